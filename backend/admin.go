@@ -0,0 +1,352 @@
+//-------------------------------------------------------
+// backend/admin.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Operational API under /admin, guarded by a separate admin key:
+//       GET/POST /admin/read-only     view / toggle read-only mode
+//       GET/POST /admin/maintenance   maintenance mode (maintenance.go)
+//       GET      /admin/config        effective configuration
+//       POST     /admin/config/reload reload the config file
+//       POST     /admin/backup        archive all notes and metadata
+//       POST     /admin/logs/rotate   archive and hash past audit logs
+//       GET      /admin/stats         latency and SLO summary
+//       GET      /admin/alerts        anomaly alerts (see anomaly.go)
+//       GET      /admin/lockouts      login throttle state
+//       POST     /admin/lockouts/clear clear one throttled client
+//       POST     /admin/totp/reset    remove a user's second factor
+//       GET      /admin/sessions      sessions of every user
+//       POST     /admin/sessions/revoke end sessions by id or user
+//       GET/POST /admin/fsck          metadata consistency check
+//       GET/POST /admin/sync          sync status / pull now
+//       GET      /admin/runtime       runtime diagnostics (admin_runtime.go)
+//       GET      /admin/debug/pprof/  Go profiler (admin_runtime.go)
+//       GET      /admin/probes        daily probe report (probes.go)
+//   - Read-only mode: rejects note and folder mutations with 503.
+// Audit:
+//   - Every action writes a dedicated "admin.*" audit event; failed
+//     authorization writes "admin.auth_denied".
+//   - With no admin_key configured the admin API is disabled (403).
+//   - The key is compared in constant time and never logged.
+//   - Wrong keys count towards the client's login throttle.
+// Configuration:
+//   - admin_key / ADMIN_KEY   bearer key for /admin (>= 16 chars).
+//   - backup_dir / BACKUP_DIR destination for /admin/backup.
+//   - read_only / READ_ONLY   start in read-only mode.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync/atomic"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/handlers"
+)
+
+// adminPrefix groups all operational routes behind AdminMiddleware.
+const adminPrefix = "/admin/"
+
+// syncPrefix groups the instance-to-instance routes behind SyncMiddleware.
+const syncPrefix = "/sync/"
+
+// readOnly is 1 while note and folder mutations are refused.
+var readOnly int32
+
+// readOnlySafeRoutes are non-GET routes that never modify notes.
+var readOnlySafeRoutes = map[string]bool{
+    "/auth/login":               true,
+    "/auth/logout":              true,
+    "/auth/sessions/revoke":     true,
+    "/auth/totp/enroll":         true,
+    "/auth/totp/confirm":        true,
+    "/auth/totp/recovery-codes": true,
+    "/auth/totp/disable":        true,
+    "/files/download":           true,
+    "/scratch":                  true,
+}
+
+//-------------------------------------------------------
+// Function: auditAdmin
+//-------------------------------------------------------
+// Purpose:
+//   - Write a dedicated audit event for an admin action.
+//-------------------------------------------------------
+func auditAdmin(r *http.Request, event string, status int, target string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Target:   target,
+        Detail:   detail,
+    })
+}
+
+//-------------------------------------------------------
+// Function: requireBearer
+//-------------------------------------------------------
+// Purpose:
+//   - Shared bearer-key check for the admin and sync APIs.
+// Audit:
+//   - 403 when no key is configured, 401 on a missing or wrong key;
+//     both write "<scope>.auth_denied".
+//   - The key is compared in constant time and never logged.
+//-------------------------------------------------------
+func requireBearer(scope string, label string, key func() string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        expected := key()
+        if expected == "" {
+            auditAdmin(r, scope+".auth_denied", http.StatusForbidden, "", scope+" API disabled: no key configured")
+            apierror.Write(w, r, apierror.CodeForbidden, "", label+" API disabled")
+            return
+        }
+
+        presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if presented != "" && refuseThrottled(w, r, scope) {
+            return
+        }
+        if subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+            if presented == "" {
+                auditAdmin(r, scope+".auth_denied", http.StatusUnauthorized, "", "missing "+scope+" key")
+            } else {
+                recordAuthFailure(r, scope, scope+".auth_denied", "invalid "+scope+" key")
+            }
+            w.Header().Set("WWW-Authenticate", `Bearer realm="`+scope+`"`)
+            apierror.Write(w, r, apierror.CodeUnauthorized, "", "Unauthorized")
+            return
+        }
+        auth.ThrottleReset(throttleKey(scope, r))
+        next.ServeHTTP(w, r)
+    })
+}
+
+//-------------------------------------------------------
+// Function: AdminMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Require "Authorization: Bearer <admin_key>" on admin routes.
+//-------------------------------------------------------
+func AdminMiddleware(next http.Handler) http.Handler {
+    return requireBearer("admin", "Admin", func() string { return config.Current().AdminKey }, next)
+}
+
+//-------------------------------------------------------
+// Function: SyncMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Require "Authorization: Bearer <sync.key>" on /sync routes.
+//-------------------------------------------------------
+func SyncMiddleware(next http.Handler) http.Handler {
+    return requireBearer("sync", "Sync", func() string { return config.Current().Sync.Key }, next)
+}
+
+//-------------------------------------------------------
+// Function: ReadOnlyMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Refuse mutating requests while read-only mode is on, or while
+//     this instance is a sync follower.
+// Audit:
+//   - GET/HEAD/OPTIONS, admin routes, and readOnlySafeRoutes pass.
+//   - Followers answer 503 "follower" with the primary's URL in
+//     details.primary, so clients can retry there.
+//-------------------------------------------------------
+func ReadOnlyMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        following := handlers.IsFollower()
+        if atomic.LoadInt32(&readOnly) == 1 || following {
+            switch r.Method {
+            case http.MethodGet, http.MethodHead, http.MethodOptions:
+            default:
+                if !strings.HasPrefix(r.URL.Path, adminPrefix) && !readOnlySafeRoutes[r.URL.Path] {
+                    if following {
+                        primary := config.Current().Sync.Primary
+                        apierror.WriteDetails(w, r, apierror.CodeFollower, "", "This instance is a read-only follower of "+primary, map[string]interface{}{"primary": primary})
+                        return
+                    }
+                    apierror.Write(w, r, apierror.CodeReadOnly, "", "Service is in read-only mode")
+                    return
+                }
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+//-------------------------------------------------------
+// Function: setReadOnly
+//-------------------------------------------------------
+// Purpose:
+//   - Switch read-only mode and report whether it changed.
+//-------------------------------------------------------
+func setReadOnly(enabled bool) bool {
+    value := int32(0)
+    if enabled {
+        value = 1
+    }
+    return atomic.SwapInt32(&readOnly, value) != value
+}
+
+//-------------------------------------------------------
+// Function: handleReadOnly
+//-------------------------------------------------------
+// Purpose:
+//   - GET: current mode. POST {"enabled": bool}: toggle it.
+// Audit:
+//   - POST writes "admin.read_only" with the new state.
+//-------------------------------------------------------
+func handleReadOnly(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        var req struct {
+            Enabled *bool `json:"enabled"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+            apierror.Write(w, r, apierror.CodeInvalidField, "enabled", `Bad request: expected {"enabled": true|false}`)
+            return
+        }
+        changed := setReadOnly(*req.Enabled)
+        auditAdmin(r, "admin.read_only", http.StatusOK, "", fmt.Sprintf("enabled=%t changed=%t", *req.Enabled, changed))
+        logInfo(fmt.Sprintf("Read-only mode set to %t", *req.Enabled))
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]bool{"read_only": atomic.LoadInt32(&readOnly) == 1})
+}
+
+//-------------------------------------------------------
+// Function: handleBackup
+//-------------------------------------------------------
+// Purpose:
+//   - POST: write a full backup archive to backup_dir.
+// Audit:
+//   - Writes "admin.backup" with the archive path and SHA-256
+//     (or the failure reason).
+//-------------------------------------------------------
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    result, err := handlers.CreateBackup(r.Context(), config.Current().BackupDir)
+    if err != nil {
+        logError("Backup failed: " + err.Error())
+        auditAdmin(r, "admin.backup", http.StatusInternalServerError, config.Current().BackupDir, err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Backup failed")
+        return
+    }
+
+    logInfo(fmt.Sprintf("Backup written: %s (%d files)", result.Path, result.Files))
+    auditAdmin(r, "admin.backup", http.StatusOK, result.Path, "sha256="+result.SHA256)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
+
+//-------------------------------------------------------
+// Function: handleRotateLogs
+//-------------------------------------------------------
+// Purpose:
+//   - POST: archive and hash every completed daily audit log.
+// Audit:
+//   - Writes "admin.log_rotate" listing the number of archives.
+//-------------------------------------------------------
+func handleRotateLogs(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    rotated, err := audit.Rotate()
+    if err != nil {
+        logError("Log rotation failed: " + err.Error())
+        auditAdmin(r, "admin.log_rotate", http.StatusInternalServerError, audit.LogDir,
+            fmt.Sprintf("%d rotated before error: %v", len(rotated), err))
+        apierror.Write(w, r, apierror.CodeInternal, "", "Log rotation failed")
+        return
+    }
+
+    auditAdmin(r, "admin.log_rotate", http.StatusOK, audit.LogDir, fmt.Sprintf("%d logs rotated", len(rotated)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"rotated": rotated})
+}
+
+//-------------------------------------------------------
+// Function: handleAdminStats
+//-------------------------------------------------------
+// Purpose:
+//   - GET: latency/SLO summary plus read-only state.
+// Audit:
+//   - Writes "admin.stats_view".
+//-------------------------------------------------------
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    auditAdmin(r, "admin.stats_view", http.StatusOK, "", "")
+    handleStats(w, r)
+}
+
+//-------------------------------------------------------
+// Function: handleLockouts
+//-------------------------------------------------------
+// Purpose:
+//   - GET: every throttled or locked-out key with its failures.
+// Audit:
+//   - Writes "admin.lockouts_view" with the number of keys shown.
+//-------------------------------------------------------
+func handleLockouts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    items := auth.Lockouts(audit.Clock().Now())
+    auditAdmin(r, "admin.lockouts_view", http.StatusOK, "", fmt.Sprintf("%d keys", len(items)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+}
+
+//-------------------------------------------------------
+// Function: handleLockoutClear
+//-------------------------------------------------------
+// Purpose:
+//   - POST {"key": "ip:10.0.0.5"}: forget the key's failures,
+//     ending any delay or lockout.
+// Audit:
+//   - Writes "admin.lockout_clear"; 404 if the key had none.
+//-------------------------------------------------------
+func handleLockoutClear(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Key string `json:"key"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+        apierror.Write(w, r, apierror.CodeInvalidField, "key", `Bad request: expected {"key": "ip:<address>"}`)
+        return
+    }
+    if !auth.ThrottleReset(req.Key) {
+        apierror.Write(w, r, apierror.CodeNotFound, "key", "No failures recorded for "+req.Key)
+        return
+    }
+    auditAdmin(r, "admin.lockout_clear", http.StatusOK, req.Key, "")
+    logInfo("Login throttle cleared for " + req.Key)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"cleared": req.Key})
+}
@@ -0,0 +1,232 @@
+//-------------------------------------------------------
+// backend/admin_runtime.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Runtime diagnostics for on-site performance problems, without
+//     a rebuild, behind the admin key:
+//       GET /admin/runtime            goroutines, heap, GC, open files
+//       GET /admin/debug/pprof/...    net/http/pprof profiles
+// Audit:
+//   - Both go through AdminMiddleware like every /admin route; the
+//     pprof handlers are mounted on the API mux only, never on
+//     http.DefaultServeMux (which this server does not serve).
+//   - Writes "admin.runtime_view" and "admin.pprof" (target: the
+//     profile name) audit events.
+//   - CPU profiles and traces run for ?seconds= (default 30) and are
+//     bounded by the route deadline and server.write_timeout.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "net/http"
+    "net/http/pprof"
+    "os"
+    "runtime"
+    runtimepprof "runtime/pprof"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/buildinfo"
+    "cfo-scratchpad/tracing"
+)
+
+// pprofPrefix is where the profiling handlers are mounted.
+const pprofPrefix = "/admin/debug/pprof/"
+
+// processStarted is when this process began serving, for uptime.
+var processStarted = time.Now()
+
+//-------------------------------------------------------
+// Struct: RuntimeStats
+//-------------------------------------------------------
+// Purpose:
+//   - Response body of GET /admin/runtime. Byte figures are bytes;
+//     open file fields are -1 where /proc is unavailable.
+//-------------------------------------------------------
+type RuntimeStats struct {
+    Version       string    `json:"version"`
+    GoVersion     string    `json:"go_version"`
+    Started       time.Time `json:"started"`
+    UptimeSeconds int64     `json:"uptime_seconds"`
+    Goroutines    int       `json:"goroutines"`
+    GOMAXPROCS    int       `json:"gomaxprocs"`
+    NumCPU        int       `json:"num_cpu"`
+    CgoCalls      int64     `json:"cgo_calls"`
+    Heap          struct {
+        Alloc      uint64 `json:"alloc"`
+        InUse      uint64 `json:"in_use"`
+        Idle       uint64 `json:"idle"`
+        Released   uint64 `json:"released"`
+        Objects    uint64 `json:"objects"`
+        TotalAlloc uint64 `json:"total_alloc"`
+        Mallocs    uint64 `json:"mallocs"`
+        Frees      uint64 `json:"frees"`
+        Sys        uint64 `json:"sys"`
+    } `json:"heap"`
+    GC struct {
+        Count        uint32     `json:"count"`
+        Forced       uint32     `json:"forced"`
+        LastGC       *time.Time `json:"last_gc"`
+        LastPauseMs  float64    `json:"last_pause_ms"`
+        PauseTotalMs float64    `json:"pause_total_ms"`
+        NextGCBytes  uint64     `json:"next_gc_bytes"`
+        CPUFraction  float64    `json:"cpu_fraction"`
+    } `json:"gc"`
+    OpenFiles     int           `json:"open_files"`
+    OpenFileLimit int           `json:"open_file_limit"`
+    Tracing       tracing.Stats `json:"tracing"`
+}
+
+//-------------------------------------------------------
+// Function: handleAdminRuntime
+//-------------------------------------------------------
+// Purpose:
+//   - GET: a RuntimeStats snapshot of this process.
+// Audit:
+//   - Writes "admin.runtime_view". ReadMemStats briefly stops the
+//     world; it is cheap enough to poll but not meant for tight loops.
+//-------------------------------------------------------
+func handleAdminRuntime(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var mem runtime.MemStats
+    runtime.ReadMemStats(&mem)
+
+    stats := RuntimeStats{
+        Version:       buildinfo.String(),
+        GoVersion:     runtime.Version(),
+        Started:       processStarted.UTC(),
+        UptimeSeconds: int64(time.Since(processStarted).Seconds()),
+        Goroutines:    runtime.NumGoroutine(),
+        GOMAXPROCS:    runtime.GOMAXPROCS(0),
+        NumCPU:        runtime.NumCPU(),
+        CgoCalls:      runtime.NumCgoCall(),
+        OpenFiles:     countOpenFiles(),
+        OpenFileLimit: openFileLimit(),
+        Tracing:       tracing.CurrentStats(),
+    }
+    stats.Heap.Alloc = mem.HeapAlloc
+    stats.Heap.InUse = mem.HeapInuse
+    stats.Heap.Idle = mem.HeapIdle
+    stats.Heap.Released = mem.HeapReleased
+    stats.Heap.Objects = mem.HeapObjects
+    stats.Heap.TotalAlloc = mem.TotalAlloc
+    stats.Heap.Mallocs = mem.Mallocs
+    stats.Heap.Frees = mem.Frees
+    stats.Heap.Sys = mem.Sys
+    stats.GC.Count = mem.NumGC
+    stats.GC.Forced = mem.NumForcedGC
+    if mem.LastGC != 0 {
+        last := time.Unix(0, int64(mem.LastGC)).UTC()
+        stats.GC.LastGC = &last
+    }
+    if mem.NumGC > 0 {
+        stats.GC.LastPauseMs = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+    }
+    stats.GC.PauseTotalMs = float64(mem.PauseTotalNs) / 1e6
+    stats.GC.NextGCBytes = mem.NextGC
+    stats.GC.CPUFraction = mem.GCCPUFraction
+
+    auditAdmin(r, "admin.runtime_view", http.StatusOK, "", "")
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(stats)
+}
+
+//-------------------------------------------------------
+// Function: countOpenFiles
+//-------------------------------------------------------
+// Purpose:
+//   - Number of file descriptors this process holds, from
+//     /proc/self/fd; -1 where that is unavailable.
+// Audit:
+//   - The count includes the descriptor used to read the directory.
+//-------------------------------------------------------
+func countOpenFiles() int {
+    entries, err := os.ReadDir("/proc/self/fd")
+    if err != nil {
+        return -1
+    }
+    return len(entries)
+}
+
+//-------------------------------------------------------
+// Function: openFileLimit
+//-------------------------------------------------------
+// Purpose:
+//   - Soft "Max open files" limit from /proc/self/limits; -1 where
+//     that is unavailable or unlimited.
+//-------------------------------------------------------
+func openFileLimit() int {
+    f, err := os.Open("/proc/self/limits")
+    if err != nil {
+        return -1
+    }
+    defer f.Close()
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := scanner.Text()
+        if !strings.HasPrefix(line, "Max open files") {
+            continue
+        }
+        fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+        if len(fields) == 0 {
+            return -1
+        }
+        if n, err := strconv.Atoi(fields[0]); err == nil {
+            return n
+        }
+        return -1
+    }
+    return -1
+}
+
+//-------------------------------------------------------
+// Function: handlePprof
+//-------------------------------------------------------
+// Purpose:
+//   - Serve net/http/pprof under /admin/debug/pprof/: the index,
+//     cmdline, profile (CPU), symbol, trace, and every named runtime
+//     profile (heap, goroutine, allocs, block, mutex, threadcreate).
+// Audit:
+//   - pprof.Index only resolves names under /debug/pprof/, so names
+//     are dispatched here; unknown names are a 404.
+//   - Writes "admin.pprof" with the profile name ("index" for the
+//     listing) and the query (e.g. seconds=30, debug=2).
+//-------------------------------------------------------
+func handlePprof(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    name := strings.TrimPrefix(r.URL.Path, pprofPrefix)
+    var handler http.HandlerFunc
+    switch name {
+    case "":
+        handler, name = pprof.Index, "index"
+    case "cmdline":
+        handler = pprof.Cmdline
+    case "profile":
+        handler = pprof.Profile
+    case "symbol":
+        handler = pprof.Symbol
+    case "trace":
+        handler = pprof.Trace
+    default:
+        if runtimepprof.Lookup(name) == nil {
+            auditAdmin(r, "admin.pprof", http.StatusNotFound, name, "unknown profile")
+            apierror.Write(w, r, apierror.CodeNotFound, "", "Unknown profile: "+name)
+            return
+        }
+        handler = pprof.Handler(name).ServeHTTP
+    }
+    auditAdmin(r, "admin.pprof", http.StatusOK, name, r.URL.RawQuery)
+    handler(w, r)
+}
@@ -0,0 +1,405 @@
+//-------------------------------------------------------
+// backend/anomaly.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Lightweight anomaly detection over the audit stream. Every
+//     event passed to audit.Write is checked for:
+//       mass_download   one user (or IP) reading or exporting more
+//                       than max_reads notes within the window
+//       unusual_hours   a user active outside work_hours/work_days
+//       client_errors   more than max_client_errors 4xx responses
+//                       to one IP within the window
+//       large_save      a save request over large_save_bytes
+//   - Alerts are written to the evidence log as "security.anomaly"
+//     events, logged as a warning, and posted to the optional
+//     webhook. GET /admin/alerts lists them.
+// Audit:
+//   - Off unless anomaly.enabled is set. Settings are read on every
+//     event, so a config reload takes effect without a restart.
+//   - Counters live in memory only; a restart starts them afresh.
+//   - One alert per kind and subject per window (per day for
+//     unusual_hours), so a burst does not flood the log.
+//   - Events are analyzed on a background goroutine; if it falls
+//     behind by more than anomalyQueueSize events, the excess is
+//     dropped and counted rather than slowing requests down.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+const (
+    anomalyQueueSize = 4096
+    anomalyEvent     = "security.anomaly"
+    defaultAlertDays = 7
+    maxAlertDays     = 366
+    maxAlertsListed  = 1000
+)
+
+// Anomaly kinds.
+const (
+    anomalyMassDownload = "mass_download"
+    anomalyUnusualHours = "unusual_hours"
+    anomalyClientErrors = "client_errors"
+    anomalyLargeSave    = "large_save"
+)
+
+// anomalyReadEvents count toward mass_download.
+var anomalyReadEvents = map[string]bool{
+    "file.read":     true,
+    "file.export":   true,
+    "files.export":  true,
+    "file.download": true,
+}
+
+//-------------------------------------------------------
+// Struct: Alert
+//-------------------------------------------------------
+// Purpose:
+//   - One anomaly, as returned by /admin/alerts and posted to the
+//     webhook.
+// Audit:
+//   - Subject is the user, or the client IP when there is none.
+//-------------------------------------------------------
+type Alert struct {
+    At       string `json:"at"`
+    Kind     string `json:"kind"`
+    Subject  string `json:"subject"`
+    Detail   string `json:"detail"`
+    RemoteIP string `json:"remote_ip,omitempty"`
+}
+
+//-------------------------------------------------------
+// Struct: anomalyDetector
+//-------------------------------------------------------
+// Purpose:
+//   - Sliding-window counters per subject and the last alert per
+//     kind and subject.
+// Audit:
+//   - Guarded by mu; only the analyzer goroutine touches counters.
+//-------------------------------------------------------
+type anomalyDetector struct {
+    mu      sync.Mutex
+    queue   chan audit.Event
+    reads   map[string][]time.Time
+    errors  map[string][]time.Time
+    alerted map[string]time.Time
+    dropped int64
+}
+
+var anomalies = &anomalyDetector{
+    queue:   make(chan audit.Event, anomalyQueueSize),
+    reads:   map[string][]time.Time{},
+    errors:  map[string][]time.Time{},
+    alerted: map[string]time.Time{},
+}
+
+//-------------------------------------------------------
+// Function: (*anomalyDetector) observe
+//-------------------------------------------------------
+// Purpose:
+//   - audit.SetObserver callback: queue the event for analysis.
+// Audit:
+//   - Never blocks; the detector's own alerts are not re-analyzed.
+//-------------------------------------------------------
+func (d *anomalyDetector) observe(event audit.Event) {
+    if event.Event == anomalyEvent || !config.Current().Anomaly.Enabled {
+        return
+    }
+    select {
+    case d.queue <- event:
+    default:
+        atomic.AddInt64(&d.dropped, 1)
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*anomalyDetector) run
+//-------------------------------------------------------
+// Purpose:
+//   - Analyze queued events for the life of the process.
+//-------------------------------------------------------
+func (d *anomalyDetector) run() {
+    for event := range d.queue {
+        d.check(event, config.Current().Anomaly)
+    }
+}
+
+// clientIP strips the port from an audit RemoteIP.
+func clientIP(remote string) string {
+    if host, _, err := net.SplitHostPort(remote); err == nil {
+        return host
+    }
+    return remote
+}
+
+// pushWindow appends at to list, drops entries before cutoff and
+// keeps at most limit+1 (enough to tell a breach).
+func pushWindow(list []time.Time, at time.Time, cutoff time.Time, limit int) []time.Time {
+    list = append(list, at)
+    i := 0
+    for i < len(list) && list[i].Before(cutoff) {
+        i++
+    }
+    list = list[i:]
+    if len(list) > limit+1 {
+        list = list[len(list)-limit-1:]
+    }
+    return list
+}
+
+//-------------------------------------------------------
+// Function: (*anomalyDetector) check
+//-------------------------------------------------------
+// Purpose:
+//   - Run every check against one event and raise what it trips.
+//-------------------------------------------------------
+func (d *anomalyDetector) check(event audit.Event, cfg config.AnomalyConfig) {
+    at, err := time.Parse(time.RFC3339, event.Timestamp)
+    if err != nil {
+        at = audit.Clock().Now().UTC()
+    }
+    window := cfg.Window.Std()
+    cutoff := at.Add(-window)
+    ip := clientIP(event.RemoteIP)
+    subject := event.Actor
+    if subject == "" {
+        subject = ip
+    }
+
+    alerts := []Alert{}
+    d.mu.Lock()
+    d.forget(cutoff)
+    if anomalyReadEvents[event.Event] && subject != "" {
+        d.reads[subject] = pushWindow(d.reads[subject], at, cutoff, cfg.MaxReads)
+        if len(d.reads[subject]) > cfg.MaxReads && d.fire(anomalyMassDownload, subject, at, window) {
+            alerts = append(alerts, Alert{Kind: anomalyMassDownload, Subject: subject, Detail: fmt.Sprintf("more than %d reads or exports within %s", cfg.MaxReads, window)})
+        }
+    }
+    if event.Event == "" && event.Status >= 400 && event.Status < 500 && ip != "" {
+        d.errors[ip] = pushWindow(d.errors[ip], at, cutoff, cfg.MaxClientErrors)
+        if len(d.errors[ip]) > cfg.MaxClientErrors && d.fire(anomalyClientErrors, ip, at, window) {
+            alerts = append(alerts, Alert{Kind: anomalyClientErrors, Subject: ip, Detail: fmt.Sprintf("more than %d 4xx responses within %s (last: %d %s %s)", cfg.MaxClientErrors, window, event.Status, event.Method, event.Path)})
+        }
+    }
+    if event.Event == "" && event.Path == "/file/save" && event.RequestBytes > cfg.LargeSaveBytes && d.fire(anomalyLargeSave, ip, at, window) {
+        alerts = append(alerts, Alert{Kind: anomalyLargeSave, Subject: ip, Detail: fmt.Sprintf("%s of %d bytes (limit %d), status %d", event.Path, event.RequestBytes, cfg.LargeSaveBytes, event.Status)})
+    }
+    if event.Actor != "" && cfg.WorkHours != "" && offHours(at, cfg) && d.fire(anomalyUnusualHours, event.Actor, at, 0) {
+        alerts = append(alerts, Alert{Kind: anomalyUnusualHours, Subject: event.Actor, Detail: fmt.Sprintf("%s %s at %s, outside %s %s", event.Event, event.Target, at.Format(time.RFC3339), cfg.WorkHours, cfg.Timezone)})
+    }
+    d.mu.Unlock()
+
+    for _, alert := range alerts {
+        alert.At = at.UTC().Format(time.RFC3339)
+        alert.RemoteIP = event.RemoteIP
+        raiseAlert(alert, cfg)
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*anomalyDetector) fire
+//-------------------------------------------------------
+// Purpose:
+//   - Whether kind may alert for subject now; records it if so.
+// Audit:
+//   - window 0 means once per UTC day. Caller holds mu.
+//-------------------------------------------------------
+func (d *anomalyDetector) fire(kind string, subject string, at time.Time, window time.Duration) bool {
+    key := kind + "|" + subject
+    if last, ok := d.alerted[key]; ok {
+        if window == 0 && last.UTC().Format("2006-01-02") == at.UTC().Format("2006-01-02") {
+            return false
+        }
+        if window > 0 && at.Sub(last) < window {
+            return false
+        }
+    }
+    d.alerted[key] = at
+    return true
+}
+
+// forget drops counters with nothing in the window and alert marks
+// older than a day, so idle subjects do not accumulate. Caller
+// holds mu.
+func (d *anomalyDetector) forget(cutoff time.Time) {
+    for _, counters := range []map[string][]time.Time{d.reads, d.errors} {
+        for key, list := range counters {
+            if len(list) == 0 || list[len(list)-1].Before(cutoff) {
+                delete(counters, key)
+            }
+        }
+    }
+    for key, at := range d.alerted {
+        if at.Before(cutoff.Add(-24 * time.Hour)) {
+            delete(d.alerted, key)
+        }
+    }
+}
+
+//-------------------------------------------------------
+// Function: offHours
+//-------------------------------------------------------
+// Purpose:
+//   - Whether at falls outside the configured working days and
+//     hours, in the configured time zone.
+//-------------------------------------------------------
+func offHours(at time.Time, cfg config.AnomalyConfig) bool {
+    start, end, err := config.ParseWorkHours(cfg.WorkHours)
+    if err != nil {
+        return false
+    }
+    loc, err := time.LoadLocation(cfg.Timezone)
+    if err != nil {
+        loc = time.UTC
+    }
+    local := at.In(loc)
+    if len(cfg.WorkDays) > 0 {
+        workday := false
+        for _, name := range cfg.WorkDays {
+            if day, ok := config.ParseWeekday(name); ok && day == local.Weekday() {
+                workday = true
+            }
+        }
+        if !workday {
+            return true
+        }
+    }
+    minute := local.Hour()*60 + local.Minute()
+    if start < end {
+        return minute < start || minute >= end
+    }
+    return minute < start && minute >= end
+}
+
+//-------------------------------------------------------
+// Function: raiseAlert
+//-------------------------------------------------------
+// Purpose:
+//   - Record one alert: evidence event, warning line, webhook.
+// Audit:
+//   - Webhook failures are logged, never retried or fatal.
+//-------------------------------------------------------
+func raiseAlert(alert Alert, cfg config.AnomalyConfig) {
+    audit.Write(audit.Event{
+        Timestamp: alert.At,
+        Event:     anomalyEvent,
+        Method:    "ANALYZE",
+        Path:      "/admin/alerts",
+        RemoteIP:  alert.RemoteIP,
+        Actor:     alert.Subject,
+        Target:    alert.Kind,
+        Detail:    alert.Detail,
+    })
+
+    payload := map[string]interface{}{
+        "event":     "anomaly",
+        "timestamp": alert.At,
+        "kind":      alert.Kind,
+        "subject":   alert.Subject,
+        "detail":    alert.Detail,
+        "remote_ip": alert.RemoteIP,
+    }
+    body, err := json.Marshal(payload)
+    if err != nil {
+        logError("Anomaly alert encode failed: " + err.Error())
+        return
+    }
+    logWarn(string(body))
+
+    if cfg.WebhookURL == "" {
+        return
+    }
+    go func() {
+        client := &http.Client{Timeout: 5 * time.Second}
+        resp, err := client.Post(cfg.WebhookURL, "application/json", bytes.NewReader(body))
+        if err != nil {
+            logError("Anomaly webhook failed: " + err.Error())
+            return
+        }
+        resp.Body.Close()
+        if resp.StatusCode >= 300 {
+            logError(fmt.Sprintf("Anomaly webhook returned HTTP %d", resp.StatusCode))
+        }
+    }()
+}
+
+//-------------------------------------------------------
+// Function: handleAlerts
+//-------------------------------------------------------
+// Purpose:
+//   - GET /admin/alerts?days=7&kind=...: alerts from the evidence
+//     log, newest first, with the detector's settings.
+// Audit:
+//   - Read-only; at most maxAlertsListed alerts (truncated).
+//-------------------------------------------------------
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    q := r.URL.Query()
+    days := defaultAlertDays
+    if v := q.Get("days"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > maxAlertDays {
+            apierror.Write(w, r, apierror.CodeInvalidField, "days", fmt.Sprintf("Bad request: days must be 1-%d", maxAlertDays))
+            return
+        }
+        days = n
+    }
+    kinds := map[string]bool{}
+    if v := q.Get("kind"); v != "" {
+        for _, kind := range strings.Split(v, ",") {
+            kinds[kind] = true
+        }
+    }
+
+    since := audit.Clock().Now().UTC().AddDate(0, 0, -days)
+    first := since.Format(time.RFC3339)
+    alerts := []Alert{}
+    err := audit.Scan(since, func(event audit.Event, ref string) {
+        if event.Event != anomalyEvent || event.Timestamp < first {
+            return
+        }
+        if len(kinds) > 0 && !kinds[event.Target] {
+            return
+        }
+        alerts = append(alerts, Alert{At: event.Timestamp, Kind: event.Target, Subject: event.Actor, Detail: event.Detail, RemoteIP: event.RemoteIP})
+    })
+    if err != nil {
+        logError("Failed to read alerts: " + err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Failed to read alerts")
+        return
+    }
+    sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].At > alerts[j].At })
+    truncated := len(alerts) > maxAlertsListed
+    if truncated {
+        alerts = alerts[:maxAlertsListed]
+    }
+
+    cfg := config.Current().Anomaly
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "enabled":   cfg.Enabled,
+        "alerts":    alerts,
+        "truncated": truncated,
+        "dropped":   atomic.LoadInt64(&anomalies.dropped),
+    })
+}
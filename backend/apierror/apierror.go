@@ -0,0 +1,218 @@
+//-------------------------------------------------------
+// backend/apierror/apierror.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Machine-readable API errors: every failed request answers
+//     {"code", "field", "message", "request_id"} as JSON instead
+//     of a plain-text string.
+//   - The error code catalog (Catalog, docs/error-codes.md) that
+//     clients can rely on; each code maps to exactly one status.
+//   - Per-request IDs carried on the context, echoed in the
+//     X-Request-ID header, error bodies, and audit events.
+// Audit:
+//   - Codes are stable identifiers; messages are for humans and may
+//     change. New codes are only ever added, never renamed.
+//-------------------------------------------------------
+
+package apierror
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+// Error codes. See Catalog for the status and meaning of each.
+const (
+    CodeInvalidJSON          = "invalid_json"
+    CodeMissingField         = "missing_field"
+    CodeInvalidField         = "invalid_field"
+    CodeInvalidPath          = "invalid_path"
+    CodeInvalidContent       = "invalid_content"
+    CodeMalwareDetected      = "malware_detected"
+    CodeInvalidConfig        = "invalid_config"
+    CodeIdempotencyKeyReused = "idempotency_key_reused"
+    CodeUnauthorized         = "unauthorized"
+    CodeForbidden            = "forbidden"
+    CodeMFARequired          = "mfa_required"
+    CodeCSRFFailed           = "csrf_failed"
+    CodeIPDenied             = "ip_denied"
+    CodeUnsafePath           = "unsafe_path"
+    CodeLedgerViolation      = "ledger_violation"
+    CodeNotFound             = "not_found"
+    CodeMethodNotAllowed     = "method_not_allowed"
+    CodeConflict             = "conflict"
+    CodePayloadTooLarge      = "payload_too_large"
+    CodeLocked               = "locked"
+    CodeLegalHold            = "legal_hold"
+    CodeRateLimited          = "rate_limited"
+    CodeInternal             = "internal"
+    CodeUpstreamFailed       = "upstream_failed"
+    CodeReadOnly             = "read_only"
+    CodeMaintenance          = "maintenance"
+    CodeFollower             = "follower"
+    CodeUnavailable          = "unavailable"
+    CodeStorageTimeout       = "storage_timeout"
+)
+
+//-------------------------------------------------------
+// Struct: Entry
+//-------------------------------------------------------
+// Purpose:
+//   - One documented error code and its HTTP status.
+//-------------------------------------------------------
+type Entry struct {
+    Code        string `json:"code"`
+    Status      int    `json:"status"`
+    Description string `json:"description"`
+}
+
+// Catalog lists every code the API returns.
+var Catalog = []Entry{
+    {CodeInvalidJSON, http.StatusBadRequest, "Body is not valid JSON, has unknown fields, or a field has the wrong type (field names it when known)."},
+    {CodeMissingField, http.StatusBadRequest, "A required field or query parameter is absent or empty."},
+    {CodeInvalidField, http.StatusBadRequest, "A field or query parameter has an out-of-range or unsupported value."},
+    {CodeInvalidPath, http.StatusBadRequest, "A note or folder path is malformed, escapes the scratch root, or breaks the naming rules."},
+    {CodeInvalidContent, http.StatusUnprocessableEntity, "Note content is rejected: not valid UTF-8 (details.offset is the first bad byte), refused by a save processor (details.processor), an executable or active HTML the folder's content_policy does not allow (details.kind), or an import or attachment that cannot be converted (not a .docx, not a supported image)."},
+    {CodeMalwareDetected, http.StatusUnprocessableEntity, "The antivirus scanner flagged the upload; it was quarantined, not stored (details.signature, details.quarantine_id)."},
+    {CodeInvalidConfig, http.StatusUnprocessableEntity, "The configuration file failed validation on reload; the running configuration is kept."},
+    {CodeIdempotencyKeyReused, http.StatusUnprocessableEntity, "The Idempotency-Key was already used for a different request (method, path, query, or body)."},
+    {CodeUnauthorized, http.StatusUnauthorized, "Missing or unknown token, or the action needs a user token."},
+    {CodeForbidden, http.StatusForbidden, "Authenticated but not allowed: missing role, wrong key, or the API is disabled."},
+    {CodeMFARequired, http.StatusForbidden, "The user's role requires two-factor authentication: enroll at /auth/totp/enroll and use a session token from /auth/login."},
+    {CodeCSRFFailed, http.StatusForbidden, "A cookie-authenticated write lacks a valid X-CSRF-Token header (the scratchpad_csrf cookie value)."},
+    {CodeIPDenied, http.StatusForbidden, "The client address is on ip_access.deny or missing from ip_access.allow."},
+    {CodeUnsafePath, http.StatusForbidden, "The path is a symlink or special file."},
+    {CodeLedgerViolation, http.StatusForbidden, "The change would rewrite or remove existing ledger lines."},
+    {CodeNotFound, http.StatusNotFound, "The note, folder, trash item, conflict, or thread does not exist."},
+    {CodeMethodNotAllowed, http.StatusMethodNotAllowed, "The endpoint does not support this HTTP method."},
+    {CodeConflict, http.StatusConflict, "The destination exists, the resource is in the wrong state, or a save lost to a concurrent edit (details.conflict_path)."},
+    {CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "The request body (or, for /file/audio, the note's text) exceeds the endpoint's limit."},
+    {CodeLocked, http.StatusLocked, "The target is read-only (archived folder or approved note)."},
+    {CodeLegalHold, http.StatusLocked, "The path is under legal hold and cannot be deleted, moved, or purged until an admin releases it."},
+    {CodeRateLimited, http.StatusTooManyRequests, "Too many failed authentication attempts; retry after the Retry-After header (seconds)."},
+    {CodeInternal, http.StatusInternalServerError, "Unexpected server failure; quote request_id when reporting it."},
+    {CodeUpstreamFailed, http.StatusBadGateway, "A call to another instance (sync primary), the text-to-speech backend, or a read processor failed."},
+    {CodeReadOnly, http.StatusServiceUnavailable, "The service is in read-only mode."},
+    {CodeMaintenance, http.StatusServiceUnavailable, "The service is in maintenance mode; retry after the Retry-After header (seconds) when present."},
+    {CodeFollower, http.StatusServiceUnavailable, "This instance is a read-only follower; send writes to the primary (details.primary)."},
+    {CodeUnavailable, http.StatusServiceUnavailable, "A dependency is unavailable (e.g. frontend assets failed verification, or the antivirus scanner cannot be reached)."},
+    {CodeStorageTimeout, http.StatusGatewayTimeout, "Storage did not answer before the request deadline."},
+}
+
+// statusByCode indexes Catalog.
+var statusByCode = func() map[string]int {
+    m := map[string]int{}
+    for _, entry := range Catalog {
+        m[entry.Code] = entry.Status
+    }
+    return m
+}()
+
+//-------------------------------------------------------
+// Struct: Error
+//-------------------------------------------------------
+// Purpose:
+//   - JSON body of every error response.
+// Audit:
+//   - Field is "" when the error is not about one input.
+//   - Details carries code-specific data (e.g. a conflict copy's
+//     path) and is omitted when empty.
+//-------------------------------------------------------
+type Error struct {
+    Code      string                 `json:"code"`
+    Field     string                 `json:"field"`
+    Message   string                 `json:"message"`
+    RequestID string                 `json:"request_id"`
+    Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+//-------------------------------------------------------
+// Function: Status
+//-------------------------------------------------------
+// Purpose:
+//   - The HTTP status for code (500 for unknown codes).
+//-------------------------------------------------------
+func Status(code string) int {
+    if status, ok := statusByCode[code]; ok {
+        return status
+    }
+    return http.StatusInternalServerError
+}
+
+//-------------------------------------------------------
+// Function: Write
+//-------------------------------------------------------
+// Purpose:
+//   - Send an error response with code's status.
+// Audit:
+//   - Like http.Error, headers set earlier by the handler are kept
+//     and the body is never sniffed as HTML.
+//-------------------------------------------------------
+func Write(w http.ResponseWriter, r *http.Request, code string, field string, message string) {
+    WriteDetails(w, r, code, field, message, nil)
+}
+
+//-------------------------------------------------------
+// Function: WriteDetails
+//-------------------------------------------------------
+// Purpose:
+//   - Write with code-specific details.
+//-------------------------------------------------------
+func WriteDetails(w http.ResponseWriter, r *http.Request, code string, field string, message string, details map[string]interface{}) {
+    h := w.Header()
+    h.Del("Content-Length")
+    h.Set("Content-Type", "application/json; charset=utf-8")
+    h.Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(Status(code))
+    json.NewEncoder(w).Encode(Error{
+        Code:      code,
+        Field:     field,
+        Message:   message,
+        RequestID: RequestID(r.Context()),
+        Details:   details,
+    })
+}
+
+type requestIDKey struct{}
+
+//-------------------------------------------------------
+// Function: WithRequestID
+//-------------------------------------------------------
+// Purpose:
+//   - Attach a request ID to ctx.
+//-------------------------------------------------------
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+//-------------------------------------------------------
+// Function: RequestID
+//-------------------------------------------------------
+// Purpose:
+//   - The request ID on ctx, or "" outside a request.
+//-------------------------------------------------------
+func RequestID(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+//-------------------------------------------------------
+// Function: NewRequestID
+//-------------------------------------------------------
+// Purpose:
+//   - Generate a random 16-hex-character identifier.
+// Audit:
+//   - Falls back to a timestamp-derived ID if the system RNG fails.
+//-------------------------------------------------------
+func NewRequestID() string {
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        return fmt.Sprintf("t%015x", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(buf)
+}
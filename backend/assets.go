@@ -0,0 +1,350 @@
+//-------------------------------------------------------
+// backend/assets.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Frontend asset integrity: a manifest of SHA-256 hashes of
+//     every file under ./frontend is generated at build time
+//     (`cfo-scratchpad asset-manifest`), verified at startup and on
+//     config reload, and enforced when serving static files.
+// Audit:
+//   - Differences (modified, missing, unexpected files) are logged
+//     as errors and audited as "security.asset_integrity"; serving a
+//     blocked file is audited as "security.asset_blocked".
+//   - In "enforce" mode only files listed in the manifest with an
+//     unchanged hash are served; everything else answers 503. In
+//     "warn" mode assets are served regardless.
+//   - The last verification result is reported by /readyz.
+// Configuration:
+//   - asset_integrity (ASSET_INTEGRITY): enforce | warn | off.
+//   - asset_manifest (ASSET_MANIFEST): manifest path.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "io/fs"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync/atomic"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+// Asset verification outcomes.
+const (
+    assetsVerified   = "verified"
+    assetsTampered   = "tampered"
+    assetsUnverified = "unverified"
+    assetsDisabled   = "disabled"
+)
+
+//-------------------------------------------------------
+// Struct: assetManifest
+//-------------------------------------------------------
+// Purpose:
+//   - On-disk manifest: slash-separated path -> SHA-256 hex.
+//-------------------------------------------------------
+type assetManifest struct {
+    Version     int               `json:"version"`
+    GeneratedAt string            `json:"generated_at"`
+    Files       map[string]string `json:"files"`
+}
+
+//-------------------------------------------------------
+// Struct: AssetReport
+//-------------------------------------------------------
+// Purpose:
+//   - Result of the last asset verification.
+// Audit:
+//   - Status is verified, tampered, unverified (manifest missing or
+//     unreadable), or disabled (asset_integrity off).
+//-------------------------------------------------------
+type AssetReport struct {
+    Status     string   `json:"status"`
+    Mode       string   `json:"mode"`
+    Manifest   string   `json:"manifest"`
+    CheckedAt  string   `json:"checked_at"`
+    Files      int      `json:"files"`
+    Modified   []string `json:"modified"`
+    Missing    []string `json:"missing"`
+    Unexpected []string `json:"unexpected"`
+    Error      string   `json:"error,omitempty"`
+
+    // trusted holds the hashes that may be served in enforce mode.
+    trusted map[string]string
+}
+
+// assetState holds the current *AssetReport.
+var assetState atomic.Value
+
+// currentAssetReport returns the last verification result.
+func currentAssetReport() *AssetReport {
+    if report, ok := assetState.Load().(*AssetReport); ok {
+        return report
+    }
+    return &AssetReport{Status: assetsUnverified, Modified: []string{}, Missing: []string{}, Unexpected: []string{}}
+}
+
+//-------------------------------------------------------
+// Function: hashAssetTree
+//-------------------------------------------------------
+// Purpose:
+//   - SHA-256 of every regular file below dir, keyed by its
+//     slash-separated relative path.
+// Audit:
+//   - Non-regular entries (symlinks, devices) are returned in
+//     others so verification can flag them.
+//-------------------------------------------------------
+func hashAssetTree(dir string) (map[string]string, []string, error) {
+    hashes := map[string]string{}
+    others := []string{}
+    err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            return nil
+        }
+        rel, err := filepath.Rel(dir, p)
+        if err != nil {
+            return err
+        }
+        rel = filepath.ToSlash(rel)
+        if !d.Type().IsRegular() {
+            others = append(others, rel)
+            return nil
+        }
+        sum, err := hashAssetFile(p)
+        if err != nil {
+            return err
+        }
+        hashes[rel] = sum
+        return nil
+    })
+    return hashes, others, err
+}
+
+func hashAssetFile(p string) (string, error) {
+    f, err := os.Open(p)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    h := sha256.New()
+    if _, err := io.Copy(h, f); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//-------------------------------------------------------
+// Function: verifyAssets
+//-------------------------------------------------------
+// Purpose:
+//   - Compare staticDirPath against the configured manifest, store
+//     the result for serving and /readyz, and log/audit problems.
+//-------------------------------------------------------
+func verifyAssets(cfg *config.Config) *AssetReport {
+    report := &AssetReport{
+        Status:     assetsVerified,
+        Mode:       cfg.AssetIntegrity,
+        Manifest:   cfg.AssetManifest,
+        CheckedAt:  utcNow(),
+        Modified:   []string{},
+        Missing:    []string{},
+        Unexpected: []string{},
+        trusted:    map[string]string{},
+    }
+    defer assetState.Store(report)
+
+    if cfg.AssetIntegrity == "off" {
+        report.Status = assetsDisabled
+        logInfo("Frontend asset verification disabled (asset_integrity off)")
+        return report
+    }
+
+    var manifest assetManifest
+    data, err := ioutil.ReadFile(cfg.AssetManifest)
+    if err == nil {
+        err = json.Unmarshal(data, &manifest)
+    }
+    if err == nil && manifest.Files == nil {
+        err = fmt.Errorf("manifest lists no files")
+    }
+    if err != nil {
+        report.Status = assetsUnverified
+        report.Error = err.Error()
+        logError("Frontend assets unverified: manifest " + cfg.AssetManifest + ": " + err.Error())
+        auditAssets(report)
+        return report
+    }
+
+    actual, others, err := hashAssetTree(staticDirPath)
+    if err != nil {
+        report.Status = assetsUnverified
+        report.Error = err.Error()
+        logError("Frontend assets unverified: " + err.Error())
+        auditAssets(report)
+        return report
+    }
+
+    for name, want := range manifest.Files {
+        got, ok := actual[name]
+        switch {
+        case !ok:
+            report.Missing = append(report.Missing, name)
+        case got != want:
+            report.Modified = append(report.Modified, name)
+        default:
+            report.trusted[name] = want
+        }
+    }
+    for name := range actual {
+        if _, listed := manifest.Files[name]; !listed {
+            report.Unexpected = append(report.Unexpected, name)
+        }
+    }
+    report.Unexpected = append(report.Unexpected, others...)
+    sort.Strings(report.Modified)
+    sort.Strings(report.Missing)
+    sort.Strings(report.Unexpected)
+    report.Files = len(report.trusted)
+
+    if len(report.Modified)+len(report.Missing)+len(report.Unexpected) > 0 {
+        report.Status = assetsTampered
+        for _, name := range report.Modified {
+            logError("FRONTEND ASSET MODIFIED: " + name)
+        }
+        for _, name := range report.Missing {
+            logError("FRONTEND ASSET MISSING: " + name)
+        }
+        for _, name := range report.Unexpected {
+            logError("FRONTEND ASSET NOT IN MANIFEST: " + name)
+        }
+        if cfg.AssetIntegrity == "enforce" {
+            logError("Refusing to serve frontend assets that failed verification (asset_integrity enforce)")
+        }
+        auditAssets(report)
+        return report
+    }
+
+    logInfo(fmt.Sprintf("Frontend assets verified: %d files match %s", report.Files, cfg.AssetManifest))
+    return report
+}
+
+// auditAssets records a failed or incomplete verification.
+func auditAssets(report *AssetReport) {
+    detail := report.Error
+    if detail == "" {
+        detail = fmt.Sprintf("modified=%v missing=%v unexpected=%v", report.Modified, report.Missing, report.Unexpected)
+    }
+    audit.Write(audit.Event{
+        Event:  "security.asset_integrity",
+        Method: "VERIFY",
+        Path:   staticDirPath,
+        Status: http.StatusServiceUnavailable,
+        Target: report.Manifest,
+        Detail: fmt.Sprintf("status=%s mode=%s %s", report.Status, report.Mode, detail),
+    })
+}
+
+//-------------------------------------------------------
+// Function: AssetIntegrityMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - In enforce mode, serve a static file only if it was verified
+//     against the manifest.
+// Audit:
+//   - Directory requests are checked as their index.html, which is
+//     what http.FileServer serves for them.
+//   - Each blocked file writes "security.asset_blocked".
+//-------------------------------------------------------
+func AssetIntegrityMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        report := currentAssetReport()
+        if report.Mode != "enforce" {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        name := assetName(r)
+        if _, ok := report.trusted[name]; !ok {
+            logError("Blocked unverified frontend asset: " + name)
+            audit.WriteContext(r.Context(), audit.Event{
+                Event:    "security.asset_blocked",
+                Method:   r.Method,
+                Path:     r.URL.Path,
+                RemoteIP: r.RemoteAddr,
+                Status:   http.StatusServiceUnavailable,
+                Target:   name,
+                Detail:   "asset not verified against " + report.Manifest,
+            })
+            apierror.Write(w, r, apierror.CodeUnavailable, "", "Asset failed integrity verification")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// assetName is the file below the frontend directory r asks for;
+// directories resolve to their index.html, as http.FileServer does.
+func assetName(r *http.Request) string {
+    name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+    if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+        name = path.Join(name, "index.html")
+    }
+    return name
+}
+
+//-------------------------------------------------------
+// Function: runAssetManifestCommand
+//-------------------------------------------------------
+// Purpose:
+//   - Build step: hash every file under -dir and write the manifest
+//     to -out.
+// Audit:
+//   - Refuses trees with symlinks or other non-regular files.
+//-------------------------------------------------------
+func runAssetManifestCommand(args []string) int {
+    flags := flag.NewFlagSet("asset-manifest", flag.ContinueOnError)
+    dir := flags.String("dir", staticDirPath, "frontend directory to hash")
+    out := flags.String("out", "./asset-manifest.json", "manifest file to write")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+
+    hashes, others, err := hashAssetTree(*dir)
+    if err != nil {
+        logError("asset-manifest failed: " + err.Error())
+        return 2
+    }
+    if len(others) > 0 {
+        logError("asset-manifest: non-regular files in " + *dir + ": " + strings.Join(others, ", "))
+        return 2
+    }
+
+    data, err := json.MarshalIndent(assetManifest{Version: 1, GeneratedAt: utcNow(), Files: hashes}, "", "  ")
+    if err != nil {
+        logError("asset-manifest failed: " + err.Error())
+        return 2
+    }
+    if err := ioutil.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+        logError("asset-manifest failed: " + err.Error())
+        return 2
+    }
+    logInfo(fmt.Sprintf("Wrote asset manifest %s (%d files)", *out, len(hashes)))
+    return 0
+}
@@ -0,0 +1,282 @@
+//-------------------------------------------------------
+// backend/audit/audit.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Shared audit event schema and append-only evidence writer.
+//   - Used by the HTTP middleware (one event per request) and by
+//     handlers that record domain or security events.
+// Audit:
+//   - Appends JSON records to /evidence/logs/requests_YYYY-MM-DD.log.
+//   - Emits UTC ISO 8601 timestamps for every action and error.
+//   - Never creates or modifies directories.
+//   - Fails safe if /evidence/logs/ is missing or unwritable.
+//   - With durable_writes (SetDurable), every event is fsynced
+//     before Write returns.
+// Compliance:
+//   - Required under PNCRL-AUDIT-1.0 non-commercial license terms.
+//   - Evidence logs must be retained and hashed per rotation policy.
+//-------------------------------------------------------
+
+package audit
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log"
+    "os"
+    "path/filepath"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/buildinfo"
+    "cfo-scratchpad/clock"
+    "cfo-scratchpad/tracing"
+)
+
+// LogDir is the pre-existing evidence directory receiving daily logs.
+const LogDir = "/evidence/logs"
+
+//-------------------------------------------------------
+// Struct: Event
+//-------------------------------------------------------
+// Purpose:
+//   - Define a consistent JSON schema for auditable events.
+// Audit:
+//   - One event per line in /evidence/logs/requests_YYYY-MM-DD.log.
+//   - Immutable once written (append-only).
+//   - Request events leave Event empty; domain and security events
+//     set Event (e.g. "security.symlink_blocked") plus Target/Detail.
+//   - Actor names the authenticated user behind a domain event.
+//   - Version identifies the build that wrote the event.
+//   - RequestID (request events) matches the X-Request-ID header and
+//     the request_id of an error response.
+//   - RequestBytes (request events) is the declared request body
+//     size, when the client sent one.
+//   - Category (request events) tells API calls, static asset hits
+//     and suspicious probes apart (CategoryAPI/Static/Probe).
+//-------------------------------------------------------
+type Event struct {
+    Timestamp     string `json:"timestamp"`
+    Event         string `json:"event,omitempty"`
+    Method        string `json:"method"`
+    Path          string `json:"path"`
+    RemoteIP      string `json:"remote_ip"`
+    Status        int    `json:"status"`
+    Duration      int64  `json:"duration_ms"`
+    Actor         string `json:"actor,omitempty"`
+    Target        string `json:"target,omitempty"`
+    Detail        string `json:"detail,omitempty"`
+    Panic         bool   `json:"panic,omitempty"`
+    TimedOut      bool   `json:"timed_out,omitempty"`
+    CorrelationID string `json:"correlation_id,omitempty"`
+    RequestID     string `json:"request_id,omitempty"`
+    RequestBytes  int64  `json:"request_bytes,omitempty"`
+    Category      string `json:"category,omitempty"`
+    Version       string `json:"version"`
+}
+
+// Request event categories.
+const (
+    CategoryAPI    = "api"
+    CategoryStatic = "static"
+    CategoryProbe  = "probe"
+)
+
+// writeMu serializes appends so concurrent events never interleave.
+var writeMu sync.Mutex
+
+// evidenceClock holds the clock.Clock behind event timestamps.
+var evidenceClock atomic.Value
+
+//-------------------------------------------------------
+// Function: SetClock
+//-------------------------------------------------------
+// Purpose:
+//   - Inject the clock used for event timestamps and daily log
+//     file names (clock.System until set).
+// Audit:
+//   - Call before serving; audit replay pins it with clock.Fixed.
+//-------------------------------------------------------
+func SetClock(c clock.Clock) {
+    evidenceClock.Store(&c)
+}
+
+// durable reports whether each event must be fsynced (durable_writes).
+var durable atomic.Value
+
+//-------------------------------------------------------
+// Function: SetDurable
+//-------------------------------------------------------
+// Purpose:
+//   - Inject the durable_writes switch, read on every event so a
+//     config reload takes effect immediately.
+// Audit:
+//   - When it reports true, Write fsyncs the log file (and the log
+//     directory when the daily file is created) before returning.
+//-------------------------------------------------------
+func SetDurable(fn func() bool) {
+    durable.Store(fn)
+}
+
+// observer receives every event passed to Write (see SetObserver).
+var observer atomic.Value
+
+//-------------------------------------------------------
+// Function: SetObserver
+//-------------------------------------------------------
+// Purpose:
+//   - Register fn to see every event as it is written, for
+//     analyzers over the audit stream (anomaly detection).
+// Audit:
+//   - fn runs on the writer's goroutine before the event is
+//     appended and must not block; it may call Write itself.
+//   - fn sees events even when /evidence/logs is unavailable.
+//-------------------------------------------------------
+func SetObserver(fn func(Event)) {
+    observer.Store(fn)
+}
+
+//-------------------------------------------------------
+// Function: Clock
+//-------------------------------------------------------
+// Purpose:
+//   - The injected evidence clock.
+//-------------------------------------------------------
+func Clock() clock.Clock {
+    if c, ok := evidenceClock.Load().(*clock.Clock); ok {
+        return *c
+    }
+    return clock.System{}
+}
+
+//-------------------------------------------------------
+// Function: Now
+//-------------------------------------------------------
+// Purpose:
+//   - Current UTC time formatted for Event.Timestamp.
+//-------------------------------------------------------
+func Now() string {
+    return Clock().Now().UTC().Format(time.RFC3339)
+}
+
+//-------------------------------------------------------
+// Function: Write
+//-------------------------------------------------------
+// Purpose:
+//   - Append JSON audit events to daily evidence logs.
+// Audit:
+//   - File naming: /evidence/logs/requests_YYYY-MM-DD.log
+//   - Creates the log file if missing (license-permitted).
+//   - Never creates directories; /evidence/logs must pre-exist.
+//   - Each JSON record represents one auditable transaction.
+//   - Logs [ERROR] with UTC ISO 8601 timestamp on any failure.
+//   - Passes the event to the registered observer first.
+//-------------------------------------------------------
+func Write(event Event) {
+    write(event)
+}
+
+//-------------------------------------------------------
+// Function: WriteContext
+//-------------------------------------------------------
+// Purpose:
+//   - Write, recorded as an "audit.write" span under the request's
+//     trace in ctx (see backend/tracing).
+// Audit:
+//   - The span covers the lock wait, append and any fsync, and is
+//     marked failed when the event could not be written.
+//-------------------------------------------------------
+func WriteContext(ctx context.Context, event Event) {
+    _, span := tracing.Start(ctx, "audit.write", tracing.KindInternal)
+    span.SetAttr("audit.event", defaultEvent(event.Event))
+    span.SetError(write(event))
+    span.End()
+}
+
+// defaultEvent names request events (empty Event) "request".
+func defaultEvent(name string) string {
+    if name == "" {
+        return "request"
+    }
+    return name
+}
+
+// errNotWritten reports an event that was logged as an [ERROR]
+// instead of being appended.
+var errNotWritten = errors.New("audit event not written")
+
+// write appends event; failures are logged here and returned for
+// WriteContext's span.
+func write(event Event) error {
+    if event.Timestamp == "" {
+        event.Timestamp = Now()
+    }
+    event.Version = buildinfo.String()
+    if fn, ok := observer.Load().(func(Event)); ok {
+        fn(event)
+    }
+    logFile := filepath.Join(LogDir, "requests_"+Clock().Now().UTC().Format("2006-01-02")+".log")
+
+    // Verify that /evidence/logs directory exists and is valid
+    if stat, err := os.Stat(LogDir); err != nil || !stat.IsDir() {
+        log.Printf("[ERROR] %s audit path missing or invalid: %s (%v)",
+            time.Now().UTC().Format(time.RFC3339), LogDir, err)
+        return errNotWritten
+    }
+
+    writeMu.Lock()
+    defer writeMu.Unlock()
+
+    _, statErr := os.Stat(logFile)
+    created := os.IsNotExist(statErr)
+
+    // Open or create the daily log file for appending
+    f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        log.Printf("[ERROR] %s audit open failed: %v",
+            time.Now().UTC().Format(time.RFC3339), err)
+        return err
+    }
+    defer f.Close()
+
+    // Encode event as a single JSON line
+    enc := json.NewEncoder(f)
+    if err := enc.Encode(event); err != nil {
+        log.Printf("[ERROR] %s audit encode failed: %v",
+            time.Now().UTC().Format(time.RFC3339), err)
+        return err
+    }
+
+    if fn, ok := durable.Load().(func() bool); ok && fn() {
+        if err := syncLog(f, created); err != nil {
+            log.Printf("[ERROR] %s audit fsync failed: %v",
+                time.Now().UTC().Format(time.RFC3339), err)
+            return err
+        }
+    }
+    return nil
+}
+
+//-------------------------------------------------------
+// Function: syncLog
+//-------------------------------------------------------
+// Purpose:
+//   - fsync the daily log file, and LogDir when the file is new so
+//     its directory entry survives a power cut too.
+//-------------------------------------------------------
+func syncLog(f *os.File, created bool) error {
+    if err := f.Sync(); err != nil {
+        return err
+    }
+    if !created {
+        return nil
+    }
+    dir, err := os.Open(LogDir)
+    if err != nil {
+        return err
+    }
+    defer dir.Close()
+    return dir.Sync()
+}
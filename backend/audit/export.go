@@ -0,0 +1,278 @@
+//-------------------------------------------------------
+// backend/audit/export.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Convert evidence events to the formats SIEMs ingest without
+//     custom parsers: ArcSight Common Event Format (CEF) lines and
+//     Elastic Common Schema (ECS) JSON documents.
+// Audit:
+//   - Pure conversion; the evidence logs are never modified.
+//   - Both formats carry the event's ref ("<YYYY-MM-DD>:<line>") as
+//     its id, so a re-imported range can be de-duplicated.
+//-------------------------------------------------------
+
+package audit
+
+import (
+    "encoding/json"
+    "fmt"
+    "net"
+    "strings"
+    "time"
+)
+
+// Export formats accepted by FormatEvent.
+const (
+    FormatCEF = "cef"
+    FormatECS = "ecs"
+)
+
+// ExportFormats lists the supported export formats.
+var ExportFormats = []string{FormatCEF, FormatECS}
+
+// ECSVersion is the Elastic Common Schema version ECS documents follow.
+const ECSVersion = "8.11.0"
+
+const (
+    cefVendor  = "projectfong"
+    cefProduct = "cfo-scratchpad"
+)
+
+// requestEventName names plain request records, which leave Event empty.
+const requestEventName = "http.request"
+
+// cefHeaderEscaper escapes CEF header fields ("\" and "|").
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+
+// cefValueEscaper escapes CEF extension values ("\", "=" and newlines).
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+
+//-------------------------------------------------------
+// Function: EventName
+//-------------------------------------------------------
+// Purpose:
+//   - The event's name: Event for domain and security events,
+//     "http.request" for plain request records.
+//-------------------------------------------------------
+func EventName(event Event) string {
+    if event.Event == "" {
+        return requestEventName
+    }
+    return event.Event
+}
+
+//-------------------------------------------------------
+// Function: Severity
+//-------------------------------------------------------
+// Purpose:
+//   - CEF severity (0-10) of an event: security events and
+//     lockouts are high, server errors, refused credentials and
+//     probes medium, other failures low, everything else
+//     informational.
+//-------------------------------------------------------
+func Severity(event Event) int {
+    name := EventName(event)
+    switch {
+    case strings.HasPrefix(name, "security.") || name == "auth.lockout" || event.Panic:
+        return 8
+    case event.Status >= 500:
+        return 6
+    case strings.HasPrefix(name, "auth.") && event.Status >= 400, event.Category == CategoryProbe:
+        return 5
+    case event.Status >= 400:
+        return 3
+    }
+    return 1
+}
+
+//-------------------------------------------------------
+// Function: FormatEvent
+//-------------------------------------------------------
+// Purpose:
+//   - Render one event in format (FormatCEF or FormatECS) as a
+//     single line without the trailing newline.
+// Audit:
+//   - Returns an error only for an unknown format.
+//-------------------------------------------------------
+func FormatEvent(format string, event Event, ref string) (string, error) {
+    switch format {
+    case FormatCEF:
+        return cefLine(event, ref), nil
+    case FormatECS:
+        return ecsLine(event, ref)
+    }
+    return "", fmt.Errorf("unknown export format %q", format)
+}
+
+// cefLine renders event as "CEF:0|vendor|product|version|id|name|sev|ext".
+func cefLine(event Event, ref string) string {
+    name := EventName(event)
+    header := []string{
+        "CEF:0",
+        cefHeaderEscaper.Replace(cefVendor),
+        cefHeaderEscaper.Replace(cefProduct),
+        cefHeaderEscaper.Replace(event.Version),
+        cefHeaderEscaper.Replace(name),
+        cefHeaderEscaper.Replace(name),
+        fmt.Sprint(Severity(event)),
+    }
+
+    var ext []string
+    add := func(key string, value string) {
+        if value != "" {
+            ext = append(ext, key+"="+cefValueEscaper.Replace(value))
+        }
+    }
+    if t, err := time.Parse(time.RFC3339, event.Timestamp); err == nil {
+        add("rt", fmt.Sprint(t.UnixMilli()))
+    }
+    add("externalId", ref)
+    add("src", remoteHost(event.RemoteIP))
+    add("suser", event.Actor)
+    add("requestMethod", event.Method)
+    add("request", event.Path)
+    add("outcome", outcome(event))
+    add("msg", event.Detail)
+    add("cat", event.Category)
+    if event.Status != 0 {
+        add("cn1Label", "httpStatus")
+        add("cn1", fmt.Sprint(event.Status))
+    }
+    if event.Duration != 0 {
+        add("cn2Label", "durationMs")
+        add("cn2", fmt.Sprint(event.Duration))
+    }
+    if event.Target != "" {
+        add("cs1Label", "target")
+        add("cs1", event.Target)
+    }
+    if event.RequestID != "" {
+        add("cs2Label", "requestId")
+        add("cs2", event.RequestID)
+    }
+    if event.CorrelationID != "" {
+        add("cs3Label", "correlationId")
+        add("cs3", event.CorrelationID)
+    }
+    return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// ecsLine renders event as one ECS JSON document.
+func ecsLine(event Event, ref string) (string, error) {
+    name := EventName(event)
+    ev := map[string]interface{}{
+        "kind":     "event",
+        "dataset":  "cfo_scratchpad.audit",
+        "id":       ref,
+        "action":   name,
+        "category": []string{ecsCategory(name, event.Category)},
+        "outcome":  outcome(event),
+        "severity": Severity(event),
+    }
+    if event.Duration != 0 {
+        ev["duration"] = event.Duration * int64(time.Millisecond)
+    }
+    doc := map[string]interface{}{
+        "@timestamp": event.Timestamp,
+        "ecs":        map[string]string{"version": ECSVersion},
+        "event":      ev,
+        "service":    map[string]string{"name": cefProduct, "version": event.Version},
+    }
+    if event.Detail != "" {
+        doc["message"] = event.Detail
+    }
+    if event.RemoteIP != "" {
+        doc["source"] = map[string]string{"ip": remoteHost(event.RemoteIP)}
+    }
+    if event.Actor != "" {
+        doc["user"] = map[string]string{"name": event.Actor}
+    }
+    if event.Path != "" {
+        doc["url"] = map[string]string{"path": event.Path}
+    }
+    if event.Method != "" || event.Status != 0 || event.RequestID != "" {
+        request := map[string]interface{}{}
+        if event.Method != "" {
+            request["method"] = event.Method
+        }
+        if event.RequestID != "" {
+            request["id"] = event.RequestID
+        }
+        if event.RequestBytes != 0 {
+            request["body"] = map[string]int64{"bytes": event.RequestBytes}
+        }
+        httpDoc := map[string]interface{}{"request": request}
+        if event.Status != 0 {
+            httpDoc["response"] = map[string]int{"status_code": event.Status}
+        }
+        doc["http"] = httpDoc
+    }
+    labels := map[string]string{}
+    if event.Target != "" {
+        labels["target"] = event.Target
+    }
+    if event.CorrelationID != "" {
+        labels["correlation_id"] = event.CorrelationID
+    }
+    if event.TimedOut {
+        labels["timed_out"] = "true"
+    }
+    if event.Panic {
+        labels["panic"] = "true"
+    }
+    if event.Category != "" {
+        labels["category"] = event.Category
+    }
+    if len(labels) > 0 {
+        doc["labels"] = labels
+    }
+    return marshalLine(doc)
+}
+
+// marshalLine encodes doc as compact JSON without HTML escaping.
+func marshalLine(doc interface{}) (string, error) {
+    var b strings.Builder
+    enc := json.NewEncoder(&b)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(doc); err != nil {
+        return "", err
+    }
+    return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// ecsCategory maps an event name (and request category) to its ECS
+// event.category; probes count as intrusion detection.
+func ecsCategory(name string, category string) string {
+    switch {
+    case category == CategoryProbe:
+        return "intrusion_detection"
+    case strings.HasPrefix(name, "auth."):
+        return "authentication"
+    case strings.HasPrefix(name, "security."):
+        return "intrusion_detection"
+    case strings.HasPrefix(name, "admin."):
+        return "configuration"
+    case strings.HasPrefix(name, "job."), strings.HasPrefix(name, "migration."), strings.HasPrefix(name, "sync."):
+        return "process"
+    case name == requestEventName:
+        return "web"
+    }
+    return "file"
+}
+
+// remoteHost strips the port from RemoteIP ("ip:port" on requests);
+// SIEMs expect a bare address.
+func remoteHost(addr string) string {
+    if host, _, err := net.SplitHostPort(addr); err == nil {
+        return host
+    }
+    return addr
+}
+
+// outcome is "failure" for refused or failed events, else "success".
+func outcome(event Event) string {
+    if event.Status >= 400 || event.Panic || event.TimedOut {
+        return "failure"
+    }
+    return "success"
+}
@@ -0,0 +1,116 @@
+//-------------------------------------------------------
+// backend/audit/read.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Read back evidence logs (current and rotated) for features
+//     built on recorded events, such as the activity feed.
+// Audit:
+//   - Read-only; never creates, modifies, or removes log files.
+//   - Unparseable lines (e.g. a torn final write) are skipped.
+//-------------------------------------------------------
+
+package audit
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+//-------------------------------------------------------
+// Function: Scan
+//-------------------------------------------------------
+// Purpose:
+//   - Call fn for every event logged on or after the day of since,
+//     oldest day first, in file order.
+// Audit:
+//   - ref identifies the record as "<YYYY-MM-DD>:<line>", with the
+//     line zero-padded so refs sort in file order. It stays the same
+//     after the day's log is rotated to .log.gz.
+//   - Missing LogDir yields no events and no error.
+//-------------------------------------------------------
+func Scan(since time.Time, fn func(event Event, ref string)) error {
+    entries, err := os.ReadDir(LogDir)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    first := since.UTC().Format("2006-01-02")
+    days := map[string]string{}
+    for _, entry := range entries {
+        name := entry.Name()
+        if !entry.Type().IsRegular() || !strings.HasPrefix(name, "requests_") {
+            continue
+        }
+        day := strings.TrimPrefix(name, "requests_")
+        switch {
+        case strings.HasSuffix(day, ".log.gz"):
+            day = strings.TrimSuffix(day, ".log.gz")
+        case strings.HasSuffix(day, ".log"):
+            day = strings.TrimSuffix(day, ".log")
+        default:
+            continue
+        }
+        if _, err := time.Parse("2006-01-02", day); err != nil || day < first {
+            continue
+        }
+        // Prefer the plain log if both exist mid-rotation.
+        if existing, ok := days[day]; !ok || strings.HasSuffix(existing, ".gz") {
+            days[day] = name
+        }
+    }
+
+    order := make([]string, 0, len(days))
+    for day := range days {
+        order = append(order, day)
+    }
+    sort.Strings(order)
+    for _, day := range order {
+        if err := scanFile(filepath.Join(LogDir, days[day]), day, fn); err != nil {
+            return fmt.Errorf("read %s: %v", days[day], err)
+        }
+    }
+    return nil
+}
+
+// scanFile decodes one daily log, plain or gzip-compressed.
+func scanFile(path string, day string, fn func(event Event, ref string)) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    var reader io.Reader = f
+    if strings.HasSuffix(path, ".gz") {
+        gz, err := gzip.NewReader(f)
+        if err != nil {
+            return err
+        }
+        defer gz.Close()
+        reader = gz
+    }
+
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var event Event
+        if json.Unmarshal(scanner.Bytes(), &event) != nil {
+            continue
+        }
+        fn(event, fmt.Sprintf("%s:%09d", day, line))
+    }
+    return scanner.Err()
+}
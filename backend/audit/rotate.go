@@ -0,0 +1,138 @@
+//-------------------------------------------------------
+// backend/audit/rotate.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - On-demand rotation of completed daily evidence logs: compress
+//     each past requests_YYYY-MM-DD.log to .log.gz and record its
+//     SHA-512 under /evidence/hashes/.
+// Audit:
+//   - Today's log is never touched; Write keeps appending to it.
+//   - The original is removed only after the archive and hash are
+//     both written and synced.
+//   - Retention pruning stays with rotate_logs.sh (cron).
+//-------------------------------------------------------
+
+package audit
+
+import (
+    "compress/gzip"
+    "crypto/sha512"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// HashDir receives one .sha512 file per archived log.
+const HashDir = "/evidence/hashes"
+
+//-------------------------------------------------------
+// Struct: RotatedLog
+//-------------------------------------------------------
+// Purpose:
+//   - One archived log and its integrity hash.
+//-------------------------------------------------------
+type RotatedLog struct {
+    Source  string `json:"source"`
+    Archive string `json:"archive"`
+    SHA512  string `json:"sha512"`
+}
+
+//-------------------------------------------------------
+// Function: Rotate
+//-------------------------------------------------------
+// Purpose:
+//   - Archive and hash every completed daily request log.
+// Audit:
+//   - Stops at the first failure and returns what was rotated so far.
+//   - Creates HashDir if missing (as rotate_logs.sh does); LogDir
+//     itself must pre-exist.
+//-------------------------------------------------------
+func Rotate() ([]RotatedLog, error) {
+    rotated := []RotatedLog{}
+    if stat, err := os.Stat(LogDir); err != nil || !stat.IsDir() {
+        return rotated, fmt.Errorf("audit path missing or invalid: %s", LogDir)
+    }
+    if err := os.MkdirAll(HashDir, 0755); err != nil {
+        return rotated, err
+    }
+
+    matches, err := filepath.Glob(filepath.Join(LogDir, "requests_*.log"))
+    if err != nil {
+        return rotated, err
+    }
+    sort.Strings(matches)
+    today := "requests_" + Clock().Now().UTC().Format("2006-01-02") + ".log"
+
+    for _, source := range matches {
+        if filepath.Base(source) == today {
+            continue
+        }
+        entry, err := archiveLog(source)
+        if err != nil {
+            return rotated, err
+        }
+        rotated = append(rotated, entry)
+    }
+    return rotated, nil
+}
+
+//-------------------------------------------------------
+// Function: archiveLog
+//-------------------------------------------------------
+// Purpose:
+//   - gzip one log, write its SHA-512, then remove the original.
+//-------------------------------------------------------
+func archiveLog(source string) (RotatedLog, error) {
+    archive := source + ".gz"
+    in, err := os.Open(source)
+    if err != nil {
+        return RotatedLog{}, err
+    }
+    defer in.Close()
+
+    out, err := os.OpenFile(archive, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+    if err != nil {
+        return RotatedLog{}, fmt.Errorf("archive %s: %v", archive, err)
+    }
+    hasher := sha512.New()
+    gz := gzip.NewWriter(io.MultiWriter(out, hasher))
+    if _, err := io.Copy(gz, in); err != nil {
+        out.Close()
+        os.Remove(archive)
+        return RotatedLog{}, err
+    }
+    if err := gz.Close(); err != nil {
+        out.Close()
+        os.Remove(archive)
+        return RotatedLog{}, err
+    }
+    if err := out.Sync(); err != nil {
+        out.Close()
+        os.Remove(archive)
+        return RotatedLog{}, err
+    }
+    if err := out.Close(); err != nil {
+        os.Remove(archive)
+        return RotatedLog{}, err
+    }
+
+    sum := hex.EncodeToString(hasher.Sum(nil))
+    hashFile := filepath.Join(HashDir, strings.TrimSuffix(filepath.Base(source), ".log")+".sha512")
+    // sha512sum-compatible line so `sha512sum -c` can verify it.
+    line := sum + "  " + archive + "\n"
+    if err := os.WriteFile(hashFile, []byte(line), 0644); err != nil {
+        return RotatedLog{}, err
+    }
+
+    writeMu.Lock()
+    err = os.Remove(source)
+    writeMu.Unlock()
+    if err != nil {
+        return RotatedLog{}, err
+    }
+    return RotatedLog{Source: source, Archive: archive, SHA512: sum}, nil
+}
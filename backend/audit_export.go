@@ -0,0 +1,125 @@
+//-------------------------------------------------------
+// backend/audit_export.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - GET /audit/export?from=YYYY-MM-DD&to=YYYY-MM-DD&format=cef|ecs
+//     streams the evidence log for a date range as Common Event
+//     Format lines or Elastic Common Schema NDJSON (audit/export.go),
+//     ready for a SIEM to ingest.
+// Audit:
+//   - Requires the admin key (auditPrefix routes go through
+//     AdminMiddleware): the log holds security events and client IPs.
+//   - Read-only; rotated .log.gz days are included.
+//   - Each export writes "admin.audit_export" with the range, format
+//     and event count.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// auditPrefix groups evidence exports behind AdminMiddleware.
+const auditPrefix = "/audit/"
+
+// maxAuditExportDays bounds the range of one export.
+const maxAuditExportDays = 366
+
+//-------------------------------------------------------
+// Function: handleAuditExport
+//-------------------------------------------------------
+// Purpose:
+//   - Stream the events logged from "from" through "to" (UTC days,
+//     both inclusive; default today) in the requested format
+//     (default ecs), one per line, oldest first.
+// Audit:
+//   - A read failure after streaming has begun is logged and the
+//     response ends early; the count in the audit event tells.
+//-------------------------------------------------------
+func handleAuditExport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    q := r.URL.Query()
+    format := q.Get("format")
+    if format == "" {
+        format = audit.FormatECS
+    }
+    if format != audit.FormatCEF && format != audit.FormatECS {
+        apierror.Write(w, r, apierror.CodeInvalidField, "format", fmt.Sprintf("Bad request: format must be one of %v", audit.ExportFormats))
+        return
+    }
+
+    today := audit.Clock().Now().UTC().Format("2006-01-02")
+    to, ok := exportDay(w, r, "to", today)
+    if !ok {
+        return
+    }
+    from, ok := exportDay(w, r, "from", to.Format("2006-01-02"))
+    if !ok {
+        return
+    }
+    if from.After(to) {
+        apierror.Write(w, r, apierror.CodeInvalidField, "from", "Bad request: from is after to")
+        return
+    }
+    if to.Sub(from) >= maxAuditExportDays*24*time.Hour {
+        apierror.Write(w, r, apierror.CodeInvalidField, "to", fmt.Sprintf("Bad request: range must be at most %d days", maxAuditExportDays))
+        return
+    }
+
+    first := from.Format(time.RFC3339)
+    end := to.AddDate(0, 0, 1).Format(time.RFC3339)
+    ext := map[string]string{audit.FormatCEF: "cef", audit.FormatECS: "ndjson"}[format]
+    contentType := map[string]string{audit.FormatCEF: "text/plain; charset=utf-8", audit.FormatECS: "application/x-ndjson"}[format]
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit_%s_%s.%s"`, from.Format("2006-01-02"), to.Format("2006-01-02"), ext))
+    w.Header().Set("Cache-Control", "no-store")
+
+    out := bufio.NewWriter(w)
+    count := 0
+    err := audit.Scan(from, func(event audit.Event, ref string) {
+        if event.Timestamp < first || event.Timestamp >= end {
+            return
+        }
+        line, err := audit.FormatEvent(format, event, ref)
+        if err != nil {
+            logError("Failed to export audit event " + ref + ": " + err.Error())
+            return
+        }
+        out.WriteString(line)
+        out.WriteString("\n")
+        count++
+    })
+    out.Flush()
+    detail := fmt.Sprintf("%s..%s format=%s events=%d", from.Format("2006-01-02"), to.Format("2006-01-02"), format, count)
+    if err != nil {
+        logError("Audit export failed: " + err.Error())
+        detail += " error=" + err.Error()
+    }
+    auditAdmin(r, "admin.audit_export", http.StatusOK, "", detail)
+    logInfo("Audit export " + detail)
+}
+
+// exportDay parses the YYYY-MM-DD query parameter name, or fallback
+// when absent, writing a 400 on a malformed value.
+func exportDay(w http.ResponseWriter, r *http.Request, name string, fallback string) (time.Time, bool) {
+    v := r.URL.Query().Get(name)
+    if v == "" {
+        v = fallback
+    }
+    day, err := time.Parse("2006-01-02", v)
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeInvalidField, name, "Bad request: "+name+" must be YYYY-MM-DD")
+        return time.Time{}, false
+    }
+    return day, true
+}
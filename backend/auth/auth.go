@@ -0,0 +1,143 @@
+//-------------------------------------------------------
+// backend/auth/auth.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - API user identity: resolve a bearer token to a configured user
+//     and carry that user through the request context.
+// Audit:
+//   - Tokens are never stored or logged; users are matched by the
+//     SHA-256 of the presented token (config "users"), compared in
+//     constant time.
+//   - Admin and sync keys are separate and not handled here.
+//-------------------------------------------------------
+
+package auth
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "sort"
+
+    "cfo-scratchpad/config"
+)
+
+// Roles a user can be granted (see config.KnownRoles).
+const (
+    RoleEditor   = "editor"
+    RoleReviewer = "reviewer"
+    RoleApprover = "approver"
+)
+
+//-------------------------------------------------------
+// Struct: User
+//-------------------------------------------------------
+// Purpose:
+//   - An authenticated API caller.
+// Audit:
+//   - SessionID is set when the caller used a session token rather
+//     than their configured token; MFA when that session was opened
+//     with a second factor.
+//-------------------------------------------------------
+type User struct {
+    Name      string   `json:"name"`
+    Roles     []string `json:"roles"`
+    SessionID string   `json:"-"`
+    MFA       bool     `json:"-"`
+}
+
+//-------------------------------------------------------
+// Function: (User) HasRole
+//-------------------------------------------------------
+// Purpose:
+//   - Report whether the user holds role.
+//-------------------------------------------------------
+func (u User) HasRole(role string) bool {
+    for _, r := range u.Roles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+type contextKey struct{}
+
+//-------------------------------------------------------
+// Function: WithUser
+//-------------------------------------------------------
+// Purpose:
+//   - Attach the authenticated user to a request context.
+//-------------------------------------------------------
+func WithUser(ctx context.Context, u User) context.Context {
+    return context.WithValue(ctx, contextKey{}, u)
+}
+
+//-------------------------------------------------------
+// Function: FromContext
+//-------------------------------------------------------
+// Purpose:
+//   - The authenticated user of a request, if any.
+//-------------------------------------------------------
+func FromContext(ctx context.Context) (User, bool) {
+    u, ok := ctx.Value(contextKey{}).(User)
+    return u, ok
+}
+
+//-------------------------------------------------------
+// Function: HashToken
+//-------------------------------------------------------
+// Purpose:
+//   - SHA-256 hex of a token, as stored in users[*].token_sha256.
+//-------------------------------------------------------
+func HashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+//-------------------------------------------------------
+// Function: NewToken
+//-------------------------------------------------------
+// Purpose:
+//   - Random 32-byte token (hex) for a new user.
+//-------------------------------------------------------
+func NewToken() string {
+    raw := make([]byte, 32)
+    rand.Read(raw)
+    return hex.EncodeToString(raw)
+}
+
+//-------------------------------------------------------
+// Function: Authenticate
+//-------------------------------------------------------
+// Purpose:
+//   - Resolve a presented token to a configured user.
+// Audit:
+//   - Every configured hash is compared, so timing does not reveal
+//     which (if any) user matched.
+//-------------------------------------------------------
+func Authenticate(token string) (User, bool) {
+    if token == "" {
+        return User{}, false
+    }
+    presented := []byte(HashToken(token))
+
+    users := config.Current().Users
+    names := make([]string, 0, len(users))
+    for name := range users {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var found User
+    matched := false
+    for _, name := range names {
+        if subtle.ConstantTimeCompare(presented, []byte(users[name].TokenSHA256)) == 1 && !matched {
+            found = User{Name: name, Roles: append([]string{}, users[name].Roles...)}
+            matched = true
+        }
+    }
+    return found, matched
+}
@@ -0,0 +1,216 @@
+//-------------------------------------------------------
+// backend/auth/throttle.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Throttle failed authentication: after free_attempts failures
+//     each further attempt must wait longer (1s, 2s, 4s, ... up to
+//     max_delay); max_failures within the window locks the key out
+//     for the lockout period.
+//   - Keys name who is guessing at what, e.g. "ip:<address>" for user
+//     tokens presented from a client, "admin:<address>" for the admin
+//     key (see middleware_auth.go), "user:<name>" for one user's
+//     second factor from any address.
+//   - A failure that names a user counts against both its address
+//     and its user key, so spreading guesses over many addresses
+//     does not reset the count.
+// Audit:
+//   - State is in memory only; a restart clears it.
+//   - While a key waits or is locked, attempts are refused without
+//     checking the credential, so a correct one does not help.
+//   - Settings come from config "login_throttle" on every call.
+//-------------------------------------------------------
+
+package auth
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/config"
+)
+
+//-------------------------------------------------------
+// Struct: Lockout
+//-------------------------------------------------------
+// Purpose:
+//   - Throttle state of one key, as shown to admins.
+// Audit:
+//   - RetryAt is when the next attempt is allowed; Locked marks a
+//     full lockout rather than a progressive delay.
+//-------------------------------------------------------
+type Lockout struct {
+    Key         string `json:"key"`
+    Failures    int    `json:"failures"`
+    FirstFailed string `json:"first_failed"`
+    LastFailed  string `json:"last_failed"`
+    RetryAt     string `json:"retry_at,omitempty"`
+    Locked      bool   `json:"locked"`
+}
+
+// throttleEntry is the failure record of one key.
+type throttleEntry struct {
+    failures    int
+    first       time.Time
+    last        time.Time
+    retryAt     time.Time
+    lockedUntil time.Time
+}
+
+// maxThrottleKeys triggers a sweep of expired entries on failure.
+const maxThrottleKeys = 1000
+
+var (
+    throttleMu sync.Mutex
+    throttled  = map[string]*throttleEntry{}
+)
+
+// expired reports whether an entry no longer affects anything.
+func (e *throttleEntry) expired(now time.Time, window time.Duration) bool {
+    return now.After(e.lockedUntil) && now.After(e.retryAt) && now.Sub(e.last) > window
+}
+
+//-------------------------------------------------------
+// Function: ThrottleWait
+//-------------------------------------------------------
+// Purpose:
+//   - How long key must wait before its next attempt (0 if it may
+//     try now), and whether it is locked out.
+//-------------------------------------------------------
+func ThrottleWait(key string, now time.Time) (time.Duration, bool) {
+    cfg := config.Current().LoginThrottle
+    throttleMu.Lock()
+    defer throttleMu.Unlock()
+    e, ok := throttled[key]
+    if !ok {
+        return 0, false
+    }
+    if e.expired(now, cfg.Window.Std()) {
+        delete(throttled, key)
+        return 0, false
+    }
+    if now.Before(e.lockedUntil) {
+        return e.lockedUntil.Sub(now), true
+    }
+    if now.Before(e.retryAt) {
+        return e.retryAt.Sub(now), false
+    }
+    return 0, false
+}
+
+// UserThrottleKey is the throttle key of failed credentials for
+// the named user, whichever address they come from.
+func UserThrottleKey(user string) string {
+    return "user:" + user
+}
+
+//-------------------------------------------------------
+// Function: ThrottleWaitAny
+//-------------------------------------------------------
+// Purpose:
+//   - ThrottleWait over several keys: the key with the longest wait
+//     ("" if all may try now), the wait, and whether it is a lockout.
+//-------------------------------------------------------
+func ThrottleWaitAny(keys []string, now time.Time) (string, time.Duration, bool) {
+    worst, longest, locked := "", time.Duration(0), false
+    for _, key := range keys {
+        if wait, l := ThrottleWait(key, now); wait > longest {
+            worst, longest, locked = key, wait, l
+        }
+    }
+    return worst, longest, locked
+}
+
+//-------------------------------------------------------
+// Function: ThrottleFail
+//-------------------------------------------------------
+// Purpose:
+//   - Record a failed attempt for key; returns the failures counted
+//     and, if this failure started a lockout, its end.
+// Audit:
+//   - The count starts again once the window since the first
+//     failure has passed (and any lockout has ended).
+//-------------------------------------------------------
+func ThrottleFail(key string, now time.Time) (int, time.Time) {
+    cfg := config.Current().LoginThrottle
+    throttleMu.Lock()
+    defer throttleMu.Unlock()
+    if len(throttled) >= maxThrottleKeys {
+        for k, e := range throttled {
+            if e.expired(now, cfg.Window.Std()) {
+                delete(throttled, k)
+            }
+        }
+    }
+    e, ok := throttled[key]
+    if !ok || now.Sub(e.first) > cfg.Window.Std() && now.After(e.lockedUntil) {
+        e = &throttleEntry{first: now}
+        throttled[key] = e
+    }
+    e.failures++
+    e.last = now
+
+    if e.failures >= cfg.MaxFailures {
+        e.lockedUntil = now.Add(cfg.Lockout.Std())
+        e.retryAt = e.lockedUntil
+        if e.failures == cfg.MaxFailures {
+            return e.failures, e.lockedUntil
+        }
+        return e.failures, time.Time{}
+    }
+    if extra := e.failures - cfg.FreeAttempts; extra > 0 {
+        delay := time.Second << uint(extra-1)
+        if max := cfg.MaxDelay.Std(); delay > max || delay <= 0 {
+            delay = max
+        }
+        e.retryAt = now.Add(delay)
+    }
+    return e.failures, time.Time{}
+}
+
+//-------------------------------------------------------
+// Function: ThrottleReset
+//-------------------------------------------------------
+// Purpose:
+//   - Forget key's failures (after a successful attempt, or an
+//     admin clearing a lockout); reports whether any were recorded.
+//-------------------------------------------------------
+func ThrottleReset(key string) bool {
+    throttleMu.Lock()
+    defer throttleMu.Unlock()
+    _, ok := throttled[key]
+    delete(throttled, key)
+    return ok
+}
+
+//-------------------------------------------------------
+// Function: Lockouts
+//-------------------------------------------------------
+// Purpose:
+//   - Every key with recorded failures, sorted by key.
+//-------------------------------------------------------
+func Lockouts(now time.Time) []Lockout {
+    cfg := config.Current().LoginThrottle
+    throttleMu.Lock()
+    defer throttleMu.Unlock()
+    list := []Lockout{}
+    for key, e := range throttled {
+        if e.expired(now, cfg.Window.Std()) {
+            delete(throttled, key)
+            continue
+        }
+        l := Lockout{
+            Key:         key,
+            Failures:    e.failures,
+            FirstFailed: e.first.UTC().Format(time.RFC3339),
+            LastFailed:  e.last.UTC().Format(time.RFC3339),
+            Locked:      now.Before(e.lockedUntil),
+        }
+        if now.Before(e.retryAt) {
+            l.RetryAt = e.retryAt.UTC().Format(time.RFC3339)
+        }
+        list = append(list, l)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+    return list
+}
@@ -0,0 +1,66 @@
+//-------------------------------------------------------
+// backend/auth/throttle_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for the failed authentication throttle, including a
+//     user key shared by several addresses.
+//-------------------------------------------------------
+
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+func TestThrottleUserKeySpansAddresses(t *testing.T) {
+    now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+    user := UserThrottleKey("throttle-test")
+    addresses := []string{"ip:192.0.2.1", "ip:192.0.2.2", "ip:192.0.2.3", "ip:192.0.2.4"}
+    t.Cleanup(func() {
+        ThrottleReset(user)
+        for _, ip := range addresses {
+            ThrottleReset(ip)
+        }
+    })
+
+    // Four failures from four addresses: no address is delayed, the
+    // user is (free_attempts defaults to 3).
+    for _, ip := range addresses {
+        ThrottleFail(ip, now)
+        ThrottleFail(user, now)
+    }
+
+    if key, wait, _ := ThrottleWaitAny([]string{"ip:192.0.2.9", user}, now); key != user || wait != time.Second {
+        t.Fatalf("ThrottleWaitAny = %q %v, want %q 1s", key, wait, user)
+    }
+    if key, wait, _ := ThrottleWaitAny([]string{"ip:192.0.2.1"}, now); key != "" || wait != 0 {
+        t.Fatalf("single address delayed: %q %v", key, wait)
+    }
+    if _, wait, _ := ThrottleWaitAny([]string{user}, now.Add(time.Second)); wait != 0 {
+        t.Fatalf("delay did not end after 1s: %v", wait)
+    }
+}
+
+func TestThrottleLockoutAndReset(t *testing.T) {
+    now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+    key := "ip:198.51.100.7"
+    t.Cleanup(func() { ThrottleReset(key) })
+
+    var lockedUntil time.Time
+    for i := 0; i < 10; i++ {
+        _, lockedUntil = ThrottleFail(key, now)
+    }
+    if want := now.Add(15 * time.Minute); !lockedUntil.Equal(want) {
+        t.Fatalf("lockout ends %v, want %v", lockedUntil, want)
+    }
+    if wait, locked := ThrottleWait(key, now); !locked || wait != 15*time.Minute {
+        t.Fatalf("ThrottleWait = %v locked=%v, want 15m locked", wait, locked)
+    }
+    if !ThrottleReset(key) {
+        t.Fatalf("ThrottleReset found no entry")
+    }
+    if wait, _ := ThrottleWait(key, now); wait != 0 {
+        t.Fatalf("wait after reset = %v", wait)
+    }
+}
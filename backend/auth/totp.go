@@ -0,0 +1,168 @@
+//-------------------------------------------------------
+// backend/auth/totp.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Time-based one-time passwords (RFC 6238: HMAC-SHA1, 6 digits,
+//     30 second steps) for two-factor authentication, plus the
+//     provisioning URI that authenticator apps scan and single-use
+//     recovery codes.
+//   - The MFA policy: which users must present a second factor
+//     (config "mfa.required_roles").
+// Audit:
+//   - Codes from one step either side of now are accepted for clock
+//     drift; a step at or before the last one used is refused, so a
+//     code cannot be replayed.
+//   - Recovery codes are shown once and stored only as SHA-256.
+//-------------------------------------------------------
+
+package auth
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/subtle"
+    "encoding/base32"
+    "encoding/binary"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/config"
+)
+
+const (
+    totpPeriod = 30
+    totpDigits = 6
+    totpSkew   = 1
+)
+
+// totpEncoding is unpadded base32, as authenticator apps expect.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//-------------------------------------------------------
+// Function: NewTOTPSecret
+//-------------------------------------------------------
+// Purpose:
+//   - Random 160-bit secret, base32 encoded.
+//-------------------------------------------------------
+func NewTOTPSecret() string {
+    raw := make([]byte, 20)
+    rand.Read(raw)
+    return totpEncoding.EncodeToString(raw)
+}
+
+//-------------------------------------------------------
+// Function: TOTPCode
+//-------------------------------------------------------
+// Purpose:
+//   - The code of secret for one time step (RFC 4226 truncation).
+//-------------------------------------------------------
+func TOTPCode(secret string, step int64) (string, error) {
+    key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+    if err != nil {
+        return "", fmt.Errorf("invalid TOTP secret")
+    }
+    var counter [8]byte
+    binary.BigEndian.PutUint64(counter[:], uint64(step))
+    mac := hmac.New(sha1.New, key)
+    mac.Write(counter[:])
+    sum := mac.Sum(nil)
+    offset := sum[len(sum)-1] & 0x0f
+    value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+    return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+//-------------------------------------------------------
+// Function: VerifyTOTP
+//-------------------------------------------------------
+// Purpose:
+//   - Check code against secret at now; returns the matching step,
+//     which the caller stores as lastStep for replay protection.
+//-------------------------------------------------------
+func VerifyTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+    code = strings.TrimSpace(code)
+    if len(code) != totpDigits {
+        return 0, false
+    }
+    current := now.Unix() / totpPeriod
+    for step := current - totpSkew; step <= current+totpSkew; step++ {
+        if step <= lastStep {
+            continue
+        }
+        expected, err := TOTPCode(secret, step)
+        if err != nil {
+            return 0, false
+        }
+        if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+//-------------------------------------------------------
+// Function: ProvisioningURI
+//-------------------------------------------------------
+// Purpose:
+//   - otpauth:// URI for authenticator apps (usually shown as a QR
+//     code): "otpauth://totp/<issuer>:<account>?secret=...".
+//-------------------------------------------------------
+func ProvisioningURI(issuer string, account string, secret string) string {
+    label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+    q := url.Values{}
+    q.Set("secret", secret)
+    q.Set("issuer", issuer)
+    q.Set("algorithm", "SHA1")
+    q.Set("digits", fmt.Sprint(totpDigits))
+    q.Set("period", fmt.Sprint(totpPeriod))
+    // Some apps show "+" literally, so spaces are sent as %20.
+    return "otpauth://totp/" + label + "?" + strings.Replace(q.Encode(), "+", "%20", -1)
+}
+
+//-------------------------------------------------------
+// Function: NewRecoveryCodes
+//-------------------------------------------------------
+// Purpose:
+//   - n random single-use codes formatted "xxxxx-xxxxx".
+//-------------------------------------------------------
+func NewRecoveryCodes(n int) []string {
+    codes := make([]string, n)
+    for i := range codes {
+        raw := make([]byte, 7)
+        rand.Read(raw)
+        s := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+        codes[i] = s[:5] + "-" + s[5:]
+    }
+    return codes
+}
+
+//-------------------------------------------------------
+// Function: HashRecoveryCode
+//-------------------------------------------------------
+// Purpose:
+//   - Stored form of a recovery code; case, spaces and dashes as
+//     typed do not matter.
+//-------------------------------------------------------
+func HashRecoveryCode(code string) string {
+    code = strings.ToLower(code)
+    code = strings.NewReplacer("-", "", " ", "").Replace(code)
+    return HashToken(code)
+}
+
+//-------------------------------------------------------
+// Function: MFARequired
+//-------------------------------------------------------
+// Purpose:
+//   - Report whether the user holds a role that cfg requires to sign
+//     in with a second factor.
+//-------------------------------------------------------
+func MFARequired(cfg *config.Config, u User) bool {
+    for _, role := range cfg.MFA.RequiredRoles {
+        if u.HasRole(role) {
+            return true
+        }
+    }
+    return false
+}
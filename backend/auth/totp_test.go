@@ -0,0 +1,130 @@
+//-------------------------------------------------------
+// backend/auth/totp_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for TOTP codes (RFC 6238 test vectors), verification
+//     with drift and replay protection, the provisioning URI and
+//     recovery codes.
+//-------------------------------------------------------
+
+package auth
+
+import (
+    "net/url"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+)
+
+// rfc6238Secret is the RFC 6238 SHA-1 test key "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+    // RFC 6238 appendix B, SHA-1, last six of the eight digits.
+    for _, tc := range []struct {
+        unix int64
+        want string
+    }{
+        {59, "287082"},
+        {1111111109, "081804"},
+        {1111111111, "050471"},
+        {1234567890, "005924"},
+        {2000000000, "279037"},
+        {20000000000, "353130"},
+    } {
+        got, err := TOTPCode(rfc6238Secret, tc.unix/totpPeriod)
+        if err != nil || got != tc.want {
+            t.Errorf("TOTPCode at %d = %q, %v; want %q", tc.unix, got, err, tc.want)
+        }
+    }
+    if got, _ := TOTPCode(strings.ToLower(rfc6238Secret), 1); got == "" {
+        t.Errorf("lower case secret refused")
+    }
+    if _, err := TOTPCode("not base32!", 1); err == nil {
+        t.Errorf("invalid secret accepted")
+    }
+}
+
+func TestVerifyTOTP(t *testing.T) {
+    now := time.Unix(1111111111, 0)
+    current := now.Unix() / totpPeriod
+    code := func(step int64) string {
+        c, err := TOTPCode(rfc6238Secret, step)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return c
+    }
+
+    if step, ok := VerifyTOTP(rfc6238Secret, code(current), now, 0); !ok || step != current {
+        t.Fatalf("current code: step=%d ok=%t", step, ok)
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, " "+code(current-1)+" ", now, 0); !ok {
+        t.Fatalf("previous step with spaces refused")
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, code(current+1), now, 0); !ok {
+        t.Fatalf("next step refused")
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, code(current+2), now, 0); ok {
+        t.Fatalf("code two steps ahead accepted")
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, code(current), now, current); ok {
+        t.Fatalf("replayed step accepted")
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, code(current+1), now, current); !ok {
+        t.Fatalf("step after the last used refused")
+    }
+    if _, ok := VerifyTOTP(rfc6238Secret, "12345", now, 0); ok {
+        t.Fatalf("short code accepted")
+    }
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+    a, b := NewTOTPSecret(), NewTOTPSecret()
+    if len(a) != 32 || a == b {
+        t.Fatalf("secrets %q %q: want 32 distinct base32 characters", a, b)
+    }
+    if _, err := TOTPCode(a, 1); err != nil {
+        t.Fatalf("new secret unusable: %v", err)
+    }
+}
+
+func TestProvisioningURI(t *testing.T) {
+    uri := ProvisioningURI("CFO Scratchpad", "alice@example.com", "JBSWY3DPEHPK3PXP")
+    if !strings.HasPrefix(uri, "otpauth://totp/CFO%20Scratchpad:alice@example.com?") || strings.Contains(uri, "+") {
+        t.Fatalf("URI = %q", uri)
+    }
+    parsed, err := url.Parse(uri)
+    if err != nil {
+        t.Fatal(err)
+    }
+    q := parsed.Query()
+    for key, want := range map[string]string{
+        "secret": "JBSWY3DPEHPK3PXP", "issuer": "CFO Scratchpad", "algorithm": "SHA1", "digits": "6", "period": "30",
+    } {
+        if got := q.Get(key); got != want {
+            t.Errorf("%s = %q, want %q", key, got, want)
+        }
+    }
+}
+
+func TestRecoveryCodes(t *testing.T) {
+    codes := NewRecoveryCodes(10)
+    format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+    seen := map[string]bool{}
+    for _, code := range codes {
+        if !format.MatchString(code) || seen[code] {
+            t.Fatalf("bad or repeated recovery code %q", code)
+        }
+        seen[code] = true
+    }
+    want := HashRecoveryCode(codes[0])
+    typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+    if got := HashRecoveryCode(typed); got != want {
+        t.Fatalf("hash of %q differs from hash of %q", typed, codes[0])
+    }
+    if HashRecoveryCode(codes[1]) == want {
+        t.Fatalf("two codes hash alike")
+    }
+}
@@ -0,0 +1,91 @@
+//-------------------------------------------------------
+// backend/clock/clock.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Clock: the source of "now" for handlers and audit evidence,
+//     injected instead of calling time.Now() directly.
+//   - System is the wall clock; Fixed is pinned and moved only
+//     explicitly, so tests and audit replay reproduce timestamps
+//     exactly.
+// Audit:
+//   - Every audit event timestamp, evidence log file name, and
+//     handler-stamped time (saves, trash, journal, backups) is read
+//     from the injected Clock.
+//   - Operational log lines and latency windows stay on the wall
+//     clock; they are not evidence.
+//-------------------------------------------------------
+
+package clock
+
+import (
+    "sync"
+    "time"
+)
+
+//-------------------------------------------------------
+// Type: Clock
+//-------------------------------------------------------
+// Purpose:
+//   - Report the current time.
+//-------------------------------------------------------
+type Clock interface {
+    Now() time.Time
+}
+
+//-------------------------------------------------------
+// Struct: System
+//-------------------------------------------------------
+// Purpose:
+//   - The wall clock (time.Now).
+//-------------------------------------------------------
+type System struct{}
+
+// Now returns time.Now().
+func (System) Now() time.Time {
+    return time.Now()
+}
+
+//-------------------------------------------------------
+// Struct: Fixed
+//-------------------------------------------------------
+// Purpose:
+//   - A clock that stands still until Set or Advance moves it.
+// Audit:
+//   - Safe for concurrent use. A replay tool Sets it to each
+//     recorded event's timestamp before re-issuing the request.
+//-------------------------------------------------------
+type Fixed struct {
+    mu  sync.Mutex
+    now time.Time
+}
+
+//-------------------------------------------------------
+// Function: NewFixed
+//-------------------------------------------------------
+// Purpose:
+//   - A Fixed clock reading t.
+//-------------------------------------------------------
+func NewFixed(t time.Time) *Fixed {
+    return &Fixed{now: t}
+}
+
+// Now returns the pinned time.
+func (f *Fixed) Now() time.Time {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.now
+}
+
+// Set pins the clock to t.
+func (f *Fixed) Set(t time.Time) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.now = t
+}
+
+// Advance moves the clock forward by d.
+func (f *Fixed) Advance(d time.Duration) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.now = f.now.Add(d)
+}
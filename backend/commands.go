@@ -0,0 +1,192 @@
+// -------------------------------------------------------
+// backend/commands.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Operator subcommands run from the same binary as the server,
+//     e.g. `./cfo-scratchpad fsck -repair` inside the container.
+// Audit:
+//   - Commands log with UTC ISO 8601 timestamps and write the same
+//     audit events as their /admin HTTP counterparts (method "CLI").
+//   - Exit codes: 0 success/clean, 1 problems found, 2 usage/runtime error.
+// -------------------------------------------------------
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "time"
+
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/handlers"
+)
+
+// -------------------------------------------------------
+// func runCommand(args []string) int
+// -------------------------------------------------------
+// Purpose:
+//   - Dispatch a subcommand and return its process exit code.
+// -------------------------------------------------------
+func runCommand(args []string) int {
+    switch args[0] {
+    case "fsck":
+        return runFsckCommand(args[1:])
+    case "user-token":
+        return runUserTokenCommand()
+    case "asset-manifest":
+        return runAssetManifestCommand(args[1:])
+    case "evidence-bundle":
+        return runEvidenceBundleCommand(args[1:])
+    default:
+        fmt.Fprintf(os.Stderr, "unknown command %q\nusage: cfo-scratchpad [fsck [-repair] | user-token | asset-manifest [-dir D] [-out F] | evidence-bundle -from D [-to D] [-out DIR]]\n", args[0])
+        return 2
+    }
+}
+
+// -------------------------------------------------------
+// func commandContext() context.Context
+// -------------------------------------------------------
+// Purpose:
+//   - Context for handler calls made by a command: a Server on the
+//     default scratch root with the default dependencies.
+// -------------------------------------------------------
+func commandContext() context.Context {
+    return handlers.NewServer(handlers.DefaultRoot, nil, nil, nil, nil).Context()
+}
+
+// -------------------------------------------------------
+// func runFsckCommand(args []string) int
+// -------------------------------------------------------
+// Purpose:
+//   - Cross-check the metadata index against the filesystem and
+//     print the JSON report; -repair fixes what it finds.
+// Audit:
+//   - Repairs write an "admin.fsck_repair" audit event.
+//   - Returns 1 when unrepaired issues remain.
+// -------------------------------------------------------
+func runFsckCommand(args []string) int {
+    fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+    repair := fs.Bool("repair", false, "repair metadata to match the filesystem")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+
+    report, err := handlers.RunFsck(commandContext(), *repair)
+    if err != nil {
+        logError("fsck failed: " + err.Error())
+        return 2
+    }
+
+    if *repair {
+        audit.Write(audit.Event{
+            Event:  "admin.fsck_repair",
+            Method: "CLI",
+            Path:   "fsck",
+            Status: 0,
+            Detail: fmt.Sprintf("%d issues repaired", len(report.Issues)),
+        })
+    }
+
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    enc.Encode(report)
+
+    logInfo(fmt.Sprintf("fsck completed: %d issues (repair=%t)", len(report.Issues), *repair))
+    if len(report.Issues) > 0 && !*repair {
+        return 1
+    }
+    return 0
+}
+
+// -------------------------------------------------------
+// func runUserTokenCommand() int
+// -------------------------------------------------------
+// Purpose:
+//   - Generate a user token and the token_sha256 to put in the
+//     config file's "users" entry.
+// Audit:
+//   - Nothing is stored; the token is shown once and must be handed
+//     to the user out of band.
+// -------------------------------------------------------
+func runUserTokenCommand() int {
+    token := auth.NewToken()
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    enc.Encode(map[string]string{
+        "token":        token,
+        "token_sha256": auth.HashToken(token),
+    })
+    return 0
+}
+
+// -------------------------------------------------------
+// func runEvidenceBundleCommand(args []string) int
+// -------------------------------------------------------
+// Purpose:
+//   - Write an evidence bundle for -from..-to (UTC days, -to
+//     defaults to -from) to -out (default backup_dir) and print its
+//     summary.
+// Audit:
+//   - Writes an "admin.evidence_bundle" audit event.
+//   - Returns 1 when a rotated log fails its SHA-512 manifest.
+// -------------------------------------------------------
+func runEvidenceBundleCommand(args []string) int {
+    fs := flag.NewFlagSet("evidence-bundle", flag.ContinueOnError)
+    fromFlag := fs.String("from", "", "first day, YYYY-MM-DD")
+    toFlag := fs.String("to", "", "last day, YYYY-MM-DD (default -from)")
+    outFlag := fs.String("out", "", "output directory (default backup_dir)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    cfg, err := config.Init()
+    if err != nil {
+        logError("Configuration error: " + err.Error())
+        return 2
+    }
+    if *toFlag == "" {
+        *toFlag = *fromFlag
+    }
+    from, err := time.Parse("2006-01-02", *fromFlag)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "evidence-bundle: -from must be YYYY-MM-DD")
+        return 2
+    }
+    to, err := time.Parse("2006-01-02", *toFlag)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "evidence-bundle: -to must be YYYY-MM-DD")
+        return 2
+    }
+    out := *outFlag
+    if out == "" {
+        out = cfg.BackupDir
+    }
+
+    result, err := handlers.CreateEvidenceBundle(commandContext(), out, cfg.BackupDir, from, to)
+    if err != nil {
+        logError("Evidence bundle failed: " + err.Error())
+        return 2
+    }
+    audit.Write(audit.Event{
+        Event:  "admin.evidence_bundle",
+        Method: "CLI",
+        Path:   "evidence-bundle",
+        Status: 0,
+        Target: result.Path,
+        Detail: fmt.Sprintf("%s..%s logs=%d events=%d sha256=%s", result.From, result.To, result.Logs, result.Events, result.SHA256),
+    })
+
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    enc.Encode(result)
+
+    logInfo(fmt.Sprintf("Evidence bundle written: %s (%d logs, %d events)", result.Path, result.Logs, result.Events))
+    if len(result.Mismatched) > 0 {
+        return 1
+    }
+    return 0
+}
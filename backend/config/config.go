@@ -0,0 +1,1794 @@
+//-------------------------------------------------------
+// backend/config/config.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Runtime configuration: defaults, environment variables, and an
+//     optional JSON config file (CONFIG_FILE).
+//   - Hot reload: Reload() re-reads the file and swaps the active
+//     configuration atomically (triggered by SIGHUP or
+//     POST /admin/config/reload).
+// Audit:
+//   - Precedence: built-in defaults < environment < config file, so
+//     edits to the file always take effect on reload.
+//   - Invalid files are rejected as a whole with line/column and
+//     field-level messages; the previous configuration stays active.
+//   - Unknown keys are errors (catches typos such as "slo_p59_ms").
+//-------------------------------------------------------
+
+package config
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "net/netip"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/schedule"
+    "cfo-scratchpad/tracing"
+)
+
+//-------------------------------------------------------
+// Type: Duration
+//-------------------------------------------------------
+// Purpose:
+//   - time.Duration that reads/writes JSON as "30s", "5m", etc.
+//-------------------------------------------------------
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err != nil {
+        return fmt.Errorf("duration must be a string like \"30s\" or \"5m\"")
+    }
+    parsed, err := time.ParseDuration(s)
+    if err != nil {
+        return fmt.Errorf("invalid duration %q", s)
+    }
+    *d = Duration(parsed)
+    return nil
+}
+
+// Std returns the value as a time.Duration.
+func (d Duration) Std() time.Duration {
+    return time.Duration(d)
+}
+
+//-------------------------------------------------------
+// Struct: SLOConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Latency SLO alerting settings (see metrics_slo.go).
+//-------------------------------------------------------
+type SLOConfig struct {
+    P95Ms      int64    `json:"p95_ms"`
+    Window     Duration `json:"window"`
+    MinSamples int      `json:"min_samples"`
+    WebhookURL string   `json:"webhook_url"`
+}
+
+//-------------------------------------------------------
+// Struct: Config
+//-------------------------------------------------------
+// Purpose:
+//   - Complete runtime configuration.
+// Audit:
+//   - Port, Server, ReadOnly and JobWorkers are read at startup only;
+//     a changed port, server tuning or worker count needs a restart
+//     and read-only is toggled via /admin/read-only.
+//   - AdminKey is a secret; use Redacted() before displaying.
+//-------------------------------------------------------
+type Config struct {
+    Port                string                   `json:"port"`
+    RequestTimeout      Duration                 `json:"request_timeout"`
+    RouteTimeouts       map[string]Duration      `json:"route_timeouts"`
+    SLO                 SLOConfig                `json:"slo"`
+    SaveNormalizeEOL    bool                     `json:"save_normalize_eol"`
+    DuplicateSimilarity float64                  `json:"duplicate_similarity"`
+    AdminKey            string                   `json:"admin_key"`
+    BackupDir           string                   `json:"backup_dir"`
+    ReadOnly            bool                     `json:"read_only"`
+    MaintenancePage     string                   `json:"maintenance_page"`
+    TrashRetention      map[string]int           `json:"trash_retention"`
+    Sync                SyncConfig               `json:"sync"`
+    Users               map[string]UserConfig    `json:"users"`
+    AuthRequired        bool                     `json:"auth_required"`
+    AssetIntegrity      string                   `json:"asset_integrity"`
+    AssetManifest       string                   `json:"asset_manifest"`
+    Lint                LintConfig               `json:"lint"`
+    LinkCheckInterval   Duration                 `json:"link_check_interval"`
+    DurableWrites       bool                     `json:"durable_writes"`
+    JobWorkers          int                      `json:"job_workers"`
+    FolderTemplates     map[string][]string      `json:"folder_templates"`
+    Rollover            RolloverConfig           `json:"rollover"`
+    Recurring           []RecurringNote          `json:"recurring"`
+    Processors          []ProcessorConfig        `json:"processors"`
+    Sensitive           SensitiveConfig          `json:"sensitive"`
+    Anomaly             AnomalyConfig            `json:"anomaly"`
+    LoginThrottle       LoginThrottleConfig      `json:"login_throttle"`
+    MFA                 MFAConfig                `json:"mfa"`
+    Sessions            SessionsConfig           `json:"sessions"`
+    SecurityHeaders     SecurityHeadersConfig    `json:"security_headers"`
+    Scratch             ScratchConfig            `json:"scratch"`
+    Server              ServerConfig             `json:"server"`
+    Tracing             TracingConfig            `json:"tracing"`
+    IPAccess            IPAccessConfig           `json:"ip_access"`
+    Automations         AutomationsConfig        `json:"automations"`
+    Raw                 RawConfig                `json:"raw"`
+    Compact             CompactConfig            `json:"compact"`
+    Idempotency         IdempotencyConfig        `json:"idempotency"`
+    TTS                 TTSConfig                `json:"tts"`
+    OCR                 OCRConfig                `json:"ocr"`
+    Export              ExportConfig             `json:"export"`
+    Antivirus           AntivirusConfig          `json:"antivirus"`
+    ContentPolicy       map[string]ContentPolicy `json:"content_policy"`
+}
+
+//-------------------------------------------------------
+// Struct: AnomalyConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Anomaly detection over the audit stream (see anomaly.go):
+//     thresholds per Window, working hours, optional webhook.
+// Audit:
+//   - WorkHours is "HH:MM-HH:MM" in Timezone (IANA name) and may
+//     wrap midnight; empty turns the unusual hours check off.
+//   - WorkDays are weekday names (MON..SUN).
+//-------------------------------------------------------
+type AnomalyConfig struct {
+    Enabled         bool     `json:"enabled"`
+    Window          Duration `json:"window"`
+    MaxReads        int      `json:"max_reads"`
+    MaxClientErrors int      `json:"max_client_errors"`
+    LargeSaveBytes  int64    `json:"large_save_bytes"`
+    WorkHours       string   `json:"work_hours"`
+    WorkDays        []string `json:"work_days"`
+    Timezone        string   `json:"timezone"`
+    WebhookURL      string   `json:"webhook_url"`
+}
+
+//-------------------------------------------------------
+// Struct: LoginThrottleConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Failed authentication throttling (see auth/throttle.go).
+// Audit:
+//   - After FreeAttempts failures each attempt waits 1s, 2s, 4s, ...
+//     up to MaxDelay; MaxFailures within Window locks out for
+//     Lockout.
+//-------------------------------------------------------
+type LoginThrottleConfig struct {
+    FreeAttempts int      `json:"free_attempts"`
+    MaxFailures  int      `json:"max_failures"`
+    Window       Duration `json:"window"`
+    Lockout      Duration `json:"lockout"`
+    MaxDelay     Duration `json:"max_delay"`
+}
+
+//-------------------------------------------------------
+// Struct: MFAConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Two-factor authentication (see handlers/totp.go): the issuer
+//     name shown in authenticator apps and the roles that must sign
+//     in with a second factor.
+//-------------------------------------------------------
+type MFAConfig struct {
+    Issuer        string   `json:"issuer"`
+    RequiredRoles []string `json:"required_roles"`
+}
+
+//-------------------------------------------------------
+// Struct: SessionsConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Lifetimes of sessions opened at /auth/login (see
+//     handlers/sessions.go).
+// Audit:
+//   - A session ends IdleTimeout after its last use or
+//     AbsoluteLifetime after login, whichever is first.
+//-------------------------------------------------------
+type SessionsConfig struct {
+    IdleTimeout      Duration `json:"idle_timeout"`
+    AbsoluteLifetime Duration `json:"absolute_lifetime"`
+}
+
+//-------------------------------------------------------
+// Struct: ScratchConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Limits of the per-user scratch buffers (see
+//     handlers/scratch.go).
+// Audit:
+//   - Buffers live in memory only; TTL is counted from the last
+//     write.
+//-------------------------------------------------------
+type ScratchConfig struct {
+    TTL        Duration `json:"ttl"`
+    MaxBuffers int      `json:"max_buffers"`
+    MaxBytes   int      `json:"max_bytes"`
+}
+
+//-------------------------------------------------------
+// Struct: ServerConfig
+//-------------------------------------------------------
+// Purpose:
+//   - HTTP server tuning (see backend/http_server.go): connection
+//     timeouts, header size, keep-alives, and TLS with HTTP/2.
+// Audit:
+//   - ReadHeaderTimeout and ReadTimeout bound how long a client may
+//     take to send a request, so slow-drip (slowloris) connections
+//     are closed instead of held open.
+//   - WriteTimeout 0 leaves responses unbounded (route deadlines
+//     still apply); otherwise it must cover the longest route.
+//   - TCPKeepAlive 0 turns TCP keep-alive probes off.
+//   - HTTP2 only applies when TLSCertFile/TLSKeyFile are set.
+//-------------------------------------------------------
+type ServerConfig struct {
+    ReadHeaderTimeout Duration `json:"read_header_timeout"`
+    ReadTimeout       Duration `json:"read_timeout"`
+    WriteTimeout      Duration `json:"write_timeout"`
+    IdleTimeout       Duration `json:"idle_timeout"`
+    MaxHeaderBytes    int      `json:"max_header_bytes"`
+    DisableKeepAlives bool     `json:"disable_keep_alives"`
+    TCPKeepAlive      Duration `json:"tcp_keep_alive"`
+    TLSCertFile       string   `json:"tls_cert_file"`
+    TLSKeyFile        string   `json:"tls_key_file"`
+    HTTP2             bool     `json:"http2"`
+}
+
+//-------------------------------------------------------
+// Struct: TracingConfig
+//-------------------------------------------------------
+// Purpose:
+//   - OpenTelemetry trace export over OTLP/HTTP (see
+//     backend/tracing): request, storage and audit writer spans.
+// Audit:
+//   - Off by default. Endpoint is the collector base URL;
+//     "/v1/traces" is appended.
+//   - Headers (e.g. a collector API key) are secrets; Redacted()
+//     hides their values.
+//   - Note paths are only attached to storage spans when
+//     IncludePaths is set, since the collector may sit outside the
+//     evidence boundary.
+//-------------------------------------------------------
+type TracingConfig struct {
+    Enabled      bool              `json:"enabled"`
+    Endpoint     string            `json:"endpoint"`
+    ServiceName  string            `json:"service_name"`
+    SampleRatio  float64           `json:"sample_ratio"`
+    Headers      map[string]string `json:"headers"`
+    IncludePaths bool              `json:"include_paths"`
+}
+
+//-------------------------------------------------------
+// Struct: IPAccessConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Client address allow and deny lists (see
+//     backend/middleware_ipaccess.go), e.g. to restrict access to
+//     the finance VLAN.
+// Audit:
+//   - Entries are CIDR ranges ("10.20.0.0/16") or single addresses.
+//   - Deny wins over allow; a non-empty Allow admits only the
+//     addresses it lists. Both empty: every address is admitted.
+//   - TrustedProxies are the reverse proxies whose X-Forwarded-For
+//     header names the real client; other peers' headers are
+//     ignored.
+//-------------------------------------------------------
+type IPAccessConfig struct {
+    Allow          []string `json:"allow"`
+    Deny           []string `json:"deny"`
+    TrustedProxies []string `json:"trusted_proxies"`
+}
+
+//-------------------------------------------------------
+// Struct: AutomationsConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Who may change and test webhook automations, and which
+//     internal networks they may post to (see
+//     handlers/automations.go).
+// Audit:
+//   - Loopback, private, link-local and other non-public addresses
+//     are refused when a delivery connects, unless they fall in
+//     AllowedNetworks (CIDR ranges or single addresses).
+//-------------------------------------------------------
+type AutomationsConfig struct {
+    Roles           []string `json:"roles"`
+    AllowedNetworks []string `json:"allowed_networks"`
+}
+
+//-------------------------------------------------------
+// Struct: ContentPolicy
+//-------------------------------------------------------
+// Purpose:
+//   - What a folder's notes may contain and how they are served
+//     (see handlers/content_sniff.go); keyed by folder in
+//     content_policy, with "*" as the default.
+// Audit:
+//   - The zero value is the strict policy: executables and HTML
+//     with active content (scripts, event handlers, frames,
+//     javascript: URLs) are refused on save, and notes are served
+//     inline as plain text.
+//   - Disposition "attachment" makes GET /file a download.
+//-------------------------------------------------------
+type ContentPolicy struct {
+    AllowExecutable bool   `json:"allow_executable"`
+    AllowActiveHTML bool   `json:"allow_active_html"`
+    Disposition     string `json:"disposition"`
+}
+
+//-------------------------------------------------------
+// Struct: RawConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Folders that may hold files of any type, read and written
+//     byte for byte with ?raw=1 (see handlers/raw.go).
+// Audit:
+//   - Folders are relative paths and include their subfolders.
+//     Empty (the default): raw mode is off everywhere.
+//   - MaxBytes caps one raw upload.
+//-------------------------------------------------------
+type RawConfig struct {
+    Folders  []string `json:"folders"`
+    MaxBytes int64    `json:"max_bytes"`
+}
+
+//-------------------------------------------------------
+// Struct: CompactConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Storage compaction (see handlers/compact.go): how long old
+//     note versions, find-and-replace snapshots and backups are
+//     kept, and how often compaction runs.
+// Audit:
+//   - Every limit defaults to 0, which keeps everything: nothing is
+//     collected until an operator opts in.
+//   - RevisionDays counts from the last save of that content;
+//     current content and content of notes under legal hold are
+//     always kept.
+//   - Interval 0 turns the scheduled run off; /admin/compact still
+//     works.
+//-------------------------------------------------------
+type CompactConfig struct {
+    Interval     Duration `json:"interval"`
+    RevisionDays int      `json:"revision_days"`
+    SnapshotDays int      `json:"snapshot_days"`
+    KeepBackups  int      `json:"keep_backups"`
+}
+
+//-------------------------------------------------------
+// Struct: IdempotencyConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Idempotency-Key support on mutating routes (see
+//     middleware_idempotency.go): how long a key and its outcome are
+//     remembered, and how many keys are kept at most.
+// Audit:
+//   - Window 0 turns the feature off; the header is then ignored.
+//   - When MaxKeys is reached the oldest key is forgotten first.
+//-------------------------------------------------------
+type IdempotencyConfig struct {
+    Window  Duration `json:"window"`
+    MaxKeys int      `json:"max_keys"`
+}
+
+//-------------------------------------------------------
+// Struct: TTSConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Text-to-speech for /file/audio (see handlers/tts.go): the
+//     local backend that renders a note to audio.
+// Audit:
+//   - Backend "" (the default) turns the feature off. "command" runs
+//     Command with the note text on stdin and reads the audio from
+//     stdout; "http" POSTs the text to URL, a speech server run on
+//     premises, and reads the audio from the response.
+//   - Command arguments may contain {lang} and {voice}. Voices maps
+//     a note language to a voice name; "default" is the fallback.
+//   - Format is what the backend produces: wav, mp3 or ogg.
+//   - MaxChars caps the text of one note; Timeout one rendering.
+//-------------------------------------------------------
+type TTSConfig struct {
+    Backend  string            `json:"backend"`
+    Command  []string          `json:"command"`
+    URL      string            `json:"url"`
+    Voices   map[string]string `json:"voices"`
+    Format   string            `json:"format"`
+    MaxChars int               `json:"max_chars"`
+    Timeout  Duration          `json:"timeout"`
+}
+
+//-------------------------------------------------------
+// Struct: ExportConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Stamps on printable note exports (/file/export?format=html,
+//     see handlers/export_html.go): the company name, the header
+//     and footer lines printed on every page, and the watermark
+//     printed across every page of a watermarked export.
+// Audit:
+//   - Header, Footer and Watermark may use the fields in
+//     ExportStampFields as {name}; an empty header or footer prints
+//     nothing. ExportedAt is shown in Timezone (IANA name).
+//-------------------------------------------------------
+type ExportConfig struct {
+    Company   string `json:"company"`
+    Header    string `json:"header"`
+    Footer    string `json:"footer"`
+    Watermark string `json:"watermark"`
+    Timezone  string `json:"timezone"`
+}
+
+// ExportStampFields are the {fields} export stamps may use.
+var ExportStampFields = []string{"company", "title", "path", "exported_at", "exporter", "sha256", "recipient", "share_id"}
+
+//-------------------------------------------------------
+// Struct: AntivirusConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Malware scanning of uploads by a ClamAV daemon (see
+//     handlers/antivirus.go) before they are written.
+// Audit:
+//   - Clamd "" (the default) turns scanning off; otherwise it is
+//     clamd's unix socket (an absolute path) or its host:port.
+//   - When clamd cannot be reached or reports an error, uploads are
+//     refused unless FailOpen is set.
+//   - Timeout bounds one scan, connection included.
+//-------------------------------------------------------
+type AntivirusConfig struct {
+    Clamd    string   `json:"clamd"`
+    FailOpen bool     `json:"fail_open"`
+    Timeout  Duration `json:"timeout"`
+}
+
+//-------------------------------------------------------
+// Struct: OCRConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Text extraction from scanned attachments (see
+//     handlers/ocr.go): the local OCR engine and which raw files it
+//     reads.
+// Audit:
+//   - Backend "" (the default) turns OCR off. "command" runs Command
+//     (e.g. tesseract); {input} in its arguments is replaced by a
+//     temporary copy of the attachment, otherwise the attachment is
+//     sent on stdin. "http" POSTs the attachment to URL. Either way
+//     the extracted text is read back as UTF-8.
+//   - {lang} in the arguments is replaced by Languages (tesseract
+//     style, e.g. "eng+deu").
+//   - Auto queues an "ocr" job for each uploaded attachment whose
+//     extension is listed in Extensions.
+//   - MaxBytes caps one attachment; Timeout one extraction.
+//-------------------------------------------------------
+type OCRConfig struct {
+    Backend    string   `json:"backend"`
+    Command    []string `json:"command"`
+    URL        string   `json:"url"`
+    Languages  string   `json:"languages"`
+    Extensions []string `json:"extensions"`
+    Auto       bool     `json:"auto"`
+    MaxBytes   int64    `json:"max_bytes"`
+    Timeout    Duration `json:"timeout"`
+}
+
+//-------------------------------------------------------
+// Struct: SecurityHeadersConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Response security headers (see middleware_headers.go); an
+//     empty value leaves that header out.
+// Audit:
+//   - HSTS is only sent over TLS, or when TrustForwardedProto is set
+//     and a TLS-terminating proxy sends X-Forwarded-Proto: https.
+//-------------------------------------------------------
+type SecurityHeadersConfig struct {
+    ContentSecurityPolicy string `json:"content_security_policy"`
+    ContentTypeOptions    string `json:"content_type_options"`
+    FrameOptions          string `json:"frame_options"`
+    ReferrerPolicy        string `json:"referrer_policy"`
+    HSTS                  string `json:"hsts"`
+    TrustForwardedProto   bool   `json:"trust_forwarded_proto"`
+}
+
+//-------------------------------------------------------
+// Struct: SyncConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Cross-instance sync: Key authenticates /sync (on a primary)
+//     and is presented to Primary (on a secondary).
+// Audit:
+//   - Key is a secret; Redacted() hides it.
+//   - Follower makes the secondary a read-only hot standby of
+//     Primary until promoted (see handlers/follower.go); it is read
+//     at startup.
+//-------------------------------------------------------
+type SyncConfig struct {
+    Key      string   `json:"key"`
+    Primary  string   `json:"primary"`
+    Interval Duration `json:"interval"`
+    Follower bool     `json:"follower"`
+}
+
+//-------------------------------------------------------
+// Struct: LintConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Optional spelling and terminology checks (/file/lint).
+// Audit:
+//   - Dictionary is a word list file, one word per line (e.g.
+//     /usr/share/dict/words); without it only Words and Terms apply.
+//   - Words is the custom dictionary (entity names, account codes);
+//     its spelling, including case, is the one enforced.
+//   - Terms maps a preferred term to variants that are flagged.
+//-------------------------------------------------------
+type LintConfig struct {
+    Enabled    bool                `json:"enabled"`
+    Dictionary string              `json:"dictionary"`
+    Words      []string            `json:"words"`
+    Terms      map[string][]string `json:"terms"`
+}
+
+//-------------------------------------------------------
+// Struct: RolloverConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Month-end rollover (/rollover): Template from
+//     folder_templates for the new period, Rolling name patterns of
+//     notes carried forward.
+// Audit:
+//   - Day > 0 schedules a rollover of every folder in Folders
+//     (parents of YYYY-MM period folders) on that day of the month;
+//     0 leaves rollover on-demand only.
+//-------------------------------------------------------
+type RolloverConfig struct {
+    Template string   `json:"template"`
+    Rolling  []string `json:"rolling"`
+    Folders  []string `json:"folders"`
+    Day      int      `json:"day"`
+}
+
+//-------------------------------------------------------
+// Struct: RecurringNote
+//-------------------------------------------------------
+// Purpose:
+//   - One recurring note: on each Schedule (cron, UTC) the note at
+//     Template is copied to Target.
+// Audit:
+//   - Target and the template's content may use {yyyy}, {mm},
+//     {dd}, {ww} (ISO week), {q} (quarter) and {date} (YYYY-MM-DD)
+//     of the scheduled time; an existing target is never
+//     overwritten.
+//-------------------------------------------------------
+type RecurringNote struct {
+    Name     string `json:"name"`
+    Schedule string `json:"schedule"`
+    Template string `json:"template"`
+    Target   string `json:"target"`
+}
+
+//-------------------------------------------------------
+// Struct: ProcessorConfig
+//-------------------------------------------------------
+// Purpose:
+//   - One content processor (see handlers/processors.go): an
+//     executable (Command) or a Go plugin (Plugin, a .so file) run
+//     on the listed Hooks: "save", "read" and "index".
+// Audit:
+//   - Processors run in the order listed. Folders limits one to
+//     notes in those folders (default: every note).
+//   - A failing save or read hook refuses the request unless
+//     FailOpen is set, in which case the content passes unchanged.
+//     A failing index hook is only logged.
+//   - Timeout bounds one hook call (0 = 10s).
+//-------------------------------------------------------
+type ProcessorConfig struct {
+    Name     string   `json:"name"`
+    Hooks    []string `json:"hooks"`
+    Command  []string `json:"command"`
+    Plugin   string   `json:"plugin"`
+    Folders  []string `json:"folders"`
+    Timeout  Duration `json:"timeout"`
+    FailOpen bool     `json:"fail_open"`
+}
+
+// ProcessorHooks are the hooks a processor may run on.
+var ProcessorHooks = []string{"save", "read", "index"}
+
+//-------------------------------------------------------
+// Struct: SensitiveConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Sensitive data scanning (/reports/sensitive): the built-in
+//     detectors to run, extra named patterns, and keywords.
+// Audit:
+//   - Detectors are names from SensitiveDetectors; Patterns maps a
+//     name to an RE2 expression; Keywords match whole words,
+//     ignoring case.
+//-------------------------------------------------------
+type SensitiveConfig struct {
+    Detectors []string          `json:"detectors"`
+    Patterns  map[string]string `json:"patterns"`
+    Keywords  []string          `json:"keywords"`
+}
+
+//-------------------------------------------------------
+// Struct: UserConfig
+//-------------------------------------------------------
+// Purpose:
+//   - One API user: the SHA-256 of their bearer token and roles.
+// Audit:
+//   - Only the token hash is stored; Redacted() hides it anyway.
+//-------------------------------------------------------
+type UserConfig struct {
+    TokenSHA256 string   `json:"token_sha256"`
+    Roles       []string `json:"roles"`
+}
+
+// AssetIntegrityModes are the accepted asset_integrity values:
+// "enforce" refuses tampered assets, "warn" logs and serves them,
+// "off" skips verification.
+var AssetIntegrityModes = []string{"enforce", "warn", "off"}
+
+// SensitiveDetectors are the built-in sensitive data detectors.
+var SensitiveDetectors = []string{"ssn", "card", "iban", "routing", "bank_account"}
+
+// ReferrerPolicies are the accepted security_headers.referrer_policy values.
+var ReferrerPolicies = []string{"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+    "same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url"}
+
+// KnownRoles are the roles a user may be granted.
+var KnownRoles = []string{"editor", "reviewer", "approver"}
+
+// userNamePattern restricts user names to safe file and log tokens.
+var userNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// tokenHashPattern matches a lowercase hex SHA-256.
+var tokenHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ocrLanguagesPattern matches tesseract language lists (eng+deu).
+var ocrLanguagesPattern = regexp.MustCompile(`^[A-Za-z_]{1,32}(\+[A-Za-z_]{1,32})*$`)
+
+// exportStampPattern finds {field} references in export stamps.
+var exportStampPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// minAdminKeyLength keeps the admin and sync keys out of guessable territory.
+const minAdminKeyLength = 16
+
+var (
+    current  atomic.Value // *Config
+    reloadMu sync.Mutex
+    filePath string
+)
+
+//-------------------------------------------------------
+// Function: Defaults
+//-------------------------------------------------------
+// Purpose:
+//   - Built-in configuration before environment and file overrides.
+//-------------------------------------------------------
+func Defaults() *Config {
+    return &Config{
+        Port:                "8080",
+        RequestTimeout:      Duration(10 * time.Second),
+        RouteTimeouts:       map[string]Duration{},
+        SLO:                 SLOConfig{Window: Duration(5 * time.Minute), MinSamples: 20},
+        DuplicateSimilarity: 0.9,
+        BackupDir:           "/backups",
+        TrashRetention:      map[string]int{"*": 30},
+        ContentPolicy:       map[string]ContentPolicy{},
+        Sync:                SyncConfig{Interval: Duration(time.Minute)},
+        Users:               map[string]UserConfig{},
+        AssetIntegrity:      "warn",
+        AssetManifest:       "./asset-manifest.json",
+        Lint:                LintConfig{Words: []string{}, Terms: map[string][]string{}},
+        JobWorkers:          2,
+        FolderTemplates:     map[string][]string{"default": {"01-close", "02-forecast", "03-board", "99-archive"}},
+        Rollover:            RolloverConfig{Template: "default", Rolling: []string{"*rolling*"}, Folders: []string{}},
+        Recurring:           []RecurringNote{},
+        Processors:          []ProcessorConfig{},
+        Anomaly:             AnomalyConfig{Window: Duration(10 * time.Minute), MaxReads: 200, MaxClientErrors: 50, LargeSaveBytes: 5 << 20, WorkDays: []string{"MON", "TUE", "WED", "THU", "FRI"}, Timezone: "UTC"},
+        Sessions:            SessionsConfig{IdleTimeout: Duration(30 * time.Minute), AbsoluteLifetime: Duration(12 * time.Hour)},
+        MFA:                 MFAConfig{Issuer: "CFO Scratchpad", RequiredRoles: []string{}},
+        LoginThrottle:       LoginThrottleConfig{FreeAttempts: 3, MaxFailures: 10, Window: Duration(15 * time.Minute), Lockout: Duration(15 * time.Minute), MaxDelay: Duration(30 * time.Second)},
+        Sensitive:           SensitiveConfig{Detectors: append([]string{}, SensitiveDetectors...), Patterns: map[string]string{}, Keywords: []string{}},
+        Scratch:             ScratchConfig{TTL: Duration(24 * time.Hour), MaxBuffers: 5, MaxBytes: 64 << 10},
+        Server:              ServerConfig{ReadHeaderTimeout: Duration(10 * time.Second), ReadTimeout: Duration(time.Minute), WriteTimeout: Duration(6 * time.Minute), IdleTimeout: Duration(2 * time.Minute), MaxHeaderBytes: 64 << 10, TCPKeepAlive: Duration(3 * time.Minute), HTTP2: true},
+        IPAccess:            IPAccessConfig{Allow: []string{}, Deny: []string{}, TrustedProxies: []string{}},
+        Automations:         AutomationsConfig{Roles: []string{"approver"}, AllowedNetworks: []string{}},
+        Raw:                 RawConfig{Folders: []string{}, MaxBytes: 10 << 20},
+        Idempotency:         IdempotencyConfig{Window: Duration(24 * time.Hour), MaxKeys: 10000},
+        OCR:                 OCRConfig{Command: []string{}, Languages: "eng", Extensions: []string{".pdf", ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".gif", ".bmp", ".webp"}, Auto: true, MaxBytes: 50 << 20, Timeout: Duration(5 * time.Minute)},
+        TTS:                 TTSConfig{Command: []string{}, Voices: map[string]string{}, Format: "wav", MaxChars: 100000, Timeout: Duration(2 * time.Minute)},
+        Antivirus:           AntivirusConfig{Timeout: Duration(time.Minute)},
+        Export:              ExportConfig{Header: "{company} | {title}", Footer: "{path} | SHA-256 {sha256} | exported {exported_at} by {exporter}", Watermark: "{recipient} | {share_id} | {exported_at}", Timezone: "UTC"},
+        Tracing:             TracingConfig{Endpoint: "http://localhost:4318", ServiceName: "cfo-scratchpad", SampleRatio: 1, Headers: map[string]string{}},
+        SecurityHeaders: SecurityHeadersConfig{
+            ContentSecurityPolicy: "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'; form-action 'self'",
+            ContentTypeOptions:    "nosniff",
+            FrameOptions:          "DENY",
+            ReferrerPolicy:        "no-referrer",
+            HSTS:                  "max-age=31536000; includeSubDomains",
+        },
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*Config) TrashRetentionDays
+//-------------------------------------------------------
+// Purpose:
+//   - Retention for a trashed path: the most specific folder rule
+//     that contains it, else the "*" default.
+// Audit:
+//   - 0 means keep forever.
+//-------------------------------------------------------
+func (c *Config) TrashRetentionDays(path string) int {
+    best, days := -1, c.TrashRetention["*"]
+    for folder, d := range c.TrashRetention {
+        if folder == "*" {
+            continue
+        }
+        if (path == folder || strings.HasPrefix(path, folder+"/")) && len(folder) > best {
+            best, days = len(folder), d
+        }
+    }
+    return days
+}
+
+//-------------------------------------------------------
+// Function: (*Config) ContentPolicyFor
+//-------------------------------------------------------
+// Purpose:
+//   - Content policy for a note: the most specific folder rule that
+//     contains it, else the "*" default, else the strict policy.
+//-------------------------------------------------------
+func (c *Config) ContentPolicyFor(path string) ContentPolicy {
+    best, policy := -1, c.ContentPolicy["*"]
+    for folder, p := range c.ContentPolicy {
+        if folder == "*" {
+            continue
+        }
+        if (path == folder || strings.HasPrefix(path, folder+"/")) && len(folder) > best {
+            best, policy = len(folder), p
+        }
+    }
+    return policy
+}
+
+//-------------------------------------------------------
+// Function: (*Config) Redacted
+//-------------------------------------------------------
+// Purpose:
+//   - Copy of the configuration safe to show to operators.
+//-------------------------------------------------------
+func (c *Config) Redacted() *Config {
+    copied := *c
+    if copied.AdminKey != "" {
+        copied.AdminKey = "[redacted]"
+    }
+    if copied.Sync.Key != "" {
+        copied.Sync.Key = "[redacted]"
+    }
+    copied.Tracing.Headers = make(map[string]string, len(c.Tracing.Headers))
+    for name := range c.Tracing.Headers {
+        copied.Tracing.Headers[name] = "[redacted]"
+    }
+    copied.Users = make(map[string]UserConfig, len(c.Users))
+    for name, user := range c.Users {
+        user.TokenSHA256 = "[redacted]"
+        copied.Users[name] = user
+    }
+    return &copied
+}
+
+//-------------------------------------------------------
+// Function: Current
+//-------------------------------------------------------
+// Purpose:
+//   - Active configuration; safe for concurrent use.
+// Audit:
+//   - Returns defaults+environment if Init has not run (CLI, tools).
+//   - Callers must treat the result as read-only.
+//-------------------------------------------------------
+func Current() *Config {
+    if c, ok := current.Load().(*Config); ok {
+        return c
+    }
+    c, _ := fromEnv(Defaults())
+    current.Store(c)
+    return c
+}
+
+//-------------------------------------------------------
+// Function: Init
+//-------------------------------------------------------
+// Purpose:
+//   - Load configuration at startup from env and CONFIG_FILE.
+// Audit:
+//   - Any error is returned so main can fail fast.
+//-------------------------------------------------------
+func Init() (*Config, error) {
+    filePath = os.Getenv("CONFIG_FILE")
+    c, err := build()
+    if err != nil {
+        return nil, err
+    }
+    current.Store(c)
+    return c, nil
+}
+
+//-------------------------------------------------------
+// Function: Reload
+//-------------------------------------------------------
+// Purpose:
+//   - Re-read the config file and swap the active config.
+// Audit:
+//   - On error the previous configuration remains active.
+//-------------------------------------------------------
+func Reload() (*Config, error) {
+    reloadMu.Lock()
+    defer reloadMu.Unlock()
+
+    c, err := build()
+    if err != nil {
+        return nil, err
+    }
+    current.Store(c)
+    return c, nil
+}
+
+// FilePath returns the config file in use ("" when none).
+func FilePath() string {
+    return filePath
+}
+
+//-------------------------------------------------------
+// Function: build
+//-------------------------------------------------------
+// Purpose:
+//   - Defaults -> environment -> file -> validation.
+//-------------------------------------------------------
+func build() (*Config, error) {
+    c, err := fromEnv(Defaults())
+    if err != nil {
+        return nil, err
+    }
+    if filePath != "" {
+        if err := applyFile(c, filePath); err != nil {
+            return nil, err
+        }
+    }
+    if err := c.Validate(); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+//-------------------------------------------------------
+// Function: fromEnv
+//-------------------------------------------------------
+// Purpose:
+//   - Apply the historical environment variables onto c.
+//-------------------------------------------------------
+func fromEnv(c *Config) (*Config, error) {
+    problems := []string{}
+    env := func(name string, apply func(string) error) {
+        if v := os.Getenv(name); v != "" {
+            if err := apply(v); err != nil {
+                problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+            }
+        }
+    }
+
+    env("PORT", func(v string) error { c.Port = v; return nil })
+    env("REQUEST_TIMEOUT", func(v string) error { return parseDurationInto(v, &c.RequestTimeout) })
+    env("ROUTE_TIMEOUTS", func(v string) error {
+        for _, pair := range strings.Split(v, ",") {
+            parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+            if len(parts) != 2 {
+                return fmt.Errorf("entry %q must be route=duration", pair)
+            }
+            var d Duration
+            if err := parseDurationInto(parts[1], &d); err != nil {
+                return err
+            }
+            c.RouteTimeouts[parts[0]] = d
+        }
+        return nil
+    })
+    env("SLO_P95_MS", func(v string) error {
+        n, err := strconv.ParseInt(v, 10, 64)
+        c.SLO.P95Ms = n
+        return err
+    })
+    env("SLO_WINDOW", func(v string) error { return parseDurationInto(v, &c.SLO.Window) })
+    env("SLO_MIN_SAMPLES", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.SLO.MinSamples = n
+        return err
+    })
+    env("SLO_WEBHOOK_URL", func(v string) error { c.SLO.WebhookURL = v; return nil })
+    env("SAVE_NORMALIZE_EOL", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.SaveNormalizeEOL = b
+        return err
+    })
+    env("DUPLICATE_SIMILARITY", func(v string) error {
+        f, err := strconv.ParseFloat(v, 64)
+        c.DuplicateSimilarity = f
+        return err
+    })
+    env("ADMIN_KEY", func(v string) error { c.AdminKey = v; return nil })
+    env("BACKUP_DIR", func(v string) error { c.BackupDir = v; return nil })
+    env("MAINTENANCE_PAGE", func(v string) error { c.MaintenancePage = v; return nil })
+    env("TRASH_RETENTION_DAYS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.TrashRetention["*"] = n
+        return err
+    })
+    env("SYNC_KEY", func(v string) error { c.Sync.Key = v; return nil })
+    env("SYNC_PRIMARY", func(v string) error { c.Sync.Primary = v; return nil })
+    env("SYNC_INTERVAL", func(v string) error { return parseDurationInto(v, &c.Sync.Interval) })
+    env("SYNC_FOLLOWER", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.Sync.Follower = b
+        return err
+    })
+    env("AUTH_REQUIRED", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.AuthRequired = b
+        return err
+    })
+    env("ASSET_INTEGRITY", func(v string) error { c.AssetIntegrity = v; return nil })
+    env("ASSET_MANIFEST", func(v string) error { c.AssetManifest = v; return nil })
+    env("LINT_ENABLED", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.Lint.Enabled = b
+        return err
+    })
+    env("LINT_DICTIONARY", func(v string) error { c.Lint.Dictionary = v; return nil })
+    env("LINK_CHECK_INTERVAL", func(v string) error { return parseDurationInto(v, &c.LinkCheckInterval) })
+    env("DURABLE_WRITES", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.DurableWrites = b
+        return err
+    })
+    env("FOLDER_TEMPLATE", func(v string) error {
+        c.FolderTemplates["default"] = strings.Split(v, ",")
+        return nil
+    })
+    env("ROLLOVER_DAY", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.Rollover.Day = n
+        return err
+    })
+    env("ROLLOVER_FOLDERS", func(v string) error { c.Rollover.Folders = strings.Split(v, ","); return nil })
+    env("JOB_WORKERS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.JobWorkers = n
+        return err
+    })
+    env("TLS_CERT_FILE", func(v string) error { c.Server.TLSCertFile = v; return nil })
+    env("TLS_KEY_FILE", func(v string) error { c.Server.TLSKeyFile = v; return nil })
+    env("IP_ALLOW", func(v string) error { c.IPAccess.Allow = splitList(v); return nil })
+    env("IP_DENY", func(v string) error { c.IPAccess.Deny = splitList(v); return nil })
+    env("TRUSTED_PROXIES", func(v string) error { c.IPAccess.TrustedProxies = splitList(v); return nil })
+    env("COMPACT_INTERVAL", func(v string) error { return parseDurationInto(v, &c.Compact.Interval) })
+    env("COMPACT_REVISION_DAYS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.Compact.RevisionDays = n
+        return err
+    })
+    env("COMPACT_SNAPSHOT_DAYS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.Compact.SnapshotDays = n
+        return err
+    })
+    env("COMPACT_KEEP_BACKUPS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.Compact.KeepBackups = n
+        return err
+    })
+    env("RAW_FOLDERS", func(v string) error { c.Raw.Folders = splitList(v); return nil })
+    env("RAW_MAX_BYTES", func(v string) error {
+        n, err := strconv.ParseInt(v, 10, 64)
+        c.Raw.MaxBytes = n
+        return err
+    })
+    env("IDEMPOTENCY_WINDOW", func(v string) error { return parseDurationInto(v, &c.Idempotency.Window) })
+    env("IDEMPOTENCY_MAX_KEYS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.Idempotency.MaxKeys = n
+        return err
+    })
+    env("TTS_BACKEND", func(v string) error { c.TTS.Backend = v; return nil })
+    env("TTS_COMMAND", func(v string) error { c.TTS.Command = strings.Fields(v); return nil })
+    env("TTS_URL", func(v string) error { c.TTS.URL = v; return nil })
+    env("TTS_FORMAT", func(v string) error { c.TTS.Format = v; return nil })
+    env("TTS_MAX_CHARS", func(v string) error {
+        n, err := strconv.Atoi(v)
+        c.TTS.MaxChars = n
+        return err
+    })
+    env("TTS_TIMEOUT", func(v string) error { return parseDurationInto(v, &c.TTS.Timeout) })
+    env("OCR_BACKEND", func(v string) error { c.OCR.Backend = v; return nil })
+    env("OCR_COMMAND", func(v string) error { c.OCR.Command = strings.Fields(v); return nil })
+    env("OCR_URL", func(v string) error { c.OCR.URL = v; return nil })
+    env("OCR_LANGUAGES", func(v string) error { c.OCR.Languages = v; return nil })
+    env("OCR_AUTO", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.OCR.Auto = b
+        return err
+    })
+    env("OCR_MAX_BYTES", func(v string) error {
+        n, err := strconv.ParseInt(v, 10, 64)
+        c.OCR.MaxBytes = n
+        return err
+    })
+    env("OCR_TIMEOUT", func(v string) error { return parseDurationInto(v, &c.OCR.Timeout) })
+    env("CLAMD_ADDRESS", func(v string) error { c.Antivirus.Clamd = v; return nil })
+    env("ANTIVIRUS_FAIL_OPEN", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.Antivirus.FailOpen = b
+        return err
+    })
+    env("ANTIVIRUS_TIMEOUT", func(v string) error { return parseDurationInto(v, &c.Antivirus.Timeout) })
+    env("EXPORT_COMPANY", func(v string) error { c.Export.Company = v; return nil })
+    env("EXPORT_TIMEZONE", func(v string) error { c.Export.Timezone = v; return nil })
+    env("TRACING_ENABLED", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.Tracing.Enabled = b
+        return err
+    })
+    env("OTEL_EXPORTER_OTLP_ENDPOINT", func(v string) error { c.Tracing.Endpoint = v; return nil })
+    env("OTEL_SERVICE_NAME", func(v string) error { c.Tracing.ServiceName = v; return nil })
+    env("OTEL_TRACES_SAMPLER_ARG", func(v string) error {
+        f, err := strconv.ParseFloat(v, 64)
+        c.Tracing.SampleRatio = f
+        return err
+    })
+    env("OTEL_EXPORTER_OTLP_HEADERS", func(v string) error {
+        headers := map[string]string{}
+        for _, pair := range strings.Split(v, ",") {
+            parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+            if len(parts) != 2 || parts[0] == "" {
+                return fmt.Errorf("entry %q must be name=value", pair)
+            }
+            headers[parts[0]] = parts[1]
+        }
+        c.Tracing.Headers = headers
+        return nil
+    })
+    env("READ_ONLY", func(v string) error {
+        b, err := strconv.ParseBool(v)
+        c.ReadOnly = b
+        return err
+    })
+
+    if len(problems) > 0 {
+        return c, errors.New("invalid environment: " + strings.Join(problems, "; "))
+    }
+    return c, nil
+}
+
+func knownRole(role string) bool {
+    for _, known := range KnownRoles {
+        if role == known {
+            return true
+        }
+    }
+    return false
+}
+
+func knownMode(mode string) bool {
+    for _, known := range AssetIntegrityModes {
+        if mode == known {
+            return true
+        }
+    }
+    return false
+}
+
+func knownReferrerPolicy(policy string) bool {
+    for _, known := range ReferrerPolicies {
+        if policy == known {
+            return true
+        }
+    }
+    return false
+}
+
+func knownDetector(name string) bool {
+    for _, known := range SensitiveDetectors {
+        if name == known {
+            return true
+        }
+    }
+    return false
+}
+
+func knownProcessorHook(hook string) bool {
+    for _, known := range ProcessorHooks {
+        if hook == known {
+            return true
+        }
+    }
+    return false
+}
+
+func knownExportStampField(field string) bool {
+    for _, known := range ExportStampFields {
+        if field == known {
+            return true
+        }
+    }
+    return false
+}
+
+//-------------------------------------------------------
+// Function: ParseWorkHours
+//-------------------------------------------------------
+// Purpose:
+//   - Parse "HH:MM-HH:MM" into start and end minutes of the day.
+// Audit:
+//   - start > end means the range wraps midnight; equal bounds are
+//     refused.
+//-------------------------------------------------------
+func ParseWorkHours(text string) (int, int, error) {
+    bounds := strings.Split(text, "-")
+    if len(bounds) != 2 {
+        return 0, 0, fmt.Errorf("want HH:MM-HH:MM, got %q", text)
+    }
+    minutes := [2]int{}
+    for i, bound := range bounds {
+        t, err := time.Parse("15:04", strings.TrimSpace(bound))
+        if err != nil {
+            return 0, 0, fmt.Errorf("want HH:MM-HH:MM, got %q", text)
+        }
+        minutes[i] = t.Hour()*60 + t.Minute()
+    }
+    if minutes[0] == minutes[1] {
+        return 0, 0, fmt.Errorf("start and end are the same in %q", text)
+    }
+    return minutes[0], minutes[1], nil
+}
+
+//-------------------------------------------------------
+// Function: ParseWeekday
+//-------------------------------------------------------
+// Purpose:
+//   - Map MON..SUN (any case) to a time.Weekday.
+//-------------------------------------------------------
+func ParseWeekday(name string) (time.Weekday, bool) {
+    for i, day := range []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"} {
+        if strings.EqualFold(name, day) {
+            return time.Weekday(i), true
+        }
+    }
+    return 0, false
+}
+
+//-------------------------------------------------------
+// Function: ParseAddressRange
+//-------------------------------------------------------
+// Purpose:
+//   - Parse a CIDR range or a single IP address (a one-address
+//     range) from the ip_access lists.
+// Audit:
+//   - IPv4-mapped IPv6 forms are reduced to IPv4, so an IPv4 range
+//     also matches clients seen on a dual-stack socket.
+//-------------------------------------------------------
+func ParseAddressRange(text string) (netip.Prefix, error) {
+    text = strings.TrimSpace(text)
+    if strings.Contains(text, "/") {
+        prefix, err := netip.ParsePrefix(text)
+        if err != nil {
+            return netip.Prefix{}, fmt.Errorf("invalid CIDR range %q", text)
+        }
+        if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+            prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+        }
+        return prefix.Masked(), nil
+    }
+    addr, err := netip.ParseAddr(text)
+    if err != nil {
+        return netip.Prefix{}, fmt.Errorf("invalid address %q", text)
+    }
+    addr = addr.Unmap()
+    return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// splitList splits a comma-separated environment value, dropping
+// blanks.
+func splitList(v string) []string {
+    list := []string{}
+    for _, item := range strings.Split(v, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
+}
+
+func parseDurationInto(v string, d *Duration) error {
+    parsed, err := time.ParseDuration(v)
+    if err != nil {
+        return fmt.Errorf("invalid duration %q", v)
+    }
+    *d = Duration(parsed)
+    return nil
+}
+
+//-------------------------------------------------------
+// Function: applyFile
+//-------------------------------------------------------
+// Purpose:
+//   - Overlay the JSON config file onto c.
+// Audit:
+//   - Syntax errors report line and column; unknown keys and type
+//     errors name the offending field.
+//-------------------------------------------------------
+func applyFile(c *Config, path string) error {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("config file %s: %v", path, err)
+    }
+
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(c); err != nil {
+        var syntaxErr *json.SyntaxError
+        var typeErr *json.UnmarshalTypeError
+        switch {
+        case errors.As(err, &syntaxErr):
+            line, col := lineCol(data, syntaxErr.Offset)
+            return fmt.Errorf("config file %s: syntax error at line %d, column %d: %v", path, line, col, err)
+        case errors.As(err, &typeErr):
+            line, col := lineCol(data, typeErr.Offset)
+            return fmt.Errorf("config file %s: field %q at line %d, column %d must be %s, not %s",
+                path, typeErr.Field, line, col, typeErr.Type, typeErr.Value)
+        default:
+            return fmt.Errorf("config file %s: %v", path, err)
+        }
+    }
+    return nil
+}
+
+func lineCol(data []byte, offset int64) (int, int) {
+    if offset > int64(len(data)) {
+        offset = int64(len(data))
+    }
+    before := data[:offset]
+    line := bytes.Count(before, []byte("\n")) + 1
+    col := int(offset) - bytes.LastIndexByte(before, '\n')
+    return line, col
+}
+
+//-------------------------------------------------------
+// Function: (*Config) Validate
+//-------------------------------------------------------
+// Purpose:
+//   - Range-check values and report every problem at once.
+//-------------------------------------------------------
+func (c *Config) Validate() error {
+    problems := []string{}
+    add := func(format string, args ...interface{}) {
+        problems = append(problems, fmt.Sprintf(format, args...))
+    }
+
+    if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+        add("port: must be 1-65535, got %q", c.Port)
+    }
+    if c.RequestTimeout <= 0 {
+        add("request_timeout: must be positive")
+    }
+    routes := make([]string, 0, len(c.RouteTimeouts))
+    for route := range c.RouteTimeouts {
+        routes = append(routes, route)
+    }
+    sort.Strings(routes)
+    for _, route := range routes {
+        if !strings.HasPrefix(route, "/") {
+            add("route_timeouts: route %q must start with /", route)
+        }
+        if c.RouteTimeouts[route] <= 0 {
+            add("route_timeouts[%s]: must be positive", route)
+        }
+    }
+    if c.SLO.P95Ms < 0 {
+        add("slo.p95_ms: must be >= 0 (0 disables alerting)")
+    }
+    if c.SLO.Window <= 0 {
+        add("slo.window: must be positive")
+    }
+    if c.SLO.MinSamples < 1 {
+        add("slo.min_samples: must be >= 1")
+    }
+    if c.SLO.WebhookURL != "" && !strings.HasPrefix(c.SLO.WebhookURL, "http://") && !strings.HasPrefix(c.SLO.WebhookURL, "https://") {
+        add("slo.webhook_url: must be an http(s) URL")
+    }
+    if c.DuplicateSimilarity <= 0 || c.DuplicateSimilarity > 1 {
+        add("duplicate_similarity: must be in (0, 1]")
+    }
+    if c.AdminKey != "" && len(c.AdminKey) < minAdminKeyLength {
+        add("admin_key: must be at least %d characters", minAdminKeyLength)
+    }
+    folders := make([]string, 0, len(c.TrashRetention))
+    for folder := range c.TrashRetention {
+        folders = append(folders, folder)
+    }
+    sort.Strings(folders)
+    for _, folder := range folders {
+        if c.TrashRetention[folder] < 0 {
+            add("trash_retention[%s]: days must be >= 0 (0 keeps forever)", folder)
+        }
+        if folder != "*" && (folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/")) {
+            add("trash_retention: folder %q must be a relative path without leading or trailing /", folder)
+        }
+    }
+    folders = folders[:0]
+    for folder := range c.ContentPolicy {
+        folders = append(folders, folder)
+    }
+    sort.Strings(folders)
+    for _, folder := range folders {
+        if d := c.ContentPolicy[folder].Disposition; d != "" && d != "inline" && d != "attachment" {
+            add("content_policy[%s].disposition: must be inline or attachment, got %q", folder, d)
+        }
+        if folder != "*" && (folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/")) {
+            add("content_policy: folder %q must be a relative path without leading or trailing /", folder)
+        }
+    }
+    if c.Sync.Key != "" && len(c.Sync.Key) < minAdminKeyLength {
+        add("sync.key: must be at least %d characters", minAdminKeyLength)
+    }
+    if c.Sync.Primary != "" {
+        if !strings.HasPrefix(c.Sync.Primary, "http://") && !strings.HasPrefix(c.Sync.Primary, "https://") {
+            add("sync.primary: must be an http(s) URL")
+        }
+        if c.Sync.Key == "" {
+            add("sync.primary: requires sync.key")
+        }
+    }
+    if c.Sync.Follower && c.Sync.Primary == "" {
+        add("sync.follower: requires sync.primary")
+    }
+    if c.Sync.Interval < Duration(5*time.Second) {
+        add("sync.interval: must be at least 5s")
+    }
+    names := make([]string, 0, len(c.Users))
+    for name := range c.Users {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        user := c.Users[name]
+        if !userNamePattern.MatchString(name) {
+            add("users: name %q must be 1-64 of a-z 0-9 . _ - (starting with a letter or digit)", name)
+        }
+        if !tokenHashPattern.MatchString(user.TokenSHA256) {
+            add("users[%s].token_sha256: must be 64 lowercase hex characters", name)
+        }
+        for _, role := range user.Roles {
+            if !knownRole(role) {
+                add("users[%s].roles: unknown role %q (known: %s)", name, role, strings.Join(KnownRoles, ", "))
+            }
+        }
+    }
+    if c.AuthRequired && len(c.Users) == 0 {
+        add("auth_required: requires at least one entry in users")
+    }
+    if !knownMode(c.AssetIntegrity) {
+        add("asset_integrity: must be one of %s, got %q", strings.Join(AssetIntegrityModes, ", "), c.AssetIntegrity)
+    }
+    if c.AssetIntegrity != "off" && c.AssetManifest == "" {
+        add("asset_manifest: required unless asset_integrity is off")
+    }
+    if c.Lint.Dictionary != "" && !filepath.IsAbs(c.Lint.Dictionary) {
+        add("lint.dictionary: must be an absolute path, got %q", c.Lint.Dictionary)
+    }
+    for i, word := range c.Lint.Words {
+        if strings.TrimSpace(word) == "" {
+            add("lint.words[%d]: must not be empty", i)
+        }
+    }
+    preferred := make([]string, 0, len(c.Lint.Terms))
+    for term := range c.Lint.Terms {
+        preferred = append(preferred, term)
+    }
+    sort.Strings(preferred)
+    for _, term := range preferred {
+        if strings.TrimSpace(term) == "" {
+            add("lint.terms: preferred term must not be empty")
+        }
+        if len(c.Lint.Terms[term]) == 0 {
+            add("lint.terms[%s]: must list at least one variant", term)
+        }
+        for _, variant := range c.Lint.Terms[term] {
+            if strings.TrimSpace(variant) == "" || variant == term {
+                add("lint.terms[%s]: variant %q must be non-empty and differ from the preferred term", term, variant)
+            }
+        }
+    }
+    if c.LinkCheckInterval != 0 && c.LinkCheckInterval < Duration(time.Minute) {
+        add("link_check_interval: must be 0 (off) or at least 1m")
+    }
+    templates := make([]string, 0, len(c.FolderTemplates))
+    for name := range c.FolderTemplates {
+        templates = append(templates, name)
+    }
+    sort.Strings(templates)
+    for _, name := range templates {
+        if strings.TrimSpace(name) == "" {
+            add("folder_templates: template name must not be empty")
+        }
+        if len(c.FolderTemplates[name]) == 0 {
+            add("folder_templates[%s]: must list at least one folder", name)
+        }
+        for _, folder := range c.FolderTemplates[name] {
+            if folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/") {
+                add("folder_templates[%s]: folder %q must be a relative path without leading or trailing /", name, folder)
+            }
+        }
+    }
+    if _, ok := c.FolderTemplates[c.Rollover.Template]; !ok {
+        add("rollover.template: no folder template named %q", c.Rollover.Template)
+    }
+    for _, pattern := range c.Rollover.Rolling {
+        if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+            add("rollover.rolling: invalid pattern %q", pattern)
+        }
+    }
+    for _, folder := range c.Rollover.Folders {
+        if folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/") {
+            add("rollover.folders: folder %q must be a relative path without leading or trailing /", folder)
+        }
+    }
+    if c.Rollover.Day < 0 || c.Rollover.Day > 28 {
+        add("rollover.day: must be between 0 (off) and 28, got %d", c.Rollover.Day)
+    }
+    recurring := map[string]bool{}
+    for i, note := range c.Recurring {
+        if note.Name == "" || recurring[note.Name] {
+            add("recurring[%d]: name must be non-empty and unique, got %q", i, note.Name)
+        }
+        recurring[note.Name] = true
+        if _, err := schedule.Parse(note.Schedule); err != nil {
+            add("recurring[%d].schedule: %v", i, err)
+        }
+        for _, field := range [][2]string{{"template", note.Template}, {"target", note.Target}} {
+            value := field[1]
+            if value == "" || strings.HasPrefix(value, "/") || !(strings.HasSuffix(value, ".md") || strings.HasSuffix(value, ".txt")) {
+                add("recurring[%d].%s: must be a relative .md or .txt note path, got %q", i, field[0], value)
+            }
+        }
+    }
+    processors := map[string]bool{}
+    for i, processor := range c.Processors {
+        if !userNamePattern.MatchString(processor.Name) || processors[processor.Name] {
+            add("processors[%d]: name must be unique lowercase letters, digits, '.', '_' or '-', got %q", i, processor.Name)
+        }
+        processors[processor.Name] = true
+        if len(processor.Hooks) == 0 {
+            add("processors[%d].hooks: must list at least one of %s", i, strings.Join(ProcessorHooks, ", "))
+        }
+        for _, hook := range processor.Hooks {
+            if !knownProcessorHook(hook) {
+                add("processors[%d].hooks: unknown hook %q (known: %s)", i, hook, strings.Join(ProcessorHooks, ", "))
+            }
+        }
+        switch {
+        case (len(processor.Command) > 0) == (processor.Plugin != ""):
+            add("processors[%d]: set exactly one of command and plugin", i)
+        case len(processor.Command) > 0 && !filepath.IsAbs(processor.Command[0]):
+            add("processors[%d].command: must start with an absolute program path, got %q", i, processor.Command[0])
+        case processor.Plugin != "" && (!filepath.IsAbs(processor.Plugin) || !strings.HasSuffix(processor.Plugin, ".so")):
+            add("processors[%d].plugin: must be an absolute path to a .so file, got %q", i, processor.Plugin)
+        }
+        for _, folder := range processor.Folders {
+            if folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/") {
+                add("processors[%d].folders: folder %q must be a relative path without leading or trailing /", i, folder)
+            }
+        }
+        if processor.Timeout < 0 || processor.Timeout > Duration(5*time.Minute) {
+            add("processors[%d].timeout: must be between 0 (10s) and 5m, got %s", i, processor.Timeout.Std())
+        }
+    }
+    for _, detector := range c.Sensitive.Detectors {
+        if !knownDetector(detector) {
+            add("sensitive.detectors: unknown detector %q (known: %s)", detector, strings.Join(SensitiveDetectors, ", "))
+        }
+    }
+    patternNames := make([]string, 0, len(c.Sensitive.Patterns))
+    for name := range c.Sensitive.Patterns {
+        patternNames = append(patternNames, name)
+    }
+    sort.Strings(patternNames)
+    for _, name := range patternNames {
+        if strings.TrimSpace(name) == "" || name == "keyword" || knownDetector(name) {
+            add("sensitive.patterns: name %q must be non-empty and not a detector name or \"keyword\"", name)
+        }
+        if re, err := regexp.Compile(c.Sensitive.Patterns[name]); err != nil {
+            add("sensitive.patterns[%s]: %v", name, err)
+        } else if re.MatchString("") {
+            add("sensitive.patterns[%s]: must not match the empty string", name)
+        }
+    }
+    for i, keyword := range c.Sensitive.Keywords {
+        if strings.TrimSpace(keyword) == "" {
+            add("sensitive.keywords[%d]: must not be empty", i)
+        }
+    }
+    if c.Anomaly.Window < Duration(time.Minute) {
+        add("anomaly.window: must be at least 1m")
+    }
+    if c.Anomaly.MaxReads < 1 || c.Anomaly.MaxClientErrors < 1 || c.Anomaly.LargeSaveBytes < 1 {
+        add("anomaly: max_reads, max_client_errors and large_save_bytes must be >= 1")
+    }
+    if c.Anomaly.WorkHours != "" {
+        if _, _, err := ParseWorkHours(c.Anomaly.WorkHours); err != nil {
+            add("anomaly.work_hours: %v", err)
+        }
+    }
+    for _, day := range c.Anomaly.WorkDays {
+        if _, ok := ParseWeekday(day); !ok {
+            add("anomaly.work_days: unknown day %q (use MON..SUN)", day)
+        }
+    }
+    if _, err := time.LoadLocation(c.Anomaly.Timezone); err != nil {
+        add("anomaly.timezone: %v", err)
+    }
+    if c.Anomaly.WebhookURL != "" && !strings.HasPrefix(c.Anomaly.WebhookURL, "http://") && !strings.HasPrefix(c.Anomaly.WebhookURL, "https://") {
+        add("anomaly.webhook_url: must be an http(s) URL")
+    }
+    headers := map[string]string{
+        "content_security_policy": c.SecurityHeaders.ContentSecurityPolicy,
+        "content_type_options":    c.SecurityHeaders.ContentTypeOptions,
+        "frame_options":           c.SecurityHeaders.FrameOptions,
+        "referrer_policy":         c.SecurityHeaders.ReferrerPolicy,
+        "hsts":                    c.SecurityHeaders.HSTS,
+    }
+    headerNames := make([]string, 0, len(headers))
+    for name := range headers {
+        headerNames = append(headerNames, name)
+    }
+    sort.Strings(headerNames)
+    for _, name := range headerNames {
+        if strings.ContainsAny(headers[name], "\r\n") {
+            add("security_headers.%s: must be a single line", name)
+        }
+    }
+    if v := c.SecurityHeaders.ContentTypeOptions; v != "" && v != "nosniff" {
+        add("security_headers.content_type_options: must be \"nosniff\" or empty, got %q", v)
+    }
+    if v := c.SecurityHeaders.FrameOptions; v != "" && v != "DENY" && v != "SAMEORIGIN" {
+        add("security_headers.frame_options: must be DENY, SAMEORIGIN or empty, got %q", v)
+    }
+    if v := c.SecurityHeaders.ReferrerPolicy; v != "" && !knownReferrerPolicy(v) {
+        add("security_headers.referrer_policy: unknown policy %q (known: %s)", v, strings.Join(ReferrerPolicies, ", "))
+    }
+    if v := c.SecurityHeaders.HSTS; v != "" && !strings.HasPrefix(v, "max-age=") {
+        add("security_headers.hsts: must start with max-age=, got %q", v)
+    }
+    if c.Scratch.TTL < Duration(time.Minute) || c.Scratch.TTL > Duration(7*24*time.Hour) {
+        add("scratch.ttl: must be 1m-168h, got %s", c.Scratch.TTL.Std())
+    }
+    if c.Scratch.MaxBuffers < 1 || c.Scratch.MaxBuffers > 50 {
+        add("scratch.max_buffers: must be 1-50, got %d", c.Scratch.MaxBuffers)
+    }
+    if c.Scratch.MaxBytes < 1<<10 || c.Scratch.MaxBytes > 1<<20 {
+        add("scratch.max_bytes: must be 1024-1048576, got %d", c.Scratch.MaxBytes)
+    }
+    if c.Sessions.IdleTimeout < Duration(time.Minute) || c.Sessions.AbsoluteLifetime < c.Sessions.IdleTimeout {
+        add("sessions: need 1m <= idle_timeout <= absolute_lifetime")
+    }
+    if strings.TrimSpace(c.MFA.Issuer) == "" || strings.Contains(c.MFA.Issuer, ":") {
+        add("mfa.issuer: must be non-empty and contain no ':'")
+    }
+    for _, role := range c.MFA.RequiredRoles {
+        if !knownRole(role) {
+            add("mfa.required_roles: unknown role %q (known: %s)", role, strings.Join(KnownRoles, ", "))
+        }
+    }
+    if c.LoginThrottle.FreeAttempts < 0 || c.LoginThrottle.MaxFailures <= c.LoginThrottle.FreeAttempts {
+        add("login_throttle: need 0 <= free_attempts < max_failures")
+    }
+    if c.LoginThrottle.Window < Duration(time.Minute) || c.LoginThrottle.Lockout < Duration(time.Minute) {
+        add("login_throttle: window and lockout must be at least 1m")
+    }
+    if c.LoginThrottle.MaxDelay < Duration(time.Second) {
+        add("login_throttle.max_delay: must be at least 1s")
+    }
+    if c.Server.ReadHeaderTimeout < Duration(time.Second) || c.Server.ReadTimeout < c.Server.ReadHeaderTimeout {
+        add("server: need 1s <= read_header_timeout <= read_timeout")
+    }
+    if c.Server.IdleTimeout < Duration(time.Second) {
+        add("server.idle_timeout: must be at least 1s")
+    }
+    if c.Server.WriteTimeout != 0 {
+        longest := c.RequestTimeout
+        for _, d := range c.RouteTimeouts {
+            if d > longest {
+                longest = d
+            }
+        }
+        if c.Server.WriteTimeout <= longest {
+            add("server.write_timeout: must be 0 (off) or longer than every request and route timeout (%s)", longest.Std())
+        }
+    }
+    if c.Server.MaxHeaderBytes < 4<<10 || c.Server.MaxHeaderBytes > 1<<20 {
+        add("server.max_header_bytes: must be 4096-1048576, got %d", c.Server.MaxHeaderBytes)
+    }
+    if c.Server.TCPKeepAlive < 0 {
+        add("server.tcp_keep_alive: must be >= 0 (0 turns probes off)")
+    }
+    if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+        add("server: tls_cert_file and tls_key_file must be set together")
+    }
+    for _, field := range [][2]string{{"tls_cert_file", c.Server.TLSCertFile}, {"tls_key_file", c.Server.TLSKeyFile}} {
+        if field[1] != "" && !filepath.IsAbs(field[1]) {
+            add("server.%s: must be an absolute path, got %q", field[0], field[1])
+        }
+    }
+    for _, list := range []struct {
+        name    string
+        entries []string
+    }{{"allow", c.IPAccess.Allow}, {"deny", c.IPAccess.Deny}, {"trusted_proxies", c.IPAccess.TrustedProxies}} {
+        for i, entry := range list.entries {
+            if _, err := ParseAddressRange(entry); err != nil {
+                add("ip_access.%s[%d]: %v", list.name, i, err)
+            }
+        }
+    }
+    if len(c.Automations.Roles) == 0 {
+        add("automations.roles: must name at least one role")
+    }
+    for _, role := range c.Automations.Roles {
+        if !knownRole(role) {
+            add("automations.roles: unknown role %q (known: %s)", role, strings.Join(KnownRoles, ", "))
+        }
+    }
+    for i, entry := range c.Automations.AllowedNetworks {
+        if _, err := ParseAddressRange(entry); err != nil {
+            add("automations.allowed_networks[%d]: %v", i, err)
+        }
+    }
+    for _, folder := range c.Raw.Folders {
+        if folder == "" || strings.HasPrefix(folder, "/") || strings.HasSuffix(folder, "/") || strings.HasPrefix(folder, ".") || strings.Contains(folder, "/.") {
+            add("raw.folders: folder %q must be a relative path without leading or trailing / or hidden components", folder)
+        }
+    }
+    if c.Compact.Interval != 0 && c.Compact.Interval < Duration(time.Hour) {
+        add("compact.interval: must be 0 (off) or at least 1h")
+    }
+    for _, field := range []struct {
+        name  string
+        value int
+    }{{"revision_days", c.Compact.RevisionDays}, {"snapshot_days", c.Compact.SnapshotDays}, {"keep_backups", c.Compact.KeepBackups}} {
+        if field.value < 0 {
+            add("compact.%s: must be >= 0 (0 keeps everything), got %d", field.name, field.value)
+        }
+    }
+    if c.Raw.MaxBytes < 1 || c.Raw.MaxBytes > 1<<30 {
+        add("raw.max_bytes: must be 1-1073741824, got %d", c.Raw.MaxBytes)
+    }
+    if c.Idempotency.Window < 0 || c.Idempotency.Window > Duration(7*24*time.Hour) {
+        add("idempotency.window: must be between 0 (off) and 168h, got %s", c.Idempotency.Window.Std())
+    }
+    if c.Idempotency.MaxKeys < 1 || c.Idempotency.MaxKeys > 1000000 {
+        add("idempotency.max_keys: must be 1-1000000, got %d", c.Idempotency.MaxKeys)
+    }
+    switch c.TTS.Backend {
+    case "":
+    case "command":
+        if len(c.TTS.Command) == 0 || !filepath.IsAbs(c.TTS.Command[0]) {
+            add("tts.command: must start with an absolute program path when tts.backend is command")
+        }
+    case "http":
+        if u, err := url.Parse(c.TTS.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            add("tts.url: must be an http(s) URL when tts.backend is http, got %q", c.TTS.URL)
+        }
+    default:
+        add("tts.backend: must be \"\", command or http, got %q", c.TTS.Backend)
+    }
+    if c.TTS.Format != "wav" && c.TTS.Format != "mp3" && c.TTS.Format != "ogg" {
+        add("tts.format: must be wav, mp3 or ogg, got %q", c.TTS.Format)
+    }
+    if c.TTS.MaxChars < 1 || c.TTS.MaxChars > 1000000 {
+        add("tts.max_chars: must be 1-1000000, got %d", c.TTS.MaxChars)
+    }
+    if c.TTS.Timeout < Duration(time.Second) || c.TTS.Timeout > Duration(5*time.Minute) {
+        add("tts.timeout: must be between 1s and 5m, got %s", c.TTS.Timeout.Std())
+    }
+    switch c.OCR.Backend {
+    case "":
+    case "command":
+        if len(c.OCR.Command) == 0 || !filepath.IsAbs(c.OCR.Command[0]) {
+            add("ocr.command: must start with an absolute program path when ocr.backend is command")
+        }
+    case "http":
+        if u, err := url.Parse(c.OCR.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            add("ocr.url: must be an http(s) URL when ocr.backend is http, got %q", c.OCR.URL)
+        }
+    default:
+        add("ocr.backend: must be \"\", command or http, got %q", c.OCR.Backend)
+    }
+    if !ocrLanguagesPattern.MatchString(c.OCR.Languages) {
+        add("ocr.languages: must be language codes joined by +, such as eng+deu, got %q", c.OCR.Languages)
+    }
+    for _, ext := range c.OCR.Extensions {
+        if !strings.HasPrefix(ext, ".") || ext == ".txt" || ext == ".md" {
+            add("ocr.extensions: %q must start with a dot and not be a note extension", ext)
+        }
+    }
+    if c.OCR.MaxBytes < 1 || c.OCR.MaxBytes > 1<<30 {
+        add("ocr.max_bytes: must be 1-1073741824, got %d", c.OCR.MaxBytes)
+    }
+    if c.OCR.Timeout < Duration(time.Second) || c.OCR.Timeout > Duration(30*time.Minute) {
+        add("ocr.timeout: must be between 1s and 30m, got %s", c.OCR.Timeout.Std())
+    }
+    if clamd := c.Antivirus.Clamd; clamd != "" && !filepath.IsAbs(clamd) {
+        if host, port, err := net.SplitHostPort(clamd); err != nil || host == "" || port == "" {
+            add("antivirus.clamd: must be an absolute socket path or host:port, got %q", clamd)
+        }
+    }
+    if c.Antivirus.Timeout < Duration(time.Second) || c.Antivirus.Timeout > Duration(10*time.Minute) {
+        add("antivirus.timeout: must be between 1s and 10m, got %s", c.Antivirus.Timeout.Std())
+    }
+    if !strings.Contains(c.Export.Watermark, "{recipient}") && !strings.Contains(c.Export.Watermark, "{share_id}") {
+        add("export.watermark: must include {recipient} or {share_id}, got %q", c.Export.Watermark)
+    }
+    for _, field := range [][2]string{{"header", c.Export.Header}, {"footer", c.Export.Footer}, {"watermark", c.Export.Watermark}} {
+        for _, match := range exportStampPattern.FindAllStringSubmatch(field[1], -1) {
+            if !knownExportStampField(match[1]) {
+                add("export.%s: unknown field {%s} (known: %s)", field[0], match[1], strings.Join(ExportStampFields, ", "))
+            }
+        }
+    }
+    if _, err := time.LoadLocation(c.Export.Timezone); err != nil || c.Export.Timezone == "" {
+        add("export.timezone: must be an IANA time zone name, got %q", c.Export.Timezone)
+    }
+    if c.Tracing.Enabled {
+        if _, err := tracing.TracesURL(c.Tracing.Endpoint); err != nil {
+            add("tracing.%v", err)
+        }
+        if strings.TrimSpace(c.Tracing.ServiceName) == "" {
+            add("tracing.service_name: must not be empty")
+        }
+    }
+    if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+        add("tracing.sample_ratio: must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+    }
+    if c.JobWorkers < 1 || c.JobWorkers > 16 {
+        add("job_workers: must be between 1 and 16, got %d", c.JobWorkers)
+    }
+    if !filepath.IsAbs(c.BackupDir) {
+        add("backup_dir: must be an absolute path, got %q", c.BackupDir)
+    }
+    if c.MaintenancePage != "" && !filepath.IsAbs(c.MaintenancePage) {
+        add("maintenance_page: must be an absolute path, got %q", c.MaintenancePage)
+    }
+
+    if len(problems) > 0 {
+        return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+    }
+    return nil
+}
@@ -0,0 +1,148 @@
+//-------------------------------------------------------
+// backend/config_reload.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Hot-reload the config file on SIGHUP or POST /admin/config/reload.
+//   - Show the effective configuration via GET /admin/config.
+// Audit:
+//   - Every reload attempt writes an "admin.config_reload" audit event
+//     recording the trigger and outcome.
+//   - A rejected file leaves the running configuration untouched.
+//   - A successful reload re-verifies the frontend assets.
+//   - The listen port and server tuning are only read at startup;
+//     changing them is reported but needs a restart.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "os/signal"
+    "reflect"
+    "syscall"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+//-------------------------------------------------------
+// Function: reloadConfig
+//-------------------------------------------------------
+// Purpose:
+//   - Reload configuration and record the outcome.
+// Audit:
+//   - event carries the trigger (method/path/remote IP); Status and
+//     Detail are filled in here before it is written.
+//-------------------------------------------------------
+func reloadConfig(event audit.Event) (*config.Config, error) {
+    previous := config.Current()
+    cfg, err := config.Reload()
+
+    event.Event = "admin.config_reload"
+    event.Target = config.FilePath()
+    if err != nil {
+        logError("Config reload rejected: " + err.Error())
+        event.Status = http.StatusUnprocessableEntity
+        event.Detail = err.Error()
+        audit.Write(event)
+        return nil, err
+    }
+
+    logInfo("Configuration reloaded from " + describeConfigSource())
+    if cfg.Port != previous.Port {
+        logWarn("Port change to " + cfg.Port + " takes effect after restart")
+    }
+    if cfg.Server != previous.Server {
+        logWarn("Server tuning changes take effect after restart")
+    }
+    if !reflect.DeepEqual(cfg.Tracing, previous.Tracing) {
+        logWarn("Tracing changes take effect after restart")
+    }
+    verifyAssets(cfg)
+    event.Status = http.StatusOK
+    event.Detail = "reloaded"
+    audit.Write(event)
+    return cfg, nil
+}
+
+//-------------------------------------------------------
+// Function: watchConfigSignals
+//-------------------------------------------------------
+// Purpose:
+//   - Reload configuration whenever the process receives SIGHUP.
+//-------------------------------------------------------
+func watchConfigSignals() {
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGHUP)
+    for range signals {
+        logInfo("SIGHUP received, reloading configuration")
+        reloadConfig(audit.Event{Method: "SIGNAL", Path: "SIGHUP"})
+    }
+}
+
+//-------------------------------------------------------
+// Function: describeConfigSource
+//-------------------------------------------------------
+// Purpose:
+//   - Human-readable origin of the active configuration.
+//-------------------------------------------------------
+func describeConfigSource() string {
+    if path := config.FilePath(); path != "" {
+        return path
+    }
+    return "environment (CONFIG_FILE not set)"
+}
+
+//-------------------------------------------------------
+// Function: handleConfig
+//-------------------------------------------------------
+// Purpose:
+//   - GET /admin/config: effective configuration as JSON.
+// Audit:
+//   - Writes "admin.config_view"; admin_key is redacted.
+//-------------------------------------------------------
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    auditAdmin(r, "admin.config_view", http.StatusOK, config.FilePath(), "")
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "source": describeConfigSource(),
+        "config": config.Current().Redacted(),
+    })
+}
+
+//-------------------------------------------------------
+// Function: handleConfigReload
+//-------------------------------------------------------
+// Purpose:
+//   - POST /admin/config/reload: re-read the config file.
+// Audit:
+//   - 422 with the validation message when the file is rejected.
+//-------------------------------------------------------
+func handleConfigReload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    cfg, err := reloadConfig(audit.Event{
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+    })
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeInvalidConfig, "", err.Error())
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "source": describeConfigSource(),
+        "config": cfg.Redacted(),
+    })
+}
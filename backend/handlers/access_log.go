@@ -0,0 +1,180 @@
+// -------------------------------------------------------
+// backend/handlers/access_log.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Per-note access log: GET /file/access-log?path=... answers
+//     who read, saved, moved, deleted, exported, signed, ... one
+//     note and when, newest first.
+//   - Built from the change journal (saves, moves, deletes) and the
+//     audit log (reads and other events naming the note); nothing
+//     extra is stored.
+// Audit:
+//   - Reads are the "file.read" events written by GET /file and
+//     /file/preview; older logs, written before reads were
+//     recorded, have none.
+//   - Moves are listed under both the old and the new path.
+//   - Only events naming the exact path are included; a folder path
+//     does not collect the events of its notes.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    accessLogPageSize    = 100
+    maxAccessLogPageSize = 1000
+)
+
+// -------------------------------------------------------
+// func collectAccessLog(ctx, rel, since, types, actor) ([]Activity, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Every journal entry and audit event for rel since the given
+//     time, newest first, filtered by type and actor when set.
+// Audit:
+//   - Audit events without Event (plain request records) carry no
+//     note path and are never included.
+// -------------------------------------------------------
+func collectAccessLog(ctx context.Context, rel string, since time.Time, types []string, actor string) ([]Activity, error) {
+    first := since.UTC().Format("2006-01-02T15:04:05Z")
+    items := []Activity{}
+    keep := func(a Activity) {
+        if a.At < first || (actor != "" && a.Actor != actor) {
+            return
+        }
+        if len(types) > 0 && !oneOf(a.Type, types) {
+            return
+        }
+        items = append(items, a)
+    }
+
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        return items, err
+    }
+    local := InstanceID(ctx)
+    for _, entry := range entries {
+        if entry.Path != rel && entry.From != rel {
+            continue
+        }
+        a := Activity{
+            ID:     fmt.Sprintf("journal:%012d", entry.Clock),
+            At:     entry.At,
+            Type:   activityJournalTypes[entry.Op],
+            Actor:  entry.Actor,
+            Path:   entry.Path,
+            From:   entry.From,
+            Detail: journalDetail(entry),
+        }
+        if entry.Origin != local {
+            a.Origin = entry.Origin
+        }
+        if a.Type != "" {
+            keep(a)
+        }
+    }
+
+    err = audit.Scan(since, func(event audit.Event, ref string) {
+        if event.Event == "" || event.Target != rel {
+            return
+        }
+        keep(Activity{
+            ID:       "audit:" + ref,
+            At:       event.Timestamp,
+            Type:     event.Event,
+            Actor:    event.Actor,
+            Path:     event.Target,
+            Detail:   event.Detail,
+            RemoteIP: event.RemoteIP,
+        })
+    })
+    if err != nil {
+        return items, err
+    }
+
+    sort.Slice(items, func(i, j int) bool {
+        return activityBefore(items[j], items[i].At, items[i].ID)
+    })
+    return items, nil
+}
+
+// -------------------------------------------------------
+// func HandleFileAccessLog(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/access-log?path=...&days=D&type=T,...&actor=A&limit=N
+//     {"path", "items", "truncated"}.
+// Audit:
+//   - days defaults to 30 (max 366); limit to 100 (max 1000).
+//   - type takes event names as listed, e.g. "file.read,note.move".
+// -------------------------------------------------------
+func HandleFileAccessLog(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    q := r.URL.Query()
+    file := q.Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    days, err := strconv.Atoi(defaultString(q.Get("days"), strconv.Itoa(activityDays)))
+    if err != nil || days < 1 || days > maxActivityDays {
+        apierror.Write(w, r, apierror.CodeInvalidField, "days", fmt.Sprintf("Bad request: days must be 1-%d", maxActivityDays))
+        return
+    }
+    limit, err := strconv.Atoi(defaultString(q.Get("limit"), strconv.Itoa(accessLogPageSize)))
+    if err != nil || limit < 1 || limit > maxAccessLogPageSize {
+        apierror.Write(w, r, apierror.CodeInvalidField, "limit", fmt.Sprintf("Bad request: limit must be 1-%d", maxAccessLogPageSize))
+        return
+    }
+    types := []string{}
+    if t := q.Get("type"); t != "" {
+        types = strings.Split(t, ",")
+    }
+
+    rel := relativeTo(r.Context(), absPath)
+    since := timeNow(r.Context()).UTC().AddDate(0, 0, -days)
+    var items []Activity
+    err = runWithContext(r.Context(), func() error {
+        var readErr error
+        items, readErr = collectAccessLog(r.Context(), rel, since, types, q.Get("actor"))
+        return readErr
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "collect access log for "+rel, "Internal server error")
+        return
+    }
+
+    truncated := len(items) > limit
+    if truncated {
+        items = items[:limit]
+    }
+    logInfo(r.Context(), fmt.Sprintf("Access log for %s: %d events", rel, len(items)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":      rel,
+        "items":     items,
+        "truncated": truncated,
+    })
+}
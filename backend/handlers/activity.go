@@ -0,0 +1,280 @@
+// -------------------------------------------------------
+// backend/handlers/activity.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Activity feed: GET /activity returns meaningful note events
+//     (saves, moves, deletes, workflow, comments, signatures, ...)
+//     newest first, paginated by an opaque cursor.
+//   - Built from the change journal (content changes) and the audit
+//     log (domain events); nothing extra is stored.
+// Audit:
+//   - Only note and folder events appear. Request, security, admin,
+//     sync, and auth events are never exposed through the feed.
+//   - Items are filtered per caller with pathVisible, the check of
+//     the read routes: an item whose path (or, for a move, former
+//     path) the caller could not open or list is left out.
+//   - ?scope=mine restricts the feed to the caller's own events and
+//     requires a user token.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    activityPageSize    = 50
+    maxActivityPageSize = 500
+    activityDays        = 30
+    maxActivityDays     = 366
+)
+
+// activityAuditEvents are the audit events shown in the feed.
+var activityAuditEvents = map[string]bool{
+    "workflow.submit":    true,
+    "workflow.reject":    true,
+    "workflow.approve":   true,
+    "workflow.reopen":    true,
+    "comment.add":        true,
+    "comment.resolve":    true,
+    "file.sign":          true,
+    "file.save_conflict": true,
+    "ledger.enable":      true,
+    "conflict.resolve":   true,
+    "sync.conflict":      true,
+    "folder.archive":     true,
+    "folder.unarchive":   true,
+}
+
+// activityJournalTypes names journal operations in the feed.
+var activityJournalTypes = map[string]string{
+    journalPut:    "note.save",
+    journalDelete: "note.delete",
+    journalMove:   "note.move",
+    journalTags:   "note.tags",
+    journalMkdir:  "folder.create",
+}
+
+// activityFolderTypes are the feed types whose path is a folder.
+var activityFolderTypes = map[string]bool{
+    "folder.create":    true,
+    "folder.archive":   true,
+    "folder.unarchive": true,
+}
+
+// journalDetail is the feed detail of a journal entry: the tags
+// after a tag change, else the content hash.
+func journalDetail(entry JournalEntry) string {
+    if entry.Op == journalTags {
+        return strings.Join(entry.Tags, " ")
+    }
+    return entry.SHA256
+}
+
+// -------------------------------------------------------
+// type Activity
+// -------------------------------------------------------
+// Purpose:
+//   - One feed item.
+// Audit:
+//   - Origin is set for changes pulled from another instance.
+//   - RemoteIP is set only in /file/access-log.
+// -------------------------------------------------------
+type Activity struct {
+    ID       string `json:"id"`
+    At       string `json:"at"`
+    Type     string `json:"type"`
+    Actor    string `json:"actor,omitempty"`
+    Path     string `json:"path"`
+    From     string `json:"from,omitempty"`
+    Origin   string `json:"origin,omitempty"`
+    Detail   string `json:"detail,omitempty"`
+    RemoteIP string `json:"remote_ip,omitempty"`
+}
+
+// activityResponse is the GET /activity payload.
+type activityResponse struct {
+    Items      []Activity `json:"items"`
+    NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// activityBefore reports whether a is older than the position (at, id).
+func activityBefore(a Activity, at string, id string) bool {
+    if a.At != at {
+        return a.At < at
+    }
+    return a.ID < id
+}
+
+// encodeActivityCursor / decodeActivityCursor wrap the position of
+// the last returned item.
+func encodeActivityCursor(a Activity) string {
+    return base64.RawURLEncoding.EncodeToString([]byte(a.At + "|" + a.ID))
+}
+
+func decodeActivityCursor(cursor string) (string, string, bool) {
+    raw, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return "", "", false
+    }
+    parts := strings.SplitN(string(raw), "|", 2)
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        return "", "", false
+    }
+    return parts[0], parts[1], true
+}
+
+// -------------------------------------------------------
+// func collectActivity(ctx, since, actor) ([]Activity, error)
+// -------------------------------------------------------
+// Purpose:
+//   - All items since the given time visible to the caller of ctx,
+//     newest first, optionally limited to one actor.
+// -------------------------------------------------------
+func collectActivity(ctx context.Context, since time.Time, actor string) ([]Activity, error) {
+    first := since.UTC().Format("2006-01-02T15:04:05Z")
+    items := []Activity{}
+    keep := func(a Activity) {
+        if a.At < first || (actor != "" && a.Actor != actor) {
+            return
+        }
+        folder := activityFolderTypes[a.Type]
+        if a.Path == "" || !pathVisible(ctx, a.Path, folder) || a.From != "" && !pathVisible(ctx, a.From, folder) {
+            return
+        }
+        items = append(items, a)
+    }
+
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        return items, err
+    }
+    local := InstanceID(ctx)
+    for _, entry := range entries {
+        a := Activity{
+            ID:     fmt.Sprintf("journal:%012d", entry.Clock),
+            At:     entry.At,
+            Type:   activityJournalTypes[entry.Op],
+            Actor:  entry.Actor,
+            Path:   entry.Path,
+            From:   entry.From,
+            Detail: journalDetail(entry),
+        }
+        if entry.Origin != local {
+            a.Origin = entry.Origin
+        }
+        if a.Type != "" {
+            keep(a)
+        }
+    }
+
+    err = audit.Scan(since, func(event audit.Event, ref string) {
+        if !activityAuditEvents[event.Event] {
+            return
+        }
+        keep(Activity{
+            ID:     "audit:" + ref,
+            At:     event.Timestamp,
+            Type:   event.Event,
+            Actor:  event.Actor,
+            Path:   event.Target,
+            Detail: event.Detail,
+        })
+    })
+    if err != nil {
+        return items, err
+    }
+
+    sort.Slice(items, func(i, j int) bool {
+        return activityBefore(items[j], items[i].At, items[i].ID)
+    })
+    return items, nil
+}
+
+// -------------------------------------------------------
+// func HandleActivity(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /activity?scope=all|mine&limit=N&days=D&cursor=C
+// Audit:
+//   - Always returns an array for items ([] when none); next_cursor
+//     is present only when more items follow.
+// -------------------------------------------------------
+func HandleActivity(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    q := r.URL.Query()
+
+    actor := ""
+    switch defaultString(q.Get("scope"), "all") {
+    case "all":
+    case "mine":
+        user, ok := requireUser(w, r)
+        if !ok {
+            return
+        }
+        actor = user.Name
+    default:
+        apierror.Write(w, r, apierror.CodeInvalidField, "scope", "Bad request: scope must be all or mine")
+        return
+    }
+
+    limit, err := strconv.Atoi(defaultString(q.Get("limit"), strconv.Itoa(activityPageSize)))
+    if err != nil || limit < 1 || limit > maxActivityPageSize {
+        apierror.Write(w, r, apierror.CodeInvalidField, "limit", fmt.Sprintf("Bad request: limit must be 1-%d", maxActivityPageSize))
+        return
+    }
+    days, err := strconv.Atoi(defaultString(q.Get("days"), strconv.Itoa(activityDays)))
+    if err != nil || days < 1 || days > maxActivityDays {
+        apierror.Write(w, r, apierror.CodeInvalidField, "days", fmt.Sprintf("Bad request: days must be 1-%d", maxActivityDays))
+        return
+    }
+    cursorAt, cursorID := "", ""
+    if cursor := q.Get("cursor"); cursor != "" {
+        var ok bool
+        if cursorAt, cursorID, ok = decodeActivityCursor(cursor); !ok {
+            apierror.Write(w, r, apierror.CodeInvalidField, "cursor", "Bad request: invalid cursor")
+            return
+        }
+    }
+
+    var items []Activity
+    since := timeNow(r.Context()).UTC().AddDate(0, 0, -days)
+    err = runWithContext(r.Context(), func() error {
+        var readErr error
+        items, readErr = collectActivity(r.Context(), since, actor)
+        return readErr
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "collect activity", "Internal server error")
+        return
+    }
+
+    if cursorAt != "" {
+        start := sort.Search(len(items), func(i int) bool {
+            return activityBefore(items[i], cursorAt, cursorID)
+        })
+        items = items[start:]
+    }
+    resp := activityResponse{Items: items}
+    if len(items) > limit {
+        resp.Items = items[:limit]
+        resp.NextCursor = encodeActivityCursor(items[limit-1])
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
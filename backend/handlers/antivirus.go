@@ -0,0 +1,312 @@
+// -------------------------------------------------------
+// backend/handlers/antivirus.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Malware scanning of uploads with ClamAV: raw uploads
+//     (PUT /file?raw=1), pasted images and /file/import bodies
+//     (including Word documents) are streamed to clamd before they
+//     are written.
+//   - Flagged uploads are quarantined instead of stored:
+//       GET    /admin/quarantine       list quarantined uploads
+//       DELETE /admin/quarantine?id=   destroy one
+// Audit:
+//   - Off unless antivirus.clamd is set (config.AntivirusConfig).
+//     clamd is asked with INSTREAM over its unix socket or TCP.
+//   - A flagged upload answers 422 malware_detected and writes
+//     "file.quarantine" with the signature and SHA-256. Its bytes
+//     are kept gzip-compressed and owner-readable only in
+//     .scratchpad/quarantine/ for investigation.
+//   - A scan that fails (clamd down, timeout, size limit) refuses
+//     the upload with 503 unless antivirus.fail_open; either way
+//     "file.scan_failed" is written.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    quarantineDir       = "quarantine"
+    quarantineFile      = "quarantine.json"
+    clamdChunkBytes     = 64 << 10
+    maxClamdReplyLength = 4 << 10
+)
+
+// quarantineMu guards quarantine.json and the quarantine directory.
+var quarantineMu sync.Mutex
+
+// -------------------------------------------------------
+// type QuarantineItem
+// -------------------------------------------------------
+// Purpose:
+//   - One quarantined upload: where it was headed, who sent it, and
+//     what clamd found.
+// -------------------------------------------------------
+type QuarantineItem struct {
+    ID        string `json:"id"`
+    Path      string `json:"path"`
+    Source    string `json:"source"`
+    Signature string `json:"signature"`
+    SHA256    string `json:"sha256"`
+    Bytes     int    `json:"bytes"`
+    At        string `json:"at"`
+    Actor     string `json:"actor"`
+}
+
+// -------------------------------------------------------
+// func clamdScan(ctx, address, timeout, data) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Scan data with clamd; returns the signature found, or "" when
+//     the data is clean.
+// Audit:
+//   - An absolute address is a unix socket, anything else host:port.
+//   - Any reply other than "OK" or "<signature> FOUND" is an error
+//     (e.g. clamd's StreamMaxLength exceeded).
+// -------------------------------------------------------
+func clamdScan(ctx context.Context, address string, timeout time.Duration, data []byte) (string, error) {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    network := "tcp"
+    if filepath.IsAbs(address) {
+        network = "unix"
+    }
+    var dialer net.Dialer
+    conn, err := dialer.DialContext(ctx, network, address)
+    if err != nil {
+        return "", err
+    }
+    defer conn.Close()
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+        return "", err
+    }
+    size := make([]byte, 4)
+    for start := 0; start < len(data); start += clamdChunkBytes {
+        chunk := data[start:min(start+clamdChunkBytes, len(data))]
+        binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+        if _, err := conn.Write(size); err != nil {
+            return "", err
+        }
+        if _, err := conn.Write(chunk); err != nil {
+            return "", err
+        }
+    }
+    if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+        return "", err
+    }
+    // The z prefix makes clamd end its reply with a NUL.
+    reply, err := bufio.NewReader(io.LimitReader(conn, maxClamdReplyLength)).ReadString(0)
+    if err != nil && (err != io.EOF || reply == "") {
+        return "", err
+    }
+
+    result := strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+    result = strings.TrimPrefix(result, "stream: ")
+    switch {
+    case result == "OK":
+        return "", nil
+    case strings.HasSuffix(result, " FOUND"):
+        return strings.TrimSuffix(result, " FOUND"), nil
+    default:
+        return "", fmt.Errorf("clamd: %s", defaultString(result, "empty reply"))
+    }
+}
+
+// -------------------------------------------------------
+// func quarantineUpload(ctx, rel, source, signature, data) (QuarantineItem, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Keep a flagged upload out of the tree: store its bytes in the
+//     quarantine directory and register it.
+// -------------------------------------------------------
+func quarantineUpload(ctx context.Context, rel string, source string, signature string, data []byte) (QuarantineItem, error) {
+    item := QuarantineItem{
+        ID:        newStampID(ctx),
+        Path:      rel,
+        Source:    source,
+        Signature: signature,
+        SHA256:    contentHash(data),
+        Bytes:     len(data),
+        At:        timeNow(ctx).UTC().Format(time.RFC3339),
+        Actor:     actorName(ctx),
+    }
+    var buf bytes.Buffer
+    gz := gzip.NewWriter(&buf)
+    gz.Write(data)
+    if err := gz.Close(); err != nil {
+        return item, err
+    }
+
+    quarantineMu.Lock()
+    defer quarantineMu.Unlock()
+    if err := writeMetaFilePerm(ctx, filepath.Join(quarantineDir, item.ID+".gz"), buf.Bytes(), 0600); err != nil {
+        return item, err
+    }
+    items := []QuarantineItem{}
+    if err := loadMetaJSON(ctx, quarantineFile, &items); err != nil {
+        return item, err
+    }
+    return item, saveMetaJSON(ctx, quarantineFile, append(items, item))
+}
+
+// -------------------------------------------------------
+// func rejectIfInfected(w, r, rel, source, data) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Scan an upload bound for rel before it is written; answers
+//     the request and returns true when it must not be stored.
+// Audit:
+//   - source names the route in the quarantine record ("raw_put",
+//     "paste_image", "import").
+//   - A quarantine that cannot be written still refuses the upload.
+// -------------------------------------------------------
+func rejectIfInfected(w http.ResponseWriter, r *http.Request, rel string, source string, data []byte) bool {
+    ctx := r.Context()
+    cfg := currentConfig(ctx).Antivirus
+    if cfg.Clamd == "" {
+        return false
+    }
+    event := audit.Event{
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Actor:    actorName(ctx),
+        Target:   rel,
+    }
+
+    signature, err := clamdScan(ctx, cfg.Clamd, cfg.Timeout.Std(), data)
+    if err != nil {
+        logError(ctx, "Malware scan of "+rel+" failed: "+err.Error())
+        event.Event, event.Status = "file.scan_failed", apierror.Status(apierror.CodeUnavailable)
+        event.Detail = fmt.Sprintf("source=%s bytes=%d fail_open=%t error=%q", source, len(data), cfg.FailOpen, err.Error())
+        if cfg.FailOpen {
+            event.Status = http.StatusOK
+            audit.WriteContext(ctx, event)
+            return false
+        }
+        audit.WriteContext(ctx, event)
+        apierror.Write(w, r, apierror.CodeUnavailable, "", "Malware scanner unavailable; upload refused")
+        return true
+    }
+    if signature == "" {
+        return false
+    }
+
+    item, err := quarantineUpload(ctx, rel, source, signature, data)
+    if err != nil {
+        logError(ctx, "Failed to quarantine "+rel+": "+err.Error())
+        item.ID = ""
+    }
+    logError(ctx, fmt.Sprintf("Malware %s in upload to %s (sha256 %s); quarantined as %q", signature, rel, item.SHA256, item.ID))
+    event.Event, event.Status = "file.quarantine", apierror.Status(apierror.CodeMalwareDetected)
+    event.Detail = fmt.Sprintf("source=%s signature=%q sha256=%s bytes=%d quarantine_id=%s", source, signature, item.SHA256, len(data), item.ID)
+    audit.WriteContext(ctx, event)
+    apierror.WriteDetails(w, r, apierror.CodeMalwareDetected, "", "Upload rejected: malware detected",
+        map[string]interface{}{"signature": signature, "quarantine_id": item.ID})
+    return true
+}
+
+// -------------------------------------------------------
+// func HandleQuarantine(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/quarantine: quarantined uploads, newest first.
+//   - DELETE /admin/quarantine?id=...: destroy one (204).
+// Audit:
+//   - Deletion writes "quarantine.delete". Quarantined bytes are
+//     never served back through the API.
+// -------------------------------------------------------
+func HandleQuarantine(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        quarantineMu.Lock()
+        items := []QuarantineItem{}
+        err := loadMetaJSON(r.Context(), quarantineFile, &items)
+        quarantineMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load quarantine", "Internal error")
+            return
+        }
+        sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(items)
+        return
+    case http.MethodDelete:
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    id := r.URL.Query().Get("id")
+    if !requireField(w, r, "id", id) {
+        return
+    }
+    quarantineMu.Lock()
+    items := []QuarantineItem{}
+    err := loadMetaJSON(r.Context(), quarantineFile, &items)
+    var removed *QuarantineItem
+    if err == nil {
+        for i := range items {
+            if items[i].ID == id {
+                item := items[i]
+                removed = &item
+                items = append(items[:i], items[i+1:]...)
+                break
+            }
+        }
+    }
+    if err == nil && removed != nil {
+        if err = serverFrom(r.Context()).Storage.Remove(metaPath(r.Context(), quarantineDir, removed.ID+".gz")); os.IsNotExist(err) {
+            err = nil
+        }
+        if err == nil {
+            err = saveMetaJSON(r.Context(), quarantineFile, items)
+        }
+    }
+    quarantineMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "delete quarantined upload "+id, "Internal error")
+        return
+    }
+    if removed == nil {
+        apierror.Write(w, r, apierror.CodeNotFound, "id", "Quarantined upload not found")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Deleted quarantined upload %s (%s, %s)", removed.ID, removed.Path, removed.Signature))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "quarantine.delete",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusNoContent,
+        Target:   removed.Path,
+        Detail:   fmt.Sprintf("id=%s signature=%q sha256=%s", removed.ID, removed.Signature, removed.SHA256),
+    })
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,653 @@
+// -------------------------------------------------------
+// backend/handlers/archive.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Cold storage for folders: POST /folders/archive compresses a
+//     folder into .scratchpad/archives/<id>.tar.gz and removes it
+//     from the working tree; POST /folders/unarchive restores it.
+//   - Archived folders are hidden from /folders unless
+//     ?include=archived, stay readable through /files and /file, and
+//     reject every write with 423 Locked.
+// Audit:
+//   - The archive is fully written and synced before the folder is
+//     removed; unarchive extracts to a staging directory and moves
+//     it into place with a single rename.
+//   - Registry: .scratchpad/archives.json (path -> record, including
+//     the detached index entries and the archive SHA-256).
+//   - Writes "folder.archive" and "folder.unarchive" audit events.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    archiveDirName      = "archives"
+    archiveRegistryFile = "archives.json"
+    // maxArchivedFileBytes bounds a single note read from an archive.
+    maxArchivedFileBytes = 64 << 20
+)
+
+// errArchivedEntryNotFound is returned when a path is not in an archive;
+// it wraps os.ErrNotExist so writeStorageError answers not_found.
+var errArchivedEntryNotFound = fmt.Errorf("not found in archive: %w", os.ErrNotExist)
+
+// -------------------------------------------------------
+// type ArchiveRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Registry entry for one archived folder.
+// -------------------------------------------------------
+type ArchiveRecord struct {
+    Path            string                `json:"path"`
+    ID              string                `json:"id"`
+    ArchivedAt      string                `json:"archived_at"`
+    Files           int                   `json:"files"`
+    Bytes           int64                 `json:"bytes"`
+    CompressedBytes int64                 `json:"compressed_bytes"`
+    SHA256          string                `json:"sha256"`
+    Index           map[string]IndexEntry `json:"index,omitempty"`
+}
+
+// FolderInfo is the /folders?include=archived element.
+type FolderInfo struct {
+    Path        string `json:"path"`
+    Archived    bool   `json:"archived"`
+    ArchivedAt  string `json:"archived_at,omitempty"`
+    Description string `json:"description,omitempty"`
+    Color       string `json:"color,omitempty"`
+    Icon        string `json:"icon,omitempty"`
+    Position    *int   `json:"position,omitempty"`
+}
+
+var (
+    archiveMu       sync.Mutex
+    archivesLoaded  bool
+    archiveRegistry = map[string]ArchiveRecord{}
+)
+
+// -------------------------------------------------------
+// func ensureArchivesLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Load archives.json on first use. Caller holds archiveMu.
+// -------------------------------------------------------
+func ensureArchivesLocked(ctx context.Context) {
+    if archivesLoaded {
+        return
+    }
+    archivesLoaded = true
+    loaded := map[string]ArchiveRecord{}
+    if err := loadMetaJSON(ctx, archiveRegistryFile, &loaded); err != nil {
+        logError(ctx, "Failed to load archive registry: "+err.Error())
+    }
+    archiveRegistry = loaded
+}
+
+// -------------------------------------------------------
+// func archivedFolderFor(ctx context.Context, rel string) (ArchiveRecord, string, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Find the archived folder containing rel (or equal to it) and
+//     return rel's path inside that archive ("." for the folder).
+// -------------------------------------------------------
+func archivedFolderFor(ctx context.Context, rel string) (ArchiveRecord, string, bool) {
+    archiveMu.Lock()
+    defer archiveMu.Unlock()
+    ensureArchivesLocked(ctx)
+
+    for folder, record := range archiveRegistry {
+        if rel == folder {
+            return record, ".", true
+        }
+        if strings.HasPrefix(rel, folder+"/") {
+            return record, strings.TrimPrefix(rel, folder+"/"), true
+        }
+    }
+    return ArchiveRecord{}, "", false
+}
+
+// -------------------------------------------------------
+// func archivedFolders() []ArchiveRecord
+// -------------------------------------------------------
+// Purpose:
+//   - All archived folders sorted by path (index omitted).
+// -------------------------------------------------------
+func archivedFolders(ctx context.Context) []ArchiveRecord {
+    archiveMu.Lock()
+    defer archiveMu.Unlock()
+    ensureArchivesLocked(ctx)
+
+    out := make([]ArchiveRecord, 0, len(archiveRegistry))
+    for _, record := range archiveRegistry {
+        record.Index = nil
+        out = append(out, record)
+    }
+    sort.Slice(out, func(a, b int) bool { return out[a].Path < out[b].Path })
+    return out
+}
+
+// -------------------------------------------------------
+// func rejectIfArchived(w, r, absPath) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Write 423 Locked and return true if absPath lies in an
+//     archived folder. Used by every write path.
+// -------------------------------------------------------
+func rejectIfArchived(w http.ResponseWriter, r *http.Request, absPath string) bool {
+    record, _, ok := archivedFolderFor(r.Context(), relativeTo(r.Context(), absPath))
+    if !ok {
+        return false
+    }
+    logError(r.Context(), "Rejected write to archived folder "+record.Path+": "+absPath)
+    apierror.Write(w, r, apierror.CodeLocked, "", "Folder is archived (read-only): "+record.Path)
+    return true
+}
+
+// -------------------------------------------------------
+// func archiveFilePath(ctx context.Context, id string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Absolute path of the compressed archive for id.
+// -------------------------------------------------------
+func archiveFilePath(ctx context.Context, id string) string {
+    return metaPath(ctx, archiveDirName, id+".tar.gz")
+}
+
+// -------------------------------------------------------
+// func writeFolderArchive(ctx, absPath, dest) (ArchiveRecord, error)
+// -------------------------------------------------------
+// Purpose:
+//   - tar.gz the folder at absPath into dest (via dest.partial).
+// Audit:
+//   - Symlinks and special files are refused, not skipped: an
+//     archive must hold everything the folder held.
+// -------------------------------------------------------
+func writeFolderArchive(ctx context.Context, absPath string, dest string) (ArchiveRecord, error) {
+    record := ArchiveRecord{}
+    store := serverFrom(ctx).Storage
+    partial := dest + ".partial"
+    out, err := store.Create(partial, 0600)
+    if err != nil {
+        return record, err
+    }
+    fail := func(err error) (ArchiveRecord, error) {
+        out.Close()
+        store.Remove(partial)
+        return record, err
+    }
+
+    hasher := sha256.New()
+    counter := &countingWriter{w: io.MultiWriter(out, hasher)}
+    gz := gzip.NewWriter(counter)
+    tw := tar.NewWriter(gz)
+
+    err = walkPath(ctx, absPath, func(p string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if p == absPath {
+            return nil
+        }
+        if !info.IsDir() && !info.Mode().IsRegular() {
+            return &UnsafePathError{Path: p, Reason: "not a regular file or directory"}
+        }
+        rel, relErr := filepath.Rel(absPath, p)
+        if relErr != nil {
+            return relErr
+        }
+        header, hdrErr := tar.FileInfoHeader(info, "")
+        if hdrErr != nil {
+            return hdrErr
+        }
+        header.Name = filepath.ToSlash(rel)
+        if info.IsDir() {
+            header.Name += "/"
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+        f, openErr := store.Open(p)
+        if openErr != nil {
+            return openErr
+        }
+        defer f.Close()
+        n, copyErr := io.Copy(tw, io.LimitReader(f, info.Size()))
+        if copyErr != nil {
+            return copyErr
+        }
+        record.Files++
+        record.Bytes += n
+        return nil
+    })
+    if err != nil {
+        return fail(err)
+    }
+    if err := tw.Close(); err != nil {
+        return fail(err)
+    }
+    if err := gz.Close(); err != nil {
+        return fail(err)
+    }
+    if err := out.Close(); err != nil {
+        store.Remove(partial)
+        return record, err
+    }
+    if syncer, ok := store.(Syncer); ok {
+        if err := syncer.Sync(partial); err != nil {
+            store.Remove(partial)
+            return record, err
+        }
+    }
+    if err := store.Rename(partial, dest); err != nil {
+        store.Remove(partial)
+        return record, err
+    }
+    record.CompressedBytes = counter.n
+    record.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+    return record, nil
+}
+
+// countingWriter counts bytes passed through to w.
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+    n, err := c.w.Write(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// -------------------------------------------------------
+// func walkArchive(ctx, record, fn) error
+// -------------------------------------------------------
+// Purpose:
+//   - Call fn for each entry of an archived folder; fn returning
+//     io.EOF stops early without error.
+// -------------------------------------------------------
+func walkArchive(ctx context.Context, record ArchiveRecord, fn func(header *tar.Header, body io.Reader) error) error {
+    f, err := serverFrom(ctx).Storage.Open(archiveFilePath(ctx, record.ID))
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    gz, err := gzip.NewReader(f)
+    if err != nil {
+        return err
+    }
+    defer gz.Close()
+
+    tr := tar.NewReader(gz)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if err := fn(header, tr); err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+    }
+}
+
+// -------------------------------------------------------
+// func readArchivedFile(ctx, record, inner) ([]byte, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Read one note from an archived folder.
+// -------------------------------------------------------
+func readArchivedFile(ctx context.Context, record ArchiveRecord, inner string) ([]byte, error) {
+    var data []byte
+    found := false
+    err := walkArchive(ctx, record, func(header *tar.Header, body io.Reader) error {
+        if header.Typeflag != tar.TypeReg || header.Name != inner {
+            return nil
+        }
+        var readErr error
+        data, readErr = ioutil.ReadAll(io.LimitReader(body, maxArchivedFileBytes))
+        found = true
+        if readErr != nil {
+            return readErr
+        }
+        return io.EOF
+    })
+    if err == nil && !found {
+        err = errArchivedEntryNotFound
+    }
+    return data, err
+}
+
+// -------------------------------------------------------
+// func listArchivedFiles(ctx, record, inner) ([]string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Note names directly inside folder inner of an archive.
+// -------------------------------------------------------
+func listArchivedFiles(ctx context.Context, record ArchiveRecord, inner string) ([]string, error) {
+    files := []string{}
+    err := walkArchive(ctx, record, func(header *tar.Header, body io.Reader) error {
+        if header.Typeflag == tar.TypeReg && path.Dir(header.Name) == inner && isNoteName(header.Name) {
+            files = append(files, path.Base(header.Name))
+        }
+        return nil
+    })
+    sort.Strings(files)
+    return files, err
+}
+
+// -------------------------------------------------------
+// func listArchivedSubfolders(ctx, record) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Relative paths of the archived folder and its subfolders.
+// -------------------------------------------------------
+func listArchivedSubfolders(ctx context.Context, record ArchiveRecord) ([]string, error) {
+    folders := []string{record.Path}
+    err := walkArchive(ctx, record, func(header *tar.Header, body io.Reader) error {
+        if header.Typeflag == tar.TypeDir {
+            folders = append(folders, record.Path+"/"+strings.TrimSuffix(header.Name, "/"))
+        }
+        return nil
+    })
+    return folders, err
+}
+
+// -------------------------------------------------------
+// func extractArchive(ctx, record, staging) error
+// -------------------------------------------------------
+// Purpose:
+//   - Unpack an archive into the staging directory.
+// Audit:
+//   - Entry names must stay inside staging; only regular files and
+//     directories are created.
+// -------------------------------------------------------
+func extractArchive(ctx context.Context, record ArchiveRecord, staging string) error {
+    store := serverFrom(ctx).Storage
+    if err := store.MkdirAll(staging); err != nil {
+        return err
+    }
+    return walkArchive(ctx, record, func(header *tar.Header, body io.Reader) error {
+        name := path.Clean(header.Name)
+        if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+            return fmt.Errorf("archive %s: unsafe entry %q", record.ID, header.Name)
+        }
+        target := filepath.Join(staging, filepath.FromSlash(name))
+        switch header.Typeflag {
+        case tar.TypeDir:
+            return store.MkdirAll(target)
+        case tar.TypeReg:
+            if err := store.MkdirAll(filepath.Dir(target)); err != nil {
+                return err
+            }
+            out, err := store.Create(target, 0644)
+            if err != nil {
+                return err
+            }
+            if _, err := io.Copy(out, body); err != nil {
+                out.Close()
+                return err
+            }
+            return out.Close()
+        default:
+            return fmt.Errorf("archive %s: unsupported entry type for %q", record.ID, header.Name)
+        }
+    })
+}
+
+// -------------------------------------------------------
+// func decodeFolderPath(w, r) (string, string, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Parse {"path": "..."} and return (relative, absolute) paths.
+// -------------------------------------------------------
+func decodeFolderPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+    var req struct {
+        Path string `json:"path"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return "", "", false
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        logError(r.Context(), "Rejected folder path: "+req.Path)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return "", "", false
+    }
+    return relativeTo(r.Context(), absPath), absPath, true
+}
+
+// -------------------------------------------------------
+// func archiveFolder(ctx, rel, absPath) (ArchiveRecord, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Archive the folder at absPath, register it, detach its index
+//     entries, and remove it from the working tree.
+// Audit:
+//   - Nothing changes unless the archive and registry are both
+//     written; the caller writes the audit event.
+// -------------------------------------------------------
+func archiveFolder(ctx context.Context, rel string, absPath string) (ArchiveRecord, error) {
+    store := serverFrom(ctx).Storage
+    if err := store.MkdirAll(metaPath(ctx, archiveDirName)); err != nil {
+        return ArchiveRecord{}, err
+    }
+    id := newStampID(ctx)
+    record, err := writeFolderArchive(ctx, absPath, archiveFilePath(ctx, id))
+    if err != nil {
+        return record, err
+    }
+    record.Path = rel
+    record.ID = id
+    record.ArchivedAt = utcNow(ctx)
+
+    record.Index = indexDetach(ctx, rel)
+    archiveMu.Lock()
+    ensureArchivesLocked(ctx)
+    archiveRegistry[rel] = record
+    saveErr := saveMetaJSON(ctx, archiveRegistryFile, archiveRegistry)
+    if saveErr != nil {
+        delete(archiveRegistry, rel)
+    }
+    archiveMu.Unlock()
+    if saveErr != nil {
+        indexAttach(ctx, rel, record.Index)
+        store.Remove(archiveFilePath(ctx, id))
+        return record, saveErr
+    }
+
+    if err := store.RemoveAll(absPath); err != nil {
+        logError(ctx, "Archived folder could not be removed from working tree: "+err.Error())
+    }
+    touchFolders(rel)
+    return record, nil
+}
+
+// -------------------------------------------------------
+// func HandleFolderArchive(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /folders/archive {"path": "..."}: compress and retire a
+//     folder.
+// Audit:
+//   - 404 if missing, 423 if already inside an archived folder.
+//   - Writes "folder.archive" with sizes and archive SHA-256.
+// -------------------------------------------------------
+func HandleFolderArchive(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    rel, absPath, ok := decodeFolderPath(w, r)
+    if !ok || rejectIfArchived(w, r, absPath) {
+        return
+    }
+
+    ctx := r.Context()
+    info, err := statPath(ctx, absPath)
+    if os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Folder not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "stat folder: "+absPath, "Archive failed")
+        return
+    }
+    if !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Not a folder")
+        return
+    }
+
+    record, err := archiveFolder(ctx, rel, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "archive folder: "+absPath, "Archive failed")
+        return
+    }
+
+    logInfo(ctx, fmt.Sprintf("Archived folder %s (%d files, %d -> %d bytes)", rel, record.Files, record.Bytes, record.CompressedBytes))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "folder.archive",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   rel,
+        Detail:   fmt.Sprintf("id=%s files=%d bytes=%d compressed=%d sha256=%s", record.ID, record.Files, record.Bytes, record.CompressedBytes, record.SHA256),
+    })
+
+    record.Index = nil
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(record)
+}
+
+// -------------------------------------------------------
+// func HandleFolderUnarchive(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /folders/unarchive {"path": "..."}: restore an archived
+//     folder to the working tree.
+// Audit:
+//   - 409 if something now occupies the path.
+//   - The archive SHA-256 is verified before extraction.
+//   - Writes "folder.unarchive".
+// -------------------------------------------------------
+func HandleFolderUnarchive(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    rel, absPath, ok := decodeFolderPath(w, r)
+    if !ok {
+        return
+    }
+
+    archiveMu.Lock()
+    ensureArchivesLocked(r.Context())
+    record, found := archiveRegistry[rel]
+    archiveMu.Unlock()
+    if !found {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Folder is not archived")
+        return
+    }
+
+    ctx := r.Context()
+    if _, err := statPath(ctx, absPath); err == nil {
+        apierror.Write(w, r, apierror.CodeConflict, "", "Destination already exists: "+rel)
+        return
+    }
+    if sum, err := fileSHA256(ctx, archiveFilePath(ctx, record.ID)); err != nil || sum != record.SHA256 {
+        logError(ctx, "Archive integrity check failed for "+rel)
+        apierror.Write(w, r, apierror.CodeInternal, "", "Archive integrity check failed")
+        return
+    }
+
+    store := serverFrom(ctx).Storage
+    staging := metaPath(ctx, archiveDirName, record.ID+".extract")
+    store.RemoveAll(staging)
+    if err := extractArchive(ctx, record, staging); err != nil {
+        store.RemoveAll(staging)
+        writeStorageError(w, r, err, "extract archive "+record.ID, "Unarchive failed")
+        return
+    }
+    if err := mkdirAll(ctx, filepath.Dir(absPath)); err != nil {
+        store.RemoveAll(staging)
+        writeStorageError(w, r, err, "create parent: "+absPath, "Unarchive failed")
+        return
+    }
+    if err := renamePathAny(ctx, staging, absPath); err != nil {
+        store.RemoveAll(staging)
+        writeStorageError(w, r, err, "move unarchived folder into place", "Unarchive failed")
+        return
+    }
+
+    archiveMu.Lock()
+    delete(archiveRegistry, rel)
+    if err := saveMetaJSON(ctx, archiveRegistryFile, archiveRegistry); err != nil {
+        logError(ctx, "Failed to save archive registry: "+err.Error())
+    }
+    archiveMu.Unlock()
+    store.Remove(archiveFilePath(ctx, record.ID))
+    indexAttach(ctx, rel, record.Index)
+    touchFolders(rel)
+
+    logInfo(ctx, "Unarchived folder "+rel)
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "folder.unarchive",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   rel,
+        Detail:   fmt.Sprintf("id=%s files=%d", record.ID, record.Files),
+    })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"path": rel, "files": record.Files})
+}
+
+// -------------------------------------------------------
+// func fileSHA256(ctx, path string) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Streamed hex SHA-256 of a file under the scratch root.
+// -------------------------------------------------------
+func fileSHA256(ctx context.Context, path string) (string, error) {
+    f, err := serverFrom(ctx).Storage.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    hasher := sha256.New()
+    if _, err := io.Copy(hasher, f); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(hasher.Sum(nil)), nil
+}
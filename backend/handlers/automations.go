@@ -0,0 +1,860 @@
+// -------------------------------------------------------
+// backend/handlers/automations.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Automations: webhooks fired when notes change, narrowed to a
+//     folder and to chosen events (e.g. only approvals under
+//     Board-Notes):
+//       GET    /automations                all automations
+//       POST   /automations {automation}   create or replace by name
+//       DELETE /automations?name=...       remove one
+//       POST   /automations/test {"name"}  fire one now, synchronously
+//   - Events are the change journal operations of local changes
+//     (note.save, note.move, note.delete, note.tags, folder.create),
+//     approval workflow transitions (workflow.submit, .reject,
+//     .approve, .reopen) and backups (backup.succeeded, .failed).
+//   - format "slack" or "teams" posts a chat message to an incoming
+//     webhook instead of the JSON event; the text comes from the
+//     automation's template for the event, else a built-in one.
+// Audit:
+//   - Stored in .scratchpad/automations.json. Changes and test fires
+//     need a user holding one of automations.roles (default
+//     approver); others get 403 and an "automation.denied" event.
+//     Changes write "automation.save" / "automation.delete"; test
+//     fires write "automation.test".
+//   - Deliveries never follow redirects and refuse loopback,
+//     private, link-local and other non-public addresses when they
+//     connect, unless automations.allowed_networks lists them.
+//   - Changes pulled from another instance do not fire, so a synced
+//     pair never delivers the same change twice.
+//   - Deliveries are queued and posted one at a time; failures are
+//     logged, never retried, and never fail the user's request. The
+//     last delivery of each automation is shown by GET.
+//   - With a secret, X-Scratchpad-Signature carries the HMAC-SHA256
+//     of the body. Secrets are never returned.
+//   - Backup events carry no note path, so only automations without
+//     a folder receive them.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/netip"
+    "net/url"
+    "sort"
+    "strings"
+    "sync"
+    "syscall"
+    "text/template"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+)
+
+const (
+    automationsFile       = "automations.json"
+    maxAutomations        = 100
+    maxAutomationURL      = 2048
+    automationQueueSize   = 256
+    automationTimeout     = 5 * time.Second
+    automationTestTimeout = 10 * time.Second
+    maxAutomationTemplate = 2000
+)
+
+// Automation formats: the event as JSON, or a chat message.
+const (
+    automationJSON  = "json"
+    automationSlack = "slack"
+    automationTeams = "teams"
+)
+
+// nonPublicNetworks are ranges that IsPrivate and friends do not
+// cover but that never hold a public webhook endpoint: shared
+// address space (carrier-grade NAT) and benchmarking.
+var nonPublicNetworks = []netip.Prefix{
+    netip.MustParsePrefix("100.64.0.0/10"),
+    netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// automationEvents are the events an automation can listen for.
+var automationEvents = []string{
+    "note.save", "note.move", "note.delete", "note.tags", "folder.create",
+    "workflow.submit", "workflow.reject", "workflow.approve", "workflow.reopen",
+    "backup.succeeded", "backup.failed",
+}
+
+// automationMessages are the built-in chat message templates.
+var automationMessages = map[string]string{
+    "note.save":        "{{.Actor}} saved {{.Path}}",
+    "note.move":        "{{.Actor}} moved {{.From}} to {{.Path}}",
+    "note.delete":      "{{.Actor}} deleted {{.Path}}",
+    "note.tags":        "{{.Actor}} changed the tags of {{.Path}}",
+    "folder.create":    "{{.Actor}} created folder {{.Path}}",
+    "workflow.submit":  "{{.Actor}} submitted {{.Path}} for review",
+    "workflow.reject":  "{{.Actor}} rejected {{.Path}}: {{.Workflow.Comment}}",
+    "workflow.approve": "{{.Actor}} approved {{.Path}}",
+    "workflow.reopen":  "{{.Actor}} reopened {{.Path}}: {{.Workflow.Comment}}",
+    "backup.succeeded": "Backup written: {{.Backup.Path}} ({{.Backup.Files}} files)",
+    "backup.failed":    "Backup failed: {{.Backup.Error}}",
+}
+
+// journalAutomationEvents maps journal operations to their events.
+var journalAutomationEvents = map[string]string{
+    journalPut:    "note.save",
+    journalMove:   "note.move",
+    journalDelete: "note.delete",
+    journalTags:   "note.tags",
+    journalMkdir:  "folder.create",
+}
+
+var (
+    // automationsMu guards automations.json.
+    automationsMu sync.Mutex
+    // lastDeliveries holds each automation's last delivery.
+    lastDeliveriesMu sync.Mutex
+    lastDeliveries   = map[string]AutomationDelivery{}
+    automationQueue  = make(chan automationJob, automationQueueSize)
+)
+
+// -------------------------------------------------------
+// type Automation
+// -------------------------------------------------------
+// Purpose:
+//   - One webhook rule.
+// Audit:
+//   - Folder is a relative folder path ("" = the whole scratch
+//     root); a move matches when either end lies in it.
+//   - Events empty means every event.
+//   - Secret is write-only: saving without one keeps the stored
+//     secret; responses only say whether one is set.
+//   - Format is json (default), slack or teams; Templates maps
+//     events to Go text/template message text for the chat formats.
+// -------------------------------------------------------
+type Automation struct {
+    Name         string              `json:"name"`
+    Folder       string              `json:"folder,omitempty"`
+    Events       []string            `json:"events,omitempty"`
+    URL          string              `json:"url"`
+    Format       string              `json:"format"`
+    Templates    map[string]string   `json:"templates,omitempty"`
+    Secret       string              `json:"secret,omitempty"`
+    SecretSet    bool                `json:"secret_set"`
+    Disabled     bool                `json:"disabled,omitempty"`
+    UpdatedBy    string              `json:"updated_by,omitempty"`
+    UpdatedAt    string              `json:"updated_at"`
+    LastDelivery *AutomationDelivery `json:"last_delivery,omitempty"`
+}
+
+// -------------------------------------------------------
+// type AutomationEvent
+// -------------------------------------------------------
+// Purpose:
+//   - The JSON body posted to an automation's URL.
+// Audit:
+//   - Carries paths and hashes, never note content.
+//   - Clock is the journal clock of note and folder events;
+//     Workflow is set for workflow events and Backup for backups.
+// -------------------------------------------------------
+type AutomationEvent struct {
+    Automation string              `json:"automation"`
+    Event      string              `json:"event"`
+    Path       string              `json:"path"`
+    From       string              `json:"from,omitempty"`
+    Actor      string              `json:"actor,omitempty"`
+    SHA256     string              `json:"sha256,omitempty"`
+    Clock      int64               `json:"clock,omitempty"`
+    Workflow   *AutomationWorkflow `json:"workflow,omitempty"`
+    Backup     *AutomationBackup   `json:"backup,omitempty"`
+    Instance   string              `json:"instance"`
+    At         string              `json:"at"`
+    Test       bool                `json:"test,omitempty"`
+}
+
+// AutomationWorkflow describes the transition of a workflow event.
+type AutomationWorkflow struct {
+    From    string `json:"from"`
+    To      string `json:"to"`
+    Comment string `json:"comment,omitempty"`
+}
+
+// AutomationBackup describes the archive of a backup event; Error is
+// set when the backup failed.
+type AutomationBackup struct {
+    Path   string `json:"path,omitempty"`
+    Files  int    `json:"files,omitempty"`
+    Bytes  int64  `json:"bytes,omitempty"`
+    SHA256 string `json:"sha256,omitempty"`
+    Error  string `json:"error,omitempty"`
+}
+
+// AutomationDelivery is the outcome of one webhook post.
+type AutomationDelivery struct {
+    Event      string `json:"event"`
+    Path       string `json:"path"`
+    At         string `json:"at"`
+    Status     int    `json:"status,omitempty"`
+    Error      string `json:"error,omitempty"`
+    DurationMs int64  `json:"duration_ms"`
+}
+
+// automationJob is one queued delivery.
+type automationJob struct {
+    automation Automation
+    event      AutomationEvent
+}
+
+// loadAutomationsLocked returns the automations sorted by name.
+// Caller holds automationsMu.
+func loadAutomationsLocked(ctx context.Context) ([]Automation, error) {
+    automations := []Automation{}
+    if err := loadMetaJSON(ctx, automationsFile, &automations); err != nil {
+        return nil, err
+    }
+    if automations == nil {
+        automations = []Automation{}
+    }
+    sort.Slice(automations, func(i, j int) bool { return automations[i].Name < automations[j].Name })
+    return automations, nil
+}
+
+// -------------------------------------------------------
+// func validateAutomation(ctx context.Context, a *Automation) error
+// -------------------------------------------------------
+// Purpose:
+//   - Reject automations that could not fire; normalize Folder and
+//     Events.
+// Audit:
+//   - Errors are *fieldError. Only http and https URLs are allowed;
+//     a literal address must pass checkAutomationAddress (names are
+//     checked when a delivery connects).
+// -------------------------------------------------------
+func validateAutomation(ctx context.Context, a *Automation) error {
+    if !smartNamePattern.MatchString(a.Name) {
+        return invalidField("name", "must be 1-64 letters, digits, spaces, '.', '_' or '-'")
+    }
+    target, err := url.Parse(a.URL)
+    if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" || len(a.URL) > maxAutomationURL {
+        return invalidField("url", "must be an http or https URL of at most %d bytes", maxAutomationURL)
+    }
+    if addr, err := netip.ParseAddr(strings.Trim(target.Hostname(), "[]")); err == nil {
+        if err := checkAutomationAddress(addr, automationAllowedNetworks(ctx)); err != nil {
+            return invalidField("url", "%v", err)
+        }
+    }
+    if a.Folder != "" {
+        abs := sanitizePath(ctx, a.Folder)
+        if abs == "" {
+            return invalidField("folder", "is not a valid folder path")
+        }
+        a.Folder = relativeTo(ctx, abs)
+        if abs == scratchRoot(ctx) {
+            a.Folder = ""
+        }
+    }
+    seen := map[string]bool{}
+    events := []string{}
+    for _, event := range a.Events {
+        if !oneOf(event, automationEvents) {
+            return invalidField("events", "%q is not one of %s", event, strings.Join(automationEvents, ", "))
+        }
+        if !seen[event] {
+            seen[event] = true
+            events = append(events, event)
+        }
+    }
+    a.Events = events
+    a.Format = defaultString(a.Format, automationJSON)
+    if !oneOf(a.Format, []string{automationJSON, automationSlack, automationTeams}) {
+        return invalidField("format", "must be json, slack or teams")
+    }
+    for event, text := range a.Templates {
+        if !oneOf(event, automationEvents) {
+            return invalidField("templates", "%q is not one of %s", event, strings.Join(automationEvents, ", "))
+        }
+        if len(text) > maxAutomationTemplate {
+            return invalidField("templates."+event, "exceeds %d bytes", maxAutomationTemplate)
+        }
+        if _, err := template.New(event).Parse(text); err != nil {
+            return invalidField("templates."+event, "%v", err)
+        }
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func automationMessage(ctx context.Context, a Automation, event AutomationEvent) string
+// -------------------------------------------------------
+// Purpose:
+//   - The chat text for event: the automation's template, else the
+//     built-in one.
+// Audit:
+//   - A template that fails on this event (e.g. .Workflow on a save)
+//     falls back to the built-in text, and that failing to the
+//     event name and path; the failure is logged.
+// -------------------------------------------------------
+func automationMessage(ctx context.Context, a Automation, event AutomationEvent) string {
+    for _, text := range []string{a.Templates[event.Event], automationMessages[event.Event]} {
+        if text == "" {
+            continue
+        }
+        var out strings.Builder
+        tmpl, err := template.New(event.Event).Option("missingkey=zero").Parse(text)
+        if err == nil {
+            err = tmpl.Execute(&out, event)
+        }
+        if err == nil {
+            return strings.TrimSpace(out.String())
+        }
+        logError(ctx, fmt.Sprintf("Automation %s template for %s failed: %v", a.Name, event.Event, err))
+    }
+    return strings.TrimSpace(event.Event + " " + event.Path)
+}
+
+// -------------------------------------------------------
+// func automationBody(ctx context.Context, a Automation, event AutomationEvent) []byte
+// -------------------------------------------------------
+// Purpose:
+//   - The request body for the automation's format: the event
+//     itself, a Slack message, or a Teams Adaptive Card message.
+// Audit:
+//   - Slack text escapes &, < and > as its message format requires.
+//     Test deliveries are prefixed "[test]".
+// -------------------------------------------------------
+func automationBody(ctx context.Context, a Automation, event AutomationEvent) []byte {
+    var payload interface{} = event
+    if a.Format == automationSlack || a.Format == automationTeams {
+        text := automationMessage(ctx, a, event)
+        if event.Test {
+            text = "[test] " + text
+        }
+        if a.Format == automationSlack {
+            payload = map[string]string{"text": strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)}
+        } else {
+            payload = map[string]interface{}{
+                "type": "message",
+                "attachments": []interface{}{map[string]interface{}{
+                    "contentType": "application/vnd.microsoft.card.adaptive",
+                    "content": map[string]interface{}{
+                        "$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+                        "type":    "AdaptiveCard",
+                        "version": "1.4",
+                        "body":    []interface{}{map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true}},
+                    },
+                }},
+            }
+        }
+    }
+    body, _ := json.Marshal(payload)
+    return body
+}
+
+// matches reports whether the automation fires for event.
+func (a Automation) matches(event AutomationEvent) bool {
+    if a.Disabled || len(a.Events) > 0 && !oneOf(event.Event, a.Events) {
+        return false
+    }
+    return a.Folder == "" || pathWithin(event.Path, a.Folder) || event.From != "" && pathWithin(event.From, a.Folder)
+}
+
+// pathWithin reports whether rel is folder or lies under it.
+func pathWithin(rel string, folder string) bool {
+    return rel == folder || strings.HasPrefix(rel, folder+"/")
+}
+
+// publicAutomation returns a as answered: no secret, last delivery set.
+func publicAutomation(a Automation) Automation {
+    a.SecretSet = a.Secret != ""
+    a.Secret = ""
+    a.Format = defaultString(a.Format, automationJSON)
+    lastDeliveriesMu.Lock()
+    if delivery, ok := lastDeliveries[a.Name]; ok {
+        a.LastDelivery = &delivery
+    }
+    lastDeliveriesMu.Unlock()
+    return a
+}
+
+// -------------------------------------------------------
+// func fireAutomations(ctx context.Context, event AutomationEvent)
+// -------------------------------------------------------
+// Purpose:
+//   - Queue a delivery for every enabled automation matching event.
+// Audit:
+//   - Never blocks the caller: when the queue is full the delivery
+//     is dropped and logged.
+// -------------------------------------------------------
+func fireAutomations(ctx context.Context, event AutomationEvent) {
+    automationsMu.Lock()
+    automations, err := loadAutomationsLocked(ctx)
+    automationsMu.Unlock()
+    if err != nil {
+        logError(ctx, "Failed to load automations: "+err.Error())
+        return
+    }
+    for _, a := range automations {
+        if !a.matches(event) {
+            continue
+        }
+        select {
+        case automationQueue <- automationJob{automation: a, event: event}:
+        default:
+            logError(ctx, fmt.Sprintf("Automation queue full; dropped %s for %s on %s", a.Name, event.Event, event.Path))
+        }
+    }
+}
+
+// automationAllowedNetworks parses automations.allowed_networks
+// (validated when the config loads).
+func automationAllowedNetworks(ctx context.Context) []netip.Prefix {
+    allowed := []netip.Prefix{}
+    for _, entry := range currentConfig(ctx).Automations.AllowedNetworks {
+        if prefix, err := config.ParseAddressRange(entry); err == nil {
+            allowed = append(allowed, prefix)
+        }
+    }
+    return allowed
+}
+
+// -------------------------------------------------------
+// func checkAutomationAddress(addr, allowed) error
+// -------------------------------------------------------
+// Purpose:
+//   - Refuse addresses a webhook must not reach: loopback, private,
+//     link-local, multicast, unspecified and the ranges in
+//     nonPublicNetworks.
+// Audit:
+//   - An address inside one of the allowed networks always passes.
+// -------------------------------------------------------
+func checkAutomationAddress(addr netip.Addr, allowed []netip.Prefix) error {
+    addr = addr.Unmap()
+    for _, prefix := range allowed {
+        if prefix.Contains(addr) {
+            return nil
+        }
+    }
+    public := addr.IsGlobalUnicast() && !addr.IsPrivate()
+    for _, prefix := range nonPublicNetworks {
+        public = public && !prefix.Contains(addr)
+    }
+    if !public {
+        return fmt.Errorf("address %s is not public (see automations.allowed_networks)", addr)
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func automationClient(ctx context.Context) *http.Client
+// -------------------------------------------------------
+// Purpose:
+//   - The client deliveries are posted with.
+// Audit:
+//   - Every connection's address is checked at dial time, after name
+//     resolution, so a name cannot resolve (or re-resolve) to an
+//     internal host. No proxy is used, so the check sees the target.
+//   - Redirects are not followed: the redirect response is the
+//     delivery's outcome.
+// -------------------------------------------------------
+func automationClient(ctx context.Context) *http.Client {
+    allowed := automationAllowedNetworks(ctx)
+    dialer := &net.Dialer{
+        Timeout: automationTimeout,
+        Control: func(network, address string, _ syscall.RawConn) error {
+            addrPort, err := netip.ParseAddrPort(address)
+            if err != nil {
+                return err
+            }
+            return checkAutomationAddress(addrPort.Addr(), allowed)
+        },
+    }
+    return &http.Client{
+        Transport: &http.Transport{
+            DialContext:         dialer.DialContext,
+            TLSHandshakeTimeout: automationTimeout,
+            DisableKeepAlives:   true,
+        },
+        Timeout: automationTestTimeout,
+        CheckRedirect: func(*http.Request, []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+}
+
+// -------------------------------------------------------
+// func requireAutomationRole(w, r) (auth.User, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The caller, if they hold one of automations.roles; otherwise
+//     401 or 403.
+// Audit:
+//   - A refusal writes "automation.denied".
+// -------------------------------------------------------
+func requireAutomationRole(w http.ResponseWriter, r *http.Request) (auth.User, bool) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return user, false
+    }
+    roles := currentConfig(r.Context()).Automations.Roles
+    for _, role := range roles {
+        if user.HasRole(role) {
+            return user, true
+        }
+    }
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "automation.denied",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusForbidden,
+        Actor:    user.Name,
+        Detail:   "requires role " + strings.Join(roles, " or "),
+    })
+    apierror.Write(w, r, apierror.CodeForbidden, "", "Forbidden: automations require role "+strings.Join(roles, " or "))
+    return user, false
+}
+
+// -------------------------------------------------------
+// func deliverAutomation(ctx, a, event) AutomationDelivery
+// -------------------------------------------------------
+// Purpose:
+//   - POST event to the automation's URL and record the outcome as
+//     its last delivery.
+// Audit:
+//   - Any status outside 2xx counts as a failure, redirects
+//     included.
+//   - Posted with automationClient.
+// -------------------------------------------------------
+func deliverAutomation(ctx context.Context, a Automation, event AutomationEvent) AutomationDelivery {
+    event.Automation = a.Name
+    event.Instance = InstanceID(ctx)
+    if event.At == "" {
+        event.At = utcNow(ctx)
+    }
+    delivery := AutomationDelivery{Event: event.Event, Path: event.Path, At: utcNow(ctx)}
+    started := timeNow(ctx)
+    body := automationBody(ctx, a, event)
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+    if err == nil {
+        req.Header.Set("Content-Type", "application/json")
+        req.Header.Set("User-Agent", "cfo-scratchpad-automation")
+        req.Header.Set("X-Scratchpad-Event", event.Event)
+        req.Header.Set("X-Scratchpad-Delivery", newStampID(ctx))
+        if a.Secret != "" {
+            mac := hmac.New(sha256.New, []byte(a.Secret))
+            mac.Write(body)
+            req.Header.Set("X-Scratchpad-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+        }
+        var resp *http.Response
+        resp, err = automationClient(ctx).Do(req)
+        if err == nil {
+            resp.Body.Close()
+            delivery.Status = resp.StatusCode
+            if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+                err = fmt.Errorf("HTTP %d", resp.StatusCode)
+            }
+        }
+    }
+    delivery.DurationMs = timeNow(ctx).Sub(started).Milliseconds()
+    if err != nil {
+        delivery.Error = err.Error()
+        logError(ctx, fmt.Sprintf("Automation %s failed for %s on %s: %v", a.Name, event.Event, event.Path, err))
+    }
+    lastDeliveriesMu.Lock()
+    lastDeliveries[a.Name] = delivery
+    lastDeliveriesMu.Unlock()
+    return delivery
+}
+
+// -------------------------------------------------------
+// func notifyBackup(ctx context.Context, result BackupResult, err error)
+// -------------------------------------------------------
+// Purpose:
+//   - Fire backup.succeeded or backup.failed for a finished backup.
+// Audit:
+//   - A canceled backup fires nothing.
+// -------------------------------------------------------
+func notifyBackup(ctx context.Context, result BackupResult, err error) {
+    if errors.Is(err, context.Canceled) {
+        return
+    }
+    event := AutomationEvent{
+        Event:  "backup.succeeded",
+        Backup: &AutomationBackup{Path: result.Path, Files: result.Files, Bytes: result.Bytes, SHA256: result.SHA256},
+    }
+    if err != nil {
+        event.Event, event.Backup = "backup.failed", &AutomationBackup{Error: err.Error()}
+    }
+    fireAutomations(ctx, event)
+}
+
+// -------------------------------------------------------
+// func RunAutomations()
+// -------------------------------------------------------
+// Purpose:
+//   - Fire automations for local changes as they are journaled, and
+//     post queued deliveries. Runs for the life of the process.
+// Audit:
+//   - Starts at the current journal clock: changes made while the
+//     server was down do not fire.
+// -------------------------------------------------------
+func RunAutomations(ctx context.Context) {
+    go func() {
+        for job := range automationQueue {
+            jobCtx, cancel := context.WithTimeout(ctx, automationTimeout)
+            deliverAutomation(jobCtx, job.automation, job.event)
+            cancel()
+        }
+    }()
+
+    cursor := currentJournalClock(ctx)
+    for {
+        changed := journalWait()
+        entries, err := journalSince(ctx, cursor, eventsPageSize)
+        if err != nil {
+            logError(ctx, "Automations failed to read the change journal: "+err.Error())
+        }
+        for _, entry := range entries {
+            cursor = entry.Clock
+            if entry.Origin != InstanceID(ctx) {
+                continue
+            }
+            fireAutomations(ctx, AutomationEvent{
+                Event:  journalAutomationEvents[entry.Op],
+                Path:   entry.Path,
+                From:   entry.From,
+                Actor:  entry.Actor,
+                SHA256: entry.SHA256,
+                Clock:  entry.Clock,
+                At:     entry.At,
+            })
+        }
+        if len(entries) == eventsPageSize {
+            continue
+        }
+        if err != nil {
+            time.Sleep(time.Minute)
+            continue
+        }
+        <-changed
+    }
+}
+
+// -------------------------------------------------------
+// func HandleAutomations(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /automations: list, save, or delete automations.
+// -------------------------------------------------------
+func HandleAutomations(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        automationsMu.Lock()
+        automations, err := loadAutomationsLocked(r.Context())
+        automationsMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load automations", "Internal error")
+            return
+        }
+        for i := range automations {
+            automations[i] = publicAutomation(automations[i])
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(automations)
+
+    case http.MethodPost:
+        user, ok := requireAutomationRole(w, r)
+        if !ok {
+            return
+        }
+        var a Automation
+        if !decodeJSON(w, r, &a) || !requireField(w, r, "name", a.Name) || !requireField(w, r, "url", a.URL) {
+            return
+        }
+        if err := validateAutomation(r.Context(), &a); err != nil {
+            writeFieldError(w, r, err)
+            return
+        }
+        a.UpdatedBy, a.UpdatedAt, a.SecretSet, a.LastDelivery = user.Name, utcNow(r.Context()), false, nil
+
+        automationsMu.Lock()
+        defer automationsMu.Unlock()
+        automations, err := loadAutomationsLocked(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "load automations", "Internal error")
+            return
+        }
+        replaced := false
+        for i := range automations {
+            if automations[i].Name == a.Name {
+                if a.Secret == "" {
+                    a.Secret = automations[i].Secret
+                }
+                automations[i] = a
+                replaced = true
+            }
+        }
+        if !replaced {
+            if len(automations) >= maxAutomations {
+                writeFieldError(w, r, invalidField("name", "would exceed %d automations", maxAutomations))
+                return
+            }
+            automations = append(automations, a)
+        }
+        if err := saveMetaJSON(r.Context(), automationsFile, automations); err != nil {
+            writeStorageError(w, r, err, "save automations", "Save failed")
+            return
+        }
+        logInfo(r.Context(), "Saved automation "+a.Name+" by "+user.Name)
+        auditRule(r, "automation.save", user.Name, a.Name,
+            fmt.Sprintf("folder=%s events=%s format=%s host=%s disabled=%t", a.Folder, strings.Join(a.Events, ","), a.Format, hostOf(a.URL), a.Disabled))
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(publicAutomation(a))
+
+    case http.MethodDelete:
+        user, ok := requireAutomationRole(w, r)
+        if !ok {
+            return
+        }
+        name := r.URL.Query().Get("name")
+        if !requireField(w, r, "name", name) {
+            return
+        }
+        automationsMu.Lock()
+        defer automationsMu.Unlock()
+        automations, err := loadAutomationsLocked(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "load automations", "Internal error")
+            return
+        }
+        kept := []Automation{}
+        for _, a := range automations {
+            if a.Name != name {
+                kept = append(kept, a)
+            }
+        }
+        if len(kept) == len(automations) {
+            apierror.Write(w, r, apierror.CodeNotFound, "name", "Automation not found")
+            return
+        }
+        if err := saveMetaJSON(r.Context(), automationsFile, kept); err != nil {
+            writeStorageError(w, r, err, "save automations", "Delete failed")
+            return
+        }
+        lastDeliveriesMu.Lock()
+        delete(lastDeliveries, name)
+        lastDeliveriesMu.Unlock()
+        logInfo(r.Context(), "Deleted automation "+name+" by "+user.Name)
+        auditRule(r, "automation.delete", user.Name, name, "")
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// hostOf is the host of a URL, for audit details without its path
+// or query (which may hold a token).
+func hostOf(raw string) string {
+    if u, err := url.Parse(raw); err == nil {
+        return u.Host
+    }
+    return ""
+}
+
+// -------------------------------------------------------
+// func HandleAutomationTest(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /automations/test {"name", "event", "path"}: post a
+//     sample event (marked "test": true) to the automation now and
+//     answer the delivery {"event", "path", "at", "status", "error",
+//     "duration_ms"}.
+// Audit:
+//   - Fires even when the automation is disabled or would not match,
+//     in the automation's format.
+//     event defaults to the automation's first event (note.save),
+//     path to a note in its folder.
+//   - A failed delivery still answers 200; see "error".
+// -------------------------------------------------------
+func HandleAutomationTest(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireAutomationRole(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Name  string `json:"name"`
+        Event string `json:"event"`
+        Path  string `json:"path"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "name", req.Name) {
+        return
+    }
+    if req.Event != "" && !oneOf(req.Event, automationEvents) {
+        writeFieldError(w, r, invalidField("event", "must be one of %s", strings.Join(automationEvents, ", ")))
+        return
+    }
+
+    automationsMu.Lock()
+    automations, err := loadAutomationsLocked(r.Context())
+    automationsMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "load automations", "Internal error")
+        return
+    }
+    var found *Automation
+    for i := range automations {
+        if automations[i].Name == req.Name {
+            found = &automations[i]
+        }
+    }
+    if found == nil {
+        apierror.Write(w, r, apierror.CodeNotFound, "name", "Automation not found")
+        return
+    }
+
+    event := AutomationEvent{Event: req.Event, Path: req.Path, Actor: user.Name, Test: true}
+    if event.Event == "" {
+        event.Event = "note.save"
+        if len(found.Events) > 0 {
+            event.Event = found.Events[0]
+        }
+    }
+    if event.Path == "" {
+        event.Path = strings.TrimPrefix(found.Folder+"/example"+fileExt, "/")
+    }
+    switch {
+    case strings.HasPrefix(event.Event, "workflow."):
+        action := workflowActions[strings.TrimPrefix(event.Event, "workflow.")]
+        event.Workflow = &AutomationWorkflow{From: action.From, To: action.To, Comment: "Test comment"}
+    case event.Event == "backup.succeeded":
+        event.Path, event.Backup = "", &AutomationBackup{Path: "scratchpad-example.tar.gz", Files: 1}
+    case event.Event == "backup.failed":
+        event.Path, event.Backup = "", &AutomationBackup{Error: "test failure"}
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), automationTestTimeout)
+    defer cancel()
+    delivery := deliverAutomation(ctx, *found, event)
+    auditRule(r, "automation.test", user.Name, found.Name,
+        fmt.Sprintf("event=%s path=%s status=%d error=%q", event.Event, event.Path, delivery.Status, delivery.Error))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(delivery)
+}
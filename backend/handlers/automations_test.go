@@ -0,0 +1,108 @@
+// -------------------------------------------------------
+// backend/handlers/automations_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that automation deliveries cannot reach internal
+//     addresses, do not follow redirects, and that changing
+//     automations needs one of automations.roles.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/netip"
+    "strings"
+    "testing"
+
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+)
+
+func TestCheckAutomationAddress(t *testing.T) {
+    allowed := []netip.Prefix{netip.MustParsePrefix("10.20.0.0/16")}
+    for _, tc := range []struct {
+        addr string
+        ok   bool
+    }{
+        {"93.184.216.34", true},
+        {"2606:4700::1111", true},
+        {"127.0.0.1", false},
+        {"::1", false},
+        {"169.254.169.254", false},
+        {"fe80::1", false},
+        {"10.0.0.5", false},
+        {"172.16.3.4", false},
+        {"192.168.1.1", false},
+        {"fd00::1", false},
+        {"100.64.1.1", false},
+        {"0.0.0.0", false},
+        {"::ffff:127.0.0.1", false},
+        {"10.20.1.2", true},
+    } {
+        err := checkAutomationAddress(netip.MustParseAddr(tc.addr), allowed)
+        if (err == nil) != tc.ok {
+            t.Errorf("checkAutomationAddress(%s) = %v, want allowed %t", tc.addr, err, tc.ok)
+        }
+    }
+}
+
+func TestDeliverAutomationRefusesInternalAndRedirects(t *testing.T) {
+    hits := 0
+    target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits++
+        if r.URL.Path == "/hop" {
+            http.Redirect(w, r, "/final", http.StatusFound)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer target.Close()
+
+    cfg := config.Defaults()
+    srv := NewServer("/cfo-scratchpad-automation-test", func() *config.Config { return cfg }, NewMemStorage("/cfo-scratchpad-automation-test"), nil, nil)
+    ctx := srv.Context()
+
+    delivery := deliverAutomation(ctx, Automation{Name: "internal", URL: target.URL + "/hook"}, AutomationEvent{Event: "note.save"})
+    if hits != 0 || delivery.Error == "" || !strings.Contains(delivery.Error, "not public") {
+        t.Fatalf("loopback delivery: hits=%d %+v", hits, delivery)
+    }
+
+    cfg.Automations.AllowedNetworks = []string{"127.0.0.1"}
+    delivery = deliverAutomation(ctx, Automation{Name: "redirect", URL: target.URL + "/hop"}, AutomationEvent{Event: "note.save"})
+    if hits != 1 || delivery.Status != http.StatusFound || delivery.Error == "" {
+        t.Fatalf("redirect followed or not reported: hits=%d %+v", hits, delivery)
+    }
+    delivery = deliverAutomation(ctx, Automation{Name: "allowed", URL: target.URL + "/hook"}, AutomationEvent{Event: "note.save"})
+    if delivery.Status != http.StatusNoContent || delivery.Error != "" {
+        t.Fatalf("allowed network delivery: %+v", delivery)
+    }
+}
+
+func TestAutomationChangesNeedRole(t *testing.T) {
+    srv := NewServer("/cfo-scratchpad-automation-test", nil, NewMemStorage("/cfo-scratchpad-automation-test"), nil, nil)
+    for _, tc := range []struct {
+        user auth.User
+        want int
+    }{
+        {auth.User{Name: "eve", Roles: []string{auth.RoleEditor}}, http.StatusForbidden},
+        {auth.User{Name: "amy", Roles: []string{auth.RoleApprover}}, http.StatusOK},
+    } {
+        r := httptest.NewRequest("POST", "/automations", strings.NewReader(`{"name":"a","url":"https://hooks.example.com/x"}`))
+        r = r.WithContext(auth.WithUser(r.Context(), tc.user))
+        rec := httptest.NewRecorder()
+        srv.Handler(http.HandlerFunc(HandleAutomations)).ServeHTTP(rec, r)
+        if rec.Code != tc.want {
+            t.Errorf("%s: POST /automations = %d %s, want %d", tc.user.Name, rec.Code, rec.Body, tc.want)
+        }
+    }
+
+    r := httptest.NewRequest("POST", "/automations", strings.NewReader(`{"name":"b","url":"http://169.254.169.254/latest"}`))
+    r = r.WithContext(auth.WithUser(r.Context(), auth.User{Name: "amy", Roles: []string{auth.RoleApprover}}))
+    rec := httptest.NewRecorder()
+    srv.Handler(http.HandlerFunc(HandleAutomations)).ServeHTTP(rec, r)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("metadata address accepted: %d %s", rec.Code, rec.Body)
+    }
+}
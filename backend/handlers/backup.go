@@ -0,0 +1,157 @@
+// -------------------------------------------------------
+// backend/handlers/backup.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Full backup of <scratchRoot> (notes and .scratchpad metadata)
+//     to a timestamped .tar.gz in the configured backup directory.
+// Audit:
+//   - Only regular files and directories are archived; symlinks and
+//     special files are skipped, never followed.
+//   - The archive is written as *.partial and renamed when complete,
+//     so a visible backup is always whole.
+//   - Returns the archive's SHA-256 for the audit record.
+//   - Every finished backup fires backup.succeeded or backup.failed
+//     automations (automations.go).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// -------------------------------------------------------
+// type BackupResult
+// -------------------------------------------------------
+// Purpose:
+//   - Summary of a completed backup archive.
+// -------------------------------------------------------
+type BackupResult struct {
+    Path      string `json:"path"`
+    Files     int    `json:"files"`
+    Bytes     int64  `json:"bytes"`
+    SHA256    string `json:"sha256"`
+    CreatedAt string `json:"created_at"`
+}
+
+// -------------------------------------------------------
+// func CreateBackup(ctx, dir) (BackupResult, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Archive scratchRoot into dir/scratchpad-<UTC>.tar.gz.
+// Audit:
+//   - dir is created if missing; a dir inside scratchRoot is
+//     excluded from the walk so backups never contain backups.
+//   - Cancelling ctx aborts the walk and removes the partial file.
+// -------------------------------------------------------
+func CreateBackup(ctx context.Context, dir string) (BackupResult, error) {
+    result, err := writeBackup(ctx, dir)
+    notifyBackup(ctx, result, err)
+    return result, err
+}
+
+// writeBackup writes the archive for CreateBackup.
+func writeBackup(ctx context.Context, dir string) (BackupResult, error) {
+    result := BackupResult{CreatedAt: utcNow(ctx)}
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return result, err
+    }
+
+    name := "scratchpad-" + timeNow(ctx).UTC().Format("20060102T150405Z") + ".tar.gz"
+    final := filepath.Join(dir, name)
+    partial := final + ".partial"
+
+    out, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return result, err
+    }
+    fail := func(err error) (BackupResult, error) {
+        out.Close()
+        os.Remove(partial)
+        return result, err
+    }
+
+    hasher := sha256.New()
+    gz := gzip.NewWriter(io.MultiWriter(out, hasher))
+    tw := tar.NewWriter(gz)
+    skipDir := filepath.Clean(dir)
+
+    err = walkPath(ctx, scratchRoot(ctx), func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if path == scratchRoot(ctx) {
+            return nil
+        }
+        if info.IsDir() && filepath.Clean(path) == skipDir {
+            return filepath.SkipDir
+        }
+        if !info.IsDir() && !info.Mode().IsRegular() {
+            logInfo(ctx, "Backup skipped non-regular entry: "+path)
+            return nil
+        }
+        if strings.Contains(info.Name(), ".tmp-") {
+            return nil
+        }
+
+        header, err := tar.FileInfoHeader(info, "")
+        if err != nil {
+            return err
+        }
+        header.Name = relativeTo(ctx, path)
+        if info.IsDir() {
+            header.Name += "/"
+        }
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        f, err := serverFrom(ctx).Storage.Open(path)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        n, err := io.Copy(tw, io.LimitReader(f, info.Size()))
+        if err != nil {
+            return err
+        }
+        result.Files++
+        result.Bytes += n
+        return nil
+    })
+    if err != nil {
+        return fail(err)
+    }
+    if err := tw.Close(); err != nil {
+        return fail(err)
+    }
+    if err := gz.Close(); err != nil {
+        return fail(err)
+    }
+    if err := out.Sync(); err != nil {
+        return fail(err)
+    }
+    if err := out.Close(); err != nil {
+        os.Remove(partial)
+        return result, err
+    }
+    if err := os.Rename(partial, final); err != nil {
+        os.Remove(partial)
+        return result, err
+    }
+
+    result.Path = final
+    result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+    return result, nil
+}
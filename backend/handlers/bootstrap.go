@@ -0,0 +1,198 @@
+// -------------------------------------------------------
+// backend/handlers/bootstrap.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - /folders/bootstrap: create a standard folder skeleton (e.g.
+//     01-close, 02-forecast, 03-board, 99-archive) under a new entity
+//     or month folder from a template in folder_templates.
+//   - GET lists the configured templates.
+// Audit:
+//   - Every template folder passes the same name policy as folder
+//     creation; an invalid one rejects the whole request before
+//     anything is created.
+//   - Existing folders are left alone and reported as "existing",
+//     so re-running a bootstrap fills in what is missing.
+//   - Writes a "folder.bootstrap" audit event.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "sort"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const defaultFolderTemplate = "default"
+
+// -------------------------------------------------------
+// type BootstrapResult
+// -------------------------------------------------------
+// Purpose:
+//   - Outcome of a bootstrap: which folders were created and which
+//     were already there.
+// -------------------------------------------------------
+type BootstrapResult struct {
+    Path     string   `json:"path"`
+    Template string   `json:"template"`
+    Created  []string `json:"created"`
+    Existing []string `json:"existing"`
+}
+
+// errNotAFolder marks a template path occupied by a file.
+var errNotAFolder = errors.New("not a folder")
+
+// -------------------------------------------------------
+// func bootstrapTargets(ctx context.Context, base string, folders []string) ([]string, string)
+// -------------------------------------------------------
+// Purpose:
+//   - Absolute paths of base and each template folder inside it.
+// Audit:
+//   - Returns the first folder failing the name policy as bad.
+// -------------------------------------------------------
+func bootstrapTargets(ctx context.Context, base string, folders []string) ([]string, string) {
+    targets := []string{sanitizePath(ctx, base)}
+    for _, folder := range folders {
+        name, err := applyNamePolicy(path.Join(base, folder))
+        if err != nil || sanitizePath(ctx, name) == "" {
+            return nil, folder
+        }
+        targets = append(targets, sanitizePath(ctx, name))
+    }
+    return targets, ""
+}
+
+// -------------------------------------------------------
+// func createFolders(ctx, targets) (created, existing []string, err error)
+// -------------------------------------------------------
+// Purpose:
+//   - Create each missing folder in order; report which were created
+//     and which already existed (relative paths).
+// Audit:
+//   - A target that is a file fails with errNotAFolder.
+// -------------------------------------------------------
+func createFolders(ctx context.Context, targets []string) ([]string, []string, error) {
+    created, existing := []string{}, []string{}
+    for _, target := range targets {
+        info, err := statPath(ctx, target)
+        switch {
+        case err == nil && info.IsDir():
+            existing = append(existing, relativeTo(ctx, target))
+            continue
+        case err == nil:
+            return created, existing, fmt.Errorf("%w: %s", errNotAFolder, relativeTo(ctx, target))
+        case !os.IsNotExist(err):
+            return created, existing, err
+        }
+        if err := mkdirAll(ctx, target); err != nil {
+            return created, existing, err
+        }
+        created = append(created, relativeTo(ctx, target))
+    }
+    return created, existing, nil
+}
+
+// -------------------------------------------------------
+// func HandleFolderBootstrap(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /folders/bootstrap: {"templates": {name: [folders]}}.
+//   - POST /folders/bootstrap {"path", "template"}: create path and
+//     the template's folders inside it (template defaults to
+//     "default").
+// -------------------------------------------------------
+func HandleFolderBootstrap(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"templates": currentConfig(r.Context()).FolderTemplates})
+    case http.MethodPost:
+        handleBootstrap(w, r)
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// handleBootstrap serves POST /folders/bootstrap.
+func handleBootstrap(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Path     string `json:"path"`
+        Template string `json:"template"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    req.Template = defaultString(req.Template, defaultFolderTemplate)
+    templates := currentConfig(r.Context()).FolderTemplates
+    folders, ok := templates[req.Template]
+    if !ok {
+        names := make([]string, 0, len(templates))
+        for name := range templates {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        writeFieldError(w, r, invalidField("template", "must be one of %s", strings.Join(names, ", ")))
+        return
+    }
+
+    base, policyErr := applyNamePolicy(req.Path)
+    if policyErr != nil {
+        logError(r.Context(), "Rejected bootstrap path by policy: "+req.Path+" ("+policyErr.Error()+")")
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder name: "+policyErr.Error())
+        return
+    }
+    absBase := sanitizePath(r.Context(), base)
+    if absBase == "" || absBase == scratchRoot(r.Context()) {
+        logError(r.Context(), "Rejected unsafe bootstrap path: "+req.Path)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, absBase) {
+        return
+    }
+
+    targets, bad := bootstrapTargets(r.Context(), base, folders)
+    if bad != "" {
+        logError(r.Context(), "Template "+req.Template+" has an invalid folder: "+bad)
+        apierror.Write(w, r, apierror.CodeInvalidConfig, "template", fmt.Sprintf("Template folder %q is not a valid name", bad))
+        return
+    }
+
+    result := BootstrapResult{Path: relativeTo(r.Context(), absBase), Template: req.Template}
+    var err error
+    result.Created, result.Existing, err = createFolders(r.Context(), targets)
+    if errors.Is(err, errNotAFolder) {
+        apierror.Write(w, r, apierror.CodeConflict, "path", err.Error())
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "create bootstrap folders under "+absBase, "Internal error")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Bootstrapped %s from template %s: %d created, %d existing",
+        result.Path, result.Template, len(result.Created), len(result.Existing)))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "folder.bootstrap",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusCreated,
+        Actor:    actorName(r.Context()),
+        Target:   result.Path,
+        Detail:   fmt.Sprintf("template=%s created=%d existing=%d", result.Template, len(result.Created), len(result.Existing)),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,221 @@
+// -------------------------------------------------------
+// backend/handlers/calendar.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /calendar?month=2024-06: everything dated in one month,
+//     per day, for a month view:
+//       notes      notes with the date in their name
+//                  (standup-2024-06-03.md, 2024/06-03 daily.md)
+//       due        notes whose frontmatter due date is that day
+//                  (frontmatter.go)
+//       tasks      checklist items due that day (tasks.go)
+//       scheduled  recurring notes the scheduler creates that day
+//                  (recurring.go), past or upcoming
+// Audit:
+//   - Days are UTC, like the recurring schedules. Every day of the
+//     month is present; empty lists are omitted.
+//   - Read-only. Everything comes from the metadata index and the
+//     configuration; notes in archived folders are left out.
+//   - The same days feed /calendar.ics (calendar_feed.go).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/schedule"
+)
+
+const calendarMonthLayout = "2006-01"
+
+// calendarNoteDatePattern finds a YYYY-MM-DD date in a note name.
+var calendarNoteDatePattern = regexp.MustCompile(`(?:^|[^0-9])(\d{4}-\d{2}-\d{2})(?:$|[^0-9])`)
+
+// -------------------------------------------------------
+// type CalendarDay
+// -------------------------------------------------------
+// Purpose:
+//   - What one day of the month holds.
+// -------------------------------------------------------
+type CalendarDay struct {
+    Date      string              `json:"date"`
+    Notes     []string            `json:"notes,omitempty"`
+    Due       []CalendarDue       `json:"due,omitempty"`
+    Tasks     []Task              `json:"tasks,omitempty"`
+    Scheduled []CalendarScheduled `json:"scheduled,omitempty"`
+}
+
+// CalendarDue is a note due that day by its frontmatter.
+type CalendarDue struct {
+    Path   string `json:"path"`
+    Title  string `json:"title,omitempty"`
+    Status string `json:"status,omitempty"`
+    Owner  string `json:"owner,omitempty"`
+}
+
+// CalendarScheduled is a recurring note created that day.
+type CalendarScheduled struct {
+    Name   string `json:"name"`
+    At     string `json:"at"`
+    Target string `json:"target"`
+}
+
+// -------------------------------------------------------
+// func noteNameDate(rel string) string
+// -------------------------------------------------------
+// Purpose:
+//   - The date a note's name carries ("" when none): the file name
+//     is tried first, then the name with its folder.
+// -------------------------------------------------------
+func noteNameDate(rel string) string {
+    for _, name := range []string{path.Base(rel), strings.ReplaceAll(rel, "/", "-")} {
+        if match := calendarNoteDatePattern.FindStringSubmatch(name); match != nil {
+            if _, err := time.Parse(frontmatterDueLayout, match[1]); err == nil {
+                return match[1]
+            }
+        }
+    }
+    return ""
+}
+
+// -------------------------------------------------------
+// func HandleCalendar(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /calendar?month=YYYY-MM (default: the current month)
+//     [&folder=]: {"month", "days": [CalendarDay...]}.
+// Audit:
+//   - folder limits notes, due dates and tasks to one folder and
+//     its subfolders; recurring notes are kept when their target
+//     lies there.
+//   - A recurring schedule that fires several times a day is shown
+//     once per day, at its first time.
+// -------------------------------------------------------
+func HandleCalendar(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    ctx := r.Context()
+    q := r.URL.Query()
+
+    start := timeNow(ctx).UTC()
+    start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+    if month := q.Get("month"); month != "" {
+        parsed, err := time.Parse(calendarMonthLayout, month)
+        if err != nil {
+            writeFieldError(w, r, invalidField("month", "must be a month (YYYY-MM)"))
+            return
+        }
+        start = parsed
+    }
+    end := start.AddDate(0, 1, 0)
+    scope, ok := calendarScope(w, r, q.Get("folder"))
+    if !ok {
+        return
+    }
+
+    days := calendarDays(ctx, start, end, scope)
+    logInfo(ctx, fmt.Sprintf("Calendar for %s under %s", start.Format(calendarMonthLayout), defaultString(scope, "/")))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "month": start.Format(calendarMonthLayout),
+        "days":  days,
+    })
+}
+
+// calendarScope is the folder prefix ("" for all) of a folder
+// parameter; it answers the request and returns false when invalid.
+func calendarScope(w http.ResponseWriter, r *http.Request, folder string) (string, bool) {
+    if folder == "" {
+        return "", true
+    }
+    absFolder := sanitizePath(r.Context(), folder)
+    if absFolder == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+        return "", false
+    }
+    if absFolder == scratchRoot(r.Context()) {
+        return "", true
+    }
+    return relativeTo(r.Context(), absFolder) + "/", true
+}
+
+// -------------------------------------------------------
+// func calendarDays(ctx, start, end, scope) []CalendarDay
+// -------------------------------------------------------
+// Purpose:
+//   - Every day from start (a UTC midnight) up to end with what it
+//     holds; scope is "" or a folder prefix ending in "/".
+// -------------------------------------------------------
+func calendarDays(ctx context.Context, start time.Time, end time.Time, scope string) []CalendarDay {
+    days := []CalendarDay{}
+    byDate := map[string]int{}
+    for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+        byDate[day.Format(frontmatterDueLayout)] = len(days)
+        days = append(days, CalendarDay{Date: day.Format(frontmatterDueLayout)})
+    }
+
+    index := indexSnapshot(ctx)
+    rels := make([]string, 0, len(index))
+    for rel := range index {
+        if scope != "" && !strings.HasPrefix(rel, scope) {
+            continue
+        }
+        if _, _, archived := archivedFolderFor(ctx, rel); archived {
+            continue
+        }
+        rels = append(rels, rel)
+    }
+    sort.Strings(rels)
+
+    frontmatter := newFrontmatterLookup(ctx, index)
+    for _, rel := range rels {
+        if i, ok := byDate[noteNameDate(rel)]; ok {
+            days[i].Notes = append(days[i].Notes, rel)
+        }
+        if fm := frontmatter.of(rel); fm.Due != "" {
+            if i, ok := byDate[fm.Due]; ok {
+                days[i].Due = append(days[i].Due, CalendarDue{Path: rel, Title: fm.Title, Status: fm.Status, Owner: fm.Owner})
+            }
+        }
+        for _, task := range noteTasks(ctx, index, rel) {
+            if i, ok := byDate[task.Due]; ok {
+                days[i].Tasks = append(days[i].Tasks, Task{Path: rel, NoteTask: task})
+            }
+        }
+    }
+
+    for _, note := range currentConfig(ctx).Recurring {
+        sched, err := schedule.Parse(note.Schedule)
+        if err != nil {
+            continue
+        }
+        for at := sched.Next(start.Add(-time.Minute)); !at.IsZero() && at.Before(end); {
+            target := expandRecurring(note.Target, at)
+            if scope == "" || strings.HasPrefix(target, scope) {
+                i := byDate[at.Format(frontmatterDueLayout)]
+                days[i].Scheduled = append(days[i].Scheduled, CalendarScheduled{Name: note.Name, At: at.Format(time.RFC3339), Target: target})
+            }
+            // Skip the rest of the day: one entry per day is enough.
+            nextDay := time.Date(at.Year(), at.Month(), at.Day()+1, 0, 0, 0, 0, time.UTC)
+            at = sched.Next(nextDay.Add(-time.Minute))
+        }
+    }
+    for i := range days {
+        scheduled := days[i].Scheduled
+        sort.SliceStable(scheduled, func(a, b int) bool { return scheduled[a].At < scheduled[b].At })
+    }
+    return days
+}
@@ -0,0 +1,413 @@
+// -------------------------------------------------------
+// backend/handlers/calendar_feed.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /calendar.ics: the calendar (calendar.go) as an iCalendar
+//     feed that Outlook or Google Calendar can subscribe to: due
+//     dates, dated tasks and dated journal notes as all-day events.
+//   - Feed tokens, since calendar apps cannot send headers:
+//       GET    /calendar/feed            whether the caller has one
+//       POST   /calendar/feed {"folder"} issue (or replace) it
+//       DELETE /calendar/feed            revoke it
+// Audit:
+//   - The feed answers a user token like any route, or
+//     ?token=<feed token>. A feed token opens only this feed, for
+//     its user, limited to the folder chosen when it was issued.
+//   - Feed tokens are shown once and stored as SHA-256 in
+//     .scratchpad/keys/calendar_feeds.json (mode 0600), one per
+//     user. A token of a user no longer configured is refused.
+//   - Unknown feed tokens answer 401, write "auth.denied" and count
+//     towards the client's login throttle like a bad user token.
+//   - Issue and revoke write "calendar.feed_issue" and
+//     "calendar.feed_revoke".
+//   - The feed covers calendarFeedPastDays before today up to
+//     calendarFeedFutureDays after. Open tasks and due dates carry
+//     a 9:00 reminder.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/auth"
+)
+
+const (
+    calendarFeedsFile      = "keys/calendar_feeds.json"
+    calendarFeedPastDays   = 90
+    calendarFeedFutureDays = 365
+    calendarICSDateLayout  = "20060102"
+    calendarICSStampLayout = "20060102T150405Z"
+)
+
+// calendarFeedsMu guards calendar_feeds.json.
+var calendarFeedsMu sync.Mutex
+
+// -------------------------------------------------------
+// type CalendarFeed
+// -------------------------------------------------------
+// Purpose:
+//   - A user's feed token, as stored.
+// -------------------------------------------------------
+type CalendarFeed struct {
+    TokenSHA256 string `json:"token_sha256"`
+    Folder      string `json:"folder,omitempty"`
+    CreatedAt   string `json:"created_at"`
+}
+
+// loadCalendarFeedsLocked returns feeds by user. Caller holds
+// calendarFeedsMu.
+func loadCalendarFeedsLocked(ctx context.Context) (map[string]CalendarFeed, error) {
+    feeds := map[string]CalendarFeed{}
+    if err := loadMetaJSON(ctx, calendarFeedsFile, &feeds); err != nil {
+        return nil, err
+    }
+    if feeds == nil {
+        feeds = map[string]CalendarFeed{}
+    }
+    return feeds, nil
+}
+
+// saveCalendarFeedsLocked writes calendar_feeds.json owner-only.
+func saveCalendarFeedsLocked(ctx context.Context, feeds map[string]CalendarFeed) error {
+    data, err := json.MarshalIndent(feeds, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeMetaFilePerm(ctx, calendarFeedsFile, data, 0600)
+}
+
+// -------------------------------------------------------
+// func calendarFeedUser(ctx context.Context, token string) (string, CalendarFeed, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The user and feed a feed token belongs to.
+// -------------------------------------------------------
+func calendarFeedUser(ctx context.Context, token string) (string, CalendarFeed, bool) {
+    hash := auth.HashToken(token)
+    calendarFeedsMu.Lock()
+    feeds, err := loadCalendarFeedsLocked(ctx)
+    calendarFeedsMu.Unlock()
+    if err != nil {
+        logError(ctx, "Failed to load calendar feeds: "+err.Error())
+        return "", CalendarFeed{}, false
+    }
+    for user, feed := range feeds {
+        if feed.TokenSHA256 == hash {
+            if _, ok := currentConfig(ctx).Users[user]; !ok {
+                return "", CalendarFeed{}, false
+            }
+            return user, feed, true
+        }
+    }
+    return "", CalendarFeed{}, false
+}
+
+// -------------------------------------------------------
+// func HandleCalendarFeed(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /calendar/feed: show, issue or revoke the caller's feed token.
+//     POST answers 201 {"token", "url", "folder", "created_at"};
+//     url is the feed path to append to the server's address.
+// -------------------------------------------------------
+func HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    switch r.Method {
+    case http.MethodGet:
+        calendarFeedsMu.Lock()
+        feeds, err := loadCalendarFeedsLocked(r.Context())
+        calendarFeedsMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load calendar feeds", "Internal error")
+            return
+        }
+        feed, enabled := feeds[user.Name]
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "enabled":    enabled,
+            "folder":     feed.Folder,
+            "created_at": feed.CreatedAt,
+        })
+
+    case http.MethodPost:
+        var req struct {
+            Folder string `json:"folder"`
+        }
+        if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+            return
+        }
+        scope, ok := calendarScope(w, r, req.Folder)
+        if !ok {
+            return
+        }
+        token := auth.NewToken()
+        feed := CalendarFeed{
+            TokenSHA256: auth.HashToken(token),
+            Folder:      strings.TrimSuffix(scope, "/"),
+            CreatedAt:   timeNow(r.Context()).UTC().Format(time.RFC3339),
+        }
+        calendarFeedsMu.Lock()
+        feeds, err := loadCalendarFeedsLocked(r.Context())
+        if err == nil {
+            feeds[user.Name] = feed
+            err = saveCalendarFeedsLocked(r.Context(), feeds)
+        }
+        calendarFeedsMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "save calendar feed for "+user.Name, "Internal error")
+            return
+        }
+        logInfo(r.Context(), "Issued calendar feed token for "+user.Name)
+        auditAuth(r, "calendar.feed_issue", http.StatusCreated, user.Name, "folder="+defaultString(feed.Folder, "/"))
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "token":      token,
+            "url":        "/calendar.ics?token=" + token,
+            "folder":     feed.Folder,
+            "created_at": feed.CreatedAt,
+        })
+
+    case http.MethodDelete:
+        calendarFeedsMu.Lock()
+        feeds, err := loadCalendarFeedsLocked(r.Context())
+        _, found := feeds[user.Name]
+        if err == nil && found {
+            delete(feeds, user.Name)
+            err = saveCalendarFeedsLocked(r.Context(), feeds)
+        }
+        calendarFeedsMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "revoke calendar feed for "+user.Name, "Internal error")
+            return
+        }
+        if !found {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "No calendar feed token")
+            return
+        }
+        logInfo(r.Context(), "Revoked calendar feed token for "+user.Name)
+        auditAuth(r, "calendar.feed_revoke", http.StatusNoContent, user.Name, "")
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func icsText(s string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Escape a TEXT value (RFC 5545 3.3.11).
+// -------------------------------------------------------
+func icsText(s string) string {
+    return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// -------------------------------------------------------
+// func writeICSLine(b *strings.Builder, line string)
+// -------------------------------------------------------
+// Purpose:
+//   - Append one content line, folded at 75 octets without
+//     splitting a UTF-8 character (RFC 5545 3.1).
+// -------------------------------------------------------
+func writeICSLine(b *strings.Builder, line string) {
+    limit := 75
+    for len(line) > limit {
+        cut := limit
+        for cut > 0 && line[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        b.WriteString(line[:cut] + "\r\n ")
+        line = line[cut:]
+        // Continuation lines start with the space.
+        limit = 74
+    }
+    b.WriteString(line + "\r\n")
+}
+
+// -------------------------------------------------------
+// type icsEvent
+// -------------------------------------------------------
+// Purpose:
+//   - One all-day event of the feed; Key makes its UID stable
+//     across refreshes.
+// -------------------------------------------------------
+type icsEvent struct {
+    Key         string
+    Date        string
+    Summary     string
+    Description string
+    Category    string
+    Reminder    bool
+}
+
+// writeICSEvent appends event as a VEVENT.
+func writeICSEvent(b *strings.Builder, event icsEvent, stamp string) {
+    day, _ := time.Parse(frontmatterDueLayout, event.Date)
+    uid := sha256.Sum256([]byte(event.Key))
+    writeICSLine(b, "BEGIN:VEVENT")
+    writeICSLine(b, "UID:"+hex.EncodeToString(uid[:16])+"@cfo-scratchpad")
+    writeICSLine(b, "DTSTAMP:"+stamp)
+    writeICSLine(b, "DTSTART;VALUE=DATE:"+day.Format(calendarICSDateLayout))
+    writeICSLine(b, "DTEND;VALUE=DATE:"+day.AddDate(0, 0, 1).Format(calendarICSDateLayout))
+    writeICSLine(b, "SUMMARY:"+icsText(event.Summary))
+    writeICSLine(b, "DESCRIPTION:"+icsText(event.Description))
+    writeICSLine(b, "CATEGORIES:"+icsText(event.Category))
+    writeICSLine(b, "TRANSP:TRANSPARENT")
+    if event.Reminder {
+        writeICSLine(b, "BEGIN:VALARM")
+        writeICSLine(b, "ACTION:DISPLAY")
+        writeICSLine(b, "DESCRIPTION:"+icsText(event.Summary))
+        writeICSLine(b, "TRIGGER;RELATED=START:PT9H")
+        writeICSLine(b, "END:VALARM")
+    }
+    writeICSLine(b, "END:VEVENT")
+}
+
+// -------------------------------------------------------
+// func calendarICS(days []CalendarDay, name string, now time.Time) string
+// -------------------------------------------------------
+// Purpose:
+//   - The VCALENDAR of days: journal notes, due dates and tasks.
+// Audit:
+//   - Done tasks are kept, marked "Done:", without a reminder.
+// -------------------------------------------------------
+func calendarICS(days []CalendarDay, name string, now time.Time) string {
+    var b strings.Builder
+    stamp := now.UTC().Format(calendarICSStampLayout)
+    writeICSLine(&b, "BEGIN:VCALENDAR")
+    writeICSLine(&b, "VERSION:2.0")
+    writeICSLine(&b, "PRODID:-//projectfong//cfo-scratchpad//EN")
+    writeICSLine(&b, "CALSCALE:GREGORIAN")
+    writeICSLine(&b, "METHOD:PUBLISH")
+    writeICSLine(&b, "X-WR-CALNAME:"+icsText(name))
+    writeICSLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+    writeICSLine(&b, "X-PUBLISHED-TTL:PT1H")
+    for _, day := range days {
+        for _, rel := range day.Notes {
+            writeICSEvent(&b, icsEvent{
+                Key:         "note|" + rel,
+                Date:        day.Date,
+                Summary:     strings.TrimSuffix(path.Base(rel), path.Ext(rel)),
+                Description: rel,
+                Category:    "Journal",
+            }, stamp)
+        }
+        for _, due := range day.Due {
+            description := due.Path
+            if due.Status != "" {
+                description += "\nStatus: " + due.Status
+            }
+            if due.Owner != "" {
+                description += "\nOwner: " + due.Owner
+            }
+            writeICSEvent(&b, icsEvent{
+                Key:         "due|" + due.Path,
+                Date:        day.Date,
+                Summary:     "Due: " + defaultString(due.Title, strings.TrimSuffix(path.Base(due.Path), path.Ext(due.Path))),
+                Description: description,
+                Category:    "Due",
+                Reminder:    true,
+            }, stamp)
+        }
+        for _, task := range day.Tasks {
+            summary := "Task: " + task.Text
+            if task.Done {
+                summary = "Done: " + task.Text
+            }
+            writeICSEvent(&b, icsEvent{
+                Key:         fmt.Sprintf("task|%s|%d|%s", task.Path, task.Line, task.Text),
+                Date:        day.Date,
+                Summary:     summary,
+                Description: fmt.Sprintf("%s, line %d", task.Path, task.Line),
+                Category:    "Task",
+                Reminder:    !task.Done,
+            }, stamp)
+        }
+    }
+    writeICSLine(&b, "END:VCALENDAR")
+    return b.String()
+}
+
+// -------------------------------------------------------
+// func HandleCalendarICS(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /calendar.ics[?token=...][&folder=...]: the feed as
+//     text/calendar.
+// Audit:
+//   - With a feed token, folder may only narrow the token's folder.
+// -------------------------------------------------------
+func HandleCalendarICS(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    ctx := r.Context()
+    q := r.URL.Query()
+    actor, feedFolder := actorName(ctx), ""
+    if token := q.Get("token"); token != "" {
+        key := "ip:" + clientAddr(r)
+        if wait, _ := auth.ThrottleWait(key, timeNow(ctx)); wait > 0 {
+            w.Header().Set("Retry-After", fmt.Sprint(int((wait+time.Second-1)/time.Second)))
+            apierror.Write(w, r, apierror.CodeRateLimited, "", "Too many failed attempts; retry later")
+            return
+        }
+        user, feed, ok := calendarFeedUser(ctx, token)
+        if !ok {
+            failures, _ := auth.ThrottleFail(key, timeNow(ctx))
+            auditAuth(r, "auth.denied", http.StatusUnauthorized, "", fmt.Sprintf("unknown calendar feed token (failure %d)", failures))
+            apierror.Write(w, r, apierror.CodeUnauthorized, "token", "Unauthorized")
+            return
+        }
+        auth.ThrottleReset(key)
+        actor, feedFolder = user, feed.Folder
+    } else if _, ok := requireUser(w, r); !ok {
+        return
+    }
+
+    scope, ok := calendarScope(w, r, q.Get("folder"))
+    if !ok {
+        return
+    }
+    if feedFolder != "" && !pathWithin(strings.TrimSuffix(scope, "/"), feedFolder) {
+        scope = feedFolder + "/"
+    }
+
+    now := timeNow(ctx).UTC()
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+    days := calendarDays(ctx, today.AddDate(0, 0, -calendarFeedPastDays), today.AddDate(0, 0, calendarFeedFutureDays+1), scope)
+    name := "CFO Scratchpad"
+    if scope != "" {
+        name += " - " + strings.TrimSuffix(scope, "/")
+    }
+    body := calendarICS(days, name, now)
+
+    logInfo(ctx, fmt.Sprintf("Calendar feed for %s under %s", defaultString(actor, "anonymous"), defaultString(scope, "/")))
+    w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+    w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+    w.Header().Set("Cache-Control", "private, no-cache")
+    if r.Method == http.MethodHead {
+        return
+    }
+    w.Write([]byte(body))
+}
@@ -0,0 +1,41 @@
+// -------------------------------------------------------
+// backend/handlers/changes.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Change feed for clients: the change journal (journal.go) as
+//     an ordered list of mutations after a sequence number.
+//       GET /changes?since=N&limit=M
+//   - The same pages sync secondaries read from /sync/changes, but
+//     behind the normal user authentication instead of the sync key.
+// Audit:
+//   - Each entry's clock is its sequence number; it strictly
+//     increases, so a client keeps the last clock it saw and asks
+//     for ?since=<clock> next. "more" is true when another page
+//     follows; "clock" is the newest sequence number now.
+//   - Entries carry paths, hashes, sizes and tags, never content.
+//   - Read-only; no audit event is written, as for /activity.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "net/http"
+
+    "cfo-scratchpad/apierror"
+)
+
+// -------------------------------------------------------
+// func HandleChanges(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /changes?since=N&limit=M: mutations after sequence N
+//     (default 0), at most M per page (default 500, max 5000).
+// -------------------------------------------------------
+func HandleChanges(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    writeChangesPage(w, r)
+}
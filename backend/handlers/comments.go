@@ -0,0 +1,378 @@
+// -------------------------------------------------------
+// backend/handlers/comments.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Threaded review comments on notes, kept out of the note text:
+//       GET  /file/comments?path=...                   threads
+//       POST /file/comments {"path", "body", "line", "parent_id"}
+//       POST /file/comments/resolve {"path", "id", "resolved"}
+//   - One sidecar per note: .scratchpad/comments/<sha256(path)>.json.
+// Audit:
+//   - Author is always the authenticated caller (401 otherwise).
+//   - Threads are resolved as a whole (root comment); replies to
+//     replies are not allowed.
+//   - Writes "comment.add" and "comment.resolve" with the actor.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    commentsDirName = "comments"
+    maxCommentBytes = 4000
+)
+
+// commentsMu guards the comment sidecars.
+var commentsMu sync.Mutex
+
+// -------------------------------------------------------
+// type Comment
+// -------------------------------------------------------
+// Purpose:
+//   - One comment; ParentID is set for replies.
+// Audit:
+//   - Line is a 1-based anchor into the note (0 = whole note).
+// -------------------------------------------------------
+type Comment struct {
+    ID         string `json:"id"`
+    ParentID   string `json:"parent_id,omitempty"`
+    Author     string `json:"author"`
+    Body       string `json:"body"`
+    Line       int    `json:"line,omitempty"`
+    CreatedAt  string `json:"created_at"`
+    Resolved   bool   `json:"resolved,omitempty"`
+    ResolvedBy string `json:"resolved_by,omitempty"`
+    ResolvedAt string `json:"resolved_at,omitempty"`
+}
+
+// -------------------------------------------------------
+// type CommentThread
+// -------------------------------------------------------
+// Purpose:
+//   - A root comment with its replies, oldest first.
+// -------------------------------------------------------
+type CommentThread struct {
+    Comment
+    Replies []Comment `json:"replies"`
+}
+
+// commentSidecar is the on-disk form of a note's comments.
+type commentSidecar struct {
+    Path     string    `json:"path"`
+    Comments []Comment `json:"comments"`
+}
+
+// commentSidecarName maps a note path to its sidecar file.
+func commentSidecarName(rel string) string {
+    sum := sha256.Sum256([]byte(rel))
+    return filepath.Join(commentsDirName, hex.EncodeToString(sum[:])+".json")
+}
+
+// -------------------------------------------------------
+// func loadCommentsLocked(ctx context.Context, rel string) []Comment
+// -------------------------------------------------------
+// Purpose:
+//   - Comments of one note. Caller holds commentsMu.
+// -------------------------------------------------------
+func loadCommentsLocked(ctx context.Context, rel string) []Comment {
+    var sidecar commentSidecar
+    if err := loadMetaJSON(ctx, commentSidecarName(rel), &sidecar); err != nil {
+        logError(ctx, "Failed to load comments for "+rel+": "+err.Error())
+    }
+    if sidecar.Comments == nil {
+        return []Comment{}
+    }
+    return sidecar.Comments
+}
+
+// saveCommentsLocked writes the sidecar of rel. Caller holds commentsMu.
+func saveCommentsLocked(ctx context.Context, rel string, comments []Comment) error {
+    defer touchListing(rel)
+    return saveMetaJSON(ctx, commentSidecarName(rel), commentSidecar{Path: rel, Comments: comments})
+}
+
+// -------------------------------------------------------
+// func unresolvedComments(ctx context.Context, rel string) int
+// -------------------------------------------------------
+// Purpose:
+//   - Number of unresolved threads on a note.
+// -------------------------------------------------------
+func unresolvedComments(ctx context.Context, rel string) int {
+    if _, err := serverFrom(ctx).Storage.Lstat(metaPath(ctx, commentSidecarName(rel))); err != nil {
+        return 0
+    }
+    commentsMu.Lock()
+    defer commentsMu.Unlock()
+    count := 0
+    for _, c := range loadCommentsLocked(ctx, rel) {
+        if c.ParentID == "" && !c.Resolved {
+            count++
+        }
+    }
+    return count
+}
+
+// -------------------------------------------------------
+// func commentsRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Move a note's comment sidecar along with it.
+// -------------------------------------------------------
+func commentsRename(ctx context.Context, from, to string) {
+    commentsMu.Lock()
+    defer commentsMu.Unlock()
+    comments := loadCommentsLocked(ctx, from)
+    if len(comments) == 0 {
+        return
+    }
+    if err := saveCommentsLocked(ctx, to, comments); err != nil {
+        logError(ctx, "Failed to move comments "+from+" -> "+to+": "+err.Error())
+        return
+    }
+    serverFrom(ctx).Storage.Remove(metaPath(ctx, commentSidecarName(from)))
+}
+
+// -------------------------------------------------------
+// func commentThreads(comments []Comment) []CommentThread
+// -------------------------------------------------------
+// Purpose:
+//   - Group a flat comment list into threads.
+// -------------------------------------------------------
+func commentThreads(comments []Comment) []CommentThread {
+    threads := []CommentThread{}
+    position := map[string]int{}
+    for _, c := range comments {
+        if c.ParentID == "" {
+            position[c.ID] = len(threads)
+            threads = append(threads, CommentThread{Comment: c, Replies: []Comment{}})
+        }
+    }
+    for _, c := range comments {
+        if i, ok := position[c.ParentID]; ok {
+            threads[i].Replies = append(threads[i].Replies, c)
+        }
+    }
+    return threads
+}
+
+// -------------------------------------------------------
+// func auditComment(r, event, actor, target, detail)
+// -------------------------------------------------------
+// Purpose:
+//   - Write a comment audit event.
+// -------------------------------------------------------
+func auditComment(r *http.Request, event string, actor string, target string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actor,
+        Target:   target,
+        Detail:   detail,
+    })
+}
+
+// -------------------------------------------------------
+// func HandleComments(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET ?path=: comment threads of a note.
+//   - POST {"path", "body", "line", "parent_id"}: add a comment or
+//     a reply.
+// Audit:
+//   - Always returns an array of threads ([] when none).
+// -------------------------------------------------------
+func HandleComments(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        absPath := sanitizePath(r.Context(), r.URL.Query().Get("path"))
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        commentsMu.Lock()
+        comments := loadCommentsLocked(r.Context(), relativeTo(r.Context(), absPath))
+        commentsMu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(commentThreads(comments))
+
+    case http.MethodPost:
+        handleCommentAdd(w, r)
+
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func handleCommentAdd(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/comments: validate and store one comment.
+// Audit:
+//   - line must fall within the note's current line count.
+// -------------------------------------------------------
+func handleCommentAdd(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        Path     string `json:"path"`
+        Body     string `json:"body"`
+        Line     int    `json:"line"`
+        ParentID string `json:"parent_id"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    req.Body = strings.TrimSpace(req.Body)
+    if req.Body == "" || len(req.Body) > maxCommentBytes {
+        apierror.Write(w, r, apierror.CodeInvalidField, "body", fmt.Sprintf("Bad request: body must be 1-%d bytes", maxCommentBytes))
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    content, err := readFile(r.Context(), absPath)
+    if os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "read file for comment: "+absPath, "Internal error")
+        return
+    }
+    if lines := len(splitLines(string(content))); req.Line < 0 || req.Line > lines {
+        apierror.Write(w, r, apierror.CodeInvalidField, "line", fmt.Sprintf("Bad request: line must be 0-%d", lines))
+        return
+    }
+
+    commentsMu.Lock()
+    defer commentsMu.Unlock()
+
+    comments := loadCommentsLocked(r.Context(), rel)
+    if req.ParentID != "" {
+        found := false
+        for _, c := range comments {
+            if c.ID == req.ParentID && c.ParentID == "" {
+                found = true
+            }
+        }
+        if !found {
+            apierror.Write(w, r, apierror.CodeInvalidField, "parent_id", "Bad request: parent_id must name a thread on this note")
+            return
+        }
+    }
+
+    comment := Comment{
+        ID:        newStampID(r.Context()),
+        ParentID:  req.ParentID,
+        Author:    user.Name,
+        Body:      req.Body,
+        Line:      req.Line,
+        CreatedAt: utcNow(r.Context()),
+    }
+    comments = append(comments, comment)
+    if err := saveCommentsLocked(r.Context(), rel, comments); err != nil {
+        writeStorageError(w, r, err, "save comments", "Comment failed")
+        return
+    }
+
+    logInfo(r.Context(), "Comment "+comment.ID+" on "+rel+" by "+user.Name)
+    auditComment(r, "comment.add", user.Name, rel, fmt.Sprintf("id=%s parent=%s line=%d", comment.ID, comment.ParentID, comment.Line))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(comment)
+}
+
+// -------------------------------------------------------
+// func HandleCommentResolve(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/comments/resolve {"path", "id", "resolved"}: mark
+//     a thread resolved (or reopen it with "resolved": false).
+// -------------------------------------------------------
+func HandleCommentResolve(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        Path     string `json:"path"`
+        ID       string `json:"id"`
+        Resolved *bool  `json:"resolved"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) || !requireField(w, r, "id", req.ID) {
+        return
+    }
+    resolved := req.Resolved == nil || *req.Resolved
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    commentsMu.Lock()
+    defer commentsMu.Unlock()
+
+    comments := loadCommentsLocked(r.Context(), rel)
+    index := -1
+    for i, c := range comments {
+        if c.ID == req.ID && c.ParentID == "" {
+            index = i
+        }
+    }
+    if index < 0 {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Comment thread not found")
+        return
+    }
+
+    c := &comments[index]
+    c.Resolved = resolved
+    c.ResolvedBy, c.ResolvedAt = "", ""
+    if resolved {
+        c.ResolvedBy, c.ResolvedAt = user.Name, utcNow(r.Context())
+    }
+    if err := saveCommentsLocked(r.Context(), rel, comments); err != nil {
+        writeStorageError(w, r, err, "save comments", "Resolve failed")
+        return
+    }
+
+    auditComment(r, "comment.resolve", user.Name, rel, fmt.Sprintf("id=%s resolved=%t", c.ID, resolved))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(*c)
+}
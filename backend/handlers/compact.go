@@ -0,0 +1,474 @@
+// -------------------------------------------------------
+// backend/handlers/compact.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Storage report and compaction for the small data volume:
+//     note versions (revision store), find-and-replace snapshots,
+//     backups, trash and the thumbnail cache.
+//       GET  /admin/compact   report: what is stored, how well the
+//                             revision store deduplicates, and what
+//                             a compaction would reclaim
+//       POST /admin/compact   compact now and report what was freed
+//   - Also runs every compact.interval, and as the "compact" job
+//     kind of /admin/jobs.
+// Audit:
+//   - Only what is past its retention goes (see config.CompactConfig;
+//     all limits default to keeping everything):
+//       revisions  content last saved more than revision_days ago
+//                  that is no note's current content, including
+//                  versions no journal entry refers to
+//       snapshots  replace snapshots older than snapshot_days
+//       backups    archives beyond the keep_backups newest, and
+//                  *.partial files left by a crash over a day ago
+//       trash      items past trash_retention (as the hourly sweep)
+//       thumbnails cached thumbnails unused for thumbnailIdleDays
+//                  (thumbnails.go; regenerated on demand)
+//   - Anything naming a path under legal hold is kept.
+//   - Dropping a revision ends asOf reads that need it (404).
+//   - POST and scheduled runs write one "admin.compact" event with
+//     the counts and bytes reclaimed per category.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    compactIdlePeriod   = 10 * time.Minute
+    compactTimeout      = 30 * time.Minute
+    compactPartialGrace = 24 * time.Hour
+)
+
+// -------------------------------------------------------
+// type CompactCategory / CompactDedup / CompactReport
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes of /admin/compact.
+// Audit:
+//   - Items/Bytes is what is stored before this run; Collectable
+//     what retention allows to remove; Removed/Reclaimed what was
+//     removed (0 for a report).
+//   - LogicalBytes counts every journaled save at its full size;
+//     StoredBytes is what the revision store holds on disk
+//     (deduplicated and compressed).
+// -------------------------------------------------------
+type CompactCategory struct {
+    Name        string `json:"name"`
+    Items       int    `json:"items"`
+    Bytes       int64  `json:"bytes"`
+    Collectable int    `json:"collectable"`
+    Removed     int    `json:"removed"`
+    Reclaimed   int64  `json:"reclaimed_bytes"`
+    Kept        string `json:"kept,omitempty"`
+}
+
+type CompactDedup struct {
+    Saves          int     `json:"saves"`
+    UniqueContents int     `json:"unique_contents"`
+    Unreferenced   int     `json:"unreferenced"`
+    LogicalBytes   int64   `json:"logical_bytes"`
+    StoredBytes    int64   `json:"stored_bytes"`
+    Ratio          float64 `json:"ratio"`
+}
+
+type CompactReport struct {
+    At         string            `json:"at"`
+    DryRun     bool              `json:"dry_run"`
+    Categories []CompactCategory `json:"categories"`
+    Dedup      CompactDedup      `json:"dedup"`
+    Removed    int               `json:"removed"`
+    Reclaimed  int64             `json:"reclaimed_bytes"`
+}
+
+// compactCandidate is one removable item of a category.
+type compactCandidate struct {
+    path  string
+    bytes int64
+}
+
+// heldCache answers isHeld once per path during a run.
+type heldCache map[string]bool
+
+func (c heldCache) held(ctx context.Context, rel string) bool {
+    held, ok := c[rel]
+    if !ok {
+        held = isHeld(ctx, rel)
+        c[rel] = held
+    }
+    return held
+}
+
+// -------------------------------------------------------
+// func compactRevisions(ctx, now, days, held, report) ([]compactCandidate, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Measure the revision store and pick the revisions past
+//     retention.
+// Audit:
+//   - A revision's age counts from the later of its file's
+//     modification time and the newest journal entry saving it.
+//   - Current content (index hash) and content ever saved under a
+//     held path are never candidates.
+// -------------------------------------------------------
+func compactRevisions(ctx context.Context, now time.Time, days int, held heldCache, report *CompactReport) ([]compactCandidate, error) {
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        return nil, err
+    }
+    lastSaved := map[string]string{}
+    heldContent := map[string]bool{}
+    for _, entry := range entries {
+        if entry.SHA256 == "" {
+            continue
+        }
+        report.Dedup.Saves++
+        report.Dedup.LogicalBytes += entry.Size
+        if entry.At > lastSaved[entry.SHA256] {
+            lastSaved[entry.SHA256] = entry.At
+        }
+        if held.held(ctx, entry.Path) {
+            heldContent[entry.SHA256] = true
+        }
+    }
+    current := map[string]bool{}
+    for _, entry := range indexSnapshot(ctx) {
+        current[entry.SHA256] = true
+    }
+
+    category := CompactCategory{Name: "revisions", Kept: "forever"}
+    if days > 0 {
+        category.Kept = fmt.Sprintf("%d days after the last save", days)
+    }
+    cutoff := now.AddDate(0, 0, -days)
+    candidates := []compactCandidate{}
+    err = serverFrom(ctx).Storage.Walk(metaPath(ctx, revisionsDir), func(path string, info os.FileInfo, err error) error {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if ctxErr := ctx.Err(); ctxErr != nil {
+            return ctxErr
+        }
+        if !info.Mode().IsRegular() || !strings.HasSuffix(info.Name(), ".gz") {
+            return nil
+        }
+        sha := strings.TrimSuffix(info.Name(), ".gz")
+        category.Items++
+        category.Bytes += info.Size()
+        saved, referenced := lastSaved[sha]
+        if !referenced {
+            report.Dedup.Unreferenced++
+        }
+        if days == 0 || current[sha] || heldContent[sha] || info.ModTime().After(cutoff) {
+            return nil
+        }
+        if referenced && saved > cutoff.UTC().Format("2006-01-02T15:04:05Z") {
+            return nil
+        }
+        candidates = append(candidates, compactCandidate{path: path, bytes: info.Size()})
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    report.Dedup.UniqueContents = category.Items
+    report.Dedup.StoredBytes = category.Bytes
+    if category.Bytes > 0 {
+        report.Dedup.Ratio = float64(report.Dedup.LogicalBytes) / float64(category.Bytes)
+    }
+    category.Collectable = len(candidates)
+    report.Categories = append(report.Categories, category)
+    return candidates, nil
+}
+
+// -------------------------------------------------------
+// func compactSnapshots(ctx, now, days, held, report) ([]compactCandidate, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Measure replace snapshots and pick those past retention.
+// -------------------------------------------------------
+func compactSnapshots(ctx context.Context, now time.Time, days int, held heldCache, report *CompactReport) ([]compactCandidate, error) {
+    snapshots, err := listReplaceSnapshots(ctx)
+    if err != nil {
+        return nil, err
+    }
+    category := CompactCategory{Name: "snapshots", Kept: "forever"}
+    if days > 0 {
+        category.Kept = fmt.Sprintf("%d days", days)
+    }
+    cutoff := now.AddDate(0, 0, -days).UTC().Format("2006-01-02T15:04:05Z")
+    candidates := []compactCandidate{}
+    for _, snapshot := range snapshots {
+        dir := metaPath(ctx, snapshotsDirName, snapshot.ID)
+        size := treeBytes(ctx, dir)
+        category.Items++
+        category.Bytes += size
+        if days == 0 || snapshot.At > cutoff {
+            continue
+        }
+        keep := false
+        for _, file := range snapshot.Files {
+            keep = keep || held.held(ctx, file.Path)
+        }
+        if !keep {
+            candidates = append(candidates, compactCandidate{path: dir, bytes: size})
+        }
+    }
+    category.Collectable = len(candidates)
+    report.Categories = append(report.Categories, category)
+    return candidates, nil
+}
+
+// -------------------------------------------------------
+// func compactBackups(dir, now, keep, report) ([]compactCandidate, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Measure the backup directory and pick archives beyond the
+//     keep newest, plus stale *.partial files.
+// -------------------------------------------------------
+func compactBackups(dir string, now time.Time, keep int, report *CompactReport) ([]compactCandidate, error) {
+    category := CompactCategory{Name: "backups", Kept: "all"}
+    if keep > 0 {
+        category.Kept = fmt.Sprintf("newest %d", keep)
+    }
+    entries, err := ioutil.ReadDir(dir)
+    if err != nil && !os.IsNotExist(err) {
+        return nil, err
+    }
+    archives := []os.FileInfo{}
+    candidates := []compactCandidate{}
+    for _, entry := range entries {
+        if !entry.Mode().IsRegular() || !strings.HasPrefix(entry.Name(), "scratchpad-") {
+            continue
+        }
+        category.Items++
+        category.Bytes += entry.Size()
+        switch {
+        case strings.HasSuffix(entry.Name(), ".tar.gz"):
+            archives = append(archives, entry)
+        case strings.HasSuffix(entry.Name(), ".partial") && now.Sub(entry.ModTime()) > compactPartialGrace:
+            candidates = append(candidates, compactCandidate{path: filepath.Join(dir, entry.Name()), bytes: entry.Size()})
+        }
+    }
+    sort.Slice(archives, func(i, j int) bool { return archives[i].Name() > archives[j].Name() })
+    if keep > 0 && len(archives) > keep {
+        for _, archive := range archives[keep:] {
+            candidates = append(candidates, compactCandidate{path: filepath.Join(dir, archive.Name()), bytes: archive.Size()})
+        }
+    }
+    category.Collectable = len(candidates)
+    report.Categories = append(report.Categories, category)
+    return candidates, nil
+}
+
+// treeBytes sums the sizes of the regular files under dir.
+func treeBytes(ctx context.Context, dir string) int64 {
+    var total int64
+    serverFrom(ctx).Storage.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err == nil && info.Mode().IsRegular() {
+            total += info.Size()
+        }
+        return nil
+    })
+    return total
+}
+
+// -------------------------------------------------------
+// func RunCompaction(ctx, dryRun) (CompactReport, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Report storage use and, unless dryRun, remove everything past
+//     retention.
+// Audit:
+//   - Revisions are removed under revisionsMu after re-checking
+//     their modification time, so content saved again meanwhile is
+//     kept.
+//   - A failed removal is logged and the run continues.
+// -------------------------------------------------------
+func RunCompaction(ctx context.Context, dryRun bool) (CompactReport, error) {
+    cfg := currentConfig(ctx)
+    now := timeNow(ctx)
+    report := CompactReport{At: now.UTC().Format("2006-01-02T15:04:05Z"), DryRun: dryRun, Categories: []CompactCategory{}}
+    held := heldCache{}
+
+    revisions, err := compactRevisions(ctx, now, cfg.Compact.RevisionDays, held, &report)
+    if err != nil {
+        return report, err
+    }
+    snapshots, err := compactSnapshots(ctx, now, cfg.Compact.SnapshotDays, held, &report)
+    if err != nil {
+        return report, err
+    }
+    backups, err := compactBackups(cfg.BackupDir, now, cfg.Compact.KeepBackups, &report)
+    if err != nil {
+        return report, err
+    }
+    trash, err := listTrash(ctx)
+    if err != nil {
+        return report, err
+    }
+    trashCategory := CompactCategory{Name: "trash", Kept: "per trash_retention"}
+    for _, item := range trash {
+        trashCategory.Items++
+        trashCategory.Bytes += item.Bytes
+        if expires, ok := trashExpiry(cfg, item); ok && !item.Held && !expires.After(now) {
+            trashCategory.Collectable++
+        }
+    }
+    report.Categories = append(report.Categories, trashCategory)
+    thumbnails, err := compactThumbnails(ctx, now, &report)
+    if err != nil {
+        return report, err
+    }
+    if dryRun {
+        return report, nil
+    }
+
+    // Backups live outside the scratch root and are removed with os;
+    // everything else goes through the Server's Storage.
+    store := serverFrom(ctx).Storage
+    cutoff := now.AddDate(0, 0, -cfg.Compact.RevisionDays)
+    remove := func(index int, candidates []compactCandidate, revision bool, removeAll func(string) error) {
+        for _, candidate := range candidates {
+            if revision {
+                revisionsMu.Lock()
+                info, statErr := store.Lstat(candidate.path)
+                if statErr != nil || info.ModTime().After(cutoff) {
+                    revisionsMu.Unlock()
+                    continue
+                }
+            }
+            err := removeAll(candidate.path)
+            if revision {
+                revisionsMu.Unlock()
+            }
+            if err != nil {
+                logError(ctx, "Compaction failed to remove "+candidate.path+": "+err.Error())
+                continue
+            }
+            report.Categories[index].Removed++
+            report.Categories[index].Reclaimed += candidate.bytes
+        }
+    }
+    remove(0, revisions, true, store.RemoveAll)
+    remove(1, snapshots, false, store.RemoveAll)
+    remove(2, backups, false, os.RemoveAll)
+    purged, err := PurgeExpiredTrash(ctx)
+    if err != nil {
+        logError(ctx, "Compaction trash purge failed: "+err.Error())
+    }
+    for _, item := range purged {
+        report.Categories[3].Removed++
+        report.Categories[3].Reclaimed += item.Bytes
+    }
+    remove(4, thumbnails, false, store.RemoveAll)
+    for _, category := range report.Categories {
+        report.Removed += category.Removed
+        report.Reclaimed += category.Reclaimed
+    }
+    return report, nil
+}
+
+// compactDetail summarizes a run for the audit log.
+func compactDetail(report CompactReport) string {
+    parts := []string{}
+    for _, category := range report.Categories {
+        parts = append(parts, fmt.Sprintf("%s=%d/%dB", category.Name, category.Removed, category.Reclaimed))
+    }
+    return fmt.Sprintf("removed=%d reclaimed=%d %s", report.Removed, report.Reclaimed, strings.Join(parts, " "))
+}
+
+// -------------------------------------------------------
+// func HandleCompact(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: storage report with what compaction would reclaim.
+//   - POST: compact now.
+// -------------------------------------------------------
+func HandleCompact(w http.ResponseWriter, r *http.Request) {
+    dryRun := true
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        dryRun = false
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    report, err := RunCompaction(r.Context(), dryRun)
+    if err != nil {
+        writeStorageError(w, r, err, "compact storage", "Internal server error")
+        return
+    }
+    if !dryRun {
+        logInfo(r.Context(), "Compaction: "+compactDetail(report))
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "admin.compact",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Detail:   compactDetail(report),
+        })
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
+
+// -------------------------------------------------------
+// func RunCompactSchedule()
+// -------------------------------------------------------
+// Purpose:
+//   - Compact every compact.interval for the life of the process.
+// Audit:
+//   - Configuration is re-read each cycle; 0 disables the run,
+//     which is then re-examined every compactIdlePeriod.
+//   - Cycles are skipped while schedules are paused (maintenance
+//     mode).
+// -------------------------------------------------------
+func RunCompactSchedule(ctx context.Context) {
+    for {
+        interval := currentConfig(ctx).Compact.Interval.Std()
+        if interval <= 0 {
+            time.Sleep(compactIdlePeriod)
+            continue
+        }
+        time.Sleep(interval)
+        if SchedulesPaused() {
+            continue
+        }
+
+        ctx, cancel := context.WithTimeout(ctx, compactTimeout)
+        report, err := RunCompaction(ctx, false)
+        cancel()
+        if err != nil {
+            logError(ctx, "Scheduled compaction failed: "+err.Error())
+            continue
+        }
+        logInfo(ctx, "Scheduled compaction: "+compactDetail(report))
+        audit.Write(audit.Event{
+            Event:  "admin.compact",
+            Method: "SCHEDULE",
+            Path:   "/admin/compact",
+            Detail: compactDetail(report),
+        })
+    }
+}
@@ -0,0 +1,405 @@
+// -------------------------------------------------------
+// backend/handlers/conflicts.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Conflict copies: when two versions of a note diverge (sync
+//     pull, or a save whose base_sha256 is stale) the second version
+//     is written next to the note as "<name> (conflict <UTC>).<ext>"
+//     instead of overwriting it.
+//   - Outstanding conflicts are tracked in .scratchpad/conflicts.json:
+//       GET  /conflicts          list outstanding conflicts
+//       POST /conflicts/resolve  keep mine / keep theirs / merge
+// Audit:
+//   - Resolving never destroys a version: the conflict copy is moved
+//     to the trash, and the chosen content is saved to the note.
+//   - Writes "file.save_conflict" and "conflict.resolve" events
+//     (sync conflicts are audited as "sync.conflict" in sync.go).
+//   - Conflict copies whose file was removed by hand are dropped
+//     from the list.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const conflictsFile = "conflicts.json"
+
+// Where a conflict came from.
+const (
+    conflictSourceSync = "sync"
+    conflictSourceSave = "save"
+)
+
+// Resolution strategies for POST /conflicts/resolve.
+const (
+    resolveMine   = "mine"
+    resolveTheirs = "theirs"
+    resolveMerge  = "merge"
+)
+
+// conflictMu guards conflicts.json and serializes base-checked saves.
+var conflictMu sync.Mutex
+
+// -------------------------------------------------------
+// type Conflict
+// -------------------------------------------------------
+// Purpose:
+//   - One outstanding divergence of a note.
+// Audit:
+//   - Mine/Theirs name the files holding each side: for sync the
+//     local note is mine and the primary's copy theirs; for a stale
+//     save the rejected save (the copy) is mine.
+// -------------------------------------------------------
+type Conflict struct {
+    ID           string `json:"id"`
+    Path         string `json:"path"`
+    ConflictPath string `json:"conflict_path"`
+    Mine         string `json:"mine"`
+    Theirs       string `json:"theirs"`
+    Source       string `json:"source"`
+    CreatedAt    string `json:"created_at"`
+}
+
+// -------------------------------------------------------
+// func loadConflictsLocked() map[string]Conflict
+// -------------------------------------------------------
+// Purpose:
+//   - Read conflicts.json. Caller holds conflictMu.
+// -------------------------------------------------------
+func loadConflictsLocked(ctx context.Context) map[string]Conflict {
+    conflicts := map[string]Conflict{}
+    if err := loadMetaJSON(ctx, conflictsFile, &conflicts); err != nil {
+        logError(ctx, "Failed to load conflict list: "+err.Error())
+    }
+    if conflicts == nil {
+        conflicts = map[string]Conflict{}
+    }
+    return conflicts
+}
+
+// -------------------------------------------------------
+// func conflictName(rel string, at time.Time, n int) string
+// -------------------------------------------------------
+// Purpose:
+//   - Sibling name "<stem> (conflict <UTC>).<ext>" for a conflict.
+// Audit:
+//   - The timestamp uses ISO 8601 basic format (20240603T1000Z)
+//     because the filename policy forbids ':'; n > 1 adds a counter.
+// -------------------------------------------------------
+func conflictName(rel string, at time.Time, n int) string {
+    ext := path.Ext(rel)
+    stem := strings.TrimSuffix(rel, ext)
+    label := "conflict " + at.UTC().Format("20060102T1504Z")
+    if n > 1 {
+        label += fmt.Sprintf(" %d", n)
+    }
+    return stem + " (" + label + ")" + ext
+}
+
+// -------------------------------------------------------
+// func writeConflictCopy(ctx, rel, data, source) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Save data as a new conflict sibling of rel, record it as an
+//     outstanding conflict, and return the sibling's relative path.
+// Audit:
+//   - data is the version that lost the race (the primary's for
+//     sync, the stale save's for saves).
+// -------------------------------------------------------
+func writeConflictCopy(ctx context.Context, rel string, data []byte, source string) (string, error) {
+    conflictMu.Lock()
+    defer conflictMu.Unlock()
+    return writeConflictCopyLocked(ctx, rel, data, source)
+}
+
+// writeConflictCopyLocked is writeConflictCopy for callers that
+// already hold conflictMu.
+func writeConflictCopyLocked(ctx context.Context, rel string, data []byte, source string) (string, error) {
+    now := timeNow(ctx)
+    for n := 1; n < 100; n++ {
+        name := conflictName(rel, now, n)
+        absPath, ok := notePathForWrite(ctx, name)
+        if !ok {
+            return "", fmt.Errorf("conflict name rejected by policy: %s", name)
+        }
+        if _, err := statPath(ctx, absPath); err == nil {
+            continue
+        }
+        if err := writeFile(ctx, absPath, data); err != nil {
+            return "", err
+        }
+        indexUpdate(ctx, name, data)
+        journalPutEntry(ctx, name, data)
+
+        conflict := Conflict{
+            ID:           newStampID(ctx),
+            Path:         rel,
+            ConflictPath: name,
+            Mine:         rel,
+            Theirs:       name,
+            Source:       source,
+            CreatedAt:    utcNow(ctx),
+        }
+        if source == conflictSourceSave {
+            conflict.Mine, conflict.Theirs = name, rel
+        }
+        conflicts := loadConflictsLocked(ctx)
+        conflicts[conflict.ID] = conflict
+        if err := saveMetaJSON(ctx, conflictsFile, conflicts); err != nil {
+            logError(ctx, "Failed to record conflict for "+rel+": "+err.Error())
+        }
+        return name, nil
+    }
+    return "", fmt.Errorf("too many conflict copies for %s", rel)
+}
+
+// -------------------------------------------------------
+// func saveWithBase(ctx, rel, absPath, content, base) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Save content only if the note still has hash base; otherwise
+//     write it as a conflict copy and return the copy's path.
+// Audit:
+//   - A missing note is simply (re)created.
+//   - Check and write happen under conflictMu, so two base-checked
+//     saves of the same version cannot both win.
+// -------------------------------------------------------
+func saveWithBase(ctx context.Context, rel string, absPath string, content []byte, base string) (string, error) {
+    conflictMu.Lock()
+    defer conflictMu.Unlock()
+
+    current, err := readFile(ctx, absPath)
+    if err == nil && contentHash(current) != base {
+        return writeConflictCopyLocked(ctx, rel, content, conflictSourceSave)
+    }
+    if err != nil && !os.IsNotExist(err) {
+        return "", err
+    }
+    return "", writeFile(ctx, absPath, content)
+}
+
+// -------------------------------------------------------
+// func writeSaveConflict(w, r, rel, conflictPath)
+// -------------------------------------------------------
+// Purpose:
+//   - 409 response for a save that lost to a concurrent edit.
+// -------------------------------------------------------
+func writeSaveConflict(w http.ResponseWriter, r *http.Request, rel string, conflictPath string) {
+    logInfo(r.Context(), "Save conflict: "+rel+" changed since it was loaded; saved as "+conflictPath)
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.save_conflict",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusConflict,
+        Target:   rel,
+        Detail:   "saved as " + conflictPath,
+    })
+    apierror.WriteDetails(w, r, apierror.CodeConflict, "", "note changed since it was loaded",
+        map[string]interface{}{"path": rel, "conflict_path": conflictPath})
+}
+
+// -------------------------------------------------------
+// func HandleConflicts(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /conflicts: outstanding conflicts, oldest first.
+// Audit:
+//   - Always returns an array ([] when none).
+// -------------------------------------------------------
+func HandleConflicts(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    conflictMu.Lock()
+    conflicts := loadConflictsLocked(r.Context())
+    pruned := false
+    for id, c := range conflicts {
+        if _, err := statPath(r.Context(), sanitizePath(r.Context(), c.ConflictPath)); os.IsNotExist(err) {
+            delete(conflicts, id)
+            pruned = true
+        }
+    }
+    if pruned {
+        if err := saveMetaJSON(r.Context(), conflictsFile, conflicts); err != nil {
+            logError(r.Context(), "Failed to prune conflict list: "+err.Error())
+        }
+    }
+    conflictMu.Unlock()
+
+    list := make([]Conflict, 0, len(conflicts))
+    for _, c := range conflicts {
+        list = append(list, c)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// -------------------------------------------------------
+// func HandleConflictResolve(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /conflicts/resolve {"id", "strategy", "content"}:
+//       mine   - keep the "mine" version at the note's path
+//       theirs - keep the "theirs" version at the note's path
+//       merge  - save content (required) at the note's path
+//     The conflict copy then moves to the trash.
+// Audit:
+//   - Merged content goes through the save processors and the
+//     content policy, as on POST /file/save. Like a save, any
+//     resolution that changes a signed note is audited
+//     (flagSignedChange).
+//   - Writes "conflict.resolve" with the strategy and trash id.
+// -------------------------------------------------------
+func HandleConflictResolve(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        ID       string          `json:"id"`
+        Strategy string          `json:"strategy"`
+        Content  json.RawMessage `json:"content"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "id", req.ID) {
+        return
+    }
+    switch req.Strategy {
+    case resolveMine, resolveTheirs:
+    case resolveMerge:
+        if len(req.Content) == 0 {
+            apierror.Write(w, r, apierror.CodeMissingField, "content", "Bad request: merge requires content")
+            return
+        }
+    default:
+        apierror.Write(w, r, apierror.CodeInvalidField, "strategy", "Bad request: strategy must be mine, theirs, or merge")
+        return
+    }
+
+    conflictMu.Lock()
+    defer conflictMu.Unlock()
+
+    conflicts := loadConflictsLocked(r.Context())
+    c, ok := conflicts[req.ID]
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Conflict not found")
+        return
+    }
+    notePath := sanitizePath(r.Context(), c.Path)
+    copyPath := sanitizePath(r.Context(), c.ConflictPath)
+    if notePath == "" || copyPath == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, notePath) || rejectIfApproved(w, r, notePath) {
+        return
+    }
+
+    ctx := r.Context()
+    var content []byte
+    switch req.Strategy {
+    case resolveMerge:
+        raw, err := decodeRawJSONString(req.Content)
+        if err != nil {
+            apierror.Write(w, r, apierror.CodeInvalidField, "content", "Bad request: "+err.Error())
+            return
+        }
+        if offset := firstInvalidUTF8(raw); offset >= 0 {
+            writeInvalidUTF8(w, r, c.Path, offset)
+            return
+        }
+        content = raw
+        if normalizeEOLEnabled(ctx) {
+            content = []byte(normalizeLineEndings(string(raw)))
+        }
+        content, err = processContent(ctx, hookSave, c.Path, content)
+        if err != nil {
+            writeProcessorError(w, r, c.Path, err)
+            return
+        }
+        if rejectIfDangerous(w, r, c.Path, content) {
+            return
+        }
+    default:
+        keep := c.Mine
+        if req.Strategy == resolveTheirs {
+            keep = c.Theirs
+        }
+        if keep != c.Path {
+            data, err := readFile(ctx, sanitizePath(ctx, keep))
+            if err != nil {
+                writeStorageError(w, r, err, "read conflict version: "+keep, "Resolve failed")
+                return
+            }
+            content = data
+        }
+    }
+
+    if content != nil {
+        err := saveLedger(ctx, c.Path, notePath, content)
+        if ledgerErr, ok := err.(*LedgerError); ok {
+            writeLedgerViolation(w, r, ledgerErr)
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "write resolved note: "+notePath, "Resolve failed")
+            return
+        }
+        indexUpdate(ctx, c.Path, content)
+        journalPutEntry(ctx, c.Path, content)
+        flagSignedChange(r, c.Path, content)
+    }
+
+    trashID := ""
+    if _, err := statPath(ctx, copyPath); err == nil {
+        item, err := moveToTrash(ctx, copyPath, "file")
+        if err != nil {
+            writeStorageError(w, r, err, "trash conflict copy: "+copyPath, "Resolve failed")
+            return
+        }
+        trashID = item.ID
+    }
+
+    delete(conflicts, c.ID)
+    if err := saveMetaJSON(ctx, conflictsFile, conflicts); err != nil {
+        logError(ctx, "Failed to update conflict list: "+err.Error())
+    }
+
+    logInfo(ctx, "Resolved conflict "+c.ID+" on "+c.Path+" ("+req.Strategy+")")
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "conflict.resolve",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   c.Path,
+        Detail:   fmt.Sprintf("id=%s strategy=%s source=%s copy_trash_id=%s", c.ID, req.Strategy, c.Source, trashID),
+    })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "id":            c.ID,
+        "path":          c.Path,
+        "strategy":      req.Strategy,
+        "copy_trash_id": trashID,
+    })
+}
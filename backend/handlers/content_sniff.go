@@ -0,0 +1,165 @@
+// -------------------------------------------------------
+// backend/handlers/content_sniff.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Content-based checks on note content, whatever the extension:
+//     a .txt that is really an executable, or HTML that would run
+//     script if a browser ever rendered it, is refused on save.
+//   - The headers every note and attachment is served with, so the
+//     browser never executes user content.
+// Audit:
+//   - Policy per folder: config content_policy (config.ContentPolicy);
+//     the default refuses both kinds and serves notes inline.
+//   - Executables are recognised by their headers (PE, ELF, Mach-O,
+//     Java class, WebAssembly); active HTML by script, frame and
+//     object tags, event handler attributes and javascript:/
+//     vbscript:/data:text/html URLs in attributes or as Markdown
+//     link targets.
+//   - Checked on every note write: /file/save, conflict merges,
+//     /files/replace, /file/split, /file/concat, PATCH /tasks,
+//     /file/import and /file/fix-encoding. A refusal is 422
+//     invalid_content with details.kind and audited as
+//     "file.content_blocked".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "mime"
+    "net/http"
+    "path"
+    "regexp"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// Kinds of dangerous content.
+const (
+    contentKindExecutable = "executable"
+    contentKindActiveHTML = "active_html"
+)
+
+// executableMagic are file headers of native and VM executables.
+var executableMagic = []struct {
+    magic []byte
+    name  string
+}{
+    {[]byte("\x7fELF"), "ELF executable"},
+    {[]byte{0xfe, 0xed, 0xfa, 0xce}, "Mach-O executable"},
+    {[]byte{0xfe, 0xed, 0xfa, 0xcf}, "Mach-O executable"},
+    {[]byte{0xce, 0xfa, 0xed, 0xfe}, "Mach-O executable"},
+    {[]byte{0xcf, 0xfa, 0xed, 0xfe}, "Mach-O executable"},
+    {[]byte{0xca, 0xfe, 0xba, 0xbe}, "Java class or Mach-O universal binary"},
+    {[]byte("\x00asm"), "WebAssembly module"},
+}
+
+var (
+    activeHTMLTag     = regexp.MustCompile(`(?i)<\s*(script|iframe|frame|frameset|object|embed|applet|base)\b`)
+    activeHTMLRefresh = regexp.MustCompile(`(?i)<\s*meta\b[^>]*http-equiv\s*=\s*["']?\s*refresh`)
+    activeHTMLHandler = regexp.MustCompile(`(?i)<\s*[a-z][a-z0-9-]*\b[^>]*[\s"'/]on[a-z]+\s*=`)
+    activeHTMLURL     = regexp.MustCompile(`(?i)<[^>]*\b(href|src|action|formaction|xlink:href|data)\s*=\s*["']?\s*(javascript|vbscript|data\s*:\s*text/html)`)
+    // activeMarkdownLink catches the same URLs as Markdown link
+    // targets, inline "[text](url)" or reference "[label]: url".
+    activeMarkdownLink = regexp.MustCompile(`(?im)(?:\]\(|^[ \t]{0,3}\[[^\]\n]+\]:)[ \t]*<?[ \t]*(javascript[ \t]*:|vbscript[ \t]*:|data[ \t]*:[ \t]*text/html)`)
+)
+
+// -------------------------------------------------------
+// func sniffDangerousContent(content []byte) (string, string)
+// -------------------------------------------------------
+// Purpose:
+//   - The kind of dangerous content found ("" when none) and what
+//     gave it away.
+// Audit:
+//   - A PE file ("MZ") counts only when its header points at a
+//     "PE" signature, so text that starts with "MZ" passes.
+// -------------------------------------------------------
+func sniffDangerousContent(content []byte) (string, string) {
+    for _, exe := range executableMagic {
+        if bytes.HasPrefix(content, exe.magic) {
+            return contentKindExecutable, exe.name
+        }
+    }
+    if len(content) >= 64 && bytes.HasPrefix(content, []byte("MZ")) {
+        offset := int(binary.LittleEndian.Uint32(content[60:64]))
+        if offset >= 64 && offset+4 <= len(content) && bytes.Equal(content[offset:offset+4], []byte("PE\x00\x00")) {
+            return contentKindExecutable, "Windows executable"
+        }
+    }
+    for _, check := range []struct {
+        pattern *regexp.Regexp
+        what    string
+    }{
+        {activeHTMLTag, "an HTML %s tag"},
+        {activeHTMLRefresh, "an HTML meta refresh"},
+        {activeHTMLHandler, "an HTML event handler attribute"},
+        {activeHTMLURL, "a script URL in an HTML %s attribute"},
+        {activeMarkdownLink, "a %s URL in a Markdown link"},
+    } {
+        if match := check.pattern.FindSubmatch(content); match != nil {
+            if len(match) > 1 {
+                return contentKindActiveHTML, fmt.Sprintf(check.what, bytes.ToLower(match[1]))
+            }
+            return contentKindActiveHTML, check.what
+        }
+    }
+    return "", ""
+}
+
+// -------------------------------------------------------
+// func rejectIfDangerous(w, r, rel, content) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Refuse content the folder's policy does not allow; answers
+//     the request and returns true when refused.
+// -------------------------------------------------------
+func rejectIfDangerous(w http.ResponseWriter, r *http.Request, rel string, content []byte) bool {
+    ctx := r.Context()
+    kind, reason := sniffDangerousContent(content)
+    policy := currentConfig(ctx).ContentPolicyFor(rel)
+    if kind == "" || kind == contentKindExecutable && policy.AllowExecutable || kind == contentKindActiveHTML && policy.AllowActiveHTML {
+        return false
+    }
+    logError(ctx, fmt.Sprintf("Refused %s content for %s: %s", kind, rel, reason))
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "file.content_blocked",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   apierror.Status(apierror.CodeInvalidContent),
+        Actor:    actorName(ctx),
+        Target:   rel,
+        Detail:   fmt.Sprintf("kind=%s reason=%q bytes=%d sha256=%s", kind, reason, len(content), contentHash(content)),
+    })
+    apierror.WriteDetails(w, r, apierror.CodeInvalidContent, "content", "Content refused: "+reason,
+        map[string]interface{}{"kind": kind})
+    return true
+}
+
+// -------------------------------------------------------
+// func setUserContentHeaders(w, r, rel, contentType, download)
+// -------------------------------------------------------
+// Purpose:
+//   - Headers for serving stored user content: the declared type
+//     with nosniff, a sandboxing Content-Security-Policy, and a
+//     Content-Disposition naming the file.
+// Audit:
+//   - Set on every response, whatever security_headers says: these
+//     are what keep a stored .html or script inert.
+//   - download forces "attachment"; otherwise the folder's
+//     content_policy disposition applies (default inline).
+// -------------------------------------------------------
+func setUserContentHeaders(w http.ResponseWriter, r *http.Request, rel string, contentType string, download bool) {
+    disposition := "inline"
+    if download || currentConfig(r.Context()).ContentPolicyFor(rel).Disposition == "attachment" {
+        disposition = "attachment"
+    }
+    h := w.Header()
+    h.Set("Content-Type", contentType)
+    h.Set("X-Content-Type-Options", "nosniff")
+    h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+    h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(rel)}))
+}
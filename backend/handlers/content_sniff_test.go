@@ -0,0 +1,67 @@
+// -------------------------------------------------------
+// backend/handlers/content_sniff_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that script URLs in Markdown links count as active
+//     content, and that the content policy holds on every note
+//     write, not only /file/save.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "net/http"
+    "os"
+    "testing"
+)
+
+func TestSniffMarkdownScriptLinks(t *testing.T) {
+    for _, tc := range []struct {
+        content string
+        kind    string
+    }{
+        {"[pay now](javascript:alert(1))", contentKindActiveHTML},
+        {"[pay now]( JavaScript :alert(1))", contentKindActiveHTML},
+        {"[pay now](<javascript:alert(1)>)", contentKindActiveHTML},
+        {"[memo]: vbscript:msgbox", contentKindActiveHTML},
+        {"[x](data:text/html,<b>hi</b>)", contentKindActiveHTML},
+        {"[memo](https://example.com/javascript:notes)", ""},
+        {"See javascript: the language.", ""},
+        {"[report](close/q1.md)", ""},
+    } {
+        if kind, reason := sniffDangerousContent([]byte(tc.content)); kind != tc.kind {
+            t.Errorf("sniffDangerousContent(%q) = %q (%s), want %q", tc.content, kind, reason, tc.kind)
+        }
+    }
+}
+
+func TestContentPolicyOnEveryWrite(t *testing.T) {
+    const root = "/cfo-scratchpad-snifftest"
+    store := NewMemStorage(root)
+    srv := NewServer(root, nil, store, nil, nil)
+    store.MkdirAll(root + "/close")
+    store.WriteFile(root+"/close/a.md", []byte("# One\n[pay](javascript:alert(1))\n# Two\n- [ ] approve\n"))
+    store.WriteFile(root+"/close/b.md", []byte("fine\n"))
+
+    for _, tc := range []struct {
+        name    string
+        handler http.HandlerFunc
+        method  string
+        target  string
+        body    string
+    }{
+        {"concat", HandleFileConcat, "POST", "/file/concat", `{"paths":["close/a.md","close/b.md"],"target":"close/all.md"}`},
+        {"split", HandleFileSplit, "POST", "/file/split", `{"path":"close/a.md","level":1}`},
+        {"toggle", HandleTasks, "PATCH", "/tasks", `{"path":"close/a.md","line":4}`},
+    } {
+        if rec := memServe(srv, tc.handler, tc.method, tc.target, tc.body); rec.Code != http.StatusUnprocessableEntity {
+            t.Errorf("%s: %d %s, want 422", tc.name, rec.Code, rec.Body)
+        }
+    }
+    if _, err := store.Lstat(root + "/close/all.md"); !os.IsNotExist(err) {
+        t.Errorf("refused concat wrote its target: %v", err)
+    }
+    if data, _ := store.ReadFile(root + "/close/a.md"); string(data) != "# One\n[pay](javascript:alert(1))\n# Two\n- [ ] approve\n" {
+        t.Errorf("refused toggle rewrote the note: %q", data)
+    }
+}
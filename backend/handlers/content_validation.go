@@ -0,0 +1,176 @@
+// -------------------------------------------------------
+// backend/handlers/content_validation.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Validate that saved note content is well-formed UTF-8.
+//   - Optionally normalize CRLF/CR line endings to LF on save.
+// Audit:
+//   - The JSON "content" string is unquoted byte-for-byte, because
+//     encoding/json silently replaces invalid UTF-8 with U+FFFD and
+//     would hide binary garbage from validation.
+//   - Rejections return 422 with the byte offset (into the decoded
+//     content) of the first invalid sequence.
+// Configuration:
+//   - save_normalize_eol / SAVE_NORMALIZE_EOL=true converts CRLF and
+//     lone CR to LF.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "unicode/utf16"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+)
+
+// errNotJSONString is returned when "content" is not a JSON string.
+var errNotJSONString = errors.New("content must be a JSON string")
+
+// -------------------------------------------------------
+// func decodeRawJSONString(raw json.RawMessage) ([]byte, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Unquote a JSON string literal without repairing invalid UTF-8.
+// Audit:
+//   - Raw bytes are copied as-is; escaped lone surrogates
+//     (e.g. "\ud800") are emitted as their invalid 3-byte form so
+//     the UTF-8 check reports them at the right offset.
+//   - A missing or null value decodes to empty content.
+// -------------------------------------------------------
+func decodeRawJSONString(raw json.RawMessage) ([]byte, error) {
+    if len(raw) == 0 || string(raw) == "null" {
+        return []byte{}, nil
+    }
+    if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+        return nil, errNotJSONString
+    }
+
+    body := raw[1 : len(raw)-1]
+    out := make([]byte, 0, len(body))
+    for i := 0; i < len(body); i++ {
+        c := body[i]
+        if c != '\\' {
+            out = append(out, c)
+            continue
+        }
+        i++
+        if i >= len(body) {
+            return nil, errNotJSONString
+        }
+        switch body[i] {
+        case '"', '\\', '/':
+            out = append(out, body[i])
+        case 'b':
+            out = append(out, '\b')
+        case 'f':
+            out = append(out, '\f')
+        case 'n':
+            out = append(out, '\n')
+        case 'r':
+            out = append(out, '\r')
+        case 't':
+            out = append(out, '\t')
+        case 'u':
+            r, ok := parseHex4(body, i+1)
+            if !ok {
+                return nil, errNotJSONString
+            }
+            i += 4
+            if utf16.IsSurrogate(r) {
+                if lo, ok := parseHex4(body, i+3); ok && i+2 < len(body) && body[i+1] == '\\' && body[i+2] == 'u' {
+                    if pair := utf16.DecodeRune(r, lo); pair != utf8.RuneError {
+                        out = utf8.AppendRune(out, pair)
+                        i += 6
+                        continue
+                    }
+                }
+                // Lone surrogate: keep its (invalid) 3-byte encoding.
+                out = append(out, 0xED, byte(0x80|(r>>6)&0x3F), byte(0x80|r&0x3F))
+                continue
+            }
+            out = utf8.AppendRune(out, r)
+        default:
+            return nil, errNotJSONString
+        }
+    }
+    return out, nil
+}
+
+// -------------------------------------------------------
+// func parseHex4(b []byte, at int) (rune, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Parse four hex digits of a \uXXXX escape starting at b[at].
+// -------------------------------------------------------
+func parseHex4(b []byte, at int) (rune, bool) {
+    if at < 0 || at+4 > len(b) {
+        return 0, false
+    }
+    n, err := strconv.ParseUint(string(b[at:at+4]), 16, 32)
+    if err != nil {
+        return 0, false
+    }
+    return rune(n), true
+}
+
+// -------------------------------------------------------
+// func firstInvalidUTF8(b []byte) int
+// -------------------------------------------------------
+// Purpose:
+//   - Return the byte offset of the first invalid UTF-8 sequence,
+//     or -1 if the content is valid.
+// -------------------------------------------------------
+func firstInvalidUTF8(b []byte) int {
+    for i := 0; i < len(b); {
+        r, size := utf8.DecodeRune(b[i:])
+        if r == utf8.RuneError && size <= 1 {
+            return i
+        }
+        i += size
+    }
+    return -1
+}
+
+// -------------------------------------------------------
+// func normalizeLineEndings(s string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Convert CRLF and lone CR line endings to LF.
+// -------------------------------------------------------
+func normalizeLineEndings(s string) string {
+    s = strings.ReplaceAll(s, "\r\n", "\n")
+    return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// -------------------------------------------------------
+// func normalizeEOLEnabled() bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether save_normalize_eol is switched on.
+// -------------------------------------------------------
+func normalizeEOLEnabled(ctx context.Context) bool {
+    return currentConfig(ctx).SaveNormalizeEOL
+}
+
+// -------------------------------------------------------
+// func writeInvalidUTF8(w, r, path, offset)
+// -------------------------------------------------------
+// Purpose:
+//   - Reject a save with 422 invalid_content and the offending
+//     byte offset in details.offset.
+// Audit:
+//   - Logs target path and offset with UTC timestamp.
+// -------------------------------------------------------
+func writeInvalidUTF8(w http.ResponseWriter, r *http.Request, path string, offset int) {
+    logError(r.Context(), fmt.Sprintf("Rejected non-UTF-8 content for %s at byte %d", path, offset))
+    apierror.WriteDetails(w, r, apierror.CodeInvalidContent, "content", "content is not valid UTF-8",
+        map[string]interface{}{"offset": offset})
+}
@@ -0,0 +1,355 @@
+// -------------------------------------------------------
+// backend/handlers/docx_export.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/export?path=...&format=docx: the note as a Word
+//     document, for board materials that must travel as .docx.
+// Audit:
+//   - Written directly as Office Open XML (like the .xlsx table
+//     export), from the Markdown subset of markdown.go: headings
+//     become Heading 1-6, lists real Word lists (each numbered list
+//     restarting at 1), tables Word tables with a repeating header
+//     row, code and quotes their own paragraph styles.
+//   - Prepared like the HTML export (export_html.go): includes
+//     expanded, read processors applied, frontmatter dropped, and
+//     the configured header and footer stamped on every page. There
+//     is no watermark: a .docx is editable anyway.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/zip"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "strings"
+)
+
+const (
+    docxContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+    // docxIndent is one list or quote level, in twentieths of a point.
+    docxIndent   = 720
+    maxDocxLevel = 8
+)
+
+// -------------------------------------------------------
+// type docxWriter
+// -------------------------------------------------------
+// Purpose:
+//   - State of one DOCX export: the document body, the hyperlink
+//     targets (relationships rId10, rId11, ...) and the numbered
+//     lists started (numbering instances 2, 3, ...).
+// -------------------------------------------------------
+type docxWriter struct {
+    body  strings.Builder
+    links []string
+    lists int
+}
+
+// -------------------------------------------------------
+// func writeNoteDocx(w, stamp, header, footer, content) error
+// -------------------------------------------------------
+// Purpose:
+//   - Write a .docx of a note's (rendered) content, with header and
+//     footer lines (empty: none) and the stamp's title and exporter
+//     as document properties.
+// -------------------------------------------------------
+func writeNoteDocx(w io.Writer, stamp exportStamp, header, footer string, content []byte) error {
+    d := &docxWriter{}
+    d.blocks(parseMarkdownBlocks(stripFrontmatter(content)), 0, 0, false)
+
+    var rels, overrides, sect strings.Builder
+    for i, target := range d.links {
+        fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`, i+10, xmlAttr(target))
+    }
+    parts := []docxPart{}
+    for i, stampPart := range []struct{ kind, tag, text string }{{"header", "hdr", header}, {"footer", "ftr", footer}} {
+        if stampPart.text == "" {
+            continue
+        }
+        name := stampPart.kind + "1.xml"
+        fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/%s" Target="%s"/>`, i+3, stampPart.kind, name)
+        fmt.Fprintf(&overrides, `<Override PartName="/word/%s" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.%s+xml"/>`, name, stampPart.kind)
+        fmt.Fprintf(&sect, `<w:%sReference w:type="default" r:id="rId%d"/>`, stampPart.kind, i+3)
+        parts = append(parts, docxPart{"word/" + name, xml.Header + `<w:` + stampPart.tag + ` ` + docxNamespaces + `>` +
+            `<w:p><w:pPr><w:pStyle w:val="Stamp"/></w:pPr>` + docxRun(stampPart.text, "") + `</w:p></w:` + stampPart.tag + `>`})
+    }
+
+    parts = append(parts, []docxPart{
+        {"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+            `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+            `<Default Extension="xml" ContentType="application/xml"/>` +
+            `<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+            `<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+            `<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+            `<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+            overrides.String() + `</Types>`},
+        {"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+            `<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+            `</Relationships>`},
+        {"docProps/core.xml", xml.Header + `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+            `<dc:title>` + xmlEscape(stamp["title"]) + `</dc:title><dc:creator>` + xmlEscape(stamp["exporter"]) + `</dc:creator>` +
+            `<dc:identifier>sha256:` + stamp["sha256"] + `</dc:identifier></cp:coreProperties>`},
+        {"word/_rels/document.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+            `<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>` +
+            rels.String() + `</Relationships>`},
+        {"word/styles.xml", docxStyles},
+        {"word/numbering.xml", d.numbering()},
+        {"word/document.xml", xml.Header + `<w:document ` + docxNamespaces + `><w:body>` + d.body.String() +
+            `<w:sectPr>` + sect.String() + `<w:pgSz w:w="11906" w:h="16838"/>` +
+            `<w:pgMar w:top="1440" w:right="1134" w:bottom="1440" w:left="1134" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr>` +
+            `</w:body></w:document>`},
+    }...)
+
+    archive := zip.NewWriter(w)
+    for _, part := range parts {
+        f, err := archive.Create(part.name)
+        if err != nil {
+            return err
+        }
+        if _, err := io.WriteString(f, part.body); err != nil {
+            return err
+        }
+    }
+    return archive.Close()
+}
+
+// docxPart is one file of the package.
+type docxPart struct {
+    name string
+    body string
+}
+
+const docxNamespaces = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+// -------------------------------------------------------
+// func (d *docxWriter) blocks(blocks, indent, depth, quoted)
+// -------------------------------------------------------
+// Purpose:
+//   - Append blocks to the body. indent counts quote and list
+//     levels (left indent); depth is the list nesting level;
+//     paragraphs in a quote take the Quote style.
+// -------------------------------------------------------
+func (d *docxWriter) blocks(blocks []mdBlock, indent, depth int, quoted bool) {
+    for _, block := range blocks {
+        switch block.Kind {
+        case mdParagraph:
+            style := ""
+            if quoted {
+                style = `<w:pStyle w:val="Quote"/>`
+            }
+            d.paragraph(style+docxIndentPr(indent), block.Text)
+        case mdHeading:
+            d.paragraph(fmt.Sprintf(`<w:pStyle w:val="Heading%d"/>`, block.Level)+docxIndentPr(indent), block.Text)
+        case mdCode:
+            d.body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Code"/>` + docxIndentPr(indent) + `</w:pPr>`)
+            for i, line := range strings.Split(block.Text, "\n") {
+                if i > 0 {
+                    d.body.WriteString(`<w:r><w:br/></w:r>`)
+                }
+                d.body.WriteString(docxRun(line, ""))
+            }
+            d.body.WriteString(`</w:p>`)
+        case mdRule:
+            d.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr></w:pPr></w:p>`)
+        case mdQuote:
+            d.blocks(block.Children, indent+1, depth, true)
+        case mdList:
+            numID := 1
+            if block.Ordered {
+                d.lists++
+                numID = d.lists + 1
+            }
+            level := min(depth, maxDocxLevel)
+            for _, item := range block.Items {
+                text := item.Text
+                switch {
+                case item.Task && item.Done:
+                    text = "☑ " + text
+                case item.Task:
+                    text = "☐ " + text
+                }
+                d.paragraph(fmt.Sprintf(`<w:pStyle w:val="ListParagraph"/><w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, level, numID), text)
+                d.blocks(item.Children, indent+1, depth+1, quoted)
+            }
+        case mdTable:
+            d.table(block)
+        }
+    }
+}
+
+// docxIndentPr is the paragraph indent for a quote or list level.
+func docxIndentPr(indent int) string {
+    if indent == 0 {
+        return ""
+    }
+    return fmt.Sprintf(`<w:ind w:left="%d"/>`, indent*docxIndent)
+}
+
+// paragraph appends a paragraph with properties pPr and inline text.
+func (d *docxWriter) paragraph(pPr, text string) {
+    d.body.WriteString(`<w:p><w:pPr>` + pPr + `</w:pPr>` + d.inline(text, false) + `</w:p>`)
+}
+
+// -------------------------------------------------------
+// func (d *docxWriter) inline(text string, bold bool) string
+// -------------------------------------------------------
+// Purpose:
+//   - The runs of inline Markdown text, all bold when bold is set
+//     (table headers).
+// Audit:
+//   - Newlines inside a paragraph are spaces, as in Markdown; hard
+//     breaks are <w:br/>. Links are hyperlinks to their target.
+// -------------------------------------------------------
+func (d *docxWriter) inline(text string, bold bool) string {
+    var out strings.Builder
+    for _, span := range parseInline(text) {
+        if span.Break {
+            out.WriteString(`<w:r><w:br/></w:r>`)
+            continue
+        }
+        props := ""
+        switch {
+        case span.Code:
+            props = `<w:rStyle w:val="InlineCode"/>`
+        case span.Link != "":
+            props = `<w:rStyle w:val="Hyperlink"/>`
+        }
+        if span.Bold || bold {
+            props += `<w:b/>`
+        }
+        if span.Italic {
+            props += `<w:i/>`
+        }
+        if span.Strike {
+            props += `<w:strike/>`
+        }
+        run := docxRun(strings.ReplaceAll(span.Text, "\n", " "), props)
+        if span.Link != "" {
+            d.links = append(d.links, span.Link)
+            run = fmt.Sprintf(`<w:hyperlink r:id="rId%d">%s</w:hyperlink>`, len(d.links)+9, run)
+        }
+        out.WriteString(run)
+    }
+    return out.String()
+}
+
+// docxRun is one run of text with run properties rPr; tabs become
+// <w:tab/>.
+func docxRun(text, rPr string) string {
+    var b strings.Builder
+    b.WriteString(`<w:r>`)
+    if rPr != "" {
+        b.WriteString(`<w:rPr>` + rPr + `</w:rPr>`)
+    }
+    for i, part := range strings.Split(text, "\t") {
+        if i > 0 {
+            b.WriteString(`<w:tab/>`)
+        }
+        if part != "" {
+            b.WriteString(`<w:t xml:space="preserve">` + xmlEscape(part) + `</w:t>`)
+        }
+    }
+    b.WriteString(`</w:r>`)
+    return b.String()
+}
+
+// xmlAttr escapes s for a double-quoted XML attribute.
+func xmlAttr(s string) string {
+    return strings.ReplaceAll(xmlEscape(s), `"`, "&quot;")
+}
+
+// table appends a pipe table as a Word table; the header row
+// repeats on every page.
+func (d *docxWriter) table(block mdBlock) {
+    d.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid>`)
+    for range block.Header {
+        d.body.WriteString(`<w:gridCol/>`)
+    }
+    d.body.WriteString(`</w:tblGrid>`)
+    for r, cells := range append([][]string{block.Header}, block.Rows...) {
+        d.body.WriteString(`<w:tr>`)
+        if r == 0 {
+            d.body.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+        }
+        for c, cell := range cells {
+            jc := ""
+            if block.Aligns[c] != "" {
+                jc = `<w:jc w:val="` + block.Aligns[c] + `"/>`
+            }
+            d.body.WriteString(`<w:tc><w:p><w:pPr><w:spacing w:after="0"/>` + jc + `</w:pPr>` + d.inline(cell, r == 0) + `</w:p></w:tc>`)
+        }
+        d.body.WriteString(`</w:tr>`)
+    }
+    // Word needs a paragraph between two tables.
+    d.body.WriteString(`</w:tbl><w:p/>`)
+}
+
+// -------------------------------------------------------
+// func (d *docxWriter) numbering() string
+// -------------------------------------------------------
+// Purpose:
+//   - numbering.xml: instance 1 is bullets; every numbered list got
+//     its own instance of the decimal scheme, restarting at 1.
+// -------------------------------------------------------
+func (d *docxWriter) numbering() string {
+    var b strings.Builder
+    b.WriteString(xml.Header + `<w:numbering ` + docxNamespaces + `>`)
+    bullets := []string{"•", "◦", "▪"}
+    for abstract, format := range []string{"bullet", "decimal"} {
+        fmt.Fprintf(&b, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+        for level := 0; level <= maxDocxLevel; level++ {
+            text := fmt.Sprintf("%%%d.", level+1)
+            if format == "bullet" {
+                text = bullets[level%len(bullets)]
+            }
+            fmt.Fprintf(&b, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/>`+
+                `<w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`, level, format, text, (level+1)*docxIndent)
+        }
+        b.WriteString(`</w:abstractNum>`)
+    }
+    b.WriteString(`<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>`)
+    for i := 0; i < d.lists; i++ {
+        fmt.Fprintf(&b, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/>`, i+2)
+        for level := 0; level <= maxDocxLevel; level++ {
+            fmt.Fprintf(&b, `<w:lvlOverride w:ilvl="%d"><w:startOverride w:val="1"/></w:lvlOverride>`, level)
+        }
+        b.WriteString(`</w:num>`)
+    }
+    b.WriteString(`</w:numbering>`)
+    return b.String()
+}
+
+// docxStyles is styles.xml: the paragraph, character and table
+// styles the export uses.
+var docxStyles = xml.Header + `<w:styles ` + docxNamespaces + `>` +
+    `<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-GB"/></w:rPr></w:rPrDefault>` +
+    `<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="264" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+    `<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>` +
+    docxHeadingStyles() +
+    `<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="40"/><w:contextualSpacing/></w:pPr><w:qFormat/></w:style>` +
+    `<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:pBdr><w:left w:val="single" w:sz="12" w:space="8" w:color="999999"/></w:pBdr></w:pPr><w:rPr><w:i/><w:color w:val="404040"/></w:rPr><w:qFormat/></w:style>` +
+    `<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/><w:spacing w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/></w:rPr></w:style>` +
+    `<w:style w:type="paragraph" w:styleId="Stamp"><w:name w:val="Stamp"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0"/></w:pPr><w:rPr><w:color w:val="595959"/><w:sz w:val="16"/></w:rPr></w:style>` +
+    `<w:style w:type="character" w:styleId="InlineCode"><w:name w:val="Inline Code"/><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/></w:rPr></w:style>` +
+    `<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>` +
+    `<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders>` +
+    `<w:top w:val="single" w:sz="4" w:space="0" w:color="808080"/><w:left w:val="single" w:sz="4" w:space="0" w:color="808080"/>` +
+    `<w:bottom w:val="single" w:sz="4" w:space="0" w:color="808080"/><w:right w:val="single" w:sz="4" w:space="0" w:color="808080"/>` +
+    `<w:insideH w:val="single" w:sz="4" w:space="0" w:color="808080"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="808080"/>` +
+    `</w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+    `</w:styles>`
+
+// docxHeadingStyles are Heading 1-6, largest first.
+func docxHeadingStyles() string {
+    var b strings.Builder
+    for level, size := range []int{32, 28, 26, 24, 22, 22} {
+        fmt.Fprintf(&b, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/>`+
+            `<w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="%d"/></w:pPr>`+
+            `<w:rPr><w:b/><w:sz w:val="%d"/><w:szCs w:val="%d"/></w:rPr><w:qFormat/></w:style>`, level+1, level+1, level, size, size)
+    }
+    return b.String()
+}
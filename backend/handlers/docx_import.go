@@ -0,0 +1,604 @@
+// -------------------------------------------------------
+// backend/handlers/docx_import.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Word (.docx) to note conversion for
+//     POST /file/import?path=...&format=docx: Markdown for .md
+//     targets, plain text for .txt.
+// Audit:
+//   - Converted in Go from the document's XML: headings (Heading
+//     1-6 and Title styles, or an outline level), bulleted and
+//     numbered lists with their nesting, tables (the first row is
+//     the header), bold, italic, strikethrough and hyperlinks.
+//   - Tracked deletions and hidden text are left out; images,
+//     charts, comments and footnotes are not imported, and are
+//     reported as warnings.
+//   - Each part of the package is read up to maxDocxPartBytes
+//     uncompressed.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// maxDocxPartBytes bounds each part of an uploaded document once
+// decompressed, so a small zip cannot expand without limit.
+const maxDocxPartBytes = 64 << 20
+
+var (
+    docxHeadingStyle  = regexp.MustCompile(`^heading ?([1-9])$`)
+    docxMarkdownStart = regexp.MustCompile(`^(#|>|[-*+] |\d+[.)] )`)
+)
+
+// -------------------------------------------------------
+// type docxNode
+// -------------------------------------------------------
+// Purpose:
+//   - One element of a package part, by local name (namespaces are
+//     dropped: WordprocessingML names do not clash).
+// -------------------------------------------------------
+type docxNode struct {
+    Name     string
+    Attrs    map[string]string
+    Children []*docxNode
+    Text     string
+}
+
+// child is the first child named name, or nil.
+func (n *docxNode) child(name string) *docxNode {
+    if n == nil {
+        return nil
+    }
+    for _, c := range n.Children {
+        if c.Name == name {
+            return c
+        }
+    }
+    return nil
+}
+
+// val is the w:val of the child named name ("" when absent).
+func (n *docxNode) val(name string) string {
+    if c := n.child(name); c != nil {
+        return c.Attrs["val"]
+    }
+    return ""
+}
+
+// on reports whether a toggle property (w:b, w:i...) is set.
+func (n *docxNode) on(name string) bool {
+    c := n.child(name)
+    return c != nil && c.Attrs["val"] != "0" && c.Attrs["val"] != "false" && c.Attrs["val"] != "none"
+}
+
+// -------------------------------------------------------
+// func parseDocxPart(data []byte) (*docxNode, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The element tree of one XML part.
+// -------------------------------------------------------
+func parseDocxPart(data []byte) (*docxNode, error) {
+    dec := xml.NewDecoder(bytes.NewReader(data))
+    root := &docxNode{}
+    stack := []*docxNode{root}
+    for {
+        tok, err := dec.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        top := stack[len(stack)-1]
+        switch t := tok.(type) {
+        case xml.StartElement:
+            node := &docxNode{Name: t.Name.Local, Attrs: map[string]string{}}
+            for _, attr := range t.Attr {
+                node.Attrs[attr.Name.Local] = attr.Value
+            }
+            top.Children = append(top.Children, node)
+            stack = append(stack, node)
+        case xml.EndElement:
+            if len(stack) > 1 {
+                stack = stack[:len(stack)-1]
+            }
+        case xml.CharData:
+            if top.Name == "t" || top.Name == "delText" {
+                top.Text += string(t)
+            }
+        }
+    }
+    if len(root.Children) == 0 {
+        return nil, fmt.Errorf("no root element")
+    }
+    return root.Children[0], nil
+}
+
+// -------------------------------------------------------
+// type docxPackage
+// -------------------------------------------------------
+// Purpose:
+//   - The parts of an uploaded document the conversion reads.
+// -------------------------------------------------------
+type docxPackage struct {
+    files map[string]*zip.File
+}
+
+// part reads one part; missing parts are nil without error.
+func (p docxPackage) part(name string) (*docxNode, error) {
+    f, ok := p.files[name]
+    if !ok {
+        return nil, nil
+    }
+    if f.UncompressedSize64 > maxDocxPartBytes {
+        return nil, fmt.Errorf("%s is larger than %d bytes", name, maxDocxPartBytes)
+    }
+    rc, err := f.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    data, err := ioutil.ReadAll(io.LimitReader(rc, maxDocxPartBytes+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(data) > maxDocxPartBytes {
+        return nil, fmt.Errorf("%s is larger than %d bytes", name, maxDocxPartBytes)
+    }
+    node, err := parseDocxPart(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", name, err)
+    }
+    return node, nil
+}
+
+// -------------------------------------------------------
+// type docxReader
+// -------------------------------------------------------
+// Purpose:
+//   - State of one conversion: style headings and list levels,
+//     list formats, hyperlink targets, and the text written.
+// -------------------------------------------------------
+type docxReader struct {
+    markdown bool
+    headings map[string]int
+    quotes   map[string]bool
+    styleNum map[string][2]string
+    ordered  map[string]map[string]bool
+    links    map[string]string
+    blocks   []string
+    inList   bool
+    counters map[string]int
+    images   int
+}
+
+// -------------------------------------------------------
+// func convertDocx(data []byte, markdown bool) (string, []string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - A Word document as Markdown (or plain text), with warnings
+//     about what was not imported.
+// -------------------------------------------------------
+func convertDocx(data []byte, markdown bool) (string, []string, error) {
+    archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+    if err != nil {
+        return "", nil, fmt.Errorf("not a .docx file (%v)", err)
+    }
+    pkg := docxPackage{files: map[string]*zip.File{}}
+    for _, f := range archive.File {
+        pkg.files[f.Name] = f
+    }
+    document, err := pkg.part("word/document.xml")
+    if err != nil {
+        return "", nil, err
+    }
+    body := document.child("body")
+    if document == nil || document.Name != "document" || body == nil {
+        return "", nil, fmt.Errorf("not a Word document (no word/document.xml body)")
+    }
+
+    d := &docxReader{markdown: markdown, headings: map[string]int{}, quotes: map[string]bool{}, styleNum: map[string][2]string{},
+        ordered: map[string]map[string]bool{}, links: map[string]string{}, counters: map[string]int{}}
+    if err := d.loadStyles(pkg); err != nil {
+        return "", nil, err
+    }
+    if err := d.loadNumbering(pkg); err != nil {
+        return "", nil, err
+    }
+    if rels, err := pkg.part("word/_rels/document.xml.rels"); err != nil {
+        return "", nil, err
+    } else if rels != nil {
+        for _, rel := range rels.Children {
+            if strings.HasSuffix(rel.Attrs["Type"], "/hyperlink") {
+                d.links[rel.Attrs["Id"]] = rel.Attrs["Target"]
+            }
+        }
+    }
+
+    d.container(body)
+    var out strings.Builder
+    for i, block := range d.blocks {
+        if i > 0 {
+            out.WriteString("\n")
+            if !strings.HasPrefix(block, "\x00") || !strings.HasPrefix(d.blocks[i-1], "\x00") {
+                out.WriteString("\n")
+            }
+        }
+        out.WriteString(strings.TrimPrefix(block, "\x00"))
+    }
+    if out.Len() > 0 {
+        out.WriteString("\n")
+    }
+
+    warnings := []string{}
+    if d.images > 0 {
+        warnings = append(warnings, fmt.Sprintf("%d images or charts were not imported", d.images))
+    }
+    for _, what := range []string{"comments", "footnotes", "endnotes"} {
+        // Word writes two separator notes into every footnotes and
+        // endnotes part; only more than that are real notes.
+        node, err := pkg.part("word/" + what + ".xml")
+        if err == nil && node != nil && (len(node.Children) > 2 || what == "comments" && len(node.Children) > 0) {
+            warnings = append(warnings, what+" were not imported")
+        }
+    }
+    return out.String(), warnings, nil
+}
+
+// loadStyles maps heading styles to levels and list styles to
+// their numbering.
+func (d *docxReader) loadStyles(pkg docxPackage) error {
+    styles, err := pkg.part("word/styles.xml")
+    if err != nil || styles == nil {
+        return err
+    }
+    for _, style := range styles.Children {
+        if style.Name != "style" {
+            continue
+        }
+        id := style.Attrs["styleId"]
+        name := strings.ToLower(style.val("name"))
+        pPr := style.child("pPr")
+        switch {
+        case name == "title":
+            d.headings[id] = 1
+        case strings.Contains(name, "quote"):
+            d.quotes[id] = true
+        case docxHeadingStyle.MatchString(name):
+            d.headings[id], _ = strconv.Atoi(docxHeadingStyle.FindStringSubmatch(name)[1])
+        case pPr.val("outlineLvl") != "":
+            if level, err := strconv.Atoi(pPr.val("outlineLvl")); err == nil && level < 9 {
+                d.headings[id] = level + 1
+            }
+        }
+        if numPr := pPr.child("numPr"); numPr != nil {
+            d.styleNum[id] = [2]string{numPr.val("numId"), numPr.val("ilvl")}
+        }
+    }
+    return nil
+}
+
+// loadNumbering records which list levels are numbered rather than
+// bulleted, per numbering instance.
+func (d *docxReader) loadNumbering(pkg docxPackage) error {
+    numbering, err := pkg.part("word/numbering.xml")
+    if err != nil || numbering == nil {
+        return err
+    }
+    abstract := map[string]map[string]bool{}
+    for _, node := range numbering.Children {
+        if node.Name != "abstractNum" {
+            continue
+        }
+        levels := map[string]bool{}
+        for _, lvl := range node.Children {
+            if lvl.Name == "lvl" {
+                format := lvl.val("numFmt")
+                levels[lvl.Attrs["ilvl"]] = format != "" && format != "bullet" && format != "none"
+            }
+        }
+        abstract[node.Attrs["abstractNumId"]] = levels
+    }
+    for _, node := range numbering.Children {
+        if node.Name == "num" {
+            d.ordered[node.Attrs["numId"]] = abstract[node.val("abstractNumId")]
+        }
+    }
+    return nil
+}
+
+// container converts the paragraphs and tables of a body, cell, or
+// content control.
+func (d *docxReader) container(node *docxNode) {
+    for _, child := range node.Children {
+        switch child.Name {
+        case "p":
+            d.paragraph(child)
+        case "tbl":
+            d.inList = false
+            d.table(child)
+        case "sdt", "sdtContent", "customXml", "ins", "moveTo":
+            d.container(child)
+        }
+    }
+}
+
+// -------------------------------------------------------
+// func (d *docxReader) paragraph(p *docxNode)
+// -------------------------------------------------------
+// Purpose:
+//   - Add one paragraph as a heading, list item, or text.
+// Audit:
+//   - List items carry a "\x00" mark so consecutive items are
+//     joined without a blank line; it is removed when joining.
+//   - Numbered items are numbered in order (1., 2., ...), restarting
+//     below a higher-level item. Quote styles become block quotes in
+//     Markdown.
+// -------------------------------------------------------
+func (d *docxReader) paragraph(p *docxNode) {
+    pPr := p.child("pPr")
+    style := pPr.val("pStyle")
+    text := strings.TrimSpace(d.inline(p))
+    if text == "" {
+        return
+    }
+
+    level := d.headings[style]
+    if outline := pPr.val("outlineLvl"); outline != "" {
+        if n, err := strconv.Atoi(outline); err == nil && n < 9 {
+            level = n + 1
+        }
+    }
+    numID, ilvl := "", "0"
+    if numPr := pPr.child("numPr"); numPr != nil {
+        numID, ilvl = numPr.val("numId"), defaultString(numPr.val("ilvl"), "0")
+    } else if num, ok := d.styleNum[style]; ok {
+        numID, ilvl = num[0], defaultString(num[1], "0")
+    }
+
+    switch {
+    case level > 0 && numID == "":
+        d.inList = false
+        if d.markdown {
+            text = strings.Repeat("#", min(level, 6)) + " " + text
+        }
+        d.blocks = append(d.blocks, text)
+    case numID != "" && numID != "0":
+        depth, _ := strconv.Atoi(ilvl)
+        depth = min(max(depth, 0), maxDocxLevel)
+        key := numID + "/" + strconv.Itoa(depth)
+        if !d.inList {
+            d.counters = map[string]int{}
+        }
+        // A higher-level item restarts the numbering below it.
+        for deeper := depth + 1; deeper <= maxDocxLevel; deeper++ {
+            delete(d.counters, numID+"/"+strconv.Itoa(deeper))
+        }
+        d.counters[key]++
+        marker := "- "
+        if d.ordered[numID][strconv.Itoa(depth)] {
+            marker = strconv.Itoa(d.counters[key]) + ". "
+        }
+        d.inList = true
+        d.blocks = append(d.blocks, "\x00"+strings.Repeat("    ", depth)+marker+text)
+    default:
+        d.inList = false
+        if d.markdown && docxMarkdownStart.MatchString(text) {
+            text = `\` + text
+        }
+        if d.markdown && d.quotes[style] {
+            text = "> " + strings.ReplaceAll(text, "\n", "\n> ")
+        }
+        d.blocks = append(d.blocks, text)
+    }
+}
+
+// -------------------------------------------------------
+// func (d *docxReader) inline(node *docxNode) string
+// -------------------------------------------------------
+// Purpose:
+//   - The text of a paragraph's runs, with Markdown emphasis and
+//     links when converting to Markdown.
+// -------------------------------------------------------
+func (d *docxReader) inline(node *docxNode) string {
+    spans := []mdSpan{}
+    d.runs(node, "", &spans)
+
+    // Merge neighbours with the same formatting so emphasis is not
+    // split at every run boundary.
+    merged := []mdSpan{}
+    for _, span := range spans {
+        if n := len(merged); n > 0 && !span.Break && !merged[n-1].Break &&
+            merged[n-1].Bold == span.Bold && merged[n-1].Italic == span.Italic && merged[n-1].Strike == span.Strike && merged[n-1].Link == span.Link {
+            merged[n-1].Text += span.Text
+            continue
+        }
+        merged = append(merged, span)
+    }
+
+    var out strings.Builder
+    for _, span := range merged {
+        if span.Break {
+            if d.markdown {
+                out.WriteString("  ")
+            }
+            out.WriteString("\n")
+            continue
+        }
+        if !d.markdown {
+            out.WriteString(span.Text)
+            if span.Link != "" && span.Link != strings.TrimSpace(span.Text) {
+                out.WriteString(" (" + span.Link + ")")
+            }
+            continue
+        }
+        text := markdownEscape(span.Text)
+        if span.Link != "" {
+            text = "[" + text + "](" + strings.ReplaceAll(strings.ReplaceAll(span.Link, " ", "%20"), ")", "%29") + ")"
+        }
+        // Markers hug the text: spaces stay outside them.
+        core := strings.TrimSpace(text)
+        if core == "" {
+            out.WriteString(text)
+            continue
+        }
+        lead := text[:strings.Index(text, core)]
+        trail := text[len(lead)+len(core):]
+        for _, mark := range []struct {
+            on     bool
+            marker string
+        }{{span.Strike, "~~"}, {span.Italic, "*"}, {span.Bold, "**"}} {
+            if mark.on {
+                core = mark.marker + core + mark.marker
+            }
+        }
+        out.WriteString(lead + core + trail)
+    }
+    return out.String()
+}
+
+// runs collects the text runs below node; link is the hyperlink
+// they sit in.
+func (d *docxReader) runs(node *docxNode, link string, spans *[]mdSpan) {
+    for _, child := range node.Children {
+        switch child.Name {
+        case "r":
+            rPr := child.child("rPr")
+            if rPr.on("vanish") {
+                continue
+            }
+            span := mdSpan{Bold: rPr.on("b"), Italic: rPr.on("i"), Strike: rPr.on("strike") || rPr.on("dstrike"), Link: link}
+            for _, part := range child.Children {
+                switch part.Name {
+                case "t":
+                    span.Text += part.Text
+                case "tab", "ptab":
+                    span.Text += "\t"
+                case "noBreakHyphen":
+                    span.Text += "-"
+                case "br", "cr":
+                    if part.Attrs["type"] == "page" || part.Attrs["type"] == "column" {
+                        continue
+                    }
+                    *spans = append(*spans, span, mdSpan{Break: true})
+                    span.Text = ""
+                case "drawing", "pict", "object":
+                    d.images++
+                }
+            }
+            *spans = append(*spans, span)
+        case "hyperlink":
+            target := d.links[child.Attrs["id"]]
+            d.runs(child, target, spans)
+        case "del", "moveFrom", "pPr", "rPr", "commentReference":
+        default:
+            d.runs(child, link, spans)
+        }
+    }
+}
+
+// markdownEscape escapes what would otherwise read as Markdown.
+func markdownEscape(text string) string {
+    var b strings.Builder
+    for i := 0; i < len(text); i++ {
+        switch text[i] {
+        case '\\', '*', '`', '[', ']', '~':
+            b.WriteByte('\\')
+        }
+        b.WriteByte(text[i])
+    }
+    return b.String()
+}
+
+// -------------------------------------------------------
+// func (d *docxReader) table(tbl *docxNode)
+// -------------------------------------------------------
+// Purpose:
+//   - Add a table: a pipe table in Markdown (first row as the
+//     header), tab-separated rows in plain text.
+// Audit:
+//   - A cell's paragraphs are joined with spaces; merged cells are
+//     repeated as empty cells so columns stay aligned; nested
+//     tables are flattened into their cell.
+// -------------------------------------------------------
+func (d *docxReader) table(tbl *docxNode) {
+    rows := [][]string{}
+    width := 0
+    for _, tr := range tbl.Children {
+        if tr.Name != "tr" {
+            continue
+        }
+        row := []string{}
+        for _, tc := range tr.Children {
+            if tc.Name != "tc" {
+                continue
+            }
+            row = append(row, d.cellText(tc))
+            if span, err := strconv.Atoi(tc.child("tcPr").val("gridSpan")); err == nil {
+                for i := 1; i < span && i < 64; i++ {
+                    row = append(row, "")
+                }
+            }
+        }
+        width = max(width, len(row))
+        rows = append(rows, row)
+    }
+    if len(rows) == 0 || width == 0 {
+        return
+    }
+
+    var out strings.Builder
+    for r, row := range rows {
+        for len(row) < width {
+            row = append(row, "")
+        }
+        if !d.markdown {
+            out.WriteString(strings.Join(row, "\t") + "\n")
+            continue
+        }
+        for c := range row {
+            inner := strings.TrimSuffix(strings.TrimPrefix(row[c], "**"), "**")
+            if r == 0 && len(inner) == len(row[c])-4 && !strings.Contains(inner, "**") {
+                // Header cells are usually bold already; the header
+                // row says so without the markers.
+                row[c] = inner
+            }
+            row[c] = strings.ReplaceAll(row[c], "|", `\|`)
+        }
+        out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+        if r == 0 {
+            out.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+        }
+    }
+    d.blocks = append(d.blocks, strings.TrimSuffix(out.String(), "\n"))
+}
+
+// cellText is the text of one table cell on a single line.
+func (d *docxReader) cellText(tc *docxNode) string {
+    var parts []string
+    var walk func(node *docxNode)
+    walk = func(node *docxNode) {
+        for _, child := range node.Children {
+            switch child.Name {
+            case "p":
+                if text := strings.TrimSpace(d.inline(child)); text != "" {
+                    parts = append(parts, text)
+                }
+            case "tbl", "tr", "tc", "sdt", "sdtContent", "customXml", "ins":
+                walk(child)
+            }
+        }
+    }
+    walk(tc)
+    return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
@@ -0,0 +1,152 @@
+// -------------------------------------------------------
+// backend/handlers/download.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - POST /files/download {"paths": [...]}: a ZIP of exactly the
+//     listed notes, for grabbing a handful of related memos at once.
+// Audit:
+//   - Every path is validated like GET /file (sanitized, note
+//     extension); notes in archived folders are read from the archive.
+//   - Each note goes through the read processors, as on GET /file.
+//   - At most maxDownloadFiles notes and maxDownloadBytes of content;
+//     beyond that the request is refused (413) before anything is sent.
+//   - All notes are read before the ZIP is streamed, so a missing or
+//     unreadable note answers with an error instead of a partial ZIP.
+//   - Writes one "file.download" audit event per note, so downloads
+//     show in /file/access-log and count toward mass_download.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/zip"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    maxDownloadFiles       = 200
+    maxDownloadBytes       = 64 << 20
+    maxDownloadRequestSize = 1 << 20
+)
+
+// downloadItem is one note read for a ZIP download.
+type downloadItem struct {
+    rel      string
+    data     []byte
+    modified time.Time
+}
+
+// -------------------------------------------------------
+// func HandleFilesDownload(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Stream scratchpad-files-<UTC>.zip holding the listed notes
+//     under their paths; duplicates are included once.
+// -------------------------------------------------------
+func HandleFilesDownload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Paths []string `json:"paths"`
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, maxDownloadRequestSize)
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if len(req.Paths) == 0 {
+        apierror.Write(w, r, apierror.CodeMissingField, "paths", "Missing required field: paths")
+        return
+    }
+
+    seen := map[string]bool{}
+    items := []downloadItem{}
+    var total int64
+    for _, path := range req.Paths {
+        absPath := sanitizePath(r.Context(), path)
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "paths", "Invalid file path: "+path)
+            return
+        }
+        rel := relativeTo(r.Context(), absPath)
+        if seen[rel] {
+            continue
+        }
+        seen[rel] = true
+        if len(items) == maxDownloadFiles {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "paths", fmt.Sprintf("At most %d files per download", maxDownloadFiles))
+            return
+        }
+
+        data, err := readNote(r.Context(), absPath)
+        if errors.Is(err, os.ErrNotExist) {
+            apierror.Write(w, r, apierror.CodeNotFound, "paths", "File not found: "+rel)
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "read file for download: "+absPath, "Internal error")
+            return
+        }
+        data, err = processContent(r.Context(), hookRead, rel, data)
+        if err != nil {
+            writeProcessorError(w, r, rel, err)
+            return
+        }
+        total += int64(len(data))
+        if total > maxDownloadBytes {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "paths", fmt.Sprintf("Download exceeds %d MiB", maxDownloadBytes>>20))
+            return
+        }
+        modified := timeNow(r.Context())
+        if info, err := serverFrom(r.Context()).Storage.Lstat(absPath); err == nil {
+            modified = info.ModTime()
+        }
+        items = append(items, downloadItem{rel: rel, data: data, modified: modified})
+    }
+
+    name := "scratchpad-files-" + timeNow(r.Context()).UTC().Format("20060102T150405Z") + ".zip"
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+    zw := zip.NewWriter(w)
+    status := http.StatusOK
+    for _, item := range items {
+        header := &zip.FileHeader{Name: item.rel, Method: zip.Deflate, Modified: item.modified.UTC()}
+        fw, err := zw.CreateHeader(header)
+        if err == nil {
+            _, err = fw.Write(item.data)
+        }
+        if err != nil {
+            logError(r.Context(), "Download stream failed: "+err.Error())
+            status = http.StatusInternalServerError
+            break
+        }
+    }
+    if err := zw.Close(); err != nil && status == http.StatusOK {
+        logError(r.Context(), "Download stream failed: "+err.Error())
+        status = http.StatusInternalServerError
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Downloaded %d files (%d bytes) as %s", len(items), total, name))
+    actor := actorName(r.Context())
+    for _, item := range items {
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "file.download",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   status,
+            Actor:    actor,
+            Target:   item.rel,
+            Detail:   fmt.Sprintf("zip of %d files", len(items)),
+        })
+    }
+}
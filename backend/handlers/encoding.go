@@ -0,0 +1,355 @@
+// -------------------------------------------------------
+// backend/handlers/encoding.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Character encoding detection and transcoding to UTF-8 for
+//     files that come from elsewhere (Windows exports, Excel "Unicode
+//     text", mail attachments):
+//       POST /file/import?path=...      raw file body, saved as UTF-8
+//            (&format=docx converts a Word document; docx_import.go)
+//       POST /file/fix-encoding {"path"} transcode a note in place
+//   - Both report the detected source encoding.
+// Audit:
+//   - Detected encodings: utf-8, utf-8-bom, utf-16le, utf-16be (with
+//     or without a byte order mark), and windows-1252 as the fallback
+//     for any other non-UTF-8 bytes (it maps every byte, and is a
+//     superset of ISO-8859-1 for printable text).
+//   - The result is always valid UTF-8 without a BOM; line endings
+//     are normalized when save_normalize_eol is on, as for saves.
+//   - Import creates a new note (409 if one exists). fix-encoding
+//     rewrites a note only when its bytes change; the old bytes are
+//     kept in the revision store first. Written content passes the
+//     save processors, as on POST /file/save.
+//   - Writes "file.import" and "file.fix_encoding" audit events with
+//     the detected encoding and the resulting sha256.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "unicode/utf16"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const maxImportBytes = 16 << 20
+
+// Detected source encodings.
+const (
+    encodingUTF8        = "utf-8"
+    encodingUTF8BOM     = "utf-8-bom"
+    encodingUTF16LE     = "utf-16le"
+    encodingUTF16BE     = "utf-16be"
+    encodingWindows1252 = "windows-1252"
+)
+
+// windows1252High maps bytes 0x80-0x9F; the five bytes Windows-1252
+// leaves undefined map to the C1 control of the same value (as in
+// the WHATWG encoding standard). Other bytes equal their code point.
+var windows1252High = [32]rune{
+    0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+    0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+    0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+    0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// -------------------------------------------------------
+// func detectEncoding(data []byte) string
+// -------------------------------------------------------
+// Purpose:
+//   - Best guess at the encoding of data.
+// Audit:
+//   - A BOM decides. Without one, valid UTF-8 is UTF-8; text where
+//     at least a third of the 16-bit units have a zero high byte on
+//     the same side (ASCII stored as UTF-16) is UTF-16; anything
+//     else is Windows-1252.
+// -------------------------------------------------------
+func detectEncoding(data []byte) string {
+    switch {
+    case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+        return encodingUTF8BOM
+    case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+        return encodingUTF16LE
+    case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+        return encodingUTF16BE
+    case utf8.Valid(data):
+        return encodingUTF8
+    }
+    if len(data) >= 2 && len(data)%2 == 0 {
+        evenZero, oddZero := 0, 0
+        for i := 0; i+1 < len(data); i += 2 {
+            if data[i] == 0 {
+                evenZero++
+            }
+            if data[i+1] == 0 {
+                oddZero++
+            }
+        }
+        units := len(data) / 2
+        switch {
+        case oddZero*3 >= units && evenZero*3 < units:
+            return encodingUTF16LE
+        case evenZero*3 >= units && oddZero*3 < units:
+            return encodingUTF16BE
+        }
+    }
+    return encodingWindows1252
+}
+
+// -------------------------------------------------------
+// func transcodeToUTF8(data []byte, encoding string) []byte
+// -------------------------------------------------------
+// Purpose:
+//   - Convert data from encoding to UTF-8, dropping any BOM.
+// Audit:
+//   - Unpaired UTF-16 surrogates and a trailing odd byte become
+//     U+FFFD, so the result is always valid UTF-8.
+// -------------------------------------------------------
+func transcodeToUTF8(data []byte, encoding string) []byte {
+    switch encoding {
+    case encodingUTF8:
+        return data
+    case encodingUTF8BOM:
+        return data[3:]
+    case encodingUTF16LE, encodingUTF16BE:
+        if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+            data = data[2:]
+        }
+        units := make([]uint16, 0, len(data)/2)
+        for i := 0; i+1 < len(data); i += 2 {
+            if encoding == encodingUTF16LE {
+                units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+            } else {
+                units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+            }
+        }
+        out := []byte(string(utf16.Decode(units)))
+        if len(data)%2 == 1 {
+            out = append(out, string(utf8.RuneError)...)
+        }
+        return out
+    }
+    out := make([]byte, 0, len(data)+len(data)/8)
+    for _, b := range data {
+        switch {
+        case b < 0x80:
+            out = append(out, b)
+        case b < 0xA0:
+            out = utf8.AppendRune(out, windows1252High[b-0x80])
+        default:
+            out = utf8.AppendRune(out, rune(b))
+        }
+    }
+    return out
+}
+
+// toNoteText detects the encoding of data and returns it as note
+// content (UTF-8, line endings normalized if configured).
+func toNoteText(ctx context.Context, data []byte) ([]byte, string) {
+    encoding := detectEncoding(data)
+    text := transcodeToUTF8(data, encoding)
+    if normalizeEOLEnabled(ctx) {
+        text = []byte(normalizeLineEndings(string(text)))
+    }
+    return text, encoding
+}
+
+// auditEncoding records an import or an in-place transcode.
+func auditEncoding(r *http.Request, event string, rel string, encoding string, content []byte) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail:   fmt.Sprintf("encoding=%s bytes=%d sha256=%s", encoding, len(content), contentHash(content)),
+    })
+}
+
+// -------------------------------------------------------
+// func HandleFileImport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Create the note ?path= from the raw request body, transcoded
+//     to UTF-8.
+// Audit:
+//   - The body is the file as-is (any Content-Type); at most
+//     maxImportBytes.
+//   - format=docx converts a Word document instead, reporting what
+//     it could not import in "warnings"; the encoding is "docx".
+//   - The body is scanned for malware before it is converted
+//     (antivirus.go).
+// -------------------------------------------------------
+func HandleFileImport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    target := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", target) {
+        return
+    }
+    format := r.URL.Query().Get("format")
+    if format != "" && format != "text" && format != "docx" {
+        writeFieldError(w, r, invalidField("format", "must be text or docx"))
+        return
+    }
+    ctx := r.Context()
+    rel, absPath, err := newNoteTarget(ctx, "path", target)
+    if err != nil {
+        writeNewNoteError(w, r, err, "path", "check import target "+target)
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+
+    data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Import exceeds %d MiB", maxImportBytes>>20))
+            return
+        }
+        logError(ctx, "Failed to read import body: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInvalidField, "", "Bad request: could not read body")
+        return
+    }
+    if rejectIfInfected(w, r, rel, "import", data) {
+        return
+    }
+    var content []byte
+    encoding, warnings := "", []string{}
+    if format == "docx" {
+        converted, notes, err := convertDocx(data, strings.EqualFold(filepath.Ext(absPath), markdownExt))
+        if err != nil {
+            logError(ctx, "Cannot convert "+rel+" from docx: "+err.Error())
+            apierror.Write(w, r, apierror.CodeInvalidContent, "", "Cannot import document: "+err.Error())
+            return
+        }
+        content, encoding, warnings = []byte(converted), "docx", notes
+    } else {
+        content, encoding = toNoteText(ctx, data)
+    }
+    content, err = processContent(ctx, hookSave, rel, content)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+    if rejectIfDangerous(w, r, rel, content) {
+        return
+    }
+    if err := writeNewNotes(ctx, []SplitPart{{Path: rel, content: content, abs: absPath}}); err != nil {
+        writeNewNoteError(w, r, err, "path", "import "+rel)
+        return
+    }
+
+    logInfo(ctx, fmt.Sprintf("Imported %s (%s, %d bytes)", rel, encoding, len(data)))
+    auditEncoding(r, "file.import", rel, encoding, content)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":     rel,
+        "encoding": encoding,
+        "bytes":    len(content),
+        "sha256":   contentHash(content),
+        "warnings": warnings,
+    })
+}
+
+// -------------------------------------------------------
+// func HandleFileFixEncoding(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Transcode an existing note to UTF-8 in place.
+// Audit:
+//   - A note that is already plain UTF-8 is left alone (changed is
+//     false). With dry_run the detection is reported and nothing is
+//     written.
+//   - Archived, approved and ledger notes are refused like saves.
+// -------------------------------------------------------
+func HandleFileFixEncoding(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Path   string `json:"path"`
+        DryRun bool   `json:"dry_run"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    ctx := r.Context()
+    data, err := readNote(ctx, absPath)
+    if errors.Is(err, os.ErrNotExist) {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "File not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "read file for fix-encoding: "+absPath, "Internal error")
+        return
+    }
+    content, encoding := toNoteText(ctx, data)
+    changed := !bytes.Equal(content, data)
+    result := map[string]interface{}{
+        "path":     rel,
+        "encoding": encoding,
+        "changed":  changed,
+        "dry_run":  req.DryRun,
+        "bytes":    len(content),
+        "sha256":   contentHash(content),
+    }
+    if changed && !req.DryRun {
+        if rejectIfArchived(w, r, absPath) || rejectIfApproved(w, r, absPath) {
+            return
+        }
+        if isLedger(ctx, rel) {
+            writeLedgerViolation(w, r, &LedgerError{Path: rel, Reason: "ledger notes cannot be transcoded in place"})
+            return
+        }
+        content, err = processContent(ctx, hookSave, rel, content)
+        if err != nil {
+            writeProcessorError(w, r, rel, err)
+            return
+        }
+        if rejectIfDangerous(w, r, rel, content) {
+            return
+        }
+        result["bytes"], result["sha256"] = len(content), contentHash(content)
+        storeRevision(ctx, data)
+        if err := writeFile(ctx, absPath, content); err != nil {
+            writeStorageError(w, r, err, "fix encoding: "+absPath, "Write failed")
+            return
+        }
+        indexUpdate(ctx, rel, content)
+        journalPutEntry(ctx, rel, content)
+        flagSignedChange(r, rel, content)
+        logInfo(ctx, fmt.Sprintf("Transcoded %s from %s to UTF-8", rel, encoding))
+        auditEncoding(r, "file.fix_encoding", rel, encoding, content)
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,170 @@
+// -------------------------------------------------------
+// backend/handlers/events.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Server-sent events: GET /events streams change notifications
+//     (the change journal entries of /changes, changes.go) as they
+//     happen, over plain HTTP that proxies pass where WebSockets are
+//     blocked.
+//       id: <clock>
+//       event: change
+//       data: {"clock": ..., "op": "put", "path": ...}
+// Audit:
+//   - Each event's id is its journal clock. A reconnecting
+//     EventSource sends it back as Last-Event-ID and the stream
+//     resumes after it, so no change is missed across reconnects.
+//     ?since=N does the same for clients that cannot set headers.
+//     Without either the stream starts at the current clock.
+//   - A "ready" event with the current clock opens every stream;
+//     comment lines keep idle connections alive through proxies.
+//   - The stream ends at the route deadline (/events, 5 minutes by
+//     default, see route_timeouts) and the client reconnects, so a
+//     connection never outlives server.write_timeout.
+//   - Entries carry paths and hashes, never content. Read-only; the
+//     request is audited like any other when it ends.
+//   - Each entry is checked before it is written, as /activity
+//     checks its items: an entry whose path (or former path) the
+//     caller could not open or list (pathVisible) is skipped, and
+//     ?folder= keeps only entries in that folder, as on /files.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    eventsPageSize  = 500
+    eventsKeepAlive = 25 * time.Second
+    // eventsRetryMs is the reconnect delay suggested to clients.
+    eventsRetryMs = 2000
+)
+
+// -------------------------------------------------------
+// func eventsCursor(r) (int64, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Where a stream starts: Last-Event-ID, else ?since, else now.
+// -------------------------------------------------------
+func eventsCursor(r *http.Request) (int64, error) {
+    value := r.Header.Get("Last-Event-ID")
+    field := "Last-Event-ID"
+    if value == "" {
+        value = r.URL.Query().Get("since")
+        field = "since"
+    }
+    if value == "" {
+        return currentJournalClock(r.Context()), nil
+    }
+    cursor, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || cursor < 0 {
+        return 0, invalidField(field, "must be a non-negative integer")
+    }
+    return cursor, nil
+}
+
+// -------------------------------------------------------
+// func eventVisible(ctx, entry, folder) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a stream scoped to folder ("." for all) may carry
+//     entry to the caller of ctx.
+// Audit:
+//   - A move is shown when either end lies in folder, but only if
+//     both ends are visible.
+// -------------------------------------------------------
+func eventVisible(ctx context.Context, entry JournalEntry, folder string) bool {
+    isFolder := entry.Op == journalMkdir
+    if !pathVisible(ctx, entry.Path, isFolder) || entry.From != "" && !pathVisible(ctx, entry.From, isFolder) {
+        return false
+    }
+    return folder == "." || pathWithin(entry.Path, folder) || entry.From != "" && pathWithin(entry.From, folder)
+}
+
+// -------------------------------------------------------
+// func HandleEvents(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /events: text/event-stream of journal changes after the
+//     cursor, until the client leaves or the deadline passes.
+//   - ?folder= limits the stream to one folder and its subfolders.
+// -------------------------------------------------------
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        apierror.Write(w, r, apierror.CodeInternal, "", "Streaming is not supported")
+        return
+    }
+    cursor, err := eventsCursor(r)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    folderAbs := sanitizePath(r.Context(), r.URL.Query().Get("folder"))
+    if folderAbs == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+        return
+    }
+    folder := relativeTo(r.Context(), folderAbs)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-store")
+    // Ask buffering proxies (nginx) to pass events through at once.
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+    fmt.Fprintf(w, "retry: %d\nevent: ready\ndata: {\"clock\":%d}\n\n", eventsRetryMs, currentJournalClock(r.Context()))
+    flusher.Flush()
+
+    ctx := r.Context()
+    keepAlive := time.NewTicker(eventsKeepAlive)
+    defer keepAlive.Stop()
+    sent := 0
+    for {
+        // Take the wait channel before reading, so an append between
+        // the read and the wait still wakes this stream.
+        changed := journalWait()
+        entries, err := journalSince(ctx, cursor, eventsPageSize)
+        if err != nil {
+            logError(ctx, "Event stream failed to read the change journal: "+err.Error())
+            return
+        }
+        for _, entry := range entries {
+            cursor = entry.Clock
+            if !eventVisible(ctx, entry, folder) {
+                continue
+            }
+            data, _ := json.Marshal(entry)
+            fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", entry.Clock, data)
+            sent++
+        }
+        if len(entries) > 0 {
+            flusher.Flush()
+            if len(entries) == eventsPageSize {
+                continue
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            logInfo(ctx, fmt.Sprintf("Event stream ended after %d events (cursor %d)", sent, cursor))
+            return
+        case <-changed:
+        case <-keepAlive.C:
+            fmt.Fprint(w, ": keep-alive\n\n")
+            flusher.Flush()
+        }
+    }
+}
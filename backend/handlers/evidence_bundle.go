@@ -0,0 +1,506 @@
+// -------------------------------------------------------
+// backend/handlers/evidence_bundle.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Auditor-ready evidence bundle for a date range, one .tar.gz:
+//       logs/      the daily evidence logs (plain or rotated .gz)
+//       hashes/    their SHA-512 manifests from /evidence/hashes
+//       backup/    the backup archive nearest the end of the range
+//       SHA256SUMS sha256sum-compatible list of the files above
+//       README.txt summary: range, event counts, missing days,
+//                  manifest checks, backup, verification steps
+//       README.txt.sig, signing_key.pem
+//                  Ed25519 signature of README.txt (base64) and the
+//                  instance's bundle signing key
+//   - POST /admin/evidence-bundle {"from", "to"} and the
+//     `evidence-bundle` command write it to backup_dir.
+// Audit:
+//   - Evidence is copied, never modified; today's log is copied up
+//     to its size when the bundle starts.
+//   - Each rotated log is checked against its SHA-512 manifest and
+//     the result stated in README.txt; a mismatch does not stop the
+//     bundle, it is reported.
+//   - The signing key is created on first use in
+//     .scratchpad/keys/evidence_signing.json (mode 0600); README.txt
+//     lists every file's SHA-256, so its signature covers them all.
+//   - The archive is written as *.partial and renamed when complete.
+//   - The endpoint writes "admin.evidence_bundle".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/sha512"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "hash"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/buildinfo"
+)
+
+const (
+    evidenceSigningKeyFile = "keys/evidence_signing.json"
+    maxEvidenceBundleDays  = 366
+)
+
+// -------------------------------------------------------
+// type EvidenceBundleResult
+// -------------------------------------------------------
+// Purpose:
+//   - Summary of a written evidence bundle.
+// Audit:
+//   - Missing lists days of the range without an evidence log;
+//     Mismatched lists rotated logs that fail their SHA-512 manifest.
+// -------------------------------------------------------
+type EvidenceBundleResult struct {
+    Path       string   `json:"path"`
+    From       string   `json:"from"`
+    To         string   `json:"to"`
+    Logs       int      `json:"logs"`
+    Events     int      `json:"events"`
+    Missing    []string `json:"missing"`
+    Mismatched []string `json:"mismatched"`
+    Backup     string   `json:"backup"`
+    SHA256     string   `json:"sha256"`
+    PublicKey  string   `json:"public_key"`
+    CreatedAt  string   `json:"created_at"`
+}
+
+// bundleFile is one file copied into the bundle.
+type bundleFile struct {
+    name   string // path inside the bundle
+    sha256 string
+}
+
+// -------------------------------------------------------
+// func CreateEvidenceBundle(ctx, dir, backupDir, from, to) (EvidenceBundleResult, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Write dir/evidence-<from>_<to>-<UTC>.tar.gz for the UTC days
+//     from..to (inclusive), taking the backup from backupDir.
+// Audit:
+//   - dir is created if missing. Cancelling ctx removes the partial
+//     file.
+// -------------------------------------------------------
+func CreateEvidenceBundle(ctx context.Context, dir string, backupDir string, from time.Time, to time.Time) (EvidenceBundleResult, error) {
+    now := timeNow(ctx).UTC()
+    result := EvidenceBundleResult{
+        From:       from.Format("2006-01-02"),
+        To:         to.Format("2006-01-02"),
+        Missing:    []string{},
+        Mismatched: []string{},
+        CreatedAt:  now.Format("2006-01-02T15:04:05Z"),
+    }
+    if to.Before(from) {
+        return result, fmt.Errorf("from is after to")
+    }
+    if to.Sub(from) >= maxEvidenceBundleDays*24*time.Hour {
+        return result, fmt.Errorf("range must be at most %d days", maxEvidenceBundleDays)
+    }
+
+    private, err := evidenceSigningKey(ctx)
+    if err != nil {
+        return result, fmt.Errorf("signing key: %v", err)
+    }
+    public := private.Public().(ed25519.PublicKey)
+    result.PublicKey = base64.StdEncoding.EncodeToString(public)
+
+    events, err := countEvidenceEvents(from, to)
+    if err != nil {
+        return result, err
+    }
+
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return result, err
+    }
+    base := "evidence-" + result.From + "_" + result.To
+    final := filepath.Join(dir, base+"-"+now.Format("20060102T150405Z")+".tar.gz")
+    partial := final + ".partial"
+    out, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return result, err
+    }
+    fail := func(err error) (EvidenceBundleResult, error) {
+        out.Close()
+        os.Remove(partial)
+        return result, err
+    }
+
+    hasher := sha256.New()
+    gz := gzip.NewWriter(io.MultiWriter(out, hasher))
+    tw := tar.NewWriter(gz)
+    files := []bundleFile{}
+    add := func(name string, source string, extra hash.Hash) error {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        sum, err := tarCopy(tw, base+"/"+name, source, extra)
+        if err != nil {
+            return fmt.Errorf("copy %s: %v", source, err)
+        }
+        files = append(files, bundleFile{name: name, sha256: sum})
+        return nil
+    }
+
+    // Evidence logs and their manifests, day by day.
+    var readme strings.Builder
+    logLines := []string{}
+    for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+        d := day.Format("2006-01-02")
+        source := evidenceLogFor(d)
+        if source == "" {
+            result.Missing = append(result.Missing, d)
+            continue
+        }
+        var sha hash.Hash
+        if strings.HasSuffix(source, ".gz") {
+            sha = sha512.New()
+        }
+        if err := add("logs/"+filepath.Base(source), source, sha); err != nil {
+            return fail(err)
+        }
+        result.Logs++
+        line := fmt.Sprintf("  %s  %s  events=%d", d, filepath.Base(source), events[d])
+        manifest := filepath.Join(audit.HashDir, "requests_"+d+".sha512")
+        if _, err := os.Stat(manifest); err == nil {
+            if err := add("hashes/"+filepath.Base(manifest), manifest, nil); err != nil {
+                return fail(err)
+            }
+        }
+        if sha != nil {
+            switch manifestSHA512(manifest) {
+            case "":
+                line += "  manifest=absent"
+            case hex.EncodeToString(sha.Sum(nil)):
+                line += "  manifest=verified"
+            default:
+                line += "  manifest=MISMATCH"
+                result.Mismatched = append(result.Mismatched, filepath.Base(source))
+            }
+        } else {
+            line += "  manifest=not rotated"
+        }
+        result.Events += events[d]
+        logLines = append(logLines, line)
+    }
+
+    // The backup taken nearest the end of the range.
+    backupLine := "  none found in " + backupDir
+    if backup, taken := nearestBackup(backupDir, to.AddDate(0, 0, 1)); backup != "" {
+        if err := add("backup/"+filepath.Base(backup), backup, nil); err != nil {
+            return fail(err)
+        }
+        result.Backup = filepath.Base(backup)
+        backupLine = "  " + result.Backup + "  taken " + taken.Format("2006-01-02T15:04:05Z")
+    }
+
+    var sums strings.Builder
+    for _, f := range files {
+        sums.WriteString(f.sha256 + "  " + f.name + "\n")
+    }
+    sumsData := []byte(sums.String())
+
+    fmt.Fprintf(&readme, "CFO Scratchpad evidence bundle\n\n")
+    fmt.Fprintf(&readme, "Range:     %s .. %s (UTC, inclusive)\n", result.From, result.To)
+    fmt.Fprintf(&readme, "Generated: %s\n", result.CreatedAt)
+    fmt.Fprintf(&readme, "Build:     %s\n", buildinfo.String())
+    fmt.Fprintf(&readme, "Instance:  %s\n\n", InstanceID(ctx))
+    fmt.Fprintf(&readme, "Evidence logs: %d of %d days, %d events\n", result.Logs, len(result.Missing)+result.Logs, result.Events)
+    for _, line := range logLines {
+        readme.WriteString(line + "\n")
+    }
+    if len(result.Missing) > 0 {
+        fmt.Fprintf(&readme, "Days without a log: %s\n", strings.Join(result.Missing, ", "))
+    }
+    if len(result.Mismatched) > 0 {
+        fmt.Fprintf(&readme, "WARNING: %d log(s) do not match their SHA-512 manifest: %s\n", len(result.Mismatched), strings.Join(result.Mismatched, ", "))
+    }
+    fmt.Fprintf(&readme, "\nBackup nearest the end of the range:\n%s\n", backupLine)
+    fmt.Fprintf(&readme, "\nFiles (SHA-256, also in SHA256SUMS):\n")
+    for _, f := range files {
+        fmt.Fprintf(&readme, "  %s  %s\n", f.sha256, f.name)
+    }
+    fmt.Fprintf(&readme, "\nVerification:\n")
+    fmt.Fprintf(&readme, "  sha256sum -c SHA256SUMS\n")
+    fmt.Fprintf(&readme, "  base64 -d README.txt.sig > README.txt.sig.bin\n")
+    fmt.Fprintf(&readme, "  openssl pkeyutl -verify -pubin -inkey signing_key.pem -rawin -in README.txt -sigfile README.txt.sig.bin\n")
+    fmt.Fprintf(&readme, "\nSigning key (Ed25519, base64): %s\n", result.PublicKey)
+    readmeData := []byte(readme.String())
+
+    der, err := x509.MarshalPKIXPublicKey(public)
+    if err != nil {
+        return fail(err)
+    }
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, readmeData)) + "\n"
+    generated := []struct {
+        name string
+        data []byte
+    }{
+        {"SHA256SUMS", sumsData},
+        {"README.txt", readmeData},
+        {"README.txt.sig", []byte(signature)},
+        {"signing_key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})},
+    }
+    for _, g := range generated {
+        header := &tar.Header{Name: base + "/" + g.name, Mode: 0644, Size: int64(len(g.data)), ModTime: now.Truncate(time.Second), Typeflag: tar.TypeReg}
+        if err := tw.WriteHeader(header); err != nil {
+            return fail(err)
+        }
+        if _, err := tw.Write(g.data); err != nil {
+            return fail(err)
+        }
+    }
+
+    if err := tw.Close(); err != nil {
+        return fail(err)
+    }
+    if err := gz.Close(); err != nil {
+        return fail(err)
+    }
+    if err := out.Sync(); err != nil {
+        return fail(err)
+    }
+    if err := out.Close(); err != nil {
+        os.Remove(partial)
+        return result, err
+    }
+    if err := os.Rename(partial, final); err != nil {
+        os.Remove(partial)
+        return result, err
+    }
+    result.Path = final
+    result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+    return result, nil
+}
+
+// tarCopy appends source to tw as name, returning its SHA-256; extra,
+// when set, hashes the same bytes. Only the size at open is copied.
+// Sources lie outside the scratch root, so symlinks are refused by
+// Lstat rather than openNoFollow.
+func tarCopy(tw *tar.Writer, name string, source string, extra hash.Hash) (string, error) {
+    if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() {
+        return "", fmt.Errorf("not a regular file")
+    }
+    f, err := os.Open(source)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        return "", err
+    }
+    if !info.Mode().IsRegular() {
+        return "", fmt.Errorf("not a regular file")
+    }
+    header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+    if err := tw.WriteHeader(header); err != nil {
+        return "", err
+    }
+    sum := sha256.New()
+    var w io.Writer = io.MultiWriter(tw, sum)
+    if extra != nil {
+        w = io.MultiWriter(tw, sum, extra)
+    }
+    if _, err := io.CopyN(w, f, info.Size()); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// evidenceLogFor returns the day's log, preferring the plain file
+// mid-rotation, or "" when there is none.
+func evidenceLogFor(day string) string {
+    for _, name := range []string{"requests_" + day + ".log", "requests_" + day + ".log.gz"} {
+        path := filepath.Join(audit.LogDir, name)
+        if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+            return path
+        }
+    }
+    return ""
+}
+
+// manifestSHA512 reads the hash from a sha512sum-style manifest, or
+// "" when it is absent or unreadable.
+func manifestSHA512(path string) string {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return ""
+    }
+    fields := strings.Fields(string(data))
+    if len(fields) == 0 {
+        return ""
+    }
+    return strings.ToLower(fields[0])
+}
+
+// countEvidenceEvents counts the events logged on each day from..to.
+func countEvidenceEvents(from time.Time, to time.Time) (map[string]int, error) {
+    counts := map[string]int{}
+    last := to.Format("2006-01-02")
+    err := audit.Scan(from, func(event audit.Event, ref string) {
+        if day := strings.SplitN(ref, ":", 2)[0]; day <= last {
+            counts[day]++
+        }
+    })
+    return counts, err
+}
+
+// nearestBackup returns the scratchpad-<UTC>.tar.gz in dir taken
+// closest to at (earlier on a tie), with its time.
+func nearestBackup(dir string, at time.Time) (string, time.Time) {
+    matches, _ := filepath.Glob(filepath.Join(dir, "scratchpad-*.tar.gz"))
+    sort.Strings(matches)
+    best := ""
+    var bestTime time.Time
+    var bestDiff time.Duration
+    for _, path := range matches {
+        stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "scratchpad-"), ".tar.gz")
+        taken, err := time.Parse("20060102T150405Z", stamp)
+        if err != nil {
+            continue
+        }
+        diff := taken.Sub(at)
+        if diff < 0 {
+            diff = -diff
+        }
+        if best == "" || diff < bestDiff {
+            best, bestTime, bestDiff = path, taken, diff
+        }
+    }
+    return best, bestTime
+}
+
+// -------------------------------------------------------
+// func evidenceSigningKey() (ed25519.PrivateKey, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Load the instance's bundle signing key, generating it on
+//     first use.
+// -------------------------------------------------------
+func evidenceSigningKey(ctx context.Context) (ed25519.PrivateKey, error) {
+    signaturesMu.Lock()
+    defer signaturesMu.Unlock()
+    var stored signingKey
+    if err := loadMetaJSON(ctx, evidenceSigningKeyFile, &stored); err != nil {
+        return nil, err
+    }
+    if stored.PrivateKey != "" {
+        seed, err := base64.StdEncoding.DecodeString(stored.PrivateKey)
+        if err != nil || len(seed) != ed25519.SeedSize {
+            return nil, fmt.Errorf("evidence signing key is corrupt")
+        }
+        return ed25519.NewKeyFromSeed(seed), nil
+    }
+
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    stored = signingKey{
+        User:       "evidence-bundle",
+        PublicKey:  base64.StdEncoding.EncodeToString(public),
+        PrivateKey: base64.StdEncoding.EncodeToString(private.Seed()),
+        CreatedAt:  utcNow(ctx),
+    }
+    data, err := json.MarshalIndent(stored, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    if err := writeMetaFilePerm(ctx, evidenceSigningKeyFile, data, 0600); err != nil {
+        return nil, err
+    }
+    logInfo(ctx, "Created evidence bundle signing key")
+    return private, nil
+}
+
+// -------------------------------------------------------
+// func HandleEvidenceBundle(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/evidence-bundle {"from": "YYYY-MM-DD", "to": ...}
+//     writes a bundle to backup_dir and answers its summary; "to"
+//     defaults to "from".
+// Audit:
+//   - Writes "admin.evidence_bundle" with the range and SHA-256.
+// -------------------------------------------------------
+func HandleEvidenceBundle(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        From string `json:"from"`
+        To   string `json:"to"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "from", req.From) {
+        return
+    }
+    if req.To == "" {
+        req.To = req.From
+    }
+    from, err := time.Parse("2006-01-02", req.From)
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeInvalidField, "from", "Bad request: from must be YYYY-MM-DD")
+        return
+    }
+    to, err := time.Parse("2006-01-02", req.To)
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeInvalidField, "to", "Bad request: to must be YYYY-MM-DD")
+        return
+    }
+    if to.Before(from) || to.Sub(from) >= maxEvidenceBundleDays*24*time.Hour {
+        apierror.Write(w, r, apierror.CodeInvalidField, "to", fmt.Sprintf("Bad request: to must be from or later, at most %d days", maxEvidenceBundleDays))
+        return
+    }
+
+    dir := currentConfig(r.Context()).BackupDir
+    result, err := CreateEvidenceBundle(r.Context(), dir, dir, from, to)
+    if err != nil {
+        logError(r.Context(), "Evidence bundle failed: "+err.Error())
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "admin.evidence_bundle",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusInternalServerError,
+            Target:   req.From + ".." + req.To,
+            Detail:   err.Error(),
+        })
+        apierror.Write(w, r, apierror.CodeInternal, "", "Evidence bundle failed")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Evidence bundle written: %s (%d logs, %d events)", result.Path, result.Logs, result.Events))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "admin.evidence_bundle",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   result.Path,
+        Detail:   fmt.Sprintf("%s..%s logs=%d events=%d sha256=%s", result.From, result.To, result.Logs, result.Events, result.SHA256),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,232 @@
+// -------------------------------------------------------
+// backend/handlers/export.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /export?folder=...: a .tar.gz of every note (optionally
+//     one folder) taken at a single point in time, with a
+//     manifest.json recording the snapshot time and each file's
+//     size and SHA-256.
+// Audit:
+//   - Copy-on-read: writes are frozen (storage_queue.go) only while
+//     the notes are copied to a private staging directory
+//     (.scratchpad/exports/<id>); the archive is then built from the
+//     staging copy, so a slow client never holds up saves.
+//   - Saves and moves that arrive during the copy wait and apply
+//     after it; none of them is half-visible in the archive.
+//   - Metadata (.scratchpad) is not exported; /admin/backup covers
+//     the whole store.
+//   - Notes are exported as the read processors return them; the
+//     manifest hashes are of the exported bytes.
+//   - Writes a "files.export" audit event.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// exportsDirName holds staging copies while an export streams.
+const exportsDirName = "exports"
+
+// -------------------------------------------------------
+// type ExportManifest
+// -------------------------------------------------------
+// Purpose:
+//   - manifest.json, the first entry of every export archive.
+// Audit:
+//   - SnapshotAt is when writes were frozen; every file in the
+//     archive is its content at that instant.
+// -------------------------------------------------------
+type ExportManifest struct {
+    SnapshotAt string       `json:"snapshot_at"`
+    CreatedBy  string       `json:"created_by,omitempty"`
+    Folder     string       `json:"folder"`
+    Files      []ExportFile `json:"files"`
+    Bytes      int64        `json:"bytes"`
+}
+
+// ExportFile is one note in an export manifest.
+type ExportFile struct {
+    Path     string `json:"path"`
+    Bytes    int64  `json:"bytes"`
+    SHA256   string `json:"sha256"`
+    Modified string `json:"modified"`
+}
+
+// -------------------------------------------------------
+// func stageExport(ctx, scope, staging) (ExportManifest, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Copy the notes under scope into staging (a metadata name)
+//     while writes are frozen, and describe them.
+// Audit:
+//   - Reads go straight to Storage (see freezeWrites); the context
+//     is checked between notes.
+// -------------------------------------------------------
+func stageExport(ctx context.Context, scope, staging string) (ExportManifest, error) {
+    manifest := ExportManifest{Files: []ExportFile{}}
+    unfreeze := freezeWrites()
+    defer unfreeze()
+    manifest.SnapshotAt = utcNow(ctx)
+
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return manifest, err
+    }
+    storage := serverFrom(ctx).Storage
+    for _, note := range notes {
+        if scope != "" && !strings.HasPrefix(note.Rel, scope) {
+            continue
+        }
+        if err := ctx.Err(); err != nil {
+            return manifest, err
+        }
+        data, err := storage.ReadFile(note.Abs)
+        if err != nil {
+            return manifest, err
+        }
+        data, err = processContent(ctx, hookRead, note.Rel, data)
+        if err != nil {
+            return manifest, err
+        }
+        if err := writeMetaFilePerm(ctx, filepath.Join(staging, filepath.FromSlash(note.Rel)), data, 0600); err != nil {
+            return manifest, err
+        }
+        sum := sha256.Sum256(data)
+        manifest.Files = append(manifest.Files, ExportFile{
+            Path:     note.Rel,
+            Bytes:    int64(len(data)),
+            SHA256:   hex.EncodeToString(sum[:]),
+            Modified: note.ModTime.UTC().Format(time.RFC3339),
+        })
+        manifest.Bytes += int64(len(data))
+    }
+    return manifest, nil
+}
+
+// -------------------------------------------------------
+// func writeExportArchive(ctx, w, manifest, staging) error
+// -------------------------------------------------------
+// Purpose:
+//   - Stream manifest.json and the staged notes as .tar.gz.
+// -------------------------------------------------------
+func writeExportArchive(ctx context.Context, w io.Writer, manifest ExportManifest, staging string) error {
+    gz := gzip.NewWriter(w)
+    tw := tar.NewWriter(gz)
+    snapshot, _ := time.Parse(time.RFC3339, manifest.SnapshotAt)
+
+    body, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return err
+    }
+    header := &tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(body)), ModTime: snapshot}
+    if err := tw.WriteHeader(header); err != nil {
+        return err
+    }
+    if _, err := tw.Write(body); err != nil {
+        return err
+    }
+
+    for _, file := range manifest.Files {
+        modified, _ := time.Parse(time.RFC3339, file.Modified)
+        header := &tar.Header{Name: "notes/" + file.Path, Mode: 0644, Size: file.Bytes, ModTime: modified}
+        if err := tw.WriteHeader(header); err != nil {
+            return err
+        }
+        f, err := serverFrom(ctx).Storage.Open(metaPath(ctx, staging, filepath.FromSlash(file.Path)))
+        if err != nil {
+            return err
+        }
+        _, err = io.Copy(tw, f)
+        f.Close()
+        if err != nil {
+            return err
+        }
+    }
+    if err := tw.Close(); err != nil {
+        return err
+    }
+    return gz.Close()
+}
+
+// -------------------------------------------------------
+// func HandleExport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /export?folder=...: download a snapshot archive
+//     (scratchpad-export-<UTC>.tar.gz).
+// Audit:
+//   - Failures before streaming answer with the usual storage
+//     errors; a failure mid-stream can only be logged and audited.
+// -------------------------------------------------------
+func HandleExport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    folder := r.URL.Query().Get("folder")
+    absFolder := scratchRoot(r.Context())
+    if folder != "" {
+        absFolder = sanitizePath(r.Context(), folder)
+        if absFolder == "" {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+            return
+        }
+    }
+    scope := ""
+    if absFolder != scratchRoot(r.Context()) {
+        scope = relativeTo(r.Context(), absFolder) + "/"
+    }
+
+    staging := filepath.Join(exportsDirName, newStampID(r.Context()))
+    defer serverFrom(r.Context()).Storage.RemoveAll(metaPath(r.Context(), staging))
+
+    manifest, err := stageExport(r.Context(), scope, staging)
+    if err != nil {
+        writeStorageError(w, r, err, "stage export", "Export failed")
+        return
+    }
+    manifest.CreatedBy = actorName(r.Context())
+    manifest.Folder = strings.TrimSuffix(scope, "/")
+
+    status := http.StatusOK
+    detail := fmt.Sprintf("snapshot_at=%s files=%d bytes=%d", manifest.SnapshotAt, len(manifest.Files), manifest.Bytes)
+    name := "scratchpad-export-" + timeNow(r.Context()).UTC().Format("20060102T150405Z") + ".tar.gz"
+    w.Header().Set("Content-Type", "application/gzip")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+    if err := writeExportArchive(r.Context(), w, manifest, staging); err != nil {
+        logError(r.Context(), "Export stream failed: "+err.Error())
+        status = http.StatusInternalServerError
+        detail += " error=" + err.Error()
+    } else {
+        logInfo(r.Context(), fmt.Sprintf("Export snapshot %s: %d files", manifest.SnapshotAt, len(manifest.Files)))
+    }
+
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "files.export",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    manifest.CreatedBy,
+        Target:   defaultString(manifest.Folder, "/"),
+        Detail:   detail,
+    })
+}
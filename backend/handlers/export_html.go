@@ -0,0 +1,433 @@
+// -------------------------------------------------------
+// backend/handlers/export_html.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/export?path=...&format=html: the note as a single,
+//     self-contained HTML page styled for printing, so a reviewed
+//     memo can be printed and signed on paper.
+//   - Every printed page carries a header and footer stamp (the
+//     export configuration, config.ExportConfig): by default the
+//     company and title on top, and the path, content hash, export
+//     time and exporter below.
+// Audit:
+//   - The Markdown subset of markdown.go is rendered. Raw HTML in
+//     a note is shown as text, never interpreted. Links keep only
+//     http, https, mailto and relative targets; any other scheme
+//     (javascript:, data:, ...) is printed as plain text. The page
+//     carries a Content-Security-Policy meta tag that allows no
+//     scripts, so a saved copy stays inert when opened from disk.
+//   - Includes (![[...]]) are expanded as on /file/render, and read
+//     processors apply as on GET /file. The stamped SHA-256 is the
+//     note as stored (X-Content-SHA256), so a paper copy can be
+//     matched to the revision it was printed from.
+//   - Frontmatter is not printed; its title names the document.
+//   - ?watermark=1&recipient=... prints the recipient, a share ID
+//     and the export time across every page, so a leaked copy can
+//     be traced to whom it was given. The share ID (given, or
+//     generated) is returned in X-Share-Id and audited with the
+//     recipient.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "fmt"
+    "html"
+    "html/template"
+    "net/http"
+    "net/url"
+    "path"
+    "regexp"
+    "strings"
+    "time"
+    "unicode"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+// shareIDPattern is what a given share ID may look like.
+var shareIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+const maxRecipientLength = 128
+
+// exportHTMLPage lays out the printable page; Body is already HTML.
+var exportHTMLPage = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="Content-Security-Policy" content="default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'">
+{{if .Watermark}}<meta name="watermark" content="{{.Watermark}}">
+{{end}}<title>{{.Title}}</title>
+<style>
+@page { size: A4; margin: 24mm 18mm 26mm; }
+body { font: 11pt/1.45 Georgia, "Times New Roman", serif; color: #111; max-width: 174mm; margin: 0 auto; }
+.stamp { font: 8pt/1.3 Helvetica, Arial, sans-serif; color: #444; }
+h1, h2, h3, h4, h5, h6 { font-family: Helvetica, Arial, sans-serif; line-height: 1.2; page-break-after: avoid; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 10pt; }
+th, td { border: 1px solid #888; padding: 2pt 6pt; vertical-align: top; }
+th { background: #eee; }
+tr, pre, blockquote, li { page-break-inside: avoid; }
+pre, code { font: 9pt/1.35 Menlo, Consolas, monospace; }
+pre { white-space: pre-wrap; border: 1px solid #ccc; padding: 6pt; }
+blockquote { margin: 1em 0; padding-left: 10pt; border-left: 3px solid #999; color: #333; }
+li.task { list-style: none; margin-left: -1.2em; }
+a { color: inherit; }
+.watermark { position: fixed; top: 0; bottom: 0; left: 0; right: 0; overflow: hidden; pointer-events: none; z-index: 10; }
+.watermark span { position: absolute; left: -25%; width: 150%; text-align: center; transform: rotate(-30deg); font: bold 20pt/1 Helvetica, Arial, sans-serif; color: rgba(160, 0, 0, 0.14); white-space: nowrap; }
+.watermark span:nth-child(1) { top: 18%; }
+.watermark span:nth-child(2) { top: 50%; }
+.watermark span:nth-child(3) { top: 82%; }
+@media print {
+  header.stamp { position: fixed; top: -16mm; left: 0; right: 0; }
+  footer.stamp { position: fixed; bottom: -18mm; left: 0; right: 0; }
+}
+@media screen {
+  body { padding: 2em; }
+  header.stamp { border-bottom: 1px solid #ccc; padding-bottom: 4pt; margin-bottom: 2em; }
+  footer.stamp { border-top: 1px solid #ccc; padding-top: 4pt; margin-top: 3em; }
+}
+</style>
+</head>
+<body>
+{{if .Header}}<header class="stamp">{{.Header}}</header>
+{{end}}{{if .Watermark}}<div class="watermark" aria-hidden="true"><span>{{.Watermark}}</span><span>{{.Watermark}}</span><span>{{.Watermark}}</span></div>
+{{end}}<main>
+{{.Body}}</main>
+{{if .Footer}}<footer class="stamp">{{.Footer}}</footer>
+{{end}}</body>
+</html>
+`))
+
+// -------------------------------------------------------
+// type exportStamp
+// -------------------------------------------------------
+// Purpose:
+//   - The values an export header or footer may print, by the
+//     names in config.ExportStampFields.
+// -------------------------------------------------------
+type exportStamp map[string]string
+
+// expand fills the {fields} of line. A " | " left at either end
+// by an empty field (no company configured) is dropped.
+func (s exportStamp) expand(line string) string {
+    pairs := []string{}
+    for _, field := range config.ExportStampFields {
+        pairs = append(pairs, "{"+field+"}", s[field])
+    }
+    return strings.Trim(strings.NewReplacer(pairs...).Replace(line), " |")
+}
+
+// -------------------------------------------------------
+// func noteTitle(rel, content) string
+// -------------------------------------------------------
+// Purpose:
+//   - A document title for a note: its frontmatter title, else its
+//     first heading, else its file name.
+// -------------------------------------------------------
+func noteTitle(rel string, content []byte) string {
+    if fm := parseFrontmatter(content); fm.Title != "" {
+        return fm.Title
+    }
+    if headings := markdownHeadings(stripFrontmatter(content)); len(headings) > 0 {
+        return headings[0].Text
+    }
+    return strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+}
+
+// -------------------------------------------------------
+// func writeNoteHTML(buf, export, stamp, lang, content) error
+// -------------------------------------------------------
+// Purpose:
+//   - Write the printable page of a note's (rendered) content,
+//     stamped with the configured header and footer, and the
+//     watermark when the stamp has a share ID.
+// -------------------------------------------------------
+func writeNoteHTML(buf *bytes.Buffer, export config.ExportConfig, stamp exportStamp, lang string, content []byte) error {
+    watermark := ""
+    if stamp["share_id"] != "" {
+        watermark = stamp.expand(export.Watermark)
+    }
+    return exportHTMLPage.Execute(buf, map[string]interface{}{
+        "Lang":      lang,
+        "Title":     stamp["title"],
+        "Header":    stamp.expand(export.Header),
+        "Footer":    stamp.expand(export.Footer),
+        "Watermark": watermark,
+        "Body":      template.HTML(markdownHTML(stripFrontmatter(content))),
+    })
+}
+
+// -------------------------------------------------------
+// func exportWatermark(r) (recipient, shareID string, err error)
+// -------------------------------------------------------
+// Purpose:
+//   - The watermark an export asks for: none without ?watermark=1;
+//     otherwise ?recipient= (required) and ?share_id= (default: a
+//     new sortable ID).
+// -------------------------------------------------------
+func exportWatermark(r *http.Request) (string, string, error) {
+    q := r.URL.Query()
+    if q.Get("watermark") == "" || q.Get("watermark") == "0" {
+        if q.Get("recipient") != "" || q.Get("share_id") != "" {
+            return "", "", invalidField("watermark", "must be 1 when recipient or share_id is given")
+        }
+        return "", "", nil
+    }
+    if q.Get("watermark") != "1" {
+        return "", "", invalidField("watermark", "must be 0 or 1")
+    }
+    recipient := strings.TrimSpace(q.Get("recipient"))
+    if recipient == "" {
+        return "", "", invalidField("recipient", "is required with watermark=1")
+    }
+    if len(recipient) > maxRecipientLength || strings.IndexFunc(recipient, unicode.IsControl) >= 0 {
+        return "", "", invalidField("recipient", "must be at most %d characters without control characters", maxRecipientLength)
+    }
+    shareID := q.Get("share_id")
+    if shareID == "" {
+        shareID = newStampID(r.Context())
+    } else if !shareIDPattern.MatchString(shareID) {
+        return "", "", invalidField("share_id", "must be 1-64 letters, digits, '.', '_' or '-'")
+    }
+    return recipient, shareID, nil
+}
+
+// -------------------------------------------------------
+// func newExportStamp(now, export, exporter, rel, title, hash)
+// -------------------------------------------------------
+// Purpose:
+//   - Stamp values for one export of the note rel.
+// Audit:
+//   - An anonymous caller is stamped "anonymous".
+// -------------------------------------------------------
+func newExportStamp(now time.Time, export config.ExportConfig, exporter, rel, title, hash string) exportStamp {
+    loc, err := time.LoadLocation(export.Timezone)
+    if err != nil {
+        loc = time.UTC
+    }
+    return exportStamp{
+        "company":     export.Company,
+        "title":       title,
+        "path":        rel,
+        "exported_at": now.In(loc).Format("2006-01-02 15:04 MST"),
+        "exporter":    defaultString(exporter, "anonymous"),
+        "sha256":      hash,
+    }
+}
+
+// -------------------------------------------------------
+// func exportNoteDocument(w, r, absPath, format)
+// -------------------------------------------------------
+// Purpose:
+//   - Answer /file/export?format=html|docx for the note at absPath:
+//     a download named after the note (and share ID), with
+//     X-Content-SHA256 set to the stamped hash.
+// Audit:
+//   - Audited as a read (detail "export <format>") and as
+//     "file.export" with the hash, and for a watermarked copy the
+//     share ID and recipient. Only HTML can be watermarked.
+// -------------------------------------------------------
+func exportNoteDocument(w http.ResponseWriter, r *http.Request, absPath, format string) {
+    ctx := r.Context()
+    rel := relativeTo(ctx, absPath)
+    recipient, shareID, err := exportWatermark(r)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    if shareID != "" && format != "html" {
+        writeFieldError(w, r, invalidField("watermark", "is only available with format=html"))
+        return
+    }
+    stored, err := readNote(ctx, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for "+format+" export: "+absPath, "Internal error")
+        return
+    }
+    content, err := processContent(ctx, hookRead, rel, stored)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+    auditFileRead(r, absPath, "export "+format)
+    renderer := &includeRenderer{r: r, stack: []string{rel + "#"}, size: len(content), includes: []RenderInclude{}}
+    content = renderer.expand(rel, content, 0)
+
+    hash := contentHash(stored)
+    export := currentConfig(ctx).Export
+    stamp := newExportStamp(timeNow(ctx), export, actorName(ctx), rel, noteTitle(rel, stored), hash)
+    stamp["recipient"], stamp["share_id"] = recipient, shareID
+    var body bytes.Buffer
+    contentType := "text/html; charset=utf-8"
+    if format == "docx" {
+        contentType = docxContentType
+        err = writeNoteDocx(&body, stamp, stamp.expand(export.Header), stamp.expand(export.Footer), content)
+    } else {
+        err = writeNoteHTML(&body, export, stamp, newLanguageLookup(ctx).of(rel), content)
+    }
+    if err != nil {
+        logError(ctx, "Export of "+rel+" as "+format+" failed: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Export failed")
+        return
+    }
+
+    detail := "format=" + format + " sha256=" + hash
+    name := fileSafeName(strings.TrimSuffix(path.Base(rel), path.Ext(rel)))
+    if shareID != "" {
+        detail += fmt.Sprintf(" share_id=%s recipient=%q", shareID, recipient)
+        name += "-" + shareID
+        w.Header().Set("X-Share-Id", shareID)
+    }
+    logInfo(ctx, fmt.Sprintf("Exported %s as %s (%d includes)", rel, format, len(renderer.includes)))
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "file.export",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(ctx),
+        Target:   rel,
+        Detail:   detail,
+    })
+    w.Header().Set(contentHashHeader, hash)
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.`+format+`"`)
+    w.Write(body.Bytes())
+}
+
+// -------------------------------------------------------
+// func markdownHTML(content []byte) string
+// -------------------------------------------------------
+// Purpose:
+//   - HTML for a Markdown note (markdown.go), block by block.
+// Audit:
+//   - Headings get the /file/toc slugs as ids. All note text is
+//     escaped; checklist items print a box: ☐ open, ☑ done.
+// -------------------------------------------------------
+func markdownHTML(content []byte) string {
+    var out strings.Builder
+    writeBlocksHTML(&out, parseMarkdownBlocks(content), map[string]int{})
+    return out.String()
+}
+
+// writeBlocksHTML writes blocks; seen keeps heading slugs unique.
+func writeBlocksHTML(out *strings.Builder, blocks []mdBlock, seen map[string]int) {
+    for _, block := range blocks {
+        switch block.Kind {
+        case mdParagraph:
+            out.WriteString("<p>" + inlineHTML(block.Text) + "</p>\n")
+        case mdHeading:
+            fmt.Fprintf(out, "<h%d id=\"%s\">%s</h%d>\n", block.Level, html.EscapeString(headingSlug(block.Text, seen)), inlineHTML(block.Text), block.Level)
+        case mdCode:
+            out.WriteString("<pre><code>" + html.EscapeString(block.Text) + "</code></pre>\n")
+        case mdRule:
+            out.WriteString("<hr>\n")
+        case mdQuote:
+            out.WriteString("<blockquote>\n")
+            writeBlocksHTML(out, block.Children, seen)
+            out.WriteString("</blockquote>\n")
+        case mdList:
+            tag := "ul"
+            if block.Ordered {
+                tag = "ol"
+            }
+            out.WriteString("<" + tag + ">\n")
+            for _, item := range block.Items {
+                class, box := "", ""
+                if item.Task {
+                    class, box = ` class="task"`, "☐ "
+                    if item.Done {
+                        box = "☑ "
+                    }
+                }
+                out.WriteString("<li" + class + ">" + box + inlineHTML(item.Text))
+                if len(item.Children) > 0 {
+                    out.WriteString("\n")
+                    writeBlocksHTML(out, item.Children, seen)
+                }
+                out.WriteString("</li>\n")
+            }
+            out.WriteString("</" + tag + ">\n")
+        case mdTable:
+            aligns := make([]string, len(block.Aligns))
+            for c, align := range block.Aligns {
+                if align != "" {
+                    aligns[c] = ` style="text-align:` + align + `"`
+                }
+            }
+            row := func(cells []string, tag string) {
+                out.WriteString("<tr>")
+                for c, cell := range cells {
+                    out.WriteString("<" + tag + aligns[c] + ">" + inlineHTML(cell) + "</" + tag + ">")
+                }
+                out.WriteString("</tr>\n")
+            }
+            out.WriteString("<table>\n<thead>\n")
+            row(block.Header, "th")
+            out.WriteString("</thead>\n<tbody>\n")
+            for _, cells := range block.Rows {
+                row(cells, "td")
+            }
+            out.WriteString("</tbody>\n</table>\n")
+        }
+    }
+}
+
+// exportLinkSchemes are the link targets kept in exported HTML,
+// besides relative links.
+var exportLinkSchemes = []string{"http", "https", "mailto"}
+
+// -------------------------------------------------------
+// func exportLinkAllowed(link string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a Markdown link may become an <a href> in the export:
+//     relative, or one of exportLinkSchemes.
+// Audit:
+//   - Links with surrounding whitespace or control characters are
+//     refused, since browsers strip them before reading the scheme.
+// -------------------------------------------------------
+func exportLinkAllowed(link string) bool {
+    if link != strings.TrimSpace(link) {
+        return false
+    }
+    u, err := url.Parse(link)
+    if err != nil {
+        return false
+    }
+    return u.Scheme == "" || oneOf(strings.ToLower(u.Scheme), exportLinkSchemes)
+}
+
+// inlineHTML renders the inline spans of text; links outside
+// exportLinkAllowed keep their text but lose the link.
+func inlineHTML(text string) string {
+    var out strings.Builder
+    for _, span := range parseInline(text) {
+        if span.Break {
+            out.WriteString("<br>\n")
+            continue
+        }
+        value := html.EscapeString(span.Text)
+        if span.Code {
+            out.WriteString("<code>" + value + "</code>")
+            continue
+        }
+        if span.Link != "" && exportLinkAllowed(span.Link) {
+            value = `<a href="` + html.EscapeString(span.Link) + `">` + value + "</a>"
+        }
+        if span.Strike {
+            value = "<del>" + value + "</del>"
+        }
+        if span.Italic {
+            value = "<em>" + value + "</em>"
+        }
+        if span.Bold {
+            value = "<strong>" + value + "</strong>"
+        }
+        out.WriteString(value)
+    }
+    return out.String()
+}
@@ -0,0 +1,43 @@
+// -------------------------------------------------------
+// backend/handlers/export_html_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that the printable HTML export only links to safe
+//     targets.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestExportLinkAllowed(t *testing.T) {
+    for _, tc := range []struct {
+        link string
+        ok   bool
+    }{
+        {"https://example.com/memo", true},
+        {"http://example.com", true},
+        {"mailto:controller@example.com", true},
+        {"../close/q1.md", true},
+        {"#accruals", true},
+        {"javascript:alert(1)", false},
+        {"JavaScript:alert(1)", false},
+        {" javascript:alert(1)", false},
+        {"java\tscript:alert(1)", false},
+        {"data:text/html,<b>x</b>", false},
+        {"vbscript:msgbox", false},
+        {"file:///etc/passwd", false},
+    } {
+        if got := exportLinkAllowed(tc.link); got != tc.ok {
+            t.Errorf("exportLinkAllowed(%q) = %t, want %t", tc.link, got, tc.ok)
+        }
+    }
+
+    out := inlineHTML("see [memo](javascript:alert) and [site](https://example.com)")
+    if strings.Contains(out, "javascript") || !strings.Contains(out, `<a href="https://example.com">site</a>`) || !strings.Contains(out, "memo") {
+        t.Errorf("inlineHTML = %s", out)
+    }
+}
@@ -0,0 +1,361 @@
+// -------------------------------------------------------
+// backend/handlers/extract.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/extract-numbers?path=...: currency amounts,
+//     percentages and dates found in a note, with byte offsets and
+//     normalized values, for tooling that pulls figures out of
+//     free-form memos.
+// Audit:
+//   - Read-only; archived notes are read from their archive.
+//   - Amounts are normalized as exact decimal strings (no floating
+//     point): "($1.2m)" -> "-1200000" USD.
+//   - Dates are found first, then amounts, then percentages; a span
+//     claimed by one is never reported again as another.
+//   - Ambiguous slash dates follow date_order (mdy by default); a
+//     first number above 12 is always a day.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "math/big"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    numberCurrency = "currency"
+    numberPercent  = "percent"
+    numberDate     = "date"
+
+    maxExtractedNumbers = 5000
+)
+
+// -------------------------------------------------------
+// type ExtractedNumber
+// -------------------------------------------------------
+// Purpose:
+//   - One figure found in a note.
+// Audit:
+//   - Offset/End are byte offsets of Text; Line is 1-based.
+//   - Value: decimal amount (currency), percentage points
+//     (percent, "25 bps" -> "0.25"), or YYYY-MM-DD (date).
+// -------------------------------------------------------
+type ExtractedNumber struct {
+    Kind     string `json:"kind"`
+    Text     string `json:"text"`
+    Offset   int    `json:"offset"`
+    End      int    `json:"end"`
+    Line     int    `json:"line"`
+    Value    string `json:"value"`
+    Currency string `json:"currency,omitempty"`
+}
+
+const (
+    amountPattern = `(\d{1,3}(?:,\d{3})+|\d+)(\.\d+)?`
+    scalePattern  = `(?:\s?(k|thousand|mm|mn|m|million|bn|b|billion)\b)?`
+    monthPattern  = `(jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?`
+)
+
+var (
+    currencyPrefixRe = regexp.MustCompile(`(?i)(\(\s*)?(-\s?)?(usd|eur|gbp|jpy|cad|aud|chf|us\$|\$|€|£|¥)\s?(-)?` + amountPattern + scalePattern + `(\s*\))?`)
+    currencySuffixRe = regexp.MustCompile(`(?i)(-)?` + amountPattern + scalePattern + `\s?(usd|eur|gbp|jpy|cad|aud|chf|dollars|euros|pounds)\b`)
+    percentRe        = regexp.MustCompile(`(?i)([-+])?(\d+(?:\.\d+)?)\s?(%|percent\b|pct\b|bps\b|basis points\b)`)
+    isoDateRe        = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+    slashDateRe      = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4}|\d{2})\b`)
+    dayMonthDateRe   = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\s+` + monthPattern + `,?\s+(\d{4})\b`)
+    monthDayDateRe   = regexp.MustCompile(`(?i)\b` + monthPattern + `\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+)
+
+// currencyCodes maps symbols and words to ISO 4217 codes.
+var currencyCodes = map[string]string{
+    "$": "USD", "us$": "USD", "usd": "USD", "dollars": "USD",
+    "€": "EUR", "eur": "EUR", "euros": "EUR",
+    "£": "GBP", "gbp": "GBP", "pounds": "GBP",
+    "¥": "JPY", "jpy": "JPY",
+    "cad": "CAD", "aud": "AUD", "chf": "CHF",
+}
+
+// scaleFactors maps amount suffixes to multipliers.
+var scaleFactors = map[string]int64{
+    "k": 1e3, "thousand": 1e3,
+    "m": 1e6, "mm": 1e6, "mn": 1e6, "million": 1e6,
+    "b": 1e9, "bn": 1e9, "billion": 1e9,
+}
+
+// monthNumbers maps three-letter month prefixes to months.
+var monthNumbers = map[string]time.Month{
+    "jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+    "may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+    "sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// -------------------------------------------------------
+// func decimalString(whole, fraction, scale string, negative bool) string
+// -------------------------------------------------------
+// Purpose:
+//   - Exact decimal text of an amount like "1,234" ".5" "m".
+// -------------------------------------------------------
+func decimalString(whole, fraction, scale string, negative bool) string {
+    value, ok := new(big.Rat).SetString(strings.ReplaceAll(whole, ",", "") + fraction)
+    if !ok {
+        return ""
+    }
+    if factor, ok := scaleFactors[strings.ToLower(scale)]; ok {
+        value.Mul(value, new(big.Rat).SetInt64(factor))
+    }
+    if negative {
+        value.Neg(value)
+    }
+    text := value.FloatString(6)
+    text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+    if text == "-0" {
+        text = "0"
+    }
+    return text
+}
+
+// validDate formats year/month/day as YYYY-MM-DD if it is a real date.
+func validDate(year, month, day int) (string, bool) {
+    if year < 100 {
+        year += 2000
+    }
+    t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+    if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+        return "", false
+    }
+    return t.Format("2006-01-02"), true
+}
+
+// -------------------------------------------------------
+// type numberScanner
+// -------------------------------------------------------
+// Purpose:
+//   - Collects matches over content, skipping spans already
+//     claimed by an earlier match.
+// -------------------------------------------------------
+type numberScanner struct {
+    content string
+    claimed [][2]int
+    found   []ExtractedNumber
+}
+
+// free reports whether [start, end) overlaps no claimed span.
+func (s *numberScanner) free(start, end int) bool {
+    for _, span := range s.claimed {
+        if start < span[1] && span[0] < end {
+            return false
+        }
+    }
+    return true
+}
+
+// add records a match unless it overlaps an earlier one or is
+// glued to a neighbouring letter or digit.
+func (s *numberScanner) add(kind string, start, end int, value, currency string) {
+    if value == "" || !s.free(start, end) {
+        return
+    }
+    if start > 0 && isWordByte(s.content[start-1]) && isWordByte(s.content[start]) {
+        return
+    }
+    if end < len(s.content) && isWordByte(s.content[end]) && isWordByte(s.content[end-1]) {
+        return
+    }
+    s.claimed = append(s.claimed, [2]int{start, end})
+    s.found = append(s.found, ExtractedNumber{
+        Kind:     kind,
+        Text:     s.content[start:end],
+        Offset:   start,
+        End:      end,
+        Value:    value,
+        Currency: currency,
+    })
+}
+
+// isWordByte is an ASCII letter or digit.
+func isWordByte(c byte) bool {
+    return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// -------------------------------------------------------
+// func extractNumbers(content []byte, dayFirst bool) ([]ExtractedNumber, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - All dates, amounts and percentages in content, in document
+//     order, with line numbers.
+// Audit:
+//   - Capped at maxExtractedNumbers; the bool reports truncation.
+// -------------------------------------------------------
+func extractNumbers(content []byte, dayFirst bool) ([]ExtractedNumber, bool) {
+    s := &numberScanner{content: string(content)}
+    text := s.content
+    atoi := func(m []int, group int) int {
+        n, _ := strconv.Atoi(text[m[2*group]:m[2*group+1]])
+        return n
+    }
+    group := func(m []int, group int) string {
+        if m[2*group] < 0 {
+            return ""
+        }
+        return text[m[2*group]:m[2*group+1]]
+    }
+
+    for _, m := range isoDateRe.FindAllStringSubmatchIndex(text, -1) {
+        value, _ := validDate(atoi(m, 1), atoi(m, 2), atoi(m, 3))
+        s.add(numberDate, m[0], m[1], value, "")
+    }
+    for _, m := range dayMonthDateRe.FindAllStringSubmatchIndex(text, -1) {
+        value, _ := validDate(atoi(m, 3), int(monthNumbers[strings.ToLower(group(m, 2)[:3])]), atoi(m, 1))
+        s.add(numberDate, m[0], m[1], value, "")
+    }
+    for _, m := range monthDayDateRe.FindAllStringSubmatchIndex(text, -1) {
+        value, _ := validDate(atoi(m, 3), int(monthNumbers[strings.ToLower(group(m, 1)[:3])]), atoi(m, 2))
+        s.add(numberDate, m[0], m[1], value, "")
+    }
+    for _, m := range slashDateRe.FindAllStringSubmatchIndex(text, -1) {
+        month, day := atoi(m, 1), atoi(m, 2)
+        if dayFirst && day <= 12 || month > 12 {
+            month, day = day, month
+        }
+        value, _ := validDate(atoi(m, 3), month, day)
+        s.add(numberDate, m[0], m[1], value, "")
+    }
+
+    for _, m := range currencyPrefixRe.FindAllStringSubmatchIndex(text, -1) {
+        start, end := m[0], m[1]
+        open, close := group(m, 1) != "", group(m, 8) != ""
+        if open && !close {
+            start = m[4]
+            if m[4] < 0 {
+                start = m[6]
+            }
+        }
+        if close && !open {
+            end = m[2*8]
+        }
+        negative := open && close || group(m, 2) != "" || group(m, 4) != ""
+        value := decimalString(group(m, 5), group(m, 6), group(m, 7), negative)
+        s.add(numberCurrency, start, end, value, currencyCodes[strings.ToLower(group(m, 3))])
+    }
+    for _, m := range currencySuffixRe.FindAllStringSubmatchIndex(text, -1) {
+        value := decimalString(group(m, 2), group(m, 3), group(m, 4), group(m, 1) != "")
+        s.add(numberCurrency, m[0], m[1], value, currencyCodes[strings.ToLower(group(m, 5))])
+    }
+
+    for _, m := range percentRe.FindAllStringSubmatchIndex(text, -1) {
+        unit := strings.ToLower(group(m, 3))
+        value := group(m, 2)
+        if unit == "bps" || unit == "basis points" {
+            r, _ := new(big.Rat).SetString(value)
+            value = strings.TrimRight(strings.TrimRight(r.Quo(r, big.NewRat(100, 1)).FloatString(6), "0"), ".")
+        }
+        s.add(numberPercent, m[0], m[1], decimalString(value, "", "", group(m, 1) == "-"), "")
+    }
+
+    sort.Slice(s.found, func(i, j int) bool { return s.found[i].Offset < s.found[j].Offset })
+    line, scanned := 1, 0
+    for i := range s.found {
+        for ; scanned < s.found[i].Offset; scanned++ {
+            if text[scanned] == '\n' {
+                line++
+            }
+        }
+        s.found[i].Line = line
+    }
+    if len(s.found) > maxExtractedNumbers {
+        return s.found[:maxExtractedNumbers], true
+    }
+    return s.found, false
+}
+
+// -------------------------------------------------------
+// func HandleFileExtractNumbers(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/extract-numbers?path=...&kind=...&date_order=mdy|dmy:
+//     {"path", "numbers", "counts", "truncated"}.
+// Audit:
+//   - kind (currency, percent, date; comma-separated) filters the
+//     result; counts are per kind after filtering.
+//   - Notes over maxSearchFileBytes answer 413.
+// -------------------------------------------------------
+func HandleFileExtractNumbers(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    query := r.URL.Query()
+    file := query.Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    order := defaultString(query.Get("date_order"), "mdy")
+    if !oneOf(order, []string{"mdy", "dmy"}) {
+        writeFieldError(w, r, invalidField("date_order", "must be mdy or dmy"))
+        return
+    }
+    kinds := []string{}
+    if k := query.Get("kind"); k != "" {
+        kinds = strings.Split(k, ",")
+        for _, kind := range kinds {
+            if !oneOf(kind, []string{numberCurrency, numberPercent, numberDate}) {
+                writeFieldError(w, r, invalidField("kind", "must be currency, percent or date"))
+                return
+            }
+        }
+    }
+
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for extraction: "+absPath, "Internal error")
+        return
+    }
+    content, err = processContent(r.Context(), hookRead, relativeTo(r.Context(), absPath), content)
+    if err != nil {
+        writeProcessorError(w, r, relativeTo(r.Context(), absPath), err)
+        return
+    }
+    if len(content) > maxSearchFileBytes {
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Note exceeds %d bytes", maxSearchFileBytes))
+        return
+    }
+
+    all, truncated := extractNumbers(content, order == "dmy")
+    numbers := []ExtractedNumber{}
+    counts := map[string]int{}
+    for _, n := range all {
+        if len(kinds) > 0 && !oneOf(n.Kind, kinds) {
+            continue
+        }
+        numbers = append(numbers, n)
+        counts[n.Kind]++
+    }
+
+    rel := relativeTo(r.Context(), absPath)
+    logInfo(r.Context(), fmt.Sprintf("Extracted %d figures from %s", len(numbers), rel))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":      rel,
+        "numbers":   numbers,
+        "counts":    counts,
+        "truncated": truncated,
+    })
+}
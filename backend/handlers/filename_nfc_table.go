@@ -0,0 +1,1182 @@
+// -------------------------------------------------------
+// backend/handlers/filename_nfc_table.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Unicode 14.0.0 tables for normalizeNFC: canonical combining
+//     classes, full canonical decompositions and primary
+//     compositions.
+// Audit:
+//   - Generated by tools/gen_nfc_table.go from UnicodeData.txt and
+//     CompositionExclusions.txt. Do not edit by hand; regenerate
+//     when moving to a new Unicode version.
+//   - Hangul syllables are composed and decomposed algorithmically
+//     (filename_policy.go) and are not listed here.
+// -------------------------------------------------------
+
+package handlers
+
+// nfcCombiningClass holds every non-zero canonical combining class.
+var nfcCombiningClass = map[rune]uint8{
+    0x0300: 230, 0x0301: 230, 0x0302: 230, 0x0303: 230, 0x0304: 230, 0x0305: 230,
+    0x0306: 230, 0x0307: 230, 0x0308: 230, 0x0309: 230, 0x030A: 230, 0x030B: 230,
+    0x030C: 230, 0x030D: 230, 0x030E: 230, 0x030F: 230, 0x0310: 230, 0x0311: 230,
+    0x0312: 230, 0x0313: 230, 0x0314: 230, 0x0315: 232, 0x0316: 220, 0x0317: 220,
+    0x0318: 220, 0x0319: 220, 0x031A: 232, 0x031B: 216, 0x031C: 220, 0x031D: 220,
+    0x031E: 220, 0x031F: 220, 0x0320: 220, 0x0321: 202, 0x0322: 202, 0x0323: 220,
+    0x0324: 220, 0x0325: 220, 0x0326: 220, 0x0327: 202, 0x0328: 202, 0x0329: 220,
+    0x032A: 220, 0x032B: 220, 0x032C: 220, 0x032D: 220, 0x032E: 220, 0x032F: 220,
+    0x0330: 220, 0x0331: 220, 0x0332: 220, 0x0333: 220, 0x0334: 1, 0x0335: 1,
+    0x0336: 1, 0x0337: 1, 0x0338: 1, 0x0339: 220, 0x033A: 220, 0x033B: 220,
+    0x033C: 220, 0x033D: 230, 0x033E: 230, 0x033F: 230, 0x0340: 230, 0x0341: 230,
+    0x0342: 230, 0x0343: 230, 0x0344: 230, 0x0345: 240, 0x0346: 230, 0x0347: 220,
+    0x0348: 220, 0x0349: 220, 0x034A: 230, 0x034B: 230, 0x034C: 230, 0x034D: 220,
+    0x034E: 220, 0x0350: 230, 0x0351: 230, 0x0352: 230, 0x0353: 220, 0x0354: 220,
+    0x0355: 220, 0x0356: 220, 0x0357: 230, 0x0358: 232, 0x0359: 220, 0x035A: 220,
+    0x035B: 230, 0x035C: 233, 0x035D: 234, 0x035E: 234, 0x035F: 233, 0x0360: 234,
+    0x0361: 234, 0x0362: 233, 0x0363: 230, 0x0364: 230, 0x0365: 230, 0x0366: 230,
+    0x0367: 230, 0x0368: 230, 0x0369: 230, 0x036A: 230, 0x036B: 230, 0x036C: 230,
+    0x036D: 230, 0x036E: 230, 0x036F: 230, 0x0483: 230, 0x0484: 230, 0x0485: 230,
+    0x0486: 230, 0x0487: 230, 0x0591: 220, 0x0592: 230, 0x0593: 230, 0x0594: 230,
+    0x0595: 230, 0x0596: 220, 0x0597: 230, 0x0598: 230, 0x0599: 230, 0x059A: 222,
+    0x059B: 220, 0x059C: 230, 0x059D: 230, 0x059E: 230, 0x059F: 230, 0x05A0: 230,
+    0x05A1: 230, 0x05A2: 220, 0x05A3: 220, 0x05A4: 220, 0x05A5: 220, 0x05A6: 220,
+    0x05A7: 220, 0x05A8: 230, 0x05A9: 230, 0x05AA: 220, 0x05AB: 230, 0x05AC: 230,
+    0x05AD: 222, 0x05AE: 228, 0x05AF: 230, 0x05B0: 10, 0x05B1: 11, 0x05B2: 12,
+    0x05B3: 13, 0x05B4: 14, 0x05B5: 15, 0x05B6: 16, 0x05B7: 17, 0x05B8: 18,
+    0x05B9: 19, 0x05BA: 19, 0x05BB: 20, 0x05BC: 21, 0x05BD: 22, 0x05BF: 23,
+    0x05C1: 24, 0x05C2: 25, 0x05C4: 230, 0x05C5: 220, 0x05C7: 18, 0x0610: 230,
+    0x0611: 230, 0x0612: 230, 0x0613: 230, 0x0614: 230, 0x0615: 230, 0x0616: 230,
+    0x0617: 230, 0x0618: 30, 0x0619: 31, 0x061A: 32, 0x064B: 27, 0x064C: 28,
+    0x064D: 29, 0x064E: 30, 0x064F: 31, 0x0650: 32, 0x0651: 33, 0x0652: 34,
+    0x0653: 230, 0x0654: 230, 0x0655: 220, 0x0656: 220, 0x0657: 230, 0x0658: 230,
+    0x0659: 230, 0x065A: 230, 0x065B: 230, 0x065C: 220, 0x065D: 230, 0x065E: 230,
+    0x065F: 220, 0x0670: 35, 0x06D6: 230, 0x06D7: 230, 0x06D8: 230, 0x06D9: 230,
+    0x06DA: 230, 0x06DB: 230, 0x06DC: 230, 0x06DF: 230, 0x06E0: 230, 0x06E1: 230,
+    0x06E2: 230, 0x06E3: 220, 0x06E4: 230, 0x06E7: 230, 0x06E8: 230, 0x06EA: 220,
+    0x06EB: 230, 0x06EC: 230, 0x06ED: 220, 0x0711: 36, 0x0730: 230, 0x0731: 220,
+    0x0732: 230, 0x0733: 230, 0x0734: 220, 0x0735: 230, 0x0736: 230, 0x0737: 220,
+    0x0738: 220, 0x0739: 220, 0x073A: 230, 0x073B: 220, 0x073C: 220, 0x073D: 230,
+    0x073E: 220, 0x073F: 230, 0x0740: 230, 0x0741: 230, 0x0742: 220, 0x0743: 230,
+    0x0744: 220, 0x0745: 230, 0x0746: 220, 0x0747: 230, 0x0748: 220, 0x0749: 230,
+    0x074A: 230, 0x07EB: 230, 0x07EC: 230, 0x07ED: 230, 0x07EE: 230, 0x07EF: 230,
+    0x07F0: 230, 0x07F1: 230, 0x07F2: 220, 0x07F3: 230, 0x07FD: 220, 0x0816: 230,
+    0x0817: 230, 0x0818: 230, 0x0819: 230, 0x081B: 230, 0x081C: 230, 0x081D: 230,
+    0x081E: 230, 0x081F: 230, 0x0820: 230, 0x0821: 230, 0x0822: 230, 0x0823: 230,
+    0x0825: 230, 0x0826: 230, 0x0827: 230, 0x0829: 230, 0x082A: 230, 0x082B: 230,
+    0x082C: 230, 0x082D: 230, 0x0859: 220, 0x085A: 220, 0x085B: 220, 0x0898: 230,
+    0x0899: 220, 0x089A: 220, 0x089B: 220, 0x089C: 230, 0x089D: 230, 0x089E: 230,
+    0x089F: 230, 0x08CA: 230, 0x08CB: 230, 0x08CC: 230, 0x08CD: 230, 0x08CE: 230,
+    0x08CF: 220, 0x08D0: 220, 0x08D1: 220, 0x08D2: 220, 0x08D3: 220, 0x08D4: 230,
+    0x08D5: 230, 0x08D6: 230, 0x08D7: 230, 0x08D8: 230, 0x08D9: 230, 0x08DA: 230,
+    0x08DB: 230, 0x08DC: 230, 0x08DD: 230, 0x08DE: 230, 0x08DF: 230, 0x08E0: 230,
+    0x08E1: 230, 0x08E3: 220, 0x08E4: 230, 0x08E5: 230, 0x08E6: 220, 0x08E7: 230,
+    0x08E8: 230, 0x08E9: 220, 0x08EA: 230, 0x08EB: 230, 0x08EC: 230, 0x08ED: 220,
+    0x08EE: 220, 0x08EF: 220, 0x08F0: 27, 0x08F1: 28, 0x08F2: 29, 0x08F3: 230,
+    0x08F4: 230, 0x08F5: 230, 0x08F6: 220, 0x08F7: 230, 0x08F8: 230, 0x08F9: 220,
+    0x08FA: 220, 0x08FB: 230, 0x08FC: 230, 0x08FD: 230, 0x08FE: 230, 0x08FF: 230,
+    0x093C: 7, 0x094D: 9, 0x0951: 230, 0x0952: 220, 0x0953: 230, 0x0954: 230,
+    0x09BC: 7, 0x09CD: 9, 0x09FE: 230, 0x0A3C: 7, 0x0A4D: 9, 0x0ABC: 7,
+    0x0ACD: 9, 0x0B3C: 7, 0x0B4D: 9, 0x0BCD: 9, 0x0C3C: 7, 0x0C4D: 9,
+    0x0C55: 84, 0x0C56: 91, 0x0CBC: 7, 0x0CCD: 9, 0x0D3B: 9, 0x0D3C: 9,
+    0x0D4D: 9, 0x0DCA: 9, 0x0E38: 103, 0x0E39: 103, 0x0E3A: 9, 0x0E48: 107,
+    0x0E49: 107, 0x0E4A: 107, 0x0E4B: 107, 0x0EB8: 118, 0x0EB9: 118, 0x0EBA: 9,
+    0x0EC8: 122, 0x0EC9: 122, 0x0ECA: 122, 0x0ECB: 122, 0x0F18: 220, 0x0F19: 220,
+    0x0F35: 220, 0x0F37: 220, 0x0F39: 216, 0x0F71: 129, 0x0F72: 130, 0x0F74: 132,
+    0x0F7A: 130, 0x0F7B: 130, 0x0F7C: 130, 0x0F7D: 130, 0x0F80: 130, 0x0F82: 230,
+    0x0F83: 230, 0x0F84: 9, 0x0F86: 230, 0x0F87: 230, 0x0FC6: 220, 0x1037: 7,
+    0x1039: 9, 0x103A: 9, 0x108D: 220, 0x135D: 230, 0x135E: 230, 0x135F: 230,
+    0x1714: 9, 0x1715: 9, 0x1734: 9, 0x17D2: 9, 0x17DD: 230, 0x18A9: 228,
+    0x1939: 222, 0x193A: 230, 0x193B: 220, 0x1A17: 230, 0x1A18: 220, 0x1A60: 9,
+    0x1A75: 230, 0x1A76: 230, 0x1A77: 230, 0x1A78: 230, 0x1A79: 230, 0x1A7A: 230,
+    0x1A7B: 230, 0x1A7C: 230, 0x1A7F: 220, 0x1AB0: 230, 0x1AB1: 230, 0x1AB2: 230,
+    0x1AB3: 230, 0x1AB4: 230, 0x1AB5: 220, 0x1AB6: 220, 0x1AB7: 220, 0x1AB8: 220,
+    0x1AB9: 220, 0x1ABA: 220, 0x1ABB: 230, 0x1ABC: 230, 0x1ABD: 220, 0x1ABF: 220,
+    0x1AC0: 220, 0x1AC1: 230, 0x1AC2: 230, 0x1AC3: 220, 0x1AC4: 220, 0x1AC5: 230,
+    0x1AC6: 230, 0x1AC7: 230, 0x1AC8: 230, 0x1AC9: 230, 0x1ACA: 220, 0x1ACB: 230,
+    0x1ACC: 230, 0x1ACD: 230, 0x1ACE: 230, 0x1B34: 7, 0x1B44: 9, 0x1B6B: 230,
+    0x1B6C: 220, 0x1B6D: 230, 0x1B6E: 230, 0x1B6F: 230, 0x1B70: 230, 0x1B71: 230,
+    0x1B72: 230, 0x1B73: 230, 0x1BAA: 9, 0x1BAB: 9, 0x1BE6: 7, 0x1BF2: 9,
+    0x1BF3: 9, 0x1C37: 7, 0x1CD0: 230, 0x1CD1: 230, 0x1CD2: 230, 0x1CD4: 1,
+    0x1CD5: 220, 0x1CD6: 220, 0x1CD7: 220, 0x1CD8: 220, 0x1CD9: 220, 0x1CDA: 230,
+    0x1CDB: 230, 0x1CDC: 220, 0x1CDD: 220, 0x1CDE: 220, 0x1CDF: 220, 0x1CE0: 230,
+    0x1CE2: 1, 0x1CE3: 1, 0x1CE4: 1, 0x1CE5: 1, 0x1CE6: 1, 0x1CE7: 1,
+    0x1CE8: 1, 0x1CED: 220, 0x1CF4: 230, 0x1CF8: 230, 0x1CF9: 230, 0x1DC0: 230,
+    0x1DC1: 230, 0x1DC2: 220, 0x1DC3: 230, 0x1DC4: 230, 0x1DC5: 230, 0x1DC6: 230,
+    0x1DC7: 230, 0x1DC8: 230, 0x1DC9: 230, 0x1DCA: 220, 0x1DCB: 230, 0x1DCC: 230,
+    0x1DCD: 234, 0x1DCE: 214, 0x1DCF: 220, 0x1DD0: 202, 0x1DD1: 230, 0x1DD2: 230,
+    0x1DD3: 230, 0x1DD4: 230, 0x1DD5: 230, 0x1DD6: 230, 0x1DD7: 230, 0x1DD8: 230,
+    0x1DD9: 230, 0x1DDA: 230, 0x1DDB: 230, 0x1DDC: 230, 0x1DDD: 230, 0x1DDE: 230,
+    0x1DDF: 230, 0x1DE0: 230, 0x1DE1: 230, 0x1DE2: 230, 0x1DE3: 230, 0x1DE4: 230,
+    0x1DE5: 230, 0x1DE6: 230, 0x1DE7: 230, 0x1DE8: 230, 0x1DE9: 230, 0x1DEA: 230,
+    0x1DEB: 230, 0x1DEC: 230, 0x1DED: 230, 0x1DEE: 230, 0x1DEF: 230, 0x1DF0: 230,
+    0x1DF1: 230, 0x1DF2: 230, 0x1DF3: 230, 0x1DF4: 230, 0x1DF5: 230, 0x1DF6: 232,
+    0x1DF7: 228, 0x1DF8: 228, 0x1DF9: 220, 0x1DFA: 218, 0x1DFB: 230, 0x1DFC: 233,
+    0x1DFD: 220, 0x1DFE: 230, 0x1DFF: 220, 0x20D0: 230, 0x20D1: 230, 0x20D2: 1,
+    0x20D3: 1, 0x20D4: 230, 0x20D5: 230, 0x20D6: 230, 0x20D7: 230, 0x20D8: 1,
+    0x20D9: 1, 0x20DA: 1, 0x20DB: 230, 0x20DC: 230, 0x20E1: 230, 0x20E5: 1,
+    0x20E6: 1, 0x20E7: 230, 0x20E8: 220, 0x20E9: 230, 0x20EA: 1, 0x20EB: 1,
+    0x20EC: 220, 0x20ED: 220, 0x20EE: 220, 0x20EF: 220, 0x20F0: 230, 0x2CEF: 230,
+    0x2CF0: 230, 0x2CF1: 230, 0x2D7F: 9, 0x2DE0: 230, 0x2DE1: 230, 0x2DE2: 230,
+    0x2DE3: 230, 0x2DE4: 230, 0x2DE5: 230, 0x2DE6: 230, 0x2DE7: 230, 0x2DE8: 230,
+    0x2DE9: 230, 0x2DEA: 230, 0x2DEB: 230, 0x2DEC: 230, 0x2DED: 230, 0x2DEE: 230,
+    0x2DEF: 230, 0x2DF0: 230, 0x2DF1: 230, 0x2DF2: 230, 0x2DF3: 230, 0x2DF4: 230,
+    0x2DF5: 230, 0x2DF6: 230, 0x2DF7: 230, 0x2DF8: 230, 0x2DF9: 230, 0x2DFA: 230,
+    0x2DFB: 230, 0x2DFC: 230, 0x2DFD: 230, 0x2DFE: 230, 0x2DFF: 230, 0x302A: 218,
+    0x302B: 228, 0x302C: 232, 0x302D: 222, 0x302E: 224, 0x302F: 224, 0x3099: 8,
+    0x309A: 8, 0xA66F: 230, 0xA674: 230, 0xA675: 230, 0xA676: 230, 0xA677: 230,
+    0xA678: 230, 0xA679: 230, 0xA67A: 230, 0xA67B: 230, 0xA67C: 230, 0xA67D: 230,
+    0xA69E: 230, 0xA69F: 230, 0xA6F0: 230, 0xA6F1: 230, 0xA806: 9, 0xA82C: 9,
+    0xA8C4: 9, 0xA8E0: 230, 0xA8E1: 230, 0xA8E2: 230, 0xA8E3: 230, 0xA8E4: 230,
+    0xA8E5: 230, 0xA8E6: 230, 0xA8E7: 230, 0xA8E8: 230, 0xA8E9: 230, 0xA8EA: 230,
+    0xA8EB: 230, 0xA8EC: 230, 0xA8ED: 230, 0xA8EE: 230, 0xA8EF: 230, 0xA8F0: 230,
+    0xA8F1: 230, 0xA92B: 220, 0xA92C: 220, 0xA92D: 220, 0xA953: 9, 0xA9B3: 7,
+    0xA9C0: 9, 0xAAB0: 230, 0xAAB2: 230, 0xAAB3: 230, 0xAAB4: 220, 0xAAB7: 230,
+    0xAAB8: 230, 0xAABE: 230, 0xAABF: 230, 0xAAC1: 230, 0xAAF6: 9, 0xABED: 9,
+    0xFB1E: 26, 0xFE20: 230, 0xFE21: 230, 0xFE22: 230, 0xFE23: 230, 0xFE24: 230,
+    0xFE25: 230, 0xFE26: 230, 0xFE27: 220, 0xFE28: 220, 0xFE29: 220, 0xFE2A: 220,
+    0xFE2B: 220, 0xFE2C: 220, 0xFE2D: 220, 0xFE2E: 230, 0xFE2F: 230, 0x101FD: 220,
+    0x102E0: 220, 0x10376: 230, 0x10377: 230, 0x10378: 230, 0x10379: 230, 0x1037A: 230,
+    0x10A0D: 220, 0x10A0F: 230, 0x10A38: 230, 0x10A39: 1, 0x10A3A: 220, 0x10A3F: 9,
+    0x10AE5: 230, 0x10AE6: 220, 0x10D24: 230, 0x10D25: 230, 0x10D26: 230, 0x10D27: 230,
+    0x10EAB: 230, 0x10EAC: 230, 0x10F46: 220, 0x10F47: 220, 0x10F48: 230, 0x10F49: 230,
+    0x10F4A: 230, 0x10F4B: 220, 0x10F4C: 230, 0x10F4D: 220, 0x10F4E: 220, 0x10F4F: 220,
+    0x10F50: 220, 0x10F82: 230, 0x10F83: 220, 0x10F84: 230, 0x10F85: 220, 0x11046: 9,
+    0x11070: 9, 0x1107F: 9, 0x110B9: 9, 0x110BA: 7, 0x11100: 230, 0x11101: 230,
+    0x11102: 230, 0x11133: 9, 0x11134: 9, 0x11173: 7, 0x111C0: 9, 0x111CA: 7,
+    0x11235: 9, 0x11236: 7, 0x112E9: 7, 0x112EA: 9, 0x1133B: 7, 0x1133C: 7,
+    0x1134D: 9, 0x11366: 230, 0x11367: 230, 0x11368: 230, 0x11369: 230, 0x1136A: 230,
+    0x1136B: 230, 0x1136C: 230, 0x11370: 230, 0x11371: 230, 0x11372: 230, 0x11373: 230,
+    0x11374: 230, 0x11442: 9, 0x11446: 7, 0x1145E: 230, 0x114C2: 9, 0x114C3: 7,
+    0x115BF: 9, 0x115C0: 7, 0x1163F: 9, 0x116B6: 9, 0x116B7: 7, 0x1172B: 9,
+    0x11839: 9, 0x1183A: 7, 0x1193D: 9, 0x1193E: 9, 0x11943: 7, 0x119E0: 9,
+    0x11A34: 9, 0x11A47: 9, 0x11A99: 9, 0x11C3F: 9, 0x11D42: 7, 0x11D44: 9,
+    0x11D45: 9, 0x11D97: 9, 0x16AF0: 1, 0x16AF1: 1, 0x16AF2: 1, 0x16AF3: 1,
+    0x16AF4: 1, 0x16B30: 230, 0x16B31: 230, 0x16B32: 230, 0x16B33: 230, 0x16B34: 230,
+    0x16B35: 230, 0x16B36: 230, 0x16FF0: 6, 0x16FF1: 6, 0x1BC9E: 1, 0x1D165: 216,
+    0x1D166: 216, 0x1D167: 1, 0x1D168: 1, 0x1D169: 1, 0x1D16D: 226, 0x1D16E: 216,
+    0x1D16F: 216, 0x1D170: 216, 0x1D171: 216, 0x1D172: 216, 0x1D17B: 220, 0x1D17C: 220,
+    0x1D17D: 220, 0x1D17E: 220, 0x1D17F: 220, 0x1D180: 220, 0x1D181: 220, 0x1D182: 220,
+    0x1D185: 230, 0x1D186: 230, 0x1D187: 230, 0x1D188: 230, 0x1D189: 230, 0x1D18A: 220,
+    0x1D18B: 220, 0x1D1AA: 230, 0x1D1AB: 230, 0x1D1AC: 230, 0x1D1AD: 230, 0x1D242: 230,
+    0x1D243: 230, 0x1D244: 230, 0x1E000: 230, 0x1E001: 230, 0x1E002: 230, 0x1E003: 230,
+    0x1E004: 230, 0x1E005: 230, 0x1E006: 230, 0x1E008: 230, 0x1E009: 230, 0x1E00A: 230,
+    0x1E00B: 230, 0x1E00C: 230, 0x1E00D: 230, 0x1E00E: 230, 0x1E00F: 230, 0x1E010: 230,
+    0x1E011: 230, 0x1E012: 230, 0x1E013: 230, 0x1E014: 230, 0x1E015: 230, 0x1E016: 230,
+    0x1E017: 230, 0x1E018: 230, 0x1E01B: 230, 0x1E01C: 230, 0x1E01D: 230, 0x1E01E: 230,
+    0x1E01F: 230, 0x1E020: 230, 0x1E021: 230, 0x1E023: 230, 0x1E024: 230, 0x1E026: 230,
+    0x1E027: 230, 0x1E028: 230, 0x1E029: 230, 0x1E02A: 230, 0x1E130: 230, 0x1E131: 230,
+    0x1E132: 230, 0x1E133: 230, 0x1E134: 230, 0x1E135: 230, 0x1E136: 230, 0x1E2AE: 230,
+    0x1E2EC: 230, 0x1E2ED: 230, 0x1E2EE: 230, 0x1E2EF: 230, 0x1E8D0: 220, 0x1E8D1: 220,
+    0x1E8D2: 220, 0x1E8D3: 220, 0x1E8D4: 220, 0x1E8D5: 220, 0x1E8D6: 220, 0x1E944: 230,
+    0x1E945: 230, 0x1E946: 230, 0x1E947: 230, 0x1E948: 230, 0x1E949: 230, 0x1E94A: 7,
+}
+
+// nfcDecompositions maps a rune to its full canonical decomposition.
+var nfcDecompositions = map[rune]string{
+    0x00C0: "A\u0300", 0x00C1: "A\u0301", 0x00C2: "A\u0302",
+    0x00C3: "A\u0303", 0x00C4: "A\u0308", 0x00C5: "A\u030a",
+    0x00C7: "C\u0327", 0x00C8: "E\u0300", 0x00C9: "E\u0301",
+    0x00CA: "E\u0302", 0x00CB: "E\u0308", 0x00CC: "I\u0300",
+    0x00CD: "I\u0301", 0x00CE: "I\u0302", 0x00CF: "I\u0308",
+    0x00D1: "N\u0303", 0x00D2: "O\u0300", 0x00D3: "O\u0301",
+    0x00D4: "O\u0302", 0x00D5: "O\u0303", 0x00D6: "O\u0308",
+    0x00D9: "U\u0300", 0x00DA: "U\u0301", 0x00DB: "U\u0302",
+    0x00DC: "U\u0308", 0x00DD: "Y\u0301", 0x00E0: "a\u0300",
+    0x00E1: "a\u0301", 0x00E2: "a\u0302", 0x00E3: "a\u0303",
+    0x00E4: "a\u0308", 0x00E5: "a\u030a", 0x00E7: "c\u0327",
+    0x00E8: "e\u0300", 0x00E9: "e\u0301", 0x00EA: "e\u0302",
+    0x00EB: "e\u0308", 0x00EC: "i\u0300", 0x00ED: "i\u0301",
+    0x00EE: "i\u0302", 0x00EF: "i\u0308", 0x00F1: "n\u0303",
+    0x00F2: "o\u0300", 0x00F3: "o\u0301", 0x00F4: "o\u0302",
+    0x00F5: "o\u0303", 0x00F6: "o\u0308", 0x00F9: "u\u0300",
+    0x00FA: "u\u0301", 0x00FB: "u\u0302", 0x00FC: "u\u0308",
+    0x00FD: "y\u0301", 0x00FF: "y\u0308", 0x0100: "A\u0304",
+    0x0101: "a\u0304", 0x0102: "A\u0306", 0x0103: "a\u0306",
+    0x0104: "A\u0328", 0x0105: "a\u0328", 0x0106: "C\u0301",
+    0x0107: "c\u0301", 0x0108: "C\u0302", 0x0109: "c\u0302",
+    0x010A: "C\u0307", 0x010B: "c\u0307", 0x010C: "C\u030c",
+    0x010D: "c\u030c", 0x010E: "D\u030c", 0x010F: "d\u030c",
+    0x0112: "E\u0304", 0x0113: "e\u0304", 0x0114: "E\u0306",
+    0x0115: "e\u0306", 0x0116: "E\u0307", 0x0117: "e\u0307",
+    0x0118: "E\u0328", 0x0119: "e\u0328", 0x011A: "E\u030c",
+    0x011B: "e\u030c", 0x011C: "G\u0302", 0x011D: "g\u0302",
+    0x011E: "G\u0306", 0x011F: "g\u0306", 0x0120: "G\u0307",
+    0x0121: "g\u0307", 0x0122: "G\u0327", 0x0123: "g\u0327",
+    0x0124: "H\u0302", 0x0125: "h\u0302", 0x0128: "I\u0303",
+    0x0129: "i\u0303", 0x012A: "I\u0304", 0x012B: "i\u0304",
+    0x012C: "I\u0306", 0x012D: "i\u0306", 0x012E: "I\u0328",
+    0x012F: "i\u0328", 0x0130: "I\u0307", 0x0134: "J\u0302",
+    0x0135: "j\u0302", 0x0136: "K\u0327", 0x0137: "k\u0327",
+    0x0139: "L\u0301", 0x013A: "l\u0301", 0x013B: "L\u0327",
+    0x013C: "l\u0327", 0x013D: "L\u030c", 0x013E: "l\u030c",
+    0x0143: "N\u0301", 0x0144: "n\u0301", 0x0145: "N\u0327",
+    0x0146: "n\u0327", 0x0147: "N\u030c", 0x0148: "n\u030c",
+    0x014C: "O\u0304", 0x014D: "o\u0304", 0x014E: "O\u0306",
+    0x014F: "o\u0306", 0x0150: "O\u030b", 0x0151: "o\u030b",
+    0x0154: "R\u0301", 0x0155: "r\u0301", 0x0156: "R\u0327",
+    0x0157: "r\u0327", 0x0158: "R\u030c", 0x0159: "r\u030c",
+    0x015A: "S\u0301", 0x015B: "s\u0301", 0x015C: "S\u0302",
+    0x015D: "s\u0302", 0x015E: "S\u0327", 0x015F: "s\u0327",
+    0x0160: "S\u030c", 0x0161: "s\u030c", 0x0162: "T\u0327",
+    0x0163: "t\u0327", 0x0164: "T\u030c", 0x0165: "t\u030c",
+    0x0168: "U\u0303", 0x0169: "u\u0303", 0x016A: "U\u0304",
+    0x016B: "u\u0304", 0x016C: "U\u0306", 0x016D: "u\u0306",
+    0x016E: "U\u030a", 0x016F: "u\u030a", 0x0170: "U\u030b",
+    0x0171: "u\u030b", 0x0172: "U\u0328", 0x0173: "u\u0328",
+    0x0174: "W\u0302", 0x0175: "w\u0302", 0x0176: "Y\u0302",
+    0x0177: "y\u0302", 0x0178: "Y\u0308", 0x0179: "Z\u0301",
+    0x017A: "z\u0301", 0x017B: "Z\u0307", 0x017C: "z\u0307",
+    0x017D: "Z\u030c", 0x017E: "z\u030c", 0x01A0: "O\u031b",
+    0x01A1: "o\u031b", 0x01AF: "U\u031b", 0x01B0: "u\u031b",
+    0x01CD: "A\u030c", 0x01CE: "a\u030c", 0x01CF: "I\u030c",
+    0x01D0: "i\u030c", 0x01D1: "O\u030c", 0x01D2: "o\u030c",
+    0x01D3: "U\u030c", 0x01D4: "u\u030c", 0x01D5: "U\u0308\u0304",
+    0x01D6: "u\u0308\u0304", 0x01D7: "U\u0308\u0301", 0x01D8: "u\u0308\u0301",
+    0x01D9: "U\u0308\u030c", 0x01DA: "u\u0308\u030c", 0x01DB: "U\u0308\u0300",
+    0x01DC: "u\u0308\u0300", 0x01DE: "A\u0308\u0304", 0x01DF: "a\u0308\u0304",
+    0x01E0: "A\u0307\u0304", 0x01E1: "a\u0307\u0304", 0x01E2: "\u00c6\u0304",
+    0x01E3: "\u00e6\u0304", 0x01E6: "G\u030c", 0x01E7: "g\u030c",
+    0x01E8: "K\u030c", 0x01E9: "k\u030c", 0x01EA: "O\u0328",
+    0x01EB: "o\u0328", 0x01EC: "O\u0328\u0304", 0x01ED: "o\u0328\u0304",
+    0x01EE: "\u01b7\u030c", 0x01EF: "\u0292\u030c", 0x01F0: "j\u030c",
+    0x01F4: "G\u0301", 0x01F5: "g\u0301", 0x01F8: "N\u0300",
+    0x01F9: "n\u0300", 0x01FA: "A\u030a\u0301", 0x01FB: "a\u030a\u0301",
+    0x01FC: "\u00c6\u0301", 0x01FD: "\u00e6\u0301", 0x01FE: "\u00d8\u0301",
+    0x01FF: "\u00f8\u0301", 0x0200: "A\u030f", 0x0201: "a\u030f",
+    0x0202: "A\u0311", 0x0203: "a\u0311", 0x0204: "E\u030f",
+    0x0205: "e\u030f", 0x0206: "E\u0311", 0x0207: "e\u0311",
+    0x0208: "I\u030f", 0x0209: "i\u030f", 0x020A: "I\u0311",
+    0x020B: "i\u0311", 0x020C: "O\u030f", 0x020D: "o\u030f",
+    0x020E: "O\u0311", 0x020F: "o\u0311", 0x0210: "R\u030f",
+    0x0211: "r\u030f", 0x0212: "R\u0311", 0x0213: "r\u0311",
+    0x0214: "U\u030f", 0x0215: "u\u030f", 0x0216: "U\u0311",
+    0x0217: "u\u0311", 0x0218: "S\u0326", 0x0219: "s\u0326",
+    0x021A: "T\u0326", 0x021B: "t\u0326", 0x021E: "H\u030c",
+    0x021F: "h\u030c", 0x0226: "A\u0307", 0x0227: "a\u0307",
+    0x0228: "E\u0327", 0x0229: "e\u0327", 0x022A: "O\u0308\u0304",
+    0x022B: "o\u0308\u0304", 0x022C: "O\u0303\u0304", 0x022D: "o\u0303\u0304",
+    0x022E: "O\u0307", 0x022F: "o\u0307", 0x0230: "O\u0307\u0304",
+    0x0231: "o\u0307\u0304", 0x0232: "Y\u0304", 0x0233: "y\u0304",
+    0x0340: "\u0300", 0x0341: "\u0301", 0x0343: "\u0313",
+    0x0344: "\u0308\u0301", 0x0374: "\u02b9", 0x037E: ";",
+    0x0385: "\u00a8\u0301", 0x0386: "\u0391\u0301", 0x0387: "\u00b7",
+    0x0388: "\u0395\u0301", 0x0389: "\u0397\u0301", 0x038A: "\u0399\u0301",
+    0x038C: "\u039f\u0301", 0x038E: "\u03a5\u0301", 0x038F: "\u03a9\u0301",
+    0x0390: "\u03b9\u0308\u0301", 0x03AA: "\u0399\u0308", 0x03AB: "\u03a5\u0308",
+    0x03AC: "\u03b1\u0301", 0x03AD: "\u03b5\u0301", 0x03AE: "\u03b7\u0301",
+    0x03AF: "\u03b9\u0301", 0x03B0: "\u03c5\u0308\u0301", 0x03CA: "\u03b9\u0308",
+    0x03CB: "\u03c5\u0308", 0x03CC: "\u03bf\u0301", 0x03CD: "\u03c5\u0301",
+    0x03CE: "\u03c9\u0301", 0x03D3: "\u03d2\u0301", 0x03D4: "\u03d2\u0308",
+    0x0400: "\u0415\u0300", 0x0401: "\u0415\u0308", 0x0403: "\u0413\u0301",
+    0x0407: "\u0406\u0308", 0x040C: "\u041a\u0301", 0x040D: "\u0418\u0300",
+    0x040E: "\u0423\u0306", 0x0419: "\u0418\u0306", 0x0439: "\u0438\u0306",
+    0x0450: "\u0435\u0300", 0x0451: "\u0435\u0308", 0x0453: "\u0433\u0301",
+    0x0457: "\u0456\u0308", 0x045C: "\u043a\u0301", 0x045D: "\u0438\u0300",
+    0x045E: "\u0443\u0306", 0x0476: "\u0474\u030f", 0x0477: "\u0475\u030f",
+    0x04C1: "\u0416\u0306", 0x04C2: "\u0436\u0306", 0x04D0: "\u0410\u0306",
+    0x04D1: "\u0430\u0306", 0x04D2: "\u0410\u0308", 0x04D3: "\u0430\u0308",
+    0x04D6: "\u0415\u0306", 0x04D7: "\u0435\u0306", 0x04DA: "\u04d8\u0308",
+    0x04DB: "\u04d9\u0308", 0x04DC: "\u0416\u0308", 0x04DD: "\u0436\u0308",
+    0x04DE: "\u0417\u0308", 0x04DF: "\u0437\u0308", 0x04E2: "\u0418\u0304",
+    0x04E3: "\u0438\u0304", 0x04E4: "\u0418\u0308", 0x04E5: "\u0438\u0308",
+    0x04E6: "\u041e\u0308", 0x04E7: "\u043e\u0308", 0x04EA: "\u04e8\u0308",
+    0x04EB: "\u04e9\u0308", 0x04EC: "\u042d\u0308", 0x04ED: "\u044d\u0308",
+    0x04EE: "\u0423\u0304", 0x04EF: "\u0443\u0304", 0x04F0: "\u0423\u0308",
+    0x04F1: "\u0443\u0308", 0x04F2: "\u0423\u030b", 0x04F3: "\u0443\u030b",
+    0x04F4: "\u0427\u0308", 0x04F5: "\u0447\u0308", 0x04F8: "\u042b\u0308",
+    0x04F9: "\u044b\u0308", 0x0622: "\u0627\u0653", 0x0623: "\u0627\u0654",
+    0x0624: "\u0648\u0654", 0x0625: "\u0627\u0655", 0x0626: "\u064a\u0654",
+    0x06C0: "\u06d5\u0654", 0x06C2: "\u06c1\u0654", 0x06D3: "\u06d2\u0654",
+    0x0929: "\u0928\u093c", 0x0931: "\u0930\u093c", 0x0934: "\u0933\u093c",
+    0x0958: "\u0915\u093c", 0x0959: "\u0916\u093c", 0x095A: "\u0917\u093c",
+    0x095B: "\u091c\u093c", 0x095C: "\u0921\u093c", 0x095D: "\u0922\u093c",
+    0x095E: "\u092b\u093c", 0x095F: "\u092f\u093c", 0x09CB: "\u09c7\u09be",
+    0x09CC: "\u09c7\u09d7", 0x09DC: "\u09a1\u09bc", 0x09DD: "\u09a2\u09bc",
+    0x09DF: "\u09af\u09bc", 0x0A33: "\u0a32\u0a3c", 0x0A36: "\u0a38\u0a3c",
+    0x0A59: "\u0a16\u0a3c", 0x0A5A: "\u0a17\u0a3c", 0x0A5B: "\u0a1c\u0a3c",
+    0x0A5E: "\u0a2b\u0a3c", 0x0B48: "\u0b47\u0b56", 0x0B4B: "\u0b47\u0b3e",
+    0x0B4C: "\u0b47\u0b57", 0x0B5C: "\u0b21\u0b3c", 0x0B5D: "\u0b22\u0b3c",
+    0x0B94: "\u0b92\u0bd7", 0x0BCA: "\u0bc6\u0bbe", 0x0BCB: "\u0bc7\u0bbe",
+    0x0BCC: "\u0bc6\u0bd7", 0x0C48: "\u0c46\u0c56", 0x0CC0: "\u0cbf\u0cd5",
+    0x0CC7: "\u0cc6\u0cd5", 0x0CC8: "\u0cc6\u0cd6", 0x0CCA: "\u0cc6\u0cc2",
+    0x0CCB: "\u0cc6\u0cc2\u0cd5", 0x0D4A: "\u0d46\u0d3e", 0x0D4B: "\u0d47\u0d3e",
+    0x0D4C: "\u0d46\u0d57", 0x0DDA: "\u0dd9\u0dca", 0x0DDC: "\u0dd9\u0dcf",
+    0x0DDD: "\u0dd9\u0dcf\u0dca", 0x0DDE: "\u0dd9\u0ddf", 0x0F43: "\u0f42\u0fb7",
+    0x0F4D: "\u0f4c\u0fb7", 0x0F52: "\u0f51\u0fb7", 0x0F57: "\u0f56\u0fb7",
+    0x0F5C: "\u0f5b\u0fb7", 0x0F69: "\u0f40\u0fb5", 0x0F73: "\u0f71\u0f72",
+    0x0F75: "\u0f71\u0f74", 0x0F76: "\u0fb2\u0f80", 0x0F78: "\u0fb3\u0f80",
+    0x0F81: "\u0f71\u0f80", 0x0F93: "\u0f92\u0fb7", 0x0F9D: "\u0f9c\u0fb7",
+    0x0FA2: "\u0fa1\u0fb7", 0x0FA7: "\u0fa6\u0fb7", 0x0FAC: "\u0fab\u0fb7",
+    0x0FB9: "\u0f90\u0fb5", 0x1026: "\u1025\u102e", 0x1B06: "\u1b05\u1b35",
+    0x1B08: "\u1b07\u1b35", 0x1B0A: "\u1b09\u1b35", 0x1B0C: "\u1b0b\u1b35",
+    0x1B0E: "\u1b0d\u1b35", 0x1B12: "\u1b11\u1b35", 0x1B3B: "\u1b3a\u1b35",
+    0x1B3D: "\u1b3c\u1b35", 0x1B40: "\u1b3e\u1b35", 0x1B41: "\u1b3f\u1b35",
+    0x1B43: "\u1b42\u1b35", 0x1E00: "A\u0325", 0x1E01: "a\u0325",
+    0x1E02: "B\u0307", 0x1E03: "b\u0307", 0x1E04: "B\u0323",
+    0x1E05: "b\u0323", 0x1E06: "B\u0331", 0x1E07: "b\u0331",
+    0x1E08: "C\u0327\u0301", 0x1E09: "c\u0327\u0301", 0x1E0A: "D\u0307",
+    0x1E0B: "d\u0307", 0x1E0C: "D\u0323", 0x1E0D: "d\u0323",
+    0x1E0E: "D\u0331", 0x1E0F: "d\u0331", 0x1E10: "D\u0327",
+    0x1E11: "d\u0327", 0x1E12: "D\u032d", 0x1E13: "d\u032d",
+    0x1E14: "E\u0304\u0300", 0x1E15: "e\u0304\u0300", 0x1E16: "E\u0304\u0301",
+    0x1E17: "e\u0304\u0301", 0x1E18: "E\u032d", 0x1E19: "e\u032d",
+    0x1E1A: "E\u0330", 0x1E1B: "e\u0330", 0x1E1C: "E\u0327\u0306",
+    0x1E1D: "e\u0327\u0306", 0x1E1E: "F\u0307", 0x1E1F: "f\u0307",
+    0x1E20: "G\u0304", 0x1E21: "g\u0304", 0x1E22: "H\u0307",
+    0x1E23: "h\u0307", 0x1E24: "H\u0323", 0x1E25: "h\u0323",
+    0x1E26: "H\u0308", 0x1E27: "h\u0308", 0x1E28: "H\u0327",
+    0x1E29: "h\u0327", 0x1E2A: "H\u032e", 0x1E2B: "h\u032e",
+    0x1E2C: "I\u0330", 0x1E2D: "i\u0330", 0x1E2E: "I\u0308\u0301",
+    0x1E2F: "i\u0308\u0301", 0x1E30: "K\u0301", 0x1E31: "k\u0301",
+    0x1E32: "K\u0323", 0x1E33: "k\u0323", 0x1E34: "K\u0331",
+    0x1E35: "k\u0331", 0x1E36: "L\u0323", 0x1E37: "l\u0323",
+    0x1E38: "L\u0323\u0304", 0x1E39: "l\u0323\u0304", 0x1E3A: "L\u0331",
+    0x1E3B: "l\u0331", 0x1E3C: "L\u032d", 0x1E3D: "l\u032d",
+    0x1E3E: "M\u0301", 0x1E3F: "m\u0301", 0x1E40: "M\u0307",
+    0x1E41: "m\u0307", 0x1E42: "M\u0323", 0x1E43: "m\u0323",
+    0x1E44: "N\u0307", 0x1E45: "n\u0307", 0x1E46: "N\u0323",
+    0x1E47: "n\u0323", 0x1E48: "N\u0331", 0x1E49: "n\u0331",
+    0x1E4A: "N\u032d", 0x1E4B: "n\u032d", 0x1E4C: "O\u0303\u0301",
+    0x1E4D: "o\u0303\u0301", 0x1E4E: "O\u0303\u0308", 0x1E4F: "o\u0303\u0308",
+    0x1E50: "O\u0304\u0300", 0x1E51: "o\u0304\u0300", 0x1E52: "O\u0304\u0301",
+    0x1E53: "o\u0304\u0301", 0x1E54: "P\u0301", 0x1E55: "p\u0301",
+    0x1E56: "P\u0307", 0x1E57: "p\u0307", 0x1E58: "R\u0307",
+    0x1E59: "r\u0307", 0x1E5A: "R\u0323", 0x1E5B: "r\u0323",
+    0x1E5C: "R\u0323\u0304", 0x1E5D: "r\u0323\u0304", 0x1E5E: "R\u0331",
+    0x1E5F: "r\u0331", 0x1E60: "S\u0307", 0x1E61: "s\u0307",
+    0x1E62: "S\u0323", 0x1E63: "s\u0323", 0x1E64: "S\u0301\u0307",
+    0x1E65: "s\u0301\u0307", 0x1E66: "S\u030c\u0307", 0x1E67: "s\u030c\u0307",
+    0x1E68: "S\u0323\u0307", 0x1E69: "s\u0323\u0307", 0x1E6A: "T\u0307",
+    0x1E6B: "t\u0307", 0x1E6C: "T\u0323", 0x1E6D: "t\u0323",
+    0x1E6E: "T\u0331", 0x1E6F: "t\u0331", 0x1E70: "T\u032d",
+    0x1E71: "t\u032d", 0x1E72: "U\u0324", 0x1E73: "u\u0324",
+    0x1E74: "U\u0330", 0x1E75: "u\u0330", 0x1E76: "U\u032d",
+    0x1E77: "u\u032d", 0x1E78: "U\u0303\u0301", 0x1E79: "u\u0303\u0301",
+    0x1E7A: "U\u0304\u0308", 0x1E7B: "u\u0304\u0308", 0x1E7C: "V\u0303",
+    0x1E7D: "v\u0303", 0x1E7E: "V\u0323", 0x1E7F: "v\u0323",
+    0x1E80: "W\u0300", 0x1E81: "w\u0300", 0x1E82: "W\u0301",
+    0x1E83: "w\u0301", 0x1E84: "W\u0308", 0x1E85: "w\u0308",
+    0x1E86: "W\u0307", 0x1E87: "w\u0307", 0x1E88: "W\u0323",
+    0x1E89: "w\u0323", 0x1E8A: "X\u0307", 0x1E8B: "x\u0307",
+    0x1E8C: "X\u0308", 0x1E8D: "x\u0308", 0x1E8E: "Y\u0307",
+    0x1E8F: "y\u0307", 0x1E90: "Z\u0302", 0x1E91: "z\u0302",
+    0x1E92: "Z\u0323", 0x1E93: "z\u0323", 0x1E94: "Z\u0331",
+    0x1E95: "z\u0331", 0x1E96: "h\u0331", 0x1E97: "t\u0308",
+    0x1E98: "w\u030a", 0x1E99: "y\u030a", 0x1E9B: "\u017f\u0307",
+    0x1EA0: "A\u0323", 0x1EA1: "a\u0323", 0x1EA2: "A\u0309",
+    0x1EA3: "a\u0309", 0x1EA4: "A\u0302\u0301", 0x1EA5: "a\u0302\u0301",
+    0x1EA6: "A\u0302\u0300", 0x1EA7: "a\u0302\u0300", 0x1EA8: "A\u0302\u0309",
+    0x1EA9: "a\u0302\u0309", 0x1EAA: "A\u0302\u0303", 0x1EAB: "a\u0302\u0303",
+    0x1EAC: "A\u0323\u0302", 0x1EAD: "a\u0323\u0302", 0x1EAE: "A\u0306\u0301",
+    0x1EAF: "a\u0306\u0301", 0x1EB0: "A\u0306\u0300", 0x1EB1: "a\u0306\u0300",
+    0x1EB2: "A\u0306\u0309", 0x1EB3: "a\u0306\u0309", 0x1EB4: "A\u0306\u0303",
+    0x1EB5: "a\u0306\u0303", 0x1EB6: "A\u0323\u0306", 0x1EB7: "a\u0323\u0306",
+    0x1EB8: "E\u0323", 0x1EB9: "e\u0323", 0x1EBA: "E\u0309",
+    0x1EBB: "e\u0309", 0x1EBC: "E\u0303", 0x1EBD: "e\u0303",
+    0x1EBE: "E\u0302\u0301", 0x1EBF: "e\u0302\u0301", 0x1EC0: "E\u0302\u0300",
+    0x1EC1: "e\u0302\u0300", 0x1EC2: "E\u0302\u0309", 0x1EC3: "e\u0302\u0309",
+    0x1EC4: "E\u0302\u0303", 0x1EC5: "e\u0302\u0303", 0x1EC6: "E\u0323\u0302",
+    0x1EC7: "e\u0323\u0302", 0x1EC8: "I\u0309", 0x1EC9: "i\u0309",
+    0x1ECA: "I\u0323", 0x1ECB: "i\u0323", 0x1ECC: "O\u0323",
+    0x1ECD: "o\u0323", 0x1ECE: "O\u0309", 0x1ECF: "o\u0309",
+    0x1ED0: "O\u0302\u0301", 0x1ED1: "o\u0302\u0301", 0x1ED2: "O\u0302\u0300",
+    0x1ED3: "o\u0302\u0300", 0x1ED4: "O\u0302\u0309", 0x1ED5: "o\u0302\u0309",
+    0x1ED6: "O\u0302\u0303", 0x1ED7: "o\u0302\u0303", 0x1ED8: "O\u0323\u0302",
+    0x1ED9: "o\u0323\u0302", 0x1EDA: "O\u031b\u0301", 0x1EDB: "o\u031b\u0301",
+    0x1EDC: "O\u031b\u0300", 0x1EDD: "o\u031b\u0300", 0x1EDE: "O\u031b\u0309",
+    0x1EDF: "o\u031b\u0309", 0x1EE0: "O\u031b\u0303", 0x1EE1: "o\u031b\u0303",
+    0x1EE2: "O\u031b\u0323", 0x1EE3: "o\u031b\u0323", 0x1EE4: "U\u0323",
+    0x1EE5: "u\u0323", 0x1EE6: "U\u0309", 0x1EE7: "u\u0309",
+    0x1EE8: "U\u031b\u0301", 0x1EE9: "u\u031b\u0301", 0x1EEA: "U\u031b\u0300",
+    0x1EEB: "u\u031b\u0300", 0x1EEC: "U\u031b\u0309", 0x1EED: "u\u031b\u0309",
+    0x1EEE: "U\u031b\u0303", 0x1EEF: "u\u031b\u0303", 0x1EF0: "U\u031b\u0323",
+    0x1EF1: "u\u031b\u0323", 0x1EF2: "Y\u0300", 0x1EF3: "y\u0300",
+    0x1EF4: "Y\u0323", 0x1EF5: "y\u0323", 0x1EF6: "Y\u0309",
+    0x1EF7: "y\u0309", 0x1EF8: "Y\u0303", 0x1EF9: "y\u0303",
+    0x1F00: "\u03b1\u0313", 0x1F01: "\u03b1\u0314", 0x1F02: "\u03b1\u0313\u0300",
+    0x1F03: "\u03b1\u0314\u0300", 0x1F04: "\u03b1\u0313\u0301", 0x1F05: "\u03b1\u0314\u0301",
+    0x1F06: "\u03b1\u0313\u0342", 0x1F07: "\u03b1\u0314\u0342", 0x1F08: "\u0391\u0313",
+    0x1F09: "\u0391\u0314", 0x1F0A: "\u0391\u0313\u0300", 0x1F0B: "\u0391\u0314\u0300",
+    0x1F0C: "\u0391\u0313\u0301", 0x1F0D: "\u0391\u0314\u0301", 0x1F0E: "\u0391\u0313\u0342",
+    0x1F0F: "\u0391\u0314\u0342", 0x1F10: "\u03b5\u0313", 0x1F11: "\u03b5\u0314",
+    0x1F12: "\u03b5\u0313\u0300", 0x1F13: "\u03b5\u0314\u0300", 0x1F14: "\u03b5\u0313\u0301",
+    0x1F15: "\u03b5\u0314\u0301", 0x1F18: "\u0395\u0313", 0x1F19: "\u0395\u0314",
+    0x1F1A: "\u0395\u0313\u0300", 0x1F1B: "\u0395\u0314\u0300", 0x1F1C: "\u0395\u0313\u0301",
+    0x1F1D: "\u0395\u0314\u0301", 0x1F20: "\u03b7\u0313", 0x1F21: "\u03b7\u0314",
+    0x1F22: "\u03b7\u0313\u0300", 0x1F23: "\u03b7\u0314\u0300", 0x1F24: "\u03b7\u0313\u0301",
+    0x1F25: "\u03b7\u0314\u0301", 0x1F26: "\u03b7\u0313\u0342", 0x1F27: "\u03b7\u0314\u0342",
+    0x1F28: "\u0397\u0313", 0x1F29: "\u0397\u0314", 0x1F2A: "\u0397\u0313\u0300",
+    0x1F2B: "\u0397\u0314\u0300", 0x1F2C: "\u0397\u0313\u0301", 0x1F2D: "\u0397\u0314\u0301",
+    0x1F2E: "\u0397\u0313\u0342", 0x1F2F: "\u0397\u0314\u0342", 0x1F30: "\u03b9\u0313",
+    0x1F31: "\u03b9\u0314", 0x1F32: "\u03b9\u0313\u0300", 0x1F33: "\u03b9\u0314\u0300",
+    0x1F34: "\u03b9\u0313\u0301", 0x1F35: "\u03b9\u0314\u0301", 0x1F36: "\u03b9\u0313\u0342",
+    0x1F37: "\u03b9\u0314\u0342", 0x1F38: "\u0399\u0313", 0x1F39: "\u0399\u0314",
+    0x1F3A: "\u0399\u0313\u0300", 0x1F3B: "\u0399\u0314\u0300", 0x1F3C: "\u0399\u0313\u0301",
+    0x1F3D: "\u0399\u0314\u0301", 0x1F3E: "\u0399\u0313\u0342", 0x1F3F: "\u0399\u0314\u0342",
+    0x1F40: "\u03bf\u0313", 0x1F41: "\u03bf\u0314", 0x1F42: "\u03bf\u0313\u0300",
+    0x1F43: "\u03bf\u0314\u0300", 0x1F44: "\u03bf\u0313\u0301", 0x1F45: "\u03bf\u0314\u0301",
+    0x1F48: "\u039f\u0313", 0x1F49: "\u039f\u0314", 0x1F4A: "\u039f\u0313\u0300",
+    0x1F4B: "\u039f\u0314\u0300", 0x1F4C: "\u039f\u0313\u0301", 0x1F4D: "\u039f\u0314\u0301",
+    0x1F50: "\u03c5\u0313", 0x1F51: "\u03c5\u0314", 0x1F52: "\u03c5\u0313\u0300",
+    0x1F53: "\u03c5\u0314\u0300", 0x1F54: "\u03c5\u0313\u0301", 0x1F55: "\u03c5\u0314\u0301",
+    0x1F56: "\u03c5\u0313\u0342", 0x1F57: "\u03c5\u0314\u0342", 0x1F59: "\u03a5\u0314",
+    0x1F5B: "\u03a5\u0314\u0300", 0x1F5D: "\u03a5\u0314\u0301", 0x1F5F: "\u03a5\u0314\u0342",
+    0x1F60: "\u03c9\u0313", 0x1F61: "\u03c9\u0314", 0x1F62: "\u03c9\u0313\u0300",
+    0x1F63: "\u03c9\u0314\u0300", 0x1F64: "\u03c9\u0313\u0301", 0x1F65: "\u03c9\u0314\u0301",
+    0x1F66: "\u03c9\u0313\u0342", 0x1F67: "\u03c9\u0314\u0342", 0x1F68: "\u03a9\u0313",
+    0x1F69: "\u03a9\u0314", 0x1F6A: "\u03a9\u0313\u0300", 0x1F6B: "\u03a9\u0314\u0300",
+    0x1F6C: "\u03a9\u0313\u0301", 0x1F6D: "\u03a9\u0314\u0301", 0x1F6E: "\u03a9\u0313\u0342",
+    0x1F6F: "\u03a9\u0314\u0342", 0x1F70: "\u03b1\u0300", 0x1F71: "\u03b1\u0301",
+    0x1F72: "\u03b5\u0300", 0x1F73: "\u03b5\u0301", 0x1F74: "\u03b7\u0300",
+    0x1F75: "\u03b7\u0301", 0x1F76: "\u03b9\u0300", 0x1F77: "\u03b9\u0301",
+    0x1F78: "\u03bf\u0300", 0x1F79: "\u03bf\u0301", 0x1F7A: "\u03c5\u0300",
+    0x1F7B: "\u03c5\u0301", 0x1F7C: "\u03c9\u0300", 0x1F7D: "\u03c9\u0301",
+    0x1F80: "\u03b1\u0313\u0345", 0x1F81: "\u03b1\u0314\u0345", 0x1F82: "\u03b1\u0313\u0300\u0345",
+    0x1F83: "\u03b1\u0314\u0300\u0345", 0x1F84: "\u03b1\u0313\u0301\u0345", 0x1F85: "\u03b1\u0314\u0301\u0345",
+    0x1F86: "\u03b1\u0313\u0342\u0345", 0x1F87: "\u03b1\u0314\u0342\u0345", 0x1F88: "\u0391\u0313\u0345",
+    0x1F89: "\u0391\u0314\u0345", 0x1F8A: "\u0391\u0313\u0300\u0345", 0x1F8B: "\u0391\u0314\u0300\u0345",
+    0x1F8C: "\u0391\u0313\u0301\u0345", 0x1F8D: "\u0391\u0314\u0301\u0345", 0x1F8E: "\u0391\u0313\u0342\u0345",
+    0x1F8F: "\u0391\u0314\u0342\u0345", 0x1F90: "\u03b7\u0313\u0345", 0x1F91: "\u03b7\u0314\u0345",
+    0x1F92: "\u03b7\u0313\u0300\u0345", 0x1F93: "\u03b7\u0314\u0300\u0345", 0x1F94: "\u03b7\u0313\u0301\u0345",
+    0x1F95: "\u03b7\u0314\u0301\u0345", 0x1F96: "\u03b7\u0313\u0342\u0345", 0x1F97: "\u03b7\u0314\u0342\u0345",
+    0x1F98: "\u0397\u0313\u0345", 0x1F99: "\u0397\u0314\u0345", 0x1F9A: "\u0397\u0313\u0300\u0345",
+    0x1F9B: "\u0397\u0314\u0300\u0345", 0x1F9C: "\u0397\u0313\u0301\u0345", 0x1F9D: "\u0397\u0314\u0301\u0345",
+    0x1F9E: "\u0397\u0313\u0342\u0345", 0x1F9F: "\u0397\u0314\u0342\u0345", 0x1FA0: "\u03c9\u0313\u0345",
+    0x1FA1: "\u03c9\u0314\u0345", 0x1FA2: "\u03c9\u0313\u0300\u0345", 0x1FA3: "\u03c9\u0314\u0300\u0345",
+    0x1FA4: "\u03c9\u0313\u0301\u0345", 0x1FA5: "\u03c9\u0314\u0301\u0345", 0x1FA6: "\u03c9\u0313\u0342\u0345",
+    0x1FA7: "\u03c9\u0314\u0342\u0345", 0x1FA8: "\u03a9\u0313\u0345", 0x1FA9: "\u03a9\u0314\u0345",
+    0x1FAA: "\u03a9\u0313\u0300\u0345", 0x1FAB: "\u03a9\u0314\u0300\u0345", 0x1FAC: "\u03a9\u0313\u0301\u0345",
+    0x1FAD: "\u03a9\u0314\u0301\u0345", 0x1FAE: "\u03a9\u0313\u0342\u0345", 0x1FAF: "\u03a9\u0314\u0342\u0345",
+    0x1FB0: "\u03b1\u0306", 0x1FB1: "\u03b1\u0304", 0x1FB2: "\u03b1\u0300\u0345",
+    0x1FB3: "\u03b1\u0345", 0x1FB4: "\u03b1\u0301\u0345", 0x1FB6: "\u03b1\u0342",
+    0x1FB7: "\u03b1\u0342\u0345", 0x1FB8: "\u0391\u0306", 0x1FB9: "\u0391\u0304",
+    0x1FBA: "\u0391\u0300", 0x1FBB: "\u0391\u0301", 0x1FBC: "\u0391\u0345",
+    0x1FBE: "\u03b9", 0x1FC1: "\u00a8\u0342", 0x1FC2: "\u03b7\u0300\u0345",
+    0x1FC3: "\u03b7\u0345", 0x1FC4: "\u03b7\u0301\u0345", 0x1FC6: "\u03b7\u0342",
+    0x1FC7: "\u03b7\u0342\u0345", 0x1FC8: "\u0395\u0300", 0x1FC9: "\u0395\u0301",
+    0x1FCA: "\u0397\u0300", 0x1FCB: "\u0397\u0301", 0x1FCC: "\u0397\u0345",
+    0x1FCD: "\u1fbf\u0300", 0x1FCE: "\u1fbf\u0301", 0x1FCF: "\u1fbf\u0342",
+    0x1FD0: "\u03b9\u0306", 0x1FD1: "\u03b9\u0304", 0x1FD2: "\u03b9\u0308\u0300",
+    0x1FD3: "\u03b9\u0308\u0301", 0x1FD6: "\u03b9\u0342", 0x1FD7: "\u03b9\u0308\u0342",
+    0x1FD8: "\u0399\u0306", 0x1FD9: "\u0399\u0304", 0x1FDA: "\u0399\u0300",
+    0x1FDB: "\u0399\u0301", 0x1FDD: "\u1ffe\u0300", 0x1FDE: "\u1ffe\u0301",
+    0x1FDF: "\u1ffe\u0342", 0x1FE0: "\u03c5\u0306", 0x1FE1: "\u03c5\u0304",
+    0x1FE2: "\u03c5\u0308\u0300", 0x1FE3: "\u03c5\u0308\u0301", 0x1FE4: "\u03c1\u0313",
+    0x1FE5: "\u03c1\u0314", 0x1FE6: "\u03c5\u0342", 0x1FE7: "\u03c5\u0308\u0342",
+    0x1FE8: "\u03a5\u0306", 0x1FE9: "\u03a5\u0304", 0x1FEA: "\u03a5\u0300",
+    0x1FEB: "\u03a5\u0301", 0x1FEC: "\u03a1\u0314", 0x1FED: "\u00a8\u0300",
+    0x1FEE: "\u00a8\u0301", 0x1FEF: "`", 0x1FF2: "\u03c9\u0300\u0345",
+    0x1FF3: "\u03c9\u0345", 0x1FF4: "\u03c9\u0301\u0345", 0x1FF6: "\u03c9\u0342",
+    0x1FF7: "\u03c9\u0342\u0345", 0x1FF8: "\u039f\u0300", 0x1FF9: "\u039f\u0301",
+    0x1FFA: "\u03a9\u0300", 0x1FFB: "\u03a9\u0301", 0x1FFC: "\u03a9\u0345",
+    0x1FFD: "\u00b4", 0x2000: "\u2002", 0x2001: "\u2003",
+    0x2126: "\u03a9", 0x212A: "K", 0x212B: "A\u030a",
+    0x219A: "\u2190\u0338", 0x219B: "\u2192\u0338", 0x21AE: "\u2194\u0338",
+    0x21CD: "\u21d0\u0338", 0x21CE: "\u21d4\u0338", 0x21CF: "\u21d2\u0338",
+    0x2204: "\u2203\u0338", 0x2209: "\u2208\u0338", 0x220C: "\u220b\u0338",
+    0x2224: "\u2223\u0338", 0x2226: "\u2225\u0338", 0x2241: "\u223c\u0338",
+    0x2244: "\u2243\u0338", 0x2247: "\u2245\u0338", 0x2249: "\u2248\u0338",
+    0x2260: "=\u0338", 0x2262: "\u2261\u0338", 0x226D: "\u224d\u0338",
+    0x226E: "<\u0338", 0x226F: ">\u0338", 0x2270: "\u2264\u0338",
+    0x2271: "\u2265\u0338", 0x2274: "\u2272\u0338", 0x2275: "\u2273\u0338",
+    0x2278: "\u2276\u0338", 0x2279: "\u2277\u0338", 0x2280: "\u227a\u0338",
+    0x2281: "\u227b\u0338", 0x2284: "\u2282\u0338", 0x2285: "\u2283\u0338",
+    0x2288: "\u2286\u0338", 0x2289: "\u2287\u0338", 0x22AC: "\u22a2\u0338",
+    0x22AD: "\u22a8\u0338", 0x22AE: "\u22a9\u0338", 0x22AF: "\u22ab\u0338",
+    0x22E0: "\u227c\u0338", 0x22E1: "\u227d\u0338", 0x22E2: "\u2291\u0338",
+    0x22E3: "\u2292\u0338", 0x22EA: "\u22b2\u0338", 0x22EB: "\u22b3\u0338",
+    0x22EC: "\u22b4\u0338", 0x22ED: "\u22b5\u0338", 0x2329: "\u3008",
+    0x232A: "\u3009", 0x2ADC: "\u2add\u0338", 0x304C: "\u304b\u3099",
+    0x304E: "\u304d\u3099", 0x3050: "\u304f\u3099", 0x3052: "\u3051\u3099",
+    0x3054: "\u3053\u3099", 0x3056: "\u3055\u3099", 0x3058: "\u3057\u3099",
+    0x305A: "\u3059\u3099", 0x305C: "\u305b\u3099", 0x305E: "\u305d\u3099",
+    0x3060: "\u305f\u3099", 0x3062: "\u3061\u3099", 0x3065: "\u3064\u3099",
+    0x3067: "\u3066\u3099", 0x3069: "\u3068\u3099", 0x3070: "\u306f\u3099",
+    0x3071: "\u306f\u309a", 0x3073: "\u3072\u3099", 0x3074: "\u3072\u309a",
+    0x3076: "\u3075\u3099", 0x3077: "\u3075\u309a", 0x3079: "\u3078\u3099",
+    0x307A: "\u3078\u309a", 0x307C: "\u307b\u3099", 0x307D: "\u307b\u309a",
+    0x3094: "\u3046\u3099", 0x309E: "\u309d\u3099", 0x30AC: "\u30ab\u3099",
+    0x30AE: "\u30ad\u3099", 0x30B0: "\u30af\u3099", 0x30B2: "\u30b1\u3099",
+    0x30B4: "\u30b3\u3099", 0x30B6: "\u30b5\u3099", 0x30B8: "\u30b7\u3099",
+    0x30BA: "\u30b9\u3099", 0x30BC: "\u30bb\u3099", 0x30BE: "\u30bd\u3099",
+    0x30C0: "\u30bf\u3099", 0x30C2: "\u30c1\u3099", 0x30C5: "\u30c4\u3099",
+    0x30C7: "\u30c6\u3099", 0x30C9: "\u30c8\u3099", 0x30D0: "\u30cf\u3099",
+    0x30D1: "\u30cf\u309a", 0x30D3: "\u30d2\u3099", 0x30D4: "\u30d2\u309a",
+    0x30D6: "\u30d5\u3099", 0x30D7: "\u30d5\u309a", 0x30D9: "\u30d8\u3099",
+    0x30DA: "\u30d8\u309a", 0x30DC: "\u30db\u3099", 0x30DD: "\u30db\u309a",
+    0x30F4: "\u30a6\u3099", 0x30F7: "\u30ef\u3099", 0x30F8: "\u30f0\u3099",
+    0x30F9: "\u30f1\u3099", 0x30FA: "\u30f2\u3099", 0x30FE: "\u30fd\u3099",
+    0xF900: "\u8c48", 0xF901: "\u66f4", 0xF902: "\u8eca",
+    0xF903: "\u8cc8", 0xF904: "\u6ed1", 0xF905: "\u4e32",
+    0xF906: "\u53e5", 0xF907: "\u9f9c", 0xF908: "\u9f9c",
+    0xF909: "\u5951", 0xF90A: "\u91d1", 0xF90B: "\u5587",
+    0xF90C: "\u5948", 0xF90D: "\u61f6", 0xF90E: "\u7669",
+    0xF90F: "\u7f85", 0xF910: "\u863f", 0xF911: "\u87ba",
+    0xF912: "\u88f8", 0xF913: "\u908f", 0xF914: "\u6a02",
+    0xF915: "\u6d1b", 0xF916: "\u70d9", 0xF917: "\u73de",
+    0xF918: "\u843d", 0xF919: "\u916a", 0xF91A: "\u99f1",
+    0xF91B: "\u4e82", 0xF91C: "\u5375", 0xF91D: "\u6b04",
+    0xF91E: "\u721b", 0xF91F: "\u862d", 0xF920: "\u9e1e",
+    0xF921: "\u5d50", 0xF922: "\u6feb", 0xF923: "\u85cd",
+    0xF924: "\u8964", 0xF925: "\u62c9", 0xF926: "\u81d8",
+    0xF927: "\u881f", 0xF928: "\u5eca", 0xF929: "\u6717",
+    0xF92A: "\u6d6a", 0xF92B: "\u72fc", 0xF92C: "\u90ce",
+    0xF92D: "\u4f86", 0xF92E: "\u51b7", 0xF92F: "\u52de",
+    0xF930: "\u64c4", 0xF931: "\u6ad3", 0xF932: "\u7210",
+    0xF933: "\u76e7", 0xF934: "\u8001", 0xF935: "\u8606",
+    0xF936: "\u865c", 0xF937: "\u8def", 0xF938: "\u9732",
+    0xF939: "\u9b6f", 0xF93A: "\u9dfa", 0xF93B: "\u788c",
+    0xF93C: "\u797f", 0xF93D: "\u7da0", 0xF93E: "\u83c9",
+    0xF93F: "\u9304", 0xF940: "\u9e7f", 0xF941: "\u8ad6",
+    0xF942: "\u58df", 0xF943: "\u5f04", 0xF944: "\u7c60",
+    0xF945: "\u807e", 0xF946: "\u7262", 0xF947: "\u78ca",
+    0xF948: "\u8cc2", 0xF949: "\u96f7", 0xF94A: "\u58d8",
+    0xF94B: "\u5c62", 0xF94C: "\u6a13", 0xF94D: "\u6dda",
+    0xF94E: "\u6f0f", 0xF94F: "\u7d2f", 0xF950: "\u7e37",
+    0xF951: "\u964b", 0xF952: "\u52d2", 0xF953: "\u808b",
+    0xF954: "\u51dc", 0xF955: "\u51cc", 0xF956: "\u7a1c",
+    0xF957: "\u7dbe", 0xF958: "\u83f1", 0xF959: "\u9675",
+    0xF95A: "\u8b80", 0xF95B: "\u62cf", 0xF95C: "\u6a02",
+    0xF95D: "\u8afe", 0xF95E: "\u4e39", 0xF95F: "\u5be7",
+    0xF960: "\u6012", 0xF961: "\u7387", 0xF962: "\u7570",
+    0xF963: "\u5317", 0xF964: "\u78fb", 0xF965: "\u4fbf",
+    0xF966: "\u5fa9", 0xF967: "\u4e0d", 0xF968: "\u6ccc",
+    0xF969: "\u6578", 0xF96A: "\u7d22", 0xF96B: "\u53c3",
+    0xF96C: "\u585e", 0xF96D: "\u7701", 0xF96E: "\u8449",
+    0xF96F: "\u8aaa", 0xF970: "\u6bba", 0xF971: "\u8fb0",
+    0xF972: "\u6c88", 0xF973: "\u62fe", 0xF974: "\u82e5",
+    0xF975: "\u63a0", 0xF976: "\u7565", 0xF977: "\u4eae",
+    0xF978: "\u5169", 0xF979: "\u51c9", 0xF97A: "\u6881",
+    0xF97B: "\u7ce7", 0xF97C: "\u826f", 0xF97D: "\u8ad2",
+    0xF97E: "\u91cf", 0xF97F: "\u52f5", 0xF980: "\u5442",
+    0xF981: "\u5973", 0xF982: "\u5eec", 0xF983: "\u65c5",
+    0xF984: "\u6ffe", 0xF985: "\u792a", 0xF986: "\u95ad",
+    0xF987: "\u9a6a", 0xF988: "\u9e97", 0xF989: "\u9ece",
+    0xF98A: "\u529b", 0xF98B: "\u66c6", 0xF98C: "\u6b77",
+    0xF98D: "\u8f62", 0xF98E: "\u5e74", 0xF98F: "\u6190",
+    0xF990: "\u6200", 0xF991: "\u649a", 0xF992: "\u6f23",
+    0xF993: "\u7149", 0xF994: "\u7489", 0xF995: "\u79ca",
+    0xF996: "\u7df4", 0xF997: "\u806f", 0xF998: "\u8f26",
+    0xF999: "\u84ee", 0xF99A: "\u9023", 0xF99B: "\u934a",
+    0xF99C: "\u5217", 0xF99D: "\u52a3", 0xF99E: "\u54bd",
+    0xF99F: "\u70c8", 0xF9A0: "\u88c2", 0xF9A1: "\u8aaa",
+    0xF9A2: "\u5ec9", 0xF9A3: "\u5ff5", 0xF9A4: "\u637b",
+    0xF9A5: "\u6bae", 0xF9A6: "\u7c3e", 0xF9A7: "\u7375",
+    0xF9A8: "\u4ee4", 0xF9A9: "\u56f9", 0xF9AA: "\u5be7",
+    0xF9AB: "\u5dba", 0xF9AC: "\u601c", 0xF9AD: "\u73b2",
+    0xF9AE: "\u7469", 0xF9AF: "\u7f9a", 0xF9B0: "\u8046",
+    0xF9B1: "\u9234", 0xF9B2: "\u96f6", 0xF9B3: "\u9748",
+    0xF9B4: "\u9818", 0xF9B5: "\u4f8b", 0xF9B6: "\u79ae",
+    0xF9B7: "\u91b4", 0xF9B8: "\u96b8", 0xF9B9: "\u60e1",
+    0xF9BA: "\u4e86", 0xF9BB: "\u50da", 0xF9BC: "\u5bee",
+    0xF9BD: "\u5c3f", 0xF9BE: "\u6599", 0xF9BF: "\u6a02",
+    0xF9C0: "\u71ce", 0xF9C1: "\u7642", 0xF9C2: "\u84fc",
+    0xF9C3: "\u907c", 0xF9C4: "\u9f8d", 0xF9C5: "\u6688",
+    0xF9C6: "\u962e", 0xF9C7: "\u5289", 0xF9C8: "\u677b",
+    0xF9C9: "\u67f3", 0xF9CA: "\u6d41", 0xF9CB: "\u6e9c",
+    0xF9CC: "\u7409", 0xF9CD: "\u7559", 0xF9CE: "\u786b",
+    0xF9CF: "\u7d10", 0xF9D0: "\u985e", 0xF9D1: "\u516d",
+    0xF9D2: "\u622e", 0xF9D3: "\u9678", 0xF9D4: "\u502b",
+    0xF9D5: "\u5d19", 0xF9D6: "\u6dea", 0xF9D7: "\u8f2a",
+    0xF9D8: "\u5f8b", 0xF9D9: "\u6144", 0xF9DA: "\u6817",
+    0xF9DB: "\u7387", 0xF9DC: "\u9686", 0xF9DD: "\u5229",
+    0xF9DE: "\u540f", 0xF9DF: "\u5c65", 0xF9E0: "\u6613",
+    0xF9E1: "\u674e", 0xF9E2: "\u68a8", 0xF9E3: "\u6ce5",
+    0xF9E4: "\u7406", 0xF9E5: "\u75e2", 0xF9E6: "\u7f79",
+    0xF9E7: "\u88cf", 0xF9E8: "\u88e1", 0xF9E9: "\u91cc",
+    0xF9EA: "\u96e2", 0xF9EB: "\u533f", 0xF9EC: "\u6eba",
+    0xF9ED: "\u541d", 0xF9EE: "\u71d0", 0xF9EF: "\u7498",
+    0xF9F0: "\u85fa", 0xF9F1: "\u96a3", 0xF9F2: "\u9c57",
+    0xF9F3: "\u9e9f", 0xF9F4: "\u6797", 0xF9F5: "\u6dcb",
+    0xF9F6: "\u81e8", 0xF9F7: "\u7acb", 0xF9F8: "\u7b20",
+    0xF9F9: "\u7c92", 0xF9FA: "\u72c0", 0xF9FB: "\u7099",
+    0xF9FC: "\u8b58", 0xF9FD: "\u4ec0", 0xF9FE: "\u8336",
+    0xF9FF: "\u523a", 0xFA00: "\u5207", 0xFA01: "\u5ea6",
+    0xFA02: "\u62d3", 0xFA03: "\u7cd6", 0xFA04: "\u5b85",
+    0xFA05: "\u6d1e", 0xFA06: "\u66b4", 0xFA07: "\u8f3b",
+    0xFA08: "\u884c", 0xFA09: "\u964d", 0xFA0A: "\u898b",
+    0xFA0B: "\u5ed3", 0xFA0C: "\u5140", 0xFA0D: "\u55c0",
+    0xFA10: "\u585a", 0xFA12: "\u6674", 0xFA15: "\u51de",
+    0xFA16: "\u732a", 0xFA17: "\u76ca", 0xFA18: "\u793c",
+    0xFA19: "\u795e", 0xFA1A: "\u7965", 0xFA1B: "\u798f",
+    0xFA1C: "\u9756", 0xFA1D: "\u7cbe", 0xFA1E: "\u7fbd",
+    0xFA20: "\u8612", 0xFA22: "\u8af8", 0xFA25: "\u9038",
+    0xFA26: "\u90fd", 0xFA2A: "\u98ef", 0xFA2B: "\u98fc",
+    0xFA2C: "\u9928", 0xFA2D: "\u9db4", 0xFA2E: "\u90de",
+    0xFA2F: "\u96b7", 0xFA30: "\u4fae", 0xFA31: "\u50e7",
+    0xFA32: "\u514d", 0xFA33: "\u52c9", 0xFA34: "\u52e4",
+    0xFA35: "\u5351", 0xFA36: "\u559d", 0xFA37: "\u5606",
+    0xFA38: "\u5668", 0xFA39: "\u5840", 0xFA3A: "\u58a8",
+    0xFA3B: "\u5c64", 0xFA3C: "\u5c6e", 0xFA3D: "\u6094",
+    0xFA3E: "\u6168", 0xFA3F: "\u618e", 0xFA40: "\u61f2",
+    0xFA41: "\u654f", 0xFA42: "\u65e2", 0xFA43: "\u6691",
+    0xFA44: "\u6885", 0xFA45: "\u6d77", 0xFA46: "\u6e1a",
+    0xFA47: "\u6f22", 0xFA48: "\u716e", 0xFA49: "\u722b",
+    0xFA4A: "\u7422", 0xFA4B: "\u7891", 0xFA4C: "\u793e",
+    0xFA4D: "\u7949", 0xFA4E: "\u7948", 0xFA4F: "\u7950",
+    0xFA50: "\u7956", 0xFA51: "\u795d", 0xFA52: "\u798d",
+    0xFA53: "\u798e", 0xFA54: "\u7a40", 0xFA55: "\u7a81",
+    0xFA56: "\u7bc0", 0xFA57: "\u7df4", 0xFA58: "\u7e09",
+    0xFA59: "\u7e41", 0xFA5A: "\u7f72", 0xFA5B: "\u8005",
+    0xFA5C: "\u81ed", 0xFA5D: "\u8279", 0xFA5E: "\u8279",
+    0xFA5F: "\u8457", 0xFA60: "\u8910", 0xFA61: "\u8996",
+    0xFA62: "\u8b01", 0xFA63: "\u8b39", 0xFA64: "\u8cd3",
+    0xFA65: "\u8d08", 0xFA66: "\u8fb6", 0xFA67: "\u9038",
+    0xFA68: "\u96e3", 0xFA69: "\u97ff", 0xFA6A: "\u983b",
+    0xFA6B: "\u6075", 0xFA6C: "\U000242ee", 0xFA6D: "\u8218",
+    0xFA70: "\u4e26", 0xFA71: "\u51b5", 0xFA72: "\u5168",
+    0xFA73: "\u4f80", 0xFA74: "\u5145", 0xFA75: "\u5180",
+    0xFA76: "\u52c7", 0xFA77: "\u52fa", 0xFA78: "\u559d",
+    0xFA79: "\u5555", 0xFA7A: "\u5599", 0xFA7B: "\u55e2",
+    0xFA7C: "\u585a", 0xFA7D: "\u58b3", 0xFA7E: "\u5944",
+    0xFA7F: "\u5954", 0xFA80: "\u5a62", 0xFA81: "\u5b28",
+    0xFA82: "\u5ed2", 0xFA83: "\u5ed9", 0xFA84: "\u5f69",
+    0xFA85: "\u5fad", 0xFA86: "\u60d8", 0xFA87: "\u614e",
+    0xFA88: "\u6108", 0xFA89: "\u618e", 0xFA8A: "\u6160",
+    0xFA8B: "\u61f2", 0xFA8C: "\u6234", 0xFA8D: "\u63c4",
+    0xFA8E: "\u641c", 0xFA8F: "\u6452", 0xFA90: "\u6556",
+    0xFA91: "\u6674", 0xFA92: "\u6717", 0xFA93: "\u671b",
+    0xFA94: "\u6756", 0xFA95: "\u6b79", 0xFA96: "\u6bba",
+    0xFA97: "\u6d41", 0xFA98: "\u6edb", 0xFA99: "\u6ecb",
+    0xFA9A: "\u6f22", 0xFA9B: "\u701e", 0xFA9C: "\u716e",
+    0xFA9D: "\u77a7", 0xFA9E: "\u7235", 0xFA9F: "\u72af",
+    0xFAA0: "\u732a", 0xFAA1: "\u7471", 0xFAA2: "\u7506",
+    0xFAA3: "\u753b", 0xFAA4: "\u761d", 0xFAA5: "\u761f",
+    0xFAA6: "\u76ca", 0xFAA7: "\u76db", 0xFAA8: "\u76f4",
+    0xFAA9: "\u774a", 0xFAAA: "\u7740", 0xFAAB: "\u78cc",
+    0xFAAC: "\u7ab1", 0xFAAD: "\u7bc0", 0xFAAE: "\u7c7b",
+    0xFAAF: "\u7d5b", 0xFAB0: "\u7df4", 0xFAB1: "\u7f3e",
+    0xFAB2: "\u8005", 0xFAB3: "\u8352", 0xFAB4: "\u83ef",
+    0xFAB5: "\u8779", 0xFAB6: "\u8941", 0xFAB7: "\u8986",
+    0xFAB8: "\u8996", 0xFAB9: "\u8abf", 0xFABA: "\u8af8",
+    0xFABB: "\u8acb", 0xFABC: "\u8b01", 0xFABD: "\u8afe",
+    0xFABE: "\u8aed", 0xFABF: "\u8b39", 0xFAC0: "\u8b8a",
+    0xFAC1: "\u8d08", 0xFAC2: "\u8f38", 0xFAC3: "\u9072",
+    0xFAC4: "\u9199", 0xFAC5: "\u9276", 0xFAC6: "\u967c",
+    0xFAC7: "\u96e3", 0xFAC8: "\u9756", 0xFAC9: "\u97db",
+    0xFACA: "\u97ff", 0xFACB: "\u980b", 0xFACC: "\u983b",
+    0xFACD: "\u9b12", 0xFACE: "\u9f9c", 0xFACF: "\U0002284a",
+    0xFAD0: "\U00022844", 0xFAD1: "\U000233d5", 0xFAD2: "\u3b9d",
+    0xFAD3: "\u4018", 0xFAD4: "\u4039", 0xFAD5: "\U00025249",
+    0xFAD6: "\U00025cd0", 0xFAD7: "\U00027ed3", 0xFAD8: "\u9f43",
+    0xFAD9: "\u9f8e", 0xFB1D: "\u05d9\u05b4", 0xFB1F: "\u05f2\u05b7",
+    0xFB2A: "\u05e9\u05c1", 0xFB2B: "\u05e9\u05c2", 0xFB2C: "\u05e9\u05bc\u05c1",
+    0xFB2D: "\u05e9\u05bc\u05c2", 0xFB2E: "\u05d0\u05b7", 0xFB2F: "\u05d0\u05b8",
+    0xFB30: "\u05d0\u05bc", 0xFB31: "\u05d1\u05bc", 0xFB32: "\u05d2\u05bc",
+    0xFB33: "\u05d3\u05bc", 0xFB34: "\u05d4\u05bc", 0xFB35: "\u05d5\u05bc",
+    0xFB36: "\u05d6\u05bc", 0xFB38: "\u05d8\u05bc", 0xFB39: "\u05d9\u05bc",
+    0xFB3A: "\u05da\u05bc", 0xFB3B: "\u05db\u05bc", 0xFB3C: "\u05dc\u05bc",
+    0xFB3E: "\u05de\u05bc", 0xFB40: "\u05e0\u05bc", 0xFB41: "\u05e1\u05bc",
+    0xFB43: "\u05e3\u05bc", 0xFB44: "\u05e4\u05bc", 0xFB46: "\u05e6\u05bc",
+    0xFB47: "\u05e7\u05bc", 0xFB48: "\u05e8\u05bc", 0xFB49: "\u05e9\u05bc",
+    0xFB4A: "\u05ea\u05bc", 0xFB4B: "\u05d5\u05b9", 0xFB4C: "\u05d1\u05bf",
+    0xFB4D: "\u05db\u05bf", 0xFB4E: "\u05e4\u05bf", 0x1109A: "\U00011099\U000110ba",
+    0x1109C: "\U0001109b\U000110ba", 0x110AB: "\U000110a5\U000110ba", 0x1112E: "\U00011131\U00011127",
+    0x1112F: "\U00011132\U00011127", 0x1134B: "\U00011347\U0001133e", 0x1134C: "\U00011347\U00011357",
+    0x114BB: "\U000114b9\U000114ba", 0x114BC: "\U000114b9\U000114b0", 0x114BE: "\U000114b9\U000114bd",
+    0x115BA: "\U000115b8\U000115af", 0x115BB: "\U000115b9\U000115af", 0x11938: "\U00011935\U00011930",
+    0x1D15E: "\U0001d157\U0001d165", 0x1D15F: "\U0001d158\U0001d165", 0x1D160: "\U0001d158\U0001d165\U0001d16e",
+    0x1D161: "\U0001d158\U0001d165\U0001d16f", 0x1D162: "\U0001d158\U0001d165\U0001d170", 0x1D163: "\U0001d158\U0001d165\U0001d171",
+    0x1D164: "\U0001d158\U0001d165\U0001d172", 0x1D1BB: "\U0001d1b9\U0001d165", 0x1D1BC: "\U0001d1ba\U0001d165",
+    0x1D1BD: "\U0001d1b9\U0001d165\U0001d16e", 0x1D1BE: "\U0001d1ba\U0001d165\U0001d16e", 0x1D1BF: "\U0001d1b9\U0001d165\U0001d16f",
+    0x1D1C0: "\U0001d1ba\U0001d165\U0001d16f", 0x2F800: "\u4e3d", 0x2F801: "\u4e38",
+    0x2F802: "\u4e41", 0x2F803: "\U00020122", 0x2F804: "\u4f60",
+    0x2F805: "\u4fae", 0x2F806: "\u4fbb", 0x2F807: "\u5002",
+    0x2F808: "\u507a", 0x2F809: "\u5099", 0x2F80A: "\u50e7",
+    0x2F80B: "\u50cf", 0x2F80C: "\u349e", 0x2F80D: "\U0002063a",
+    0x2F80E: "\u514d", 0x2F80F: "\u5154", 0x2F810: "\u5164",
+    0x2F811: "\u5177", 0x2F812: "\U0002051c", 0x2F813: "\u34b9",
+    0x2F814: "\u5167", 0x2F815: "\u518d", 0x2F816: "\U0002054b",
+    0x2F817: "\u5197", 0x2F818: "\u51a4", 0x2F819: "\u4ecc",
+    0x2F81A: "\u51ac", 0x2F81B: "\u51b5", 0x2F81C: "\U000291df",
+    0x2F81D: "\u51f5", 0x2F81E: "\u5203", 0x2F81F: "\u34df",
+    0x2F820: "\u523b", 0x2F821: "\u5246", 0x2F822: "\u5272",
+    0x2F823: "\u5277", 0x2F824: "\u3515", 0x2F825: "\u52c7",
+    0x2F826: "\u52c9", 0x2F827: "\u52e4", 0x2F828: "\u52fa",
+    0x2F829: "\u5305", 0x2F82A: "\u5306", 0x2F82B: "\u5317",
+    0x2F82C: "\u5349", 0x2F82D: "\u5351", 0x2F82E: "\u535a",
+    0x2F82F: "\u5373", 0x2F830: "\u537d", 0x2F831: "\u537f",
+    0x2F832: "\u537f", 0x2F833: "\u537f", 0x2F834: "\U00020a2c",
+    0x2F835: "\u7070", 0x2F836: "\u53ca", 0x2F837: "\u53df",
+    0x2F838: "\U00020b63", 0x2F839: "\u53eb", 0x2F83A: "\u53f1",
+    0x2F83B: "\u5406", 0x2F83C: "\u549e", 0x2F83D: "\u5438",
+    0x2F83E: "\u5448", 0x2F83F: "\u5468", 0x2F840: "\u54a2",
+    0x2F841: "\u54f6", 0x2F842: "\u5510", 0x2F843: "\u5553",
+    0x2F844: "\u5563", 0x2F845: "\u5584", 0x2F846: "\u5584",
+    0x2F847: "\u5599", 0x2F848: "\u55ab", 0x2F849: "\u55b3",
+    0x2F84A: "\u55c2", 0x2F84B: "\u5716", 0x2F84C: "\u5606",
+    0x2F84D: "\u5717", 0x2F84E: "\u5651", 0x2F84F: "\u5674",
+    0x2F850: "\u5207", 0x2F851: "\u58ee", 0x2F852: "\u57ce",
+    0x2F853: "\u57f4", 0x2F854: "\u580d", 0x2F855: "\u578b",
+    0x2F856: "\u5832", 0x2F857: "\u5831", 0x2F858: "\u58ac",
+    0x2F859: "\U000214e4", 0x2F85A: "\u58f2", 0x2F85B: "\u58f7",
+    0x2F85C: "\u5906", 0x2F85D: "\u591a", 0x2F85E: "\u5922",
+    0x2F85F: "\u5962", 0x2F860: "\U000216a8", 0x2F861: "\U000216ea",
+    0x2F862: "\u59ec", 0x2F863: "\u5a1b", 0x2F864: "\u5a27",
+    0x2F865: "\u59d8", 0x2F866: "\u5a66", 0x2F867: "\u36ee",
+    0x2F868: "\u36fc", 0x2F869: "\u5b08", 0x2F86A: "\u5b3e",
+    0x2F86B: "\u5b3e", 0x2F86C: "\U000219c8", 0x2F86D: "\u5bc3",
+    0x2F86E: "\u5bd8", 0x2F86F: "\u5be7", 0x2F870: "\u5bf3",
+    0x2F871: "\U00021b18", 0x2F872: "\u5bff", 0x2F873: "\u5c06",
+    0x2F874: "\u5f53", 0x2F875: "\u5c22", 0x2F876: "\u3781",
+    0x2F877: "\u5c60", 0x2F878: "\u5c6e", 0x2F879: "\u5cc0",
+    0x2F87A: "\u5c8d", 0x2F87B: "\U00021de4", 0x2F87C: "\u5d43",
+    0x2F87D: "\U00021de6", 0x2F87E: "\u5d6e", 0x2F87F: "\u5d6b",
+    0x2F880: "\u5d7c", 0x2F881: "\u5de1", 0x2F882: "\u5de2",
+    0x2F883: "\u382f", 0x2F884: "\u5dfd", 0x2F885: "\u5e28",
+    0x2F886: "\u5e3d", 0x2F887: "\u5e69", 0x2F888: "\u3862",
+    0x2F889: "\U00022183", 0x2F88A: "\u387c", 0x2F88B: "\u5eb0",
+    0x2F88C: "\u5eb3", 0x2F88D: "\u5eb6", 0x2F88E: "\u5eca",
+    0x2F88F: "\U0002a392", 0x2F890: "\u5efe", 0x2F891: "\U00022331",
+    0x2F892: "\U00022331", 0x2F893: "\u8201", 0x2F894: "\u5f22",
+    0x2F895: "\u5f22", 0x2F896: "\u38c7", 0x2F897: "\U000232b8",
+    0x2F898: "\U000261da", 0x2F899: "\u5f62", 0x2F89A: "\u5f6b",
+    0x2F89B: "\u38e3", 0x2F89C: "\u5f9a", 0x2F89D: "\u5fcd",
+    0x2F89E: "\u5fd7", 0x2F89F: "\u5ff9", 0x2F8A0: "\u6081",
+    0x2F8A1: "\u393a", 0x2F8A2: "\u391c", 0x2F8A3: "\u6094",
+    0x2F8A4: "\U000226d4", 0x2F8A5: "\u60c7", 0x2F8A6: "\u6148",
+    0x2F8A7: "\u614c", 0x2F8A8: "\u614e", 0x2F8A9: "\u614c",
+    0x2F8AA: "\u617a", 0x2F8AB: "\u618e", 0x2F8AC: "\u61b2",
+    0x2F8AD: "\u61a4", 0x2F8AE: "\u61af", 0x2F8AF: "\u61de",
+    0x2F8B0: "\u61f2", 0x2F8B1: "\u61f6", 0x2F8B2: "\u6210",
+    0x2F8B3: "\u621b", 0x2F8B4: "\u625d", 0x2F8B5: "\u62b1",
+    0x2F8B6: "\u62d4", 0x2F8B7: "\u6350", 0x2F8B8: "\U00022b0c",
+    0x2F8B9: "\u633d", 0x2F8BA: "\u62fc", 0x2F8BB: "\u6368",
+    0x2F8BC: "\u6383", 0x2F8BD: "\u63e4", 0x2F8BE: "\U00022bf1",
+    0x2F8BF: "\u6422", 0x2F8C0: "\u63c5", 0x2F8C1: "\u63a9",
+    0x2F8C2: "\u3a2e", 0x2F8C3: "\u6469", 0x2F8C4: "\u647e",
+    0x2F8C5: "\u649d", 0x2F8C6: "\u6477", 0x2F8C7: "\u3a6c",
+    0x2F8C8: "\u654f", 0x2F8C9: "\u656c", 0x2F8CA: "\U0002300a",
+    0x2F8CB: "\u65e3", 0x2F8CC: "\u66f8", 0x2F8CD: "\u6649",
+    0x2F8CE: "\u3b19", 0x2F8CF: "\u6691", 0x2F8D0: "\u3b08",
+    0x2F8D1: "\u3ae4", 0x2F8D2: "\u5192", 0x2F8D3: "\u5195",
+    0x2F8D4: "\u6700", 0x2F8D5: "\u669c", 0x2F8D6: "\u80ad",
+    0x2F8D7: "\u43d9", 0x2F8D8: "\u6717", 0x2F8D9: "\u671b",
+    0x2F8DA: "\u6721", 0x2F8DB: "\u675e", 0x2F8DC: "\u6753",
+    0x2F8DD: "\U000233c3", 0x2F8DE: "\u3b49", 0x2F8DF: "\u67fa",
+    0x2F8E0: "\u6785", 0x2F8E1: "\u6852", 0x2F8E2: "\u6885",
+    0x2F8E3: "\U0002346d", 0x2F8E4: "\u688e", 0x2F8E5: "\u681f",
+    0x2F8E6: "\u6914", 0x2F8E7: "\u3b9d", 0x2F8E8: "\u6942",
+    0x2F8E9: "\u69a3", 0x2F8EA: "\u69ea", 0x2F8EB: "\u6aa8",
+    0x2F8EC: "\U000236a3", 0x2F8ED: "\u6adb", 0x2F8EE: "\u3c18",
+    0x2F8EF: "\u6b21", 0x2F8F0: "\U000238a7", 0x2F8F1: "\u6b54",
+    0x2F8F2: "\u3c4e", 0x2F8F3: "\u6b72", 0x2F8F4: "\u6b9f",
+    0x2F8F5: "\u6bba", 0x2F8F6: "\u6bbb", 0x2F8F7: "\U00023a8d",
+    0x2F8F8: "\U00021d0b", 0x2F8F9: "\U00023afa", 0x2F8FA: "\u6c4e",
+    0x2F8FB: "\U00023cbc", 0x2F8FC: "\u6cbf", 0x2F8FD: "\u6ccd",
+    0x2F8FE: "\u6c67", 0x2F8FF: "\u6d16", 0x2F900: "\u6d3e",
+    0x2F901: "\u6d77", 0x2F902: "\u6d41", 0x2F903: "\u6d69",
+    0x2F904: "\u6d78", 0x2F905: "\u6d85", 0x2F906: "\U00023d1e",
+    0x2F907: "\u6d34", 0x2F908: "\u6e2f", 0x2F909: "\u6e6e",
+    0x2F90A: "\u3d33", 0x2F90B: "\u6ecb", 0x2F90C: "\u6ec7",
+    0x2F90D: "\U00023ed1", 0x2F90E: "\u6df9", 0x2F90F: "\u6f6e",
+    0x2F910: "\U00023f5e", 0x2F911: "\U00023f8e", 0x2F912: "\u6fc6",
+    0x2F913: "\u7039", 0x2F914: "\u701e", 0x2F915: "\u701b",
+    0x2F916: "\u3d96", 0x2F917: "\u704a", 0x2F918: "\u707d",
+    0x2F919: "\u7077", 0x2F91A: "\u70ad", 0x2F91B: "\U00020525",
+    0x2F91C: "\u7145", 0x2F91D: "\U00024263", 0x2F91E: "\u719c",
+    0x2F91F: "\U000243ab", 0x2F920: "\u7228", 0x2F921: "\u7235",
+    0x2F922: "\u7250", 0x2F923: "\U00024608", 0x2F924: "\u7280",
+    0x2F925: "\u7295", 0x2F926: "\U00024735", 0x2F927: "\U00024814",
+    0x2F928: "\u737a", 0x2F929: "\u738b", 0x2F92A: "\u3eac",
+    0x2F92B: "\u73a5", 0x2F92C: "\u3eb8", 0x2F92D: "\u3eb8",
+    0x2F92E: "\u7447", 0x2F92F: "\u745c", 0x2F930: "\u7471",
+    0x2F931: "\u7485", 0x2F932: "\u74ca", 0x2F933: "\u3f1b",
+    0x2F934: "\u7524", 0x2F935: "\U00024c36", 0x2F936: "\u753e",
+    0x2F937: "\U00024c92", 0x2F938: "\u7570", 0x2F939: "\U0002219f",
+    0x2F93A: "\u7610", 0x2F93B: "\U00024fa1", 0x2F93C: "\U00024fb8",
+    0x2F93D: "\U00025044", 0x2F93E: "\u3ffc", 0x2F93F: "\u4008",
+    0x2F940: "\u76f4", 0x2F941: "\U000250f3", 0x2F942: "\U000250f2",
+    0x2F943: "\U00025119", 0x2F944: "\U00025133", 0x2F945: "\u771e",
+    0x2F946: "\u771f", 0x2F947: "\u771f", 0x2F948: "\u774a",
+    0x2F949: "\u4039", 0x2F94A: "\u778b", 0x2F94B: "\u4046",
+    0x2F94C: "\u4096", 0x2F94D: "\U0002541d", 0x2F94E: "\u784e",
+    0x2F94F: "\u788c", 0x2F950: "\u78cc", 0x2F951: "\u40e3",
+    0x2F952: "\U00025626", 0x2F953: "\u7956", 0x2F954: "\U0002569a",
+    0x2F955: "\U000256c5", 0x2F956: "\u798f", 0x2F957: "\u79eb",
+    0x2F958: "\u412f", 0x2F959: "\u7a40", 0x2F95A: "\u7a4a",
+    0x2F95B: "\u7a4f", 0x2F95C: "\U0002597c", 0x2F95D: "\U00025aa7",
+    0x2F95E: "\U00025aa7", 0x2F95F: "\u7aee", 0x2F960: "\u4202",
+    0x2F961: "\U00025bab", 0x2F962: "\u7bc6", 0x2F963: "\u7bc9",
+    0x2F964: "\u4227", 0x2F965: "\U00025c80", 0x2F966: "\u7cd2",
+    0x2F967: "\u42a0", 0x2F968: "\u7ce8", 0x2F969: "\u7ce3",
+    0x2F96A: "\u7d00", 0x2F96B: "\U00025f86", 0x2F96C: "\u7d63",
+    0x2F96D: "\u4301", 0x2F96E: "\u7dc7", 0x2F96F: "\u7e02",
+    0x2F970: "\u7e45", 0x2F971: "\u4334", 0x2F972: "\U00026228",
+    0x2F973: "\U00026247", 0x2F974: "\u4359", 0x2F975: "\U000262d9",
+    0x2F976: "\u7f7a", 0x2F977: "\U0002633e", 0x2F978: "\u7f95",
+    0x2F979: "\u7ffa", 0x2F97A: "\u8005", 0x2F97B: "\U000264da",
+    0x2F97C: "\U00026523", 0x2F97D: "\u8060", 0x2F97E: "\U000265a8",
+    0x2F97F: "\u8070", 0x2F980: "\U0002335f", 0x2F981: "\u43d5",
+    0x2F982: "\u80b2", 0x2F983: "\u8103", 0x2F984: "\u440b",
+    0x2F985: "\u813e", 0x2F986: "\u5ab5", 0x2F987: "\U000267a7",
+    0x2F988: "\U000267b5", 0x2F989: "\U00023393", 0x2F98A: "\U0002339c",
+    0x2F98B: "\u8201", 0x2F98C: "\u8204", 0x2F98D: "\u8f9e",
+    0x2F98E: "\u446b", 0x2F98F: "\u8291", 0x2F990: "\u828b",
+    0x2F991: "\u829d", 0x2F992: "\u52b3", 0x2F993: "\u82b1",
+    0x2F994: "\u82b3", 0x2F995: "\u82bd", 0x2F996: "\u82e6",
+    0x2F997: "\U00026b3c", 0x2F998: "\u82e5", 0x2F999: "\u831d",
+    0x2F99A: "\u8363", 0x2F99B: "\u83ad", 0x2F99C: "\u8323",
+    0x2F99D: "\u83bd", 0x2F99E: "\u83e7", 0x2F99F: "\u8457",
+    0x2F9A0: "\u8353", 0x2F9A1: "\u83ca", 0x2F9A2: "\u83cc",
+    0x2F9A3: "\u83dc", 0x2F9A4: "\U00026c36", 0x2F9A5: "\U00026d6b",
+    0x2F9A6: "\U00026cd5", 0x2F9A7: "\u452b", 0x2F9A8: "\u84f1",
+    0x2F9A9: "\u84f3", 0x2F9AA: "\u8516", 0x2F9AB: "\U000273ca",
+    0x2F9AC: "\u8564", 0x2F9AD: "\U00026f2c", 0x2F9AE: "\u455d",
+    0x2F9AF: "\u4561", 0x2F9B0: "\U00026fb1", 0x2F9B1: "\U000270d2",
+    0x2F9B2: "\u456b", 0x2F9B3: "\u8650", 0x2F9B4: "\u865c",
+    0x2F9B5: "\u8667", 0x2F9B6: "\u8669", 0x2F9B7: "\u86a9",
+    0x2F9B8: "\u8688", 0x2F9B9: "\u870e", 0x2F9BA: "\u86e2",
+    0x2F9BB: "\u8779", 0x2F9BC: "\u8728", 0x2F9BD: "\u876b",
+    0x2F9BE: "\u8786", 0x2F9BF: "\u45d7", 0x2F9C0: "\u87e1",
+    0x2F9C1: "\u8801", 0x2F9C2: "\u45f9", 0x2F9C3: "\u8860",
+    0x2F9C4: "\u8863", 0x2F9C5: "\U00027667", 0x2F9C6: "\u88d7",
+    0x2F9C7: "\u88de", 0x2F9C8: "\u4635", 0x2F9C9: "\u88fa",
+    0x2F9CA: "\u34bb", 0x2F9CB: "\U000278ae", 0x2F9CC: "\U00027966",
+    0x2F9CD: "\u46be", 0x2F9CE: "\u46c7", 0x2F9CF: "\u8aa0",
+    0x2F9D0: "\u8aed", 0x2F9D1: "\u8b8a", 0x2F9D2: "\u8c55",
+    0x2F9D3: "\U00027ca8", 0x2F9D4: "\u8cab", 0x2F9D5: "\u8cc1",
+    0x2F9D6: "\u8d1b", 0x2F9D7: "\u8d77", 0x2F9D8: "\U00027f2f",
+    0x2F9D9: "\U00020804", 0x2F9DA: "\u8dcb", 0x2F9DB: "\u8dbc",
+    0x2F9DC: "\u8df0", 0x2F9DD: "\U000208de", 0x2F9DE: "\u8ed4",
+    0x2F9DF: "\u8f38", 0x2F9E0: "\U000285d2", 0x2F9E1: "\U000285ed",
+    0x2F9E2: "\u9094", 0x2F9E3: "\u90f1", 0x2F9E4: "\u9111",
+    0x2F9E5: "\U0002872e", 0x2F9E6: "\u911b", 0x2F9E7: "\u9238",
+    0x2F9E8: "\u92d7", 0x2F9E9: "\u92d8", 0x2F9EA: "\u927c",
+    0x2F9EB: "\u93f9", 0x2F9EC: "\u9415", 0x2F9ED: "\U00028bfa",
+    0x2F9EE: "\u958b", 0x2F9EF: "\u4995", 0x2F9F0: "\u95b7",
+    0x2F9F1: "\U00028d77", 0x2F9F2: "\u49e6", 0x2F9F3: "\u96c3",
+    0x2F9F4: "\u5db2", 0x2F9F5: "\u9723", 0x2F9F6: "\U00029145",
+    0x2F9F7: "\U0002921a", 0x2F9F8: "\u4a6e", 0x2F9F9: "\u4a76",
+    0x2F9FA: "\u97e0", 0x2F9FB: "\U0002940a", 0x2F9FC: "\u4ab2",
+    0x2F9FD: "\U00029496", 0x2F9FE: "\u980b", 0x2F9FF: "\u980b",
+    0x2FA00: "\u9829", 0x2FA01: "\U000295b6", 0x2FA02: "\u98e2",
+    0x2FA03: "\u4b33", 0x2FA04: "\u9929", 0x2FA05: "\u99a7",
+    0x2FA06: "\u99c2", 0x2FA07: "\u99fe", 0x2FA08: "\u4bce",
+    0x2FA09: "\U00029b30", 0x2FA0A: "\u9b12", 0x2FA0B: "\u9c40",
+    0x2FA0C: "\u9cfd", 0x2FA0D: "\u4cce", 0x2FA0E: "\u4ced",
+    0x2FA0F: "\u9d67", 0x2FA10: "\U0002a0ce", 0x2FA11: "\u4cf8",
+    0x2FA12: "\U0002a105", 0x2FA13: "\U0002a20e", 0x2FA14: "\U0002a291",
+    0x2FA15: "\u9ebb", 0x2FA16: "\u4d56", 0x2FA17: "\u9ef9",
+    0x2FA18: "\u9efe", 0x2FA19: "\u9f05", 0x2FA1A: "\u9f0f",
+    0x2FA1B: "\u9f16", 0x2FA1C: "\u9f3b", 0x2FA1D: "\U0002a600",
+}
+
+// nfcCompositions maps a starter and the rune after it to their
+// primary composite; composition exclusions are left out.
+var nfcCompositions = map[[2]rune]rune{
+    {0x0041, 0x0300}: 0x00C0, {0x0041, 0x0301}: 0x00C1, {0x0041, 0x0302}: 0x00C2,
+    {0x0041, 0x0303}: 0x00C3, {0x0041, 0x0308}: 0x00C4, {0x0041, 0x030A}: 0x00C5,
+    {0x0043, 0x0327}: 0x00C7, {0x0045, 0x0300}: 0x00C8, {0x0045, 0x0301}: 0x00C9,
+    {0x0045, 0x0302}: 0x00CA, {0x0045, 0x0308}: 0x00CB, {0x0049, 0x0300}: 0x00CC,
+    {0x0049, 0x0301}: 0x00CD, {0x0049, 0x0302}: 0x00CE, {0x0049, 0x0308}: 0x00CF,
+    {0x004E, 0x0303}: 0x00D1, {0x004F, 0x0300}: 0x00D2, {0x004F, 0x0301}: 0x00D3,
+    {0x004F, 0x0302}: 0x00D4, {0x004F, 0x0303}: 0x00D5, {0x004F, 0x0308}: 0x00D6,
+    {0x0055, 0x0300}: 0x00D9, {0x0055, 0x0301}: 0x00DA, {0x0055, 0x0302}: 0x00DB,
+    {0x0055, 0x0308}: 0x00DC, {0x0059, 0x0301}: 0x00DD, {0x0061, 0x0300}: 0x00E0,
+    {0x0061, 0x0301}: 0x00E1, {0x0061, 0x0302}: 0x00E2, {0x0061, 0x0303}: 0x00E3,
+    {0x0061, 0x0308}: 0x00E4, {0x0061, 0x030A}: 0x00E5, {0x0063, 0x0327}: 0x00E7,
+    {0x0065, 0x0300}: 0x00E8, {0x0065, 0x0301}: 0x00E9, {0x0065, 0x0302}: 0x00EA,
+    {0x0065, 0x0308}: 0x00EB, {0x0069, 0x0300}: 0x00EC, {0x0069, 0x0301}: 0x00ED,
+    {0x0069, 0x0302}: 0x00EE, {0x0069, 0x0308}: 0x00EF, {0x006E, 0x0303}: 0x00F1,
+    {0x006F, 0x0300}: 0x00F2, {0x006F, 0x0301}: 0x00F3, {0x006F, 0x0302}: 0x00F4,
+    {0x006F, 0x0303}: 0x00F5, {0x006F, 0x0308}: 0x00F6, {0x0075, 0x0300}: 0x00F9,
+    {0x0075, 0x0301}: 0x00FA, {0x0075, 0x0302}: 0x00FB, {0x0075, 0x0308}: 0x00FC,
+    {0x0079, 0x0301}: 0x00FD, {0x0079, 0x0308}: 0x00FF, {0x0041, 0x0304}: 0x0100,
+    {0x0061, 0x0304}: 0x0101, {0x0041, 0x0306}: 0x0102, {0x0061, 0x0306}: 0x0103,
+    {0x0041, 0x0328}: 0x0104, {0x0061, 0x0328}: 0x0105, {0x0043, 0x0301}: 0x0106,
+    {0x0063, 0x0301}: 0x0107, {0x0043, 0x0302}: 0x0108, {0x0063, 0x0302}: 0x0109,
+    {0x0043, 0x0307}: 0x010A, {0x0063, 0x0307}: 0x010B, {0x0043, 0x030C}: 0x010C,
+    {0x0063, 0x030C}: 0x010D, {0x0044, 0x030C}: 0x010E, {0x0064, 0x030C}: 0x010F,
+    {0x0045, 0x0304}: 0x0112, {0x0065, 0x0304}: 0x0113, {0x0045, 0x0306}: 0x0114,
+    {0x0065, 0x0306}: 0x0115, {0x0045, 0x0307}: 0x0116, {0x0065, 0x0307}: 0x0117,
+    {0x0045, 0x0328}: 0x0118, {0x0065, 0x0328}: 0x0119, {0x0045, 0x030C}: 0x011A,
+    {0x0065, 0x030C}: 0x011B, {0x0047, 0x0302}: 0x011C, {0x0067, 0x0302}: 0x011D,
+    {0x0047, 0x0306}: 0x011E, {0x0067, 0x0306}: 0x011F, {0x0047, 0x0307}: 0x0120,
+    {0x0067, 0x0307}: 0x0121, {0x0047, 0x0327}: 0x0122, {0x0067, 0x0327}: 0x0123,
+    {0x0048, 0x0302}: 0x0124, {0x0068, 0x0302}: 0x0125, {0x0049, 0x0303}: 0x0128,
+    {0x0069, 0x0303}: 0x0129, {0x0049, 0x0304}: 0x012A, {0x0069, 0x0304}: 0x012B,
+    {0x0049, 0x0306}: 0x012C, {0x0069, 0x0306}: 0x012D, {0x0049, 0x0328}: 0x012E,
+    {0x0069, 0x0328}: 0x012F, {0x0049, 0x0307}: 0x0130, {0x004A, 0x0302}: 0x0134,
+    {0x006A, 0x0302}: 0x0135, {0x004B, 0x0327}: 0x0136, {0x006B, 0x0327}: 0x0137,
+    {0x004C, 0x0301}: 0x0139, {0x006C, 0x0301}: 0x013A, {0x004C, 0x0327}: 0x013B,
+    {0x006C, 0x0327}: 0x013C, {0x004C, 0x030C}: 0x013D, {0x006C, 0x030C}: 0x013E,
+    {0x004E, 0x0301}: 0x0143, {0x006E, 0x0301}: 0x0144, {0x004E, 0x0327}: 0x0145,
+    {0x006E, 0x0327}: 0x0146, {0x004E, 0x030C}: 0x0147, {0x006E, 0x030C}: 0x0148,
+    {0x004F, 0x0304}: 0x014C, {0x006F, 0x0304}: 0x014D, {0x004F, 0x0306}: 0x014E,
+    {0x006F, 0x0306}: 0x014F, {0x004F, 0x030B}: 0x0150, {0x006F, 0x030B}: 0x0151,
+    {0x0052, 0x0301}: 0x0154, {0x0072, 0x0301}: 0x0155, {0x0052, 0x0327}: 0x0156,
+    {0x0072, 0x0327}: 0x0157, {0x0052, 0x030C}: 0x0158, {0x0072, 0x030C}: 0x0159,
+    {0x0053, 0x0301}: 0x015A, {0x0073, 0x0301}: 0x015B, {0x0053, 0x0302}: 0x015C,
+    {0x0073, 0x0302}: 0x015D, {0x0053, 0x0327}: 0x015E, {0x0073, 0x0327}: 0x015F,
+    {0x0053, 0x030C}: 0x0160, {0x0073, 0x030C}: 0x0161, {0x0054, 0x0327}: 0x0162,
+    {0x0074, 0x0327}: 0x0163, {0x0054, 0x030C}: 0x0164, {0x0074, 0x030C}: 0x0165,
+    {0x0055, 0x0303}: 0x0168, {0x0075, 0x0303}: 0x0169, {0x0055, 0x0304}: 0x016A,
+    {0x0075, 0x0304}: 0x016B, {0x0055, 0x0306}: 0x016C, {0x0075, 0x0306}: 0x016D,
+    {0x0055, 0x030A}: 0x016E, {0x0075, 0x030A}: 0x016F, {0x0055, 0x030B}: 0x0170,
+    {0x0075, 0x030B}: 0x0171, {0x0055, 0x0328}: 0x0172, {0x0075, 0x0328}: 0x0173,
+    {0x0057, 0x0302}: 0x0174, {0x0077, 0x0302}: 0x0175, {0x0059, 0x0302}: 0x0176,
+    {0x0079, 0x0302}: 0x0177, {0x0059, 0x0308}: 0x0178, {0x005A, 0x0301}: 0x0179,
+    {0x007A, 0x0301}: 0x017A, {0x005A, 0x0307}: 0x017B, {0x007A, 0x0307}: 0x017C,
+    {0x005A, 0x030C}: 0x017D, {0x007A, 0x030C}: 0x017E, {0x004F, 0x031B}: 0x01A0,
+    {0x006F, 0x031B}: 0x01A1, {0x0055, 0x031B}: 0x01AF, {0x0075, 0x031B}: 0x01B0,
+    {0x0041, 0x030C}: 0x01CD, {0x0061, 0x030C}: 0x01CE, {0x0049, 0x030C}: 0x01CF,
+    {0x0069, 0x030C}: 0x01D0, {0x004F, 0x030C}: 0x01D1, {0x006F, 0x030C}: 0x01D2,
+    {0x0055, 0x030C}: 0x01D3, {0x0075, 0x030C}: 0x01D4, {0x00DC, 0x0304}: 0x01D5,
+    {0x00FC, 0x0304}: 0x01D6, {0x00DC, 0x0301}: 0x01D7, {0x00FC, 0x0301}: 0x01D8,
+    {0x00DC, 0x030C}: 0x01D9, {0x00FC, 0x030C}: 0x01DA, {0x00DC, 0x0300}: 0x01DB,
+    {0x00FC, 0x0300}: 0x01DC, {0x00C4, 0x0304}: 0x01DE, {0x00E4, 0x0304}: 0x01DF,
+    {0x0226, 0x0304}: 0x01E0, {0x0227, 0x0304}: 0x01E1, {0x00C6, 0x0304}: 0x01E2,
+    {0x00E6, 0x0304}: 0x01E3, {0x0047, 0x030C}: 0x01E6, {0x0067, 0x030C}: 0x01E7,
+    {0x004B, 0x030C}: 0x01E8, {0x006B, 0x030C}: 0x01E9, {0x004F, 0x0328}: 0x01EA,
+    {0x006F, 0x0328}: 0x01EB, {0x01EA, 0x0304}: 0x01EC, {0x01EB, 0x0304}: 0x01ED,
+    {0x01B7, 0x030C}: 0x01EE, {0x0292, 0x030C}: 0x01EF, {0x006A, 0x030C}: 0x01F0,
+    {0x0047, 0x0301}: 0x01F4, {0x0067, 0x0301}: 0x01F5, {0x004E, 0x0300}: 0x01F8,
+    {0x006E, 0x0300}: 0x01F9, {0x00C5, 0x0301}: 0x01FA, {0x00E5, 0x0301}: 0x01FB,
+    {0x00C6, 0x0301}: 0x01FC, {0x00E6, 0x0301}: 0x01FD, {0x00D8, 0x0301}: 0x01FE,
+    {0x00F8, 0x0301}: 0x01FF, {0x0041, 0x030F}: 0x0200, {0x0061, 0x030F}: 0x0201,
+    {0x0041, 0x0311}: 0x0202, {0x0061, 0x0311}: 0x0203, {0x0045, 0x030F}: 0x0204,
+    {0x0065, 0x030F}: 0x0205, {0x0045, 0x0311}: 0x0206, {0x0065, 0x0311}: 0x0207,
+    {0x0049, 0x030F}: 0x0208, {0x0069, 0x030F}: 0x0209, {0x0049, 0x0311}: 0x020A,
+    {0x0069, 0x0311}: 0x020B, {0x004F, 0x030F}: 0x020C, {0x006F, 0x030F}: 0x020D,
+    {0x004F, 0x0311}: 0x020E, {0x006F, 0x0311}: 0x020F, {0x0052, 0x030F}: 0x0210,
+    {0x0072, 0x030F}: 0x0211, {0x0052, 0x0311}: 0x0212, {0x0072, 0x0311}: 0x0213,
+    {0x0055, 0x030F}: 0x0214, {0x0075, 0x030F}: 0x0215, {0x0055, 0x0311}: 0x0216,
+    {0x0075, 0x0311}: 0x0217, {0x0053, 0x0326}: 0x0218, {0x0073, 0x0326}: 0x0219,
+    {0x0054, 0x0326}: 0x021A, {0x0074, 0x0326}: 0x021B, {0x0048, 0x030C}: 0x021E,
+    {0x0068, 0x030C}: 0x021F, {0x0041, 0x0307}: 0x0226, {0x0061, 0x0307}: 0x0227,
+    {0x0045, 0x0327}: 0x0228, {0x0065, 0x0327}: 0x0229, {0x00D6, 0x0304}: 0x022A,
+    {0x00F6, 0x0304}: 0x022B, {0x00D5, 0x0304}: 0x022C, {0x00F5, 0x0304}: 0x022D,
+    {0x004F, 0x0307}: 0x022E, {0x006F, 0x0307}: 0x022F, {0x022E, 0x0304}: 0x0230,
+    {0x022F, 0x0304}: 0x0231, {0x0059, 0x0304}: 0x0232, {0x0079, 0x0304}: 0x0233,
+    {0x00A8, 0x0301}: 0x0385, {0x0391, 0x0301}: 0x0386, {0x0395, 0x0301}: 0x0388,
+    {0x0397, 0x0301}: 0x0389, {0x0399, 0x0301}: 0x038A, {0x039F, 0x0301}: 0x038C,
+    {0x03A5, 0x0301}: 0x038E, {0x03A9, 0x0301}: 0x038F, {0x03CA, 0x0301}: 0x0390,
+    {0x0399, 0x0308}: 0x03AA, {0x03A5, 0x0308}: 0x03AB, {0x03B1, 0x0301}: 0x03AC,
+    {0x03B5, 0x0301}: 0x03AD, {0x03B7, 0x0301}: 0x03AE, {0x03B9, 0x0301}: 0x03AF,
+    {0x03CB, 0x0301}: 0x03B0, {0x03B9, 0x0308}: 0x03CA, {0x03C5, 0x0308}: 0x03CB,
+    {0x03BF, 0x0301}: 0x03CC, {0x03C5, 0x0301}: 0x03CD, {0x03C9, 0x0301}: 0x03CE,
+    {0x03D2, 0x0301}: 0x03D3, {0x03D2, 0x0308}: 0x03D4, {0x0415, 0x0300}: 0x0400,
+    {0x0415, 0x0308}: 0x0401, {0x0413, 0x0301}: 0x0403, {0x0406, 0x0308}: 0x0407,
+    {0x041A, 0x0301}: 0x040C, {0x0418, 0x0300}: 0x040D, {0x0423, 0x0306}: 0x040E,
+    {0x0418, 0x0306}: 0x0419, {0x0438, 0x0306}: 0x0439, {0x0435, 0x0300}: 0x0450,
+    {0x0435, 0x0308}: 0x0451, {0x0433, 0x0301}: 0x0453, {0x0456, 0x0308}: 0x0457,
+    {0x043A, 0x0301}: 0x045C, {0x0438, 0x0300}: 0x045D, {0x0443, 0x0306}: 0x045E,
+    {0x0474, 0x030F}: 0x0476, {0x0475, 0x030F}: 0x0477, {0x0416, 0x0306}: 0x04C1,
+    {0x0436, 0x0306}: 0x04C2, {0x0410, 0x0306}: 0x04D0, {0x0430, 0x0306}: 0x04D1,
+    {0x0410, 0x0308}: 0x04D2, {0x0430, 0x0308}: 0x04D3, {0x0415, 0x0306}: 0x04D6,
+    {0x0435, 0x0306}: 0x04D7, {0x04D8, 0x0308}: 0x04DA, {0x04D9, 0x0308}: 0x04DB,
+    {0x0416, 0x0308}: 0x04DC, {0x0436, 0x0308}: 0x04DD, {0x0417, 0x0308}: 0x04DE,
+    {0x0437, 0x0308}: 0x04DF, {0x0418, 0x0304}: 0x04E2, {0x0438, 0x0304}: 0x04E3,
+    {0x0418, 0x0308}: 0x04E4, {0x0438, 0x0308}: 0x04E5, {0x041E, 0x0308}: 0x04E6,
+    {0x043E, 0x0308}: 0x04E7, {0x04E8, 0x0308}: 0x04EA, {0x04E9, 0x0308}: 0x04EB,
+    {0x042D, 0x0308}: 0x04EC, {0x044D, 0x0308}: 0x04ED, {0x0423, 0x0304}: 0x04EE,
+    {0x0443, 0x0304}: 0x04EF, {0x0423, 0x0308}: 0x04F0, {0x0443, 0x0308}: 0x04F1,
+    {0x0423, 0x030B}: 0x04F2, {0x0443, 0x030B}: 0x04F3, {0x0427, 0x0308}: 0x04F4,
+    {0x0447, 0x0308}: 0x04F5, {0x042B, 0x0308}: 0x04F8, {0x044B, 0x0308}: 0x04F9,
+    {0x0627, 0x0653}: 0x0622, {0x0627, 0x0654}: 0x0623, {0x0648, 0x0654}: 0x0624,
+    {0x0627, 0x0655}: 0x0625, {0x064A, 0x0654}: 0x0626, {0x06D5, 0x0654}: 0x06C0,
+    {0x06C1, 0x0654}: 0x06C2, {0x06D2, 0x0654}: 0x06D3, {0x0928, 0x093C}: 0x0929,
+    {0x0930, 0x093C}: 0x0931, {0x0933, 0x093C}: 0x0934, {0x09C7, 0x09BE}: 0x09CB,
+    {0x09C7, 0x09D7}: 0x09CC, {0x0B47, 0x0B56}: 0x0B48, {0x0B47, 0x0B3E}: 0x0B4B,
+    {0x0B47, 0x0B57}: 0x0B4C, {0x0B92, 0x0BD7}: 0x0B94, {0x0BC6, 0x0BBE}: 0x0BCA,
+    {0x0BC7, 0x0BBE}: 0x0BCB, {0x0BC6, 0x0BD7}: 0x0BCC, {0x0C46, 0x0C56}: 0x0C48,
+    {0x0CBF, 0x0CD5}: 0x0CC0, {0x0CC6, 0x0CD5}: 0x0CC7, {0x0CC6, 0x0CD6}: 0x0CC8,
+    {0x0CC6, 0x0CC2}: 0x0CCA, {0x0CCA, 0x0CD5}: 0x0CCB, {0x0D46, 0x0D3E}: 0x0D4A,
+    {0x0D47, 0x0D3E}: 0x0D4B, {0x0D46, 0x0D57}: 0x0D4C, {0x0DD9, 0x0DCA}: 0x0DDA,
+    {0x0DD9, 0x0DCF}: 0x0DDC, {0x0DDC, 0x0DCA}: 0x0DDD, {0x0DD9, 0x0DDF}: 0x0DDE,
+    {0x1025, 0x102E}: 0x1026, {0x1B05, 0x1B35}: 0x1B06, {0x1B07, 0x1B35}: 0x1B08,
+    {0x1B09, 0x1B35}: 0x1B0A, {0x1B0B, 0x1B35}: 0x1B0C, {0x1B0D, 0x1B35}: 0x1B0E,
+    {0x1B11, 0x1B35}: 0x1B12, {0x1B3A, 0x1B35}: 0x1B3B, {0x1B3C, 0x1B35}: 0x1B3D,
+    {0x1B3E, 0x1B35}: 0x1B40, {0x1B3F, 0x1B35}: 0x1B41, {0x1B42, 0x1B35}: 0x1B43,
+    {0x0041, 0x0325}: 0x1E00, {0x0061, 0x0325}: 0x1E01, {0x0042, 0x0307}: 0x1E02,
+    {0x0062, 0x0307}: 0x1E03, {0x0042, 0x0323}: 0x1E04, {0x0062, 0x0323}: 0x1E05,
+    {0x0042, 0x0331}: 0x1E06, {0x0062, 0x0331}: 0x1E07, {0x00C7, 0x0301}: 0x1E08,
+    {0x00E7, 0x0301}: 0x1E09, {0x0044, 0x0307}: 0x1E0A, {0x0064, 0x0307}: 0x1E0B,
+    {0x0044, 0x0323}: 0x1E0C, {0x0064, 0x0323}: 0x1E0D, {0x0044, 0x0331}: 0x1E0E,
+    {0x0064, 0x0331}: 0x1E0F, {0x0044, 0x0327}: 0x1E10, {0x0064, 0x0327}: 0x1E11,
+    {0x0044, 0x032D}: 0x1E12, {0x0064, 0x032D}: 0x1E13, {0x0112, 0x0300}: 0x1E14,
+    {0x0113, 0x0300}: 0x1E15, {0x0112, 0x0301}: 0x1E16, {0x0113, 0x0301}: 0x1E17,
+    {0x0045, 0x032D}: 0x1E18, {0x0065, 0x032D}: 0x1E19, {0x0045, 0x0330}: 0x1E1A,
+    {0x0065, 0x0330}: 0x1E1B, {0x0228, 0x0306}: 0x1E1C, {0x0229, 0x0306}: 0x1E1D,
+    {0x0046, 0x0307}: 0x1E1E, {0x0066, 0x0307}: 0x1E1F, {0x0047, 0x0304}: 0x1E20,
+    {0x0067, 0x0304}: 0x1E21, {0x0048, 0x0307}: 0x1E22, {0x0068, 0x0307}: 0x1E23,
+    {0x0048, 0x0323}: 0x1E24, {0x0068, 0x0323}: 0x1E25, {0x0048, 0x0308}: 0x1E26,
+    {0x0068, 0x0308}: 0x1E27, {0x0048, 0x0327}: 0x1E28, {0x0068, 0x0327}: 0x1E29,
+    {0x0048, 0x032E}: 0x1E2A, {0x0068, 0x032E}: 0x1E2B, {0x0049, 0x0330}: 0x1E2C,
+    {0x0069, 0x0330}: 0x1E2D, {0x00CF, 0x0301}: 0x1E2E, {0x00EF, 0x0301}: 0x1E2F,
+    {0x004B, 0x0301}: 0x1E30, {0x006B, 0x0301}: 0x1E31, {0x004B, 0x0323}: 0x1E32,
+    {0x006B, 0x0323}: 0x1E33, {0x004B, 0x0331}: 0x1E34, {0x006B, 0x0331}: 0x1E35,
+    {0x004C, 0x0323}: 0x1E36, {0x006C, 0x0323}: 0x1E37, {0x1E36, 0x0304}: 0x1E38,
+    {0x1E37, 0x0304}: 0x1E39, {0x004C, 0x0331}: 0x1E3A, {0x006C, 0x0331}: 0x1E3B,
+    {0x004C, 0x032D}: 0x1E3C, {0x006C, 0x032D}: 0x1E3D, {0x004D, 0x0301}: 0x1E3E,
+    {0x006D, 0x0301}: 0x1E3F, {0x004D, 0x0307}: 0x1E40, {0x006D, 0x0307}: 0x1E41,
+    {0x004D, 0x0323}: 0x1E42, {0x006D, 0x0323}: 0x1E43, {0x004E, 0x0307}: 0x1E44,
+    {0x006E, 0x0307}: 0x1E45, {0x004E, 0x0323}: 0x1E46, {0x006E, 0x0323}: 0x1E47,
+    {0x004E, 0x0331}: 0x1E48, {0x006E, 0x0331}: 0x1E49, {0x004E, 0x032D}: 0x1E4A,
+    {0x006E, 0x032D}: 0x1E4B, {0x00D5, 0x0301}: 0x1E4C, {0x00F5, 0x0301}: 0x1E4D,
+    {0x00D5, 0x0308}: 0x1E4E, {0x00F5, 0x0308}: 0x1E4F, {0x014C, 0x0300}: 0x1E50,
+    {0x014D, 0x0300}: 0x1E51, {0x014C, 0x0301}: 0x1E52, {0x014D, 0x0301}: 0x1E53,
+    {0x0050, 0x0301}: 0x1E54, {0x0070, 0x0301}: 0x1E55, {0x0050, 0x0307}: 0x1E56,
+    {0x0070, 0x0307}: 0x1E57, {0x0052, 0x0307}: 0x1E58, {0x0072, 0x0307}: 0x1E59,
+    {0x0052, 0x0323}: 0x1E5A, {0x0072, 0x0323}: 0x1E5B, {0x1E5A, 0x0304}: 0x1E5C,
+    {0x1E5B, 0x0304}: 0x1E5D, {0x0052, 0x0331}: 0x1E5E, {0x0072, 0x0331}: 0x1E5F,
+    {0x0053, 0x0307}: 0x1E60, {0x0073, 0x0307}: 0x1E61, {0x0053, 0x0323}: 0x1E62,
+    {0x0073, 0x0323}: 0x1E63, {0x015A, 0x0307}: 0x1E64, {0x015B, 0x0307}: 0x1E65,
+    {0x0160, 0x0307}: 0x1E66, {0x0161, 0x0307}: 0x1E67, {0x1E62, 0x0307}: 0x1E68,
+    {0x1E63, 0x0307}: 0x1E69, {0x0054, 0x0307}: 0x1E6A, {0x0074, 0x0307}: 0x1E6B,
+    {0x0054, 0x0323}: 0x1E6C, {0x0074, 0x0323}: 0x1E6D, {0x0054, 0x0331}: 0x1E6E,
+    {0x0074, 0x0331}: 0x1E6F, {0x0054, 0x032D}: 0x1E70, {0x0074, 0x032D}: 0x1E71,
+    {0x0055, 0x0324}: 0x1E72, {0x0075, 0x0324}: 0x1E73, {0x0055, 0x0330}: 0x1E74,
+    {0x0075, 0x0330}: 0x1E75, {0x0055, 0x032D}: 0x1E76, {0x0075, 0x032D}: 0x1E77,
+    {0x0168, 0x0301}: 0x1E78, {0x0169, 0x0301}: 0x1E79, {0x016A, 0x0308}: 0x1E7A,
+    {0x016B, 0x0308}: 0x1E7B, {0x0056, 0x0303}: 0x1E7C, {0x0076, 0x0303}: 0x1E7D,
+    {0x0056, 0x0323}: 0x1E7E, {0x0076, 0x0323}: 0x1E7F, {0x0057, 0x0300}: 0x1E80,
+    {0x0077, 0x0300}: 0x1E81, {0x0057, 0x0301}: 0x1E82, {0x0077, 0x0301}: 0x1E83,
+    {0x0057, 0x0308}: 0x1E84, {0x0077, 0x0308}: 0x1E85, {0x0057, 0x0307}: 0x1E86,
+    {0x0077, 0x0307}: 0x1E87, {0x0057, 0x0323}: 0x1E88, {0x0077, 0x0323}: 0x1E89,
+    {0x0058, 0x0307}: 0x1E8A, {0x0078, 0x0307}: 0x1E8B, {0x0058, 0x0308}: 0x1E8C,
+    {0x0078, 0x0308}: 0x1E8D, {0x0059, 0x0307}: 0x1E8E, {0x0079, 0x0307}: 0x1E8F,
+    {0x005A, 0x0302}: 0x1E90, {0x007A, 0x0302}: 0x1E91, {0x005A, 0x0323}: 0x1E92,
+    {0x007A, 0x0323}: 0x1E93, {0x005A, 0x0331}: 0x1E94, {0x007A, 0x0331}: 0x1E95,
+    {0x0068, 0x0331}: 0x1E96, {0x0074, 0x0308}: 0x1E97, {0x0077, 0x030A}: 0x1E98,
+    {0x0079, 0x030A}: 0x1E99, {0x017F, 0x0307}: 0x1E9B, {0x0041, 0x0323}: 0x1EA0,
+    {0x0061, 0x0323}: 0x1EA1, {0x0041, 0x0309}: 0x1EA2, {0x0061, 0x0309}: 0x1EA3,
+    {0x00C2, 0x0301}: 0x1EA4, {0x00E2, 0x0301}: 0x1EA5, {0x00C2, 0x0300}: 0x1EA6,
+    {0x00E2, 0x0300}: 0x1EA7, {0x00C2, 0x0309}: 0x1EA8, {0x00E2, 0x0309}: 0x1EA9,
+    {0x00C2, 0x0303}: 0x1EAA, {0x00E2, 0x0303}: 0x1EAB, {0x1EA0, 0x0302}: 0x1EAC,
+    {0x1EA1, 0x0302}: 0x1EAD, {0x0102, 0x0301}: 0x1EAE, {0x0103, 0x0301}: 0x1EAF,
+    {0x0102, 0x0300}: 0x1EB0, {0x0103, 0x0300}: 0x1EB1, {0x0102, 0x0309}: 0x1EB2,
+    {0x0103, 0x0309}: 0x1EB3, {0x0102, 0x0303}: 0x1EB4, {0x0103, 0x0303}: 0x1EB5,
+    {0x1EA0, 0x0306}: 0x1EB6, {0x1EA1, 0x0306}: 0x1EB7, {0x0045, 0x0323}: 0x1EB8,
+    {0x0065, 0x0323}: 0x1EB9, {0x0045, 0x0309}: 0x1EBA, {0x0065, 0x0309}: 0x1EBB,
+    {0x0045, 0x0303}: 0x1EBC, {0x0065, 0x0303}: 0x1EBD, {0x00CA, 0x0301}: 0x1EBE,
+    {0x00EA, 0x0301}: 0x1EBF, {0x00CA, 0x0300}: 0x1EC0, {0x00EA, 0x0300}: 0x1EC1,
+    {0x00CA, 0x0309}: 0x1EC2, {0x00EA, 0x0309}: 0x1EC3, {0x00CA, 0x0303}: 0x1EC4,
+    {0x00EA, 0x0303}: 0x1EC5, {0x1EB8, 0x0302}: 0x1EC6, {0x1EB9, 0x0302}: 0x1EC7,
+    {0x0049, 0x0309}: 0x1EC8, {0x0069, 0x0309}: 0x1EC9, {0x0049, 0x0323}: 0x1ECA,
+    {0x0069, 0x0323}: 0x1ECB, {0x004F, 0x0323}: 0x1ECC, {0x006F, 0x0323}: 0x1ECD,
+    {0x004F, 0x0309}: 0x1ECE, {0x006F, 0x0309}: 0x1ECF, {0x00D4, 0x0301}: 0x1ED0,
+    {0x00F4, 0x0301}: 0x1ED1, {0x00D4, 0x0300}: 0x1ED2, {0x00F4, 0x0300}: 0x1ED3,
+    {0x00D4, 0x0309}: 0x1ED4, {0x00F4, 0x0309}: 0x1ED5, {0x00D4, 0x0303}: 0x1ED6,
+    {0x00F4, 0x0303}: 0x1ED7, {0x1ECC, 0x0302}: 0x1ED8, {0x1ECD, 0x0302}: 0x1ED9,
+    {0x01A0, 0x0301}: 0x1EDA, {0x01A1, 0x0301}: 0x1EDB, {0x01A0, 0x0300}: 0x1EDC,
+    {0x01A1, 0x0300}: 0x1EDD, {0x01A0, 0x0309}: 0x1EDE, {0x01A1, 0x0309}: 0x1EDF,
+    {0x01A0, 0x0303}: 0x1EE0, {0x01A1, 0x0303}: 0x1EE1, {0x01A0, 0x0323}: 0x1EE2,
+    {0x01A1, 0x0323}: 0x1EE3, {0x0055, 0x0323}: 0x1EE4, {0x0075, 0x0323}: 0x1EE5,
+    {0x0055, 0x0309}: 0x1EE6, {0x0075, 0x0309}: 0x1EE7, {0x01AF, 0x0301}: 0x1EE8,
+    {0x01B0, 0x0301}: 0x1EE9, {0x01AF, 0x0300}: 0x1EEA, {0x01B0, 0x0300}: 0x1EEB,
+    {0x01AF, 0x0309}: 0x1EEC, {0x01B0, 0x0309}: 0x1EED, {0x01AF, 0x0303}: 0x1EEE,
+    {0x01B0, 0x0303}: 0x1EEF, {0x01AF, 0x0323}: 0x1EF0, {0x01B0, 0x0323}: 0x1EF1,
+    {0x0059, 0x0300}: 0x1EF2, {0x0079, 0x0300}: 0x1EF3, {0x0059, 0x0323}: 0x1EF4,
+    {0x0079, 0x0323}: 0x1EF5, {0x0059, 0x0309}: 0x1EF6, {0x0079, 0x0309}: 0x1EF7,
+    {0x0059, 0x0303}: 0x1EF8, {0x0079, 0x0303}: 0x1EF9, {0x03B1, 0x0313}: 0x1F00,
+    {0x03B1, 0x0314}: 0x1F01, {0x1F00, 0x0300}: 0x1F02, {0x1F01, 0x0300}: 0x1F03,
+    {0x1F00, 0x0301}: 0x1F04, {0x1F01, 0x0301}: 0x1F05, {0x1F00, 0x0342}: 0x1F06,
+    {0x1F01, 0x0342}: 0x1F07, {0x0391, 0x0313}: 0x1F08, {0x0391, 0x0314}: 0x1F09,
+    {0x1F08, 0x0300}: 0x1F0A, {0x1F09, 0x0300}: 0x1F0B, {0x1F08, 0x0301}: 0x1F0C,
+    {0x1F09, 0x0301}: 0x1F0D, {0x1F08, 0x0342}: 0x1F0E, {0x1F09, 0x0342}: 0x1F0F,
+    {0x03B5, 0x0313}: 0x1F10, {0x03B5, 0x0314}: 0x1F11, {0x1F10, 0x0300}: 0x1F12,
+    {0x1F11, 0x0300}: 0x1F13, {0x1F10, 0x0301}: 0x1F14, {0x1F11, 0x0301}: 0x1F15,
+    {0x0395, 0x0313}: 0x1F18, {0x0395, 0x0314}: 0x1F19, {0x1F18, 0x0300}: 0x1F1A,
+    {0x1F19, 0x0300}: 0x1F1B, {0x1F18, 0x0301}: 0x1F1C, {0x1F19, 0x0301}: 0x1F1D,
+    {0x03B7, 0x0313}: 0x1F20, {0x03B7, 0x0314}: 0x1F21, {0x1F20, 0x0300}: 0x1F22,
+    {0x1F21, 0x0300}: 0x1F23, {0x1F20, 0x0301}: 0x1F24, {0x1F21, 0x0301}: 0x1F25,
+    {0x1F20, 0x0342}: 0x1F26, {0x1F21, 0x0342}: 0x1F27, {0x0397, 0x0313}: 0x1F28,
+    {0x0397, 0x0314}: 0x1F29, {0x1F28, 0x0300}: 0x1F2A, {0x1F29, 0x0300}: 0x1F2B,
+    {0x1F28, 0x0301}: 0x1F2C, {0x1F29, 0x0301}: 0x1F2D, {0x1F28, 0x0342}: 0x1F2E,
+    {0x1F29, 0x0342}: 0x1F2F, {0x03B9, 0x0313}: 0x1F30, {0x03B9, 0x0314}: 0x1F31,
+    {0x1F30, 0x0300}: 0x1F32, {0x1F31, 0x0300}: 0x1F33, {0x1F30, 0x0301}: 0x1F34,
+    {0x1F31, 0x0301}: 0x1F35, {0x1F30, 0x0342}: 0x1F36, {0x1F31, 0x0342}: 0x1F37,
+    {0x0399, 0x0313}: 0x1F38, {0x0399, 0x0314}: 0x1F39, {0x1F38, 0x0300}: 0x1F3A,
+    {0x1F39, 0x0300}: 0x1F3B, {0x1F38, 0x0301}: 0x1F3C, {0x1F39, 0x0301}: 0x1F3D,
+    {0x1F38, 0x0342}: 0x1F3E, {0x1F39, 0x0342}: 0x1F3F, {0x03BF, 0x0313}: 0x1F40,
+    {0x03BF, 0x0314}: 0x1F41, {0x1F40, 0x0300}: 0x1F42, {0x1F41, 0x0300}: 0x1F43,
+    {0x1F40, 0x0301}: 0x1F44, {0x1F41, 0x0301}: 0x1F45, {0x039F, 0x0313}: 0x1F48,
+    {0x039F, 0x0314}: 0x1F49, {0x1F48, 0x0300}: 0x1F4A, {0x1F49, 0x0300}: 0x1F4B,
+    {0x1F48, 0x0301}: 0x1F4C, {0x1F49, 0x0301}: 0x1F4D, {0x03C5, 0x0313}: 0x1F50,
+    {0x03C5, 0x0314}: 0x1F51, {0x1F50, 0x0300}: 0x1F52, {0x1F51, 0x0300}: 0x1F53,
+    {0x1F50, 0x0301}: 0x1F54, {0x1F51, 0x0301}: 0x1F55, {0x1F50, 0x0342}: 0x1F56,
+    {0x1F51, 0x0342}: 0x1F57, {0x03A5, 0x0314}: 0x1F59, {0x1F59, 0x0300}: 0x1F5B,
+    {0x1F59, 0x0301}: 0x1F5D, {0x1F59, 0x0342}: 0x1F5F, {0x03C9, 0x0313}: 0x1F60,
+    {0x03C9, 0x0314}: 0x1F61, {0x1F60, 0x0300}: 0x1F62, {0x1F61, 0x0300}: 0x1F63,
+    {0x1F60, 0x0301}: 0x1F64, {0x1F61, 0x0301}: 0x1F65, {0x1F60, 0x0342}: 0x1F66,
+    {0x1F61, 0x0342}: 0x1F67, {0x03A9, 0x0313}: 0x1F68, {0x03A9, 0x0314}: 0x1F69,
+    {0x1F68, 0x0300}: 0x1F6A, {0x1F69, 0x0300}: 0x1F6B, {0x1F68, 0x0301}: 0x1F6C,
+    {0x1F69, 0x0301}: 0x1F6D, {0x1F68, 0x0342}: 0x1F6E, {0x1F69, 0x0342}: 0x1F6F,
+    {0x03B1, 0x0300}: 0x1F70, {0x03B5, 0x0300}: 0x1F72, {0x03B7, 0x0300}: 0x1F74,
+    {0x03B9, 0x0300}: 0x1F76, {0x03BF, 0x0300}: 0x1F78, {0x03C5, 0x0300}: 0x1F7A,
+    {0x03C9, 0x0300}: 0x1F7C, {0x1F00, 0x0345}: 0x1F80, {0x1F01, 0x0345}: 0x1F81,
+    {0x1F02, 0x0345}: 0x1F82, {0x1F03, 0x0345}: 0x1F83, {0x1F04, 0x0345}: 0x1F84,
+    {0x1F05, 0x0345}: 0x1F85, {0x1F06, 0x0345}: 0x1F86, {0x1F07, 0x0345}: 0x1F87,
+    {0x1F08, 0x0345}: 0x1F88, {0x1F09, 0x0345}: 0x1F89, {0x1F0A, 0x0345}: 0x1F8A,
+    {0x1F0B, 0x0345}: 0x1F8B, {0x1F0C, 0x0345}: 0x1F8C, {0x1F0D, 0x0345}: 0x1F8D,
+    {0x1F0E, 0x0345}: 0x1F8E, {0x1F0F, 0x0345}: 0x1F8F, {0x1F20, 0x0345}: 0x1F90,
+    {0x1F21, 0x0345}: 0x1F91, {0x1F22, 0x0345}: 0x1F92, {0x1F23, 0x0345}: 0x1F93,
+    {0x1F24, 0x0345}: 0x1F94, {0x1F25, 0x0345}: 0x1F95, {0x1F26, 0x0345}: 0x1F96,
+    {0x1F27, 0x0345}: 0x1F97, {0x1F28, 0x0345}: 0x1F98, {0x1F29, 0x0345}: 0x1F99,
+    {0x1F2A, 0x0345}: 0x1F9A, {0x1F2B, 0x0345}: 0x1F9B, {0x1F2C, 0x0345}: 0x1F9C,
+    {0x1F2D, 0x0345}: 0x1F9D, {0x1F2E, 0x0345}: 0x1F9E, {0x1F2F, 0x0345}: 0x1F9F,
+    {0x1F60, 0x0345}: 0x1FA0, {0x1F61, 0x0345}: 0x1FA1, {0x1F62, 0x0345}: 0x1FA2,
+    {0x1F63, 0x0345}: 0x1FA3, {0x1F64, 0x0345}: 0x1FA4, {0x1F65, 0x0345}: 0x1FA5,
+    {0x1F66, 0x0345}: 0x1FA6, {0x1F67, 0x0345}: 0x1FA7, {0x1F68, 0x0345}: 0x1FA8,
+    {0x1F69, 0x0345}: 0x1FA9, {0x1F6A, 0x0345}: 0x1FAA, {0x1F6B, 0x0345}: 0x1FAB,
+    {0x1F6C, 0x0345}: 0x1FAC, {0x1F6D, 0x0345}: 0x1FAD, {0x1F6E, 0x0345}: 0x1FAE,
+    {0x1F6F, 0x0345}: 0x1FAF, {0x03B1, 0x0306}: 0x1FB0, {0x03B1, 0x0304}: 0x1FB1,
+    {0x1F70, 0x0345}: 0x1FB2, {0x03B1, 0x0345}: 0x1FB3, {0x03AC, 0x0345}: 0x1FB4,
+    {0x03B1, 0x0342}: 0x1FB6, {0x1FB6, 0x0345}: 0x1FB7, {0x0391, 0x0306}: 0x1FB8,
+    {0x0391, 0x0304}: 0x1FB9, {0x0391, 0x0300}: 0x1FBA, {0x0391, 0x0345}: 0x1FBC,
+    {0x00A8, 0x0342}: 0x1FC1, {0x1F74, 0x0345}: 0x1FC2, {0x03B7, 0x0345}: 0x1FC3,
+    {0x03AE, 0x0345}: 0x1FC4, {0x03B7, 0x0342}: 0x1FC6, {0x1FC6, 0x0345}: 0x1FC7,
+    {0x0395, 0x0300}: 0x1FC8, {0x0397, 0x0300}: 0x1FCA, {0x0397, 0x0345}: 0x1FCC,
+    {0x1FBF, 0x0300}: 0x1FCD, {0x1FBF, 0x0301}: 0x1FCE, {0x1FBF, 0x0342}: 0x1FCF,
+    {0x03B9, 0x0306}: 0x1FD0, {0x03B9, 0x0304}: 0x1FD1, {0x03CA, 0x0300}: 0x1FD2,
+    {0x03B9, 0x0342}: 0x1FD6, {0x03CA, 0x0342}: 0x1FD7, {0x0399, 0x0306}: 0x1FD8,
+    {0x0399, 0x0304}: 0x1FD9, {0x0399, 0x0300}: 0x1FDA, {0x1FFE, 0x0300}: 0x1FDD,
+    {0x1FFE, 0x0301}: 0x1FDE, {0x1FFE, 0x0342}: 0x1FDF, {0x03C5, 0x0306}: 0x1FE0,
+    {0x03C5, 0x0304}: 0x1FE1, {0x03CB, 0x0300}: 0x1FE2, {0x03C1, 0x0313}: 0x1FE4,
+    {0x03C1, 0x0314}: 0x1FE5, {0x03C5, 0x0342}: 0x1FE6, {0x03CB, 0x0342}: 0x1FE7,
+    {0x03A5, 0x0306}: 0x1FE8, {0x03A5, 0x0304}: 0x1FE9, {0x03A5, 0x0300}: 0x1FEA,
+    {0x03A1, 0x0314}: 0x1FEC, {0x00A8, 0x0300}: 0x1FED, {0x1F7C, 0x0345}: 0x1FF2,
+    {0x03C9, 0x0345}: 0x1FF3, {0x03CE, 0x0345}: 0x1FF4, {0x03C9, 0x0342}: 0x1FF6,
+    {0x1FF6, 0x0345}: 0x1FF7, {0x039F, 0x0300}: 0x1FF8, {0x03A9, 0x0300}: 0x1FFA,
+    {0x03A9, 0x0345}: 0x1FFC, {0x2190, 0x0338}: 0x219A, {0x2192, 0x0338}: 0x219B,
+    {0x2194, 0x0338}: 0x21AE, {0x21D0, 0x0338}: 0x21CD, {0x21D4, 0x0338}: 0x21CE,
+    {0x21D2, 0x0338}: 0x21CF, {0x2203, 0x0338}: 0x2204, {0x2208, 0x0338}: 0x2209,
+    {0x220B, 0x0338}: 0x220C, {0x2223, 0x0338}: 0x2224, {0x2225, 0x0338}: 0x2226,
+    {0x223C, 0x0338}: 0x2241, {0x2243, 0x0338}: 0x2244, {0x2245, 0x0338}: 0x2247,
+    {0x2248, 0x0338}: 0x2249, {0x003D, 0x0338}: 0x2260, {0x2261, 0x0338}: 0x2262,
+    {0x224D, 0x0338}: 0x226D, {0x003C, 0x0338}: 0x226E, {0x003E, 0x0338}: 0x226F,
+    {0x2264, 0x0338}: 0x2270, {0x2265, 0x0338}: 0x2271, {0x2272, 0x0338}: 0x2274,
+    {0x2273, 0x0338}: 0x2275, {0x2276, 0x0338}: 0x2278, {0x2277, 0x0338}: 0x2279,
+    {0x227A, 0x0338}: 0x2280, {0x227B, 0x0338}: 0x2281, {0x2282, 0x0338}: 0x2284,
+    {0x2283, 0x0338}: 0x2285, {0x2286, 0x0338}: 0x2288, {0x2287, 0x0338}: 0x2289,
+    {0x22A2, 0x0338}: 0x22AC, {0x22A8, 0x0338}: 0x22AD, {0x22A9, 0x0338}: 0x22AE,
+    {0x22AB, 0x0338}: 0x22AF, {0x227C, 0x0338}: 0x22E0, {0x227D, 0x0338}: 0x22E1,
+    {0x2291, 0x0338}: 0x22E2, {0x2292, 0x0338}: 0x22E3, {0x22B2, 0x0338}: 0x22EA,
+    {0x22B3, 0x0338}: 0x22EB, {0x22B4, 0x0338}: 0x22EC, {0x22B5, 0x0338}: 0x22ED,
+    {0x304B, 0x3099}: 0x304C, {0x304D, 0x3099}: 0x304E, {0x304F, 0x3099}: 0x3050,
+    {0x3051, 0x3099}: 0x3052, {0x3053, 0x3099}: 0x3054, {0x3055, 0x3099}: 0x3056,
+    {0x3057, 0x3099}: 0x3058, {0x3059, 0x3099}: 0x305A, {0x305B, 0x3099}: 0x305C,
+    {0x305D, 0x3099}: 0x305E, {0x305F, 0x3099}: 0x3060, {0x3061, 0x3099}: 0x3062,
+    {0x3064, 0x3099}: 0x3065, {0x3066, 0x3099}: 0x3067, {0x3068, 0x3099}: 0x3069,
+    {0x306F, 0x3099}: 0x3070, {0x306F, 0x309A}: 0x3071, {0x3072, 0x3099}: 0x3073,
+    {0x3072, 0x309A}: 0x3074, {0x3075, 0x3099}: 0x3076, {0x3075, 0x309A}: 0x3077,
+    {0x3078, 0x3099}: 0x3079, {0x3078, 0x309A}: 0x307A, {0x307B, 0x3099}: 0x307C,
+    {0x307B, 0x309A}: 0x307D, {0x3046, 0x3099}: 0x3094, {0x309D, 0x3099}: 0x309E,
+    {0x30AB, 0x3099}: 0x30AC, {0x30AD, 0x3099}: 0x30AE, {0x30AF, 0x3099}: 0x30B0,
+    {0x30B1, 0x3099}: 0x30B2, {0x30B3, 0x3099}: 0x30B4, {0x30B5, 0x3099}: 0x30B6,
+    {0x30B7, 0x3099}: 0x30B8, {0x30B9, 0x3099}: 0x30BA, {0x30BB, 0x3099}: 0x30BC,
+    {0x30BD, 0x3099}: 0x30BE, {0x30BF, 0x3099}: 0x30C0, {0x30C1, 0x3099}: 0x30C2,
+    {0x30C4, 0x3099}: 0x30C5, {0x30C6, 0x3099}: 0x30C7, {0x30C8, 0x3099}: 0x30C9,
+    {0x30CF, 0x3099}: 0x30D0, {0x30CF, 0x309A}: 0x30D1, {0x30D2, 0x3099}: 0x30D3,
+    {0x30D2, 0x309A}: 0x30D4, {0x30D5, 0x3099}: 0x30D6, {0x30D5, 0x309A}: 0x30D7,
+    {0x30D8, 0x3099}: 0x30D9, {0x30D8, 0x309A}: 0x30DA, {0x30DB, 0x3099}: 0x30DC,
+    {0x30DB, 0x309A}: 0x30DD, {0x30A6, 0x3099}: 0x30F4, {0x30EF, 0x3099}: 0x30F7,
+    {0x30F0, 0x3099}: 0x30F8, {0x30F1, 0x3099}: 0x30F9, {0x30F2, 0x3099}: 0x30FA,
+    {0x30FD, 0x3099}: 0x30FE, {0x11099, 0x110BA}: 0x1109A, {0x1109B, 0x110BA}: 0x1109C,
+    {0x110A5, 0x110BA}: 0x110AB, {0x11131, 0x11127}: 0x1112E, {0x11132, 0x11127}: 0x1112F,
+    {0x11347, 0x1133E}: 0x1134B, {0x11347, 0x11357}: 0x1134C, {0x114B9, 0x114BA}: 0x114BB,
+    {0x114B9, 0x114B0}: 0x114BC, {0x114B9, 0x114BD}: 0x114BE, {0x115B8, 0x115AF}: 0x115BA,
+    {0x115B9, 0x115AF}: 0x115BB, {0x11935, 0x11930}: 0x11938,
+}
@@ -0,0 +1,256 @@
+// -------------------------------------------------------
+// backend/handlers/filename_policy.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Filename policy layer applied to save, move, and create-folder.
+//   - Normalizes names to NFC and rejects names that are unsafe or
+//     unportable (control characters, Windows-reserved names and
+//     characters, trailing dots/spaces, hidden names, excess length).
+// Audit:
+//   - Validation errors name the offending component and reason so
+//     clients can show them verbatim.
+//   - Lookups use the same NFC normalization (see sanitizePath), so a
+//     name typed in NFD still resolves to the stored NFC file.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+const (
+    maxNameBytes = 255
+    maxPathBytes = 1024
+)
+
+// windowsReservedChars cannot appear in names on Windows/SMB shares.
+const windowsReservedChars = `<>:"\|?*`
+
+// windowsReservedNames are device names, reserved with or without extension.
+var windowsReservedNames = map[string]bool{
+    "CON": true, "PRN": true, "AUX": true, "NUL": true,
+    "COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+    "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+    "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+    "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// -------------------------------------------------------
+// type NameError
+// -------------------------------------------------------
+// Purpose:
+//   - Describes why a path failed the filename policy.
+// Audit:
+//   - Error() text is safe to return to clients.
+// -------------------------------------------------------
+type NameError struct {
+    Name   string
+    Reason string
+}
+
+func (e *NameError) Error() string {
+    if e.Name == "" {
+        return e.Reason
+    }
+    return fmt.Sprintf("name %q %s", e.Name, e.Reason)
+}
+
+// Hangul syllable constants (Unicode 3.12, conjoining jamo).
+const (
+    hangulSBase  = 0xAC00
+    hangulLBase  = 0x1100
+    hangulVBase  = 0x1161
+    hangulTBase  = 0x11A7
+    hangulLCount = 19
+    hangulVCount = 21
+    hangulTCount = 28
+    hangulNCount = hangulVCount * hangulTCount
+    hangulSCount = hangulLCount * hangulNCount
+)
+
+// -------------------------------------------------------
+// func normalizeNFC(s string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Unicode Normalization Form C: canonical decomposition,
+//     canonical ordering of combining marks, then canonical
+//     composition (UAX #15).
+// Audit:
+//   - Tables are generated from the Unicode Character Database
+//     (filename_nfc_table.go); Hangul is handled algorithmically.
+//   - ASCII is returned unchanged without allocating.
+// -------------------------------------------------------
+func normalizeNFC(s string) string {
+    ascii := true
+    for i := 0; i < len(s) && ascii; i++ {
+        ascii = s[i] < utf8.RuneSelf
+    }
+    if ascii {
+        return s
+    }
+    return string(nfcCompose(nfcDecompose(s)))
+}
+
+// -------------------------------------------------------
+// func nfcDecompose(s string) []rune
+// -------------------------------------------------------
+// Purpose:
+//   - Full canonical decomposition of s in canonical order: each
+//     run of combining marks is stably sorted by combining class.
+// -------------------------------------------------------
+func nfcDecompose(s string) []rune {
+    out := make([]rune, 0, len(s))
+    for _, r := range s {
+        if index := r - hangulSBase; index >= 0 && index < hangulSCount {
+            out = append(out, hangulLBase+index/hangulNCount, hangulVBase+index%hangulNCount/hangulTCount)
+            if t := index % hangulTCount; t != 0 {
+                out = append(out, hangulTBase+t)
+            }
+            continue
+        }
+        if d, ok := nfcDecompositions[r]; ok {
+            out = append(out, []rune(d)...)
+            continue
+        }
+        out = append(out, r)
+    }
+    for i := 1; i < len(out); i++ {
+        class := nfcCombiningClass[out[i]]
+        if class == 0 {
+            continue
+        }
+        for j := i; j > 0 && nfcCombiningClass[out[j-1]] > class; j-- {
+            out[j-1], out[j] = out[j], out[j-1]
+        }
+    }
+    return out
+}
+
+// -------------------------------------------------------
+// func nfcCompose(runes []rune) []rune
+// -------------------------------------------------------
+// Purpose:
+//   - Canonical composition of a decomposed, ordered sequence, in
+//     place.
+// Audit:
+//   - A rune combines with the last starter unless something in
+//     between blocks it: a rune of the same or higher combining
+//     class, or any rune at all when both are starters.
+// -------------------------------------------------------
+func nfcCompose(runes []rune) []rune {
+    out := runes[:0]
+    starter := -1
+    var last uint8
+    for _, r := range runes {
+        class := nfcCombiningClass[r]
+        if starter >= 0 && (starter == len(out)-1 || last != 0 && last < class) {
+            if composed, ok := composePair(out[starter], r); ok {
+                out[starter] = composed
+                continue
+            }
+        }
+        if class == 0 {
+            starter = len(out)
+        }
+        last = class
+        out = append(out, r)
+    }
+    return out
+}
+
+// composePair is the primary composite of a and b, if any.
+func composePair(a, b rune) (rune, bool) {
+    if l, v := a-hangulLBase, b-hangulVBase; l >= 0 && l < hangulLCount && v >= 0 && v < hangulVCount {
+        return hangulSBase + (l*hangulVCount+v)*hangulTCount, true
+    }
+    if s, t := a-hangulSBase, b-hangulTBase; s >= 0 && s < hangulSCount && s%hangulTCount == 0 && t > 0 && t < hangulTCount {
+        return a + t, true
+    }
+    composed, ok := nfcCompositions[[2]rune{a, b}]
+    return composed, ok
+}
+
+// -------------------------------------------------------
+// func validateName(name string) error
+// -------------------------------------------------------
+// Purpose:
+//   - Check a single (already normalized) path component.
+// Audit:
+//   - Returns *NameError describing the first violation found.
+// -------------------------------------------------------
+func validateName(name string) error {
+    if name == "" || name == "." || name == ".." {
+        return &NameError{Name: name, Reason: "is not a valid name"}
+    }
+    if len(name) > maxNameBytes {
+        return &NameError{Name: name, Reason: fmt.Sprintf("exceeds %d bytes", maxNameBytes)}
+    }
+    if strings.HasPrefix(name, ".") {
+        return &NameError{Name: name, Reason: "must not start with '.' (reserved for system data)"}
+    }
+    if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+        return &NameError{Name: name, Reason: "must not end with a dot or space"}
+    }
+    if strings.HasPrefix(name, " ") {
+        return &NameError{Name: name, Reason: "must not start with a space"}
+    }
+    for _, r := range name {
+        if r == utf8.RuneError {
+            return &NameError{Name: name, Reason: "contains invalid UTF-8"}
+        }
+        if unicode.IsControl(r) {
+            return &NameError{Name: name, Reason: fmt.Sprintf("contains control character U+%04X", r)}
+        }
+        if strings.ContainsRune(windowsReservedChars, r) {
+            return &NameError{Name: name, Reason: fmt.Sprintf("contains reserved character %q", r)}
+        }
+    }
+
+    stem := strings.ToUpper(name)
+    if dot := strings.IndexByte(stem, '.'); dot >= 0 {
+        stem = stem[:dot]
+    }
+    if windowsReservedNames[stem] {
+        return &NameError{Name: name, Reason: "is a reserved device name"}
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func applyNamePolicy(path string) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Normalize a relative path to NFC and validate each component.
+// Audit:
+//   - Returns the normalized path that must be used for the write,
+//     so stored names are always NFC.
+//   - Empty components (leading, trailing, or doubled '/') are ignored.
+// -------------------------------------------------------
+func applyNamePolicy(path string) (string, error) {
+    if !utf8.ValidString(path) {
+        return "", &NameError{Reason: "path contains invalid UTF-8"}
+    }
+    normalized := normalizeNFC(path)
+    if len(normalized) > maxPathBytes {
+        return "", &NameError{Reason: fmt.Sprintf("path exceeds %d bytes", maxPathBytes)}
+    }
+
+    parts := []string{}
+    for _, part := range strings.Split(normalized, "/") {
+        if part == "" {
+            continue
+        }
+        if err := validateName(part); err != nil {
+            return "", err
+        }
+        parts = append(parts, part)
+    }
+    if len(parts) == 0 {
+        return "", &NameError{Reason: "path is empty"}
+    }
+    return strings.Join(parts, "/"), nil
+}
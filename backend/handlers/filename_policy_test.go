@@ -0,0 +1,72 @@
+// -------------------------------------------------------
+// backend/handlers/filename_policy_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests for NFC normalization of names and the filename policy.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "testing"
+)
+
+func TestNormalizeNFC(t *testing.T) {
+    for _, tc := range []struct {
+        name, in, want string
+    }{
+        {"ascii unchanged", "Q3 budget.md", "Q3 budget.md"},
+        {"latin acute", "Cafe\u0301.md", "Caf\u00e9.md"},
+        {"already composed", "Caf\u00e9.md", "Caf\u00e9.md"},
+        {"cyrillic short i", "\u0438\u0306", "\u0439"},
+        {"greek alpha tonos", "\u03b1\u0301", "\u03ac"},
+        {"greek oxia maps to tonos", "\u1f71", "\u03ac"},
+        {"angstrom sign singleton", "\u212b", "\u00c5"},
+        {"ohm sign singleton", "\u2126", "\u03a9"},
+        {"marks reordered", "a\u0302\u0323", "\u1ead"},
+        {"marks in canonical order", "a\u0323\u0302", "\u1ead"},
+        {"vietnamese stacked", "e\u0302\u0301", "\u1ebf"},
+        {"precomposed plus mark", "\u00c7\u0301", "\u1e08"},
+        {"blocked by same class", "a\u0301\u0301", "\u00e1\u0301"},
+        {"unblocked after lower class", "a\u0328\u0301", "\u0105\u0301"},
+        {"exclusion stays decomposed", "\u0915\u093c", "\u0915\u093c"},
+        {"exclusion decomposed", "\u0958", "\u0915\u093c"},
+        {"non-starter decomposition", "\u0344", "\u0308\u0301"},
+        {"hangul lv", "\u1100\u1161", "\uac00"},
+        {"hangul lvt", "\u1100\u1161\u11a8", "\uac01"},
+        {"hangul lv plus t", "\uac00\u11a8", "\uac01"},
+        {"hangul syllable unchanged", "\ud55c\uae00", "\ud55c\uae00"},
+        {"starter pair", "\u0b47\u0b3e", "\u0b4b"},
+        {"kana voiced mark", "\u304b\u3099", "\u304c"},
+        {"leading mark", "\u0301a", "\u0301a"},
+        {"mark on non-combining base", "x\u0301", "x\u0301"},
+    } {
+        if got := normalizeNFC(tc.in); got != tc.want {
+            t.Errorf("%s: normalizeNFC(%+q) = %+q, want %+q", tc.name, tc.in, got, tc.want)
+        }
+    }
+}
+
+func TestApplyNamePolicy(t *testing.T) {
+    for _, tc := range []struct {
+        in, want string
+        ok       bool
+    }{
+        {"Deal/memo.md", "Deal/memo.md", true},
+        {"Cre\u0300me/cre\u0300me.md", "Cr\u00e8me/cr\u00e8me.md", true},
+        {"\u0418\u0306\u043e\u0433\u0443\u0440\u0442.md", "\u0419\u043e\u0433\u0443\u0440\u0442.md", true},
+        {"Deal/CON.md", "", false},
+        {"Deal/a:b.md", "", false},
+        {"Deal/trailing. ", "", false},
+        {"Deal/.hidden.md", "", false},
+        {"Deal/\x01.md", "", false},
+    } {
+        got, err := applyNamePolicy(tc.in)
+        if tc.ok && (err != nil || got != tc.want) {
+            t.Errorf("applyNamePolicy(%+q) = %+q, %v; want %+q", tc.in, got, err, tc.want)
+        }
+        if !tc.ok && err == nil {
+            t.Errorf("applyNamePolicy(%+q) = %+q, want an error", tc.in, got)
+        }
+    }
+}
@@ -2,149 +2,568 @@
 // backend/handlers/files.go
 // -------------------------------------------------------
 // Purpose Summary:
-//   - Handle file list, read, write, and move for .txt files.
+//   - Handle file list, read, write, and move for .txt and .md notes.
 // Audit:
 //   - Returns JSON arrays (never null). Logs with UTC ISO 8601.
 //   - Fails fast with clear HTTP status codes.
+//   - All storage calls honour r.Context() (504 on deadline).
 // -------------------------------------------------------
 
 package handlers
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
-    "io/ioutil"
     "net/http"
     "os"
+    "strconv"
     "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// Note extensions: plain text (the default for new notes) and Markdown.
+const (
+    fileExt     = ".txt"
+    markdownExt = ".md"
 )
 
-const fileExt = ".txt"
+// isNoteName reports whether name has a note extension.
+func isNoteName(name string) bool {
+    return strings.HasSuffix(name, fileExt) || strings.HasSuffix(name, markdownExt)
+}
+
+// -------------------------------------------------------
+// type FileEntry
+// -------------------------------------------------------
+// Purpose:
+//   - One note in a detailed listing (/files?detail=1).
+// -------------------------------------------------------
+type FileEntry struct {
+    Name               string            `json:"name"`
+    Path               string            `json:"path"`
+    State              string            `json:"state"`
+    UnresolvedComments int               `json:"unresolved_comments"`
+    Position           *int              `json:"position,omitempty"`
+    Language           string            `json:"language"`
+    Attributes         map[string]string `json:"attributes,omitempty"`
+    Frontmatter        *Frontmatter      `json:"frontmatter,omitempty"`
+}
 
 // -------------------------------------------------------
 // func HandleFileList(w, r)
 // -------------------------------------------------------
 // Purpose:
-//   - List .txt files in a sanitized folder under scratchpad root.
+//   - List .txt and .md notes in a sanitized folder under scratchpad root.
+//   - ?detail=1 returns FileEntry objects (with workflow state)
+//     instead of plain names.
 // Audit:
 //   - Always JSON encodes an array ([] when empty).
 //   - Logs counts and errors with UTC ISO 8601 timestamps.
+//   - Archived folders are listed from their archive (archive.go).
+//   - ?smart=<name> lists a smart folder instead (smart_folders.go).
+//   - ?format=ndjson streams one entry per line (listing_stream.go).
+//   - Notes with a manual position come first (ordering.go).
+//   - ?raw=1 in a raw folder lists every file, not just notes
+//     (raw.go).
+//   - Answers 304 when If-None-Match names the current ETag
+//     (listing_etag.go).
+//   - ?lang= keeps only notes in that language (language.go);
+//     ?status=, ?owner=, ?tag=, ?due_before= and ?due_after= filter
+//     by frontmatter (frontmatter.go).
 // -------------------------------------------------------
 func HandleFileList(w http.ResponseWriter, r *http.Request) {
+    if _, err := languageFilter(r); err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    if _, err := frontmatterFilter(r); err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    if smart := r.URL.Query().Get("smart"); smart != "" {
+        if notModified(w, r, listingETag(r, "")) {
+            return
+        }
+        handleSmartFileList(w, r, smart)
+        return
+    }
+
     folder := r.URL.Query().Get("folder")
-    absPath := sanitizePath(folder)
+    absPath := sanitizePath(r.Context(), folder)
 
     // Always start with an initialized slice so JSON is [] not null.
     files := []string{}
 
     if absPath == "" {
-        logError("Invalid folder path requested: " + folder)
-        http.Error(w, "Invalid folder path", http.StatusBadRequest)
+        logError(r.Context(), "Invalid folder path requested: "+folder)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return
+    }
+
+    if r.URL.Query().Get("format") == formatNDJSON {
+        streamFileList(w, r, absPath)
+        return
+    }
+    if notModified(w, r, listingETag(r, absPath)) {
+        return
+    }
+
+    if record, inner, archived := archivedFolderFor(r.Context(), relativeTo(r.Context(), absPath)); archived {
+        archivedFiles, err := listArchivedFiles(r.Context(), record, inner)
+        if err != nil {
+            writeStorageError(w, r, err, "list archived folder: "+absPath, "Internal server error")
+            return
+        }
+        writeFileList(w, r, absPath, archivedFiles)
         return
     }
 
+    ctx := r.Context()
+
     // If the folder does not exist, treat as empty list.
-    if _, err := os.Stat(absPath); os.IsNotExist(err) {
-        logInfo("Folder does not exist; returning empty list: " + absPath)
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(files)
+    if _, err := statPath(ctx, absPath); os.IsNotExist(err) {
+        logInfo(ctx, "Folder does not exist; returning empty list: "+absPath)
+        writeFileList(w, r, absPath, files)
         return
     }
 
-    entries, err := ioutil.ReadDir(absPath)
+    entries, err := readDir(ctx, absPath)
     if err != nil {
-        logError("Failed to read folder: " + err.Error())
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeStorageError(w, r, err, "read folder: "+absPath, "Internal server error")
         return
     }
 
+    raw := rawRequested(r) && rawAllowed(ctx, relativeTo(ctx, absPath))
     for _, entry := range entries {
-        if !entry.IsDir() && strings.HasSuffix(entry.Name(), fileExt) {
+        if !entry.Mode().IsRegular() {
+            continue
+        }
+        if isNoteName(entry.Name()) || raw && !strings.HasPrefix(entry.Name(), ".") {
             files = append(files, entry.Name())
         }
     }
 
-    logInfo(fmt.Sprintf("Listed %d files in folder: %s", len(files), absPath))
+    logInfo(ctx, fmt.Sprintf("Listed %d files in folder: %s", len(files), absPath))
+    writeFileList(w, r, absPath, files)
+}
+
+// -------------------------------------------------------
+// func writeFileList(w, r, absFolder, names)
+// -------------------------------------------------------
+// Purpose:
+//   - Encode a listing as names, or as FileEntry objects when the
+//     request asks for ?detail=1.
+//   - Applies the ?lang= and frontmatter filters (validated by
+//     HandleFileList).
+// -------------------------------------------------------
+func writeFileList(w http.ResponseWriter, r *http.Request, absFolder string, names []string) {
+    folderRel := relativeTo(r.Context(), absFolder)
+    sortNotesByPosition(r.Context(), folderRel, names)
+
+    rels := make([]string, 0, len(names))
+    for _, name := range names {
+        rel := name
+        if folderRel != "." {
+            rel = folderRel + "/" + name
+        }
+        rels = append(rels, rel)
+    }
+    if keep := listingFilter(r); keep != nil {
+        kept := []string{}
+        keptRels := []string{}
+        for i, rel := range rels {
+            if keep(rel) {
+                kept = append(kept, names[i])
+                keptRels = append(keptRels, rel)
+            }
+        }
+        names, rels = kept, keptRels
+    }
+
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(files)
+    if r.URL.Query().Get("detail") != "1" {
+        json.NewEncoder(w).Encode(names)
+        return
+    }
+    entries := fileEntries(r.Context(), rels)
+    json.NewEncoder(w).Encode(entries)
+}
+
+// -------------------------------------------------------
+// func listingFilter(r) func(rel string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a note passes the listing's ?lang= and frontmatter
+//     filters; nil when the request has none. The filters must
+//     already be validated.
+// -------------------------------------------------------
+func listingFilter(r *http.Request) func(rel string) bool {
+    lang := r.URL.Query().Get("lang")
+    fields, _ := frontmatterFilter(r)
+    if lang == "" && !fields.active() {
+        return nil
+    }
+    languages := newLanguageLookup(r.Context())
+    frontmatter := newFrontmatterLookup(r.Context(), languages.index)
+    return func(rel string) bool {
+        if lang != "" && !languageMatches(languages.of(rel), lang) {
+            return false
+        }
+        return !fields.active() || fields.matches(frontmatter.of(rel), languages.index[rel].Tags)
+    }
 }
 
 // -------------------------------------------------------
 // func HandleFileGet(w, r)
 // -------------------------------------------------------
 // Purpose:
-//   - Returns the contents of a specific .txt file under scratchpad root.
+//   - Returns the contents of a specific note under scratchpad root.
+//   - DELETE moves the file to the trash (see trash.go).
+//   - Notes in archived folders are read from the archive.
+//   - X-Content-SHA256 carries the content hash for base_sha256 saves.
+//   - ?asOf=<RFC 3339> answers the content at that instant instead
+//     (see handleFileAsOf).
+//   - ?raw=1 serves (and PUT stores) any file of a raw folder
+//     byte for byte (see raw.go).
+//   - Plain reads pass through the configured read processors; the
+//     hash header stays that of the stored content (processors.go).
+//   - Served as text/plain with nosniff, a sandbox CSP and a
+//     Content-Disposition per the folder's content_policy
+//     (content_sniff.go).
 // Audit:
 //   - Logs path read and any read failures with UTC ISO 8601 timestamps.
+//   - Each successful read writes a "file.read" audit event with the
+//     reader, for /file/access-log.
 // -------------------------------------------------------
 func HandleFileGet(w http.ResponseWriter, r *http.Request) {
+    if r.Method == http.MethodDelete {
+        handleFileDelete(w, r)
+        return
+    }
+    if r.Method == http.MethodPut {
+        handleRawPut(w, r)
+        return
+    }
+
     file := r.URL.Query().Get("path")
-    absPath := sanitizePath(file)
+    absPath := sanitizePath(r.Context(), file)
+
+    if absPath == "" || !isFileName(r, absPath) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rawRequested(r) {
+        handleRawGet(w, r, absPath)
+        return
+    }
+
+    if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+        handleFileAsOf(w, r, absPath, asOf)
+        return
+    }
 
-    if absPath == "" || !strings.HasSuffix(absPath, fileExt) {
-        logError("Invalid file path requested: " + file)
-        http.Error(w, "Invalid file path", http.StatusBadRequest)
+    if record, inner, archived := archivedFolderFor(r.Context(), relativeTo(r.Context(), absPath)); archived {
+        content, err := readArchivedFile(r.Context(), record, inner)
+        if err == errArchivedEntryNotFound {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "read archived file: "+absPath, "Internal error")
+            return
+        }
+        served, err := processContent(r.Context(), hookRead, relativeTo(r.Context(), absPath), content)
+        if err != nil {
+            writeProcessorError(w, r, relativeTo(r.Context(), absPath), err)
+            return
+        }
+        logInfo(r.Context(), "Read archived file: "+absPath)
+        auditFileRead(r, absPath, "")
+        setUserContentHeaders(w, r, relativeTo(r.Context(), absPath), "text/plain; charset=utf-8", false)
+        w.Write(served)
         return
     }
 
-    content, err := ioutil.ReadFile(absPath)
+    content, err := readFile(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file: "+absPath, "Internal error")
+        return
+    }
+    served, err := processContent(r.Context(), hookRead, relativeTo(r.Context(), absPath), content)
     if err != nil {
-        logError("Failed to read file: " + absPath + " - " + err.Error())
-        http.Error(w, "Internal error", http.StatusInternalServerError)
+        writeProcessorError(w, r, relativeTo(r.Context(), absPath), err)
         return
     }
 
-    logInfo("Read file: " + absPath)
+    logInfo(r.Context(), "Read file: "+absPath)
+    auditFileRead(r, absPath, "")
+
+    setUserContentHeaders(w, r, relativeTo(r.Context(), absPath), "text/plain; charset=utf-8", false)
+    w.Header().Set(contentHashHeader, contentHash(content))
+    w.Write(served)
+}
+
+// auditFileRead records who opened a note (detail names the
+// revision of a time-travel read).
+func auditFileRead(r *http.Request, absPath string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.read",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   relativeTo(r.Context(), absPath),
+        Detail:   detail,
+    })
+}
 
-    w.Header().Set("Content-Type", "text/plain")
+// -------------------------------------------------------
+// func handleFileAsOf(w, r, absPath, asOf)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file?path=...&asOf=2024-03-31T23:59:59Z: the note's
+//     content as it was at asOf, from the revision store.
+//   - The revision that answered is named in X-Revision-Clock,
+//     X-Revision-At, X-Revision-Path (where the note was then) and
+//     X-Revision-Actor; X-Content-SHA256 is its hash.
+//   - The revision is sent as the read processors return it.
+// Audit:
+//   - 404 when the note did not exist at asOf, or when the revision
+//     predates the revision store and the note has changed since.
+//   - Writes "file.read" with the revision in the detail.
+// -------------------------------------------------------
+func handleFileAsOf(w http.ResponseWriter, r *http.Request, absPath string, asOf string) {
+    at, err := time.Parse(time.RFC3339, asOf)
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeInvalidField, "asOf", "Bad request: asOf must be an RFC 3339 timestamp")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+    revision, ok, err := noteAsOf(r.Context(), rel, at)
+    if err != nil {
+        writeStorageError(w, r, err, "read journal for "+rel, "Internal error")
+        return
+    }
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Note did not exist at "+at.UTC().Format(time.RFC3339))
+        return
+    }
+
+    content, kept, err := loadRevision(r.Context(), revision.SHA256)
+    if err != nil {
+        writeStorageError(w, r, err, "read revision "+revision.SHA256, "Internal error")
+        return
+    }
+    if !kept {
+        // Saved before revisions were stored: only the live note
+        // can still hold that content.
+        current, err := readFile(r.Context(), absPath)
+        if err != nil || contentHash(current) != revision.SHA256 {
+            apierror.Write(w, r, apierror.CodeNotFound, "", fmt.Sprintf("Content of revision %d was not retained", revision.Clock))
+            return
+        }
+        content = current
+    }
+    content, err = processContent(r.Context(), hookRead, rel, content)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Read file as of %s: %s (revision %d)", at.UTC().Format(time.RFC3339), absPath, revision.Clock))
+    auditFileRead(r, absPath, fmt.Sprintf("as_of=%s revision=%d", at.UTC().Format(time.RFC3339), revision.Clock))
+
+    setUserContentHeaders(w, r, rel, "text/plain; charset=utf-8", false)
+    w.Header().Set(contentHashHeader, revision.SHA256)
+    w.Header().Set("X-Revision-Clock", strconv.FormatInt(revision.Clock, 10))
+    w.Header().Set("X-Revision-At", revision.At)
+    w.Header().Set("X-Revision-Path", revision.Path)
+    if revision.Actor != "" {
+        w.Header().Set("X-Revision-Actor", revision.Actor)
+    }
     w.Write(content)
 }
 
+// -------------------------------------------------------
+// func readNote(ctx, absPath) ([]byte, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Content of a note, read from its archive when its folder is
+//     archived.
+// Audit:
+//   - A missing note (live or archived) is an os.ErrNotExist error.
+// -------------------------------------------------------
+func readNote(ctx context.Context, absPath string) ([]byte, error) {
+    if record, inner, archived := archivedFolderFor(ctx, relativeTo(ctx, absPath)); archived {
+        return readArchivedFile(ctx, record, inner)
+    }
+    return readFile(ctx, absPath)
+}
+
+// errNotReadable refuses a path GET /file does not serve as a note.
+var errNotReadable = errors.New("only notes inside the scratchpad can be read")
+
+// -------------------------------------------------------
+// func checkNoteRead(ctx, rel) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The read guard of GET /file without raw mode: rel must be a
+//     note inside the root, outside hidden folders. Returns its
+//     absolute path, or errNotReadable.
+// Audit:
+//   - Shared by every route that serves or embeds note content
+//     (/file, /file/render and its includes), so none of them reaches
+//     what another refuses: metadata, files of raw folders (served
+//     only with ?raw=1) and paths outside the root.
+//   - Notes of archived folders pass and must be read with readNote,
+//     which serves them from their archive.
+// -------------------------------------------------------
+func checkNoteRead(ctx context.Context, rel string) (string, error) {
+    absPath := sanitizePath(ctx, rel)
+    if absPath == "" || !isNoteName(absPath) {
+        return "", errNotReadable
+    }
+    return absPath, nil
+}
+
+// -------------------------------------------------------
+// func pathVisible(ctx, rel, folder) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a feed may name rel to the caller of ctx: a folder
+//     GET /files lists, a note checkNoteRead passes, or a file of a
+//     raw folder (readable and listed with ?raw=1).
+// Audit:
+//   - Built from the read routes' own checks, so /activity and
+//     /events never name a path the caller could not open or list:
+//     metadata, dotfiles, paths outside the root, and files outside
+//     raw folders that are not notes.
+// -------------------------------------------------------
+func pathVisible(ctx context.Context, rel string, folder bool) bool {
+    if folder {
+        return sanitizePath(ctx, rel) != ""
+    }
+    if _, err := checkNoteRead(ctx, rel); err == nil {
+        return true
+    }
+    return sanitizePath(ctx, rel) != "" && rawAllowed(ctx, rel)
+}
+
 // -------------------------------------------------------
 // func HandleFileSave(w, r)
 // -------------------------------------------------------
 // Purpose:
-//   - Saves or updates content to a specific .txt file.
+//   - Saves or updates content to a specific .txt or .md note.
 // Audit:
 //   - Logs before/after snapshot of saved file (truncated for safety).
 //   - Sanitizes paths and logs full path written to with UTC timestamps.
+//   - Enforces the filename policy; the stored name is NFC-normalized.
+//   - Rejects content that is not valid UTF-8 with 422 + byte offset.
+//   - Updates the metadata index (size, hash, timestamps) and the
+//     change journal.
+//   - With base_sha256 (the X-Content-SHA256 the client loaded), a
+//     note changed in the meantime is not overwritten: the content is
+//     saved as a conflict copy and 409 returned (see conflicts.go).
+//   - Ledger notes only accept appends; anything else is 403 and
+//     audited (see ledger.go). base_sha256 is not needed for them.
+//   - Content passes through the configured save processors before
+//     any of this; a refusal is 422 (see processors.go).
 // -------------------------------------------------------
 func HandleFileSave(w http.ResponseWriter, r *http.Request) {
     type SaveRequest struct {
-        Path    string `json:"path"`
-        Content string `json:"content"`
+        Path       string          `json:"path"`
+        Content    json.RawMessage `json:"content"`
+        BaseSHA256 string          `json:"base_sha256"`
     }
 
     var req SaveRequest
-    err := json.NewDecoder(r.Body).Decode(&req)
-    if err != nil || req.Path == "" {
-        logError("Invalid save request payload")
-        http.Error(w, "Bad request", http.StatusBadRequest)
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+
+    rawContent, err := decodeRawJSONString(req.Content)
+    if err != nil {
+        logError(r.Context(), "Invalid save request content: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInvalidField, "content", "Bad request: "+err.Error())
+        return
+    }
+    if offset := firstInvalidUTF8(rawContent); offset >= 0 {
+        writeInvalidUTF8(w, r, req.Path, offset)
+        return
+    }
+    content := string(rawContent)
+    if normalizeEOLEnabled(r.Context()) {
+        content = normalizeLineEndings(content)
+    }
+
+    relPath, policyErr := applyNamePolicy(req.Path)
+    if policyErr != nil {
+        logError(r.Context(), "Rejected save path by policy: "+req.Path+" ("+policyErr.Error()+")")
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path: "+policyErr.Error())
         return
     }
 
-    absPath := sanitizePath(req.Path)
-    if absPath == "" || !strings.HasSuffix(absPath, fileExt) {
-        logError("Rejected unsafe save path: " + req.Path)
-        http.Error(w, "Invalid file path", http.StatusBadRequest)
+    absPath := sanitizePath(r.Context(), relPath)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Rejected unsafe save path: "+req.Path)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) || rejectIfApproved(w, r, absPath) {
+        return
+    }
+
+    ctx := r.Context()
+    processed, procErr := processContent(ctx, hookSave, relPath, []byte(content))
+    if procErr != nil {
+        writeProcessorError(w, r, relPath, procErr)
+        return
+    }
+    content = string(processed)
+    if rejectIfDangerous(w, r, relPath, processed) {
         return
     }
 
     before := ""
-    if existing, readErr := ioutil.ReadFile(absPath); readErr == nil {
+    if existing, readErr := readFile(ctx, absPath); readErr == nil {
         before = string(existing)
     }
 
-    err = ioutil.WriteFile(absPath, []byte(req.Content), 0644)
+    if isLedger(ctx, relPath) {
+        err = saveLedger(ctx, relPath, absPath, []byte(content))
+        if ledgerErr, ok := err.(*LedgerError); ok {
+            writeLedgerViolation(w, r, ledgerErr)
+            return
+        }
+    } else if req.BaseSHA256 != "" {
+        conflictPath, saveErr := saveWithBase(ctx, relPath, absPath, []byte(content), req.BaseSHA256)
+        if saveErr == nil && conflictPath != "" {
+            writeSaveConflict(w, r, relPath, conflictPath)
+            return
+        }
+        err = saveErr
+    } else {
+        err = writeFile(ctx, absPath, []byte(content))
+    }
     if err != nil {
-        logError("Failed to save file: " + absPath + " - " + err.Error())
-        http.Error(w, "Write failed", http.StatusInternalServerError)
+        writeStorageError(w, r, err, "save file: "+absPath, "Write failed")
         return
     }
 
-    logInfo("Saved file: " + absPath)
-    logInfo("Before snapshot: " + truncateLog(before))
-    logInfo("After snapshot: " + truncateLog(req.Content))
+    indexUpdate(ctx, relPath, []byte(content))
+    journalPutEntry(ctx, relPath, []byte(content))
+    flagSignedChange(r, relPath, []byte(content))
+
+    logInfo(ctx, "Saved file: "+absPath)
+    logInfo(ctx, "Before snapshot: "+truncateLog(before))
+    logInfo(ctx, "After snapshot: "+truncateLog(content))
 
     w.WriteHeader(http.StatusOK)
 }
@@ -156,6 +575,9 @@ func HandleFileSave(w http.ResponseWriter, r *http.Request) {
 //   - Moves a file from one folder to another safely.
 // Audit:
 //   - Logs full old/new paths and fails fast on any invalid input.
+//   - Enforces the filename policy on the destination path.
+//   - Moves the note's metadata index entry (and sidecar records)
+//     with it and journals the move.
 //   - UTC ISO 8601 timestamps via logInfo/logError.
 // -------------------------------------------------------
 func HandleFileMove(w http.ResponseWriter, r *http.Request) {
@@ -165,30 +587,50 @@ func HandleFileMove(w http.ResponseWriter, r *http.Request) {
     }
 
     var req MoveRequest
-    err := json.NewDecoder(r.Body).Decode(&req)
-    if err != nil || req.From == "" || req.To == "" {
-        logError("Invalid move request payload")
-        http.Error(w, "Bad request", http.StatusBadRequest)
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "from", req.From) || !requireField(w, r, "to", req.To) {
+        return
+    }
+
+    toRel, policyErr := applyNamePolicy(req.To)
+    if policyErr != nil {
+        logError(r.Context(), "Rejected move target by policy: "+req.To+" ("+policyErr.Error()+")")
+        apierror.Write(w, r, apierror.CodeInvalidPath, "to", "Invalid target path: "+policyErr.Error())
         return
     }
 
-    fromPath := sanitizePath(req.From)
-    toPath := sanitizePath(req.To)
+    fromPath := sanitizePath(r.Context(), req.From)
+    toPath := sanitizePath(r.Context(), toRel)
 
-    if fromPath == "" || toPath == "" || !strings.HasSuffix(fromPath, fileExt) || !strings.HasSuffix(toPath, fileExt) {
-        logError("Rejected unsafe move paths: " + req.From + " -> " + req.To)
-        http.Error(w, "Invalid file paths", http.StatusBadRequest)
+    if fromPath == "" || toPath == "" || !isNoteName(fromPath) || !isNoteName(toPath) {
+        logError(r.Context(), "Rejected unsafe move paths: "+req.From+" -> "+req.To)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "", "Invalid file paths")
+        return
+    }
+    if rejectIfArchived(w, r, fromPath) || rejectIfArchived(w, r, toPath) {
+        return
+    }
+    if rejectIfApproved(w, r, fromPath) || rejectIfApproved(w, r, toPath) {
+        return
+    }
+    if rejectIfHeld(w, r, fromPath) || rejectIfHeld(w, r, toPath) {
+        return
+    }
+    if isLedger(r.Context(), toRel) {
+        writeLedgerViolation(w, r, &LedgerError{Path: toRel, Reason: "cannot move another note over a ledger note"})
         return
     }
 
-    err = os.Rename(fromPath, toPath)
+    err := renamePath(r.Context(), fromPath, toPath)
     if err != nil {
-        logError("Failed to move file: " + err.Error())
-        http.Error(w, "Move failed", http.StatusInternalServerError)
+        writeStorageError(w, r, err, "move file: "+fromPath+" -> "+toPath, "Move failed")
         return
     }
 
-    logInfo("Moved file: " + fromPath + " -> " + toPath)
+    fromRel := relativeTo(r.Context(), fromPath)
+    journalMoveEntry(r.Context(), fromRel, toRel, indexRename(r.Context(), fromRel, toRel))
+    renameNoteMeta(r.Context(), fromRel, toRel)
+
+    logInfo(r.Context(), "Moved file: "+fromPath+" -> "+toPath)
     w.WriteHeader(http.StatusOK)
 }
 
@@ -0,0 +1,316 @@
+// -------------------------------------------------------
+// backend/handlers/folder_meta.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Folder descriptions: a short text plus an optional color and
+//     icon per folder, so the sidebar can explain what a folder
+//     such as "07-tax-prov" contains.
+//       GET    /folders/meta[?path=]            all entries / one
+//       PUT    /folders/meta {path, description, color, icon}
+//       DELETE /folders/meta?path=              remove an entry
+//   - GET /folders?include=meta returns the folder list as objects
+//     carrying these fields (combine with archived:
+//     ?include=archived,meta).
+// Audit:
+//   - Entries live in .scratchpad/folder_meta.json, keyed by the
+//     folder's relative path. PUT and DELETE write "folder.meta"
+//     with the old and new values.
+//   - Only existing, non-archived folders can be described. Entries
+//     of deleted folders are kept, so a folder restored from the
+//     trash gets its description back.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "unicode"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    folderMetaFile            = "folder_meta.json"
+    maxFolderDescriptionRunes = 1000
+    maxFolderIconRunes        = 16
+)
+
+// folderColorPattern accepts "#rrggbb" colors.
+var folderColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// folderMetaMu guards folder_meta.json.
+var folderMetaMu sync.Mutex
+
+// -------------------------------------------------------
+// type FolderMeta
+// -------------------------------------------------------
+// Purpose:
+//   - Description, color and icon of one folder.
+// -------------------------------------------------------
+type FolderMeta struct {
+    Path        string `json:"path"`
+    Description string `json:"description"`
+    Color       string `json:"color,omitempty"`
+    Icon        string `json:"icon,omitempty"`
+    UpdatedBy   string `json:"updated_by,omitempty"`
+    UpdatedAt   string `json:"updated_at"`
+}
+
+// loadFolderMetaLocked reads folder_meta.json (path -> entry).
+// Caller holds folderMetaMu.
+func loadFolderMetaLocked(ctx context.Context) (map[string]FolderMeta, error) {
+    entries := map[string]FolderMeta{}
+    if err := loadMetaJSON(ctx, folderMetaFile, &entries); err != nil {
+        return nil, err
+    }
+    if entries == nil {
+        entries = map[string]FolderMeta{}
+    }
+    return entries, nil
+}
+
+// folderMetaAll returns every entry; an unreadable file is logged
+// and treated as empty so folder listings keep working.
+func folderMetaAll(ctx context.Context) map[string]FolderMeta {
+    folderMetaMu.Lock()
+    defer folderMetaMu.Unlock()
+    entries, err := loadFolderMetaLocked(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load folder metadata: "+err.Error())
+        return map[string]FolderMeta{}
+    }
+    return entries
+}
+
+// -------------------------------------------------------
+// func folderListIncludes(r) (archived, meta bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Parse /folders ?include= (comma-separated: archived, meta).
+// -------------------------------------------------------
+func folderListIncludes(r *http.Request) (bool, bool) {
+    archived, meta := false, false
+    for _, item := range strings.Split(r.URL.Query().Get("include"), ",") {
+        switch strings.TrimSpace(item) {
+        case "archived":
+            archived = true
+        case "meta":
+            meta = true
+        }
+    }
+    return archived, meta
+}
+
+// withFolderMeta copies the description fields of entries onto info.
+func withFolderMeta(info FolderInfo, entries map[string]FolderMeta) FolderInfo {
+    if entry, ok := entries[info.Path]; ok {
+        info.Description = entry.Description
+        info.Color = entry.Color
+        info.Icon = entry.Icon
+    }
+    return info
+}
+
+// -------------------------------------------------------
+// func validateFolderMeta(meta FolderMeta) (string, string)
+// -------------------------------------------------------
+// Purpose:
+//   - The field at fault and why, or "" when meta is acceptable.
+// -------------------------------------------------------
+func validateFolderMeta(meta FolderMeta) (string, string) {
+    if !utf8.ValidString(meta.Description) || utf8.RuneCountInString(meta.Description) > maxFolderDescriptionRunes {
+        return "description", fmt.Sprintf("must be valid UTF-8 of at most %d characters", maxFolderDescriptionRunes)
+    }
+    if meta.Color != "" && !folderColorPattern.MatchString(meta.Color) {
+        return "color", `must be a "#rrggbb" color`
+    }
+    if utf8.RuneCountInString(meta.Icon) > maxFolderIconRunes || strings.IndexFunc(meta.Icon, func(c rune) bool {
+        return unicode.IsControl(c) || unicode.IsSpace(c) || c == utf8.RuneError
+    }) >= 0 {
+        return "icon", fmt.Sprintf("must be at most %d characters without spaces", maxFolderIconRunes)
+    }
+    return "", ""
+}
+
+// -------------------------------------------------------
+// func HandleFolderMeta(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: every entry sorted by path, or ?path= for one (404 if
+//     the folder has none).
+//   - PUT {"path", "description", "color", "icon"}: set a folder's
+//     entry; all three fields empty removes it.
+//   - DELETE ?path=: remove a folder's entry (404 if none).
+// -------------------------------------------------------
+func HandleFolderMeta(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        getFolderMeta(w, r)
+    case http.MethodPut:
+        putFolderMeta(w, r)
+    case http.MethodDelete:
+        deleteFolderMeta(w, r)
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// getFolderMeta serves GET /folders/meta.
+func getFolderMeta(w http.ResponseWriter, r *http.Request) {
+    entries := folderMetaAll(r.Context())
+    if p := r.URL.Query().Get("path"); p != "" {
+        absPath := sanitizePath(r.Context(), p)
+        if absPath == "" || absPath == scratchRoot(r.Context()) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+            return
+        }
+        entry, ok := entries[relativeTo(r.Context(), absPath)]
+        if !ok {
+            apierror.Write(w, r, apierror.CodeNotFound, "path", "Folder has no description")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(entry)
+        return
+    }
+    list := make([]FolderMeta, 0, len(entries))
+    for _, entry := range entries {
+        list = append(list, entry)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// putFolderMeta serves PUT /folders/meta.
+func putFolderMeta(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Path        string `json:"path"`
+        Description string `json:"description"`
+        Color       string `json:"color"`
+        Icon        string `json:"icon"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    info, err := statPath(r.Context(), absPath)
+    if err != nil || !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "Folder not found")
+        return
+    }
+
+    meta := FolderMeta{
+        Path:        relativeTo(r.Context(), absPath),
+        Description: strings.TrimSpace(req.Description),
+        Color:       strings.ToLower(strings.TrimSpace(req.Color)),
+        Icon:        strings.TrimSpace(req.Icon),
+        UpdatedBy:   actorName(r.Context()),
+        UpdatedAt:   utcNow(r.Context()),
+    }
+    if field, problem := validateFolderMeta(meta); field != "" {
+        apierror.Write(w, r, apierror.CodeInvalidField, field, "Bad request: "+field+" "+problem)
+        return
+    }
+
+    folderMetaMu.Lock()
+    defer folderMetaMu.Unlock()
+    entries, err := loadFolderMetaLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load folder metadata", "Internal error")
+        return
+    }
+    previous := entries[meta.Path]
+    if meta.Description == "" && meta.Color == "" && meta.Icon == "" {
+        delete(entries, meta.Path)
+    } else {
+        entries[meta.Path] = meta
+    }
+    if err := saveMetaJSON(r.Context(), folderMetaFile, entries); err != nil {
+        writeStorageError(w, r, err, "save folder metadata", "Update failed")
+        return
+    }
+    touchFolders(meta.Path)
+
+    logInfo(r.Context(), "Updated folder description: "+meta.Path)
+    auditFolderMeta(r, http.StatusOK, meta.Path, previous, meta)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(meta)
+}
+
+// deleteFolderMeta serves DELETE /folders/meta?path=.
+func deleteFolderMeta(w http.ResponseWriter, r *http.Request) {
+    p := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", p) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), p)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    folderMetaMu.Lock()
+    defer folderMetaMu.Unlock()
+    entries, err := loadFolderMetaLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load folder metadata", "Internal error")
+        return
+    }
+    previous, ok := entries[rel]
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "Folder has no description")
+        return
+    }
+    delete(entries, rel)
+    if err := saveMetaJSON(r.Context(), folderMetaFile, entries); err != nil {
+        writeStorageError(w, r, err, "save folder metadata", "Delete failed")
+        return
+    }
+    touchFolders(rel)
+
+    logInfo(r.Context(), "Removed folder description: "+rel)
+    auditFolderMeta(r, http.StatusNoContent, rel, previous, FolderMeta{})
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// -------------------------------------------------------
+// func auditFolderMeta(r, status, rel, before, after)
+// -------------------------------------------------------
+// Purpose:
+//   - Write a "folder.meta" event with the old and new values.
+// -------------------------------------------------------
+func auditFolderMeta(r *http.Request, status int, rel string, before FolderMeta, after FolderMeta) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "folder.meta",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail: fmt.Sprintf("description=%q->%q color=%q->%q icon=%q->%q",
+            before.Description, after.Description, before.Color, after.Color, before.Icon, after.Icon),
+    })
+}
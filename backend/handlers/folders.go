@@ -2,8 +2,9 @@
 // backend/handlers/folders.go
 // -------------------------------------------------------
 // Purpose Summary:
-//   - Handle folder listing and creation for cfo-scratchpad.
-//   - Responds to GET (list) and POST (create) requests on /folders.
+//   - Handle folder listing, creation, and deletion for cfo-scratchpad.
+//   - Responds to GET (list), POST (create), and DELETE (trash)
+//     requests on /folders.
 // Audit:
 //   - Logs all operations with UTC ISO 8601 timestamps.
 //   - Enforces path safety and fails fast on invalid input.
@@ -12,16 +13,17 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "net/http"
     "os"
     "path/filepath"
+    "sort"
     "strings"
-    "time"
-)
 
-const scratchRoot = "/scratchpad-data"
+    "cfo-scratchpad/apierror"
+)
 
 // -------------------------------------------------------
 // func utcNow()
@@ -31,8 +33,8 @@ const scratchRoot = "/scratchpad-data"
 // Audit:
 //   - Centralizes timestamp formatting for all logs.
 // -------------------------------------------------------
-func utcNow() string {
-    return time.Now().UTC().Format("2006-01-02T15:04:05Z")
+func utcNow(ctx context.Context) string {
+    return timeNow(ctx).UTC().Format("2006-01-02T15:04:05Z")
 }
 
 // -------------------------------------------------------
@@ -43,8 +45,8 @@ func utcNow() string {
 // Audit:
 //   - Visible, timestamped log trail for normal operations.
 // -------------------------------------------------------
-func logInfo(msg string) {
-    fmt.Printf("[INFO] %s %s\n", utcNow(), msg)
+func logInfo(ctx context.Context, msg string) {
+    serverFrom(ctx).Logger.Info(msg)
 }
 
 // -------------------------------------------------------
@@ -55,8 +57,8 @@ func logInfo(msg string) {
 // Audit:
 //   - Ensures all failure paths are recorded visibly.
 // -------------------------------------------------------
-func logError(msg string) {
-    fmt.Printf("[ERROR] %s %s\n", utcNow(), msg)
+func logError(ctx context.Context, msg string) {
+    serverFrom(ctx).Logger.Error(msg)
 }
 
 // -------------------------------------------------------
@@ -66,32 +68,65 @@ func logError(msg string) {
 //   - Prevents directory traversal by sanitizing input paths.
 // Audit:
 //   - Strips `..` and ensures paths are rooted under scratchRoot.
+//   - Applies NFC normalization so lookups match stored names.
+//   - Rejects dot-prefixed components (system data, e.g. .scratchpad).
 // -------------------------------------------------------
-func sanitizePath(path string) string {
-    clean := filepath.Clean(path)
+func sanitizePath(ctx context.Context, path string) string {
+    clean := filepath.Clean(normalizeNFC(path))
     if strings.Contains(clean, "..") {
         return ""
     }
-    return filepath.Join(scratchRoot, clean)
+    if clean != "." {
+        for _, part := range strings.Split(filepath.ToSlash(clean), "/") {
+            if strings.HasPrefix(part, ".") {
+                return ""
+            }
+        }
+    }
+    return filepath.Join(scratchRoot(ctx), clean)
+}
+
+// -------------------------------------------------------
+// func relativeTo(ctx context.Context, absPath string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Inverse of sanitizePath: slash-separated path below scratchRoot.
+// Audit:
+//   - Used as the stable key for metadata (index, sidecars).
+// -------------------------------------------------------
+func relativeTo(ctx context.Context, absPath string) string {
+    rel, err := filepath.Rel(scratchRoot(ctx), absPath)
+    if err != nil {
+        return ""
+    }
+    return filepath.ToSlash(rel)
 }
 
 // -------------------------------------------------------
 // func HandleFolders(w http.ResponseWriter, r *http.Request)
 // -------------------------------------------------------
 // Purpose:
-//   - Dispatch handler for GET (list folders) and POST (create folder).
+//   - Dispatch handler for GET (list folders), POST (create folder),
+//     and DELETE (move folder to trash, see trash.go).
+//   - ?type=smart manages smart folders instead (smart_folders.go).
 // Audit:
 //   - Logs method, path, and outcomes for all folder actions.
 // -------------------------------------------------------
 func HandleFolders(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Query().Get("type") == "smart" {
+        handleSmartFolders(w, r)
+        return
+    }
     switch r.Method {
     case "GET":
         handleListFolders(w, r)
     case "POST":
         handleCreateFolder(w, r)
+    case "DELETE":
+        handleDeleteFolder(w, r)
     default:
-        logError("Unsupported method: " + r.Method)
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
     }
 }
 
@@ -102,45 +137,101 @@ func HandleFolders(w http.ResponseWriter, r *http.Request) {
 //   - Lists all subfolders under the scratchpad root.
 // Audit:
 //   - Logs total folders found and any filesystem errors.
+//   - Hidden (dot) directories such as .scratchpad are skipped.
+//   - Archived folders are omitted unless ?include=archived, which
+//     returns [{"path", "archived", "archived_at"}] instead.
+//   - ?include=meta returns objects with each folder's description,
+//     color and icon (folder_meta.go); it combines with archived.
 //   - Ensures JSON response is always an array (never null).
+//   - ?format=ndjson streams one entry per line (listing_stream.go).
+//   - Folders are in manual order among their siblings, then by name
+//     (ordering.go).
+//   - Answers 304 when If-None-Match names the current ETag
+//     (listing_etag.go).
 //   - UTC ISO 8601 timestamps via logInfo/logError.
 // -------------------------------------------------------
 func handleListFolders(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Query().Get("format") == formatNDJSON {
+        streamFolderList(w, r)
+        return
+    }
+    if notModified(w, r, listingETag(r, scratchRoot(r.Context()))) {
+        return
+    }
+
     // Always initialize to an empty slice so JSON is [] instead of null.
     folders := []string{}
 
+    ctx := r.Context()
+
     // If root is missing, treat as empty but log clearly.
-    if _, statErr := os.Stat(scratchRoot); os.IsNotExist(statErr) {
-        logInfo("Scratch root missing; returning empty folder list: " + scratchRoot)
+    if _, statErr := statPath(ctx, scratchRoot(ctx)); os.IsNotExist(statErr) {
+        logInfo(ctx, "Scratch root missing; returning empty folder list: "+scratchRoot(ctx))
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(folders)
         return
     }
 
-    err := filepath.Walk(scratchRoot, func(path string, info os.FileInfo, err error) error {
+    err := walkPath(ctx, scratchRoot(ctx), func(path string, info os.FileInfo, err error) error {
         if err != nil {
             return err
         }
-        if info.IsDir() && path != scratchRoot {
-            rel, relErr := filepath.Rel(scratchRoot, path)
+        if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != scratchRoot(ctx) {
+            return filepath.SkipDir
+        }
+        if info.IsDir() && path != scratchRoot(ctx) {
+            rel, relErr := filepath.Rel(scratchRoot(ctx), path)
             if relErr != nil {
                 return relErr
             }
+            if _, _, archived := archivedFolderFor(ctx, filepath.ToSlash(rel)); archived {
+                return filepath.SkipDir
+            }
             folders = append(folders, rel)
         }
         return nil
     })
 
     if err != nil {
-        logError("Failed to list folders: " + err.Error())
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeStorageError(w, r, err, "list folders", "Internal server error")
         return
     }
 
-    logInfo(fmt.Sprintf("Listed %d folders", len(folders)))
+    logInfo(ctx, fmt.Sprintf("Listed %d folders", len(folders)))
+    positions := currentOrder(ctx).Folders
+    sort.SliceStable(folders, func(a, b int) bool { return lessFolderPath(positions, folders[a], folders[b]) })
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(folders)
+    withArchived, withMeta := folderListIncludes(r)
+    if !withArchived && !withMeta {
+        json.NewEncoder(w).Encode(folders)
+        return
+    }
+
+    // include=archived and/or meta: objects instead of plain paths.
+    infos := []FolderInfo{}
+    for _, folder := range folders {
+        infos = append(infos, FolderInfo{Path: folder, Position: positionOf(positions, folder)})
+    }
+    if withArchived {
+        for _, record := range archivedFolders(ctx) {
+            subfolders, listErr := listArchivedSubfolders(ctx, record)
+            if listErr != nil {
+                logError(ctx, "Failed to read archive "+record.ID+": "+listErr.Error())
+            }
+            for _, folder := range subfolders {
+                infos = append(infos, FolderInfo{Path: folder, Archived: true, ArchivedAt: record.ArchivedAt, Position: positionOf(positions, folder)})
+            }
+        }
+    }
+    if withMeta {
+        entries := folderMetaAll(ctx)
+        for i := range infos {
+            infos[i] = withFolderMeta(infos[i], entries)
+        }
+    }
+    sort.SliceStable(infos, func(a, b int) bool { return lessFolderPath(positions, infos[a].Path, infos[b].Path) })
+    json.NewEncoder(w).Encode(infos)
 }
 
 // -------------------------------------------------------
@@ -150,6 +241,8 @@ func handleListFolders(w http.ResponseWriter, r *http.Request) {
 //   - Creates a new folder under scratchpad root.
 // Audit:
 //   - Logs created path and fails fast on unsafe paths.
+//   - Enforces the filename policy (NFC, reserved names, etc.).
+//   - A folder that did not exist yet is journaled as "mkdir".
 // -------------------------------------------------------
 func handleCreateFolder(w http.ResponseWriter, r *http.Request) {
     type Request struct {
@@ -157,27 +250,37 @@ func handleCreateFolder(w http.ResponseWriter, r *http.Request) {
     }
 
     var req Request
-    err := json.NewDecoder(r.Body).Decode(&req)
-    if err != nil || req.Name == "" {
-        logError("Invalid folder creation payload")
-        http.Error(w, "Bad request", http.StatusBadRequest)
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "name", req.Name) {
+        return
+    }
+
+    name, policyErr := applyNamePolicy(req.Name)
+    if policyErr != nil {
+        logError(r.Context(), "Rejected folder name by policy: "+req.Name+" ("+policyErr.Error()+")")
+        apierror.Write(w, r, apierror.CodeInvalidPath, "name", "Invalid folder name: "+policyErr.Error())
         return
     }
 
-    safePath := sanitizePath(req.Name)
+    safePath := sanitizePath(r.Context(), name)
     if safePath == "" {
-        logError("Rejected unsafe folder name: " + req.Name)
-        http.Error(w, "Invalid folder path", http.StatusBadRequest)
+        logError(r.Context(), "Rejected unsafe folder name: "+req.Name)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "name", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, safePath) {
         return
     }
 
-    mkErr := os.MkdirAll(safePath, 0755)
+    _, statErr := statPath(r.Context(), safePath)
+    mkErr := mkdirAll(r.Context(), safePath)
     if mkErr != nil {
-        logError("Failed to create folder: " + mkErr.Error())
-        http.Error(w, "Internal error", http.StatusInternalServerError)
+        writeStorageError(w, r, mkErr, "create folder: "+safePath, "Internal error")
         return
     }
+    if os.IsNotExist(statErr) {
+        journalMkdirEntry(r.Context(), relativeTo(r.Context(), safePath))
+    }
 
-    logInfo("Created folder: " + safePath)
+    logInfo(r.Context(), "Created folder: "+safePath)
     w.WriteHeader(http.StatusCreated)
 }
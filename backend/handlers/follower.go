@@ -0,0 +1,212 @@
+// -------------------------------------------------------
+// backend/handlers/follower.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Follower mode: a hot standby for the single-binary deployment.
+//     With sync.follower, a secondary keeps pulling the primary's
+//     change journal (sync.go), serves read traffic, and refuses
+//     writes until an operator promotes it.
+//       GET  /admin/follower           role, primary, lag
+//       POST /admin/follower/promote   become a primary
+// Audit:
+//   - While following, scheduled writers are paused (as during
+//     maintenance), so the follower holds exactly what the primary
+//     sent.
+//   - Promotion is saved in .scratchpad/promotion.json: a restart
+//     with sync.follower still set stays primary instead of
+//     following a primary it has replaced, and the sync puller stops
+//     so a returning old primary cannot overwrite newer writes.
+//   - Promotion writes "admin.promote" with the cursor reached and
+//     whether the final catch-up pull succeeded.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    promotionFile       = "promotion.json"
+    promoteCatchUpLimit = 2 * time.Minute
+)
+
+// following is true while this instance is a read-only follower;
+// promoted is true once it has replaced its primary.
+var (
+    following atomic.Bool
+    promoted  atomic.Bool
+)
+
+// -------------------------------------------------------
+// type Promotion
+// -------------------------------------------------------
+// Purpose:
+//   - Contents of promotion.json.
+// -------------------------------------------------------
+type Promotion struct {
+    PromotedAt string `json:"promoted_at"`
+    PromotedBy string `json:"promoted_by,omitempty"`
+    Primary    string `json:"primary"`
+    Cursor     int64  `json:"cursor"`
+    CaughtUp   bool   `json:"caught_up"`
+}
+
+// loadPromotion returns promotion.json; ok is false when the
+// instance was never promoted.
+func loadPromotion(ctx context.Context) (Promotion, bool) {
+    var promotion Promotion
+    if err := loadMetaJSON(ctx, promotionFile, &promotion); err != nil {
+        logError(ctx, "Failed to load promotion record: "+err.Error())
+    }
+    return promotion, promotion.PromotedAt != ""
+}
+
+// -------------------------------------------------------
+// func StartFollower(ctx context.Context, enabled bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Enter follower mode at startup when sync.follower is set and
+//     the instance has not been promoted since.
+// -------------------------------------------------------
+func StartFollower(ctx context.Context, enabled bool) {
+    if !enabled {
+        return
+    }
+    if promotion, ok := loadPromotion(ctx); ok {
+        promoted.Store(true)
+        logError(ctx, "sync.follower is set but this instance was promoted at "+promotion.PromotedAt+"; running as primary")
+        return
+    }
+    following.Store(true)
+    logInfo(ctx, "Running as a read-only follower of "+currentConfig(ctx).Sync.Primary)
+}
+
+// IsFollower reports whether writes are refused as a follower.
+func IsFollower() bool {
+    return following.Load()
+}
+
+// -------------------------------------------------------
+// func followerStatus(ctx) map[string]interface{}
+// -------------------------------------------------------
+// Purpose:
+//   - Role and replication progress for /admin/follower.
+// Audit:
+//   - lag is the number of primary journal entries not yet pulled,
+//     as of the last pull.
+// -------------------------------------------------------
+func followerStatus(ctx context.Context) map[string]interface{} {
+    state := loadSyncState(ctx)
+    role := "primary"
+    if IsFollower() {
+        role = "follower"
+    }
+    lag := state.PrimaryClock - state.Cursor
+    if lag < 0 {
+        lag = 0
+    }
+    status := map[string]interface{}{
+        "role":          role,
+        "primary":       currentConfig(ctx).Sync.Primary,
+        "cursor":        state.Cursor,
+        "primary_clock": state.PrimaryClock,
+        "lag":           lag,
+        "last_sync_at":  state.LastSyncAt,
+        "last_error":    state.LastError,
+    }
+    if promotion, ok := loadPromotion(ctx); ok {
+        status["promotion"] = promotion
+    }
+    return status
+}
+
+// -------------------------------------------------------
+// func HandleFollower(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/follower: role and lag.
+// -------------------------------------------------------
+func HandleFollower(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(followerStatus(r.Context()))
+}
+
+// -------------------------------------------------------
+// func HandleFollowerPromote(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/follower/promote {"force": bool}: pull once more
+//     from the primary, then stop following and accept writes.
+// Audit:
+//   - A failed catch-up pull (primary down) answers 502 unless
+//     force is set; forcing promotes with what was pulled so far.
+//   - 409 when the instance is not a follower.
+// -------------------------------------------------------
+func HandleFollowerPromote(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Force bool `json:"force"`
+    }
+    if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+        return
+    }
+    if !IsFollower() {
+        apierror.Write(w, r, apierror.CodeConflict, "", "This instance is not a follower")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), promoteCatchUpLimit)
+    _, pullErr := SyncOnce(ctx)
+    cancel()
+    if pullErr != nil && !req.Force {
+        logError(ctx, "Promotion catch-up failed: "+pullErr.Error())
+        apierror.Write(w, r, apierror.CodeUpstreamFailed, "", "Catch-up pull failed: "+pullErr.Error()+`; retry, or send {"force": true} to promote anyway`)
+        return
+    }
+
+    state := loadSyncState(ctx)
+    promotion := Promotion{
+        PromotedAt: utcNow(ctx),
+        PromotedBy: defaultString(actorName(r.Context()), "admin"),
+        Primary:    currentConfig(r.Context()).Sync.Primary,
+        Cursor:     state.Cursor,
+        CaughtUp:   pullErr == nil,
+    }
+    if err := saveMetaJSON(ctx, promotionFile, promotion); err != nil {
+        writeStorageError(w, r, err, "save promotion record", "Promotion failed")
+        return
+    }
+    promoted.Store(true)
+    following.Store(false)
+
+    logInfo(ctx, fmt.Sprintf("Promoted to primary at cursor %d (caught up: %t)", promotion.Cursor, promotion.CaughtUp))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "admin.promote",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   promotion.Primary,
+        Detail:   fmt.Sprintf("cursor=%d caught_up=%t force=%t%s", promotion.Cursor, promotion.CaughtUp, req.Force, errSuffix(pullErr)),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(followerStatus(r.Context()))
+}
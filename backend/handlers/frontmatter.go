@@ -0,0 +1,329 @@
+// -------------------------------------------------------
+// backend/handlers/frontmatter.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - YAML frontmatter: structured fields at the top of a note,
+//     between "---" lines, kept in the same file as the free text.
+//       ---
+//       title: Q3 accrual review
+//       tags: [close, q3]
+//       status: in-review
+//       owner: amy
+//       due: 2025-10-15
+//       ---
+//   - Parsed on save into the metadata index, shown in detailed
+//     listings and search results, and filterable there with
+//     ?status=, ?owner=, ?tag=, ?due_before= and ?due_after=.
+// Audit:
+//   - Only the subset of YAML these fields need is read: scalars
+//     (plain or quoted), flow lists [a, b], block lists "- a", and
+//     comments. Other keys are ignored; malformed frontmatter never
+//     fails a save, it is simply not indexed.
+//   - Values are kept as written; filters compare them ignoring
+//     case. Tags are lowercased without a leading '#', like
+//     hashtags; due must be a YYYY-MM-DD date or it is dropped.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // maxFrontmatterLines bounds how far a closing "---" is sought.
+    maxFrontmatterLines  = 200
+    maxFrontmatterValue  = 256
+    maxFrontmatterTags   = 50
+    frontmatterDueLayout = "2006-01-02"
+)
+
+// -------------------------------------------------------
+// type Frontmatter
+// -------------------------------------------------------
+// Purpose:
+//   - The indexed frontmatter fields of one note.
+// Audit:
+//   - The index keeps an empty Frontmatter for notes without any,
+//     so nil there means "not parsed yet" (see frontmatterLookup).
+// -------------------------------------------------------
+type Frontmatter struct {
+    Title  string   `json:"title,omitempty"`
+    Tags   []string `json:"tags,omitempty"`
+    Status string   `json:"status,omitempty"`
+    Owner  string   `json:"owner,omitempty"`
+    Due    string   `json:"due,omitempty"`
+}
+
+// empty reports whether no field is set.
+func (f *Frontmatter) empty() bool {
+    return f == nil || f.Title == "" && len(f.Tags) == 0 && f.Status == "" && f.Owner == "" && f.Due == ""
+}
+
+// -------------------------------------------------------
+// func frontmatterBlock(data []byte) ([]string, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The lines between the opening and closing "---" of a note
+//     that starts with frontmatter.
+// Audit:
+//   - A UTF-8 BOM and CRLF line endings are accepted; "..." also
+//     closes the block, as in YAML.
+// -------------------------------------------------------
+func frontmatterBlock(data []byte) ([]string, bool) {
+    data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+    lines := strings.SplitN(string(data), "\n", maxFrontmatterLines+2)
+    if len(lines) < 2 || strings.TrimRight(lines[0], " \t\r") != "---" {
+        return nil, false
+    }
+    for i := 1; i < len(lines) && i <= maxFrontmatterLines; i++ {
+        line := strings.TrimRight(lines[i], " \t\r")
+        if line == "---" || line == "..." {
+            block := lines[1:i]
+            for j := range block {
+                block[j] = strings.TrimRight(block[j], "\r")
+            }
+            return block, true
+        }
+    }
+    return nil, false
+}
+
+// -------------------------------------------------------
+// func parseFrontmatter(data []byte) *Frontmatter
+// -------------------------------------------------------
+// Purpose:
+//   - The frontmatter fields of a note; never nil (empty when the
+//     note has no frontmatter).
+// -------------------------------------------------------
+func parseFrontmatter(data []byte) *Frontmatter {
+    fm := &Frontmatter{}
+    block, ok := frontmatterBlock(data)
+    if !ok {
+        return fm
+    }
+
+    values := map[string][]string{}
+    key := ""
+    for _, line := range block {
+        trimmed := strings.TrimSpace(line)
+        if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+            continue
+        }
+        indented := line[0] == ' ' || line[0] == '\t'
+        if indented || strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+            // Block list item of the last key; other nesting is
+            // not one of our fields.
+            if key != "" && strings.HasPrefix(trimmed, "-") {
+                values[key] = append(values[key], yamlScalar(strings.TrimPrefix(trimmed, "-")))
+            }
+            continue
+        }
+        colon := strings.Index(line, ":")
+        if colon <= 0 {
+            key = ""
+            continue
+        }
+        key = strings.ToLower(strings.TrimSpace(line[:colon]))
+        raw := strings.TrimSpace(line[colon+1:])
+        switch {
+        case raw == "":
+            values[key] = nil
+        case strings.HasPrefix(raw, "["):
+            values[key] = yamlFlowList(raw)
+        default:
+            values[key] = []string{yamlScalar(raw)}
+        }
+    }
+
+    single := func(name string) string {
+        if list := values[name]; len(list) == 1 && len(list[0]) <= maxFrontmatterValue {
+            return list[0]
+        }
+        return ""
+    }
+    fm.Title = single("title")
+    fm.Status = single("status")
+    fm.Owner = single("owner")
+    if due := single("due"); len(due) >= len(frontmatterDueLayout) {
+        // A YAML timestamp (2025-10-15T17:00:00Z) counts by its date.
+        if _, err := time.Parse(frontmatterDueLayout, due[:len(frontmatterDueLayout)]); err == nil {
+            fm.Due = due[:len(frontmatterDueLayout)]
+        }
+    }
+
+    seen := map[string]bool{}
+    for _, value := range values["tags"] {
+        // "tags: close, q3" and "tags: close q3" list tags too.
+        for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+            tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+            if smartTagPattern.MatchString(tag) && !seen[tag] && len(fm.Tags) < maxFrontmatterTags {
+                seen[tag] = true
+                fm.Tags = append(fm.Tags, tag)
+            }
+        }
+    }
+    return fm
+}
+
+// yamlScalar unquotes a YAML scalar and drops a trailing comment.
+func yamlScalar(raw string) string {
+    raw = strings.TrimSpace(raw)
+    switch {
+    case strings.HasPrefix(raw, `"`):
+        if end := strings.LastIndex(raw, `"`); end > 0 {
+            if value, err := strconv.Unquote(raw[:end+1]); err == nil {
+                return value
+            }
+            return raw[1:end]
+        }
+    case strings.HasPrefix(raw, "'"):
+        if end := strings.LastIndex(raw, "'"); end > 0 {
+            return strings.ReplaceAll(raw[1:end], "''", "'")
+        }
+    }
+    if comment := strings.Index(raw, " #"); comment >= 0 {
+        raw = raw[:comment]
+    }
+    return strings.TrimSpace(raw)
+}
+
+// yamlFlowList splits a flow sequence such as [close, "q3"].
+func yamlFlowList(raw string) []string {
+    raw = strings.TrimPrefix(raw, "[")
+    if end := strings.LastIndex(raw, "]"); end >= 0 {
+        raw = raw[:end]
+    }
+    var items []string
+    for _, item := range strings.Split(raw, ",") {
+        if value := yamlScalar(item); value != "" {
+            items = append(items, value)
+        }
+    }
+    return items
+}
+
+// -------------------------------------------------------
+// type frontmatterLookup
+// -------------------------------------------------------
+// Purpose:
+//   - Resolve the frontmatter of many notes for one listing or
+//     search from an index snapshot.
+// -------------------------------------------------------
+type frontmatterLookup struct {
+    ctx   context.Context
+    index map[string]IndexEntry
+}
+
+// newFrontmatterLookup reads from index (an indexSnapshot).
+func newFrontmatterLookup(ctx context.Context, index map[string]IndexEntry) *frontmatterLookup {
+    return &frontmatterLookup{ctx: ctx, index: index}
+}
+
+// -------------------------------------------------------
+// func (l *frontmatterLookup) of(rel string) *Frontmatter
+// -------------------------------------------------------
+// Purpose:
+//   - The frontmatter of a note; never nil.
+// Audit:
+//   - Index entries from before frontmatter was indexed are parsed
+//     now and stored; unreadable notes have none.
+// -------------------------------------------------------
+func (l *frontmatterLookup) of(rel string) *Frontmatter {
+    if entry, ok := l.index[rel]; ok && entry.Frontmatter != nil {
+        return entry.Frontmatter
+    }
+    data, err := readFile(l.ctx, sanitizePath(l.ctx, rel))
+    if err != nil {
+        return &Frontmatter{}
+    }
+    fm := parseFrontmatter(data)
+    indexSetFrontmatter(l.ctx, rel, fm)
+    return fm
+}
+
+// shown is the frontmatter of a note for a response (nil when it
+// has none, so the field is omitted).
+func (l *frontmatterLookup) shown(rel string) *Frontmatter {
+    if fm := l.of(rel); !fm.empty() {
+        return fm
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// type frontmatterQuery
+// -------------------------------------------------------
+// Purpose:
+//   - The frontmatter filters of a listing or search request.
+// Audit:
+//   - All given filters must hold. tag also matches the note's
+//     hashtags; due_before/due_after are inclusive and exclude
+//     notes without a due date.
+// -------------------------------------------------------
+type frontmatterQuery struct {
+    Status    string
+    Owner     string
+    Tag       string
+    DueBefore string
+    DueAfter  string
+}
+
+// active reports whether any filter is set.
+func (q frontmatterQuery) active() bool {
+    return q != frontmatterQuery{}
+}
+
+// matches reports whether a note with fm and hashtags passes.
+func (q frontmatterQuery) matches(fm *Frontmatter, hashtags []string) bool {
+    if q.Status != "" && !strings.EqualFold(fm.Status, q.Status) {
+        return false
+    }
+    if q.Owner != "" && !strings.EqualFold(fm.Owner, q.Owner) {
+        return false
+    }
+    if q.Tag != "" && !oneOf(q.Tag, fm.Tags) && !oneOf(q.Tag, hashtags) {
+        return false
+    }
+    if (q.DueBefore != "" || q.DueAfter != "") && fm.Due == "" {
+        return false
+    }
+    if q.DueBefore != "" && fm.Due > q.DueBefore {
+        return false
+    }
+    if q.DueAfter != "" && fm.Due < q.DueAfter {
+        return false
+    }
+    return true
+}
+
+// -------------------------------------------------------
+// func frontmatterFilter(r) (frontmatterQuery, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The request's frontmatter filters (zero when absent).
+// -------------------------------------------------------
+func frontmatterFilter(r *http.Request) (frontmatterQuery, error) {
+    params := r.URL.Query()
+    q := frontmatterQuery{
+        Status:    params.Get("status"),
+        Owner:     params.Get("owner"),
+        Tag:       strings.ToLower(strings.TrimPrefix(params.Get("tag"), "#")),
+        DueBefore: params.Get("due_before"),
+        DueAfter:  params.Get("due_after"),
+    }
+    if q.Tag != "" && !smartTagPattern.MatchString(q.Tag) {
+        return q, invalidField("tag", "must be a tag such as close or #close")
+    }
+    for field, value := range map[string]string{"due_before": q.DueBefore, "due_after": q.DueAfter} {
+        if _, err := time.Parse(frontmatterDueLayout, value); value != "" && err != nil {
+            return q, invalidField(field, "must be a date (YYYY-MM-DD)")
+        }
+    }
+    return q, nil
+}
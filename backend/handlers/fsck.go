@@ -0,0 +1,217 @@
+// -------------------------------------------------------
+// backend/handlers/fsck.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Consistency checker for metadata layered on the filesystem.
+//   - /admin/fsck endpoint (GET = report, POST ?repair=1 = repair)
+//     and the shared RunFsck used by the `fsck` CLI command.
+// Audit:
+//   - The filesystem is the source of truth; repairs only ever
+//     change metadata under .scratchpad, never user notes.
+//   - Checks: index entries without a file (orphan_index), notes
+//     missing from the index (unindexed), size/hash drift
+//     (mismatch), and leftover temp files from interrupted
+//     metadata writes (stray_temp).
+//   - Every repair run writes an "admin.fsck_repair" audit event.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// -------------------------------------------------------
+// type FsckIssue / FsckReport
+// -------------------------------------------------------
+// Purpose:
+//   - One detected inconsistency and the overall check result.
+// -------------------------------------------------------
+type FsckIssue struct {
+    Kind     string `json:"kind"`
+    Path     string `json:"path"`
+    Detail   string `json:"detail"`
+    Repaired bool   `json:"repaired"`
+}
+
+type FsckReport struct {
+    CheckedAt    string      `json:"checked_at"`
+    FilesOnDisk  int         `json:"files_on_disk"`
+    IndexEntries int         `json:"index_entries"`
+    Repair       bool        `json:"repair"`
+    Issues       []FsckIssue `json:"issues"`
+}
+
+// -------------------------------------------------------
+// func RunFsck(ctx, repair) (FsckReport, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Cross-check metadata against the filesystem; optionally repair.
+// Audit:
+//   - Issues are sorted by kind then path for stable output.
+// -------------------------------------------------------
+func RunFsck(ctx context.Context, repair bool) (FsckReport, error) {
+    report := FsckReport{CheckedAt: utcNow(ctx), Repair: repair, Issues: []FsckIssue{}}
+
+    onDisk, err := buildIndexFromDisk(ctx)
+    if err != nil {
+        return report, err
+    }
+    indexed := indexSnapshot(ctx)
+    report.FilesOnDisk = len(onDisk)
+    report.IndexEntries = len(indexed)
+
+    for rel, entry := range indexed {
+        actual, ok := onDisk[rel]
+        if !ok {
+            report.Issues = append(report.Issues, FsckIssue{
+                Kind: "orphan_index", Path: rel, Detail: "index entry has no file on disk",
+            })
+            continue
+        }
+        if actual.SHA256 != entry.SHA256 || actual.Size != entry.Size {
+            report.Issues = append(report.Issues, FsckIssue{
+                Kind: "mismatch", Path: rel,
+                Detail: fmt.Sprintf("index size=%d sha256=%.12s, disk size=%d sha256=%.12s",
+                    entry.Size, entry.SHA256, actual.Size, actual.SHA256),
+            })
+        }
+    }
+    for rel := range onDisk {
+        if _, ok := indexed[rel]; !ok {
+            report.Issues = append(report.Issues, FsckIssue{
+                Kind: "unindexed", Path: rel, Detail: "file on disk is missing from the index",
+            })
+        }
+    }
+
+    strays, err := strayTempFiles(ctx)
+    if err != nil {
+        return report, err
+    }
+    for _, stray := range strays {
+        report.Issues = append(report.Issues, FsckIssue{
+            Kind: "stray_temp", Path: relativeTo(ctx, stray), Detail: "leftover temp file from an interrupted metadata write",
+        })
+    }
+
+    if repair && len(report.Issues) > 0 {
+        repairIndex(ctx, onDisk, indexed, report.Issues)
+        for i := range report.Issues {
+            issue := &report.Issues[i]
+            if issue.Kind == "stray_temp" {
+                issue.Repaired = serverFrom(ctx).Storage.Remove(filepath.Join(scratchRoot(ctx), filepath.FromSlash(issue.Path))) == nil
+                continue
+            }
+            issue.Repaired = true
+        }
+    }
+
+    sort.Slice(report.Issues, func(a, b int) bool {
+        if report.Issues[a].Kind != report.Issues[b].Kind {
+            return report.Issues[a].Kind < report.Issues[b].Kind
+        }
+        return report.Issues[a].Path < report.Issues[b].Path
+    })
+    return report, nil
+}
+
+// -------------------------------------------------------
+// func repairIndex(ctx, onDisk, indexed, issues)
+// -------------------------------------------------------
+// Purpose:
+//   - Bring the index in line with disk, keeping created_at for
+//     entries that still exist.
+// -------------------------------------------------------
+func repairIndex(ctx context.Context, onDisk map[string]IndexEntry, indexed map[string]IndexEntry, issues []FsckIssue) {
+    repaired := make(map[string]IndexEntry, len(onDisk))
+    for rel, actual := range onDisk {
+        if old, ok := indexed[rel]; ok {
+            actual.CreatedAt = old.CreatedAt
+            if old.SHA256 == actual.SHA256 {
+                actual.UpdatedAt = old.UpdatedAt
+            }
+        }
+        repaired[rel] = actual
+    }
+    indexReplace(ctx, repaired)
+    logInfo(ctx, fmt.Sprintf("fsck repaired index: %d entries, %d issues", len(repaired), len(issues)))
+}
+
+// -------------------------------------------------------
+// func strayTempFiles() ([]string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Find *.tmp-* files left in the metadata directory.
+// -------------------------------------------------------
+func strayTempFiles(ctx context.Context) ([]string, error) {
+    strays := []string{}
+    store := serverFrom(ctx).Storage
+    root := metaPath(ctx)
+    if _, err := store.Lstat(root); os.IsNotExist(err) {
+        return strays, nil
+    }
+    err := store.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.Mode().IsRegular() && strings.Contains(info.Name(), ".tmp-") {
+            strays = append(strays, path)
+        }
+        return nil
+    })
+    return strays, err
+}
+
+// -------------------------------------------------------
+// func HandleFsck(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: report inconsistencies. POST ?repair=1: report and repair.
+// Audit:
+//   - Repairs write an "admin.fsck_repair" audit event with counts.
+// -------------------------------------------------------
+func HandleFsck(w http.ResponseWriter, r *http.Request) {
+    repair := false
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        repair = r.URL.Query().Get("repair") == "1"
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    report, err := RunFsck(r.Context(), repair)
+    if err != nil {
+        writeStorageError(w, r, err, "run fsck", "Internal server error")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("fsck: %d files on disk, %d index entries, %d issues (repair=%t)",
+        report.FilesOnDisk, report.IndexEntries, len(report.Issues), repair))
+    if repair {
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "admin.fsck_repair",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Detail:   fmt.Sprintf("%d issues repaired", len(report.Issues)),
+        })
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
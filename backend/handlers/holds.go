@@ -0,0 +1,316 @@
+// -------------------------------------------------------
+// backend/handlers/holds.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Legal hold: a note or folder under hold cannot be deleted,
+//     moved, purged from the trash, or archived by expiry rules until
+//     an admin releases it.
+//       GET  /admin/holds                    all holds
+//       POST /admin/holds {path, reason}     place a hold
+//       POST /admin/holds/release {path}     lift a hold
+// Audit:
+//   - A hold covers its path and everything below it; deleting a
+//     folder that contains a held note is refused as well.
+//   - Trashed items stay in the trash past their retention while a
+//     hold covers their original path.
+//   - Holds are kept in .scratchpad/holds.json. Placing and lifting
+//     write "hold.place" and "hold.release"; each refused change
+//     writes "hold.blocked".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const holdsFile = "holds.json"
+
+// holdsMu guards holds.json.
+var holdsMu sync.Mutex
+
+// -------------------------------------------------------
+// type Hold
+// -------------------------------------------------------
+// Purpose:
+//   - One legal hold on a note or folder (relative path).
+// -------------------------------------------------------
+type Hold struct {
+    Path     string `json:"path"`
+    Reason   string `json:"reason"`
+    PlacedBy string `json:"placed_by"`
+    PlacedAt string `json:"placed_at"`
+}
+
+// loadHoldsLocked reads holds.json (path -> hold). Caller holds holdsMu.
+func loadHoldsLocked(ctx context.Context) (map[string]Hold, error) {
+    holds := map[string]Hold{}
+    if err := loadMetaJSON(ctx, holdsFile, &holds); err != nil {
+        return nil, err
+    }
+    if holds == nil {
+        holds = map[string]Hold{}
+    }
+    return holds, nil
+}
+
+// -------------------------------------------------------
+// func holdsCovering(ctx context.Context, rel string) ([]Hold, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Holds on rel, on a folder containing rel, or on anything
+//     inside rel, sorted by path.
+// Audit:
+//   - Callers treat an error as held: a hold that cannot be read
+//     must not let a deletion through.
+// -------------------------------------------------------
+func holdsCovering(ctx context.Context, rel string) ([]Hold, error) {
+    holdsMu.Lock()
+    holds, err := loadHoldsLocked(ctx)
+    holdsMu.Unlock()
+    if err != nil {
+        return nil, err
+    }
+    found := []Hold{}
+    for held, hold := range holds {
+        if held == rel || strings.HasPrefix(rel, held+"/") || strings.HasPrefix(held, rel+"/") {
+            found = append(found, hold)
+        }
+    }
+    sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+    return found, nil
+}
+
+// isHeld reports whether rel is covered by a hold (true on error).
+func isHeld(ctx context.Context, rel string) bool {
+    holds, err := holdsCovering(ctx, rel)
+    if err != nil {
+        logError(ctx, "Failed to load legal holds: "+err.Error())
+        return true
+    }
+    return len(holds) > 0
+}
+
+// -------------------------------------------------------
+// func rejectIfHeld(w, r, absPath) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Write 423 legal_hold and return true if absPath is covered by
+//     a hold. Used by delete and move.
+// -------------------------------------------------------
+func rejectIfHeld(w http.ResponseWriter, r *http.Request, absPath string) bool {
+    rel := relativeTo(r.Context(), absPath)
+    holds, err := holdsCovering(r.Context(), rel)
+    if err != nil {
+        writeStorageError(w, r, err, "load legal holds", "Internal error")
+        return true
+    }
+    if len(holds) == 0 {
+        return false
+    }
+    reason := "under legal hold"
+    if holds[0].Path != rel {
+        reason = "covered by the legal hold on " + holds[0].Path
+    }
+    logError(r.Context(), "Rejected change to held path "+rel+" ("+reason+")")
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "hold.blocked",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusLocked,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail:   reason,
+    })
+    apierror.Write(w, r, apierror.CodeLegalHold, "path", "Path is "+reason+" until an admin releases it")
+    return true
+}
+
+// -------------------------------------------------------
+// func holdTargetExists(r, absPath) (bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a hold on absPath covers anything: a live note or
+//     folder, an archived folder, or an item in the trash.
+// -------------------------------------------------------
+func holdTargetExists(r *http.Request, absPath string) (bool, error) {
+    rel := relativeTo(r.Context(), absPath)
+    if _, err := statPath(r.Context(), absPath); err == nil {
+        return true, nil
+    }
+    if _, _, ok := archivedFolderFor(r.Context(), rel); ok {
+        return true, nil
+    }
+    items, err := listTrash(r.Context())
+    if err != nil {
+        return false, err
+    }
+    for _, item := range items {
+        if item.Path == rel || strings.HasPrefix(rel, item.Path+"/") || strings.HasPrefix(item.Path, rel+"/") {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// -------------------------------------------------------
+// func HandleHolds(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/holds: holds sorted by path.
+//   - POST /admin/holds {"path", "reason"}: place a hold (201);
+//     re-placing an existing hold answers 409.
+// -------------------------------------------------------
+func HandleHolds(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        holdsMu.Lock()
+        holds, err := loadHoldsLocked(r.Context())
+        holdsMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load legal holds", "Internal error")
+            return
+        }
+        list := make([]Hold, 0, len(holds))
+        for _, hold := range holds {
+            list = append(list, hold)
+        }
+        sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(list)
+        return
+    case http.MethodPost:
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        Path   string `json:"path"`
+        Reason string `json:"reason"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) || !requireField(w, r, "reason", strings.TrimSpace(req.Reason)) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid path")
+        return
+    }
+    exists, err := holdTargetExists(r, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "check hold target "+absPath, "Internal error")
+        return
+    }
+    if !exists {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "No note, folder, archive, or trash item at this path")
+        return
+    }
+
+    hold := Hold{
+        Path:     relativeTo(r.Context(), absPath),
+        Reason:   strings.TrimSpace(req.Reason),
+        PlacedBy: defaultString(actorName(r.Context()), "admin"),
+        PlacedAt: utcNow(r.Context()),
+    }
+    holdsMu.Lock()
+    defer holdsMu.Unlock()
+    holds, err := loadHoldsLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load legal holds", "Internal error")
+        return
+    }
+    if _, ok := holds[hold.Path]; ok {
+        apierror.Write(w, r, apierror.CodeConflict, "path", "Path is already under legal hold")
+        return
+    }
+    holds[hold.Path] = hold
+    if err := saveMetaJSON(r.Context(), holdsFile, holds); err != nil {
+        writeStorageError(w, r, err, "save legal holds", "Hold failed")
+        return
+    }
+
+    logInfo(r.Context(), "Placed legal hold on "+hold.Path)
+    auditHold(r, "hold.place", http.StatusCreated, hold)
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(hold)
+}
+
+// -------------------------------------------------------
+// func HandleHoldRelease(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/holds/release {"path", "reason"}: lift the hold on
+//     exactly path; 404 if there is none.
+// Audit:
+//   - Holds on parent or child paths are left in place.
+// -------------------------------------------------------
+func HandleHoldRelease(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Path   string `json:"path"`
+        Reason string `json:"reason"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid path")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    holdsMu.Lock()
+    defer holdsMu.Unlock()
+    holds, err := loadHoldsLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load legal holds", "Internal error")
+        return
+    }
+    hold, ok := holds[rel]
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "No legal hold on this path")
+        return
+    }
+    delete(holds, rel)
+    if err := saveMetaJSON(r.Context(), holdsFile, holds); err != nil {
+        writeStorageError(w, r, err, "save legal holds", "Release failed")
+        return
+    }
+
+    logInfo(r.Context(), "Released legal hold on "+rel)
+    hold.Reason = defaultString(strings.TrimSpace(req.Reason), hold.Reason)
+    auditHold(r, "hold.release", http.StatusOK, hold)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// auditHold records placing or lifting a hold.
+func auditHold(r *http.Request, event string, status int, hold Hold) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    defaultString(actorName(r.Context()), "admin"),
+        Target:   hold.Path,
+        Detail:   fmt.Sprintf("reason=%q placed_by=%s placed_at=%s", hold.Reason, hold.PlacedBy, hold.PlacedAt),
+    })
+}
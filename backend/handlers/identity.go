@@ -0,0 +1,46 @@
+// -------------------------------------------------------
+// backend/handlers/identity.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Helpers for handlers that act on behalf of the calling user
+//     (set by the user middleware in main, see auth package).
+// Audit:
+//   - Identity-bound actions answer 401 for anonymous callers.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "net/http"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/auth"
+)
+
+// -------------------------------------------------------
+// func requireUser(w, r) (auth.User, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The authenticated caller, or a 401 response if there is none.
+// -------------------------------------------------------
+func requireUser(w http.ResponseWriter, r *http.Request) (auth.User, bool) {
+    user, ok := auth.FromContext(r.Context())
+    if !ok {
+        w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+        apierror.Write(w, r, apierror.CodeUnauthorized, "", "Unauthorized: this action requires a user token")
+        return auth.User{}, false
+    }
+    return user, true
+}
+
+// -------------------------------------------------------
+// func actorName(ctx context.Context) string
+// -------------------------------------------------------
+// Purpose:
+//   - Name of the authenticated caller, or "" when anonymous.
+// -------------------------------------------------------
+func actorName(ctx context.Context) string {
+    user, _ := auth.FromContext(ctx)
+    return user.Name
+}
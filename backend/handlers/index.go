@@ -0,0 +1,474 @@
+// -------------------------------------------------------
+// backend/handlers/index.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Metadata index of every note: size, SHA-256, and timestamps.
+//   - Daily usage history derived from the index for growth reports.
+// Audit:
+//   - Persisted to .scratchpad/index.json and
+//     .scratchpad/usage_history.json after every change.
+//   - Updated by save and move; the filesystem remains the source of
+//     truth and the index can be rebuilt from it at any time.
+//   - Index failures are logged but never fail the user's request.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+)
+
+const (
+    indexFile        = "index.json"
+    usageHistoryFile = "usage_history.json"
+    // maxUsageHistoryDays bounds the stored daily snapshots.
+    maxUsageHistoryDays = 400
+)
+
+// -------------------------------------------------------
+// type IndexEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Indexed facts about one note, keyed by relative path.
+// Audit:
+//   - Tags are the hashtags at the last journaled save, so the
+//     journal can record tag changes (journal.go).
+//   - Language is the detected language of the content
+//     (language.go); overrides are kept apart.
+//   - Attributes come from index processors (processors.go).
+//   - Frontmatter holds the parsed YAML header (frontmatter.go),
+//     Tasks the checklist items (tasks.go).
+// -------------------------------------------------------
+type IndexEntry struct {
+    Size        int64             `json:"size"`
+    SHA256      string            `json:"sha256"`
+    CreatedAt   string            `json:"created_at"`
+    UpdatedAt   string            `json:"updated_at"`
+    Tags        []string          `json:"tags,omitempty"`
+    Language    string            `json:"language,omitempty"`
+    Attributes  map[string]string `json:"attributes,omitempty"`
+    Frontmatter *Frontmatter      `json:"frontmatter,omitempty"`
+    Tasks       []NoteTask        `json:"tasks"`
+}
+
+// -------------------------------------------------------
+// type UsageSnapshot
+// -------------------------------------------------------
+// Purpose:
+//   - Totals for one UTC day, overall and per folder.
+// -------------------------------------------------------
+type UsageSnapshot struct {
+    Date    string           `json:"date"`
+    Files   int              `json:"files"`
+    Bytes   int64            `json:"bytes"`
+    Folders map[string]int64 `json:"folders"`
+}
+
+var (
+    indexMu     sync.Mutex
+    indexLoaded bool
+    indexData   = map[string]IndexEntry{}
+)
+
+// -------------------------------------------------------
+// func contentHash(data []byte) string
+// -------------------------------------------------------
+// Purpose:
+//   - Hex SHA-256 used for index entries and reports.
+// -------------------------------------------------------
+func contentHash(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// -------------------------------------------------------
+// func ensureIndexLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Load the index from disk on first use. Caller holds indexMu.
+// Audit:
+//   - When no index exists yet (first run, or an existing data
+//     directory), it is built from the filesystem and persisted.
+// -------------------------------------------------------
+func ensureIndexLocked(ctx context.Context) {
+    if indexLoaded {
+        return
+    }
+    indexLoaded = true
+
+    if _, err := serverFrom(ctx).Storage.Lstat(metaPath(ctx, indexFile)); os.IsNotExist(err) {
+        built, buildErr := buildIndexFromDisk(context.WithoutCancel(ctx))
+        if buildErr != nil {
+            logError(ctx, "Failed to build index from disk: "+buildErr.Error())
+            return
+        }
+        indexData = built
+        logInfo(ctx, fmt.Sprintf("Built metadata index from disk: %d notes", len(built)))
+        persistIndexLocked(ctx)
+        return
+    }
+
+    loaded := map[string]IndexEntry{}
+    if err := loadMetaJSON(ctx, indexFile, &loaded); err != nil {
+        logError(ctx, "Failed to load index; starting empty: "+err.Error())
+    }
+    indexData = loaded
+}
+
+// -------------------------------------------------------
+// func buildIndexFromDisk(ctx) (map[string]IndexEntry, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Compute index entries for every note currently on disk.
+// Audit:
+//   - Timestamps are taken from file modification times.
+// -------------------------------------------------------
+func buildIndexFromDisk(ctx context.Context) (map[string]IndexEntry, error) {
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return nil, err
+    }
+    built := make(map[string]IndexEntry, len(notes))
+    for _, note := range notes {
+        data, readErr := readFile(ctx, note.Abs)
+        if readErr != nil {
+            return nil, readErr
+        }
+        stamp := note.ModTime.Format("2006-01-02T15:04:05Z")
+        built[note.Rel] = IndexEntry{
+            Size:        int64(len(data)),
+            SHA256:      contentHash(data),
+            CreatedAt:   stamp,
+            UpdatedAt:   stamp,
+            Tags:        noteTags(data),
+            Language:    detectLanguage(data),
+            Frontmatter: parseFrontmatter(data),
+            Tasks:       parseTasks(data),
+        }
+    }
+    return built, nil
+}
+
+// -------------------------------------------------------
+// func persistIndexLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Save the index and today's usage snapshot. Caller holds indexMu.
+// -------------------------------------------------------
+func persistIndexLocked(ctx context.Context) {
+    if err := saveMetaJSON(ctx, indexFile, indexData); err != nil {
+        logError(ctx, "Failed to persist index: "+err.Error())
+        return
+    }
+    recordUsageSnapshotLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexUpdate(ctx context.Context, rel string, data []byte)
+// -------------------------------------------------------
+// Purpose:
+//   - Record the current content of a note after a save.
+// -------------------------------------------------------
+func indexUpdate(ctx context.Context, rel string, data []byte) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    now := utcNow(ctx)
+    entry := indexData[rel]
+    if entry.CreatedAt == "" {
+        entry.CreatedAt = now
+    }
+    entry.Size = int64(len(data))
+    entry.SHA256 = contentHash(data)
+    entry.UpdatedAt = now
+    entry.Language = detectLanguage(data)
+    entry.Frontmatter = parseFrontmatter(data)
+    entry.Tasks = parseTasks(data)
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexSetTags(ctx context.Context, rel string, tags []string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Store a note's hashtags; reports whether they changed.
+// Audit:
+//   - Notes not in the index are left alone (false).
+// -------------------------------------------------------
+func indexSetTags(ctx context.Context, rel string, tags []string) bool {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[rel]
+    if !ok || strings.Join(entry.Tags, "\n") == strings.Join(tags, "\n") {
+        return false
+    }
+    entry.Tags = tags
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+    return true
+}
+
+// -------------------------------------------------------
+// func indexSetLanguage(ctx context.Context, rel, lang string)
+// -------------------------------------------------------
+// Purpose:
+//   - Store the detected language of a note indexed without one.
+// -------------------------------------------------------
+func indexSetLanguage(ctx context.Context, rel, lang string) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[rel]
+    if !ok || entry.Language == lang {
+        return
+    }
+    entry.Language = lang
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexSetFrontmatter(ctx context.Context, rel string, fm *Frontmatter)
+// -------------------------------------------------------
+// Purpose:
+//   - Store the frontmatter of a note indexed without it.
+// -------------------------------------------------------
+func indexSetFrontmatter(ctx context.Context, rel string, fm *Frontmatter) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[rel]
+    if !ok {
+        return
+    }
+    entry.Frontmatter = fm
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexSetTasks(ctx context.Context, rel string, tasks []NoteTask)
+// -------------------------------------------------------
+// Purpose:
+//   - Store the tasks of a note indexed without them.
+// -------------------------------------------------------
+func indexSetTasks(ctx context.Context, rel string, tasks []NoteTask) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[rel]
+    if !ok {
+        return
+    }
+    entry.Tasks = tasks
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexSetAttributes(ctx context.Context, rel string, attributes map[string]string)
+// -------------------------------------------------------
+// Purpose:
+//   - Store the attributes index processors gave a note (nil clears).
+// -------------------------------------------------------
+func indexSetAttributes(ctx context.Context, rel string, attributes map[string]string) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[rel]
+    if !ok {
+        return
+    }
+    entry.Attributes = attributes
+    indexData[rel] = entry
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexRename(ctx context.Context, from, to string) IndexEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Move an index entry after a file move; returns the entry
+//     (zero value if from was not indexed).
+// -------------------------------------------------------
+func indexRename(ctx context.Context, from, to string) IndexEntry {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    entry, ok := indexData[from]
+    if !ok {
+        return entry
+    }
+    delete(indexData, from)
+    entry.UpdatedAt = utcNow(ctx)
+    indexData[to] = entry
+    persistIndexLocked(ctx)
+    return entry
+}
+
+// -------------------------------------------------------
+// func indexDetach(ctx context.Context, prefix string) map[string]IndexEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Remove the entry for prefix, or every entry under the folder
+//     prefix, and return them keyed relative to prefix.
+// Audit:
+//   - A single file is returned under the key ".".
+// -------------------------------------------------------
+func indexDetach(ctx context.Context, prefix string) map[string]IndexEntry {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    detached := map[string]IndexEntry{}
+    for rel, entry := range indexData {
+        switch {
+        case rel == prefix:
+            detached["."] = entry
+        case strings.HasPrefix(rel, prefix+"/"):
+            detached[strings.TrimPrefix(rel, prefix+"/")] = entry
+        default:
+            continue
+        }
+        delete(indexData, rel)
+    }
+    if len(detached) > 0 {
+        persistIndexLocked(ctx)
+    }
+    return detached
+}
+
+// -------------------------------------------------------
+// func indexAttach(ctx context.Context, prefix string, entries map[string]IndexEntry)
+// -------------------------------------------------------
+// Purpose:
+//   - Inverse of indexDetach: re-insert entries below prefix.
+// -------------------------------------------------------
+func indexAttach(ctx context.Context, prefix string, entries map[string]IndexEntry) {
+    if len(entries) == 0 {
+        return
+    }
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    for rel, entry := range entries {
+        if rel == "." {
+            indexData[prefix] = entry
+        } else {
+            indexData[prefix+"/"+rel] = entry
+        }
+    }
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func indexSnapshot() map[string]IndexEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Copy of the full index for read-only use.
+// -------------------------------------------------------
+func indexSnapshot(ctx context.Context) map[string]IndexEntry {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+    ensureIndexLocked(ctx)
+
+    out := make(map[string]IndexEntry, len(indexData))
+    for k, v := range indexData {
+        out[k] = v
+    }
+    return out
+}
+
+// -------------------------------------------------------
+// func indexReplace(ctx context.Context, entries map[string]IndexEntry)
+// -------------------------------------------------------
+// Purpose:
+//   - Replace the whole index (used by fsck repair) and persist it.
+// -------------------------------------------------------
+func indexReplace(ctx context.Context, entries map[string]IndexEntry) {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+
+    indexData = entries
+    indexLoaded = true
+    persistIndexLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func folderOf(rel string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Folder a note belongs to (its parent directory, "." for root).
+// -------------------------------------------------------
+func folderOf(rel string) string {
+    return path.Dir(rel)
+}
+
+// -------------------------------------------------------
+// func recordUsageSnapshotLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Upsert today's usage totals into the usage history.
+// Audit:
+//   - One snapshot per UTC day; oldest entries are trimmed.
+// -------------------------------------------------------
+func recordUsageSnapshotLocked(ctx context.Context) {
+    snap := UsageSnapshot{Date: timeNow(ctx).UTC().Format("2006-01-02"), Folders: map[string]int64{}}
+    for rel, entry := range indexData {
+        snap.Files++
+        snap.Bytes += entry.Size
+        snap.Folders[folderOf(rel)] += entry.Size
+    }
+
+    history := []UsageSnapshot{}
+    if err := loadMetaJSON(ctx, usageHistoryFile, &history); err != nil {
+        logError(ctx, "Failed to load usage history: "+err.Error())
+    }
+    if n := len(history); n > 0 && history[n-1].Date == snap.Date {
+        history[n-1] = snap
+    } else {
+        history = append(history, snap)
+    }
+    sort.Slice(history, func(a, b int) bool { return history[a].Date < history[b].Date })
+    if len(history) > maxUsageHistoryDays {
+        history = history[len(history)-maxUsageHistoryDays:]
+    }
+    if err := saveMetaJSON(ctx, usageHistoryFile, history); err != nil {
+        logError(ctx, "Failed to persist usage history: "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func usageHistory() []UsageSnapshot
+// -------------------------------------------------------
+// Purpose:
+//   - Read the stored daily usage history (oldest first).
+// -------------------------------------------------------
+func usageHistory(ctx context.Context) []UsageSnapshot {
+    indexMu.Lock()
+    defer indexMu.Unlock()
+
+    history := []UsageSnapshot{}
+    if err := loadMetaJSON(ctx, usageHistoryFile, &history); err != nil {
+        logError(ctx, "Failed to load usage history: "+err.Error())
+    }
+    return history
+}
@@ -0,0 +1,526 @@
+// -------------------------------------------------------
+// backend/handlers/jobs.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Background jobs for long-running maintenance (backup, fsck,
+//     trash purge, compaction, link check, OCR): a queue, a fixed
+//     worker pool, and job state persisted in .scratchpad/jobs.json.
+//   - /admin/jobs to submit, list and inspect jobs and
+//     /admin/jobs/cancel to cancel one.
+// Audit:
+//   - Every state change writes a "job.<status>" audit event
+//     (job.queued, job.running, job.succeeded, job.failed,
+//     job.canceled) with the job id as target; a cancel request
+//     is recorded as "job.cancel".
+//   - Jobs run with a detached context (maxJobDuration), so they
+//     outlive the request that submitted them.
+//   - After a restart, queued jobs are queued again; jobs that
+//     were running are marked failed ("interrupted by restart").
+//   - Finished jobs beyond maxJobHistory are dropped, oldest first.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    jobQueued    = "queued"
+    jobRunning   = "running"
+    jobSucceeded = "succeeded"
+    jobFailed    = "failed"
+    jobCanceled  = "canceled"
+
+    jobsFile       = "jobs.json"
+    maxJobHistory  = 200
+    maxQueuedJobs  = 100
+    maxJobDuration = time.Hour
+)
+
+// -------------------------------------------------------
+// type Job
+// -------------------------------------------------------
+// Purpose:
+//   - One unit of background work and its lifecycle.
+// Audit:
+//   - Result is kind-specific (e.g. BackupResult, FsckReport) and
+//     only set on success; Error only on failure.
+// -------------------------------------------------------
+type Job struct {
+    ID         string            `json:"id"`
+    Kind       string            `json:"kind"`
+    Params     map[string]string `json:"params"`
+    Status     string            `json:"status"`
+    CreatedBy  string            `json:"created_by,omitempty"`
+    CreatedAt  string            `json:"created_at"`
+    StartedAt  string            `json:"started_at,omitempty"`
+    FinishedAt string            `json:"finished_at,omitempty"`
+    Error      string            `json:"error,omitempty"`
+    Result     interface{}       `json:"result,omitempty"`
+}
+
+// finished reports whether the job has reached a final state.
+func (job *Job) finished() bool {
+    return job.Status == jobSucceeded || job.Status == jobFailed || job.Status == jobCanceled
+}
+
+// -------------------------------------------------------
+// type jobKind
+// -------------------------------------------------------
+// Purpose:
+//   - What a job kind runs and which params it accepts.
+// -------------------------------------------------------
+type jobKind struct {
+    params []string
+    run    func(ctx context.Context, params map[string]string) (interface{}, error)
+}
+
+// jobKinds lists the job kinds that can be submitted.
+var jobKinds = map[string]jobKind{
+    "backup": {
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            return CreateBackup(ctx, currentConfig(ctx).BackupDir)
+        },
+    },
+    "fsck": {
+        params: []string{"repair"},
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            repair, _ := strconv.ParseBool(params["repair"])
+            return RunFsck(ctx, repair)
+        },
+    },
+    "trash_purge": {
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            return PurgeExpiredTrash(ctx)
+        },
+    },
+    "compact": {
+        params: []string{"dry_run"},
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            dryRun, _ := strconv.ParseBool(params["dry_run"])
+            return RunCompaction(ctx, dryRun)
+        },
+    },
+    "link_check": {
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            report, err := checkLinks(ctx)
+            if err != nil {
+                return nil, err
+            }
+            return report, saveMetaJSON(ctx, linkReportFile, report)
+        },
+    },
+    "ocr": {
+        params: []string{"path", "force"},
+        run: func(ctx context.Context, params map[string]string) (interface{}, error) {
+            force, _ := strconv.ParseBool(params["force"])
+            return RunOCR(ctx, params["path"], force)
+        },
+    },
+}
+
+var (
+    jobsMu     sync.Mutex
+    jobList    []*Job // oldest first
+    jobQueue   = make(chan string, maxQueuedJobs)
+    jobCancels = map[string]context.CancelFunc{}
+)
+
+// -------------------------------------------------------
+// func saveJobsLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Trim the history and persist every job. Caller holds jobsMu.
+// Audit:
+//   - A write failure is logged; the in-memory state stays
+//     authoritative until the next save.
+// -------------------------------------------------------
+func saveJobsLocked(ctx context.Context) {
+    finished := 0
+    for _, job := range jobList {
+        if job.finished() {
+            finished++
+        }
+    }
+    kept := jobList[:0]
+    for _, job := range jobList {
+        if job.finished() && finished > maxJobHistory {
+            finished--
+            continue
+        }
+        kept = append(kept, job)
+    }
+    jobList = kept
+
+    if err := saveMetaJSON(ctx, jobsFile, map[string]interface{}{"jobs": jobList}); err != nil {
+        logError(ctx, "Failed to save job state: "+err.Error())
+    }
+}
+
+// findJobLocked returns the job with id, or nil. Caller holds jobsMu.
+func findJobLocked(id string) *Job {
+    for _, job := range jobList {
+        if job.ID == id {
+            return job
+        }
+    }
+    return nil
+}
+
+// auditJob writes the job.<status> event for a background transition.
+func auditJob(job *Job) {
+    audit.Write(audit.Event{
+        Event:  "job." + job.Status,
+        Method: "JOB",
+        Path:   "/admin/jobs",
+        Actor:  job.CreatedBy,
+        Target: job.ID,
+        Detail: strings.TrimSpace("kind=" + job.Kind + " " + job.Error),
+    })
+}
+
+// -------------------------------------------------------
+// func StartJobs(ctx context.Context, workers int)
+// -------------------------------------------------------
+// Purpose:
+//   - Load persisted jobs and start the worker pool.
+// Audit:
+//   - Call once at startup, after Install.
+// -------------------------------------------------------
+func StartJobs(ctx context.Context, workers int) {
+    var state struct {
+        Jobs []*Job `json:"jobs"`
+    }
+    if err := loadMetaJSON(ctx, jobsFile, &state); err != nil {
+        logError(ctx, "Failed to load job state: "+err.Error())
+    }
+
+    jobsMu.Lock()
+    jobList = state.Jobs
+    requeued := 0
+    for _, job := range jobList {
+        switch job.Status {
+        case jobRunning:
+            job.Status = jobFailed
+            job.Error = "interrupted by restart"
+            job.FinishedAt = utcNow(ctx)
+            auditJob(job)
+        case jobQueued:
+            if requeued < maxQueuedJobs {
+                jobQueue <- job.ID
+                requeued++
+                continue
+            }
+            job.Status = jobFailed
+            job.Error = "queue full after restart"
+            job.FinishedAt = utcNow(ctx)
+            auditJob(job)
+        }
+    }
+    saveJobsLocked(ctx)
+    jobsMu.Unlock()
+
+    for i := 0; i < workers; i++ {
+        go runJobWorker(ctx)
+    }
+    logInfo(ctx, fmt.Sprintf("Job workers started: %d (%d jobs requeued)", workers, requeued))
+}
+
+// runJobWorker runs queued jobs, one at a time, for the life of the process.
+func runJobWorker(ctx context.Context) {
+    for id := range jobQueue {
+        runJob(ctx, id)
+    }
+}
+
+// -------------------------------------------------------
+// func runJob(ctx context.Context, id string)
+// -------------------------------------------------------
+// Purpose:
+//   - Run one queued job to completion and record the outcome.
+// Audit:
+//   - A job canceled while queued is skipped.
+//   - A panic in the job marks it failed instead of killing the
+//     worker.
+// -------------------------------------------------------
+func runJob(ctx context.Context, id string) {
+    jobsMu.Lock()
+    job := findJobLocked(id)
+    if job == nil || job.Status != jobQueued {
+        jobsMu.Unlock()
+        return
+    }
+    ctx, cancel := context.WithTimeout(ctx, maxJobDuration)
+    defer cancel()
+    jobCancels[id] = cancel
+    job.Status = jobRunning
+    job.StartedAt = utcNow(ctx)
+    kind, params := jobKinds[job.Kind], job.Params
+    saveJobsLocked(ctx)
+    auditJob(job)
+    jobsMu.Unlock()
+
+    var result interface{}
+    err := func() (err error) {
+        defer func() {
+            if recovered := recover(); recovered != nil {
+                err = fmt.Errorf("panic: %v", recovered)
+            }
+        }()
+        result, err = kind.run(ctx, params)
+        return err
+    }()
+
+    jobsMu.Lock()
+    defer jobsMu.Unlock()
+    delete(jobCancels, id)
+    job.FinishedAt = utcNow(ctx)
+    switch {
+    case errors.Is(err, context.Canceled):
+        job.Status = jobCanceled
+    case errors.Is(err, context.DeadlineExceeded):
+        job.Status = jobFailed
+        job.Error = "exceeded " + maxJobDuration.String()
+    case err != nil:
+        job.Status = jobFailed
+        job.Error = err.Error()
+    default:
+        job.Status = jobSucceeded
+        job.Result = result
+    }
+    logInfo(ctx, fmt.Sprintf("Job %s (%s) %s", job.ID, job.Kind, job.Status))
+    saveJobsLocked(ctx)
+    auditJob(job)
+}
+
+// -------------------------------------------------------
+// func validateJobParams(kind jobKind, params map[string]string) error
+// -------------------------------------------------------
+// Purpose:
+//   - Reject params the kind does not know, and bad values.
+// -------------------------------------------------------
+func validateJobParams(kind jobKind, params map[string]string) error {
+    for name, value := range params {
+        if !oneOf(name, kind.params) {
+            return invalidField("params", "has unknown key %q", name)
+        }
+        if name == "repair" || name == "force" {
+            if _, err := strconv.ParseBool(value); err != nil {
+                return invalidField("params."+name, "must be true or false")
+            }
+        }
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func HandleJobs(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/jobs[?status=&kind=]: jobs, newest first.
+//   - GET /admin/jobs?id=...: one job.
+//   - POST /admin/jobs {"kind", "params"}: queue a job (202).
+// Audit:
+//   - A full queue answers 503 unavailable.
+// -------------------------------------------------------
+func HandleJobs(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        handleListJobs(w, r)
+    case http.MethodPost:
+        handleSubmitJob(w, r)
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// handleListJobs serves GET /admin/jobs.
+func handleListJobs(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    jobsMu.Lock()
+    defer jobsMu.Unlock()
+
+    if id := query.Get("id"); id != "" {
+        job := findJobLocked(id)
+        if job == nil {
+            apierror.Write(w, r, apierror.CodeNotFound, "id", "Job not found")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(job)
+        return
+    }
+
+    list := []*Job{}
+    for _, job := range jobList {
+        if s := query.Get("status"); s != "" && job.Status != s {
+            continue
+        }
+        if k := query.Get("kind"); k != "" && job.Kind != k {
+            continue
+        }
+        list = append(list, job)
+    }
+    sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"jobs": list})
+}
+
+// errJobQueueFull is returned by enqueueJob when maxQueuedJobs
+// jobs are already waiting.
+var errJobQueueFull = errors.New("job queue is full")
+
+// -------------------------------------------------------
+// func enqueueJob(ctx, kind, params, actor) (*Job, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Record and queue a job of a known kind with validated params.
+// Audit:
+//   - Used by /admin/jobs and by handlers that start work in the
+//     background (raw uploads queue "ocr"); the caller writes the
+//     job.queued audit event.
+// -------------------------------------------------------
+func enqueueJob(ctx context.Context, kind string, params map[string]string, actor string) (*Job, error) {
+    job := &Job{
+        ID:        newStampID(ctx),
+        Kind:      kind,
+        Params:    params,
+        Status:    jobQueued,
+        CreatedBy: actor,
+        CreatedAt: utcNow(ctx),
+    }
+    jobsMu.Lock()
+    defer jobsMu.Unlock()
+    select {
+    case jobQueue <- job.ID:
+    default:
+        logError(ctx, "Job queue full, rejected "+kind)
+        return nil, errJobQueueFull
+    }
+    jobList = append(jobList, job)
+    saveJobsLocked(ctx)
+    logInfo(ctx, "Job queued: "+job.ID+" ("+job.Kind+")")
+    return job, nil
+}
+
+// handleSubmitJob serves POST /admin/jobs.
+func handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Kind   string            `json:"kind"`
+        Params map[string]string `json:"params"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "kind", req.Kind) {
+        return
+    }
+    kind, ok := jobKinds[req.Kind]
+    if !ok {
+        names := make([]string, 0, len(jobKinds))
+        for name := range jobKinds {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        writeFieldError(w, r, invalidField("kind", "must be one of %s", strings.Join(names, ", ")))
+        return
+    }
+    if req.Params == nil {
+        req.Params = map[string]string{}
+    }
+    if err := validateJobParams(kind, req.Params); err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    job, err := enqueueJob(r.Context(), req.Kind, req.Params, actorName(r.Context()))
+    if err != nil {
+        apierror.Write(w, r, apierror.CodeUnavailable, "", "Job queue is full")
+        return
+    }
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "job.queued",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusAccepted,
+        Actor:    job.CreatedBy,
+        Target:   job.ID,
+        Detail:   "kind=" + job.Kind,
+    })
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(job)
+}
+
+// -------------------------------------------------------
+// func HandleJobCancel(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/jobs/cancel {"id"}: cancel a queued or running job.
+// Audit:
+//   - A queued job is canceled at once; a running job's context is
+//     canceled and it becomes "canceled" when its work returns.
+//   - A finished job answers 409 conflict.
+// -------------------------------------------------------
+func HandleJobCancel(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        ID string `json:"id"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "id", req.ID) {
+        return
+    }
+
+    jobsMu.Lock()
+    job := findJobLocked(req.ID)
+    if job == nil {
+        jobsMu.Unlock()
+        apierror.Write(w, r, apierror.CodeNotFound, "id", "Job not found")
+        return
+    }
+    if job.finished() {
+        status := job.Status
+        jobsMu.Unlock()
+        apierror.Write(w, r, apierror.CodeConflict, "id", "Job already "+status)
+        return
+    }
+    if job.Status == jobQueued {
+        job.Status = jobCanceled
+        job.FinishedAt = utcNow(r.Context())
+        saveJobsLocked(r.Context())
+    } else if cancel := jobCancels[job.ID]; cancel != nil {
+        cancel()
+    }
+    snapshot := *job
+    jobsMu.Unlock()
+
+    logInfo(r.Context(), "Job cancel requested: "+snapshot.ID)
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "job.cancel",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   snapshot.ID,
+        Detail:   "kind=" + snapshot.Kind + " status=" + snapshot.Status,
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,344 @@
+// -------------------------------------------------------
+// backend/handlers/journal.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Change journal: one JSON line per mutation (note put, delete,
+//     move, tag change; folder mkdir) in .scratchpad/journal.jsonl,
+//     ordered by a Lamport clock. Served to sync secondaries
+//     (/sync/changes) and to clients (/changes, changes.go).
+//   - Stable instance identity (.scratchpad/instance.json) used as
+//     the origin of locally made changes.
+// Audit:
+//   - Append-only; entries are never rewritten.
+//   - The clock strictly increases in file order, so it doubles as
+//     the sync cursor ("changes since clock N").
+//   - Changes applied from another instance keep their origin, so
+//     an instance never re-imports its own edits.
+//   - Journal failures are logged and never fail the user's request.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bufio"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "os"
+    "strings"
+    "sync"
+)
+
+const (
+    journalFile  = "journal.jsonl"
+    instanceFile = "instance.json"
+    // journalTailSize is how many recent entries stay in memory for
+    // change streams (events.go).
+    journalTailSize = 1024
+)
+
+// Journal operations.
+const (
+    journalPut    = "put"
+    journalDelete = "delete"
+    journalMove   = "move"
+    journalTags   = "tags"
+    journalMkdir  = "mkdir"
+)
+
+// -------------------------------------------------------
+// type JournalEntry
+// -------------------------------------------------------
+// Purpose:
+//   - One recorded change to a note or folder.
+// Audit:
+//   - SHA256/Size describe the content after a put or move.
+//   - From is set for moves only.
+//   - Tags is the note's full hashtag set after a tag change; a
+//     tags entry without it means the last tag was removed.
+//   - Actor is the user who made a local change, when known.
+// -------------------------------------------------------
+type JournalEntry struct {
+    Clock  int64    `json:"clock"`
+    Origin string   `json:"origin"`
+    Op     string   `json:"op"`
+    Path   string   `json:"path"`
+    From   string   `json:"from,omitempty"`
+    Actor  string   `json:"actor,omitempty"`
+    SHA256 string   `json:"sha256,omitempty"`
+    Size   int64    `json:"size,omitempty"`
+    Tags   []string `json:"tags,omitempty"`
+    At     string   `json:"at"`
+}
+
+var (
+    journalMu      sync.Mutex
+    journalLoaded  bool
+    journalClock   int64
+    journalTail    []JournalEntry
+    journalChanged = make(chan struct{})
+    instanceOnce   sync.Once
+    instanceValue  string
+)
+
+// -------------------------------------------------------
+// func InstanceID() string
+// -------------------------------------------------------
+// Purpose:
+//   - This instance's persistent random identifier.
+// Audit:
+//   - Created on first use; if it cannot be persisted a per-process
+//     id is used and the failure logged.
+// -------------------------------------------------------
+func InstanceID(ctx context.Context) string {
+    instanceOnce.Do(func() {
+        var stored struct {
+            ID string `json:"id"`
+        }
+        if err := loadMetaJSON(ctx, instanceFile, &stored); err != nil {
+            logError(ctx, "Failed to load instance id: "+err.Error())
+        }
+        if stored.ID == "" {
+            raw := make([]byte, 8)
+            rand.Read(raw)
+            stored.ID = hex.EncodeToString(raw)
+            if err := saveMetaJSON(ctx, instanceFile, stored); err != nil {
+                logError(ctx, "Failed to persist instance id: "+err.Error())
+            }
+        }
+        instanceValue = stored.ID
+    })
+    return instanceValue
+}
+
+// -------------------------------------------------------
+// func ensureJournalLocked()
+// -------------------------------------------------------
+// Purpose:
+//   - Recover the clock from the last journal line. Caller holds
+//     journalMu.
+// -------------------------------------------------------
+func ensureJournalLocked(ctx context.Context) {
+    if journalLoaded {
+        return
+    }
+    journalLoaded = true
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        logError(ctx, "Failed to read change journal: "+err.Error())
+        return
+    }
+    if n := len(entries); n > 0 {
+        journalClock = entries[n-1].Clock
+    }
+}
+
+// -------------------------------------------------------
+// func journalAppend(ctx context.Context, entry JournalEntry, seen int64) JournalEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Stamp entry with the next Lamport clock and append it.
+// Audit:
+//   - seen is the sender's clock for remote changes (0 for local);
+//     the clock advances to max(local, seen) + 1.
+//   - Origin defaults to this instance.
+//   - A written entry is kept in the in-memory tail and wakes the
+//     change streams waiting in journalWait.
+// -------------------------------------------------------
+func journalAppend(ctx context.Context, entry JournalEntry, seen int64) JournalEntry {
+    if entry.Origin == "" {
+        entry.Origin = InstanceID(ctx)
+    }
+
+    journalMu.Lock()
+    defer journalMu.Unlock()
+    ensureJournalLocked(ctx)
+
+    if seen > journalClock {
+        journalClock = seen
+    }
+    journalClock++
+    entry.Clock = journalClock
+    if entry.At == "" {
+        entry.At = utcNow(ctx)
+    }
+
+    line, err := json.Marshal(entry)
+    if err != nil {
+        logError(ctx, "Failed to encode journal entry: "+err.Error())
+        return entry
+    }
+    store := serverFrom(ctx).Storage
+    if err := store.MkdirAll(metaPath(ctx)); err != nil {
+        logError(ctx, "Failed to create metadata directory: "+err.Error())
+        return entry
+    }
+    if err := store.AppendFile(metaPath(ctx, journalFile), append(line, '\n')); err != nil {
+        logError(ctx, "Failed to append change journal: "+err.Error())
+        return entry
+    }
+    journalTail = append(journalTail, entry)
+    if len(journalTail) > journalTailSize {
+        journalTail = append([]JournalEntry(nil), journalTail[len(journalTail)-journalTailSize:]...)
+    }
+    close(journalChanged)
+    journalChanged = make(chan struct{})
+    return entry
+}
+
+// -------------------------------------------------------
+// func journalPutEntry / journalDeleteEntry / journalMoveEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Record local changes made by the HTTP handlers.
+// Audit:
+//   - Saves also keep their content as a revision (revisions.go).
+//   - A save that changes the note's hashtags is followed by a tags
+//     entry.
+//   - Saves run the configured index processors (processors.go).
+// -------------------------------------------------------
+func journalPutEntry(ctx context.Context, rel string, data []byte) {
+    storeRevision(ctx, data)
+    processIndex(ctx, rel, data)
+    journalAppend(ctx, JournalEntry{Op: journalPut, Path: rel, Actor: actorName(ctx), SHA256: contentHash(data), Size: int64(len(data))}, 0)
+    if tags := noteTags(data); indexSetTags(ctx, rel, tags) {
+        journalAppend(ctx, JournalEntry{Op: journalTags, Path: rel, Actor: actorName(ctx), Tags: tags}, 0)
+    }
+}
+
+func journalDeleteEntry(ctx context.Context, rel string) {
+    journalAppend(ctx, JournalEntry{Op: journalDelete, Path: rel, Actor: actorName(ctx)}, 0)
+}
+
+func journalMoveEntry(ctx context.Context, from, to string, entry IndexEntry) {
+    journalAppend(ctx, JournalEntry{Op: journalMove, Path: to, From: from, Actor: actorName(ctx), SHA256: entry.SHA256, Size: entry.Size}, 0)
+}
+
+func journalMkdirEntry(ctx context.Context, rel string) {
+    journalAppend(ctx, JournalEntry{Op: journalMkdir, Path: rel, Actor: actorName(ctx)}, 0)
+}
+
+// journalNoteContent reports whether entry changed a note's content
+// or path (put, move, delete), as opposed to its tags or a folder.
+func journalNoteContent(entry JournalEntry) bool {
+    return entry.Op == journalPut || entry.Op == journalMove || entry.Op == journalDelete
+}
+
+// -------------------------------------------------------
+// func journalFolderEntries(ctx, op, prefix, entries)
+// -------------------------------------------------------
+// Purpose:
+//   - Journal one put/delete per note for a whole-folder operation
+//     (trash, restore), using index entries keyed relative to prefix.
+// -------------------------------------------------------
+func journalFolderEntries(ctx context.Context, op string, prefix string, entries map[string]IndexEntry) {
+    actor := actorName(ctx)
+    for rel, entry := range entries {
+        full := prefix
+        if rel != "." {
+            full = prefix + "/" + rel
+        }
+        if op == journalPut {
+            journalAppend(ctx, JournalEntry{Op: journalPut, Path: full, Actor: actor, SHA256: entry.SHA256, Size: entry.Size}, 0)
+        } else {
+            journalAppend(ctx, JournalEntry{Op: journalDelete, Path: full, Actor: actor}, 0)
+        }
+    }
+}
+
+// -------------------------------------------------------
+// func readJournal(ctx context.Context, since int64, limit int) ([]JournalEntry, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Entries with Clock > since, oldest first; limit 0 = all.
+// Audit:
+//   - Unparseable lines (e.g. a torn final write) are skipped.
+// -------------------------------------------------------
+func readJournal(ctx context.Context, since int64, limit int) ([]JournalEntry, error) {
+    entries := []JournalEntry{}
+    f, err := serverFrom(ctx).Storage.Open(metaPath(ctx, journalFile))
+    if os.IsNotExist(err) {
+        return entries, nil
+    }
+    if err != nil {
+        return entries, err
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" {
+            continue
+        }
+        var entry JournalEntry
+        if json.Unmarshal([]byte(line), &entry) != nil {
+            continue
+        }
+        if entry.Clock <= since {
+            continue
+        }
+        entries = append(entries, entry)
+        if limit > 0 && len(entries) >= limit {
+            break
+        }
+    }
+    return entries, scanner.Err()
+}
+
+// -------------------------------------------------------
+// func journalSince(ctx context.Context, since int64, limit int) ([]JournalEntry, error)
+// -------------------------------------------------------
+// Purpose:
+//   - readJournal, answered from the in-memory tail when it holds
+//     every entry after since.
+// Audit:
+//   - Entries before the tail have clocks below its first clock, so
+//     since >= first-1 means the tail is complete for the request.
+// -------------------------------------------------------
+func journalSince(ctx context.Context, since int64, limit int) ([]JournalEntry, error) {
+    journalMu.Lock()
+    ensureJournalLocked(ctx)
+    if since >= journalClock {
+        journalMu.Unlock()
+        return []JournalEntry{}, nil
+    }
+    if len(journalTail) > 0 && since >= journalTail[0].Clock-1 {
+        entries := []JournalEntry{}
+        for _, entry := range journalTail {
+            if entry.Clock <= since {
+                continue
+            }
+            entries = append(entries, entry)
+            if limit > 0 && len(entries) >= limit {
+                break
+            }
+        }
+        journalMu.Unlock()
+        return entries, nil
+    }
+    journalMu.Unlock()
+    return readJournal(ctx, since, limit)
+}
+
+// journalWait returns a channel closed by the next journal append.
+func journalWait() <-chan struct{} {
+    journalMu.Lock()
+    defer journalMu.Unlock()
+    return journalChanged
+}
+
+// -------------------------------------------------------
+// func currentJournalClock() int64
+// -------------------------------------------------------
+// Purpose:
+//   - Latest Lamport clock value of this instance.
+// -------------------------------------------------------
+func currentJournalClock(ctx context.Context) int64 {
+    journalMu.Lock()
+    defer journalMu.Unlock()
+    ensureJournalLocked(ctx)
+    return journalClock
+}
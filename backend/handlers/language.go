@@ -0,0 +1,395 @@
+// -------------------------------------------------------
+// backend/handlers/language.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Note languages: every note carries a language tag (ISO 639-1
+//     code, "und" when undetermined), detected from its content on
+//     save and overridable per note.
+//       GET  /file/language?path=...              language, detected, override
+//       POST /file/language {"path", "language"}  set ("" clears) the override
+//   - ?lang= filters /files and /search by language; detailed
+//     listings and search results carry each note's language, so
+//     later features (spell check, speech) can dispatch on it.
+//   - Registry: .scratchpad/languages.json (path -> tag) holds the
+//     overrides; detected languages live in the index.
+// Audit:
+//   - Detection is offline and heuristic: the writing system picks
+//     the language for non-Latin scripts; Latin text is scored on
+//     common words of eleven European languages and stays "und"
+//     unless one clearly leads.
+//   - Notes indexed before detection existed are detected the first
+//     time a listing or search asks for their language.
+//   - Filters match the primary subtag too (lang=pt matches pt-BR).
+//   - Archived notes are "und" unless they carry an override.
+//   - Overrides write "file.language" with the old and new tag.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "regexp"
+    "strings"
+    "sync"
+    "unicode"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    languagesFile   = "languages.json"
+    languageUnknown = "und"
+    // languageSampleBytes is how much of a note detection reads.
+    languageSampleBytes = 64 << 10
+    // languageMinHits is how many common words Latin text needs
+    // before a language is named.
+    languageMinHits = 3
+)
+
+// languageTagPattern accepts BCP 47 style tags: a 2-3 letter primary
+// subtag and optional subtags (en, pt-BR, zh-Hant).
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// languageMu guards languages.json.
+var languageMu sync.Mutex
+
+// languageStopwords are frequent short words of each Latin-script
+// language detection recognizes.
+var languageStopwords = map[string][]string{
+    "en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "are", "this", "you", "not", "have", "be", "on"},
+    "de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "ich", "mit", "sie", "den", "auf", "für", "von", "zu", "dem", "sich", "auch"},
+    "fr": {"le", "la", "les", "et", "est", "des", "une", "pour", "dans", "que", "qui", "pas", "sur", "avec", "ce", "il", "sont", "du", "au"},
+    "es": {"el", "la", "los", "las", "y", "es", "de", "que", "en", "un", "una", "por", "con", "para", "del", "se", "no", "su", "al"},
+    "it": {"il", "la", "di", "che", "è", "e", "un", "una", "per", "non", "sono", "con", "del", "della", "gli", "le", "si", "da"},
+    "pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "se", "por", "dos"},
+    "nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "er", "ik", "ook"},
+    "sv": {"och", "att", "det", "som", "en", "är", "på", "för", "med", "av", "inte", "den", "till", "har", "jag"},
+    "da": {"og", "at", "det", "som", "en", "er", "på", "for", "med", "af", "ikke", "den", "til", "har", "jeg"},
+    "fi": {"ja", "on", "ei", "se", "että", "oli", "hän", "kun", "mutta", "ovat", "myös", "tai"},
+    "pl": {"i", "w", "nie", "się", "na", "że", "jest", "z", "do", "to", "jak", "co", "ale", "po"},
+}
+
+// languageWords maps each stopword to the languages using it.
+var languageWords = func() map[string][]string {
+    words := map[string][]string{}
+    for lang, list := range languageStopwords {
+        for _, word := range list {
+            words[word] = append(words[word], lang)
+        }
+    }
+    return words
+}()
+
+// -------------------------------------------------------
+// func detectLanguage(data []byte) string
+// -------------------------------------------------------
+// Purpose:
+//   - Best guess at the language of a note's content; "und" when
+//     the text is too short or too mixed to tell.
+// -------------------------------------------------------
+func detectLanguage(data []byte) string {
+    if len(data) > languageSampleBytes {
+        data = data[:languageSampleBytes]
+    }
+    text := strings.ToValidUTF8(string(data), "")
+
+    scripts := map[string]int{}
+    letters := 0
+    for _, c := range text {
+        if !unicode.IsLetter(c) {
+            continue
+        }
+        letters++
+        switch {
+        case unicode.Is(unicode.Hiragana, c) || unicode.Is(unicode.Katakana, c):
+            scripts["kana"]++
+        case unicode.Is(unicode.Han, c):
+            scripts["han"]++
+        case unicode.Is(unicode.Hangul, c):
+            scripts["ko"]++
+        case unicode.Is(unicode.Cyrillic, c):
+            scripts["cyrillic"]++
+            if strings.ContainsRune("іїєґІЇЄҐ", c) {
+                scripts["uk"]++
+            }
+        case unicode.Is(unicode.Greek, c):
+            scripts["el"]++
+        case unicode.Is(unicode.Arabic, c):
+            scripts["ar"]++
+        case unicode.Is(unicode.Hebrew, c):
+            scripts["he"]++
+        case unicode.Is(unicode.Thai, c):
+            scripts["th"]++
+        case unicode.Is(unicode.Devanagari, c):
+            scripts["hi"]++
+        }
+    }
+    if letters == 0 {
+        return languageUnknown
+    }
+
+    // Mostly non-Latin letters: the script decides.
+    if cjk := scripts["kana"] + scripts["han"]; cjk*2 > letters {
+        if scripts["kana"]*10 >= cjk {
+            return "ja"
+        }
+        return "zh"
+    }
+    if scripts["cyrillic"]*2 > letters {
+        if scripts["uk"] > 0 {
+            return "uk"
+        }
+        return "ru"
+    }
+    for _, lang := range []string{"ko", "el", "ar", "he", "th", "hi"} {
+        if scripts[lang]*2 > letters {
+            return lang
+        }
+    }
+
+    scores := map[string]int{}
+    for _, word := range strings.FieldsFunc(strings.ToLower(text), func(c rune) bool { return !unicode.IsLetter(c) }) {
+        for _, lang := range languageWords[word] {
+            scores[lang]++
+        }
+    }
+    best, bestScore, runnerUp := languageUnknown, 0, 0
+    for lang, score := range scores {
+        if score > bestScore || score == bestScore && lang < best {
+            best, bestScore, runnerUp = lang, score, bestScore
+        } else if score > runnerUp {
+            runnerUp = score
+        }
+    }
+    // A clear lead (20%) over the runner-up, or the text is mixed.
+    if bestScore < languageMinHits || bestScore*5 < runnerUp*6 {
+        return languageUnknown
+    }
+    return best
+}
+
+// -------------------------------------------------------
+// func loadLanguagesLocked() map[string]string
+// -------------------------------------------------------
+// Purpose:
+//   - Read languages.json. Caller holds languageMu.
+// -------------------------------------------------------
+func loadLanguagesLocked(ctx context.Context) map[string]string {
+    overrides := map[string]string{}
+    if err := loadMetaJSON(ctx, languagesFile, &overrides); err != nil {
+        logError(ctx, "Failed to load language overrides: "+err.Error())
+    }
+    if overrides == nil {
+        overrides = map[string]string{}
+    }
+    return overrides
+}
+
+// languageOverrides returns a copy of every override.
+func languageOverrides(ctx context.Context) map[string]string {
+    languageMu.Lock()
+    defer languageMu.Unlock()
+    return loadLanguagesLocked(ctx)
+}
+
+// -------------------------------------------------------
+// func languageRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Move a note's language override along with it.
+// -------------------------------------------------------
+func languageRename(ctx context.Context, from, to string) {
+    languageMu.Lock()
+    defer languageMu.Unlock()
+    overrides := loadLanguagesLocked(ctx)
+    lang, ok := overrides[from]
+    if !ok {
+        return
+    }
+    delete(overrides, from)
+    overrides[to] = lang
+    if err := saveMetaJSON(ctx, languagesFile, overrides); err != nil {
+        logError(ctx, "Failed to move language override "+from+" -> "+to+": "+err.Error())
+    }
+    touchListing(from, to)
+}
+
+// -------------------------------------------------------
+// type languageLookup
+// -------------------------------------------------------
+// Purpose:
+//   - Resolve the languages of many notes for one listing or
+//     search: the override, else the detected language.
+// -------------------------------------------------------
+type languageLookup struct {
+    ctx       context.Context
+    overrides map[string]string
+    index     map[string]IndexEntry
+}
+
+// newLanguageLookup snapshots the overrides and the index.
+func newLanguageLookup(ctx context.Context) *languageLookup {
+    return &languageLookup{ctx: ctx, overrides: languageOverrides(ctx), index: indexSnapshot(ctx)}
+}
+
+// -------------------------------------------------------
+// func (l *languageLookup) detected(rel string) string
+// -------------------------------------------------------
+// Purpose:
+//   - The detected language of a note.
+// Audit:
+//   - Index entries from before detection existed are detected now
+//     and stored; unreadable notes are "und".
+// -------------------------------------------------------
+func (l *languageLookup) detected(rel string) string {
+    if entry, ok := l.index[rel]; ok && entry.Language != "" {
+        return entry.Language
+    }
+    data, err := readFile(l.ctx, sanitizePath(l.ctx, rel))
+    if err != nil {
+        return languageUnknown
+    }
+    lang := detectLanguage(data)
+    indexSetLanguage(l.ctx, rel, lang)
+    return lang
+}
+
+// of returns the language of a note.
+func (l *languageLookup) of(rel string) string {
+    if lang := l.overrides[rel]; lang != "" {
+        return lang
+    }
+    return l.detected(rel)
+}
+
+// languageMatches reports whether lang satisfies a ?lang= filter;
+// a primary subtag matches its regional variants.
+func languageMatches(lang, filter string) bool {
+    lang, filter = strings.ToLower(lang), strings.ToLower(filter)
+    return lang == filter || strings.HasPrefix(lang, filter+"-")
+}
+
+// -------------------------------------------------------
+// func languageFilter(r) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The request's ?lang= filter ("" when absent).
+// -------------------------------------------------------
+func languageFilter(r *http.Request) (string, error) {
+    lang := r.URL.Query().Get("lang")
+    if lang != "" && !languageTagPattern.MatchString(lang) {
+        return "", invalidField("lang", "must be a language tag such as en or pt-BR")
+    }
+    return lang, nil
+}
+
+// -------------------------------------------------------
+// func HandleFileLanguage(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET ?path=: the note's language, what was detected, and the
+//     override if any.
+//   - POST {"path", "language"}: set the override; "" clears it.
+// -------------------------------------------------------
+func HandleFileLanguage(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        absPath := sanitizePath(r.Context(), r.URL.Query().Get("path"))
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        if _, err := statPath(r.Context(), absPath); os.IsNotExist(err) {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+            return
+        }
+        writeLanguage(w, r, relativeTo(r.Context(), absPath))
+
+    case http.MethodPost:
+        handleSetLanguage(w, r)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// writeLanguage answers the language record of one note.
+func writeLanguage(w http.ResponseWriter, r *http.Request, rel string) {
+    lookup := newLanguageLookup(r.Context())
+    override := lookup.overrides[rel]
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":     rel,
+        "language": lookup.of(rel),
+        "detected": lookup.detected(rel),
+        "override": override,
+    })
+}
+
+// -------------------------------------------------------
+// func handleSetLanguage(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/language: record or clear a note's override.
+// -------------------------------------------------------
+func handleSetLanguage(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Path     string `json:"path"`
+        Language string `json:"language"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    if req.Language != "" && !languageTagPattern.MatchString(req.Language) {
+        writeFieldError(w, r, invalidField("language", "must be a language tag such as en or pt-BR, or empty to clear"))
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    if _, err := statPath(r.Context(), absPath); os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    languageMu.Lock()
+    overrides := loadLanguagesLocked(r.Context())
+    previous := overrides[rel]
+    if req.Language == "" {
+        delete(overrides, rel)
+    } else {
+        overrides[rel] = req.Language
+    }
+    err := saveMetaJSON(r.Context(), languagesFile, overrides)
+    languageMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "save language override: "+rel, "Failed to save language")
+        return
+    }
+    touchListing(rel)
+
+    logInfo(r.Context(), fmt.Sprintf("Language override for %s: %q -> %q", rel, previous, req.Language))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.language",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail:   fmt.Sprintf("from=%s to=%s", defaultString(previous, "auto"), defaultString(req.Language, "auto")),
+    })
+    writeLanguage(w, r, rel)
+}
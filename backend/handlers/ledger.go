@@ -0,0 +1,376 @@
+// -------------------------------------------------------
+// backend/handlers/ledger.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Ledger notes (decision logs, approvals): once a note is put in
+//     ledger mode, saves may only append lines after the existing
+//     content.
+//       POST /file/ledger {"path"}  switch a note to ledger mode
+//       GET  /file/ledger?path=...  ledger record of one note
+//       GET  /file/ledger           all ledger notes
+//   - Registry: .scratchpad/ledgers.json (path -> LedgerRecord).
+// Audit:
+//   - Each save is verified by prefix hash: the SHA-256 of the first
+//     Size bytes of the new content must equal the recorded hash of
+//     the last accepted version.
+//   - Ledger mode is one-way; ledger notes (and folders holding
+//     them) cannot be deleted. Moves carry the record along.
+//   - Writes "ledger.enable" and, for every rejected edit or delete,
+//     "ledger.violation".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const ledgersFile = "ledgers.json"
+
+// ledgerMu guards ledgers.json and serializes ledger saves so two
+// concurrent appends cannot overwrite each other.
+var ledgerMu sync.Mutex
+
+// -------------------------------------------------------
+// type LedgerRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Ledger state of one note: hash and size of the last accepted
+//     content, which every later save must start with.
+// -------------------------------------------------------
+type LedgerRecord struct {
+    Path      string `json:"path"`
+    EnabledAt string `json:"enabled_at"`
+    SHA256    string `json:"sha256"`
+    Size      int64  `json:"size"`
+    Appends   int64  `json:"appends"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+// -------------------------------------------------------
+// type LedgerError
+// -------------------------------------------------------
+// Purpose:
+//   - A save or delete that would rewrite ledger history.
+// -------------------------------------------------------
+type LedgerError struct {
+    Path   string
+    Reason string
+}
+
+func (e *LedgerError) Error() string {
+    return "ledger note " + e.Path + ": " + e.Reason
+}
+
+// -------------------------------------------------------
+// func loadLedgersLocked() map[string]LedgerRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Read ledgers.json. Caller holds ledgerMu.
+// -------------------------------------------------------
+func loadLedgersLocked(ctx context.Context) map[string]LedgerRecord {
+    ledgers := map[string]LedgerRecord{}
+    if err := loadMetaJSON(ctx, ledgersFile, &ledgers); err != nil {
+        logError(ctx, "Failed to load ledger registry: "+err.Error())
+    }
+    if ledgers == nil {
+        ledgers = map[string]LedgerRecord{}
+    }
+    return ledgers
+}
+
+// -------------------------------------------------------
+// func isLedger(ctx context.Context, rel string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether the note at rel is in ledger mode.
+// -------------------------------------------------------
+func isLedger(ctx context.Context, rel string) bool {
+    ledgerMu.Lock()
+    defer ledgerMu.Unlock()
+    _, ok := loadLedgersLocked(ctx)[rel]
+    return ok
+}
+
+// -------------------------------------------------------
+// func ledgersUnder(ctx context.Context, rel string) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Ledger notes at rel or anywhere inside folder rel.
+// -------------------------------------------------------
+func ledgersUnder(ctx context.Context, rel string) []string {
+    ledgerMu.Lock()
+    defer ledgerMu.Unlock()
+    found := []string{}
+    for path := range loadLedgersLocked(ctx) {
+        if rel == "." || path == rel || strings.HasPrefix(path, rel+"/") {
+            found = append(found, path)
+        }
+    }
+    sort.Strings(found)
+    return found
+}
+
+// -------------------------------------------------------
+// func checkLedgerAppend(record, content) error
+// -------------------------------------------------------
+// Purpose:
+//   - Verify content only appends whole lines to the recorded
+//     version.
+// Audit:
+//   - When the recorded content does not end in a newline, the
+//     appended part must start with one.
+// -------------------------------------------------------
+func checkLedgerAppend(record LedgerRecord, content []byte) error {
+    if int64(len(content)) < record.Size {
+        return &LedgerError{Path: record.Path, Reason: "content is shorter than the recorded ledger"}
+    }
+    prefix := content[:record.Size]
+    sum := sha256.Sum256(prefix)
+    if hex.EncodeToString(sum[:]) != record.SHA256 {
+        return &LedgerError{Path: record.Path, Reason: "existing entries were modified (prefix hash mismatch)"}
+    }
+    appended := content[record.Size:]
+    if len(appended) > 0 && len(prefix) > 0 && prefix[len(prefix)-1] != '\n' && appended[0] != '\n' {
+        return &LedgerError{Path: record.Path, Reason: "appended text must start on a new line"}
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func ledgerAccepts(ctx context.Context, rel string, content []byte) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether content may be written to rel (always true for
+//     notes that are not ledgers).
+// -------------------------------------------------------
+func ledgerAccepts(ctx context.Context, rel string, content []byte) bool {
+    ledgerMu.Lock()
+    defer ledgerMu.Unlock()
+    record, ok := loadLedgersLocked(ctx)[rel]
+    return !ok || checkLedgerAppend(record, content) == nil
+}
+
+// -------------------------------------------------------
+// func saveLedger(ctx, rel, absPath, content) error
+// -------------------------------------------------------
+// Purpose:
+//   - Check, write, and record an append to a ledger note; plain
+//     notes are written as-is.
+// Audit:
+//   - Returns *LedgerError (nothing written) on a violation.
+// -------------------------------------------------------
+func saveLedger(ctx context.Context, rel string, absPath string, content []byte) error {
+    ledgerMu.Lock()
+    defer ledgerMu.Unlock()
+
+    ledgers := loadLedgersLocked(ctx)
+    record, ok := ledgers[rel]
+    if !ok {
+        return writeFile(ctx, absPath, content)
+    }
+    if err := checkLedgerAppend(record, content); err != nil {
+        return err
+    }
+    if int64(len(content)) == record.Size {
+        return nil
+    }
+    if err := writeFile(ctx, absPath, content); err != nil {
+        return err
+    }
+
+    record.SHA256 = contentHash(content)
+    record.Size = int64(len(content))
+    record.Appends++
+    record.UpdatedAt = utcNow(ctx)
+    ledgers[rel] = record
+    if err := saveMetaJSON(ctx, ledgersFile, ledgers); err != nil {
+        logError(ctx, "Failed to update ledger registry for "+rel+": "+err.Error())
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func ledgerRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Move a ledger record along with its note.
+// -------------------------------------------------------
+func ledgerRename(ctx context.Context, from, to string) {
+    ledgerMu.Lock()
+    defer ledgerMu.Unlock()
+    ledgers := loadLedgersLocked(ctx)
+    record, ok := ledgers[from]
+    if !ok {
+        return
+    }
+    delete(ledgers, from)
+    record.Path = to
+    ledgers[to] = record
+    if err := saveMetaJSON(ctx, ledgersFile, ledgers); err != nil {
+        logError(ctx, "Failed to move ledger record "+from+" -> "+to+": "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func auditLedgerViolation(r, rel, reason)
+// -------------------------------------------------------
+// Purpose:
+//   - Record a rejected attempt to rewrite or remove a ledger.
+// -------------------------------------------------------
+func auditLedgerViolation(r *http.Request, rel string, reason string) {
+    logError(r.Context(), "Rejected ledger change: "+rel+" ("+reason+")")
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "ledger.violation",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusForbidden,
+        Target:   rel,
+        Detail:   reason,
+    })
+}
+
+// -------------------------------------------------------
+// func writeLedgerViolation(w, r, err)
+// -------------------------------------------------------
+// Purpose:
+//   - Audit and answer 403 for a *LedgerError.
+// -------------------------------------------------------
+func writeLedgerViolation(w http.ResponseWriter, r *http.Request, err *LedgerError) {
+    auditLedgerViolation(r, err.Path, err.Reason)
+    apierror.Write(w, r, apierror.CodeLedgerViolation, "", "Ledger note: "+err.Reason)
+}
+
+// -------------------------------------------------------
+// func rejectIfLedger(w, r, absPath) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Refuse deleting a ledger note or a folder containing one.
+// -------------------------------------------------------
+func rejectIfLedger(w http.ResponseWriter, r *http.Request, absPath string) bool {
+    rel := relativeTo(r.Context(), absPath)
+    found := ledgersUnder(r.Context(), rel)
+    if len(found) == 0 {
+        return false
+    }
+    reason := "ledger notes cannot be deleted"
+    if found[0] != rel {
+        reason = fmt.Sprintf("folder contains %d ledger note(s), e.g. %s", len(found), found[0])
+    }
+    writeLedgerViolation(w, r, &LedgerError{Path: rel, Reason: reason})
+    return true
+}
+
+// -------------------------------------------------------
+// func HandleLedger(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: one ledger record (?path=) or all of them.
+//   - POST {"path"}: put an existing note in ledger mode.
+// Audit:
+//   - Enabling an already-ledger note is a no-op (200).
+// -------------------------------------------------------
+func HandleLedger(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        ledgerMu.Lock()
+        ledgers := loadLedgersLocked(r.Context())
+        ledgerMu.Unlock()
+
+        w.Header().Set("Content-Type", "application/json")
+        if file := r.URL.Query().Get("path"); file != "" {
+            record, ok := ledgers[relativeTo(r.Context(), sanitizePath(r.Context(), file))]
+            if !ok {
+                apierror.Write(w, r, apierror.CodeNotFound, "", "Not a ledger note")
+                return
+            }
+            json.NewEncoder(w).Encode(record)
+            return
+        }
+        list := make([]LedgerRecord, 0, len(ledgers))
+        for _, record := range ledgers {
+            list = append(list, record)
+        }
+        sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+        json.NewEncoder(w).Encode(list)
+
+    case http.MethodPost:
+        var req struct {
+            Path string `json:"path"`
+        }
+        if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+            return
+        }
+        absPath := sanitizePath(r.Context(), req.Path)
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        if rejectIfArchived(w, r, absPath) {
+            return
+        }
+        rel := relativeTo(r.Context(), absPath)
+
+        ledgerMu.Lock()
+        defer ledgerMu.Unlock()
+        ledgers := loadLedgersLocked(r.Context())
+        if record, ok := ledgers[rel]; ok {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(record)
+            return
+        }
+
+        content, err := readFile(r.Context(), absPath)
+        if os.IsNotExist(err) {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "read ledger note: "+absPath, "Internal error")
+            return
+        }
+
+        now := utcNow(r.Context())
+        record := LedgerRecord{
+            Path:      rel,
+            EnabledAt: now,
+            SHA256:    contentHash(content),
+            Size:      int64(len(content)),
+            UpdatedAt: now,
+        }
+        ledgers[rel] = record
+        if err := saveMetaJSON(r.Context(), ledgersFile, ledgers); err != nil {
+            writeStorageError(w, r, err, "save ledger registry", "Internal error")
+            return
+        }
+
+        logInfo(r.Context(), "Enabled ledger mode: "+absPath)
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "ledger.enable",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Target:   rel,
+            Detail:   fmt.Sprintf("sha256=%s size=%d", record.SHA256, record.Size),
+        })
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(record)
+
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
@@ -0,0 +1,501 @@
+// -------------------------------------------------------
+// backend/handlers/lint.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - /file/lint: optional spelling and terminology checks with the
+//     position of each finding, for inline highlighting:
+//       GET  /file/lint?path=...       lint a saved note
+//       POST /file/lint {"content"}    lint the editor's buffer
+//   - Driven by the "lint" configuration: a word list file, a custom
+//     dictionary (entity names, account codes), and preferred terms.
+// Audit:
+//   - Disabled unless lint.enabled is set (403 forbidden).
+//   - Without a word list only the custom dictionary and terms are
+//     checked; "spelling_checked" tells the client which applies.
+//   - Read-only; the word list is cached until its file changes.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/config"
+)
+
+const (
+    maxLintBytes       = 8 << 20
+    maxLintIssues      = 500
+    maxLintSuggestions = 3
+    maxDictionaryBytes = 16 << 20
+)
+
+// Lint issue kinds.
+const (
+    issueSpelling = "spelling"
+    issueTerm     = "term"
+)
+
+// -------------------------------------------------------
+// type LintIssue
+// -------------------------------------------------------
+// Purpose:
+//   - One finding returned by /file/lint.
+// Audit:
+//   - Line and Column are 1-based; Column and Offset count bytes,
+//     as in /search.
+//   - Suggestions is never null.
+// -------------------------------------------------------
+type LintIssue struct {
+    Kind        string   `json:"kind"`
+    Line        int      `json:"line"`
+    Column      int      `json:"column"`
+    Offset      int      `json:"offset"`
+    Length      int      `json:"length"`
+    Text        string   `json:"text"`
+    Message     string   `json:"message"`
+    Suggestions []string `json:"suggestions"`
+}
+
+// -------------------------------------------------------
+// Word list cache
+// -------------------------------------------------------
+// The word list is reloaded when its path, size, or modification
+// time changes, so editing it needs no restart.
+var (
+    dictionaryMu      sync.Mutex
+    dictionaryPath    string
+    dictionarySize    int64
+    dictionaryModTime time.Time
+    dictionaryWords   map[string]struct{}
+)
+
+// -------------------------------------------------------
+// func loadDictionary(ctx context.Context, path string) (map[string]struct{}, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The lowercased words of the word list at path.
+// Audit:
+//   - Lines are trimmed; empty lines and "#" comments are skipped.
+//   - Files over maxDictionaryBytes are refused.
+// -------------------------------------------------------
+func loadDictionary(ctx context.Context, path string) (map[string]struct{}, error) {
+    dictionaryMu.Lock()
+    defer dictionaryMu.Unlock()
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    if info.Size() > maxDictionaryBytes {
+        return nil, fmt.Errorf("word list exceeds %d bytes", maxDictionaryBytes)
+    }
+    if dictionaryWords != nil && path == dictionaryPath && info.Size() == dictionarySize && info.ModTime().Equal(dictionaryModTime) {
+        return dictionaryWords, nil
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    words := map[string]struct{}{}
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        word := strings.TrimSpace(scanner.Text())
+        if word == "" || strings.HasPrefix(word, "#") {
+            continue
+        }
+        words[strings.ToLower(word)] = struct{}{}
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    dictionaryPath, dictionarySize, dictionaryModTime, dictionaryWords = path, info.Size(), info.ModTime(), words
+    logInfo(ctx, fmt.Sprintf("Loaded lint word list %s (%d words)", path, len(words)))
+    return words, nil
+}
+
+// phrasePattern matches phrase as whole words, ignoring case.
+func phrasePattern(phrase string) *regexp.Regexp {
+    return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(` + regexp.QuoteMeta(phrase) + `)(?:$|[^\p{L}\p{N}_])`)
+}
+
+// -------------------------------------------------------
+// func findPhrase(content, phrase) [][2]int
+// -------------------------------------------------------
+// Purpose:
+//   - Byte ranges of every whole-word occurrence of phrase.
+// Audit:
+//   - Occurrences separated by a single character are all found:
+//     the search resumes at the end of the phrase, not after the
+//     boundary character the pattern consumed.
+// -------------------------------------------------------
+func findPhrase(content []byte, phrase string) [][2]int {
+    re := phrasePattern(phrase)
+    spans := [][2]int{}
+    for start := 0; start < len(content); {
+        loc := re.FindSubmatchIndex(content[start:])
+        if loc == nil {
+            break
+        }
+        spans = append(spans, [2]int{start + loc[2], start + loc[3]})
+        start += loc[3]
+    }
+    return spans
+}
+
+// capitalize upper-cases the first letter of s.
+func capitalize(s string) string {
+    r, size := utf8.DecodeRuneInString(s)
+    return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// hasUpper reports whether s contains an upper-case letter.
+func hasUpper(s string) bool {
+    return strings.IndexFunc(s, unicode.IsUpper) >= 0
+}
+
+// -------------------------------------------------------
+// func lintTerms(content, cfg) []LintIssue
+// -------------------------------------------------------
+// Purpose:
+//   - Flag non-preferred term variants and custom dictionary
+//     entries written with different case ("acme" for "Acme").
+// Audit:
+//   - An all-lowercase custom word may be capitalized (sentence
+//     start); otherwise the configured spelling is exact.
+// -------------------------------------------------------
+func lintTerms(content []byte, cfg config.LintConfig) []LintIssue {
+    issues := []LintIssue{}
+    for preferred, variants := range cfg.Terms {
+        for _, variant := range variants {
+            for _, span := range findPhrase(content, variant) {
+                text := string(content[span[0]:span[1]])
+                if text == preferred {
+                    continue
+                }
+                issues = append(issues, LintIssue{
+                    Kind:        issueTerm,
+                    Offset:      span[0],
+                    Length:      span[1] - span[0],
+                    Text:        text,
+                    Message:     fmt.Sprintf("Use %q instead of %q", preferred, text),
+                    Suggestions: []string{preferred},
+                })
+            }
+        }
+    }
+    for _, word := range cfg.Words {
+        for _, span := range findPhrase(content, word) {
+            text := string(content[span[0]:span[1]])
+            if text == word || (!hasUpper(word) && text == capitalize(word)) {
+                continue
+            }
+            issues = append(issues, LintIssue{
+                Kind:        issueTerm,
+                Offset:      span[0],
+                Length:      span[1] - span[0],
+                Text:        text,
+                Message:     fmt.Sprintf("Write %q as %q", text, word),
+                Suggestions: []string{word},
+            })
+        }
+    }
+    return issues
+}
+
+// -------------------------------------------------------
+// func lintWords(content) [][2]int
+// -------------------------------------------------------
+// Purpose:
+//   - Byte ranges of the words to spell-check.
+// Audit:
+//   - A word is a run of letters and digits, with single internal
+//     apostrophes or hyphens ("don't", "year-end").
+// -------------------------------------------------------
+func lintWords(content []byte) [][2]int {
+    spans := [][2]int{}
+    start := -1
+    isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+    for i := 0; i <= len(content); {
+        r, size := utf8.RuneError, 1
+        if i < len(content) {
+            r, size = utf8.DecodeRune(content[i:])
+        }
+        switch {
+        case i < len(content) && isWord(r):
+            if start < 0 {
+                start = i
+            }
+        case start >= 0 && (r == '\'' || r == '’' || r == '-') && i+size < len(content):
+            if next, _ := utf8.DecodeRune(content[i+size:]); isWord(next) {
+                break
+            }
+            spans = append(spans, [2]int{start, i})
+            start = -1
+        default:
+            if start >= 0 {
+                spans = append(spans, [2]int{start, i})
+                start = -1
+            }
+        }
+        i += size
+    }
+    return spans
+}
+
+// -------------------------------------------------------
+// func spellingSuggestions(word, dict) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Up to maxLintSuggestions dictionary words one edit away
+//     (deletion, transposition, substitution, or insertion of a-z).
+// Audit:
+//   - Suggestions keep the word's leading capital.
+// -------------------------------------------------------
+func spellingSuggestions(word string, dict map[string]struct{}) []string {
+    lower := []rune(strings.ToLower(word))
+    found := map[string]struct{}{}
+    try := func(candidate []rune) {
+        if _, ok := dict[string(candidate)]; ok {
+            found[string(candidate)] = struct{}{}
+        }
+    }
+    for i := range lower {
+        try(append(append([]rune{}, lower[:i]...), lower[i+1:]...))
+        if i+1 < len(lower) {
+            swapped := append([]rune{}, lower...)
+            swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+            try(swapped)
+        }
+    }
+    for i := 0; i <= len(lower); i++ {
+        for c := 'a'; c <= 'z'; c++ {
+            if i < len(lower) {
+                replaced := append([]rune{}, lower...)
+                replaced[i] = c
+                try(replaced)
+            }
+            inserted := append(append(append([]rune{}, lower[:i]...), c), lower[i:]...)
+            try(inserted)
+        }
+    }
+
+    suggestions := make([]string, 0, len(found))
+    for candidate := range found {
+        suggestions = append(suggestions, candidate)
+    }
+    sort.Strings(suggestions)
+    if len(suggestions) > maxLintSuggestions {
+        suggestions = suggestions[:maxLintSuggestions]
+    }
+    if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+        for i := range suggestions {
+            suggestions[i] = capitalize(suggestions[i])
+        }
+    }
+    return suggestions
+}
+
+// -------------------------------------------------------
+// func lintSpelling(content, dict, custom, covered) []LintIssue
+// -------------------------------------------------------
+// Purpose:
+//   - Flag words found in neither the word list nor the custom
+//     dictionary.
+// Audit:
+//   - Words with digits (account codes, amounts), single letters,
+//     and words inside a term finding (covered, sorted) are skipped.
+//   - A possessive "'s" is checked without the suffix.
+// -------------------------------------------------------
+func lintSpelling(content []byte, dict map[string]struct{}, custom map[string]struct{}, covered [][2]int) []LintIssue {
+    issues := []LintIssue{}
+    next := 0
+    for _, span := range lintWords(content) {
+        for next < len(covered) && covered[next][1] <= span[0] {
+            next++
+        }
+        if next < len(covered) && covered[next][0] < span[1] {
+            continue
+        }
+        word := string(content[span[0]:span[1]])
+        if utf8.RuneCountInString(word) < 2 || strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+            continue
+        }
+        lower := strings.ToLower(word)
+        base := strings.TrimSuffix(strings.TrimSuffix(lower, "'s"), "’s")
+        if known(custom, lower, base) || known(dict, lower, base) {
+            continue
+        }
+        issues = append(issues, LintIssue{
+            Kind:        issueSpelling,
+            Offset:      span[0],
+            Length:      span[1] - span[0],
+            Text:        word,
+            Message:     fmt.Sprintf("Unknown word %q", word),
+            Suggestions: spellingSuggestions(word, dict),
+        })
+    }
+    return issues
+}
+
+// known reports whether any of words is in set.
+func known(set map[string]struct{}, words ...string) bool {
+    for _, word := range words {
+        if _, ok := set[word]; ok {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func lintContent(content, cfg, dict) []LintIssue
+// -------------------------------------------------------
+// Purpose:
+//   - All findings in content, sorted by offset, with positions.
+// Audit:
+//   - dict nil skips the spelling check.
+// -------------------------------------------------------
+func lintContent(content []byte, cfg config.LintConfig, dict map[string]struct{}) []LintIssue {
+    issues := lintTerms(content, cfg)
+    if dict != nil {
+        covered := make([][2]int, 0, len(issues))
+        for _, issue := range issues {
+            covered = append(covered, [2]int{issue.Offset, issue.Offset + issue.Length})
+        }
+        sort.Slice(covered, func(i, j int) bool { return covered[i][0] < covered[j][0] })
+
+        custom := map[string]struct{}{}
+        for _, word := range cfg.Words {
+            for _, part := range strings.Fields(word) {
+                custom[strings.ToLower(part)] = struct{}{}
+            }
+        }
+        for preferred := range cfg.Terms {
+            for _, part := range strings.Fields(preferred) {
+                custom[strings.ToLower(part)] = struct{}{}
+            }
+        }
+        issues = append(issues, lintSpelling(content, dict, custom, covered)...)
+    }
+    sort.SliceStable(issues, func(i, j int) bool { return issues[i].Offset < issues[j].Offset })
+
+    line, lineStart, scanned := 1, 0, 0
+    for i := range issues {
+        for ; scanned < issues[i].Offset; scanned++ {
+            if content[scanned] == '\n' {
+                line++
+                lineStart = scanned + 1
+            }
+        }
+        issues[i].Line = line
+        issues[i].Column = issues[i].Offset - lineStart + 1
+    }
+    return issues
+}
+
+// -------------------------------------------------------
+// func HandleFileLint(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Lint a saved note (GET ?path=) or posted content (POST
+//     {"content"}), answering {"path", "issues", "truncated",
+//     "spelling_checked"}.
+// Audit:
+//   - Posted content is limited to maxLintBytes (413).
+//   - An unreadable word list is logged and only disables the
+//     spelling check.
+//   - At most maxLintIssues issues are returned (truncated).
+// -------------------------------------------------------
+func HandleFileLint(w http.ResponseWriter, r *http.Request) {
+    cfg := currentConfig(r.Context()).Lint
+    if !cfg.Enabled {
+        logError(r.Context(), "Lint requested but lint.enabled is off")
+        apierror.Write(w, r, apierror.CodeForbidden, "", "Lint is disabled")
+        return
+    }
+
+    var content []byte
+    rel := ""
+    switch r.Method {
+    case http.MethodGet:
+        file := r.URL.Query().Get("path")
+        if !requireField(w, r, "path", file) {
+            return
+        }
+        absPath := sanitizePath(r.Context(), file)
+        if absPath == "" || !isNoteName(absPath) {
+            logError(r.Context(), "Invalid file path requested: "+file)
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        data, err := readNote(r.Context(), absPath)
+        if err != nil {
+            writeStorageError(w, r, err, "read file for lint: "+absPath, "Internal error")
+            return
+        }
+        content, rel = data, relativeTo(r.Context(), absPath)
+
+    case http.MethodPost:
+        var body struct {
+            Content string `json:"content"`
+        }
+        dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLintBytes))
+        if err := dec.Decode(&body); err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Content exceeds %d bytes", maxLintBytes))
+                return
+            }
+            writeJSONError(w, r, err)
+            return
+        }
+        content = []byte(body.Content)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var dict map[string]struct{}
+    if cfg.Dictionary != "" {
+        words, err := loadDictionary(r.Context(), cfg.Dictionary)
+        if err != nil {
+            logError(r.Context(), "Failed to load lint word list "+cfg.Dictionary+": "+err.Error())
+        }
+        dict = words
+    }
+
+    issues := lintContent(content, cfg, dict)
+    truncated := len(issues) > maxLintIssues
+    if truncated {
+        issues = issues[:maxLintIssues]
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Lint of %s found %d issues", defaultString(rel, "posted content"), len(issues)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":             rel,
+        "issues":           issues,
+        "truncated":        truncated,
+        "spelling_checked": dict != nil,
+    })
+}
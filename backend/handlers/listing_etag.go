@@ -0,0 +1,238 @@
+// -------------------------------------------------------
+// backend/handlers/listing_etag.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Conditional GETs for the folder listings (/files, /folders):
+//     each answer carries an ETag, and a poll with a matching
+//     If-None-Match gets 304 Not Modified without the listing being
+//     built or sent.
+// Audit:
+//   - A folder's ETag hashes the index entries of the notes directly
+//     in it, the folder's listing version, its modification time,
+//     a per-process nonce, the query, the caller and the current UTC
+//     date. The /folders ETag hashes the folders the index spans and
+//     the tree version instead; a smart listing the whole index and
+//     the overall version.
+//   - Versions are advanced only by changes a listing shows: note
+//     writes, renames and removals, new folders, and the metadata
+//     listings include (workflow state, comments, order, language
+//     overrides, folder metadata, archives, smart folders). Sessions,
+//     preferences, jobs and other metadata leave every ETag alone,
+//     and a change in one folder leaves the others' ETags alone.
+//   - Files added or removed by hand still show through the folder's
+//     modification time; a restart and day boundaries (smart folder
+//     date ranges) produce new ETags.
+//   - Responses are "Cache-Control: private, no-cache", so browsers
+//     revalidate each time and shared caches never store them.
+//   - NDJSON streams are not covered (listing_stream.go).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "net/http"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+)
+
+var (
+    listingMu sync.Mutex
+    // listingVersions counts listing changes per folder ("." is the root).
+    listingVersions = map[string]int64{}
+    // listingTree counts changes to the folder tree (/folders).
+    listingTree int64
+    // listingAll counts every listing change (smart listings).
+    listingAll int64
+    // listingNonce separates ETags of different processes.
+    listingNonce = func() string {
+        raw := make([]byte, 8)
+        rand.Read(raw)
+        return hex.EncodeToString(raw)
+    }()
+)
+
+// listingHidden reports whether rel is outside the listed tree: the
+// metadata directory, dot files, or not below the root at all.
+func listingHidden(rel string) bool {
+    if rel == "" || rel == ".." || strings.HasPrefix(rel, "../") {
+        return true
+    }
+    for _, part := range strings.Split(rel, "/") {
+        if part != "." && strings.HasPrefix(part, ".") {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func touchListing(rels ...string)
+// -------------------------------------------------------
+// Purpose:
+//   - Record a change to the notes at rels (slash-separated): the
+//     listings of their folders and smart listings get new ETags.
+// Audit:
+//   - With no rels only smart listings change (a smart folder's
+//     definition was saved).
+// -------------------------------------------------------
+func touchListing(rels ...string) {
+    listingMu.Lock()
+    defer listingMu.Unlock()
+    listingAll++
+    for _, rel := range rels {
+        if !listingHidden(rel) {
+            listingVersions[path.Dir(rel)]++
+        }
+    }
+}
+
+// -------------------------------------------------------
+// func touchFolders(rels ...string)
+// -------------------------------------------------------
+// Purpose:
+//   - Record a change to the folders at rels (created, moved,
+//     removed, archived, described or reordered): /folders, the
+//     folders' own listings and their parents' get new ETags.
+// -------------------------------------------------------
+func touchFolders(rels ...string) {
+    listingMu.Lock()
+    defer listingMu.Unlock()
+    listingAll++
+    for _, rel := range rels {
+        if listingHidden(rel) {
+            continue
+        }
+        listingTree++
+        listingVersions[rel]++
+        listingVersions[path.Dir(rel)]++
+    }
+}
+
+// touchStoragePaths records a storage change to absolute paths; dir
+// says whether they are folders.
+func touchStoragePaths(ctx context.Context, dir bool, absPaths ...string) {
+    rels := make([]string, 0, len(absPaths))
+    for _, absPath := range absPaths {
+        rels = append(rels, relativeTo(ctx, absPath))
+    }
+    if dir {
+        touchFolders(rels...)
+        return
+    }
+    touchListing(rels...)
+}
+
+// -------------------------------------------------------
+// func listingETag(r, absFolder) string
+// -------------------------------------------------------
+// Purpose:
+//   - The ETag of the listing r asks for: the folder at absFolder,
+//     the folder tree when absFolder is the root of a /folders
+//     request, or a smart listing when absFolder is "".
+// Audit:
+//   - Versions are read before the listing is built, so a change
+//     racing with it yields a new ETag on the next poll.
+// -------------------------------------------------------
+func listingETag(r *http.Request, absFolder string) string {
+    ctx := r.Context()
+    h := sha256.New()
+    fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n", listingNonce, r.URL.Path, r.URL.Query().Encode(),
+        actorName(ctx), timeNow(ctx).UTC().Format("2006-01-02"))
+
+    rel := ""
+    if absFolder != "" {
+        rel = relativeTo(ctx, absFolder)
+    }
+    listingMu.Lock()
+    switch {
+    case rel == "":
+        fmt.Fprintf(h, "all %d\n", listingAll)
+    case r.URL.Path == "/folders":
+        fmt.Fprintf(h, "tree %d\n", listingTree)
+    default:
+        fmt.Fprintf(h, "folder %d\n", listingVersions[rel])
+    }
+    listingMu.Unlock()
+
+    if absFolder != "" {
+        if info, err := statPath(ctx, absFolder); err == nil {
+            fmt.Fprintf(h, "mtime %d\n", info.ModTime().UnixNano())
+        }
+    }
+    hashIndexForListing(ctx, h, rel, r.URL.Path == "/folders")
+    return `"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// -------------------------------------------------------
+// func hashIndexForListing(ctx, h, folder, tree)
+// -------------------------------------------------------
+// Purpose:
+//   - Add the index entries a listing depends on to h: the notes
+//     directly in folder, every note for a smart listing (folder ""),
+//     or only the folders notes live in for the tree.
+// Audit:
+//   - Entries are hashed in path order so the digest is stable.
+// -------------------------------------------------------
+func hashIndexForListing(ctx context.Context, h hash.Hash, folder string, tree bool) {
+    entries := indexSnapshot(ctx)
+    rels := make([]string, 0, len(entries))
+    folders := map[string]bool{}
+    for rel := range entries {
+        dir := path.Dir(rel)
+        switch {
+        case tree:
+            for ; dir != "." && !folders[dir]; dir = path.Dir(dir) {
+                folders[dir] = true
+            }
+        case folder == "" || dir == folder:
+            rels = append(rels, rel)
+        }
+    }
+    for dir := range folders {
+        rels = append(rels, dir)
+    }
+    sort.Strings(rels)
+    for _, rel := range rels {
+        if tree {
+            fmt.Fprintf(h, "%s\n", rel)
+            continue
+        }
+        entry := entries[rel]
+        fmt.Fprintf(h, "%s %s %s %s\n", rel, entry.SHA256, entry.UpdatedAt, entry.Language)
+    }
+}
+
+// -------------------------------------------------------
+// func notModified(w, r, etag) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Set the ETag headers; answer 304 and report true when the
+//     request's If-None-Match already names etag.
+// Audit:
+//   - Weak validators (W/"...") and "*" match as RFC 9110 allows
+//     for If-None-Match.
+//   - Only GET and HEAD are conditional.
+// -------------------------------------------------------
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        return false
+    }
+    w.Header().Set("ETag", etag)
+    w.Header().Set("Cache-Control", "private, no-cache")
+    for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+        candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+        if candidate == etag || candidate == "*" {
+            w.WriteHeader(http.StatusNotModified)
+            return true
+        }
+    }
+    return false
+}
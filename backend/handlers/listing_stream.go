@@ -0,0 +1,296 @@
+// -------------------------------------------------------
+// backend/handlers/listing_stream.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Streamed listings for very large folders:
+//       GET /files?folder=...&format=ndjson
+//       GET /folders?format=ndjson
+//     write one JSON value per line (application/x-ndjson) as entries
+//     are found, instead of buffering the whole array.
+// Audit:
+//   - Each line is exactly what the JSON array form would hold at
+//     that position: a name, a FileEntry (detail=1), a folder path,
+//     or a FolderInfo (include=archived).
+//   - Entries come in directory walk order (by name within each
+//     folder); archived folders (include=archived) follow the live
+//     ones.
+//   - A failure before the first line answers a normal JSON error.
+//     After that the status is already sent, so the stream ends with
+//     a {"error": "..."} line and the failure is logged.
+//   - Lines are flushed every ndjsonFlushEvery entries and at the end.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+const (
+    formatNDJSON     = "ndjson"
+    ndjsonFlushEvery = 100
+    walkBuffer       = 256
+)
+
+// -------------------------------------------------------
+// type ndjsonStream
+// -------------------------------------------------------
+// Purpose:
+//   - Line writer for one streamed response.
+// -------------------------------------------------------
+type ndjsonStream struct {
+    w       http.ResponseWriter
+    r       *http.Request
+    enc     *json.Encoder
+    written int
+}
+
+func newNDJSONStream(w http.ResponseWriter, r *http.Request) *ndjsonStream {
+    return &ndjsonStream{w: w, r: r, enc: json.NewEncoder(w)}
+}
+
+// write sends one value, starting the response on the first call.
+func (s *ndjsonStream) write(v interface{}) error {
+    if s.written == 0 {
+        s.w.Header().Set("Content-Type", "application/x-ndjson")
+        s.w.Header().Set("Cache-Control", "no-store")
+    }
+    if err := s.enc.Encode(v); err != nil {
+        return err
+    }
+    s.written++
+    if s.written%ndjsonFlushEvery == 0 {
+        s.flush()
+    }
+    return nil
+}
+
+func (s *ndjsonStream) flush() {
+    if flusher, ok := s.w.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+// finish ends the stream; err is answered as a JSON error if nothing
+// was sent yet, and as a final {"error"} line otherwise.
+func (s *ndjsonStream) finish(err error, action string) {
+    if err == nil {
+        if s.written == 0 {
+            s.w.Header().Set("Content-Type", "application/x-ndjson")
+            s.w.WriteHeader(http.StatusOK)
+        }
+        s.flush()
+        return
+    }
+    if s.written == 0 {
+        writeStorageError(s.w, s.r, err, action, "Internal server error")
+        return
+    }
+    logError(s.r.Context(), fmt.Sprintf("Streamed listing cut short after %d entries (%s): %v", s.written, action, err))
+    s.enc.Encode(map[string]string{"error": "listing incomplete"})
+    s.flush()
+}
+
+// -------------------------------------------------------
+// func walkPathEach(ctx, root, match, emit) error
+// -------------------------------------------------------
+// Purpose:
+//   - walkPath that hands every entry match accepts to emit, on the
+//     caller's goroutine, while the walk is still running.
+// Audit:
+//   - match runs inside the walk and may return filepath.SkipDir;
+//     emit may write to the response (the walk goroutine never does,
+//     so it cannot touch the writer after the handler returns).
+//   - An emit error stops the walk.
+// -------------------------------------------------------
+func walkPathEach(ctx context.Context, root string, match func(path string, info os.FileInfo) (bool, error), emit func(path string, info os.FileInfo) error) error {
+    type found struct {
+        path string
+        info os.FileInfo
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    items := make(chan found, walkBuffer)
+    done := make(chan error, 1)
+    go func() {
+        done <- walkPath(ctx, root, func(path string, info os.FileInfo, err error) error {
+            if err != nil {
+                return err
+            }
+            ok, err := match(path, info)
+            if ok {
+                select {
+                case items <- found{path, info}:
+                case <-ctx.Done():
+                    return ctx.Err()
+                }
+            }
+            return err
+        })
+    }()
+    for {
+        select {
+        case item := <-items:
+            if err := emit(item.path, item.info); err != nil {
+                return err
+            }
+        case err := <-done:
+            for {
+                select {
+                case item := <-items:
+                    if emitErr := emit(item.path, item.info); emitErr != nil {
+                        return emitErr
+                    }
+                default:
+                    return err
+                }
+            }
+        }
+    }
+}
+
+// -------------------------------------------------------
+// func streamFileList(w, r, absFolder)
+// -------------------------------------------------------
+// Purpose:
+//   - /files?format=ndjson: the notes directly in absFolder.
+// Audit:
+//   - A missing folder is an empty stream, as the array form is [].
+// -------------------------------------------------------
+func streamFileList(w http.ResponseWriter, r *http.Request, absFolder string) {
+    stream := newNDJSONStream(w, r)
+    detail := r.URL.Query().Get("detail") == "1"
+    folderRel := relativeTo(r.Context(), absFolder)
+    keep := listingFilter(r)
+    var states map[string]string
+    var positions map[string]int
+    var languages *languageLookup
+    var frontmatter *frontmatterLookup
+    if detail {
+        states = workflowStates(r.Context())
+        positions = currentOrder(r.Context()).Files
+        languages = newLanguageLookup(r.Context())
+        frontmatter = newFrontmatterLookup(r.Context(), languages.index)
+    }
+    send := func(name string) error {
+        rel := name
+        if folderRel != "." {
+            rel = folderRel + "/" + name
+        }
+        if keep != nil && !keep(rel) {
+            return nil
+        }
+        if !detail {
+            return stream.write(name)
+        }
+        return stream.write(FileEntry{
+            Name:               name,
+            Path:               rel,
+            State:              defaultString(states[rel], stateDraft),
+            UnresolvedComments: unresolvedComments(r.Context(), rel),
+            Position:           positionOf(positions, rel),
+            Language:           languages.of(rel),
+            Attributes:         languages.index[rel].Attributes,
+            Frontmatter:        frontmatter.shown(rel),
+        })
+    }
+
+    if record, inner, archived := archivedFolderFor(r.Context(), folderRel); archived {
+        names, err := listArchivedFiles(r.Context(), record, inner)
+        for _, name := range names {
+            if err != nil {
+                break
+            }
+            err = send(name)
+        }
+        stream.finish(err, "list archived folder: "+absFolder)
+        return
+    }
+
+    ctx := r.Context()
+    if _, err := statPath(ctx, absFolder); os.IsNotExist(err) {
+        stream.finish(nil, "")
+        return
+    }
+    err := walkPathEach(ctx, absFolder, func(path string, info os.FileInfo) (bool, error) {
+        if info.IsDir() && path != absFolder {
+            return false, filepath.SkipDir
+        }
+        return info.Mode().IsRegular() && isNoteName(info.Name()), nil
+    }, func(path string, info os.FileInfo) error {
+        return send(info.Name())
+    })
+    logInfo(ctx, fmt.Sprintf("Streamed %d files in folder: %s", stream.written, absFolder))
+    stream.finish(err, "read folder: "+absFolder)
+}
+
+// -------------------------------------------------------
+// func streamFolderList(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /folders?format=ndjson: every live folder, then archived ones
+//     when include=archived; objects with descriptions when
+//     include=meta.
+// -------------------------------------------------------
+func streamFolderList(w http.ResponseWriter, r *http.Request) {
+    stream := newNDJSONStream(w, r)
+    ctx := r.Context()
+    withArchived, withMeta := folderListIncludes(r)
+    positions := currentOrder(ctx).Folders
+    entries := map[string]FolderMeta{}
+    if withMeta {
+        entries = folderMetaAll(ctx)
+    }
+    root := scratchRoot(ctx)
+
+    if _, err := statPath(ctx, root); os.IsNotExist(err) {
+        stream.finish(nil, "")
+        return
+    }
+    err := walkPathEach(ctx, root, func(path string, info os.FileInfo) (bool, error) {
+        if !info.IsDir() || path == root {
+            return false, nil
+        }
+        if strings.HasPrefix(info.Name(), ".") {
+            return false, filepath.SkipDir
+        }
+        if _, _, archived := archivedFolderFor(ctx, relativeTo(ctx, path)); archived {
+            return false, filepath.SkipDir
+        }
+        return true, nil
+    }, func(path string, info os.FileInfo) error {
+        rel, err := filepath.Rel(root, path)
+        if err != nil {
+            return err
+        }
+        if withArchived || withMeta {
+            return stream.write(withFolderMeta(FolderInfo{Path: rel, Position: positionOf(positions, rel)}, entries))
+        }
+        return stream.write(rel)
+    })
+
+    if err == nil && withArchived {
+        for _, record := range archivedFolders(ctx) {
+            subfolders, listErr := listArchivedSubfolders(ctx, record)
+            if listErr != nil {
+                logError(ctx, "Failed to read archive "+record.ID+": "+listErr.Error())
+            }
+            for _, folder := range subfolders {
+                if err = stream.write(withFolderMeta(FolderInfo{Path: folder, Archived: true, ArchivedAt: record.ArchivedAt, Position: positionOf(positions, folder)}, entries)); err != nil {
+                    break
+                }
+            }
+            if err != nil {
+                break
+            }
+        }
+    }
+    logInfo(ctx, fmt.Sprintf("Streamed %d folders", stream.written))
+    stream.finish(err, "list folders")
+}
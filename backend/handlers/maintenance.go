@@ -0,0 +1,40 @@
+// -------------------------------------------------------
+// backend/handlers/maintenance.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Pause switch for the scheduled writers (trash retention,
+//     link check, compaction, month-end rollover, recurring notes,
+//     expiry rules)
+//     while the service is in maintenance mode, so a backup or a
+//     migration sees no background writes.
+// Audit:
+//   - A paused cycle is skipped, not queued. Rollover and recurring
+//     notes catch up from their state files on the next cycle;
+//     the sweeps simply run again on their next interval.
+//   - Admin jobs (/admin/jobs) are not paused: they are started by
+//     the operator doing the maintenance.
+//   - A follower (follower.go) keeps them paused until promoted:
+//     the primary runs them and the results arrive by sync.
+// -------------------------------------------------------
+
+package handlers
+
+import "sync/atomic"
+
+// schedulesPaused is true while scheduled writers skip their cycles.
+var schedulesPaused atomic.Bool
+
+// -------------------------------------------------------
+// func PauseSchedules(paused bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Pause or resume the scheduled writers.
+// -------------------------------------------------------
+func PauseSchedules(paused bool) {
+    schedulesPaused.Store(paused)
+}
+
+// SchedulesPaused reports whether scheduled writers are paused.
+func SchedulesPaused() bool {
+    return schedulesPaused.Load() || following.Load()
+}
@@ -0,0 +1,431 @@
+// -------------------------------------------------------
+// backend/handlers/markdown.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - The Markdown subset notes use, parsed into blocks (headings,
+//     paragraphs, lists and checklists, pipe tables, block quotes,
+//     fenced code, rules) and inline spans (strong, emphasis,
+//     strikethrough, code, links, line breaks), for the document
+//     exports: HTML (export_html.go) and DOCX (docx_export.go).
+// Audit:
+//   - Parsing never fails: anything not recognised is paragraph
+//     text. Setext headings and indented code blocks are read as
+//     paragraphs; raw HTML is text.
+//   - Block rules match the other readers: ATX headings and fences
+//     as on /file/toc, tables as on the table export.
+//   - Images become their alt text in brackets and wiki-links their
+//     alias or target; nothing is fetched. Only http(s) and mailto
+//     links are kept as links.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "regexp"
+    "strings"
+)
+
+// mdKind is the kind of a Markdown block.
+type mdKind int
+
+const (
+    mdParagraph mdKind = iota
+    mdHeading
+    mdCode
+    mdQuote
+    mdList
+    mdTable
+    mdRule
+)
+
+var (
+    mdListPattern  = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])( +|$)`)
+    mdTaskPattern  = regexp.MustCompile(`^\[([ xX])\] `)
+    mdImagePattern = regexp.MustCompile(`^!\[([^\]]*)\]\((?:[^()\s]|\([^()\s]*\))*\)`)
+    mdWikiPattern  = regexp.MustCompile(`^\[\[([^\[\]|]+)(?:\|([^\[\]]+))?\]\]`)
+    mdLinkPattern  = regexp.MustCompile(`^\[([^\[\]]+)\]\(((?:[^()\s]|\([^()\s]*\))+)\)`)
+)
+
+// -------------------------------------------------------
+// type mdBlock
+// -------------------------------------------------------
+// Purpose:
+//   - One block of a note.
+// Audit:
+//   - Text is inline Markdown for headings and paragraphs and
+//     verbatim for code. Quotes hold Children; lists hold Items;
+//     table rows are padded or cut to the header's width, and
+//     Aligns holds "", "center" or "right" per column.
+// -------------------------------------------------------
+type mdBlock struct {
+    Kind     mdKind
+    Level    int
+    Text     string
+    Children []mdBlock
+    Ordered  bool
+    Items    []mdListItem
+    Header   []string
+    Aligns   []string
+    Rows     [][]string
+}
+
+// mdListItem is one list item; Children are the blocks under it.
+type mdListItem struct {
+    Text     string
+    Task     bool
+    Done     bool
+    Children []mdBlock
+}
+
+// -------------------------------------------------------
+// type mdSpan
+// -------------------------------------------------------
+// Purpose:
+//   - A run of inline text with one formatting. Break is a hard
+//     line break (and has no text).
+// -------------------------------------------------------
+type mdSpan struct {
+    Text   string
+    Bold   bool
+    Italic bool
+    Strike bool
+    Code   bool
+    Break  bool
+    Link   string
+}
+
+// -------------------------------------------------------
+// func parseMarkdownBlocks(content []byte) []mdBlock
+// -------------------------------------------------------
+// Purpose:
+//   - The blocks of a note (frontmatter, if any, is paragraph text;
+//     strip it first).
+// -------------------------------------------------------
+func parseMarkdownBlocks(content []byte) []mdBlock {
+    lines := splitTocLines(content)
+    blocks := []mdBlock{}
+    var paragraph []string
+    flush := func() {
+        if len(paragraph) > 0 {
+            blocks = append(blocks, mdBlock{Kind: mdParagraph, Text: strings.Join(paragraph, "\n")})
+            paragraph = nil
+        }
+    }
+
+    for i := 0; i < len(lines); i++ {
+        line := lines[i].text
+        trimmed := strings.TrimSpace(line)
+        if trimmed == "" {
+            flush()
+            continue
+        }
+        if marker := fenceMarker(line); marker != "" {
+            flush()
+            var code []string
+            for i++; i < len(lines); i++ {
+                closing := strings.TrimSpace(lines[i].text)
+                if strings.HasPrefix(closing, marker) && strings.Trim(closing, marker[:1]) == "" {
+                    break
+                }
+                code = append(code, lines[i].text)
+            }
+            blocks = append(blocks, mdBlock{Kind: mdCode, Text: strings.Join(code, "\n")})
+            continue
+        }
+        if level, text, ok := atxHeading(line); ok {
+            flush()
+            blocks = append(blocks, mdBlock{Kind: mdHeading, Level: level, Text: text})
+            continue
+        }
+        if isThematicBreak(trimmed) {
+            flush()
+            blocks = append(blocks, mdBlock{Kind: mdRule})
+            continue
+        }
+        if strings.HasPrefix(trimmed, ">") {
+            flush()
+            var quoted []string
+            for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i].text), ">"); i++ {
+                inner := strings.TrimPrefix(strings.TrimSpace(lines[i].text), ">")
+                quoted = append(quoted, strings.TrimPrefix(inner, " "))
+            }
+            i--
+            blocks = append(blocks, mdBlock{Kind: mdQuote, Children: parseMarkdownBlocks([]byte(strings.Join(quoted, "\n")))})
+            continue
+        }
+        if mdListPattern.MatchString(line) {
+            flush()
+            var list mdBlock
+            list, i = parseMarkdownList(lines, i)
+            blocks = append(blocks, list)
+            i--
+            continue
+        }
+        if strings.Contains(line, "|") && i+1 < len(lines) {
+            if header := splitTableRow(line); isTableDelimiter(lines[i+1].text, len(header)) {
+                flush()
+                var table mdBlock
+                table, i = parseMarkdownTable(lines, i, header)
+                blocks = append(blocks, table)
+                i--
+                continue
+            }
+        }
+        // Trailing spaces are kept: two of them break the line.
+        paragraph = append(paragraph, strings.TrimLeft(line, " \t"))
+    }
+    flush()
+    return blocks
+}
+
+// isThematicBreak reports whether a trimmed line is ---, *** or ___.
+func isThematicBreak(trimmed string) bool {
+    compact := strings.ReplaceAll(trimmed, " ", "")
+    return len(compact) >= 3 && (strings.Trim(compact, "-") == "" || strings.Trim(compact, "*") == "" || strings.Trim(compact, "_") == "")
+}
+
+// -------------------------------------------------------
+// func parseMarkdownList(lines, start) (mdBlock, int)
+// -------------------------------------------------------
+// Purpose:
+//   - The list starting at lines[start], and the index of the
+//     first line after it.
+// Audit:
+//   - Lines indented past the item marker belong to the item and
+//     are parsed as its children, so nested lists nest. A blank
+//     line ends the list unless an item or indented line follows.
+// -------------------------------------------------------
+func parseMarkdownList(lines []tocLine, start int) (mdBlock, int) {
+    first := mdListPattern.FindStringSubmatch(lines[start].text)
+    indent := len(first[1])
+    list := mdBlock{Kind: mdList, Ordered: isOrderedMarker(first[2])}
+
+    i := start
+    for i < len(lines) {
+        match := mdListPattern.FindStringSubmatch(lines[i].text)
+        if match == nil || len(match[1]) != indent || isOrderedMarker(match[2]) != list.Ordered {
+            break
+        }
+        width := len(match[0])
+        body := []string{lines[i].text[width:]}
+        for i++; i < len(lines); i++ {
+            text := lines[i].text
+            if strings.TrimSpace(text) == "" {
+                if i+1 < len(lines) && leadingSpaces(lines[i+1].text) >= width {
+                    body = append(body, "")
+                    continue
+                }
+                break
+            }
+            if leadingSpaces(text) < width && (mdListPattern.MatchString(text) || leadingSpaces(text) <= indent) {
+                break
+            }
+            body = append(body, strings.TrimPrefix(text, strings.Repeat(" ", min(width, leadingSpaces(text)))))
+        }
+
+        item := mdListItem{}
+        if task := mdTaskPattern.FindStringSubmatch(body[0]); task != nil {
+            item.Task, item.Done = true, task[1] != " "
+            body[0] = body[0][len(task[0]):]
+        }
+        item.Text = strings.TrimSpace(body[0])
+        if len(body) > 1 {
+            item.Children = parseMarkdownBlocks([]byte(strings.Join(body[1:], "\n")))
+        }
+        list.Items = append(list.Items, item)
+        // A blank line between items does not end the list.
+        for i < len(lines) && strings.TrimSpace(lines[i].text) == "" && i+1 < len(lines) && mdListPattern.MatchString(lines[i+1].text) {
+            i++
+        }
+    }
+    return list, i
+}
+
+// isOrderedMarker reports whether a list marker is numbered (1. or 1)).
+func isOrderedMarker(marker string) bool {
+    return strings.ContainsAny(marker[len(marker)-1:], ".)")
+}
+
+// leadingSpaces counts the spaces a line starts with (a tab counts 4).
+func leadingSpaces(line string) int {
+    n := 0
+    for _, c := range line {
+        switch c {
+        case ' ':
+            n++
+        case '\t':
+            n += 4
+        default:
+            return n
+        }
+    }
+    return n
+}
+
+// -------------------------------------------------------
+// func parseMarkdownTable(lines, start, header) (mdBlock, int)
+// -------------------------------------------------------
+// Purpose:
+//   - The pipe table whose header is lines[start], and the index
+//     of the first line after it.
+// Audit:
+//   - Column alignment follows the delimiter row (":--", ":-:",
+//     "--:").
+// -------------------------------------------------------
+func parseMarkdownTable(lines []tocLine, start int, header []string) (mdBlock, int) {
+    table := mdBlock{Kind: mdTable, Header: header}
+    for _, cell := range splitTableRow(lines[start+1].text) {
+        switch {
+        case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+            table.Aligns = append(table.Aligns, "center")
+        case strings.HasSuffix(cell, ":"):
+            table.Aligns = append(table.Aligns, "right")
+        default:
+            table.Aligns = append(table.Aligns, "")
+        }
+    }
+    i := start + 2
+    for ; i < len(lines) && strings.TrimSpace(lines[i].text) != "" && strings.Contains(lines[i].text, "|"); i++ {
+        cells := splitTableRow(lines[i].text)
+        row := make([]string, len(header))
+        copy(row, cells)
+        table.Rows = append(table.Rows, row)
+    }
+    return table, i
+}
+
+// -------------------------------------------------------
+// func parseInline(text string) []mdSpan
+// -------------------------------------------------------
+// Purpose:
+//   - The inline spans of a heading, paragraph, list item or cell.
+// Audit:
+//   - "\" escapes ASCII punctuation. ** (strong), * (emphasis) and
+//     ~~ (strikethrough) only open before a non-space with a closing
+//     marker further on, and only close after a non-space;
+//     otherwise they are text. Code spans are verbatim.
+//   - A newline after two or more spaces is a hard break; other
+//     newlines are kept in the text.
+// -------------------------------------------------------
+func parseInline(text string) []mdSpan {
+    spans := []mdSpan{}
+    var buf strings.Builder
+    var bold, italic, strike bool
+    emit := func() {
+        if buf.Len() > 0 {
+            spans = append(spans, mdSpan{Text: buf.String(), Bold: bold, Italic: italic, Strike: strike})
+            buf.Reset()
+        }
+    }
+    // toggle flips one formatting at a marker when it may open or
+    // close there.
+    toggle := func(on *bool, i int, marker string) bool {
+        after := i + len(marker)
+        if *on {
+            if i == 0 || text[i-1] == ' ' || text[i-1] == '\n' {
+                return false
+            }
+        } else if after >= len(text) || text[after] == ' ' || text[after] == '\n' || !strings.Contains(text[after+1:], marker) {
+            return false
+        }
+        emit()
+        *on = !*on
+        return true
+    }
+
+    for i := 0; i < len(text); {
+        c := text[i]
+        rest := text[i:]
+        switch {
+        case c == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]):
+            buf.WriteByte(text[i+1])
+            i += 2
+            continue
+        case c == '`':
+            ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+            closing := strings.Index(text[i+ticks:], strings.Repeat("`", ticks))
+            if closing < 0 {
+                buf.WriteString(rest[:ticks])
+                i += ticks
+                continue
+            }
+            emit()
+            spans = append(spans, mdSpan{Text: strings.TrimSpace(text[i+ticks : i+ticks+closing]), Code: true})
+            i += ticks + closing + ticks
+            continue
+        case c == ' ':
+            spaces := len(rest) - len(strings.TrimLeft(rest, " "))
+            if spaces >= 2 && i+spaces < len(text) && text[i+spaces] == '\n' {
+                emit()
+                spans = append(spans, mdSpan{Break: true})
+                i += spaces + 1
+                continue
+            }
+        case c == '!':
+            if m := mdImagePattern.FindStringSubmatch(rest); m != nil {
+                buf.WriteString("[" + m[1] + "]")
+                i += len(m[0])
+                continue
+            }
+        case c == '[':
+            if m := mdWikiPattern.FindStringSubmatch(rest); m != nil {
+                buf.WriteString(strings.TrimSpace(defaultString(m[2], m[1])))
+                i += len(m[0])
+                continue
+            }
+            if m := mdLinkPattern.FindStringSubmatch(rest); m != nil {
+                target := strings.ToLower(m[2])
+                if strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "mailto:") {
+                    emit()
+                    spans = append(spans, mdSpan{Text: m[1], Bold: bold, Italic: italic, Strike: strike, Link: m[2]})
+                } else {
+                    buf.WriteString(m[1])
+                }
+                i += len(m[0])
+                continue
+            }
+        case strings.HasPrefix(rest, "**"):
+            if toggle(&bold, i, "**") {
+                i += 2
+                continue
+            }
+            buf.WriteString(rest[:2])
+            i += 2
+            continue
+        case strings.HasPrefix(rest, "~~"):
+            if toggle(&strike, i, "~~") {
+                i += 2
+                continue
+            }
+            buf.WriteString(rest[:2])
+            i += 2
+            continue
+        case c == '*':
+            if toggle(&italic, i, "*") {
+                i++
+                continue
+            }
+        }
+        buf.WriteByte(c)
+        i++
+    }
+    emit()
+    return spans
+}
+
+// isASCIIPunct reports whether c may be escaped with a backslash.
+func isASCIIPunct(c byte) bool {
+    return c >= '!' && c <= '/' || c >= ':' && c <= '@' || c >= '[' && c <= '`' || c >= '{' && c <= '~'
+}
+
+// plainInline is the text of inline Markdown without formatting.
+func plainInline(text string) string {
+    var b strings.Builder
+    for _, span := range parseInline(text) {
+        if span.Break {
+            b.WriteString("\n")
+        }
+        b.WriteString(span.Text)
+    }
+    return b.String()
+}
@@ -0,0 +1,348 @@
+// -------------------------------------------------------
+// backend/handlers/merge.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Three-way merge of text notes (diff3):
+//       POST /file/merge {"base", "mine", "theirs"}
+//     returns the merged text; regions changed differently on both
+//     sides are wrapped in conflict markers.
+// Audit:
+//   - Pure computation: nothing is read from or written to disk.
+//   - Line-based. Diffs use Myers' O(ND) algorithm, so cost grows
+//     with the size of the edits rather than the size of the note.
+//     Past maxDiffEdits the search stops; a merge then reports the
+//     whole note as one conflict.
+//   - Request bodies are limited to maxMergeBytes (413).
+//   - Markers follow the diff3 style (git merge.conflictStyle=diff3):
+//       <<<<<<< mine / ||||||| base / ======= / >>>>>>> theirs
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    // maxMergeBytes bounds a /file/merge request body.
+    maxMergeBytes = 8 << 20
+    // maxDiffEdits bounds the edit distance diffMatches searches;
+    // its trace holds about maxDiffEdits² ints.
+    maxDiffEdits = 1000
+)
+
+const (
+    markerMine   = "<<<<<<< mine\n"
+    markerBase   = "||||||| base\n"
+    markerSplit  = "=======\n"
+    markerTheirs = ">>>>>>> theirs\n"
+)
+
+// -------------------------------------------------------
+// type MergeResult
+// -------------------------------------------------------
+// Purpose:
+//   - Outcome of a three-way merge.
+// -------------------------------------------------------
+type MergeResult struct {
+    Merged    string `json:"merged"`
+    Conflicts int    `json:"conflicts"`
+    Clean     bool   `json:"clean"`
+}
+
+// -------------------------------------------------------
+// func splitLines(s string) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Split text into lines, each keeping its "\n" terminator (the
+//     last line may have none), so joining restores s exactly.
+// -------------------------------------------------------
+func splitLines(s string) []string {
+    lines := []string{}
+    for len(s) > 0 {
+        i := strings.IndexByte(s, '\n')
+        if i < 0 {
+            lines = append(lines, s)
+            break
+        }
+        lines = append(lines, s[:i+1])
+        s = s[i+1:]
+    }
+    return lines
+}
+
+// -------------------------------------------------------
+// func diffMatches(a, b []string) ([]int, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Longest common subsequence of two line slices: match[i] is
+//     the index in b of line a[i], or -1 if a[i] was removed.
+// Audit:
+//   - Myers' greedy algorithm saving the 2d+1 live diagonals of V
+//     per edit step d; memory is O(D²) for D edits.
+//   - Beyond maxDiffEdits it gives up and returns false, with only
+//     the common prefix and suffix matched (still a valid, if not
+//     minimal, diff).
+// -------------------------------------------------------
+func diffMatches(a, b []string) ([]int, bool) {
+    match := make([]int, len(a))
+    for i := range match {
+        match[i] = -1
+    }
+
+    // Common prefix and suffix never need the search.
+    start := 0
+    for start < len(a) && start < len(b) && a[start] == b[start] {
+        match[start] = start
+        start++
+    }
+    endA, endB := len(a), len(b)
+    for endA > start && endB > start && a[endA-1] == b[endB-1] {
+        endA--
+        endB--
+        match[endA] = endB
+    }
+
+    n, m := endA-start, endB-start
+    if n == 0 || m == 0 {
+        return match, true
+    }
+    max := n + m
+    offset := max + 1
+    v := make([]int, 2*max+2)
+    trace := [][]int{}
+
+    found := false
+    for d := 0; d <= max && !found; d++ {
+        if d > maxDiffEdits {
+            return match, false
+        }
+        // trace[d][k+d] is V at diagonal k before step d.
+        snapshot := make([]int, 2*d+1)
+        copy(snapshot, v[offset-d:offset+d+1])
+        trace = append(trace, snapshot)
+        for k := -d; k <= d; k += 2 {
+            var x int
+            if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+                x = v[offset+k+1]
+            } else {
+                x = v[offset+k-1] + 1
+            }
+            y := x - k
+            for x < n && y < m && a[start+x] == b[start+y] {
+                x++
+                y++
+            }
+            v[offset+k] = x
+            if x >= n && y >= m {
+                found = true
+                break
+            }
+        }
+    }
+
+    // Walk the trace backwards, recording the diagonal (equal) runs.
+    x, y := n, m
+    for d := len(trace) - 1; d >= 0 && (x > 0 || y > 0); d-- {
+        prevX, prevY := 0, 0
+        if d > 0 {
+            vd := trace[d]
+            k := x - y
+            var prevK int
+            if k == -d || (k != d && vd[k-1+d] < vd[k+1+d]) {
+                prevK = k + 1
+            } else {
+                prevK = k - 1
+            }
+            prevX = vd[prevK+d]
+            prevY = prevX - prevK
+        }
+        for x > prevX && y > prevY {
+            x--
+            y--
+            match[start+x] = start + y
+        }
+        x, y = prevX, prevY
+    }
+    return match, true
+}
+
+// -------------------------------------------------------
+// func joinLines(lines []string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Concatenate lines produced by splitLines.
+// -------------------------------------------------------
+func joinLines(lines []string) string {
+    return strings.Join(lines, "")
+}
+
+// -------------------------------------------------------
+// func sameLines(a, b []string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether two line slices are identical.
+// -------------------------------------------------------
+func sameLines(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+// -------------------------------------------------------
+// func writeConflictBlock(out, mine, base, theirs)
+// -------------------------------------------------------
+// Purpose:
+//   - Emit one diff3-style conflict region.
+// Audit:
+//   - A side whose last line has no newline gets one, so markers
+//     always start on their own line.
+// -------------------------------------------------------
+func writeConflictBlock(out *strings.Builder, mine, base, theirs []string) {
+    section := func(marker string, lines []string) {
+        out.WriteString(marker)
+        text := joinLines(lines)
+        out.WriteString(text)
+        if text != "" && !strings.HasSuffix(text, "\n") {
+            out.WriteString("\n")
+        }
+    }
+    section(markerMine, mine)
+    section(markerBase, base)
+    section(markerSplit, theirs)
+    out.WriteString(markerTheirs)
+}
+
+// -------------------------------------------------------
+// func Merge3(base, mine, theirs string) MergeResult
+// -------------------------------------------------------
+// Purpose:
+//   - diff3 merge: alternate stable chunks (unchanged on both sides)
+//     with unstable chunks, taking whichever side changed; chunks
+//     changed differently on both sides become conflicts.
+// Audit:
+//   - Identical changes on both sides merge cleanly.
+//   - When either side is too far from base to diff (maxDiffEdits),
+//     the whole note is one conflict unless only one side changed.
+// -------------------------------------------------------
+func Merge3(base, mine, theirs string) MergeResult {
+    o, a, b := splitLines(base), splitLines(mine), splitLines(theirs)
+    matchA, okA := diffMatches(o, a)
+    matchB, okB := diffMatches(o, b)
+
+    var out strings.Builder
+    result := MergeResult{}
+    if !okA || !okB {
+        switch {
+        case mine == theirs || theirs == base:
+            out.WriteString(mine)
+        case mine == base:
+            out.WriteString(theirs)
+        default:
+            writeConflictBlock(&out, a, o, b)
+            result.Conflicts++
+        }
+        result.Merged = out.String()
+        result.Clean = result.Conflicts == 0
+        return result
+    }
+    po, pa, pb := 0, 0, 0
+    for po < len(o) || pa < len(a) || pb < len(b) {
+        // Stable run: base line present at the current spot in both.
+        run := 0
+        for po+run < len(o) && matchA[po+run] == pa+run && matchB[po+run] == pb+run {
+            run++
+        }
+        if run > 0 {
+            out.WriteString(joinLines(o[po : po+run]))
+            po += run
+            pa += run
+            pb += run
+            continue
+        }
+
+        // Unstable chunk: up to the next base line kept by both.
+        next := po
+        for next < len(o) && (matchA[next] < 0 || matchB[next] < 0) {
+            next++
+        }
+        endA, endB := len(a), len(b)
+        if next < len(o) {
+            endA, endB = matchA[next], matchB[next]
+        }
+        chunkO, chunkA, chunkB := o[po:next], a[pa:endA], b[pb:endB]
+
+        switch {
+        case sameLines(chunkA, chunkO):
+            out.WriteString(joinLines(chunkB))
+        case sameLines(chunkB, chunkO), sameLines(chunkA, chunkB):
+            out.WriteString(joinLines(chunkA))
+        default:
+            writeConflictBlock(&out, chunkA, chunkO, chunkB)
+            result.Conflicts++
+        }
+        po, pa, pb = next, endA, endB
+    }
+
+    result.Merged = out.String()
+    result.Clean = result.Conflicts == 0
+    return result
+}
+
+// -------------------------------------------------------
+// func HandleFileMerge(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/merge {"base", "mine", "theirs"}: three-way merge.
+// Audit:
+//   - Always 200 when the request is valid; callers check "clean".
+//   - Bodies over maxMergeBytes are 413; malformed JSON is
+//     invalid_json.
+// -------------------------------------------------------
+func HandleFileMerge(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        Base   *string `json:"base"`
+        Mine   *string `json:"mine"`
+        Theirs *string `json:"theirs"`
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, maxMergeBytes)
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if req.Base == nil || req.Mine == nil || req.Theirs == nil {
+        apierror.Write(w, r, apierror.CodeMissingField, "", "Bad request: base, mine, and theirs are required")
+        return
+    }
+
+    var result MergeResult
+    err := runWithContext(r.Context(), func() error {
+        result = Merge3(*req.Base, *req.Mine, *req.Theirs)
+        return nil
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "merge", "Merge failed")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Merged note versions: %d conflicts", result.Conflicts))
+    w.Header().Set("Content-Type", "application/json")
+    enc := json.NewEncoder(w)
+    enc.SetEscapeHTML(false)
+    enc.Encode(result)
+}
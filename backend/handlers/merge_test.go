@@ -0,0 +1,160 @@
+// -------------------------------------------------------
+// backend/handlers/merge_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests for the diff3 three-way merge (Merge3).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "fmt"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "cfo-scratchpad/apierror"
+)
+
+func TestMerge3(t *testing.T) {
+    base := "revenue\ncosts\nmargin\nnotes\n"
+    for _, tc := range []struct {
+        name         string
+        base, mine   string
+        theirs, want string
+        conflicts    int
+    }{
+        {"no changes", base, base, base, base, 0},
+        {"only mine changed", base, "revenue\ncosts Q3\nmargin\nnotes\n", base,
+            "revenue\ncosts Q3\nmargin\nnotes\n", 0},
+        {"only theirs changed", base, base, "revenue\ncosts\nmargin 12%\nnotes\n",
+            "revenue\ncosts\nmargin 12%\nnotes\n", 0},
+        {"separate regions", base, "revenue FY\ncosts\nmargin\nnotes\n", "revenue\ncosts\nmargin\nnotes\nsigned\n",
+            "revenue FY\ncosts\nmargin\nnotes\nsigned\n", 0},
+        {"same change on both sides", base, "revenue\ncosts\nmargin 9%\nnotes\n", "revenue\ncosts\nmargin 9%\nnotes\n",
+            "revenue\ncosts\nmargin 9%\nnotes\n", 0},
+        {"deletion and untouched", base, "revenue\nmargin\nnotes\n", base, "revenue\nmargin\nnotes\n", 0},
+        {"conflicting edits", base, "revenue\ncosts\nmargin 9%\nnotes\n", "revenue\ncosts\nmargin 11%\nnotes\n",
+            "revenue\ncosts\n<<<<<<< mine\nmargin 9%\n||||||| base\nmargin\n=======\nmargin 11%\n>>>>>>> theirs\nnotes\n", 1},
+        {"conflict without final newline", "a\nb", "a\nmine", "a\ntheirs",
+            "a\n<<<<<<< mine\nmine\n||||||| base\nb\n=======\ntheirs\n>>>>>>> theirs\n", 1},
+        {"both append differently", "", "x\n", "y\n",
+            "<<<<<<< mine\nx\n||||||| base\n=======\ny\n>>>>>>> theirs\n", 1},
+    } {
+        got := Merge3(tc.base, tc.mine, tc.theirs)
+        if got.Merged != tc.want || got.Conflicts != tc.conflicts || got.Clean != (tc.conflicts == 0) {
+            t.Errorf("%s: Merge3 = %q (%d conflicts, clean=%t), want %q (%d conflicts)",
+                tc.name, got.Merged, got.Conflicts, got.Clean, tc.want, tc.conflicts)
+        }
+    }
+}
+
+func TestMerge3TwoConflicts(t *testing.T) {
+    base := strings.Repeat("line\n", 3) + "a\n" + strings.Repeat("keep\n", 5) + "b\n"
+    mine := strings.Repeat("line\n", 3) + "a1\n" + strings.Repeat("keep\n", 5) + "b1\n"
+    theirs := strings.Repeat("line\n", 3) + "a2\n" + strings.Repeat("keep\n", 5) + "b2\n"
+
+    got := Merge3(base, mine, theirs)
+    if got.Conflicts != 2 || strings.Count(got.Merged, markerMine) != 2 {
+        t.Fatalf("Merge3 = %d conflicts:\n%s", got.Conflicts, got.Merged)
+    }
+    if !strings.Contains(got.Merged, ">>>>>>> theirs\n"+strings.Repeat("keep\n", 5)+"<<<<<<< mine\n") {
+        t.Fatalf("stable lines between conflicts not kept:\n%s", got.Merged)
+    }
+}
+
+func TestSplitLinesRoundTrip(t *testing.T) {
+    for _, s := range []string{"", "a", "a\n", "a\nb", "a\n\nb\n", "\n\n"} {
+        if got := joinLines(splitLines(s)); got != s {
+            t.Errorf("joinLines(splitLines(%q)) = %q", s, got)
+        }
+    }
+}
+
+// lcsLength is the textbook dynamic-programming LCS length.
+func lcsLength(a, b []string) int {
+    prev := make([]int, len(b)+1)
+    for i := range a {
+        cur := make([]int, len(b)+1)
+        for j := range b {
+            if a[i] == b[j] {
+                cur[j+1] = prev[j] + 1
+            } else {
+                cur[j+1] = max(cur[j], prev[j+1])
+            }
+        }
+        prev = cur
+    }
+    return prev[len(b)]
+}
+
+func TestDiffMatchesIsLongestCommonSubsequence(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    lines := func() []string {
+        out := make([]string, rng.Intn(30))
+        for i := range out {
+            out[i] = string(rune('a' + rng.Intn(4)))
+        }
+        return out
+    }
+    for round := 0; round < 500; round++ {
+        a, b := lines(), lines()
+        match, ok := diffMatches(a, b)
+        if !ok {
+            t.Fatalf("diffMatches gave up on %d and %d lines", len(a), len(b))
+        }
+        common, last := 0, -1
+        for i, j := range match {
+            if j < 0 {
+                continue
+            }
+            if j <= last || a[i] != b[j] {
+                t.Fatalf("invalid match %v for %q / %q", match, a, b)
+            }
+            common, last = common+1, j
+        }
+        if want := lcsLength(a, b); common != want {
+            t.Fatalf("matched %d lines of %q / %q, LCS is %d", common, a, b, want)
+        }
+    }
+}
+
+func TestMerge3BeyondEditLimit(t *testing.T) {
+    var base, mine, theirs strings.Builder
+    for i := 0; i < maxDiffEdits; i++ {
+        fmt.Fprintf(&base, "base %d\n", i)
+        fmt.Fprintf(&mine, "mine %d\n", i)
+        fmt.Fprintf(&theirs, "theirs %d\n", i)
+    }
+    if _, ok := diffMatches(splitLines(base.String()), splitLines(mine.String())); ok {
+        t.Fatalf("diffMatches searched past maxDiffEdits")
+    }
+
+    got := Merge3(base.String(), mine.String(), theirs.String())
+    want := markerMine + mine.String() + markerBase + base.String() + markerSplit + theirs.String() + markerTheirs
+    if got.Conflicts != 1 || got.Merged != want {
+        t.Fatalf("Merge3 beyond the limit = %d conflicts, %d bytes", got.Conflicts, len(got.Merged))
+    }
+    if got := Merge3(base.String(), mine.String(), base.String()); !got.Clean || got.Merged != mine.String() {
+        t.Fatalf("one-sided change beyond the limit did not merge cleanly")
+    }
+}
+
+func TestHandleFileMergeRejectsBadBodies(t *testing.T) {
+    for _, tc := range []struct {
+        name, body string
+        code       string
+    }{
+        {"malformed", `{"base": "a"`, apierror.CodeInvalidJSON},
+        {"missing side", `{"base": "a", "mine": "b"}`, apierror.CodeMissingField},
+        {"too large", `{"base": "` + strings.Repeat("x", maxMergeBytes) + `"}`, apierror.CodePayloadTooLarge},
+    } {
+        rec := httptest.NewRecorder()
+        HandleFileMerge(rec, httptest.NewRequest(http.MethodPost, "/file/merge", strings.NewReader(tc.body)))
+        if !strings.Contains(rec.Body.String(), `"`+tc.code+`"`) {
+            t.Errorf("%s: %d %s, want code %s", tc.name, rec.Code, rec.Body, tc.code)
+        }
+    }
+}
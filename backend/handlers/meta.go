@@ -0,0 +1,138 @@
+// -------------------------------------------------------
+// backend/handlers/meta.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - System metadata storage under <scratchRoot>/.scratchpad/.
+//   - JSON load/save helpers used by the index and sidecar data.
+// Audit:
+//   - The directory is hidden from listings and unreachable through
+//     the file API (dot-prefixed names are reserved by policy).
+//   - Saves are atomic (temp file + rename) so a crash never leaves
+//     half-written metadata.
+//   - All access goes through the Server's Storage, which checks
+//     the chain for symlinks (OSStorage) or keeps it in memory.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const metaDirName = ".scratchpad"
+
+// -------------------------------------------------------
+// func metaPath(ctx context.Context, parts ...string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Absolute path of an entry inside the metadata directory.
+// -------------------------------------------------------
+func metaPath(ctx context.Context, parts ...string) string {
+    return filepath.Join(append([]string{scratchRoot(ctx), metaDirName}, parts...)...)
+}
+
+// -------------------------------------------------------
+// func loadMetaJSON(ctx context.Context, name string, v interface{}) error
+// -------------------------------------------------------
+// Purpose:
+//   - Decode a metadata JSON file into v.
+// Audit:
+//   - A missing file is not an error; v is left unchanged.
+// -------------------------------------------------------
+func loadMetaJSON(ctx context.Context, name string, v interface{}) error {
+    data, err := serverFrom(ctx).Storage.ReadFile(metaPath(ctx, name))
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("corrupt metadata %s: %v", name, err)
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func saveMetaJSON(ctx context.Context, name string, v interface{}) error
+// -------------------------------------------------------
+// Purpose:
+//   - Atomically write v as indented JSON to the metadata file.
+// Audit:
+//   - Creates the metadata directory (and subdirectories) on demand.
+// -------------------------------------------------------
+func saveMetaJSON(ctx context.Context, name string, v interface{}) error {
+    data, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeMetaFile(ctx, name, data)
+}
+
+// -------------------------------------------------------
+// func writeMetaFile(ctx context.Context, name string, data []byte) error
+// -------------------------------------------------------
+// Purpose:
+//   - Atomically replace a metadata file with data.
+// -------------------------------------------------------
+func writeMetaFile(ctx context.Context, name string, data []byte) error {
+    return writeMetaFilePerm(ctx, name, data, 0644)
+}
+
+// -------------------------------------------------------
+// func writeMetaFilePerm(ctx context.Context, name string, data []byte, perm os.FileMode) error
+// -------------------------------------------------------
+// Purpose:
+//   - writeMetaFile with explicit permissions (0600 for secrets).
+// Audit:
+//   - Listing ETags are not touched here; writers of metadata that
+//     listings show do that themselves (listing_etag.go).
+// -------------------------------------------------------
+func writeMetaFilePerm(ctx context.Context, name string, data []byte, perm os.FileMode) error {
+    store := serverFrom(ctx).Storage
+    path := metaPath(ctx, name)
+    if err := store.MkdirAll(filepath.Dir(path)); err != nil {
+        return err
+    }
+
+    tmp := fmt.Sprintf("%s.tmp-%d", path, time.Now().UnixNano())
+    f, err := store.Create(tmp, perm)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        store.Remove(tmp)
+        return err
+    }
+    if err := f.Close(); err != nil {
+        store.Remove(tmp)
+        return err
+    }
+    return store.Rename(tmp, path)
+}
+
+// -------------------------------------------------------
+// func renameNoteMeta(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Carry per-note sidecar records (ledger mode, signatures,
+//     workflow state, comments, sort position, language override,
+//     OCR sidecar link) along when a note is moved.
+// Audit:
+//   - The index and journal are handled by the callers.
+// -------------------------------------------------------
+func renameNoteMeta(ctx context.Context, from, to string) {
+    ledgerRename(ctx, from, to)
+    signaturesRename(ctx, from, to)
+    workflowRename(ctx, from, to)
+    commentsRename(ctx, from, to)
+    orderRename(ctx, from, to)
+    languageRename(ctx, from, to)
+    ocrRename(ctx, from, to)
+}
@@ -0,0 +1,501 @@
+// -------------------------------------------------------
+// backend/handlers/ocr.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - OCR ingestion: scanned invoices, receipts and contracts kept
+//     as raw attachments (raw.go) get a sidecar note holding their
+//     text, so /search finds them.
+//       Invoices/scan-0412.pdf  ->  Invoices/scan-0412.pdf.ocr.md
+//   - Extraction runs as the "ocr" background job (jobs.go): for one
+//     attachment ({"path"}) or every attachment in the raw folders.
+//     With ocr.auto each upload queues its own job.
+//   - Engines are pluggable (ocrBackends): "command" runs a program
+//     on this host (e.g. tesseract), "http" posts the file to an OCR
+//     service on premises.
+//   - Registry: .scratchpad/ocr.json (attachment -> OCRRecord).
+// Audit:
+//   - Sidecars are ordinary notes: indexed, journaled, kept as
+//     revisions, and searchable. Search results for a sidecar name
+//     its attachment.
+//   - An attachment whose SHA-256 is unchanged is not extracted
+//     again unless the job has force=true.
+//   - A sidecar edited by hand, approved, held, or in ledger mode is
+//     never overwritten; the attachment is reported as skipped.
+//   - Each extraction writes "file.ocr" with the attachment, its
+//     SHA-256 and the number of characters recognized.
+// Configuration:
+//   - ocr.backend / OCR_BACKEND       "" (off, default), command, http
+//   - ocr.command / OCR_COMMAND       program and arguments
+//   - ocr.url / OCR_URL               OCR service endpoint
+//   - ocr.languages / OCR_LANGUAGES   default "eng"
+//   - ocr.extensions                  default .pdf and common images
+//   - ocr.auto / OCR_AUTO             default true
+//   - ocr.max_bytes / OCR_MAX_BYTES   default 50 MiB
+//   - ocr.timeout / OCR_TIMEOUT       default 5m
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+    "unicode/utf8"
+
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+const (
+    ocrFile      = "ocr.json"
+    ocrSuffix    = ".ocr.md"
+    ocrMaxText   = 8 << 20
+    ocrMaxStderr = 512
+)
+
+// ocrMu guards ocr.json.
+var ocrMu sync.Mutex
+
+// -------------------------------------------------------
+// type OCRRecord
+// -------------------------------------------------------
+// Purpose:
+//   - The last extraction of one attachment.
+// Audit:
+//   - NoteSHA256 is the sidecar as written; a sidecar that no longer
+//     matches it was edited and is left alone.
+// -------------------------------------------------------
+type OCRRecord struct {
+    Attachment   string `json:"attachment"`
+    Note         string `json:"note"`
+    SourceSHA256 string `json:"source_sha256"`
+    NoteSHA256   string `json:"note_sha256"`
+    Chars        int    `json:"chars"`
+    Backend      string `json:"backend"`
+    ExtractedAt  string `json:"extracted_at"`
+}
+
+// -------------------------------------------------------
+// type OCRReport / OCRSkip
+// -------------------------------------------------------
+// Purpose:
+//   - Result of an "ocr" job.
+// -------------------------------------------------------
+type OCRReport struct {
+    Scanned   int       `json:"scanned"`
+    Extracted []string  `json:"extracted"`
+    Unchanged int       `json:"unchanged"`
+    Skipped   []OCRSkip `json:"skipped"`
+    Failed    []OCRSkip `json:"failed"`
+}
+
+type OCRSkip struct {
+    Path   string `json:"path"`
+    Reason string `json:"reason"`
+}
+
+// -------------------------------------------------------
+// type ocrBackend
+// -------------------------------------------------------
+// Purpose:
+//   - One way of turning an image or PDF into text.
+// -------------------------------------------------------
+type ocrBackend interface {
+    extract(ctx context.Context, data []byte, name string) (string, error)
+}
+
+// ocrBackends builds the backend named by ocr.backend.
+var ocrBackends = map[string]func(cfg config.OCRConfig) ocrBackend{
+    "command": func(cfg config.OCRConfig) ocrBackend { return ocrCommand{argv: cfg.Command, languages: cfg.Languages} },
+    "http":    func(cfg config.OCRConfig) ocrBackend { return ocrHTTP{url: cfg.URL, languages: cfg.Languages} },
+}
+
+// -------------------------------------------------------
+// type ocrCommand
+// -------------------------------------------------------
+// Purpose:
+//   - Backend running a local program, e.g.
+//       tesseract {input} stdout -l {lang}
+//     The text is read from its stdout.
+// Audit:
+//   - With {input}, the attachment is copied to a private temporary
+//     file (extension kept, removed afterwards); without it, the
+//     bytes go to stdin. No shell is involved.
+// -------------------------------------------------------
+type ocrCommand struct {
+    argv      []string
+    languages string
+}
+
+func (b ocrCommand) extract(ctx context.Context, data []byte, name string) (string, error) {
+    input := ""
+    for _, arg := range b.argv[1:] {
+        if strings.Contains(arg, "{input}") {
+            tmp, err := ioutil.TempFile("", "cfo-ocr-*"+strings.ToLower(path.Ext(name)))
+            if err != nil {
+                return "", err
+            }
+            defer os.Remove(tmp.Name())
+            _, err = tmp.Write(data)
+            if closeErr := tmp.Close(); err == nil {
+                err = closeErr
+            }
+            if err != nil {
+                return "", err
+            }
+            input = tmp.Name()
+            break
+        }
+    }
+
+    replacer := strings.NewReplacer("{input}", input, "{lang}", b.languages)
+    args := make([]string, 0, len(b.argv)-1)
+    for _, arg := range b.argv[1:] {
+        args = append(args, replacer.Replace(arg))
+    }
+    cmd := exec.CommandContext(ctx, b.argv[0], args...)
+    if input == "" {
+        cmd.Stdin = bytes.NewReader(data)
+    }
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &limitedBuffer{buf: &stdout, max: ocrMaxText}
+    cmd.Stderr = &limitedBuffer{buf: &stderr, max: ocrMaxStderr}
+    if err := cmd.Run(); err != nil {
+        if ctx.Err() != nil {
+            return "", ctx.Err()
+        }
+        return "", fmt.Errorf("%s: %v: %s", path.Base(b.argv[0]), err, strings.TrimSpace(stderr.String()))
+    }
+    return stdout.String(), nil
+}
+
+// -------------------------------------------------------
+// type ocrHTTP
+// -------------------------------------------------------
+// Purpose:
+//   - Backend calling an OCR service:
+//       POST <url>?lang=<languages>&name=<file name>
+//     with the attachment as the body (its MIME type as
+//     Content-Type), answering 2xx with the text.
+// -------------------------------------------------------
+type ocrHTTP struct {
+    url       string
+    languages string
+}
+
+func (b ocrHTTP) extract(ctx context.Context, data []byte, name string) (string, error) {
+    target, err := url.Parse(b.url)
+    if err != nil {
+        return "", err
+    }
+    query := target.Query()
+    query.Set("lang", b.languages)
+    query.Set("name", name)
+    target.RawQuery = query.Encode()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(data))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", defaultString(mime.TypeByExtension(strings.ToLower(path.Ext(name))), rawDefaultType))
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, ocrMaxStderr))
+        return "", fmt.Errorf("OCR service answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+    }
+    text, err := ioutil.ReadAll(io.LimitReader(resp.Body, ocrMaxText))
+    return string(text), err
+}
+
+// ocrCandidate reports whether rel has one of ocr.extensions.
+func ocrCandidate(cfg config.OCRConfig, rel string) bool {
+    ext := strings.ToLower(path.Ext(rel))
+    for _, allowed := range cfg.Extensions {
+        if ext == strings.ToLower(allowed) {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func loadOCRLocked() map[string]OCRRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Read ocr.json. Caller holds ocrMu.
+// -------------------------------------------------------
+func loadOCRLocked(ctx context.Context) map[string]OCRRecord {
+    records := map[string]OCRRecord{}
+    if err := loadMetaJSON(ctx, ocrFile, &records); err != nil {
+        logError(ctx, "Failed to load OCR records: "+err.Error())
+    }
+    if records == nil {
+        records = map[string]OCRRecord{}
+    }
+    return records
+}
+
+// ocrSidecars maps each sidecar note to its attachment.
+func ocrSidecars(ctx context.Context) map[string]string {
+    ocrMu.Lock()
+    defer ocrMu.Unlock()
+    sidecars := map[string]string{}
+    for attachment, record := range loadOCRLocked(ctx) {
+        sidecars[record.Note] = attachment
+    }
+    return sidecars
+}
+
+// -------------------------------------------------------
+// func ocrRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Follow a sidecar note that was moved, so a later extraction
+//     updates it where it now lives.
+// -------------------------------------------------------
+func ocrRename(ctx context.Context, from, to string) {
+    ocrMu.Lock()
+    defer ocrMu.Unlock()
+    records := loadOCRLocked(ctx)
+    for attachment, record := range records {
+        if record.Note != from {
+            continue
+        }
+        record.Note = to
+        records[attachment] = record
+        if err := saveMetaJSON(ctx, ocrFile, records); err != nil {
+            logError(ctx, "Failed to move OCR sidecar "+from+" -> "+to+": "+err.Error())
+        }
+        return
+    }
+}
+
+// -------------------------------------------------------
+// func ocrSidecarContent(ctx, rel, sha, text) []byte
+// -------------------------------------------------------
+// Purpose:
+//   - The sidecar note: a header linking the attachment, then the
+//     recognized text.
+// -------------------------------------------------------
+func ocrSidecarContent(ctx context.Context, rel, sha, text string) []byte {
+    name := path.Base(rel)
+    if text == "" {
+        text = "_No text was recognized._"
+    }
+    return []byte(fmt.Sprintf("# OCR: %s\n\nSource: [%s](%s)  \nSHA-256: %s  \nExtracted: %s\n\n---\n\n%s\n",
+        name, name, url.PathEscape(name), sha, utcNow(ctx), text))
+}
+
+// ocrCleanText normalizes engine output: valid UTF-8, LF line
+// endings, page breaks as blank lines.
+func ocrCleanText(text string) string {
+    text = strings.ToValidUTF8(text, "")
+    text = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\f", "\n\n").Replace(text)
+    return strings.TrimSpace(text)
+}
+
+// -------------------------------------------------------
+// func RunOCR(ctx, only string, force bool) (*OCRReport, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Extract the text of one attachment (only) or of every
+//     attachment in the raw folders into sidecar notes.
+// Audit:
+//   - One failing attachment is reported and the run continues;
+//     errors are returned only for a bad request or a canceled job.
+// -------------------------------------------------------
+func RunOCR(ctx context.Context, only string, force bool) (*OCRReport, error) {
+    cfg := currentConfig(ctx).OCR
+    newBackend, ok := ocrBackends[cfg.Backend]
+    if !ok {
+        return nil, errors.New("OCR is disabled (ocr.backend is not set)")
+    }
+    backend := newBackend(cfg)
+
+    var attachments []noteFile
+    if only != "" {
+        absPath := sanitizePath(ctx, only)
+        rel := relativeTo(ctx, absPath)
+        if absPath == "" || !rawAllowed(ctx, rel) || !ocrCandidate(cfg, rel) {
+            return nil, fmt.Errorf("%s is not an OCR attachment in a raw folder", only)
+        }
+        info, err := statPath(ctx, absPath)
+        if err != nil {
+            return nil, err
+        }
+        attachments = []noteFile{{Rel: rel, Abs: absPath, Size: info.Size()}}
+    } else {
+        found, err := scanFiles(ctx, func(name string) bool { return ocrCandidate(cfg, name) })
+        if err != nil {
+            return nil, err
+        }
+        for _, file := range found {
+            if rawAllowed(ctx, file.Rel) {
+                attachments = append(attachments, file)
+            }
+        }
+        sort.Slice(attachments, func(i, j int) bool { return attachments[i].Rel < attachments[j].Rel })
+    }
+
+    report := &OCRReport{Extracted: []string{}, Skipped: []OCRSkip{}, Failed: []OCRSkip{}}
+    for _, file := range attachments {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        report.Scanned++
+        note, skip, err := ocrAttachment(ctx, cfg, backend, file, force)
+        switch {
+        case err != nil:
+            logError(ctx, fmt.Sprintf("OCR failed for %s: %v", file.Rel, err))
+            report.Failed = append(report.Failed, OCRSkip{Path: file.Rel, Reason: err.Error()})
+        case skip == "unchanged":
+            report.Unchanged++
+        case skip != "":
+            report.Skipped = append(report.Skipped, OCRSkip{Path: file.Rel, Reason: skip})
+        default:
+            report.Extracted = append(report.Extracted, note)
+        }
+    }
+    logInfo(ctx, fmt.Sprintf("OCR scanned %d attachments: %d extracted, %d unchanged, %d skipped, %d failed",
+        report.Scanned, len(report.Extracted), report.Unchanged, len(report.Skipped), len(report.Failed)))
+    return report, nil
+}
+
+// -------------------------------------------------------
+// func ocrAttachment(ctx, cfg, backend, file, force) (string, string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Extract one attachment; returns the sidecar written, or why
+//     nothing was written ("unchanged" or a reason to report).
+// -------------------------------------------------------
+func ocrAttachment(ctx context.Context, cfg config.OCRConfig, backend ocrBackend, file noteFile, force bool) (string, string, error) {
+    if file.Size > cfg.MaxBytes {
+        return "", fmt.Sprintf("exceeds ocr.max_bytes (%d bytes)", cfg.MaxBytes), nil
+    }
+    sidecarRel, err := applyNamePolicy(file.Rel + ocrSuffix)
+    if err != nil {
+        return "", "sidecar name: " + err.Error(), nil
+    }
+    ocrMu.Lock()
+    record, known := loadOCRLocked(ctx)[file.Rel]
+    ocrMu.Unlock()
+    if known && record.Note != "" {
+        sidecarRel = record.Note
+    }
+    absSidecar := sanitizePath(ctx, sidecarRel)
+    if absSidecar == "" {
+        return "", "sidecar path is invalid", nil
+    }
+
+    data, err := readFile(ctx, file.Abs)
+    if err != nil {
+        return "", "", err
+    }
+    sha := contentHash(data)
+    existing, readErr := readFile(ctx, absSidecar)
+    sidecarExists := readErr == nil
+    if known && sidecarExists && record.SourceSHA256 == sha && !force {
+        return "", "unchanged", nil
+    }
+    switch {
+    case sidecarExists && (!known || contentHash(existing) != record.NoteSHA256):
+        return "", "sidecar " + sidecarRel + " was edited or not written by OCR; delete it to extract again", nil
+    case isApproved(ctx, sidecarRel):
+        return "", "sidecar " + sidecarRel + " is approved", nil
+    case isHeld(ctx, sidecarRel):
+        return "", "sidecar " + sidecarRel + " is under legal hold", nil
+    case isLedger(ctx, sidecarRel):
+        return "", "sidecar " + sidecarRel + " is a ledger note", nil
+    }
+
+    extractCtx, cancel := context.WithTimeout(ctx, cfg.Timeout.Std())
+    text, err := backend.extract(extractCtx, data, path.Base(file.Rel))
+    cancel()
+    if err != nil {
+        if ctx.Err() != nil {
+            return "", "", ctx.Err()
+        }
+        return "", "", err
+    }
+    text = ocrCleanText(text)
+    content := ocrSidecarContent(ctx, file.Rel, sha, text)
+    if err := writeFile(ctx, absSidecar, content); err != nil {
+        return "", "", err
+    }
+    indexUpdate(ctx, sidecarRel, content)
+    journalPutEntry(ctx, sidecarRel, content)
+
+    record = OCRRecord{
+        Attachment:   file.Rel,
+        Note:         sidecarRel,
+        SourceSHA256: sha,
+        NoteSHA256:   contentHash(content),
+        Chars:        utf8.RuneCountInString(text),
+        Backend:      cfg.Backend,
+        ExtractedAt:  utcNow(ctx),
+    }
+    ocrMu.Lock()
+    records := loadOCRLocked(ctx)
+    records[file.Rel] = record
+    err = saveMetaJSON(ctx, ocrFile, records)
+    ocrMu.Unlock()
+    if err != nil {
+        logError(ctx, "Failed to save OCR record for "+file.Rel+": "+err.Error())
+    }
+
+    audit.Write(audit.Event{
+        Event:  "file.ocr",
+        Method: "JOB",
+        Path:   "/admin/jobs",
+        Target: sidecarRel,
+        Detail: fmt.Sprintf("attachment=%s sha256=%s chars=%d backend=%s", file.Rel, sha, record.Chars, cfg.Backend),
+    })
+    return sidecarRel, "", nil
+}
+
+// -------------------------------------------------------
+// func queueUploadOCR(r, rel) string
+// -------------------------------------------------------
+// Purpose:
+//   - After a raw upload, queue an "ocr" job for it when ocr.auto
+//     is on and the file is an OCR attachment; returns the job id
+//     ("" when none was queued).
+// -------------------------------------------------------
+func queueUploadOCR(r *http.Request, rel string) string {
+    ctx := r.Context()
+    cfg := currentConfig(ctx).OCR
+    if _, ok := ocrBackends[cfg.Backend]; !ok || !cfg.Auto || !ocrCandidate(cfg, rel) {
+        return ""
+    }
+    job, err := enqueueJob(ctx, "ocr", map[string]string{"path": rel}, actorName(ctx))
+    if err != nil {
+        logError(ctx, "OCR not queued for "+rel+": "+err.Error())
+        return ""
+    }
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "job.queued",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusAccepted,
+        Actor:    job.CreatedBy,
+        Target:   job.ID,
+        Detail:   "kind=ocr path=" + rel,
+    })
+    return job.ID
+}
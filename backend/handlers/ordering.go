@@ -0,0 +1,320 @@
+// -------------------------------------------------------
+// backend/handlers/ordering.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Manual sort positions for notes within their folder and for
+//     folders among their siblings, so the sidebar can follow the
+//     close checklist instead of the alphabet.
+//       PATCH /files/order   {"positions": {"Acme/bank-rec.md": 1}}
+//       PATCH /folders/order {"positions": {"07-tax-prov": 7}}
+//   - /files and /folders list positioned entries first, by
+//     position, then the rest by name; object listings
+//     (/files?detail=1, /folders?include=...) carry "position".
+// Audit:
+//   - Positions live in .scratchpad/order.json. Each PATCH writes one
+//     "order.set" event listing the changes.
+//   - A null position removes it. Positions are compared only among
+//     siblings, so they need not be contiguous or unique; ties sort
+//     by name.
+//   - Renaming a note within its folder keeps its position; moving
+//     it to another folder drops it. Positions of deleted items are
+//     kept for a restore from the trash.
+//   - Streamed listings (format=ndjson) stay in walk order; their
+//     objects still carry the position.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    orderFile        = "order.json"
+    maxOrderChanges  = 1000
+    maxOrderPosition = 1000000
+    orderKindFiles   = "files"
+    orderKindFolders = "folders"
+)
+
+// orderMu guards order.json.
+var orderMu sync.Mutex
+
+// -------------------------------------------------------
+// type sortOrder
+// -------------------------------------------------------
+// Purpose:
+//   - Contents of order.json: relative path -> position, for notes
+//     and for folders.
+// -------------------------------------------------------
+type sortOrder struct {
+    Files   map[string]int `json:"files"`
+    Folders map[string]int `json:"folders"`
+}
+
+// loadOrderLocked reads order.json. Caller holds orderMu.
+func loadOrderLocked(ctx context.Context) (*sortOrder, error) {
+    order := &sortOrder{}
+    if err := loadMetaJSON(ctx, orderFile, order); err != nil {
+        return nil, err
+    }
+    if order.Files == nil {
+        order.Files = map[string]int{}
+    }
+    if order.Folders == nil {
+        order.Folders = map[string]int{}
+    }
+    return order, nil
+}
+
+// currentOrder returns order.json; an unreadable file is logged and
+// treated as empty so listings fall back to name order.
+func currentOrder(ctx context.Context) *sortOrder {
+    orderMu.Lock()
+    defer orderMu.Unlock()
+    order, err := loadOrderLocked(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load sort order: "+err.Error())
+        return &sortOrder{Files: map[string]int{}, Folders: map[string]int{}}
+    }
+    return order
+}
+
+// positionOf returns a pointer to the position of rel, or nil.
+func positionOf(positions map[string]int, rel string) *int {
+    if position, ok := positions[rel]; ok {
+        return &position
+    }
+    return nil
+}
+
+// lessByPosition orders two siblings: positioned before unpositioned,
+// then by position, then by name.
+func lessByPosition(positions map[string]int, a string, b string) bool {
+    pa, okA := positions[a]
+    pb, okB := positions[b]
+    if okA != okB {
+        return okA
+    }
+    if okA && pa != pb {
+        return pa < pb
+    }
+    return path.Base(a) < path.Base(b)
+}
+
+// -------------------------------------------------------
+// func sortNotesByPosition(ctx, folderRel, names)
+// -------------------------------------------------------
+// Purpose:
+//   - Sort note names of one folder into manual order, in place.
+// -------------------------------------------------------
+func sortNotesByPosition(ctx context.Context, folderRel string, names []string) {
+    positions := currentOrder(ctx).Files
+    if len(positions) == 0 {
+        return
+    }
+    rel := func(name string) string {
+        if folderRel == "." {
+            return name
+        }
+        return folderRel + "/" + name
+    }
+    sort.SliceStable(names, func(i, j int) bool {
+        return lessByPosition(positions, rel(names[i]), rel(names[j]))
+    })
+}
+
+// -------------------------------------------------------
+// func lessFolderPath(positions, a, b) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Manual order of two folder paths, keeping every folder
+//     directly before its subfolders.
+// Audit:
+//   - Paths are compared component by component; each component is
+//     ordered among its siblings by lessByPosition.
+// -------------------------------------------------------
+func lessFolderPath(positions map[string]int, a string, b string) bool {
+    partsA := strings.Split(a, "/")
+    partsB := strings.Split(b, "/")
+    for k := 0; k < len(partsA) && k < len(partsB); k++ {
+        if partsA[k] != partsB[k] {
+            return lessByPosition(positions, strings.Join(partsA[:k+1], "/"), strings.Join(partsB[:k+1], "/"))
+        }
+    }
+    return len(partsA) < len(partsB)
+}
+
+// -------------------------------------------------------
+// func orderRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Carry a note's position along a rename in the same folder;
+//     drop it when the note moves to another folder.
+// -------------------------------------------------------
+func orderRename(ctx context.Context, from, to string) {
+    orderMu.Lock()
+    defer orderMu.Unlock()
+    order, err := loadOrderLocked(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load sort order: "+err.Error())
+        return
+    }
+    position, ok := order.Files[from]
+    if !ok {
+        return
+    }
+    delete(order.Files, from)
+    if path.Dir(from) == path.Dir(to) {
+        order.Files[to] = position
+    }
+    if err := saveMetaJSON(ctx, orderFile, order); err != nil {
+        logError(ctx, "Failed to save sort order: "+err.Error())
+    }
+    touchListing(from, to)
+}
+
+// -------------------------------------------------------
+// func HandleFileOrder(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - PATCH /files/order {"positions": {"<note path>": n|null}}.
+// -------------------------------------------------------
+func HandleFileOrder(w http.ResponseWriter, r *http.Request) {
+    handleOrder(w, r, orderKindFiles)
+}
+
+// -------------------------------------------------------
+// func HandleFolderOrder(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - PATCH /folders/order {"positions": {"<folder path>": n|null}}.
+// -------------------------------------------------------
+func HandleFolderOrder(w http.ResponseWriter, r *http.Request) {
+    handleOrder(w, r, orderKindFolders)
+}
+
+// -------------------------------------------------------
+// func handleOrder(w, r, kind)
+// -------------------------------------------------------
+// Purpose:
+//   - Validate and apply a batch of position changes for notes or
+//     folders; answers the resulting positions of the paths given.
+// Audit:
+//   - Every path must be an existing note (files) or folder
+//     (folders) outside archived folders; one bad path rejects the
+//     whole batch.
+// -------------------------------------------------------
+func handleOrder(w http.ResponseWriter, r *http.Request, kind string) {
+    if r.Method != http.MethodPatch {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Positions map[string]*int `json:"positions"`
+    }
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if len(req.Positions) == 0 {
+        apierror.Write(w, r, apierror.CodeMissingField, "positions", "Bad request: positions is required")
+        return
+    }
+    if len(req.Positions) > maxOrderChanges {
+        apierror.Write(w, r, apierror.CodeInvalidField, "positions", fmt.Sprintf("Bad request: at most %d positions per request", maxOrderChanges))
+        return
+    }
+
+    changes := map[string]*int{}
+    for p, position := range req.Positions {
+        field := "positions." + p
+        absPath := sanitizePath(r.Context(), p)
+        if absPath == "" || absPath == scratchRoot(r.Context()) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, field, "Invalid path")
+            return
+        }
+        if rejectIfArchived(w, r, absPath) {
+            return
+        }
+        info, err := statPath(r.Context(), absPath)
+        if kind == orderKindFiles && (err != nil || !info.Mode().IsRegular() || !isNoteName(info.Name())) {
+            apierror.Write(w, r, apierror.CodeNotFound, field, "Note not found")
+            return
+        }
+        if kind == orderKindFolders && (err != nil || !info.IsDir()) {
+            apierror.Write(w, r, apierror.CodeNotFound, field, "Folder not found")
+            return
+        }
+        if position != nil && (*position < 0 || *position > maxOrderPosition) {
+            apierror.Write(w, r, apierror.CodeInvalidField, field, fmt.Sprintf("Bad request: position must be 0-%d or null", maxOrderPosition))
+            return
+        }
+        changes[relativeTo(r.Context(), absPath)] = position
+    }
+
+    orderMu.Lock()
+    defer orderMu.Unlock()
+    order, err := loadOrderLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load sort order", "Internal error")
+        return
+    }
+    positions := order.Files
+    if kind == orderKindFolders {
+        positions = order.Folders
+    }
+    rels := make([]string, 0, len(changes))
+    result := map[string]*int{}
+    for rel, position := range changes {
+        rels = append(rels, rel)
+        if position == nil {
+            delete(positions, rel)
+        } else {
+            positions[rel] = *position
+        }
+        result[rel] = position
+    }
+    if err := saveMetaJSON(r.Context(), orderFile, order); err != nil {
+        writeStorageError(w, r, err, "save sort order", "Update failed")
+        return
+    }
+    if kind == orderKindFolders {
+        touchFolders(rels...)
+    } else {
+        touchListing(rels...)
+    }
+
+    sort.Strings(rels)
+    details := make([]string, 0, len(rels))
+    for _, rel := range rels {
+        if result[rel] == nil {
+            details = append(details, fmt.Sprintf("%s=null", rel))
+        } else {
+            details = append(details, fmt.Sprintf("%s=%d", rel, *result[rel]))
+        }
+    }
+    logInfo(r.Context(), fmt.Sprintf("Updated %d %s positions", len(rels), kind))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "order.set",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   kind,
+        Detail:   strings.Join(details, " "),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"positions": result})
+}
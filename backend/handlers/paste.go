@@ -0,0 +1,217 @@
+// -------------------------------------------------------
+// backend/handlers/paste.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - POST /file/paste-image {"path", "data", "alt"}: store an image
+//     pasted into the editor (a screenshot of a dashboard, say) as
+//     an attachment next to the note, and return the Markdown link
+//     to insert at the cursor.
+// Audit:
+//   - data is a data URL (data:image/png;base64,...) or bare
+//     base64. The type is taken from the decoded bytes, not the
+//     URL: PNG, JPEG, GIF and WebP are accepted; SVG is not, since
+//     it can carry script.
+//   - The attachment is written to the "attachments" subfolder of
+//     the note's folder as <note>-<stamp id>.<ext>, so it never
+//     replaces a file. That folder must lie in raw.folders (raw.go)
+//     and is created on first use; the raw.max_bytes limit applies
+//     to the decoded image.
+//   - Archive, approval and legal hold guards apply to the note as
+//     for a save. The note itself is not changed: the editor
+//     inserts the link and saves as usual.
+//   - Writes "file.paste_image" (note, size and SHA-256) and, like
+//     a raw upload, is scanned for malware (antivirus.go) and queues
+//     OCR when ocr.auto is on.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    pasteFolder       = "attachments"
+    pasteDefaultAlt   = "Pasted image"
+    maxPasteAltLength = 200
+)
+
+// pasteImageTypes maps the sniffed MIME type to the file extension.
+var pasteImageTypes = map[string]string{
+    "image/png":  ".png",
+    "image/jpeg": ".jpg",
+    "image/gif":  ".gif",
+    "image/webp": ".webp",
+}
+
+// -------------------------------------------------------
+// func decodePastedImage(data string) ([]byte, string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The image bytes of a data URL or bare base64, with the file
+//     extension of their sniffed type.
+// Audit:
+//   - A data URL must be base64 and declare an image type; the
+//     declared type is otherwise ignored.
+// -------------------------------------------------------
+func decodePastedImage(data string) ([]byte, string, error) {
+    encoded := strings.TrimSpace(data)
+    if strings.HasPrefix(encoded, "data:") {
+        comma := strings.IndexByte(encoded, ',')
+        if comma < 0 {
+            return nil, "", fmt.Errorf("data URL has no comma")
+        }
+        header := strings.ToLower(encoded[len("data:"):comma])
+        if !strings.HasPrefix(header, "image/") || !strings.HasSuffix(header, ";base64") {
+            return nil, "", fmt.Errorf("data URL must be a base64 image")
+        }
+        encoded = encoded[comma+1:]
+    }
+    // Data URLs copied from elsewhere may be wrapped across lines.
+    encoded = strings.Join(strings.Fields(encoded), "")
+    image, err := base64.StdEncoding.DecodeString(encoded)
+    if err != nil {
+        image, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("not valid base64")
+    }
+    if len(image) == 0 {
+        return nil, "", fmt.Errorf("image is empty")
+    }
+    sniffed := http.DetectContentType(image)
+    ext, ok := pasteImageTypes[sniffed]
+    if !ok {
+        return nil, "", fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image", sniffed)
+    }
+    return image, ext, nil
+}
+
+// -------------------------------------------------------
+// func HandleFilePasteImage(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/paste-image: store the image, answer 201 with
+//     {"path", "markdown", "bytes", "sha256", "content_type"}.
+// Audit:
+//   - path is the note being edited; its folder must exist.
+//     "markdown" links the attachment relative to the note.
+// -------------------------------------------------------
+func HandleFilePasteImage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    ctx := r.Context()
+    limit := currentConfig(ctx).Raw.MaxBytes
+    // base64 is 4/3 of the image; leave room for the JSON around it.
+    r.Body = http.MaxBytesReader(w, r.Body, limit/3*4+(64<<10))
+    var req struct {
+        Path string `json:"path"`
+        Data string `json:"data"`
+        Alt  string `json:"alt"`
+    }
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if !requireField(w, r, "path", req.Path) || !requireField(w, r, "data", req.Data) {
+        return
+    }
+    alt := strings.TrimSpace(defaultString(req.Alt, pasteDefaultAlt))
+    if len([]rune(alt)) > maxPasteAltLength || strings.ContainsAny(alt, "\r\n") {
+        writeFieldError(w, r, invalidField("alt", "must be one line of at most %d characters", maxPasteAltLength))
+        return
+    }
+
+    notePath, policyErr := applyNamePolicy(req.Path)
+    if policyErr != nil {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path: "+policyErr.Error())
+        return
+    }
+    noteAbs := sanitizePath(ctx, notePath)
+    if noteAbs == "" || !isNoteName(noteAbs) {
+        logError(ctx, "Rejected unsafe paste target: "+req.Path)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, noteAbs) || rejectIfApproved(w, r, noteAbs) || rejectIfHeld(w, r, noteAbs) {
+        return
+    }
+    noteDir := path.Dir(noteAbs)
+    if info, err := statPath(ctx, noteDir); err != nil || !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "Folder not found")
+        return
+    }
+    notePath = relativeTo(ctx, noteAbs)
+    folderRel := path.Join(path.Dir(notePath), pasteFolder)
+    if rejectIfNotRaw(w, r, folderRel) {
+        return
+    }
+
+    image, ext, err := decodePastedImage(req.Data)
+    if err != nil {
+        writeFieldError(w, r, invalidField("data", "%v", err))
+        return
+    }
+    if int64(len(image)) > limit {
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "data", fmt.Sprintf("Image exceeds %d bytes", limit))
+        return
+    }
+
+    stem := strings.TrimSuffix(path.Base(notePath), path.Ext(notePath))
+    name := fileSafeName(stem) + "-" + newStampID(ctx) + ext
+    rel := path.Join(folderRel, name)
+    absPath := sanitizePath(ctx, rel)
+    if absPath == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfInfected(w, r, rel, "paste_image", image) {
+        return
+    }
+    if err := mkdirAll(ctx, path.Dir(absPath)); err != nil {
+        writeStorageError(w, r, err, "create attachments folder: "+path.Dir(absPath), "Write failed")
+        return
+    }
+    if err := writeFile(ctx, absPath, image); err != nil {
+        writeStorageError(w, r, err, "save pasted image: "+absPath, "Write failed")
+        return
+    }
+
+    hash := contentHash(image)
+    contentType := http.DetectContentType(image)
+    logInfo(ctx, fmt.Sprintf("Saved pasted image: %s (%s, %d bytes)", absPath, contentType, len(image)))
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "file.paste_image",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusCreated,
+        Actor:    actorName(ctx),
+        Target:   rel,
+        Detail:   fmt.Sprintf("note=%s bytes=%d sha256=%s type=%s", notePath, len(image), hash, contentType),
+    })
+    if jobID := queueUploadOCR(r, rel); jobID != "" {
+        w.Header().Set("X-OCR-Job", jobID)
+    }
+    altText := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+    w.Header().Set(contentHashHeader, hash)
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":         rel,
+        "markdown":     "![" + altText + "](" + pasteFolder + "/" + name + ")",
+        "bytes":        len(image),
+        "sha256":       hash,
+        "content_type": contentType,
+    })
+}
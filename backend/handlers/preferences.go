@@ -0,0 +1,214 @@
+// -------------------------------------------------------
+// backend/handlers/preferences.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Per-user UI preferences kept on the server so they follow the
+//     user across browsers:
+//       GET /preferences                      current (or default) values
+//       PUT /preferences {...}                update; omitted fields keep
+//                                             their value
+//   - Stored in .scratchpad/preferences/<user>.json.
+// Audit:
+//   - Requires a user token (401 otherwise).
+//   - Bodies are limited to 8 KiB; unknown fields and out-of-range
+//     values are rejected with 400.
+//   - Updates write "preferences.update" with the actor.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "path/filepath"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    preferencesDirName  = "preferences"
+    maxPreferencesBytes = 8 << 10
+)
+
+// preferencesMu guards the preference files.
+var preferencesMu sync.Mutex
+
+// Accepted values for the enumerated preferences.
+var (
+    preferenceSortOrders = []string{"name-asc", "name-desc", "modified-desc", "modified-asc"}
+    preferenceThemes     = []string{"system", "light", "dark"}
+)
+
+// -------------------------------------------------------
+// type EditorPreferences
+// -------------------------------------------------------
+// Purpose:
+//   - Editor options of one user.
+// -------------------------------------------------------
+type EditorPreferences struct {
+    FontSize    int  `json:"font_size"`
+    TabWidth    int  `json:"tab_width"`
+    WordWrap    bool `json:"word_wrap"`
+    LineNumbers bool `json:"line_numbers"`
+    SpellCheck  bool `json:"spell_check"`
+}
+
+// -------------------------------------------------------
+// type Preferences
+// -------------------------------------------------------
+// Purpose:
+//   - Everything stored for one user.
+// -------------------------------------------------------
+type Preferences struct {
+    DefaultFolder string            `json:"default_folder"`
+    SortOrder     string            `json:"sort_order"`
+    Theme         string            `json:"theme"`
+    Editor        EditorPreferences `json:"editor"`
+    UpdatedAt     string            `json:"updated_at,omitempty"`
+}
+
+// defaultPreferences is what a user gets before saving anything.
+func defaultPreferences() Preferences {
+    return Preferences{
+        SortOrder: "name-asc",
+        Theme:     "system",
+        Editor: EditorPreferences{
+            FontSize:    14,
+            TabWidth:    4,
+            WordWrap:    true,
+            LineNumbers: false,
+            SpellCheck:  true,
+        },
+    }
+}
+
+// oneOf reports whether value is in allowed.
+func oneOf(value string, allowed []string) bool {
+    for _, a := range allowed {
+        if value == a {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func validatePreferences(ctx context.Context, p Preferences) error
+// -------------------------------------------------------
+// Purpose:
+//   - Enforce the preference schema.
+// Audit:
+//   - default_folder must be a valid folder path but need not exist
+//     (an empty value means the root).
+// -------------------------------------------------------
+func validatePreferences(ctx context.Context, p Preferences) error {
+    if len(p.DefaultFolder) > 512 {
+        return invalidField("default_folder", "exceeds 512 bytes")
+    }
+    if p.DefaultFolder != "" && sanitizePath(ctx, p.DefaultFolder) == "" {
+        return invalidField("default_folder", "is not a valid folder path")
+    }
+    if !oneOf(p.SortOrder, preferenceSortOrders) {
+        return invalidField("sort_order", "must be one of %v", preferenceSortOrders)
+    }
+    if !oneOf(p.Theme, preferenceThemes) {
+        return invalidField("theme", "must be one of %v", preferenceThemes)
+    }
+    if p.Editor.FontSize < 8 || p.Editor.FontSize > 32 {
+        return invalidField("editor.font_size", "must be 8-32")
+    }
+    if p.Editor.TabWidth < 1 || p.Editor.TabWidth > 8 {
+        return invalidField("editor.tab_width", "must be 1-8")
+    }
+    return nil
+}
+
+// preferencesName is the metadata file of a user's preferences.
+func preferencesName(user string) string {
+    return filepath.Join(preferencesDirName, user+".json")
+}
+
+// -------------------------------------------------------
+// func loadPreferencesLocked(ctx context.Context, user string) Preferences
+// -------------------------------------------------------
+// Purpose:
+//   - Stored preferences of user over the defaults.
+//     Caller holds preferencesMu.
+// -------------------------------------------------------
+func loadPreferencesLocked(ctx context.Context, user string) Preferences {
+    prefs := defaultPreferences()
+    if err := loadMetaJSON(ctx, preferencesName(user), &prefs); err != nil {
+        logError(ctx, "Failed to load preferences for "+user+": "+err.Error())
+        return defaultPreferences()
+    }
+    return prefs
+}
+
+// -------------------------------------------------------
+// func HandlePreferences(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: the caller's preferences.
+//   - PUT: merge the body into them, validate, and store.
+// -------------------------------------------------------
+func HandlePreferences(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        preferencesMu.Lock()
+        prefs := loadPreferencesLocked(r.Context(), user.Name)
+        preferencesMu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(prefs)
+
+    case http.MethodPut:
+        preferencesMu.Lock()
+        defer preferencesMu.Unlock()
+
+        prefs := loadPreferencesLocked(r.Context(), user.Name)
+        dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreferencesBytes))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(&prefs); err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Preferences exceed %d bytes", maxPreferencesBytes))
+                return
+            }
+            writeJSONError(w, r, err)
+            return
+        }
+        if err := validatePreferences(r.Context(), prefs); err != nil {
+            writeFieldError(w, r, err)
+            return
+        }
+        prefs.UpdatedAt = utcNow(r.Context())
+        if err := saveMetaJSON(r.Context(), preferencesName(user.Name), prefs); err != nil {
+            writeStorageError(w, r, err, "save preferences for "+user.Name, "Save failed")
+            return
+        }
+
+        logInfo(r.Context(), "Updated preferences for "+user.Name)
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "preferences.update",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Actor:    user.Name,
+        })
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(prefs)
+
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
@@ -0,0 +1,182 @@
+// -------------------------------------------------------
+// backend/handlers/preview.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Note previews for listings: the first lines of a note plus
+//     its total size, without sending the whole note.
+//       GET /file/preview?path=...&lines=100&bytes=16384
+// Audit:
+//   - At most "bytes" bytes are read from storage (OSStorage reads
+//     only that prefix), so previewing a huge note stays cheap.
+//     Notes under a read processor are read whole and previewed
+//     as the processor returns them, like GET /file.
+//   - The cut never splits a UTF-8 character.
+//   - Previews reveal content, so each one writes a "file.read"
+//     event with detail "preview" and shows in /file/access-log.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    previewDefaultLines = 20
+    previewMaxLines     = 1000
+    previewDefaultBytes = 16 << 10
+    previewMaxBytes     = 1 << 20
+)
+
+// -------------------------------------------------------
+// type FilePreview
+// -------------------------------------------------------
+// Purpose:
+//   - Response body of GET /file/preview.
+// Audit:
+//   - Truncated is true when Content is not the whole note.
+// -------------------------------------------------------
+type FilePreview struct {
+    Path       string `json:"path"`
+    Content    string `json:"content"`
+    Lines      int    `json:"lines"`
+    Bytes      int    `json:"bytes"`
+    TotalBytes int64  `json:"total_bytes"`
+    Truncated  bool   `json:"truncated"`
+    Modified   string `json:"modified,omitempty"`
+}
+
+// -------------------------------------------------------
+// func cutPreview(data, lines) []byte
+// -------------------------------------------------------
+// Purpose:
+//   - Keep at most lines lines of data and drop a trailing partial
+//     UTF-8 character.
+// -------------------------------------------------------
+func cutPreview(data []byte, lines int) []byte {
+    offset := 0
+    for i := 0; i < lines; i++ {
+        next := bytes.IndexByte(data[offset:], '\n')
+        if next < 0 {
+            offset = len(data)
+            break
+        }
+        offset += next + 1
+    }
+    data = data[:offset]
+    for end := len(data); end > 0 && end > len(data)-utf8.UTFMax; end-- {
+        if utf8.RuneStart(data[end-1]) {
+            if !utf8.FullRune(data[end-1:]) {
+                data = data[:end-1]
+            }
+            break
+        }
+    }
+    return data
+}
+
+// -------------------------------------------------------
+// func HandleFilePreview(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/preview?path=...: the first lines (default 20, max
+//     1000) and at most bytes bytes (default 16 KiB, max 1 MiB) of a
+//     note, with its total size.
+// Audit:
+//   - Notes in archived folders are previewed from the archive.
+// -------------------------------------------------------
+func HandleFilePreview(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    file := r.URL.Query().Get("path")
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    lines, err := searchIntParam(r, "lines", previewDefaultLines, previewMaxLines)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    limit, err := searchIntParam(r, "bytes", previewDefaultBytes, previewMaxBytes)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    preview := FilePreview{Path: relativeTo(r.Context(), absPath)}
+    var data []byte
+    partial := false
+    if record, inner, archived := archivedFolderFor(r.Context(), preview.Path); archived {
+        content, err := readArchivedFile(r.Context(), record, inner)
+        if err == errArchivedEntryNotFound {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "read archived file: "+absPath, "Internal error")
+            return
+        }
+        data = content
+    } else if len(processorsFor(r.Context(), hookRead, preview.Path)) > 0 {
+        content, err := readNote(r.Context(), absPath)
+        if err != nil {
+            writeStorageError(w, r, err, "read file: "+absPath, "Internal error")
+            return
+        }
+        if info, err := statPath(r.Context(), absPath); err == nil {
+            preview.Modified = info.ModTime().UTC().Format("2006-01-02T15:04:05Z")
+        }
+        data = content
+    } else {
+        info, err := statPath(r.Context(), absPath)
+        if err != nil {
+            writeStorageError(w, r, err, "stat file: "+absPath, "Internal error")
+            return
+        }
+        preview.TotalBytes = info.Size()
+        preview.Modified = info.ModTime().UTC().Format("2006-01-02T15:04:05Z")
+        partial = true
+        data, err = readFilePrefix(r.Context(), absPath, int64(limit))
+        if err != nil {
+            writeStorageError(w, r, err, "read file: "+absPath, "Internal error")
+            return
+        }
+    }
+    if !partial {
+        served, err := processContent(r.Context(), hookRead, preview.Path, data)
+        if err != nil {
+            writeProcessorError(w, r, preview.Path, err)
+            return
+        }
+        preview.TotalBytes = int64(len(served))
+        data = served
+        if len(data) > limit {
+            data = data[:limit]
+        }
+    }
+
+    cut := cutPreview(data, lines)
+    preview.Content = string(cut)
+    preview.Bytes = len(cut)
+    preview.Lines = bytes.Count(cut, []byte("\n"))
+    if len(cut) > 0 && cut[len(cut)-1] != '\n' {
+        preview.Lines++
+    }
+    preview.Truncated = int64(len(cut)) < preview.TotalBytes
+
+    logInfo(r.Context(), "Previewed file: "+absPath)
+    auditFileRead(r, absPath, "preview")
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(preview)
+}
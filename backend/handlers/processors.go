@@ -0,0 +1,388 @@
+// -------------------------------------------------------
+// backend/handlers/processors.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Content processors: site-specific transformations (redaction,
+//     formatting, enrichment) declared in the processors config
+//     list instead of patched into the handlers. Each runs on some
+//     of three hooks:
+//       save    content of every note write (POST /file/save, merges
+//               of /conflicts/resolve, /files/replace, /file/split,
+//               /file/concat, PATCH /tasks, /file/import and
+//               /file/fix-encoding), before it is written; returns
+//               the content to store, or refuses the write
+//       read    content of every route that sends note text (GET
+//               /file and ?asOf=, /file/preview, /files/download,
+//               /export, /file/export, /file/audio, /search,
+//               /file/toc, /file/stats, /file/extract-numbers,
+//               includes), before it is used; returns what the
+//               reader gets (the stored note is unchanged)
+//       index   content of every local save; returns attributes
+//               (string key/value pairs) kept in the index and shown
+//               in detailed listings
+//   - A processor is an executable or a Go plugin; both implement
+//     Processor.
+// Audit:
+//   - Executables get the content on stdin and answer on stdout
+//     (index: a JSON object of strings). SCRATCHPAD_HOOK,
+//     SCRATCHPAD_PATH and SCRATCHPAD_USER describe the call; the
+//     rest of the server's environment (keys, tokens) is withheld.
+//     A non-zero exit is a failure; stderr is its message.
+//   - Go plugins export any of
+//       func OnSave(path string, content []byte) ([]byte, error)
+//       func OnRead(path string, content []byte) ([]byte, error)
+//       func OnIndex(path string, content []byte) (map[string]string, error)
+//     and need a server built with cgo and the same Go toolchain.
+//   - Processors run in config order, each on the previous one's
+//     output. Saved content must stay valid UTF-8.
+//   - A failed save hook answers 422 invalid_content and a failed
+//     read hook 502 upstream_failed, both naming the processor in
+//     details, unless the processor is fail_open. Failures write
+//     "processor.failed"; index failures are only logged.
+//   - X-Content-SHA256 on reads is always the stored content's hash,
+//     so base_sha256 saves keep working behind a read hook.
+//   - Not processed: ?raw=1 files (not notes), /sync (replicates the
+//     stored bytes), and listings built from the index at save time
+//     (GET /tasks, attributes), which reflect the stored content.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "os/exec"
+    "plugin"
+    "regexp"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+// Processor hooks.
+const (
+    hookSave  = "save"
+    hookRead  = "read"
+    hookIndex = "index"
+)
+
+const (
+    defaultProcessorTimeout = 10 * time.Second
+    maxProcessorOutput      = 64 << 20
+    maxProcessorStderr      = 512
+    maxAttributes           = 64
+    maxAttributeValue       = 1024
+)
+
+// attributeKeyPattern restricts attribute names from index hooks.
+var attributeKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// -------------------------------------------------------
+// type Processor
+// -------------------------------------------------------
+// Purpose:
+//   - The hooks of one content processor. Only the hooks listed in
+//     its config entry are called.
+// -------------------------------------------------------
+type Processor interface {
+    OnSave(ctx context.Context, rel string, content []byte) ([]byte, error)
+    OnRead(ctx context.Context, rel string, content []byte) ([]byte, error)
+    OnIndex(ctx context.Context, rel string, content []byte) (map[string]string, error)
+}
+
+// -------------------------------------------------------
+// type ProcessorError
+// -------------------------------------------------------
+// Purpose:
+//   - A hook that failed, which processor it belonged to, and the
+//     note it ran on.
+// -------------------------------------------------------
+type ProcessorError struct {
+    Processor string
+    Hook      string
+    Path      string
+    Err       error
+}
+
+func (e *ProcessorError) Error() string {
+    return fmt.Sprintf("processor %s (%s): %v", e.Processor, e.Hook, e.Err)
+}
+
+// -------------------------------------------------------
+// type commandProcessor
+// -------------------------------------------------------
+// Purpose:
+//   - Processor backed by an executable, run once per hook call.
+// -------------------------------------------------------
+type commandProcessor struct {
+    argv []string
+}
+
+func (p commandProcessor) run(ctx context.Context, hook, rel string, content []byte) ([]byte, error) {
+    cmd := exec.CommandContext(ctx, p.argv[0], p.argv[1:]...)
+    cmd.Env = []string{
+        "PATH=" + os.Getenv("PATH"),
+        "SCRATCHPAD_HOOK=" + hook,
+        "SCRATCHPAD_PATH=" + rel,
+        "SCRATCHPAD_USER=" + actorName(ctx),
+    }
+    cmd.Stdin = bytes.NewReader(content)
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &limitedBuffer{buf: &stdout, max: maxProcessorOutput}
+    cmd.Stderr = &limitedBuffer{buf: &stderr, max: maxProcessorStderr}
+    if err := cmd.Run(); err != nil {
+        if ctx.Err() != nil {
+            return nil, ctx.Err()
+        }
+        if message := strings.TrimSpace(stderr.String()); message != "" {
+            return nil, errors.New(message)
+        }
+        return nil, err
+    }
+    if stdout.Len() > maxProcessorOutput {
+        return nil, fmt.Errorf("output exceeds %d bytes", maxProcessorOutput)
+    }
+    return stdout.Bytes(), nil
+}
+
+func (p commandProcessor) OnSave(ctx context.Context, rel string, content []byte) ([]byte, error) {
+    return p.run(ctx, hookSave, rel, content)
+}
+
+func (p commandProcessor) OnRead(ctx context.Context, rel string, content []byte) ([]byte, error) {
+    return p.run(ctx, hookRead, rel, content)
+}
+
+func (p commandProcessor) OnIndex(ctx context.Context, rel string, content []byte) (map[string]string, error) {
+    out, err := p.run(ctx, hookIndex, rel, content)
+    if err != nil {
+        return nil, err
+    }
+    attributes := map[string]string{}
+    if err := json.Unmarshal(out, &attributes); err != nil {
+        return nil, fmt.Errorf("index output is not a JSON object of strings: %v", err)
+    }
+    return attributes, nil
+}
+
+// -------------------------------------------------------
+// type pluginProcessor
+// -------------------------------------------------------
+// Purpose:
+//   - Processor backed by a Go plugin's exported functions.
+// Audit:
+//   - The plugin is loaded on first use and stays loaded (Go cannot
+//     unload plugins); changing its file needs a restart.
+//   - Plugin functions take no context: the hook deadline cannot
+//     stop them, so they must return promptly.
+// -------------------------------------------------------
+type pluginProcessor struct {
+    file string
+}
+
+// symbol loads the plugin and looks up an exported function.
+func (p pluginProcessor) symbol(name string) (plugin.Symbol, error) {
+    loaded, err := plugin.Open(p.file)
+    if err != nil {
+        return nil, err
+    }
+    return loaded.Lookup(name)
+}
+
+func (p pluginProcessor) transform(name, rel string, content []byte) ([]byte, error) {
+    sym, err := p.symbol(name)
+    if err != nil {
+        return nil, err
+    }
+    fn, ok := sym.(func(string, []byte) ([]byte, error))
+    if !ok {
+        return nil, fmt.Errorf("%s has type %T, want func(string, []byte) ([]byte, error)", name, sym)
+    }
+    return fn(rel, content)
+}
+
+func (p pluginProcessor) OnSave(ctx context.Context, rel string, content []byte) ([]byte, error) {
+    return p.transform("OnSave", rel, content)
+}
+
+func (p pluginProcessor) OnRead(ctx context.Context, rel string, content []byte) ([]byte, error) {
+    return p.transform("OnRead", rel, content)
+}
+
+func (p pluginProcessor) OnIndex(ctx context.Context, rel string, content []byte) (map[string]string, error) {
+    sym, err := p.symbol("OnIndex")
+    if err != nil {
+        return nil, err
+    }
+    fn, ok := sym.(func(string, []byte) (map[string]string, error))
+    if !ok {
+        return nil, fmt.Errorf("OnIndex has type %T, want func(string, []byte) (map[string]string, error)", sym)
+    }
+    return fn(rel, content)
+}
+
+// newProcessor builds the Processor a config entry declares.
+func newProcessor(cfg config.ProcessorConfig) Processor {
+    if cfg.Plugin != "" {
+        return pluginProcessor{file: cfg.Plugin}
+    }
+    return commandProcessor{argv: cfg.Command}
+}
+
+// -------------------------------------------------------
+// func processorsFor(ctx, hook, rel) []config.ProcessorConfig
+// -------------------------------------------------------
+// Purpose:
+//   - The processors to run on hook for the note rel, in order.
+// -------------------------------------------------------
+func processorsFor(ctx context.Context, hook, rel string) []config.ProcessorConfig {
+    var selected []config.ProcessorConfig
+    for _, processor := range currentConfig(ctx).Processors {
+        if !oneOf(hook, processor.Hooks) {
+            continue
+        }
+        inScope := len(processor.Folders) == 0
+        for _, folder := range processor.Folders {
+            if strings.HasPrefix(rel, folder+"/") {
+                inScope = true
+            }
+        }
+        if inScope {
+            selected = append(selected, processor)
+        }
+    }
+    return selected
+}
+
+// processorContext bounds one hook call by the processor's timeout.
+func processorContext(ctx context.Context, cfg config.ProcessorConfig) (context.Context, context.CancelFunc) {
+    timeout := cfg.Timeout.Std()
+    if timeout == 0 {
+        timeout = defaultProcessorTimeout
+    }
+    return context.WithTimeout(ctx, timeout)
+}
+
+// -------------------------------------------------------
+// func processContent(ctx, hook, rel, content) ([]byte, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Run the save or read hooks over content; returns the result
+//     or the *ProcessorError of the first failing processor.
+// Audit:
+//   - fail_open processors that fail are logged and skipped.
+// -------------------------------------------------------
+func processContent(ctx context.Context, hook, rel string, content []byte) ([]byte, error) {
+    for _, cfg := range processorsFor(ctx, hook, rel) {
+        callCtx, cancel := processorContext(ctx, cfg)
+        var out []byte
+        var err error
+        if hook == hookSave {
+            out, err = newProcessor(cfg).OnSave(callCtx, rel, content)
+        } else {
+            out, err = newProcessor(cfg).OnRead(callCtx, rel, content)
+        }
+        cancel()
+        if err == nil && hook == hookSave {
+            if offset := firstInvalidUTF8(out); offset >= 0 {
+                err = fmt.Errorf("output is not valid UTF-8 at byte %d", offset)
+            }
+        }
+        if err != nil {
+            if ctx.Err() != nil {
+                return nil, ctx.Err()
+            }
+            if cfg.FailOpen {
+                logError(ctx, fmt.Sprintf("Processor %s (%s) failed for %s, passing content unchanged: %v", cfg.Name, hook, rel, err))
+                continue
+            }
+            return nil, &ProcessorError{Processor: cfg.Name, Hook: hook, Path: rel, Err: err}
+        }
+        if !bytes.Equal(out, content) {
+            logInfo(ctx, fmt.Sprintf("Processor %s (%s) changed %s: %d -> %d bytes", cfg.Name, hook, rel, len(content), len(out)))
+        }
+        content = out
+    }
+    return content, nil
+}
+
+// -------------------------------------------------------
+// func processIndex(ctx, rel, content)
+// -------------------------------------------------------
+// Purpose:
+//   - Run the index hooks over saved content and store the merged
+//     attributes in the index (later processors win on a key).
+// Audit:
+//   - Invalid keys, values over maxAttributeValue bytes, and
+//     attributes beyond maxAttributes are dropped.
+// -------------------------------------------------------
+func processIndex(ctx context.Context, rel string, content []byte) {
+    selected := processorsFor(ctx, hookIndex, rel)
+    if len(selected) == 0 {
+        return
+    }
+    merged := map[string]string{}
+    for _, cfg := range selected {
+        callCtx, cancel := processorContext(ctx, cfg)
+        attributes, err := newProcessor(cfg).OnIndex(callCtx, rel, content)
+        cancel()
+        if err != nil {
+            logError(ctx, fmt.Sprintf("Processor %s (index) failed for %s: %v", cfg.Name, rel, err))
+            continue
+        }
+        for key, value := range attributes {
+            if !attributeKeyPattern.MatchString(key) || len(value) > maxAttributeValue || !utf8.ValidString(value) {
+                continue
+            }
+            if _, exists := merged[key]; !exists && len(merged) == maxAttributes {
+                continue
+            }
+            merged[key] = value
+        }
+    }
+    if len(merged) == 0 {
+        merged = nil
+    }
+    indexSetAttributes(ctx, rel, merged)
+}
+
+// -------------------------------------------------------
+// func writeProcessorError(w, r, rel, err)
+// -------------------------------------------------------
+// Purpose:
+//   - Answer a failed save or read hook and audit it.
+// -------------------------------------------------------
+func writeProcessorError(w http.ResponseWriter, r *http.Request, rel string, err error) {
+    var failed *ProcessorError
+    if !errors.As(err, &failed) {
+        writeStorageError(w, r, err, "run processors on "+rel, "Internal error")
+        return
+    }
+    logError(r.Context(), "Processor failed for "+rel+": "+failed.Error())
+    code, status := apierror.CodeInvalidContent, http.StatusUnprocessableEntity
+    message := "Refused by processor " + failed.Processor + ": " + failed.Err.Error()
+    if failed.Hook == hookRead {
+        code, status = apierror.CodeUpstreamFailed, http.StatusBadGateway
+        message = "Processor " + failed.Processor + " failed"
+    }
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "processor.failed",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail:   fmt.Sprintf("processor=%s hook=%s error=%s", failed.Processor, failed.Hook, strings.ReplaceAll(failed.Err.Error(), "\n", " ")),
+    })
+    apierror.WriteDetails(w, r, code, "content", message, map[string]interface{}{"processor": failed.Processor, "hook": failed.Hook})
+}
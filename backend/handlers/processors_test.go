@@ -0,0 +1,93 @@
+// -------------------------------------------------------
+// backend/handlers/processors_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that save and read processors run on the routes beyond
+//     POST /file/save and GET /file that write or send note text,
+//     including conflict merges.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "cfo-scratchpad/config"
+)
+
+func TestProcessorsRunOnEveryRoute(t *testing.T) {
+    script := filepath.Join(t.TempDir(), "house-style.sh")
+    body := "#!/bin/sh\nif [ \"$SCRATCHPAD_HOOK\" = read ]; then sed 's/secret/[redacted]/g'; else sed 's/draft/final/g'; fi\n"
+    if err := os.WriteFile(script, []byte(body), 0700); err != nil {
+        t.Fatal(err)
+    }
+    cfg := config.Defaults()
+    cfg.Processors = []config.ProcessorConfig{{Name: "house-style", Hooks: []string{"save", "read"}, Command: []string{script}}}
+
+    const root = "/cfo-scratchpad-processortest"
+    store := NewMemStorage(root)
+    srv := NewServer(root, func() *config.Config { return cfg }, store, nil, nil)
+    if err := store.MkdirAll(root + "/close"); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.WriteFile(root+"/close/a.md", []byte("- [ ] draft secret\n")); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.WriteFile(root+"/close/b.md", []byte("draft two\n")); err != nil {
+        t.Fatal(err)
+    }
+
+    if rec := memServe(srv, HandleTasks, "PATCH", "/tasks", `{"path":"close/a.md","line":1}`); rec.Code != http.StatusOK {
+        t.Fatalf("toggle: %d %s", rec.Code, rec.Body)
+    }
+    if data, _ := store.ReadFile(root + "/close/a.md"); string(data) != "- [x] final secret\n" {
+        t.Fatalf("toggled note = %q, want the save processor's output", data)
+    }
+    if rec := memServe(srv, HandleFileConcat, "POST", "/file/concat", `{"paths":["close/a.md","close/b.md"],"target":"close/all.md","separator":""}`); rec.Code != http.StatusOK {
+        t.Fatalf("concat: %d %s", rec.Code, rec.Body)
+    }
+    if data, _ := store.ReadFile(root + "/close/all.md"); strings.Contains(string(data), "draft") {
+        t.Fatalf("concatenated note = %q, want the save processor's output", data)
+    }
+
+    for _, tc := range []struct {
+        name    string
+        handler http.HandlerFunc
+        target  string
+    }{
+        {"preview", HandleFilePreview, "/file/preview?path=close/a.md"},
+        {"search", HandleSearch, "/search?q=redacted"},
+    } {
+        rec := memServe(srv, tc.handler, "GET", tc.target, "")
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: %d %s", tc.name, rec.Code, rec.Body)
+        }
+        if !strings.Contains(rec.Body.String(), "[redacted]") || strings.Contains(rec.Body.String(), "secret") {
+            t.Errorf("%s sent unprocessed content: %s", tc.name, rec.Body)
+        }
+    }
+    if rec := memServe(srv, HandleSearch, "GET", "/search?q=secret", ""); strings.Contains(rec.Body.String(), "close/a.md") {
+        t.Errorf("search matched text the read processor hides: %s", rec.Body)
+    }
+
+    stale := strings.Repeat("0", 64)
+    if rec := memServe(srv, HandleFileSave, "POST", "/file/save", `{"path":"close/b.md","content":"theirs\n","base_sha256":"`+stale+`"}`); rec.Code != http.StatusConflict {
+        t.Fatalf("stale save: %d %s", rec.Code, rec.Body)
+    }
+    var conflicts []Conflict
+    rec := memServe(srv, HandleConflicts, "GET", "/conflicts", "")
+    if err := json.Unmarshal(rec.Body.Bytes(), &conflicts); err != nil || len(conflicts) != 1 {
+        t.Fatalf("conflicts: %d %s", rec.Code, rec.Body)
+    }
+    if rec := memServe(srv, HandleConflictResolve, "POST", "/conflicts/resolve", `{"id":"`+conflicts[0].ID+`","strategy":"merge","content":"draft merged\n"}`); rec.Code != http.StatusOK {
+        t.Fatalf("resolve: %d %s", rec.Code, rec.Body)
+    }
+    if data, _ := store.ReadFile(root + "/close/b.md"); string(data) != "final merged\n" {
+        t.Errorf("merged note = %q, want the save processor's output", data)
+    }
+}
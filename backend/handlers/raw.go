@@ -0,0 +1,223 @@
+// -------------------------------------------------------
+// backend/handlers/raw.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Raw mode: folders named in the raw.folders config may also
+//     hold files of any type (.json, .sql, .csv, ...), stored and
+//     served byte for byte.
+//       PUT    /file?path=...&raw=1    upload (body = file bytes)
+//       GET    /file?path=...&raw=1    download
+//       DELETE /file?path=...&raw=1    move to the trash
+//       GET    /files?folder=...&raw=1 list every file, not just notes
+//   - Notes (.txt, .md) stay the default: without raw=1 every route
+//     behaves as before, and notes are still saved with /file/save.
+// Audit:
+//   - Raw mode must be asked for on each request and is refused
+//     (403 forbidden) outside the configured folders.
+//   - Downloads carry the MIME type of the extension (else
+//     application/octet-stream) and always Content-Disposition:
+//     attachment, so an uploaded .html or .svg is never rendered by
+//     the browser in the app's origin. nosniff and a sandbox CSP are
+//     set with it (setUserContentHeaders, content_sniff.go).
+//   - Raw files are not indexed, searched, journaled or synced; the
+//     approval, legal hold and archive guards still apply.
+//   - Uploads write "file.raw_put" (size and SHA-256); downloads
+//     write "file.read" with detail "raw".
+//   - Uploads are scanned for malware first when antivirus.clamd is
+//     set (antivirus.go).
+//   - Uploaded scans and images queue an "ocr" job (ocr.go) when
+//     ocr.auto is on; X-OCR-Job names it.
+// Configuration:
+//   - raw.folders / RAW_FOLDERS       relative folders, subfolders
+//     included (default none)
+//   - raw.max_bytes / RAW_MAX_BYTES   upload limit (default 10 MiB)
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const rawDefaultType = "application/octet-stream"
+
+// rawRequested reports whether the request opted into raw mode.
+func rawRequested(r *http.Request) bool {
+    return r.URL.Query().Get("raw") == "1"
+}
+
+// -------------------------------------------------------
+// func rawAllowed(ctx, rel) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether rel (a file or folder) lies in a raw folder.
+// Audit:
+//   - Hidden components (".scratchpad", dotfiles) never qualify.
+// -------------------------------------------------------
+func rawAllowed(ctx context.Context, rel string) bool {
+    for _, part := range strings.Split(rel, "/") {
+        if strings.HasPrefix(part, ".") {
+            return false
+        }
+    }
+    for _, folder := range currentConfig(ctx).Raw.Folders {
+        if rel == folder || strings.HasPrefix(rel, folder+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func isFileName(r, absPath) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether a request may address absPath: any note that passes
+//     checkNoteRead, or any file of a raw folder when the request
+//     asked for raw mode.
+// -------------------------------------------------------
+func isFileName(r *http.Request, absPath string) bool {
+    if _, err := checkNoteRead(r.Context(), relativeTo(r.Context(), absPath)); err == nil {
+        return true
+    }
+    return rawRequested(r) && rawAllowed(r.Context(), relativeTo(r.Context(), absPath))
+}
+
+// rejectIfNotRaw answers 403 when rel is outside the raw folders.
+func rejectIfNotRaw(w http.ResponseWriter, r *http.Request, rel string) bool {
+    if rawAllowed(r.Context(), rel) {
+        return false
+    }
+    logError(r.Context(), "Raw mode refused outside raw folders: "+rel)
+    apierror.Write(w, r, apierror.CodeForbidden, "path", "Raw mode is not enabled for this folder")
+    return true
+}
+
+// -------------------------------------------------------
+// func handleRawGet(w, r, absPath)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file?path=...&raw=1: the file's bytes as an attachment.
+// -------------------------------------------------------
+func handleRawGet(w http.ResponseWriter, r *http.Request, absPath string) {
+    rel := relativeTo(r.Context(), absPath)
+    if rejectIfNotRaw(w, r, rel) {
+        return
+    }
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read raw file: "+absPath, "Internal error")
+        return
+    }
+
+    contentType := mime.TypeByExtension(strings.ToLower(path.Ext(rel)))
+    if contentType == "" {
+        contentType = rawDefaultType
+    }
+    logInfo(r.Context(), fmt.Sprintf("Read raw file: %s (%s, %d bytes)", absPath, contentType, len(content)))
+    auditFileRead(r, absPath, "raw")
+    setUserContentHeaders(w, r, rel, contentType, true)
+    w.Header().Set(contentHashHeader, contentHash(content))
+    w.Write(content)
+}
+
+// -------------------------------------------------------
+// func handleRawPut(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - PUT /file?path=...&raw=1: create or replace a file in a raw
+//     folder with the request body.
+// Audit:
+//   - Note names are refused: notes go through /file/save, which
+//     validates UTF-8 and keeps the index and journal current.
+//   - The folder must exist; bodies over raw.max_bytes answer 413.
+// -------------------------------------------------------
+func handleRawPut(w http.ResponseWriter, r *http.Request) {
+    if !rawRequested(r) {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    file := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    relPath, policyErr := applyNamePolicy(file)
+    if policyErr != nil {
+        logError(r.Context(), "Rejected raw path by policy: "+file+" ("+policyErr.Error()+")")
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path: "+policyErr.Error())
+        return
+    }
+    absPath := sanitizePath(r.Context(), relPath)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Notes are saved with /file/save")
+        return
+    }
+    if rejectIfNotRaw(w, r, relPath) || rejectIfArchived(w, r, absPath) || rejectIfApproved(w, r, absPath) || rejectIfHeld(w, r, absPath) {
+        return
+    }
+    ctx := r.Context()
+    if info, err := statPath(ctx, path.Dir(absPath)); err != nil || !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "Folder not found")
+        return
+    }
+
+    limit := currentConfig(ctx).Raw.MaxBytes
+    data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("File exceeds %d bytes", limit))
+            return
+        }
+        logError(ctx, "Failed to read raw upload: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInvalidField, "", "Bad request: could not read body")
+        return
+    }
+    if rejectIfInfected(w, r, relPath, "raw_put", data) {
+        return
+    }
+    _, statErr := statPath(ctx, absPath)
+    created := os.IsNotExist(statErr)
+    if err := writeFile(ctx, absPath, data); err != nil {
+        writeStorageError(w, r, err, "save raw file: "+absPath, "Write failed")
+        return
+    }
+
+    status := http.StatusOK
+    if created {
+        status = http.StatusCreated
+    }
+    hash := contentHash(data)
+    logInfo(ctx, fmt.Sprintf("Saved raw file: %s (%d bytes)", absPath, len(data)))
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "file.raw_put",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actorName(ctx),
+        Target:   relPath,
+        Detail:   fmt.Sprintf("bytes=%d sha256=%s created=%t", len(data), hash, created),
+    })
+    if jobID := queueUploadOCR(r, relPath); jobID != "" {
+        w.Header().Set("X-OCR-Job", jobID)
+    }
+    w.Header().Set(contentHashHeader, hash)
+    w.WriteHeader(status)
+}
@@ -0,0 +1,336 @@
+// -------------------------------------------------------
+// backend/handlers/recurring.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Recurring notes (weekly cash report, monthly flash): on each
+//     entry's cron schedule in "recurring", the template note is
+//     copied to the entry's target path with date placeholders
+//     filled in.
+//   - GET /recurring lists the entries with their next run and last
+//     result; POST /recurring {"name"} creates an entry's note now.
+// Audit:
+//   - An existing target is never overwritten; the run is recorded
+//     as "exists".
+//   - Each creation writes a "note.recurring" audit event and is
+//     indexed and journalled like a save.
+//   - Schedules are evaluated in UTC. A run missed while the server
+//     was down (up to recurringCatchUp) is made once on startup,
+//     for the latest missed time.
+//   - Last check and result per entry are kept in
+//     .scratchpad/recurring.json.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/schedule"
+)
+
+const (
+    recurringStateFile = "recurring.json"
+    recurringCatchUp   = 7 * 24 * time.Hour
+)
+
+// recurringMu serializes recurring note creation, scheduled or not.
+var recurringMu sync.Mutex
+
+// -------------------------------------------------------
+// type RecurringRun
+// -------------------------------------------------------
+// Purpose:
+//   - Last scheduler state of one recurring entry.
+// Audit:
+//   - CheckedAt is the time up to which the schedule has been
+//     handled; ScheduledFor is the occurrence last acted on.
+//   - Result is "created", "exists" or "error".
+// -------------------------------------------------------
+type RecurringRun struct {
+    CheckedAt    string `json:"checked_at"`
+    ScheduledFor string `json:"scheduled_for,omitempty"`
+    Target       string `json:"target,omitempty"`
+    Result       string `json:"result,omitempty"`
+    Error        string `json:"error,omitempty"`
+}
+
+// -------------------------------------------------------
+// func expandRecurring(text string, at time.Time) string
+// -------------------------------------------------------
+// Purpose:
+//   - Fill {yyyy}, {mm}, {dd}, {ww}, {q} and {date} from at.
+// Audit:
+//   - {ww} is the ISO week number, zero-padded.
+// -------------------------------------------------------
+func expandRecurring(text string, at time.Time) string {
+    _, week := at.ISOWeek()
+    return strings.NewReplacer(
+        "{yyyy}", at.Format("2006"),
+        "{mm}", at.Format("01"),
+        "{dd}", at.Format("02"),
+        "{ww}", fmt.Sprintf("%02d", week),
+        "{q}", strconv.Itoa((int(at.Month())+2)/3),
+        "{date}", at.Format("2006-01-02"),
+    ).Replace(text)
+}
+
+// -------------------------------------------------------
+// func createRecurring(ctx, note, at) (string, bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Create note's target for the occurrence at from its template;
+//     returns the relative target and whether it was created.
+// Audit:
+//   - The target passes the name policy and must not lie in an
+//     archived folder; missing parent folders are created.
+// -------------------------------------------------------
+func createRecurring(ctx context.Context, note config.RecurringNote, at time.Time) (string, bool, error) {
+    name, err := applyNamePolicy(expandRecurring(note.Target, at))
+    if err != nil {
+        return "", false, fmt.Errorf("target %q: %v", note.Target, err)
+    }
+    absTarget := sanitizePath(ctx, name)
+    if absTarget == "" || !isNoteName(absTarget) {
+        return "", false, fmt.Errorf("target %q is not a valid note path", name)
+    }
+    rel := relativeTo(ctx, absTarget)
+    if record, _, ok := archivedFolderFor(ctx, rel); ok {
+        return rel, false, fmt.Errorf("target folder is archived: %s", record.Path)
+    }
+    if _, err := statPath(ctx, absTarget); err == nil {
+        return rel, false, nil
+    } else if !os.IsNotExist(err) {
+        return rel, false, err
+    }
+
+    absTemplate := sanitizePath(ctx, note.Template)
+    if absTemplate == "" {
+        return rel, false, fmt.Errorf("template %q is not a valid note path", note.Template)
+    }
+    template, err := readNote(ctx, absTemplate)
+    if err != nil {
+        return rel, false, fmt.Errorf("read template %s: %w", note.Template, err)
+    }
+    content := []byte(expandRecurring(string(template), at))
+    if err := mkdirAll(ctx, filepath.Dir(absTarget)); err != nil {
+        return rel, false, err
+    }
+    if err := writeFile(ctx, absTarget, content); err != nil {
+        return rel, false, err
+    }
+    indexUpdate(ctx, rel, content)
+    journalPutEntry(ctx, rel, content)
+    return rel, true, nil
+}
+
+// -------------------------------------------------------
+// func runRecurring(ctx, note, at, method, actor) (RecurringRun, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Create one occurrence, log it, audit a creation and return
+//     the outcome for the state file.
+// -------------------------------------------------------
+func runRecurring(ctx context.Context, note config.RecurringNote, at time.Time, method, actor string) (RecurringRun, error) {
+    run := RecurringRun{CheckedAt: utcNow(ctx), ScheduledFor: at.UTC().Format(time.RFC3339)}
+    target, created, err := createRecurring(ctx, note, at)
+    run.Target = target
+    switch {
+    case err != nil:
+        run.Result, run.Error = "error", err.Error()
+        logError(ctx, "Recurring note "+note.Name+" failed: "+err.Error())
+    case created:
+        run.Result = "created"
+        logInfo(ctx, "Created recurring note "+note.Name+": "+target)
+    default:
+        run.Result = "exists"
+        logInfo(ctx, "Recurring note "+note.Name+" skipped, target exists: "+target)
+    }
+    if err != nil || created {
+        status := http.StatusCreated
+        detail := fmt.Sprintf("name=%s template=%s scheduled_for=%s", note.Name, note.Template, run.ScheduledFor)
+        if err != nil {
+            status = http.StatusInternalServerError
+            detail += " error=" + err.Error()
+        }
+        audit.WriteContext(ctx, audit.Event{
+            Event:  "note.recurring",
+            Method: method,
+            Path:   "/recurring",
+            Status: status,
+            Actor:  actor,
+            Target: defaultString(target, note.Target),
+            Detail: detail,
+        })
+    }
+    return run, err
+}
+
+// loadRecurringState reads recurring.json (name -> last run).
+func loadRecurringState(ctx context.Context) (map[string]RecurringRun, error) {
+    state := map[string]RecurringRun{}
+    err := loadMetaJSON(ctx, recurringStateFile, &state)
+    return state, err
+}
+
+// -------------------------------------------------------
+// func checkRecurring(ctx, cfg, now)
+// -------------------------------------------------------
+// Purpose:
+//   - One scheduler pass: run every entry with an occurrence since
+//     its last check.
+// Audit:
+//   - An entry seen for the first time starts at now (no backfill);
+//     several missed occurrences produce one run, for the latest.
+// -------------------------------------------------------
+func checkRecurring(ctx context.Context, cfg *config.Config, now time.Time) {
+    recurringMu.Lock()
+    defer recurringMu.Unlock()
+    state, err := loadRecurringState(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load recurring state: "+err.Error())
+        return
+    }
+
+    next := map[string]RecurringRun{}
+    for _, note := range cfg.Recurring {
+        sched, err := schedule.Parse(note.Schedule)
+        if err != nil {
+            continue
+        }
+        run, seen := state[note.Name]
+        checked, err := time.Parse(time.RFC3339, run.CheckedAt)
+        if !seen || err != nil {
+            checked = now
+        }
+        if checked.Before(now.Add(-recurringCatchUp)) {
+            checked = now.Add(-recurringCatchUp)
+        }
+
+        var due time.Time
+        for at := sched.Next(checked); !at.IsZero() && !at.After(now); at = sched.Next(at) {
+            due = at
+        }
+        if !due.IsZero() {
+            ctx, cancel := context.WithTimeout(ctx, time.Minute)
+            run, _ = runRecurring(ctx, note, due, "SCHEDULE", "")
+            cancel()
+        }
+        run.CheckedAt = now.UTC().Format(time.RFC3339)
+        next[note.Name] = run
+    }
+    if err := saveMetaJSON(ctx, recurringStateFile, next); err != nil {
+        logError(ctx, "Failed to save recurring state: "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func RunRecurring()
+// -------------------------------------------------------
+// Purpose:
+//   - Check the recurring schedules at the start of every minute.
+// Audit:
+//   - Configuration is re-read each check; checks are skipped while
+//     schedules are paused (maintenance mode).
+// -------------------------------------------------------
+func RunRecurring(ctx context.Context) {
+    for {
+        now := timeNow(ctx).UTC()
+        time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+        cfg := currentConfig(ctx)
+        if len(cfg.Recurring) == 0 || SchedulesPaused() {
+            continue
+        }
+        checkRecurring(ctx, cfg, timeNow(ctx).UTC().Truncate(time.Minute))
+    }
+}
+
+// -------------------------------------------------------
+// func HandleRecurring(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /recurring: {"recurring": [{name, schedule, template,
+//     target, next_run, next_target, last}]}.
+//   - POST /recurring {"name"}: create the entry's note for the
+//     current time; 200 with the run (result "created" or "exists").
+// -------------------------------------------------------
+func HandleRecurring(w http.ResponseWriter, r *http.Request) {
+    cfg := currentConfig(r.Context())
+    switch r.Method {
+    case http.MethodGet:
+        recurringMu.Lock()
+        state, err := loadRecurringState(r.Context())
+        recurringMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load recurring state", "Internal error")
+            return
+        }
+        now := timeNow(r.Context()).UTC()
+        entries := []map[string]interface{}{}
+        for _, note := range cfg.Recurring {
+            entry := map[string]interface{}{
+                "name":     note.Name,
+                "schedule": note.Schedule,
+                "template": note.Template,
+                "target":   note.Target,
+            }
+            if sched, err := schedule.Parse(note.Schedule); err == nil {
+                if at := sched.Next(now); !at.IsZero() {
+                    entry["next_run"] = at.Format(time.RFC3339)
+                    entry["next_target"] = expandRecurring(note.Target, at)
+                }
+            }
+            if run, ok := state[note.Name]; ok {
+                entry["last"] = run
+            }
+            entries = append(entries, entry)
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"recurring": entries})
+        return
+    case http.MethodPost:
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        Name string `json:"name"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "name", req.Name) {
+        return
+    }
+    for _, note := range cfg.Recurring {
+        if note.Name != req.Name {
+            continue
+        }
+        recurringMu.Lock()
+        run, err := runRecurring(r.Context(), note, timeNow(r.Context()).UTC(), r.Method, actorName(r.Context()))
+        recurringMu.Unlock()
+        if errors.Is(err, os.ErrNotExist) {
+            apierror.Write(w, r, apierror.CodeInvalidConfig, "name", "Template note not found: "+note.Template)
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "create recurring note "+note.Name, "Recurring note failed")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(run)
+        return
+    }
+    apierror.Write(w, r, apierror.CodeNotFound, "name", "No recurring note named "+req.Name)
+}
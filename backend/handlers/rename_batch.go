@@ -0,0 +1,420 @@
+// -------------------------------------------------------
+// backend/handlers/rename_batch.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Rename many notes of one folder with a pattern, so
+//     "2024-03_*" becomes "FY24-Q1_*" in one operation:
+//       POST /files/rename-batch {"folder", "files", "mode", "find",
+//                                 "replace", "sequence", "dry_run",
+//                                 "plan"}
+//   - Modes work on the name without its extension, which is kept:
+//       prefix  a name starting with find gets replace instead
+//       suffix  a name ending with find gets replace instead
+//       regex   the first match of find is replaced; replace may
+//               use $1, ${name}
+//   - "{n}" in replace is a sequence number, counted in listing
+//     order (manual positions first, see ordering.go) over the
+//     notes that match, from sequence.start by sequence.step,
+//     zero-padded to sequence.width.
+//   - A dry run (the default) returns every rename and a plan
+//     token; applying requires that token, like /files/replace.
+// Audit:
+//   - Apply renames one by one and renames back in reverse order
+//     if one fails; the index, journal and sidecar records are
+//     updated once all renames succeeded.
+//   - Targets must be new: a target that exists, or two notes
+//     mapping to the same target, fail the whole request.
+//   - Approved notes and notes under legal hold are not renamed;
+//     they are listed in "skipped" with the reason.
+//   - Applies write a "files.rename_batch" audit event listing
+//     every rename.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    maxRenameBatch      = 1000
+    renameBatchTimeout  = 2 * time.Minute
+    renameSequenceToken = "{n}"
+)
+
+// Rename modes.
+const (
+    renamePrefix = "prefix"
+    renameSuffix = "suffix"
+    renameRegex  = "regex"
+)
+
+// renameBatchMu serializes applies, so two batches cannot interleave.
+var renameBatchMu sync.Mutex
+
+// -------------------------------------------------------
+// type RenameBatchRequest / RenameSequence / RenameItem
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes of /files/rename-batch.
+// Audit:
+//   - Files lists note names in Folder; empty means every note
+//     in it (not in subfolders).
+//   - DryRun is a pointer so an omitted field means a dry run.
+// -------------------------------------------------------
+type RenameBatchRequest struct {
+    Folder   string          `json:"folder"`
+    Files    []string        `json:"files"`
+    Mode     string          `json:"mode"`
+    Find     string          `json:"find"`
+    Replace  string          `json:"replace"`
+    Sequence *RenameSequence `json:"sequence"`
+    DryRun   *bool           `json:"dry_run"`
+    Plan     string          `json:"plan"`
+}
+
+type RenameSequence struct {
+    Start *int `json:"start"`
+    Step  int  `json:"step"`
+    Width int  `json:"width"`
+}
+
+type RenameItem struct {
+    From string `json:"from"`
+    To   string `json:"to"`
+}
+
+// renameBatchPlan is a computed batch: renames, skips and the token.
+type renameBatchPlan struct {
+    token   string
+    renames []RenameItem
+    skipped []ReplaceSkip
+}
+
+// -------------------------------------------------------
+// func renameBatchMatcher(ctx, req) (func(stem string) (string, bool), error)
+// -------------------------------------------------------
+// Purpose:
+//   - The stem rewrite of a request: new stem and whether the
+//     pattern matched. "{n}" is left in place for the caller.
+// Audit:
+//   - Regex mode replaces only the first match, so a pattern that
+//     can match the empty string ("^", "x*") inserts once instead
+//     of between every character.
+// -------------------------------------------------------
+func renameBatchMatcher(ctx context.Context, req RenameBatchRequest) (func(string) (string, bool), error) {
+    switch req.Mode {
+    case renamePrefix:
+        return func(stem string) (string, bool) {
+            if !strings.HasPrefix(stem, req.Find) {
+                return stem, false
+            }
+            return req.Replace + strings.TrimPrefix(stem, req.Find), true
+        }, nil
+    case renameSuffix:
+        return func(stem string) (string, bool) {
+            if !strings.HasSuffix(stem, req.Find) {
+                return stem, false
+            }
+            return strings.TrimSuffix(stem, req.Find) + req.Replace, true
+        }, nil
+    case renameRegex:
+        if req.Find == "" {
+            return nil, invalidField("find", "is required in regex mode")
+        }
+        if len(req.Find) > maxSearchQueryBytes {
+            return nil, invalidField("find", "exceeds %d bytes", maxSearchQueryBytes)
+        }
+        re, err := compileSearch(ctx, req.Find)
+        if err == context.DeadlineExceeded {
+            return nil, invalidField("find", "took too long to compile")
+        }
+        if err != nil {
+            return nil, invalidField("find", "is not a valid pattern: %v", err)
+        }
+        return func(stem string) (string, bool) {
+            match := re.FindStringSubmatchIndex(stem)
+            if match == nil {
+                return stem, false
+            }
+            replaced := re.ExpandString(nil, req.Replace, stem, match)
+            return stem[:match[0]] + string(replaced) + stem[match[1]:], true
+        }, nil
+    }
+    return nil, invalidField("mode", "must be prefix, suffix or regex")
+}
+
+// -------------------------------------------------------
+// func buildRenameBatchPlan(ctx, req, absFolder) (*renameBatchPlan, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Compute every rename of a request without touching a note.
+// Audit:
+//   - Errors are *fieldError for request problems; a conflicting
+//     target is reported as conflictError.
+//   - The token hashes the request and every (from, to) pair.
+// -------------------------------------------------------
+func buildRenameBatchPlan(ctx context.Context, req RenameBatchRequest, absFolder string) (*renameBatchPlan, error) {
+    rewrite, err := renameBatchMatcher(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    folderRel := relativeTo(ctx, absFolder)
+    entries, err := readDir(ctx, absFolder)
+    if err != nil {
+        return nil, err
+    }
+    present := map[string]bool{}
+    names := []string{}
+    for _, entry := range entries {
+        present[entry.Name()] = true
+        if entry.Mode().IsRegular() && isNoteName(entry.Name()) {
+            names = append(names, entry.Name())
+        }
+    }
+    if len(req.Files) > 0 {
+        wanted := map[string]bool{}
+        for _, name := range req.Files {
+            if name != path.Base(name) || !present[name] || !isNoteName(name) {
+                return nil, invalidField("files", "%q is not a note in %s", name, folderRel)
+            }
+            wanted[name] = true
+        }
+        selected := names[:0]
+        for _, name := range names {
+            if wanted[name] {
+                selected = append(selected, name)
+            }
+        }
+        names = selected
+    }
+    sortNotesByPosition(ctx, folderRel, names)
+
+    number, step, width := 1, 1, 0
+    if req.Sequence != nil {
+        if req.Sequence.Start != nil {
+            number = *req.Sequence.Start
+        }
+        if req.Sequence.Step != 0 {
+            step = req.Sequence.Step
+        }
+        width = req.Sequence.Width
+    }
+    plan := &renameBatchPlan{renames: []RenameItem{}, skipped: []ReplaceSkip{}}
+    hash := sha256.New()
+    fmt.Fprintf(hash, "%q %q %q %q %q %d %d %d\n", folderRel, req.Files, req.Mode, req.Find, req.Replace, number, step, width)
+    targets := map[string]string{}
+    for _, name := range names {
+        ext := path.Ext(name)
+        stem, matched := rewrite(strings.TrimSuffix(name, ext))
+        if !matched {
+            continue
+        }
+        if strings.Contains(stem, renameSequenceToken) {
+            digits := strconv.Itoa(number)
+            if pad := width - len(digits); pad > 0 && number >= 0 {
+                digits = strings.Repeat("0", pad) + digits
+            }
+            stem = strings.ReplaceAll(stem, renameSequenceToken, digits)
+        }
+        number += step
+        target := stem + ext
+        if target == name {
+            continue
+        }
+        from := path.Join(folderRel, name)
+        if strings.Contains(target, "/") {
+            return nil, invalidField("replace", "gives a name with a slash for %s: %q", name, target)
+        }
+        if len(plan.renames) == maxRenameBatch {
+            return nil, invalidField("files", "would rename more than %d notes; narrow the selection", maxRenameBatch)
+        }
+        to, policyErr := applyNamePolicy(path.Join(folderRel, target))
+        if policyErr != nil || path.Dir(to) != path.Clean(folderRel) || !isNoteName(to) {
+            reason := "must stay a note in the same folder"
+            if policyErr != nil {
+                reason = policyErr.Error()
+            }
+            return nil, invalidField("replace", "gives an invalid name for %s: %q (%s)", name, target, reason)
+        }
+        switch {
+        case isApproved(ctx, from):
+            plan.skipped = append(plan.skipped, ReplaceSkip{Path: from, Reason: "approved"})
+            continue
+        case isHeld(ctx, from):
+            plan.skipped = append(plan.skipped, ReplaceSkip{Path: from, Reason: "legal_hold"})
+            continue
+        }
+        if present[path.Base(to)] {
+            return nil, conflictError{fmt.Sprintf("%s would overwrite the existing note %s", from, to)}
+        }
+        if other, dup := targets[to]; dup {
+            return nil, conflictError{fmt.Sprintf("%s and %s would both become %s", other, from, to)}
+        }
+        targets[to] = from
+        plan.renames = append(plan.renames, RenameItem{From: from, To: to})
+        fmt.Fprintf(hash, "%q %q\n", from, to)
+    }
+    plan.token = hex.EncodeToString(hash.Sum(nil))
+    return plan, nil
+}
+
+// conflictError reports a batch whose targets collide.
+type conflictError struct {
+    reason string
+}
+
+func (e conflictError) Error() string {
+    return e.reason
+}
+
+// -------------------------------------------------------
+// func applyRenameBatch(ctx, plan) error
+// -------------------------------------------------------
+// Purpose:
+//   - Rename every planned note; rename back on failure.
+// Audit:
+//   - Runs without the request's cancellation, so a client
+//     disconnecting cannot stop the batch halfway.
+// -------------------------------------------------------
+func applyRenameBatch(ctx context.Context, plan *renameBatchPlan) error {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), renameBatchTimeout)
+    defer cancel()
+    for i, item := range plan.renames {
+        err := renamePath(ctx, sanitizePath(ctx, item.From), sanitizePath(ctx, item.To))
+        if err == nil {
+            continue
+        }
+        for j := i - 1; j >= 0; j-- {
+            done := plan.renames[j]
+            if undoErr := renamePath(ctx, sanitizePath(ctx, done.To), sanitizePath(ctx, done.From)); undoErr != nil {
+                logError(ctx, "Rename batch rollback failed for "+done.To+" -> "+done.From+": "+undoErr.Error())
+            }
+        }
+        return fmt.Errorf("rename %s: %v", item.From, err)
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func HandleFilesRenameBatch(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST: dry-run or apply a batch rename.
+// Audit:
+//   - Apply answers 409 conflict when the plan token no longer
+//     matches (notes were added, renamed or re-ordered since the
+//     dry run); details.plan carries the fresh token.
+// -------------------------------------------------------
+func HandleFilesRenameBatch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req RenameBatchRequest
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "folder", req.Folder) || !requireField(w, r, "mode", req.Mode) {
+        return
+    }
+    if req.Sequence != nil && (req.Sequence.Width < 0 || req.Sequence.Width > 9) {
+        writeFieldError(w, r, invalidField("sequence.width", "must be 0-9"))
+        return
+    }
+    absFolder := sanitizePath(r.Context(), req.Folder)
+    if absFolder == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, absFolder) {
+        return
+    }
+    if info, err := statPath(r.Context(), absFolder); err != nil || !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeNotFound, "folder", "Folder not found")
+        return
+    }
+    dryRun := req.DryRun == nil || *req.DryRun
+    if !dryRun && !requireField(w, r, "plan", req.Plan) {
+        return
+    }
+    if !dryRun {
+        renameBatchMu.Lock()
+        defer renameBatchMu.Unlock()
+    }
+    plan, err := buildRenameBatchPlan(r.Context(), req, absFolder)
+    if err != nil {
+        if conflict, ok := err.(conflictError); ok {
+            apierror.Write(w, r, apierror.CodeConflict, "replace", "Conflicting rename: "+conflict.reason)
+            return
+        }
+        if _, ok := err.(*fieldError); ok {
+            writeFieldError(w, r, err)
+            return
+        }
+        writeStorageError(w, r, err, "plan rename batch in "+absFolder, "Rename failed")
+        return
+    }
+    if dryRun {
+        logInfo(r.Context(), fmt.Sprintf("Rename batch dry run in %s: %d renames", absFolder, len(plan.renames)))
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "dry_run": true,
+            "plan":    plan.token,
+            "renames": plan.renames,
+            "skipped": plan.skipped,
+        })
+        return
+    }
+    if plan.token != req.Plan {
+        logInfo(r.Context(), "Rename batch plan is stale for "+absFolder)
+        apierror.WriteDetails(w, r, apierror.CodeConflict, "plan", "Notes changed since the dry run; review the new plan",
+            map[string]interface{}{"plan": plan.token})
+        return
+    }
+    if len(plan.renames) == 0 {
+        writeFieldError(w, r, invalidField("find", "matches nothing to rename"))
+        return
+    }
+    if err := applyRenameBatch(r.Context(), plan); err != nil {
+        logError(r.Context(), "Rename batch in "+absFolder+" failed and was rolled back: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Rename failed; no notes were renamed")
+        return
+    }
+    pairs := make([]string, 0, len(plan.renames))
+    for _, item := range plan.renames {
+        journalMoveEntry(r.Context(), item.From, item.To, indexRename(r.Context(), item.From, item.To))
+        renameNoteMeta(r.Context(), item.From, item.To)
+        pairs = append(pairs, item.From+" -> "+item.To)
+    }
+    sort.Strings(pairs)
+    logInfo(r.Context(), fmt.Sprintf("Renamed %d notes in %s", len(plan.renames), absFolder))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "files.rename_batch",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   relativeTo(r.Context(), absFolder),
+        Detail:   fmt.Sprintf("mode=%s find=%q replace=%q renamed=%d skipped=%d: %s", req.Mode, req.Find, req.Replace, len(plan.renames), len(plan.skipped), strings.Join(pairs, "; ")),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "dry_run": false,
+        "renames": plan.renames,
+        "skipped": plan.skipped,
+    })
+}
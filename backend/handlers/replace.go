@@ -0,0 +1,572 @@
+// -------------------------------------------------------
+// backend/handlers/replace.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Find-and-replace across every note in a folder:
+//       POST /files/replace {"folder", "find", "replace", "mode",
+//                            "ignore_case", "dry_run", "plan"}
+//       GET  /files/replace   snapshots of past replacements
+//   - A dry run (the default) returns per-file unified diffs and a
+//     plan token; applying requires that token, so every apply was
+//     previewed and nothing changed in between.
+// Audit:
+//   - Apply is transactional: the pre-change content of every
+//     modified note is snapshotted under .scratchpad/snapshots/<id>/
+//     first, and a failed write restores the notes already written.
+//   - Ledger and approved notes are never modified; they are listed
+//     in "skipped" with the reason. So is a note saved between the
+//     plan check and its write ("stale").
+//   - A replacement that would leave content the folder's
+//     content_policy refuses fails the whole apply (422).
+//   - Applies write a "files.replace" audit event with the actor,
+//     the snapshot id, and the counts.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    snapshotsDirName    = "snapshots"
+    snapshotManifest    = "manifest.json"
+    maxReplaceFiles     = 1000
+    replaceDiffContext  = 3
+    replaceApplyTimeout = 2 * time.Minute
+)
+
+// Replace modes.
+const (
+    replaceLiteral = "literal"
+    replaceRegex   = "regex"
+)
+
+// replaceMu serializes applies, so two plans cannot interleave.
+var replaceMu sync.Mutex
+
+// -------------------------------------------------------
+// type ReplaceRequest / ReplaceFile / ReplaceSkip / ReplaceSnapshot
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes of /files/replace.
+// Audit:
+//   - DryRun is a pointer so an omitted field means a dry run.
+//   - In regex mode Replace may use $1 / ${name}; in literal mode
+//     it is inserted as-is.
+//   - SHA256Before/After identify the note versions the plan covers.
+// -------------------------------------------------------
+type ReplaceRequest struct {
+    Folder     string `json:"folder"`
+    Find       string `json:"find"`
+    Replace    string `json:"replace"`
+    Mode       string `json:"mode"`
+    IgnoreCase bool   `json:"ignore_case"`
+    DryRun     *bool  `json:"dry_run"`
+    Plan       string `json:"plan"`
+}
+
+type ReplaceFile struct {
+    Path         string `json:"path"`
+    Replacements int    `json:"replacements"`
+    SHA256Before string `json:"sha256_before"`
+    SHA256After  string `json:"sha256_after"`
+    Diff         string `json:"diff,omitempty"`
+}
+
+type ReplaceSkip struct {
+    Path   string `json:"path"`
+    Reason string `json:"reason"`
+}
+
+type ReplaceSnapshot struct {
+    ID      string        `json:"id"`
+    At      string        `json:"at"`
+    Actor   string        `json:"actor,omitempty"`
+    Folder  string        `json:"folder"`
+    Find    string        `json:"find"`
+    Replace string        `json:"replace"`
+    Mode    string        `json:"mode"`
+    Files   []ReplaceFile `json:"files"`
+}
+
+// replacePlan is a computed replacement: results plus new contents.
+type replacePlan struct {
+    token    string
+    files    []ReplaceFile
+    skipped  []ReplaceSkip
+    abs      map[string]string
+    before   map[string][]byte
+    after    map[string][]byte
+    replaced int
+}
+
+// -------------------------------------------------------
+// func unifiedDiff(path, before, after string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Unified diff (diff -u style, replaceDiffContext lines of
+//     context) between two versions of a note.
+// Audit:
+//   - Uses the line matcher of merge.go (diffMatches); past its
+//     edit limit the diff is correct but not minimal.
+// -------------------------------------------------------
+func unifiedDiff(path, before, after string) string {
+    a, b := splitLines(before), splitLines(after)
+    match, _ := diffMatches(a, b)
+
+    // Edit script: ' ' keep, '-' delete, '+' insert, with the line
+    // numbers (0-based) each op refers to.
+    type op struct {
+        kind byte
+        line string
+        ai   int
+        bi   int
+    }
+    ops := []op{}
+    j := 0
+    for i := range a {
+        if match[i] < 0 {
+            ops = append(ops, op{'-', a[i], i, j})
+            continue
+        }
+        for ; j < match[i]; j++ {
+            ops = append(ops, op{'+', b[j], i, j})
+        }
+        ops = append(ops, op{' ', a[i], i, j})
+        j++
+    }
+    for ; j < len(b); j++ {
+        ops = append(ops, op{'+', b[j], len(a), j})
+    }
+
+    var out strings.Builder
+    out.WriteString("--- a/" + path + "\n+++ b/" + path + "\n")
+    for start := 0; start < len(ops); {
+        for start < len(ops) && ops[start].kind == ' ' {
+            start++
+        }
+        if start == len(ops) {
+            break
+        }
+        // Extend the hunk while changes are within 2*context lines.
+        from := start - replaceDiffContext
+        if from < 0 {
+            from = 0
+        }
+        end, quiet := start, 0
+        for end < len(ops) && quiet <= 2*replaceDiffContext {
+            if ops[end].kind == ' ' {
+                quiet++
+            } else {
+                quiet = 0
+            }
+            end++
+        }
+        if quiet > replaceDiffContext {
+            end -= quiet - replaceDiffContext
+        }
+
+        aCount, bCount := 0, 0
+        for _, o := range ops[from:end] {
+            if o.kind != '+' {
+                aCount++
+            }
+            if o.kind != '-' {
+                bCount++
+            }
+        }
+        aStart, bStart := ops[from].ai+1, ops[from].bi+1
+        if aCount == 0 {
+            aStart--
+        }
+        if bCount == 0 {
+            bStart--
+        }
+        fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+        for _, o := range ops[from:end] {
+            out.WriteByte(o.kind)
+            out.WriteString(o.line)
+            if !strings.HasSuffix(o.line, "\n") {
+                out.WriteString("\n\\ No newline at end of file\n")
+            }
+        }
+        start = end
+    }
+    return out.String()
+}
+
+// -------------------------------------------------------
+// func replacePattern(ctx, req) (*regexp.Regexp, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Compile the find expression of a request.
+// Audit:
+//   - Errors are *fieldError; patterns matching the empty string
+//     are refused (they would insert between every character).
+// -------------------------------------------------------
+func replacePattern(ctx context.Context, req ReplaceRequest) (*regexp.Regexp, error) {
+    if len(req.Find) > maxSearchQueryBytes {
+        return nil, invalidField("find", "exceeds %d bytes", maxSearchQueryBytes)
+    }
+    expr := req.Find
+    if req.Mode == replaceLiteral {
+        expr = regexp.QuoteMeta(expr)
+    }
+    if req.IgnoreCase {
+        expr = "(?i)" + expr
+    }
+    re, err := compileSearch(ctx, expr)
+    if err == context.DeadlineExceeded {
+        return nil, invalidField("find", "took too long to compile")
+    }
+    if err != nil {
+        return nil, invalidField("find", "is not a valid pattern: %v", err)
+    }
+    if re.MatchString("") {
+        return nil, invalidField("find", "matches the empty string")
+    }
+    return re, nil
+}
+
+// -------------------------------------------------------
+// func buildReplacePlan(ctx, req, re, scope) (*replacePlan, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Apply the replacement in memory to every note under scope.
+// Audit:
+//   - "after" is the replaced content as the save processors
+//     return it; a refusing processor fails the whole plan.
+//   - The token hashes the request and every (path, before, after)
+//     triple, so it changes if any affected note changes.
+// -------------------------------------------------------
+func buildReplacePlan(ctx context.Context, req ReplaceRequest, re *regexp.Regexp, scope string) (*replacePlan, error) {
+    plan := &replacePlan{
+        files:   []ReplaceFile{},
+        skipped: []ReplaceSkip{},
+        abs:     map[string]string{},
+        before:  map[string][]byte{},
+        after:   map[string][]byte{},
+    }
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(notes, func(i, j int) bool { return notes[i].Rel < notes[j].Rel })
+
+    hash := sha256.New()
+    fmt.Fprintf(hash, "%q %q %q %q %t\n", scope, req.Find, req.Replace, req.Mode, req.IgnoreCase)
+    for _, note := range notes {
+        if scope != "" && !strings.HasPrefix(note.Rel, scope) {
+            continue
+        }
+        if note.Size > maxSearchFileBytes {
+            plan.skipped = append(plan.skipped, ReplaceSkip{Path: note.Rel, Reason: "too_large"})
+            continue
+        }
+        content, err := readFile(ctx, note.Abs)
+        if err != nil {
+            return nil, err
+        }
+        count := len(re.FindAllIndex(content, -1))
+        if count == 0 {
+            continue
+        }
+        switch {
+        case isLedger(ctx, note.Rel):
+            plan.skipped = append(plan.skipped, ReplaceSkip{Path: note.Rel, Reason: "ledger"})
+            continue
+        case isApproved(ctx, note.Rel):
+            plan.skipped = append(plan.skipped, ReplaceSkip{Path: note.Rel, Reason: "approved"})
+            continue
+        }
+
+        var updated []byte
+        if req.Mode == replaceLiteral {
+            updated = re.ReplaceAllLiteral(content, []byte(req.Replace))
+        } else {
+            updated = re.ReplaceAll(content, []byte(req.Replace))
+        }
+        updated, err = processContent(ctx, hookSave, note.Rel, updated)
+        if err != nil {
+            return nil, err
+        }
+        if string(updated) == string(content) {
+            continue
+        }
+        if len(plan.files) == maxReplaceFiles {
+            return nil, invalidField("find", "would modify more than %d notes; narrow the folder", maxReplaceFiles)
+        }
+        file := ReplaceFile{
+            Path:         note.Rel,
+            Replacements: count,
+            SHA256Before: contentHash(content),
+            SHA256After:  contentHash(updated),
+        }
+        fmt.Fprintf(hash, "%q %s %s\n", file.Path, file.SHA256Before, file.SHA256After)
+        plan.files = append(plan.files, file)
+        plan.abs[note.Rel] = note.Abs
+        plan.before[note.Rel] = content
+        plan.after[note.Rel] = updated
+        plan.replaced += count
+    }
+    plan.token = hex.EncodeToString(hash.Sum(nil))
+    return plan, nil
+}
+
+// -------------------------------------------------------
+// func applyReplacePlan(ctx, plan, snapshot) error
+// -------------------------------------------------------
+// Purpose:
+//   - Snapshot, then write every planned note; undo on failure.
+// Audit:
+//   - Holds conflictMu, like base-checked saves: each note is
+//     re-hashed first, and one that no longer matches SHA256Before
+//     (saved since the plan was built) is left alone and moved to
+//     plan.skipped as "stale".
+//   - Runs on a context detached from the request, so a client
+//     disconnecting cannot stop the transaction halfway.
+//   - Rollback failures are logged; the snapshot still holds the
+//     original content.
+// -------------------------------------------------------
+func applyReplacePlan(ctx context.Context, plan *replacePlan, snapshot ReplaceSnapshot) error {
+    conflictMu.Lock()
+    defer conflictMu.Unlock()
+    fresh := []ReplaceFile{}
+    for _, file := range plan.files {
+        current, err := readFile(ctx, plan.abs[file.Path])
+        if err == nil && contentHash(current) == file.SHA256Before {
+            fresh = append(fresh, file)
+            continue
+        }
+        logInfo(ctx, "Replace skipped "+file.Path+": changed since the plan was built")
+        plan.skipped = append(plan.skipped, ReplaceSkip{Path: file.Path, Reason: "stale"})
+        plan.replaced -= file.Replacements
+    }
+    plan.files = fresh
+    snapshot.Files = fresh
+
+    for _, file := range plan.files {
+        if err := writeMetaFile(ctx, filepath.Join(snapshotsDirName, snapshot.ID, "files", filepath.FromSlash(file.Path)), plan.before[file.Path]); err != nil {
+            return fmt.Errorf("snapshot %s: %v", file.Path, err)
+        }
+    }
+    if err := saveMetaJSON(ctx, filepath.Join(snapshotsDirName, snapshot.ID, snapshotManifest), snapshot); err != nil {
+        return fmt.Errorf("snapshot manifest: %v", err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), replaceApplyTimeout)
+    defer cancel()
+    for i, file := range plan.files {
+        err := writeFile(ctx, plan.abs[file.Path], plan.after[file.Path])
+        if err == nil {
+            continue
+        }
+        for _, written := range plan.files[:i+1] {
+            if undoErr := writeFile(ctx, plan.abs[written.Path], plan.before[written.Path]); undoErr != nil {
+                logError(ctx, "Replace rollback failed for "+written.Path+" (restore from snapshot "+snapshot.ID+"): "+undoErr.Error())
+            }
+        }
+        return fmt.Errorf("write %s: %v", file.Path, err)
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func listReplaceSnapshots() ([]ReplaceSnapshot, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Manifests of past replacements, newest first.
+// -------------------------------------------------------
+func listReplaceSnapshots(ctx context.Context) ([]ReplaceSnapshot, error) {
+    snapshots := []ReplaceSnapshot{}
+    entries, err := serverFrom(ctx).Storage.ReadDir(metaPath(ctx, snapshotsDirName))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return snapshots, nil
+        }
+        return snapshots, err
+    }
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+        var snapshot ReplaceSnapshot
+        if err := loadMetaJSON(ctx, filepath.Join(snapshotsDirName, entry.Name(), snapshotManifest), &snapshot); err != nil {
+            logError(ctx, "Skipping unreadable snapshot "+entry.Name()+": "+err.Error())
+            continue
+        }
+        if snapshot.ID != "" {
+            snapshots = append(snapshots, snapshot)
+        }
+    }
+    sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+    return snapshots, nil
+}
+
+// -------------------------------------------------------
+// func HandleFilesReplace(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST: dry-run or apply a replacement. GET: list snapshots.
+// Audit:
+//   - Apply answers 409 conflict when the plan token no longer
+//     matches (a note changed, or the request differs from the dry
+//     run); details.plan carries the fresh token.
+// -------------------------------------------------------
+func HandleFilesReplace(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        snapshots, err := listReplaceSnapshots(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "list replace snapshots", "Internal server error")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(snapshots)
+        return
+    case http.MethodPost:
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req ReplaceRequest
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "folder", req.Folder) || !requireField(w, r, "find", req.Find) {
+        return
+    }
+    req.Mode = defaultString(req.Mode, replaceLiteral)
+    if !oneOf(req.Mode, []string{replaceLiteral, replaceRegex}) {
+        writeFieldError(w, r, invalidField("mode", "must be literal or regex"))
+        return
+    }
+    if !utf8.ValidString(req.Replace) {
+        writeFieldError(w, r, invalidField("replace", "is not valid UTF-8"))
+        return
+    }
+    absFolder := sanitizePath(r.Context(), req.Folder)
+    if absFolder == "" {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+        return
+    }
+    scope := ""
+    if absFolder != scratchRoot(r.Context()) {
+        scope = relativeTo(r.Context(), absFolder) + "/"
+    }
+    dryRun := req.DryRun == nil || *req.DryRun
+    if !dryRun && !requireField(w, r, "plan", req.Plan) {
+        return
+    }
+
+    re, err := replacePattern(r.Context(), req)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    if !dryRun {
+        replaceMu.Lock()
+        defer replaceMu.Unlock()
+    }
+    plan, err := buildReplacePlan(r.Context(), req, re, scope)
+    if err != nil {
+        if _, ok := err.(*fieldError); ok {
+            writeFieldError(w, r, err)
+            return
+        }
+        writeStorageError(w, r, err, "plan replacement in "+absFolder, "Replace failed")
+        return
+    }
+
+    if dryRun {
+        for i := range plan.files {
+            path := plan.files[i].Path
+            plan.files[i].Diff = unifiedDiff(path, string(plan.before[path]), string(plan.after[path]))
+        }
+        logInfo(r.Context(), fmt.Sprintf("Replace dry run in %s: %d replacements in %d notes", defaultString(scope, "/"), plan.replaced, len(plan.files)))
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "dry_run":      true,
+            "plan":         plan.token,
+            "files":        plan.files,
+            "skipped":      plan.skipped,
+            "replacements": plan.replaced,
+        })
+        return
+    }
+
+    if plan.token != req.Plan {
+        logInfo(r.Context(), "Replace plan is stale for "+absFolder)
+        apierror.WriteDetails(w, r, apierror.CodeConflict, "plan", "Notes changed since the dry run; review the new plan",
+            map[string]interface{}{"plan": plan.token})
+        return
+    }
+    if len(plan.files) == 0 {
+        writeFieldError(w, r, invalidField("find", "matches nothing to replace"))
+        return
+    }
+    for _, file := range plan.files {
+        if rejectIfDangerous(w, r, file.Path, plan.after[file.Path]) {
+            return
+        }
+    }
+
+    now := timeNow(r.Context()).UTC()
+    snapshot := ReplaceSnapshot{
+        ID:      now.Format("20060102T150405.000000000Z"),
+        At:      now.Format(time.RFC3339),
+        Actor:   actorName(r.Context()),
+        Folder:  relativeTo(r.Context(), absFolder),
+        Find:    req.Find,
+        Replace: req.Replace,
+        Mode:    req.Mode,
+        Files:   plan.files,
+    }
+    if err := applyReplacePlan(r.Context(), plan, snapshot); err != nil {
+        logError(r.Context(), "Replace in "+absFolder+" failed and was rolled back: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Replace failed; no notes were changed")
+        return
+    }
+
+    for _, file := range plan.files {
+        indexUpdate(r.Context(), file.Path, plan.after[file.Path])
+        journalPutEntry(r.Context(), file.Path, plan.after[file.Path])
+        flagSignedChange(r, file.Path, plan.after[file.Path])
+    }
+    logInfo(r.Context(), fmt.Sprintf("Replaced %d matches in %d notes under %s (snapshot %s)", plan.replaced, len(plan.files), defaultString(scope, "/"), snapshot.ID))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "files.replace",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    snapshot.Actor,
+        Target:   snapshot.Folder,
+        Detail:   fmt.Sprintf("snapshot=%s files=%d replacements=%d", snapshot.ID, len(plan.files), plan.replaced),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "dry_run":      false,
+        "snapshot":     snapshot.ID,
+        "files":        plan.files,
+        "skipped":      plan.skipped,
+        "replacements": plan.replaced,
+    })
+}
@@ -0,0 +1,74 @@
+// -------------------------------------------------------
+// backend/handlers/replace_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that applying a replacement leaves notes saved since
+//     the plan alone, and refuses content the folder policy blocks.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+)
+
+func TestApplyReplacePlanSkipsStaleNotes(t *testing.T) {
+    const root = "/cfo-scratchpad-replacetest"
+    store := NewMemStorage(root)
+    srv := NewServer(root, nil, store, nil, nil)
+    ctx := srv.Context()
+    store.MkdirAll(root + "/close")
+    store.WriteFile(root+"/close/a.md", []byte("accrual a\n"))
+    store.WriteFile(root+"/close/b.md", []byte("accrual b\n"))
+
+    req := ReplaceRequest{Find: "accrual", Replace: "deferral", Mode: replaceLiteral}
+    re, err := replacePattern(ctx, req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    plan, err := buildReplacePlan(ctx, req, re, "")
+    if err != nil || len(plan.files) != 2 {
+        t.Fatalf("plan = %+v, %v", plan, err)
+    }
+    store.WriteFile(root+"/close/b.md", []byte("accrual b, edited\n"))
+
+    snapshot := ReplaceSnapshot{ID: "20260302T093000.000000000Z"}
+    if err := applyReplacePlan(ctx, plan, snapshot); err != nil {
+        t.Fatal(err)
+    }
+    if data, _ := store.ReadFile(root + "/close/a.md"); string(data) != "deferral a\n" {
+        t.Errorf("a.md = %q, want it replaced", data)
+    }
+    if data, _ := store.ReadFile(root + "/close/b.md"); string(data) != "accrual b, edited\n" {
+        t.Errorf("b.md = %q, want the later save kept", data)
+    }
+    if len(plan.files) != 1 || len(plan.skipped) != 1 || plan.skipped[0] != (ReplaceSkip{Path: "close/b.md", Reason: "stale"}) || plan.replaced != 1 {
+        t.Errorf("plan after apply: files=%+v skipped=%+v replaced=%d", plan.files, plan.skipped, plan.replaced)
+    }
+}
+
+func TestReplaceRefusesDangerousContent(t *testing.T) {
+    const root = "/cfo-scratchpad-replacetest"
+    store := NewMemStorage(root)
+    srv := NewServer(root, nil, store, nil, nil)
+    store.MkdirAll(root + "/close")
+    store.WriteFile(root+"/close/a.md", []byte("PLACEHOLDER\n"))
+
+    body := `{"folder":"close","find":"PLACEHOLDER","replace":"<script>alert(1)</script>","mode":"literal"`
+    rec := memServe(srv, HandleFilesReplace, "POST", "/files/replace", body+`}`)
+    var dry struct {
+        Plan string `json:"plan"`
+    }
+    if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &dry) != nil {
+        t.Fatalf("dry run: %d %s", rec.Code, rec.Body)
+    }
+    rec = memServe(srv, HandleFilesReplace, "POST", "/files/replace", body+`,"dry_run":false,"plan":"`+dry.Plan+`"}`)
+    if rec.Code != http.StatusUnprocessableEntity {
+        t.Fatalf("apply: %d %s, want 422", rec.Code, rec.Body)
+    }
+    if data, _ := store.ReadFile(root + "/close/a.md"); string(data) != "PLACEHOLDER\n" {
+        t.Errorf("a.md = %q, want it unchanged", data)
+    }
+}
@@ -0,0 +1,266 @@
+// -------------------------------------------------------
+// backend/handlers/reports_duplicates.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /reports/duplicates: group notes across the whole
+//     scratchpad into clusters of identical or near-identical content.
+// Audit:
+//   - Identical notes share a SHA-256 content hash.
+//   - Near-identical notes are linked when the Jaccard similarity of
+//     their word 3-gram shingles meets the threshold.
+//   - Read-only; logs scan size and cluster counts with UTC timestamps.
+// Configuration:
+//   - duplicate_similarity / DUPLICATE_SIMILARITY default threshold
+//     (0 < t <= 1, default 0.9).
+//   - ?threshold= overrides per request; 1 reports identical only.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    shingleSize = 3
+    // maxSimilarityCandidates bounds the O(n^2) near-duplicate pass.
+    maxSimilarityCandidates = 2000
+)
+
+// -------------------------------------------------------
+// type DuplicateFile / DuplicateCluster
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes returned by /reports/duplicates.
+// -------------------------------------------------------
+type DuplicateFile struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+}
+
+type DuplicateCluster struct {
+    Kind       string          `json:"kind"`
+    Similarity float64         `json:"similarity"`
+    Files      []DuplicateFile `json:"files"`
+}
+
+// -------------------------------------------------------
+// func HandleDuplicatesReport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Scan all notes and return duplicate clusters as JSON.
+// Audit:
+//   - clusters is always an array ([] when none found).
+//   - Exact clusters are reported first, then similar ones.
+// -------------------------------------------------------
+func HandleDuplicatesReport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    threshold, err := duplicateThreshold(r.Context(), r.URL.Query().Get("threshold"))
+    if err != nil {
+        logError(r.Context(), "Invalid duplicate threshold: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInvalidField, "threshold", "Invalid threshold: "+err.Error())
+        return
+    }
+
+    ctx := r.Context()
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        writeStorageError(w, r, err, "scan notes", "Internal server error")
+        return
+    }
+
+    // Hash every note and group by content hash.
+    byHash := map[string][]DuplicateFile{}
+    contents := map[string]string{}
+    hashes := []string{}
+    for _, note := range notes {
+        data, readErr := readFile(ctx, note.Abs)
+        if readErr != nil {
+            writeStorageError(w, r, readErr, "read file: "+note.Abs, "Internal server error")
+            return
+        }
+        sum := sha256.Sum256(data)
+        h := hex.EncodeToString(sum[:])
+        if _, seen := byHash[h]; !seen {
+            hashes = append(hashes, h)
+            contents[h] = string(data)
+        }
+        byHash[h] = append(byHash[h], DuplicateFile{Path: note.Rel, Size: note.Size, SHA256: h})
+    }
+
+    clusters := []DuplicateCluster{}
+    for _, h := range hashes {
+        if len(byHash[h]) > 1 {
+            clusters = append(clusters, DuplicateCluster{Kind: "identical", Similarity: 1, Files: byHash[h]})
+        }
+    }
+    if threshold < 1 {
+        clusters = append(clusters, similarClusters(ctx, hashes, contents, byHash, threshold)...)
+    }
+
+    logInfo(ctx, fmt.Sprintf("Duplicate report: scanned %d files, %d clusters (threshold %.2f)",
+        len(notes), len(clusters), threshold))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "threshold":     threshold,
+        "files_scanned": len(notes),
+        "clusters":      clusters,
+    })
+}
+
+// -------------------------------------------------------
+// func duplicateThreshold(ctx context.Context, param string) (float64, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Resolve the similarity threshold from query or configuration.
+// -------------------------------------------------------
+func duplicateThreshold(ctx context.Context, param string) (float64, error) {
+    if param == "" {
+        return currentConfig(ctx).DuplicateSimilarity, nil
+    }
+    t, err := strconv.ParseFloat(param, 64)
+    if err != nil || t <= 0 || t > 1 {
+        return 0, fmt.Errorf("must be a number in (0, 1], got %q", param)
+    }
+    return t, nil
+}
+
+// -------------------------------------------------------
+// func shingles(text string) map[string]bool
+// -------------------------------------------------------
+// Purpose:
+//   - Lower-cased word 3-grams; short texts fall back to words.
+// -------------------------------------------------------
+func shingles(text string) map[string]bool {
+    words := strings.Fields(strings.ToLower(text))
+    set := map[string]bool{}
+    if len(words) < shingleSize {
+        for _, w := range words {
+            set[w] = true
+        }
+        return set
+    }
+    for i := 0; i+shingleSize <= len(words); i++ {
+        set[strings.Join(words[i:i+shingleSize], " ")] = true
+    }
+    return set
+}
+
+// -------------------------------------------------------
+// func jaccard(a, b map[string]bool) float64
+// -------------------------------------------------------
+// Purpose:
+//   - |a ∩ b| / |a ∪ b|; two empty sets are not considered similar.
+// -------------------------------------------------------
+func jaccard(a, b map[string]bool) float64 {
+    if len(a) == 0 || len(b) == 0 {
+        return 0
+    }
+    if len(a) > len(b) {
+        a, b = b, a
+    }
+    inter := 0
+    for k := range a {
+        if b[k] {
+            inter++
+        }
+    }
+    return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// -------------------------------------------------------
+// func similarClusters(ctx, hashes, contents, byHash, threshold)
+// -------------------------------------------------------
+// Purpose:
+//   - Link distinct contents whose similarity meets the threshold
+//     (union-find) and return clusters spanning 2+ distinct contents.
+// Audit:
+//   - Similarity reported is the weakest link joining the cluster.
+//   - Only the first maxSimilarityCandidates contents are compared.
+// -------------------------------------------------------
+func similarClusters(ctx context.Context, hashes []string, contents map[string]string, byHash map[string][]DuplicateFile, threshold float64) []DuplicateCluster {
+    if len(hashes) > maxSimilarityCandidates {
+        logError(ctx, fmt.Sprintf("Near-duplicate scan limited to first %d of %d distinct notes",
+            maxSimilarityCandidates, len(hashes)))
+        hashes = hashes[:maxSimilarityCandidates]
+    }
+
+    sets := make([]map[string]bool, len(hashes))
+    for i, h := range hashes {
+        sets[i] = shingles(contents[h])
+    }
+
+    parent := make([]int, len(hashes))
+    for i := range parent {
+        parent[i] = i
+    }
+    var find func(int) int
+    find = func(i int) int {
+        for parent[i] != i {
+            parent[i] = parent[parent[i]]
+            i = parent[i]
+        }
+        return i
+    }
+
+    weakest := map[int]float64{}
+    for i := 0; i < len(hashes); i++ {
+        for j := i + 1; j < len(hashes); j++ {
+            sim := jaccard(sets[i], sets[j])
+            if sim < threshold {
+                continue
+            }
+            ri, rj := find(i), find(j)
+            low := sim
+            if v, ok := weakest[ri]; ok && v < low {
+                low = v
+            }
+            if v, ok := weakest[rj]; ok && v < low {
+                low = v
+            }
+            if ri != rj {
+                parent[rj] = ri
+                delete(weakest, rj)
+            }
+            weakest[ri] = low
+        }
+    }
+
+    groups := map[int][]int{}
+    for i := range hashes {
+        root := find(i)
+        groups[root] = append(groups[root], i)
+    }
+
+    clusters := []DuplicateCluster{}
+    for root, members := range groups {
+        if len(members) < 2 {
+            continue
+        }
+        files := []DuplicateFile{}
+        for _, m := range members {
+            files = append(files, byHash[hashes[m]]...)
+        }
+        sort.Slice(files, func(a, b int) bool { return files[a].Path < files[b].Path })
+        clusters = append(clusters, DuplicateCluster{Kind: "similar", Similarity: weakest[root], Files: files})
+    }
+    sort.Slice(clusters, func(a, b int) bool { return clusters[a].Files[0].Path < clusters[b].Files[0].Path })
+    return clusters
+}
@@ -0,0 +1,452 @@
+// -------------------------------------------------------
+// backend/handlers/reports_links.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /reports/broken-links: scan every note for wiki-links
+//     ([[Note]]) and relative Markdown links or images
+//     ([text](file.pdf)) whose target does not exist, and return a
+//     fix-up list with candidate targets.
+//   - Optionally runs on a schedule (link_check_interval); the last
+//     scheduled report is kept and served with ?latest=1.
+// Audit:
+//   - URLs (anything with a scheme), in-page anchors, and links in
+//     fenced code blocks are not checked.
+//   - Links may not leave the scratch root; ones that try are
+//     reported as broken.
+//   - Scheduled runs log their totals and write a
+//     "report.broken_links" audit event when links are broken.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "path"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    linkReportFile      = "broken-links.json"
+    maxBrokenLinks      = 5000
+    maxLinkSuggestions  = 5
+    linkCheckIdlePeriod = time.Minute
+)
+
+// Link kinds.
+const (
+    linkWiki       = "wiki"
+    linkAttachment = "attachment"
+)
+
+var (
+    // wikiLinkPattern captures the target, heading, and alias of [[...]].
+    wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]\n|#]*)(#[^\[\]\n|]*)?(\|[^\[\]\n]*)?\]\]`)
+
+    // markdownLinkPattern captures the target of [text](target) and
+    // ![alt](target), with an optional <...> and "title".
+    markdownLinkPattern = regexp.MustCompile(`!?\[[^\]\n]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"\n]*")?\s*\)`)
+
+    // urlSchemePattern recognises external targets (https:, mailto:).
+    urlSchemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+)
+
+// -------------------------------------------------------
+// type BrokenLink / LinkReport
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes returned by /reports/broken-links.
+// Audit:
+//   - Line and Column are 1-based; Column and Offset count bytes.
+//   - Text is the link as written; Target the path it names.
+//   - Suggestions are existing files with the target's name.
+//   - Fix is the replacement text when exactly one candidate exists.
+// -------------------------------------------------------
+type BrokenLink struct {
+    Source      string   `json:"source"`
+    Line        int      `json:"line"`
+    Column      int      `json:"column"`
+    Offset      int      `json:"offset"`
+    Length      int      `json:"length"`
+    Kind        string   `json:"kind"`
+    Text        string   `json:"text"`
+    Target      string   `json:"target"`
+    Suggestions []string `json:"suggestions"`
+    Fix         string   `json:"fix,omitempty"`
+}
+
+type LinkReport struct {
+    GeneratedAt string       `json:"generated_at"`
+    Notes       int          `json:"notes"`
+    Links       int          `json:"links"`
+    Broken      []BrokenLink `json:"broken"`
+    Truncated   bool         `json:"truncated"`
+}
+
+// noteLink is one link found in a note, before resolution; raw is
+// the target as written in text (before trimming and decoding).
+type noteLink struct {
+    kind   string
+    offset int
+    length int
+    text   string
+    raw    string
+    target string
+}
+
+// -------------------------------------------------------
+// func fencedRanges(content []byte) [][2]int
+// -------------------------------------------------------
+// Purpose:
+//   - Byte ranges of fenced code blocks (``` or ~~~), in order.
+// Audit:
+//   - An unclosed fence runs to the end of the note.
+// -------------------------------------------------------
+func fencedRanges(content []byte) [][2]int {
+    ranges := [][2]int{}
+    fence, start := "", 0
+    for _, line := range splitTocLines(content) {
+        trimmed := strings.TrimSpace(line.text)
+        if fence == "" {
+            if marker := fenceMarker(line.text); marker != "" {
+                fence, start = marker, line.offset
+            }
+            continue
+        }
+        if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+            ranges = append(ranges, [2]int{start, line.offset + len(line.text)})
+            fence = ""
+        }
+    }
+    if fence != "" {
+        ranges = append(ranges, [2]int{start, len(content)})
+    }
+    return ranges
+}
+
+// -------------------------------------------------------
+// func extractLinks(content []byte) []noteLink
+// -------------------------------------------------------
+// Purpose:
+//   - Wiki-links and local Markdown links in content, by offset.
+// Audit:
+//   - Markdown targets drop their #fragment and ?query and are
+//     URL-decoded ("Q3%20deck.pdf").
+// -------------------------------------------------------
+func extractLinks(content []byte) []noteLink {
+    fenced := fencedRanges(content)
+    inFence := func(offset int) bool {
+        for _, r := range fenced {
+            if offset >= r[0] && offset < r[1] {
+                return true
+            }
+        }
+        return false
+    }
+
+    links := []noteLink{}
+    for _, loc := range wikiLinkPattern.FindAllSubmatchIndex(content, -1) {
+        raw := string(content[loc[2]:loc[3]])
+        target := strings.TrimSpace(raw)
+        if target == "" || inFence(loc[0]) {
+            continue
+        }
+        links = append(links, noteLink{kind: linkWiki, offset: loc[0], length: loc[1] - loc[0], text: string(content[loc[0]:loc[1]]), raw: raw, target: target})
+    }
+    for _, loc := range markdownLinkPattern.FindAllSubmatchIndex(content, -1) {
+        raw := string(content[loc[2]:loc[3]])
+        if strings.HasPrefix(raw, "#") || urlSchemePattern.MatchString(raw) || inFence(loc[0]) {
+            continue
+        }
+        if i := strings.IndexAny(raw, "#?"); i >= 0 {
+            raw = raw[:i]
+        }
+        target, err := url.PathUnescape(raw)
+        if err != nil {
+            target = raw
+        }
+        if target == "" {
+            continue
+        }
+        links = append(links, noteLink{kind: linkAttachment, offset: loc[0], length: loc[1] - loc[0], text: string(content[loc[0]:loc[1]]), raw: raw, target: target})
+    }
+    sort.Slice(links, func(i, j int) bool { return links[i].offset < links[j].offset })
+    return links
+}
+
+// -------------------------------------------------------
+// type linkIndex
+// -------------------------------------------------------
+// Purpose:
+//   - Every file under the root, by path and by lowercased name,
+//     for resolving links and suggesting fixes.
+// Audit:
+//   - byName keys notes without their extension, so [[Budget]]
+//     finds "Budget.md"; attachments keep theirs.
+// -------------------------------------------------------
+type linkIndex struct {
+    paths  map[string]bool
+    byName map[string][]string
+}
+
+func newLinkIndex(files []noteFile) linkIndex {
+    index := linkIndex{paths: map[string]bool{}, byName: map[string][]string{}}
+    for _, file := range files {
+        index.paths[file.Rel] = true
+        name := strings.ToLower(path.Base(file.Rel))
+        index.byName[name] = append(index.byName[name], file.Rel)
+        if isNoteName(name) {
+            stem := strings.TrimSuffix(name, path.Ext(name))
+            index.byName[stem] = append(index.byName[stem], file.Rel)
+        }
+    }
+    for name := range index.byName {
+        sort.Strings(index.byName[name])
+    }
+    return index
+}
+
+// within joins target onto dir and reports whether it stays in the root.
+func within(dir, target string) (string, bool) {
+    joined := path.Clean(path.Join(dir, target))
+    if strings.HasPrefix(target, "/") {
+        joined = path.Clean(strings.TrimPrefix(target, "/"))
+    }
+    return joined, joined != ".." && !strings.HasPrefix(joined, "../")
+}
+
+// -------------------------------------------------------
+// func (index linkIndex) resolves(source string, link noteLink) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Whether link, found in source, points at an existing file.
+// Audit:
+//   - Wiki targets try the source folder, then the root, with .md
+//     and .txt appended; a bare name also matches a note of that
+//     name in any folder.
+//   - Markdown targets resolve against the source folder only
+//     ("/x" against the root).
+// -------------------------------------------------------
+func (index linkIndex) resolves(source string, link noteLink) bool {
+    dir := path.Dir(source)
+    if link.kind == linkAttachment {
+        target, ok := within(dir, link.target)
+        return ok && index.paths[target]
+    }
+
+    candidates := []string{link.target}
+    if !isNoteName(link.target) {
+        candidates = []string{link.target + markdownExt, link.target + fileExt, link.target}
+    }
+    for _, base := range []string{dir, "."} {
+        for _, candidate := range candidates {
+            if target, ok := within(base, candidate); ok && index.paths[target] {
+                return true
+            }
+        }
+    }
+    if !strings.Contains(link.target, "/") {
+        for _, match := range index.byName[strings.ToLower(link.target)] {
+            if isNoteName(match) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func (index linkIndex) suggest(source string, link noteLink) ([]string, string)
+// -------------------------------------------------------
+// Purpose:
+//   - Existing files named like the broken target, and the
+//     replacement text when there is exactly one.
+// -------------------------------------------------------
+func (index linkIndex) suggest(source string, link noteLink) ([]string, string) {
+    name := strings.ToLower(path.Base(link.target))
+    suggestions := []string{}
+    for _, match := range index.byName[name] {
+        if link.kind == linkWiki && !isNoteName(match) {
+            continue
+        }
+        if len(suggestions) == maxLinkSuggestions {
+            break
+        }
+        suggestions = append(suggestions, match)
+    }
+    if len(suggestions) != 1 {
+        return suggestions, ""
+    }
+
+    match := suggestions[0]
+    if link.kind == linkWiki {
+        replacement := strings.TrimSuffix(match, path.Ext(match))
+        return suggestions, "[[" + replacement + link.text[2+len(link.raw):]
+    }
+    rel, err := filepath.Rel(filepath.FromSlash(path.Dir(source)), filepath.FromSlash(match))
+    if err != nil {
+        return suggestions, ""
+    }
+    i := strings.Index(link.text, "](") + 2
+    replacement := (&url.URL{Path: filepath.ToSlash(rel)}).String()
+    return suggestions, link.text[:i] + strings.Replace(link.text[i:], link.raw, replacement, 1)
+}
+
+// -------------------------------------------------------
+// func checkLinks(ctx context.Context) (LinkReport, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Build the broken link report over all notes.
+// Audit:
+//   - Notes over maxSearchFileBytes are skipped.
+//   - Broken links are sorted by source and offset; at most
+//     maxBrokenLinks are listed (truncated).
+// -------------------------------------------------------
+func checkLinks(ctx context.Context) (LinkReport, error) {
+    report := LinkReport{GeneratedAt: timeNow(ctx).UTC().Format(time.RFC3339), Broken: []BrokenLink{}}
+    files, err := scanFiles(ctx, func(string) bool { return true })
+    if err != nil {
+        return report, err
+    }
+    index := newLinkIndex(files)
+    sort.Slice(files, func(i, j int) bool { return files[i].Rel < files[j].Rel })
+
+    for _, file := range files {
+        if !isNoteName(file.Rel) || file.Size > maxSearchFileBytes {
+            continue
+        }
+        content, err := readFile(ctx, file.Abs)
+        if err != nil {
+            return report, err
+        }
+        report.Notes++
+
+        line, lineStart, scanned := 1, 0, 0
+        for _, link := range extractLinks(content) {
+            report.Links++
+            if index.resolves(file.Rel, link) {
+                continue
+            }
+            if len(report.Broken) == maxBrokenLinks {
+                report.Truncated = true
+                continue
+            }
+            for ; scanned < link.offset; scanned++ {
+                if content[scanned] == '\n' {
+                    line++
+                    lineStart = scanned + 1
+                }
+            }
+            suggestions, fix := index.suggest(file.Rel, link)
+            report.Broken = append(report.Broken, BrokenLink{
+                Source:      file.Rel,
+                Line:        line,
+                Column:      link.offset - lineStart + 1,
+                Offset:      link.offset,
+                Length:      link.length,
+                Kind:        link.kind,
+                Text:        link.text,
+                Target:      link.target,
+                Suggestions: suggestions,
+                Fix:         fix,
+            })
+        }
+    }
+    return report, nil
+}
+
+// -------------------------------------------------------
+// func HandleBrokenLinksReport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /reports/broken-links: check now, or with ?latest=1
+//     return the last scheduled report.
+// Audit:
+//   - ?latest=1 answers not_found until a scheduled run completes.
+// -------------------------------------------------------
+func HandleBrokenLinksReport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var report LinkReport
+    if r.URL.Query().Get("latest") == "1" {
+        if err := loadMetaJSON(r.Context(), linkReportFile, &report); err != nil {
+            writeStorageError(w, r, err, "load broken link report", "Internal server error")
+            return
+        }
+        if report.GeneratedAt == "" {
+            apierror.Write(w, r, apierror.CodeNotFound, "", "No scheduled link check has run yet")
+            return
+        }
+    } else {
+        checked, err := checkLinks(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "check links", "Internal server error")
+            return
+        }
+        report = checked
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Broken link report: %d of %d links broken in %d notes", len(report.Broken), report.Links, report.Notes))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
+
+// -------------------------------------------------------
+// func RunLinkCheck()
+// -------------------------------------------------------
+// Purpose:
+//   - Check links every link_check_interval and keep the result for
+//     ?latest=1.
+// Audit:
+//   - Configuration is re-read each cycle; 0 disables the check,
+//     which is then re-examined every linkCheckIdlePeriod.
+//   - Cycles are skipped while schedules are paused (maintenance
+//     mode).
+// -------------------------------------------------------
+func RunLinkCheck(ctx context.Context) {
+    for {
+        interval := currentConfig(ctx).LinkCheckInterval.Std()
+        if interval <= 0 {
+            time.Sleep(linkCheckIdlePeriod)
+            continue
+        }
+        time.Sleep(interval)
+        if SchedulesPaused() {
+            continue
+        }
+
+        ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+        report, err := checkLinks(ctx)
+        cancel()
+        if err != nil {
+            logError(ctx, "Scheduled link check failed: "+err.Error())
+            continue
+        }
+        if err := saveMetaJSON(ctx, linkReportFile, report); err != nil {
+            logError(ctx, "Failed to save broken link report: "+err.Error())
+        }
+        logInfo(ctx, fmt.Sprintf("Scheduled link check: %d of %d links broken in %d notes", len(report.Broken), report.Links, report.Notes))
+        if len(report.Broken) > 0 {
+            audit.Write(audit.Event{
+                Event:  "report.broken_links",
+                Method: "SCHEDULE",
+                Path:   "/reports/broken-links",
+                Detail: fmt.Sprintf("broken=%d links=%d notes=%d", len(report.Broken), report.Links, report.Notes),
+            })
+        }
+    }
+}
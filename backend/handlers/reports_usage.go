@@ -0,0 +1,153 @@
+// -------------------------------------------------------
+// backend/handlers/reports_usage.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /reports/usage: per-folder file counts and bytes, the
+//     largest files, and growth over time from the metadata index.
+// Audit:
+//   - Current totals come from a live scan of the filesystem.
+//   - Growth comes from daily snapshots kept with the index.
+//   - Read-only; logs totals with UTC timestamps.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    defaultLargestFiles = 10
+    maxLargestFiles     = 100
+)
+
+// -------------------------------------------------------
+// type FolderUsage / LargeFile / UsageGrowth
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes returned by /reports/usage.
+// -------------------------------------------------------
+type FolderUsage struct {
+    Folder string `json:"folder"`
+    Files  int    `json:"files"`
+    Bytes  int64  `json:"bytes"`
+}
+
+type LargeFile struct {
+    Path     string `json:"path"`
+    Size     int64  `json:"size"`
+    Modified string `json:"modified"`
+}
+
+type UsageGrowth struct {
+    Date  string `json:"date"`
+    Files int    `json:"files"`
+    Bytes int64  `json:"bytes"`
+    Delta int64  `json:"delta_bytes"`
+}
+
+// -------------------------------------------------------
+// func HandleUsageReport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Build and return the storage usage report.
+// Audit:
+//   - ?top=N limits largest files (default 10, max 100).
+//   - ?folder=name adds that folder's daily byte history.
+//   - All lists are arrays ([] when empty).
+// -------------------------------------------------------
+func HandleUsageReport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    top := defaultLargestFiles
+    if v := r.URL.Query().Get("top"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > maxLargestFiles {
+            logError(r.Context(), "Invalid usage report top value: "+v)
+            apierror.Write(w, r, apierror.CodeInvalidField, "top", fmt.Sprintf("Invalid top: must be 1-%d", maxLargestFiles))
+            return
+        }
+        top = n
+    }
+
+    notes, err := scanNotes(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "scan notes", "Internal server error")
+        return
+    }
+
+    var totalBytes int64
+    byFolder := map[string]*FolderUsage{}
+    largest := []LargeFile{}
+    for _, note := range notes {
+        totalBytes += note.Size
+        folder := folderOf(note.Rel)
+        if byFolder[folder] == nil {
+            byFolder[folder] = &FolderUsage{Folder: folder}
+        }
+        byFolder[folder].Files++
+        byFolder[folder].Bytes += note.Size
+        largest = append(largest, LargeFile{
+            Path:     note.Rel,
+            Size:     note.Size,
+            Modified: note.ModTime.Format("2006-01-02T15:04:05Z"),
+        })
+    }
+
+    folders := []FolderUsage{}
+    for _, fu := range byFolder {
+        folders = append(folders, *fu)
+    }
+    sort.Slice(folders, func(a, b int) bool { return folders[a].Bytes > folders[b].Bytes })
+    sort.Slice(largest, func(a, b int) bool { return largest[a].Size > largest[b].Size })
+    if len(largest) > top {
+        largest = largest[:top]
+    }
+
+    history := usageHistory(r.Context())
+    growth := []UsageGrowth{}
+    var prev int64
+    for i, snap := range history {
+        delta := int64(0)
+        if i > 0 {
+            delta = snap.Bytes - prev
+        }
+        growth = append(growth, UsageGrowth{Date: snap.Date, Files: snap.Files, Bytes: snap.Bytes, Delta: delta})
+        prev = snap.Bytes
+    }
+
+    report := map[string]interface{}{
+        "generated_at":  utcNow(r.Context()),
+        "total_files":   len(notes),
+        "total_bytes":   totalBytes,
+        "folders":       folders,
+        "largest_files": largest,
+        "growth":        growth,
+    }
+
+    if folder := r.URL.Query().Get("folder"); folder != "" {
+        folderGrowth := []map[string]interface{}{}
+        for _, snap := range history {
+            folderGrowth = append(folderGrowth, map[string]interface{}{
+                "date":  snap.Date,
+                "bytes": snap.Folders[folder],
+            })
+        }
+        report["folder"] = folder
+        report["folder_growth"] = folderGrowth
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Usage report: %d files, %d bytes, %d folders", len(notes), totalBytes, len(folders)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
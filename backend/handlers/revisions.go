@@ -0,0 +1,178 @@
+// -------------------------------------------------------
+// backend/handlers/revisions.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Revision content store: every saved version of a note is kept
+//     once, by content hash, in .scratchpad/revisions/<ab>/<sha256>.gz,
+//     next to the change journal that records when it was saved.
+//   - Time-travel reads: GET /file?path=...&asOf=<RFC 3339> answers
+//     the note's content as it was at that instant (see HandleFileGet).
+// Audit:
+//   - Revisions are written with every journaled save (local and
+//     synced) and never rewritten; identical content is stored once.
+//   - Purging trash does not remove revisions: the content of a
+//     deleted note stays readable through asOf, as evidence, until
+//     compaction (compact.revision_days, see compact.go) collects it.
+//   - Saves made before revisions were stored have a journal entry
+//     but no content; asOf then answers only when the note still has
+//     that content.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "compress/gzip"
+    "context"
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+const revisionsDir = "revisions"
+
+// revisionsMu orders revision writes against compaction.
+var revisionsMu sync.Mutex
+
+// errRevisionCorrupt is returned when stored content no longer
+// matches its hash.
+var errRevisionCorrupt = errors.New("stored revision does not match its hash")
+
+// -------------------------------------------------------
+// type NoteRevision
+// -------------------------------------------------------
+// Purpose:
+//   - The journal entry that put a note's content in place, as found
+//     by an asOf lookup.
+// Audit:
+//   - Path is where the note was at the time; it differs from the
+//     requested path when the note was moved since.
+// -------------------------------------------------------
+type NoteRevision struct {
+    Clock  int64  `json:"clock"`
+    At     string `json:"at"`
+    Actor  string `json:"actor,omitempty"`
+    Path   string `json:"path"`
+    SHA256 string `json:"sha256"`
+}
+
+// revisionName is the metadata name of the stored content with sha.
+func revisionName(sha string) string {
+    return filepath.Join(revisionsDir, sha[:2], sha+".gz")
+}
+
+// -------------------------------------------------------
+// func storeRevision(ctx, data []byte)
+// -------------------------------------------------------
+// Purpose:
+//   - Keep data as a revision unless content with its hash is
+//     already stored.
+// Audit:
+//   - Failures are logged and never fail the save being recorded.
+//   - Storing content that is already kept refreshes its
+//     modification time, so compaction counts its age from now.
+// -------------------------------------------------------
+func storeRevision(ctx context.Context, data []byte) {
+    sha := contentHash(data)
+    name := revisionName(sha)
+    revisionsMu.Lock()
+    defer revisionsMu.Unlock()
+    store := serverFrom(ctx).Storage
+    if _, err := store.Lstat(metaPath(ctx, name)); err == nil {
+        store.Chtimes(metaPath(ctx, name), timeNow(ctx))
+        return
+    }
+    var buf bytes.Buffer
+    gz := gzip.NewWriter(&buf)
+    gz.Write(data)
+    if err := gz.Close(); err != nil {
+        logError(ctx, "Failed to compress revision "+sha+": "+err.Error())
+        return
+    }
+    if err := writeMetaFile(ctx, name, buf.Bytes()); err != nil {
+        logError(ctx, "Failed to store revision "+sha+": "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func loadRevision(ctx context.Context, sha string) ([]byte, bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Read stored revision content; ok is false when none is kept.
+// Audit:
+//   - The content is checked against its hash before it is returned.
+// -------------------------------------------------------
+func loadRevision(ctx context.Context, sha string) ([]byte, bool, error) {
+    if len(sha) != 64 {
+        return nil, false, nil
+    }
+    f, err := serverFrom(ctx).Storage.Open(metaPath(ctx, revisionName(sha)))
+    if os.IsNotExist(err) {
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    defer f.Close()
+    gz, err := gzip.NewReader(f)
+    if err != nil {
+        return nil, false, err
+    }
+    defer gz.Close()
+    data, err := ioutil.ReadAll(gz)
+    if err != nil {
+        return nil, false, err
+    }
+    if contentHash(data) != sha {
+        return nil, false, errRevisionCorrupt
+    }
+    return data, true, nil
+}
+
+// -------------------------------------------------------
+// func noteAsOf(ctx context.Context, rel string, at time.Time) (NoteRevision, bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The revision of the note now at rel that was in place at at;
+//     ok is false when the note did not exist then.
+// Audit:
+//   - Walks the journal backwards. Moves after at are followed back
+//     to the note's earlier path; deletes after at are passed over,
+//     so a deleted and re-created path still answers for the old
+//     note. At or before at, the last entry for the path decides: a
+//     save or a move onto it is the answer, a delete or a move away
+//     means there was no note.
+// -------------------------------------------------------
+func noteAsOf(ctx context.Context, rel string, at time.Time) (NoteRevision, bool, error) {
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        return NoteRevision{}, false, err
+    }
+    cutoff := at.UTC().Format("2006-01-02T15:04:05Z")
+    name := rel
+    for i := len(entries) - 1; i >= 0; i-- {
+        entry := entries[i]
+        if !journalNoteContent(entry) {
+            continue
+        }
+        if entry.At > cutoff {
+            if entry.Op == journalMove && entry.Path == name {
+                name = entry.From
+            }
+            continue
+        }
+        switch {
+        case entry.Op == journalMove && entry.From == name:
+            return NoteRevision{}, false, nil
+        case entry.Path != name:
+            continue
+        case entry.Op == journalDelete:
+            return NoteRevision{}, false, nil
+        }
+        return NoteRevision{Clock: entry.Clock, At: entry.At, Actor: entry.Actor, Path: entry.Path, SHA256: entry.SHA256}, true, nil
+    }
+    return NoteRevision{}, false, nil
+}
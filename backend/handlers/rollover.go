@@ -0,0 +1,419 @@
+// -------------------------------------------------------
+// backend/handlers/rollover.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Month-end rollover of a period folder (e.g. Acme/2025-11):
+//       1. create the next period's folder (Acme/2025-12) from the
+//          rollover template (folders/bootstrap),
+//       2. copy "rolling" notes (rollover.rolling name patterns,
+//          e.g. open-items.rolling.md) into the same place in it,
+//       3. archive the old period folder (folders/archive).
+//   - POST /rollover runs on demand (dry run by default); with
+//     rollover.day set, RunRollover does it for rollover.folders on
+//     that day of each month. GET /rollover shows the last
+//     scheduled run.
+// Audit:
+//   - Steps run in the order above, so a failure before the archive
+//     leaves the old period untouched; folders and copies already
+//     made are kept and a re-run skips them.
+//   - A carried note whose target already exists is skipped, never
+//     overwritten.
+//   - Applied rollovers write "folder.rollover"; scheduled runs are
+//     recorded in .scratchpad/rollover.json.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    periodLayout          = "2006-01"
+    rolloverStateFile     = "rollover.json"
+    rolloverCheckInterval = time.Hour
+)
+
+// rolloverMu serializes rollovers, scheduled or not.
+var rolloverMu sync.Mutex
+
+// RolloverNote is one rolling note carried into the new period.
+type RolloverNote struct {
+    From string `json:"from"`
+    To   string `json:"to"`
+}
+
+// RolloverSkip is a rolling note that was not carried, and why.
+type RolloverSkip struct {
+    Path   string `json:"path"`
+    Reason string `json:"reason"`
+}
+
+// -------------------------------------------------------
+// type RolloverPlan
+// -------------------------------------------------------
+// Purpose:
+//   - What a rollover does (dry run) or did (applied).
+// Audit:
+//   - Archived is only set once the old period has been archived.
+// -------------------------------------------------------
+type RolloverPlan struct {
+    From     string         `json:"from"`
+    To       string         `json:"to"`
+    Template string         `json:"template"`
+    DryRun   bool           `json:"dry_run"`
+    Archive  bool           `json:"archive"`
+    Create   []string       `json:"create"`
+    Existing []string       `json:"existing"`
+    Carry    []RolloverNote `json:"carry"`
+    Skipped  []RolloverSkip `json:"skipped"`
+    Archived *ArchiveRecord `json:"archived,omitempty"`
+
+    targets []string
+}
+
+// nextPeriod returns the YYYY-MM period after the one that ends name.
+func nextPeriod(name string) (string, bool) {
+    period, err := time.Parse(periodLayout, path.Base(name))
+    if err != nil {
+        return "", false
+    }
+    return path.Join(path.Dir(name), period.AddDate(0, 1, 0).Format(periodLayout)), true
+}
+
+// isRolling reports whether inner (a path inside the period folder)
+// matches a rolling pattern, by base name or by full inner path.
+func isRolling(inner string, patterns []string) bool {
+    for _, pattern := range patterns {
+        if ok, _ := path.Match(pattern, path.Base(inner)); ok {
+            return true
+        }
+        if ok, _ := path.Match(pattern, inner); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// -------------------------------------------------------
+// func planRollover(ctx, from, to, template, archive) (RolloverPlan, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Work out the folders to create and notes to carry, without
+//     changing anything.
+// Audit:
+//   - from and to are validated, relative folder paths.
+// -------------------------------------------------------
+func planRollover(ctx context.Context, from, to, template string, archive bool) (RolloverPlan, error) {
+    plan := RolloverPlan{
+        From: from, To: to, Template: template, DryRun: true, Archive: archive,
+        Create: []string{}, Existing: []string{}, Carry: []RolloverNote{}, Skipped: []RolloverSkip{},
+    }
+    cfg := currentConfig(ctx)
+    folders, ok := cfg.FolderTemplates[template]
+    if !ok {
+        return plan, invalidField("template", "no folder template named %q", template)
+    }
+    targets, bad := bootstrapTargets(ctx, to, folders)
+    if bad != "" {
+        return plan, invalidField("template", "folder %q is not a valid name", bad)
+    }
+    plan.targets = targets
+    for _, target := range targets {
+        info, err := statPath(ctx, target)
+        switch {
+        case err == nil && info.IsDir():
+            plan.Existing = append(plan.Existing, relativeTo(ctx, target))
+        case err == nil:
+            return plan, fmt.Errorf("%w: %s", errNotAFolder, relativeTo(ctx, target))
+        case os.IsNotExist(err):
+            plan.Create = append(plan.Create, relativeTo(ctx, target))
+        default:
+            return plan, err
+        }
+    }
+
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return plan, err
+    }
+    for _, note := range notes {
+        inner := strings.TrimPrefix(note.Rel, from+"/")
+        if inner == note.Rel || !isRolling(inner, cfg.Rollover.Rolling) {
+            continue
+        }
+        dest := path.Join(to, inner)
+        if _, err := statPath(ctx, sanitizePath(ctx, dest)); err == nil {
+            plan.Skipped = append(plan.Skipped, RolloverSkip{Path: note.Rel, Reason: "exists"})
+            continue
+        } else if !os.IsNotExist(err) {
+            return plan, err
+        }
+        plan.Carry = append(plan.Carry, RolloverNote{From: note.Rel, To: dest})
+    }
+    return plan, nil
+}
+
+// -------------------------------------------------------
+// func applyRollover(ctx, plan *RolloverPlan) error
+// -------------------------------------------------------
+// Purpose:
+//   - Create the folders, copy the rolling notes, then archive the
+//     old period.
+// Audit:
+//   - Copies are indexed and journalled like saves.
+// -------------------------------------------------------
+func applyRollover(ctx context.Context, plan *RolloverPlan) error {
+    plan.DryRun = false
+    if _, _, err := createFolders(ctx, plan.targets); err != nil {
+        return err
+    }
+    for _, note := range plan.Carry {
+        content, err := readFile(ctx, sanitizePath(ctx, note.From))
+        if err != nil {
+            return err
+        }
+        dest := sanitizePath(ctx, note.To)
+        if err := mkdirAll(ctx, filepath.Dir(dest)); err != nil {
+            return err
+        }
+        if err := writeFile(ctx, dest, content); err != nil {
+            return err
+        }
+        indexUpdate(ctx, note.To, content)
+        journalPutEntry(ctx, note.To, content)
+    }
+    if !plan.Archive {
+        return nil
+    }
+    record, err := archiveFolder(ctx, plan.From, sanitizePath(ctx, plan.From))
+    if err != nil {
+        return err
+    }
+    record.Index = nil
+    plan.Archived = &record
+    return nil
+}
+
+// rolloverDetail summarizes an applied rollover for audit events.
+func rolloverDetail(plan RolloverPlan) string {
+    detail := fmt.Sprintf("to=%s template=%s created=%d carried=%d skipped=%d", plan.To, plan.Template, len(plan.Create), len(plan.Carry), len(plan.Skipped))
+    if plan.Archived != nil {
+        detail += " archive=" + plan.Archived.ID + " sha256=" + plan.Archived.SHA256
+    }
+    return detail
+}
+
+// -------------------------------------------------------
+// func HandleRollover(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /rollover {"from", "to", "template", "archive",
+//     "dry_run"}: plan (default) or apply a rollover.
+//   - GET /rollover: the last scheduled run.
+// Audit:
+//   - to defaults to the next YYYY-MM period beside from; it must
+//     not lie inside from.
+// -------------------------------------------------------
+func HandleRollover(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        state := map[string]interface{}{}
+        if err := loadMetaJSON(r.Context(), rolloverStateFile, &state); err != nil {
+            writeStorageError(w, r, err, "load rollover state", "Internal error")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(state)
+        return
+    case http.MethodPost:
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        From     string `json:"from"`
+        To       string `json:"to"`
+        Template string `json:"template"`
+        Archive  *bool  `json:"archive"`
+        DryRun   *bool  `json:"dry_run"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "from", req.From) {
+        return
+    }
+    absFrom := sanitizePath(r.Context(), req.From)
+    if absFrom == "" || absFrom == scratchRoot(r.Context()) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "from", "Invalid folder path")
+        return
+    }
+    from := relativeTo(r.Context(), absFrom)
+    if req.To == "" {
+        next, ok := nextPeriod(from)
+        if !ok {
+            writeFieldError(w, r, invalidField("to", "is required when from does not end in a YYYY-MM folder"))
+            return
+        }
+        req.To = next
+    }
+    to, policyErr := applyNamePolicy(req.To)
+    absTo := ""
+    if policyErr == nil {
+        absTo = sanitizePath(r.Context(), to)
+    }
+    if absTo == "" || absTo == scratchRoot(r.Context()) || absTo == absFrom || strings.HasPrefix(absTo, absFrom+string(filepath.Separator)) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "to", "Invalid target folder")
+        return
+    }
+    to = relativeTo(r.Context(), absTo)
+    if rejectIfArchived(w, r, absFrom) || rejectIfArchived(w, r, absTo) {
+        return
+    }
+    info, err := statPath(r.Context(), absFrom)
+    if err == nil && !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "from", "Not a folder")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "stat rollover folder: "+absFrom, "Internal error")
+        return
+    }
+
+    template := defaultString(req.Template, currentConfig(r.Context()).Rollover.Template)
+    archive := req.Archive == nil || *req.Archive
+    dryRun := req.DryRun == nil || *req.DryRun
+
+    rolloverMu.Lock()
+    defer rolloverMu.Unlock()
+    plan, err := planRollover(r.Context(), from, to, template, archive)
+    var fieldErr *fieldError
+    switch {
+    case errors.As(err, &fieldErr):
+        writeFieldError(w, r, err)
+        return
+    case errors.Is(err, errNotAFolder):
+        apierror.Write(w, r, apierror.CodeConflict, "to", err.Error())
+        return
+    case err != nil:
+        writeStorageError(w, r, err, "plan rollover of "+from, "Internal error")
+        return
+    }
+
+    if !dryRun {
+        // The rollover must finish once started, even if the client leaves.
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Minute)
+        defer cancel()
+        if err := applyRollover(ctx, &plan); err != nil {
+            writeStorageError(w, r, err, "apply rollover of "+from, "Rollover failed")
+            return
+        }
+        logInfo(ctx, "Rolled over "+from+" -> "+to)
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "folder.rollover",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Actor:    actorName(r.Context()),
+            Target:   from,
+            Detail:   rolloverDetail(plan),
+        })
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(plan)
+}
+
+// -------------------------------------------------------
+// func RunRollover()
+// -------------------------------------------------------
+// Purpose:
+//   - On rollover.day of each month, roll every folder in
+//     rollover.folders from last month's period to this month's.
+// Audit:
+//   - The month done is kept in rollover.json, so a restart never
+//     runs it twice; a folder without last month's period is
+//     skipped.
+//   - Configuration is re-read each check (hourly); checks are
+//     skipped while schedules are paused (maintenance mode).
+// -------------------------------------------------------
+func RunRollover(ctx context.Context) {
+    for {
+        time.Sleep(rolloverCheckInterval)
+        cfg := currentConfig(ctx)
+        now := timeNow(ctx).UTC()
+        if cfg.Rollover.Day == 0 || now.Day() < cfg.Rollover.Day || SchedulesPaused() {
+            continue
+        }
+
+        var state struct {
+            Period  string                   `json:"period"`
+            RanAt   string                   `json:"ran_at"`
+            Results []map[string]interface{} `json:"results"`
+        }
+        if err := loadMetaJSON(ctx, rolloverStateFile, &state); err != nil {
+            logError(ctx, "Failed to load rollover state: "+err.Error())
+            continue
+        }
+        period := now.Format(periodLayout)
+        if state.Period == period {
+            continue
+        }
+        previous := now.AddDate(0, 0, -now.Day()).Format(periodLayout)
+
+        state.Period, state.RanAt, state.Results = period, utcNow(ctx), []map[string]interface{}{}
+        rolloverMu.Lock()
+        for _, folder := range cfg.Rollover.Folders {
+            from, to := path.Join(folder, previous), path.Join(folder, period)
+            result := map[string]interface{}{"from": from, "to": to}
+            state.Results = append(state.Results, result)
+            if info, err := serverFrom(ctx).Storage.Lstat(sanitizePath(ctx, from)); err != nil || !info.IsDir() {
+                result["skipped"] = "missing"
+                continue
+            }
+
+            ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+            plan, err := planRollover(ctx, from, to, cfg.Rollover.Template, true)
+            if err == nil {
+                err = applyRollover(ctx, &plan)
+            }
+            cancel()
+            status := http.StatusOK
+            detail := rolloverDetail(plan)
+            if err != nil {
+                status = http.StatusInternalServerError
+                detail = err.Error()
+                result["error"] = err.Error()
+                logError(ctx, "Scheduled rollover of "+from+" failed: "+err.Error())
+            } else {
+                result["plan"] = plan
+                logInfo(ctx, "Scheduled rollover "+from+" -> "+to)
+            }
+            audit.Write(audit.Event{
+                Event:  "folder.rollover",
+                Method: "SCHEDULE",
+                Path:   "/rollover",
+                Status: status,
+                Target: from,
+                Detail: detail,
+            })
+        }
+        rolloverMu.Unlock()
+        if err := saveMetaJSON(ctx, rolloverStateFile, state); err != nil {
+            logError(ctx, "Failed to save rollover state: "+err.Error())
+        }
+    }
+}
@@ -0,0 +1,670 @@
+// -------------------------------------------------------
+// backend/handlers/rules.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Expiry rules: notes untouched for N days, optionally limited to
+//     a folder and to notes carrying #tags, are flagged or their
+//     folders archived automatically:
+//       GET    /rules                  all rules
+//       POST   /rules {rule}           create or replace a rule by name
+//       DELETE /rules?name=...         remove a rule
+//       GET    /rules/preview          what the next run would do
+//       POST   /rules/run              run the rules now
+//       GET    /rules/flags            notes currently flagged
+//   - Rules run hourly (RunRules); the last run is kept in
+//     .scratchpad/rules_state.json.
+// Audit:
+//   - "flag" marks each matching note; flags are recomputed every
+//     run, so a note edited since drops its flag.
+//   - "archive" works on whole folders, like /folders/archive: each
+//     subfolder of the rule's folder whose notes were all untouched
+//     for N days (and, with tags, holding a note with every tag) is
+//     archived. Notes directly in the rule's folder and folders
+//     under legal hold are never archived.
+//   - Rule changes need a user token and write "rule.save" /
+//     "rule.delete"; archives write "folder.archive" with the rule
+//     name and flag runs write "rule.flag".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    rulesFile          = "rules.json"
+    rulesStateFile     = "rules_state.json"
+    ruleFlagsFile      = "rule_flags.json"
+    rulesCheckInterval = time.Hour
+    maxRules           = 100
+    maxRuleDays        = 3650
+
+    ruleActionFlag    = "flag"
+    ruleActionArchive = "archive"
+)
+
+// rulesMu serializes rule changes and runs.
+var rulesMu sync.Mutex
+
+// -------------------------------------------------------
+// type Rule
+// -------------------------------------------------------
+// Purpose:
+//   - One expiry rule.
+// Audit:
+//   - Folder is a relative folder path ("" = the whole scratch
+//     root); Tags must all appear in a note as hashtags.
+//   - Disabled rules are kept but neither previewed nor run.
+// -------------------------------------------------------
+type Rule struct {
+    Name      string   `json:"name"`
+    Folder    string   `json:"folder,omitempty"`
+    Tags      []string `json:"tags,omitempty"`
+    Days      int      `json:"days"`
+    Action    string   `json:"action"`
+    Disabled  bool     `json:"disabled,omitempty"`
+    UpdatedBy string   `json:"updated_by,omitempty"`
+    UpdatedAt string   `json:"updated_at"`
+}
+
+// -------------------------------------------------------
+// type RuleAction
+// -------------------------------------------------------
+// Purpose:
+//   - One thing a rule run does: flag a note or archive a folder.
+// Audit:
+//   - Modified is the latest modification of the note (or of any
+//     note in the folder); IdleDays counts whole days since.
+// -------------------------------------------------------
+type RuleAction struct {
+    Rule     string `json:"rule"`
+    Action   string `json:"action"`
+    Path     string `json:"path"`
+    Modified string `json:"modified"`
+    IdleDays int    `json:"idle_days"`
+    Error    string `json:"error,omitempty"`
+}
+
+// RuleFlag is a /rules/flags element.
+type RuleFlag struct {
+    Path      string `json:"path"`
+    Rule      string `json:"rule"`
+    Modified  string `json:"modified"`
+    IdleDays  int    `json:"idle_days"`
+    FlaggedAt string `json:"flagged_at"`
+}
+
+// loadRulesLocked returns the rules sorted by name. Caller holds rulesMu.
+func loadRulesLocked(ctx context.Context) ([]Rule, error) {
+    rules := []Rule{}
+    if err := loadMetaJSON(ctx, rulesFile, &rules); err != nil {
+        return nil, err
+    }
+    if rules == nil {
+        rules = []Rule{}
+    }
+    sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+    return rules, nil
+}
+
+// -------------------------------------------------------
+// func validateRule(ctx context.Context, rule *Rule) error
+// -------------------------------------------------------
+// Purpose:
+//   - Reject rules that could not run; normalize Folder and Tags.
+// Audit:
+//   - Errors are *fieldError.
+// -------------------------------------------------------
+func validateRule(ctx context.Context, rule *Rule) error {
+    if !smartNamePattern.MatchString(rule.Name) {
+        return invalidField("name", "must be 1-64 letters, digits, spaces, '.', '_' or '-'")
+    }
+    if !oneOf(rule.Action, []string{ruleActionFlag, ruleActionArchive}) {
+        return invalidField("action", "must be flag or archive")
+    }
+    if rule.Days < 1 || rule.Days > maxRuleDays {
+        return invalidField("days", "must be between 1 and %d", maxRuleDays)
+    }
+    if rule.Folder != "" {
+        abs := sanitizePath(ctx, rule.Folder)
+        if abs == "" {
+            return invalidField("folder", "is not a valid folder path")
+        }
+        rule.Folder = relativeTo(ctx, abs)
+        if abs == scratchRoot(ctx) {
+            rule.Folder = ""
+        }
+    }
+    if len(rule.Tags) > maxSmartFolderTags {
+        return invalidField("tags", "allows at most %d tags", maxSmartFolderTags)
+    }
+    for i, tag := range rule.Tags {
+        rule.Tags[i] = strings.TrimPrefix(tag, "#")
+        if !smartTagPattern.MatchString(rule.Tags[i]) {
+            return invalidField("tags", "%q is not a valid tag", tag)
+        }
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func planRules(ctx, rules, now) ([]RuleAction, error)
+// -------------------------------------------------------
+// Purpose:
+//   - What running the enabled rules at now would do, in rule order
+//     then path order. Changes nothing.
+// Audit:
+//   - A note is read only when its rule has tags and its age
+//     already qualifies.
+// -------------------------------------------------------
+func planRules(ctx context.Context, rules []Rule, now time.Time) ([]RuleAction, error) {
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return nil, err
+    }
+    actions := []RuleAction{}
+    idle := func(modified time.Time) int { return int(now.Sub(modified).Hours() / 24) }
+
+    for _, rule := range rules {
+        if rule.Disabled {
+            continue
+        }
+        cutoff := now.AddDate(0, 0, -rule.Days)
+        tags := []*regexp.Regexp{}
+        for _, tag := range rule.Tags {
+            tags = append(tags, tagPattern(tag))
+        }
+        tagged := func(note noteFile) (bool, error) {
+            if len(tags) == 0 {
+                return true, nil
+            }
+            if note.Size > maxSearchFileBytes {
+                return false, nil
+            }
+            content, err := readFile(ctx, note.Abs)
+            if err != nil {
+                return false, err
+            }
+            for _, tag := range tags {
+                if !tag.Match(content) {
+                    return false, nil
+                }
+            }
+            return true, nil
+        }
+        scope := ""
+        if rule.Folder != "" {
+            scope = rule.Folder + "/"
+        }
+
+        type folderState struct {
+            latest time.Time
+            tagged bool
+        }
+        folders := map[string]*folderState{}
+        for _, note := range notes {
+            if !strings.HasPrefix(note.Rel, scope) {
+                continue
+            }
+            if rule.Action == ruleActionFlag {
+                if !note.ModTime.Before(cutoff) {
+                    continue
+                }
+                ok, err := tagged(note)
+                if err != nil {
+                    return nil, err
+                }
+                if ok {
+                    actions = append(actions, RuleAction{Rule: rule.Name, Action: rule.Action, Path: note.Rel,
+                        Modified: note.ModTime.UTC().Format(time.RFC3339), IdleDays: idle(note.ModTime)})
+                }
+                continue
+            }
+
+            inner := strings.TrimPrefix(note.Rel, scope)
+            slash := strings.Index(inner, "/")
+            if slash < 0 {
+                continue
+            }
+            folder := scope + inner[:slash]
+            state := folders[folder]
+            if state == nil {
+                state = &folderState{}
+                folders[folder] = state
+            }
+            if note.ModTime.After(state.latest) {
+                state.latest = note.ModTime
+            }
+            if !state.tagged && note.ModTime.Before(cutoff) {
+                ok, err := tagged(note)
+                if err != nil {
+                    return nil, err
+                }
+                state.tagged = ok
+            }
+        }
+
+        names := make([]string, 0, len(folders))
+        for folder, state := range folders {
+            if state.latest.Before(cutoff) && state.tagged && !isHeld(ctx, folder) {
+                names = append(names, folder)
+            }
+        }
+        sort.Strings(names)
+        for _, folder := range names {
+            actions = append(actions, RuleAction{Rule: rule.Name, Action: rule.Action, Path: folder,
+                Modified: folders[folder].latest.UTC().Format(time.RFC3339), IdleDays: idle(folders[folder].latest)})
+        }
+    }
+    sortRuleActions(actions)
+    return actions, nil
+}
+
+// sortRuleActions orders actions by rule, then path.
+func sortRuleActions(actions []RuleAction) {
+    sort.SliceStable(actions, func(i, j int) bool {
+        if actions[i].Rule != actions[j].Rule {
+            return actions[i].Rule < actions[j].Rule
+        }
+        return actions[i].Path < actions[j].Path
+    })
+}
+
+// -------------------------------------------------------
+// func applyRules(ctx, actions, method, actor) []RuleAction
+// -------------------------------------------------------
+// Purpose:
+//   - Archive the planned folders and replace the flag set with the
+//     planned flags; return the actions with errors filled in.
+// Audit:
+//   - A folder that is gone or already archived (an earlier rule
+//     in the same run) is skipped with an error, not retried.
+//   - Caller holds rulesMu.
+// -------------------------------------------------------
+func applyRules(ctx context.Context, actions []RuleAction, method, actor string) []RuleAction {
+    previous := map[string]RuleFlag{}
+    if err := loadMetaJSON(ctx, ruleFlagsFile, &previous); err != nil {
+        logError(ctx, "Failed to load rule flags: "+err.Error())
+    }
+    flags := map[string]RuleFlag{}
+    flagged := map[string]int{}
+
+    for i, action := range actions {
+        if action.Action == ruleActionFlag {
+            if _, dup := flags[action.Path]; dup {
+                continue
+            }
+            flag := RuleFlag{Path: action.Path, Rule: action.Rule, Modified: action.Modified, IdleDays: action.IdleDays, FlaggedAt: utcNow(ctx)}
+            if old, ok := previous[action.Path]; ok && old.Rule == action.Rule && old.Modified == action.Modified {
+                flag.FlaggedAt = old.FlaggedAt
+            }
+            flags[action.Path] = flag
+            flagged[action.Rule]++
+            continue
+        }
+
+        absPath := sanitizePath(ctx, action.Path)
+        info, err := statPath(ctx, absPath)
+        if err == nil && !info.IsDir() {
+            err = errNotAFolder
+        }
+        var record ArchiveRecord
+        if err == nil {
+            record, err = archiveFolder(ctx, action.Path, absPath)
+        }
+        status, detail := http.StatusOK, ""
+        if err != nil {
+            actions[i].Error = err.Error()
+            status, detail = http.StatusInternalServerError, "rule="+action.Rule+" error="+err.Error()
+            logError(ctx, "Rule "+action.Rule+" could not archive "+action.Path+": "+err.Error())
+        } else {
+            detail = fmt.Sprintf("rule=%s idle_days=%d id=%s files=%d bytes=%d compressed=%d sha256=%s",
+                action.Rule, action.IdleDays, record.ID, record.Files, record.Bytes, record.CompressedBytes, record.SHA256)
+            logInfo(ctx, fmt.Sprintf("Rule %s archived %s (idle %d days)", action.Rule, action.Path, action.IdleDays))
+        }
+        audit.WriteContext(ctx, audit.Event{
+            Event:  "folder.archive",
+            Method: method,
+            Path:   "/rules/run",
+            Status: status,
+            Actor:  actor,
+            Target: action.Path,
+            Detail: detail,
+        })
+    }
+
+    if err := saveMetaJSON(ctx, ruleFlagsFile, flags); err != nil {
+        logError(ctx, "Failed to save rule flags: "+err.Error())
+    }
+    rules := make([]string, 0, len(flagged))
+    for rule := range flagged {
+        rules = append(rules, rule)
+    }
+    sort.Strings(rules)
+    for _, rule := range rules {
+        logInfo(ctx, fmt.Sprintf("Rule %s flagged %d notes", rule, flagged[rule]))
+        audit.WriteContext(ctx, audit.Event{
+            Event:  "rule.flag",
+            Method: method,
+            Path:   "/rules/run",
+            Status: http.StatusOK,
+            Actor:  actor,
+            Target: rule,
+            Detail: fmt.Sprintf("flagged=%d", flagged[rule]),
+        })
+    }
+    return actions
+}
+
+// -------------------------------------------------------
+// func runRules(ctx, method, actor) (map[string]interface{}, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Plan and apply all enabled rules; record and return the run.
+// -------------------------------------------------------
+func runRules(ctx context.Context, method, actor string) (map[string]interface{}, error) {
+    rulesMu.Lock()
+    defer rulesMu.Unlock()
+    rules, err := loadRulesLocked(ctx)
+    if err != nil {
+        return nil, err
+    }
+    actions, err := planRules(ctx, rules, timeNow(ctx).UTC())
+    if err != nil {
+        return nil, err
+    }
+    state := map[string]interface{}{"ran_at": utcNow(ctx), "actions": applyRules(ctx, actions, method, actor)}
+    if err := saveMetaJSON(ctx, rulesStateFile, state); err != nil {
+        logError(ctx, "Failed to save rules state: "+err.Error())
+    }
+    return state, nil
+}
+
+// -------------------------------------------------------
+// func RunRules()
+// -------------------------------------------------------
+// Purpose:
+//   - Run the expiry rules every hour.
+// Audit:
+//   - Skipped when no rules are defined (no flags file churn) and
+//     while schedules are paused (maintenance mode).
+// -------------------------------------------------------
+func RunRules(ctx context.Context) {
+    for {
+        time.Sleep(rulesCheckInterval)
+        if SchedulesPaused() {
+            continue
+        }
+        rulesMu.Lock()
+        rules, err := loadRulesLocked(ctx)
+        rulesMu.Unlock()
+        if err != nil {
+            logError(ctx, "Failed to load rules: "+err.Error())
+            continue
+        }
+        if len(rules) == 0 {
+            continue
+        }
+        ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+        if _, err := runRules(ctx, "SCHEDULE", ""); err != nil {
+            logError(ctx, "Scheduled rule run failed: "+err.Error())
+        }
+        cancel()
+    }
+}
+
+// -------------------------------------------------------
+// func HandleRules(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /rules: list, save, or delete expiry rules.
+// -------------------------------------------------------
+func HandleRules(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        rulesMu.Lock()
+        rules, err := loadRulesLocked(r.Context())
+        rulesMu.Unlock()
+        if err != nil {
+            writeStorageError(w, r, err, "load rules", "Internal error")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(rules)
+
+    case http.MethodPost:
+        user, ok := requireUser(w, r)
+        if !ok {
+            return
+        }
+        var rule Rule
+        if !decodeJSON(w, r, &rule) || !requireField(w, r, "name", rule.Name) {
+            return
+        }
+        if err := validateRule(r.Context(), &rule); err != nil {
+            writeFieldError(w, r, err)
+            return
+        }
+        rule.UpdatedBy, rule.UpdatedAt = user.Name, utcNow(r.Context())
+
+        rulesMu.Lock()
+        defer rulesMu.Unlock()
+        rules, err := loadRulesLocked(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "load rules", "Internal error")
+            return
+        }
+        replaced := false
+        for i := range rules {
+            if rules[i].Name == rule.Name {
+                rules[i] = rule
+                replaced = true
+            }
+        }
+        if !replaced {
+            if len(rules) >= maxRules {
+                writeFieldError(w, r, invalidField("name", "would exceed %d rules", maxRules))
+                return
+            }
+            rules = append(rules, rule)
+        }
+        if err := saveMetaJSON(r.Context(), rulesFile, rules); err != nil {
+            writeStorageError(w, r, err, "save rules", "Save failed")
+            return
+        }
+        logInfo(r.Context(), "Saved rule "+rule.Name+" by "+user.Name)
+        auditRule(r, "rule.save", user.Name, rule.Name,
+            fmt.Sprintf("action=%s days=%d folder=%s tags=%s disabled=%t", rule.Action, rule.Days, rule.Folder, strings.Join(rule.Tags, ","), rule.Disabled))
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(rule)
+
+    case http.MethodDelete:
+        user, ok := requireUser(w, r)
+        if !ok {
+            return
+        }
+        name := r.URL.Query().Get("name")
+        if !requireField(w, r, "name", name) {
+            return
+        }
+        rulesMu.Lock()
+        defer rulesMu.Unlock()
+        rules, err := loadRulesLocked(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "load rules", "Internal error")
+            return
+        }
+        kept := []Rule{}
+        for _, rule := range rules {
+            if rule.Name != name {
+                kept = append(kept, rule)
+            }
+        }
+        if len(kept) == len(rules) {
+            apierror.Write(w, r, apierror.CodeNotFound, "name", "Rule not found")
+            return
+        }
+        if err := saveMetaJSON(r.Context(), rulesFile, kept); err != nil {
+            writeStorageError(w, r, err, "save rules", "Delete failed")
+            return
+        }
+        logInfo(r.Context(), "Deleted rule "+name+" by "+user.Name)
+        auditRule(r, "rule.delete", user.Name, name, "")
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func HandleRulesPreview(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /rules/preview[?name=...]: {"at", "actions"} the next run
+//     would take now, for all enabled rules or just one.
+// Audit:
+//   - ?name previews that rule even when disabled.
+// -------------------------------------------------------
+func HandleRulesPreview(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    rulesMu.Lock()
+    rules, err := loadRulesLocked(r.Context())
+    rulesMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "load rules", "Internal error")
+        return
+    }
+    if name := r.URL.Query().Get("name"); name != "" {
+        selected := []Rule{}
+        for _, rule := range rules {
+            if rule.Name == name {
+                rule.Disabled = false
+                selected = append(selected, rule)
+            }
+        }
+        if len(selected) == 0 {
+            apierror.Write(w, r, apierror.CodeNotFound, "name", "Rule not found")
+            return
+        }
+        rules = selected
+    }
+
+    now := timeNow(r.Context()).UTC()
+    actions, err := planRules(r.Context(), rules, now)
+    if err != nil {
+        writeStorageError(w, r, err, "preview rules", "Preview failed")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"at": now.Format(time.RFC3339), "actions": actions})
+}
+
+// -------------------------------------------------------
+// func HandleRulesRun(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /rules/run: the last run; POST /rules/run: run the rules
+//     now and return {"ran_at", "actions"}.
+// -------------------------------------------------------
+func HandleRulesRun(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        state := map[string]interface{}{}
+        if err := loadMetaJSON(r.Context(), rulesStateFile, &state); err != nil {
+            writeStorageError(w, r, err, "load rules state", "Internal error")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(state)
+    case http.MethodPost:
+        user, ok := requireUser(w, r)
+        if !ok {
+            return
+        }
+        state, err := runRules(context.WithoutCancel(r.Context()), r.Method, user.Name)
+        if err != nil {
+            writeStorageError(w, r, err, "run rules", "Rule run failed")
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(state)
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func HandleRuleFlags(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /rules/flags[?folder=...]: flagged notes sorted by path.
+// -------------------------------------------------------
+func HandleRuleFlags(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    scope := ""
+    if folder := r.URL.Query().Get("folder"); folder != "" {
+        abs := sanitizePath(r.Context(), folder)
+        if abs == "" {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+            return
+        }
+        if abs != scratchRoot(r.Context()) {
+            scope = relativeTo(r.Context(), abs) + "/"
+        }
+    }
+
+    rulesMu.Lock()
+    stored := map[string]RuleFlag{}
+    err := loadMetaJSON(r.Context(), ruleFlagsFile, &stored)
+    rulesMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "load rule flags", "Internal error")
+        return
+    }
+    flags := []RuleFlag{}
+    for rel, flag := range stored {
+        if strings.HasPrefix(rel, scope) {
+            flags = append(flags, flag)
+        }
+    }
+    sort.Slice(flags, func(i, j int) bool { return flags[i].Path < flags[j].Path })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(flags)
+}
+
+// auditRule records a rule change.
+func auditRule(r *http.Request, event, actor, name, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actor,
+        Target:   name,
+        Detail:   detail,
+    })
+}
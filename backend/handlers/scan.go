@@ -0,0 +1,93 @@
+// -------------------------------------------------------
+// backend/handlers/scan.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Enumerate every note file under the scratchpad root for
+//     reports and scans that span all folders.
+// Audit:
+//   - Skips hidden (dot) entries reserved for system data.
+//   - Never descends into symlinked directories and only returns
+//     regular files (Walk uses Lstat).
+//   - Honours the request context between entries.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// -------------------------------------------------------
+// type noteFile
+// -------------------------------------------------------
+// Purpose:
+//   - One note discovered by scanNotes.
+// Audit:
+//   - Rel is slash-separated and relative to scratchRoot.
+// -------------------------------------------------------
+type noteFile struct {
+    Rel     string
+    Abs     string
+    Size    int64
+    ModTime time.Time
+}
+
+// -------------------------------------------------------
+// func scanNotes(ctx) ([]noteFile, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Walk scratchRoot and collect all regular note files.
+// Audit:
+//   - Returns an empty slice (not an error) if the root is missing.
+// -------------------------------------------------------
+func scanNotes(ctx context.Context) ([]noteFile, error) {
+    return scanFiles(ctx, isNoteName)
+}
+
+// -------------------------------------------------------
+// func scanFiles(ctx, match) ([]noteFile, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Walk scratchRoot and collect the regular files whose name
+//     satisfies match (notes, or attachments too).
+// -------------------------------------------------------
+func scanFiles(ctx context.Context, match func(name string) bool) ([]noteFile, error) {
+    notes := []noteFile{}
+    if _, err := statPath(ctx, scratchRoot(ctx)); os.IsNotExist(err) {
+        return notes, nil
+    }
+
+    err := walkPath(ctx, scratchRoot(ctx), func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if path == scratchRoot(ctx) {
+            return nil
+        }
+        if strings.HasPrefix(info.Name(), ".") {
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !info.Mode().IsRegular() || !match(info.Name()) {
+            return nil
+        }
+        rel, relErr := filepath.Rel(scratchRoot(ctx), path)
+        if relErr != nil {
+            return relErr
+        }
+        notes = append(notes, noteFile{
+            Rel:     filepath.ToSlash(rel),
+            Abs:     path,
+            Size:    info.Size(),
+            ModTime: info.ModTime().UTC(),
+        })
+        return nil
+    })
+    return notes, err
+}
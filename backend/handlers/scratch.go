@@ -0,0 +1,239 @@
+// -------------------------------------------------------
+// backend/handlers/scratch.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Scratch buffers: a few named, ephemeral text buffers per user
+//     for moving snippets between notes and devices without
+//     creating files:
+//       GET    /scratch                    list the caller's buffers
+//       GET    /scratch?name=...           one buffer with content
+//       PUT    /scratch {"name", "content"} set a buffer
+//       DELETE /scratch?name=...           drop a buffer
+// Audit:
+//   - Requires a user token (401 otherwise); a user only ever sees
+//     their own buffers.
+//   - Held in memory only: never written under the scratch root or
+//     .scratchpad, and lost on restart.
+//   - A buffer expires scratch.ttl after its last write. A user holds
+//     at most scratch.max_buffers buffers of scratch.max_bytes each.
+//   - Writes and deletes are audited ("scratch.put", "scratch.delete")
+//     with the buffer name and size; content is never logged.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+// defaultScratchName is the buffer used when no name is given.
+const defaultScratchName = "default"
+
+// scratchNamePattern restricts buffer names to short tokens.
+var scratchNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// -------------------------------------------------------
+// type ScratchBuffer
+// -------------------------------------------------------
+// Purpose:
+//   - One user's named buffer; Content is left out of listings.
+// -------------------------------------------------------
+type ScratchBuffer struct {
+    Name      string `json:"name"`
+    Content   string `json:"content,omitempty"`
+    Bytes     int    `json:"bytes"`
+    UpdatedAt string `json:"updated_at"`
+    ExpiresAt string `json:"expires_at"`
+}
+
+// scratchEntry is a stored buffer with its expiry.
+type scratchEntry struct {
+    content string
+    updated time.Time
+    expires time.Time
+}
+
+var (
+    scratchMu      sync.Mutex
+    scratchBuffers = map[string]map[string]*scratchEntry{}
+)
+
+// scratchForLocked returns user's live buffers, dropping expired ones.
+// Caller holds scratchMu.
+func scratchForLocked(user string, now time.Time) map[string]*scratchEntry {
+    buffers := scratchBuffers[user]
+    for name, entry := range buffers {
+        if !now.Before(entry.expires) {
+            delete(buffers, name)
+        }
+    }
+    if len(buffers) == 0 {
+        delete(scratchBuffers, user)
+        return nil
+    }
+    return buffers
+}
+
+// scratchView renders a buffer for the API.
+func scratchView(name string, entry *scratchEntry, withContent bool) ScratchBuffer {
+    view := ScratchBuffer{
+        Name:      name,
+        Bytes:     len(entry.content),
+        UpdatedAt: entry.updated.UTC().Format(time.RFC3339),
+        ExpiresAt: entry.expires.UTC().Format(time.RFC3339),
+    }
+    if withContent {
+        view.Content = entry.content
+    }
+    return view
+}
+
+// -------------------------------------------------------
+// func HandleScratch(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET, PUT, and DELETE the caller's scratch buffers.
+// Audit:
+//   - Over-size content answers 413; a new buffer beyond
+//     max_buffers answers 409 (drop one first).
+// -------------------------------------------------------
+func HandleScratch(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    cfg := currentConfig(r.Context()).Scratch
+    now := timeNow(r.Context())
+
+    switch r.Method {
+    case http.MethodGet:
+        name := r.URL.Query().Get("name")
+        scratchMu.Lock()
+        buffers := scratchForLocked(user.Name, now)
+        if name != "" {
+            entry, found := buffers[name]
+            var view ScratchBuffer
+            if found {
+                view = scratchView(name, entry, true)
+            }
+            scratchMu.Unlock()
+            if !found {
+                apierror.Write(w, r, apierror.CodeNotFound, "name", "Scratch buffer not found")
+                return
+            }
+            w.Header().Set("Content-Type", "application/json")
+            w.Header().Set("Cache-Control", "no-store")
+            json.NewEncoder(w).Encode(view)
+            return
+        }
+        items := []ScratchBuffer{}
+        for name, entry := range buffers {
+            items = append(items, scratchView(name, entry, false))
+        }
+        scratchMu.Unlock()
+        sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Cache-Control", "no-store")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "items":       items,
+            "max_buffers": cfg.MaxBuffers,
+            "max_bytes":   cfg.MaxBytes,
+            "ttl":         cfg.TTL,
+        })
+
+    case http.MethodPut, http.MethodPost:
+        var req struct {
+            Name    string `json:"name"`
+            Content string `json:"content"`
+        }
+        dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(cfg.MaxBytes)*2+1024))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(&req); err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                apierror.Write(w, r, apierror.CodePayloadTooLarge, "content", fmt.Sprintf("Scratch content exceeds %d bytes", cfg.MaxBytes))
+                return
+            }
+            writeJSONError(w, r, err)
+            return
+        }
+        if req.Name == "" {
+            req.Name = defaultScratchName
+        }
+        if !scratchNamePattern.MatchString(req.Name) {
+            apierror.Write(w, r, apierror.CodeInvalidField, "name", "Bad request: name must be 1-32 of a-z, 0-9, '_' or '-'")
+            return
+        }
+        if len(req.Content) > cfg.MaxBytes {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "content", fmt.Sprintf("Scratch content exceeds %d bytes", cfg.MaxBytes))
+            return
+        }
+        if !utf8.ValidString(req.Content) {
+            apierror.Write(w, r, apierror.CodeInvalidContent, "content", "Scratch content is not valid UTF-8")
+            return
+        }
+
+        scratchMu.Lock()
+        buffers := scratchForLocked(user.Name, now)
+        if _, exists := buffers[req.Name]; !exists && len(buffers) >= cfg.MaxBuffers {
+            scratchMu.Unlock()
+            apierror.Write(w, r, apierror.CodeConflict, "name", fmt.Sprintf("At most %d scratch buffers; delete one first", cfg.MaxBuffers))
+            return
+        }
+        if buffers == nil {
+            buffers = map[string]*scratchEntry{}
+            scratchBuffers[user.Name] = buffers
+        }
+        entry := &scratchEntry{content: req.Content, updated: now, expires: now.Add(cfg.TTL.Std())}
+        buffers[req.Name] = entry
+        view := scratchView(req.Name, entry, false)
+        scratchMu.Unlock()
+
+        auditScratch(r, "scratch.put", http.StatusOK, user.Name, req.Name, fmt.Sprintf("bytes=%d", len(req.Content)))
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(view)
+
+    case http.MethodDelete:
+        name := defaultString(r.URL.Query().Get("name"), defaultScratchName)
+        scratchMu.Lock()
+        buffers := scratchForLocked(user.Name, now)
+        _, found := buffers[name]
+        delete(buffers, name)
+        scratchMu.Unlock()
+        if !found {
+            apierror.Write(w, r, apierror.CodeNotFound, "name", "Scratch buffer not found")
+            return
+        }
+        auditScratch(r, "scratch.delete", http.StatusNoContent, user.Name, name, "")
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// auditScratch records a change to a scratch buffer (never its content).
+func auditScratch(r *http.Request, event string, status int, user string, name string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    user,
+        Target:   name,
+        Detail:   detail,
+    })
+}
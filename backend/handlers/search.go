@@ -0,0 +1,331 @@
+// -------------------------------------------------------
+// backend/handlers/search.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /search: full-text search across notes with substring
+//     (default), regular expression, and whole-word modes, and an
+//     optional case-sensitive flag.
+// Audit:
+//   - Regular expressions use Go's RE2 engine: matching is linear
+//     in the input, so no pattern can backtrack catastrophically.
+//   - Patterns are length-limited and compiled under a deadline;
+//     RE2 rejects oversized programs ("expression too large").
+//     Patterns matching the empty string are refused.
+//   - Matches per file and files per response are capped; notes
+//     larger than maxSearchFileBytes are skipped and counted.
+//   - Notes are searched as the read processors return them, so
+//     snippets never show what GET /file would hide; a note whose
+//     read processor fails is skipped and counted.
+//   - Read-only; logs the query mode and result counts.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    maxSearchQueryBytes   = 1024
+    searchCompileTimeout  = time.Second
+    defaultSearchMatches  = 20
+    maxSearchMatches      = 200
+    defaultSearchFiles    = 100
+    maxSearchFiles        = 1000
+    maxSearchFileBytes    = 8 << 20
+    maxSearchExcerptBytes = 240
+)
+
+// Search modes accepted by ?mode=.
+const (
+    searchSubstring = "substring"
+    searchRegex     = "regex"
+    searchWord      = "word"
+)
+
+// -------------------------------------------------------
+// type SearchMatch / SearchFile
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes returned by /search.
+// Audit:
+//   - Line and Column are 1-based; Column and Offset count bytes.
+//   - Text is the matching line, cut to maxSearchExcerptBytes.
+//   - Truncated marks a file with more than max_matches matches.
+//   - Attachment names the scan an OCR sidecar note was extracted
+//     from (ocr.go).
+// -------------------------------------------------------
+type SearchMatch struct {
+    Line   int    `json:"line"`
+    Column int    `json:"column"`
+    Offset int    `json:"offset"`
+    Length int    `json:"length"`
+    Text   string `json:"text"`
+}
+
+type SearchFile struct {
+    Path        string        `json:"path"`
+    Language    string        `json:"language"`
+    Attachment  string        `json:"attachment,omitempty"`
+    Frontmatter *Frontmatter  `json:"frontmatter,omitempty"`
+    Matches     []SearchMatch `json:"matches"`
+    Truncated   bool          `json:"truncated"`
+}
+
+// -------------------------------------------------------
+// func searchPattern(query, mode string, caseSensitive bool) string
+// -------------------------------------------------------
+// Purpose:
+//   - Translate a query and its flags into one RE2 expression.
+// Audit:
+//   - Substring and word queries are quoted, so only regex mode
+//     interprets metacharacters. Word boundaries are ASCII (\b).
+// -------------------------------------------------------
+func searchPattern(query, mode string, caseSensitive bool) string {
+    expr := query
+    switch mode {
+    case searchSubstring:
+        expr = regexp.QuoteMeta(query)
+    case searchWord:
+        expr = `\b` + regexp.QuoteMeta(query) + `\b`
+    }
+    if !caseSensitive {
+        expr = "(?i)" + expr
+    }
+    return expr
+}
+
+// -------------------------------------------------------
+// func compileSearch(ctx, expr) (*regexp.Regexp, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Compile expr, giving up after searchCompileTimeout.
+// -------------------------------------------------------
+func compileSearch(ctx context.Context, expr string) (*regexp.Regexp, error) {
+    ctx, cancel := context.WithTimeout(ctx, searchCompileTimeout)
+    defer cancel()
+    var re *regexp.Regexp
+    err := runWithContext(ctx, func() error {
+        var compileErr error
+        re, compileErr = regexp.Compile(expr)
+        return compileErr
+    })
+    return re, err
+}
+
+// -------------------------------------------------------
+// func searchContent(re, content, limit) ([]SearchMatch, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Up to limit matches in content, and whether there were more.
+// Audit:
+//   - re must not match the empty string (HandleSearch rejects
+//     such patterns), so every match has a length.
+// -------------------------------------------------------
+func searchContent(re *regexp.Regexp, content []byte, limit int) ([]SearchMatch, bool) {
+    matches := []SearchMatch{}
+    line, lineStart, scanned := 1, 0, 0
+    for _, loc := range re.FindAllIndex(content, limit+1) {
+        if len(matches) == limit {
+            return matches, true
+        }
+        for ; scanned < loc[0]; scanned++ {
+            if content[scanned] == '\n' {
+                line++
+                lineStart = scanned + 1
+            }
+        }
+        lineEnd := len(content)
+        if i := bytes.IndexByte(content[lineStart:], '\n'); i >= 0 {
+            lineEnd = lineStart + i
+        }
+        text := content[lineStart:lineEnd]
+        if len(text) > maxSearchExcerptBytes {
+            text = text[:maxSearchExcerptBytes]
+        }
+        matches = append(matches, SearchMatch{
+            Line:   line,
+            Column: loc[0] - lineStart + 1,
+            Offset: loc[0],
+            Length: loc[1] - loc[0],
+            Text:   strings.ToValidUTF8(strings.TrimSuffix(string(text), "\r"), ""),
+        })
+    }
+    return matches, false
+}
+
+// searchIntParam parses an optional 1..max query parameter.
+func searchIntParam(r *http.Request, name string, def, max int) (int, error) {
+    v := r.URL.Query().Get(name)
+    if v == "" {
+        return def, nil
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n < 1 || n > max {
+        return 0, invalidField(name, "must be 1-%d", max)
+    }
+    return n, nil
+}
+
+// -------------------------------------------------------
+// func HandleSearch(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /search?q=...: notes containing the query, with the
+//     position of each match.
+// Audit:
+//   - mode = substring (default) | regex | word; case=1 makes the
+//     search case-sensitive (default: case-insensitive).
+//   - folder limits the search to one folder and its subfolders;
+//     lang to notes in one language (language.go); status, owner,
+//     tag, due_before and due_after filter by frontmatter
+//     (frontmatter.go).
+//   - max_matches (default 20, max 200) caps matches per file;
+//     limit (default 100, max 1000) caps files in the response.
+//   - Files are sorted by path; arrays are never null.
+// -------------------------------------------------------
+func HandleSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    q := r.URL.Query()
+    query := q.Get("q")
+    if !requireField(w, r, "q", query) {
+        return
+    }
+    if len(query) > maxSearchQueryBytes {
+        writeFieldError(w, r, invalidField("q", "exceeds %d bytes", maxSearchQueryBytes))
+        return
+    }
+    mode := defaultString(q.Get("mode"), searchSubstring)
+    if !oneOf(mode, []string{searchSubstring, searchRegex, searchWord}) {
+        writeFieldError(w, r, invalidField("mode", "must be substring, regex, or word"))
+        return
+    }
+    caseSensitive := q.Get("case") == "1" || q.Get("case") == "true"
+    perFile, err := searchIntParam(r, "max_matches", defaultSearchMatches, maxSearchMatches)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    limit, err := searchIntParam(r, "limit", defaultSearchFiles, maxSearchFiles)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    scope := ""
+    if folder := q.Get("folder"); folder != "" {
+        absFolder := sanitizePath(r.Context(), folder)
+        if absFolder == "" {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+            return
+        }
+        scope = relativeTo(r.Context(), absFolder) + "/"
+    }
+    lang, err := languageFilter(r)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+    fields, err := frontmatterFilter(r)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    re, err := compileSearch(r.Context(), searchPattern(query, mode, caseSensitive))
+    if err == context.DeadlineExceeded {
+        writeFieldError(w, r, invalidField("q", "took too long to compile"))
+        return
+    }
+    if err != nil {
+        writeFieldError(w, r, invalidField("q", "is not a valid pattern: %v", err))
+        return
+    }
+    if re.MatchString("") {
+        writeFieldError(w, r, invalidField("q", "matches the empty string"))
+        return
+    }
+
+    notes, err := scanNotes(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "scan notes", "Search failed")
+        return
+    }
+    sort.Slice(notes, func(i, j int) bool { return notes[i].Rel < notes[j].Rel })
+
+    languages := newLanguageLookup(r.Context())
+    frontmatter := newFrontmatterLookup(r.Context(), languages.index)
+    sidecars := ocrSidecars(r.Context())
+    files := []SearchFile{}
+    truncated := false
+    searched, skipped := 0, 0
+    for _, note := range notes {
+        if scope != "" && !strings.HasPrefix(note.Rel, scope) {
+            continue
+        }
+        if lang != "" && !languageMatches(languages.of(note.Rel), lang) {
+            continue
+        }
+        if fields.active() && !fields.matches(frontmatter.of(note.Rel), languages.index[note.Rel].Tags) {
+            continue
+        }
+        if note.Size > maxSearchFileBytes {
+            skipped++
+            continue
+        }
+        content, err := readFile(r.Context(), note.Abs)
+        if err != nil {
+            writeStorageError(w, r, err, "read file for search: "+note.Abs, "Search failed")
+            return
+        }
+        content, err = processContent(r.Context(), hookRead, note.Rel, content)
+        var failed *ProcessorError
+        if errors.As(err, &failed) {
+            logError(r.Context(), "Search skipped "+note.Rel+": "+failed.Error())
+            skipped++
+            continue
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "process file for search: "+note.Abs, "Search failed")
+            return
+        }
+        searched++
+        matches, more := searchContent(re, content, perFile)
+        if len(matches) == 0 {
+            continue
+        }
+        if len(files) == limit {
+            truncated = true
+            break
+        }
+        files = append(files, SearchFile{Path: note.Rel, Language: languages.of(note.Rel), Attachment: sidecars[note.Rel], Frontmatter: frontmatter.shown(note.Rel), Matches: matches, Truncated: more})
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Search (%s, case=%t) matched %d files of %d searched", mode, caseSensitive, len(files), searched))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "query":          query,
+        "mode":           mode,
+        "case_sensitive": caseSensitive,
+        "files":          files,
+        "truncated":      truncated,
+        "searched":       searched,
+        "skipped":        skipped,
+    })
+}
@@ -0,0 +1,574 @@
+// -------------------------------------------------------
+// backend/handlers/sensitive.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Sensitive data scan before notes leave the building:
+//       GET  /reports/sensitive[?folder=|path=][&rule=]   findings
+//       POST /reports/sensitive/redact {path, target, rules}
+//     The redact call writes a sanitized copy of one note with each
+//     finding replaced by [REDACTED:<rule>]; the original is kept.
+//   - Built-in detectors (SSNs, card numbers, IBANs, routing and
+//     bank account numbers) plus the named patterns and keywords in
+//     the "sensitive" configuration.
+// Audit:
+//   - Findings never echo the matched value: "match" is masked down
+//     to its last four letters or digits (keywords are shown as
+//     configured).
+//   - Card, IBAN and routing numbers must pass their check digits;
+//     routing and account numbers need a label ("routing", "ABA",
+//     "account no.") in front of them.
+//   - Archived folders are scanned only with ?path=.
+//   - Each sanitized copy writes a "file.redact" audit event.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math/big"
+    "net/http"
+    "path"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+    "unicode"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+const maxSensitiveFindings = 5000
+
+// Sensitive rule kinds.
+const (
+    sensitiveDetector = "detector"
+    sensitivePattern  = "pattern"
+    sensitiveKeyword  = "keyword"
+)
+
+// sensitiveDetectors are the built-in detectors by name; group is
+// the submatch holding the value (0 for the whole match).
+var sensitiveDetectors = map[string]struct {
+    pattern *regexp.Regexp
+    group   int
+    valid   func(string) bool
+}{
+    "ssn":          {regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b`), 0, validSSN},
+    "card":         {regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), 0, validCard},
+    "iban":         {regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), 0, validIBAN},
+    "routing":      {regexp.MustCompile(`(?i)\b(?:routing|aba|rtn)(?:\s*(?:no\.?|number|#))?\s*[:#]?\s*(\d{9})\b`), 1, validRouting},
+    "bank_account": {regexp.MustCompile(`(?i)\b(?:account|acct|a/c)(?:\s*(?:no\.?|number|#))?\s*[:#]?\s*(\d[\d -]{4,18}\d)\b`), 1, validAccount},
+}
+
+// -------------------------------------------------------
+// type SensitiveFinding / SensitiveReport
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shapes returned by /reports/sensitive.
+// Audit:
+//   - Line and Column are 1-based; Column and Offset count bytes.
+//   - Rule is the detector, pattern name, or "keyword"; Kind says
+//     which of the three it is.
+// -------------------------------------------------------
+type SensitiveFinding struct {
+    Path   string `json:"path"`
+    Line   int    `json:"line"`
+    Column int    `json:"column"`
+    Offset int    `json:"offset"`
+    Length int    `json:"length"`
+    Rule   string `json:"rule"`
+    Kind   string `json:"kind"`
+    Match  string `json:"match"`
+}
+
+type SensitiveReport struct {
+    GeneratedAt string             `json:"generated_at"`
+    Notes       int                `json:"notes"`
+    Findings    []SensitiveFinding `json:"findings"`
+    Counts      map[string]int     `json:"counts"`
+    Truncated   bool               `json:"truncated"`
+}
+
+// sensitiveRule is one compiled detector, pattern, or keyword.
+type sensitiveRule struct {
+    name    string
+    kind    string
+    pattern *regexp.Regexp
+    group   int
+    valid   func(string) bool
+}
+
+// sensitiveMatch is one finding in a note's content.
+type sensitiveMatch struct {
+    rule   sensitiveRule
+    offset int
+    length int
+}
+
+// -------------------------------------------------------
+// func sensitiveRules(cfg config.SensitiveConfig) []sensitiveRule
+// -------------------------------------------------------
+// Purpose:
+//   - The configured rules: detectors, then patterns by name, then
+//     one rule per keyword (all named "keyword").
+// Audit:
+//   - The configuration was validated on load, so a pattern that
+//     fails to compile here is skipped.
+// -------------------------------------------------------
+func sensitiveRules(cfg config.SensitiveConfig) []sensitiveRule {
+    rules := []sensitiveRule{}
+    for _, name := range cfg.Detectors {
+        if d, ok := sensitiveDetectors[name]; ok {
+            rules = append(rules, sensitiveRule{name: name, kind: sensitiveDetector, pattern: d.pattern, group: d.group, valid: d.valid})
+        }
+    }
+    names := make([]string, 0, len(cfg.Patterns))
+    for name := range cfg.Patterns {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        if re, err := regexp.Compile(cfg.Patterns[name]); err == nil {
+            rules = append(rules, sensitiveRule{name: name, kind: sensitivePattern, pattern: re})
+        }
+    }
+    for _, keyword := range cfg.Keywords {
+        keyword = strings.TrimSpace(keyword)
+        if keyword == "" {
+            continue
+        }
+        expr := regexp.QuoteMeta(keyword)
+        if isWordRune(rune(keyword[0])) {
+            expr = `\b` + expr
+        }
+        if isWordRune(rune(keyword[len(keyword)-1])) {
+            expr += `\b`
+        }
+        rules = append(rules, sensitiveRule{name: sensitiveKeyword, kind: sensitiveKeyword, pattern: regexp.MustCompile(`(?i)` + expr)})
+    }
+    return rules
+}
+
+// isWordRune reports whether c counts as a word character for \b.
+func isWordRune(c rune) bool {
+    return c == '_' || c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c))
+}
+
+// -------------------------------------------------------
+// func filterSensitiveRules(rules, only) ([]sensitiveRule, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The rules named in only (all when only is empty); false if
+//     only names a rule that is not configured.
+// -------------------------------------------------------
+func filterSensitiveRules(rules []sensitiveRule, only []string) ([]sensitiveRule, bool) {
+    if len(only) == 0 {
+        return rules, true
+    }
+    kept := []sensitiveRule{}
+    for _, name := range only {
+        found := false
+        for _, rule := range rules {
+            if rule.name == name {
+                kept = append(kept, rule)
+                found = true
+            }
+        }
+        if !found {
+            return nil, false
+        }
+    }
+    return kept, true
+}
+
+// -------------------------------------------------------
+// func findSensitive(content []byte, rules []sensitiveRule) []sensitiveMatch
+// -------------------------------------------------------
+// Purpose:
+//   - Every finding of rules in content, by offset.
+// Audit:
+//   - Overlapping findings keep the earliest (then the longest), so
+//     a redaction never cuts into one already made.
+// -------------------------------------------------------
+func findSensitive(content []byte, rules []sensitiveRule) []sensitiveMatch {
+    matches := []sensitiveMatch{}
+    for _, rule := range rules {
+        for _, loc := range rule.pattern.FindAllSubmatchIndex(content, -1) {
+            start, end := loc[2*rule.group], loc[2*rule.group+1]
+            if start < 0 || start == end {
+                continue
+            }
+            if rule.valid != nil && !rule.valid(string(content[start:end])) {
+                continue
+            }
+            matches = append(matches, sensitiveMatch{rule: rule, offset: start, length: end - start})
+        }
+    }
+    sort.SliceStable(matches, func(i, j int) bool {
+        if matches[i].offset != matches[j].offset {
+            return matches[i].offset < matches[j].offset
+        }
+        return matches[i].length > matches[j].length
+    })
+
+    kept := []sensitiveMatch{}
+    end := 0
+    for _, m := range matches {
+        if m.offset < end {
+            continue
+        }
+        kept = append(kept, m)
+        end = m.offset + m.length
+    }
+    return kept
+}
+
+// -------------------------------------------------------
+// func maskSensitive(text string) string
+// -------------------------------------------------------
+// Purpose:
+//   - text with every letter and digit but the last four replaced
+//     by "*"; separators are kept. Short values are fully masked.
+// -------------------------------------------------------
+func maskSensitive(text string) string {
+    runes := []rune(text)
+    shown := 0
+    for i := len(runes) - 1; i >= 0; i-- {
+        if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+            continue
+        }
+        if shown < 4 && len(runes) > 6 {
+            shown++
+            continue
+        }
+        runes[i] = '*'
+    }
+    return string(runes)
+}
+
+// digitsOf returns the digits of text, dropping spaces and dashes.
+func digitsOf(text string) string {
+    return strings.Map(func(c rune) rune {
+        if c >= '0' && c <= '9' {
+            return c
+        }
+        return -1
+    }, text)
+}
+
+// validSSN rejects area 000, 666 and 9xx, group 00 and serial 0000.
+func validSSN(text string) bool {
+    d := digitsOf(text)
+    return d[:3] != "000" && d[:3] != "666" && d[0] != '9' && d[3:5] != "00" && d[5:] != "0000"
+}
+
+// validCard applies the Luhn check to 13-19 digits.
+func validCard(text string) bool {
+    d := digitsOf(text)
+    if len(d) < 13 || len(d) > 19 {
+        return false
+    }
+    sum := 0
+    for i := 0; i < len(d); i++ {
+        n := int(d[len(d)-1-i] - '0')
+        if i%2 == 1 {
+            if n *= 2; n > 9 {
+                n -= 9
+            }
+        }
+        sum += n
+    }
+    return sum%10 == 0
+}
+
+// validIBAN applies the ISO 13616 mod-97 check.
+func validIBAN(text string) bool {
+    iban := strings.ReplaceAll(text, " ", "")
+    if len(iban) < 15 || len(iban) > 34 {
+        return false
+    }
+    var numeric strings.Builder
+    for _, c := range iban[4:] + iban[:4] {
+        if c >= 'A' && c <= 'Z' {
+            fmt.Fprintf(&numeric, "%d", c-'A'+10)
+        } else {
+            numeric.WriteRune(c)
+        }
+    }
+    n, ok := new(big.Int).SetString(numeric.String(), 10)
+    return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validRouting applies the ABA routing number checksum.
+func validRouting(text string) bool {
+    weights := []int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+    sum := 0
+    for i, c := range text {
+        sum += int(c-'0') * weights[i]
+    }
+    return sum%10 == 0 && text != "000000000"
+}
+
+// validAccount accepts 6-17 digits.
+func validAccount(text string) bool {
+    d := digitsOf(text)
+    return len(d) >= 6 && len(d) <= 17
+}
+
+// -------------------------------------------------------
+// func scanSensitive(ctx, files, rules) (SensitiveReport, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Build the report over files (sorted by path).
+// Audit:
+//   - Notes over maxSearchFileBytes are skipped; at most
+//     maxSensitiveFindings findings are listed (truncated), while
+//     counts cover every finding.
+// -------------------------------------------------------
+func scanSensitive(ctx context.Context, files []noteFile, rules []sensitiveRule) (SensitiveReport, error) {
+    report := SensitiveReport{GeneratedAt: timeNow(ctx).UTC().Format(time.RFC3339), Findings: []SensitiveFinding{}, Counts: map[string]int{}}
+    sort.Slice(files, func(i, j int) bool { return files[i].Rel < files[j].Rel })
+    for _, file := range files {
+        if file.Size > maxSearchFileBytes {
+            continue
+        }
+        content, err := readNote(ctx, file.Abs)
+        if err != nil {
+            return report, err
+        }
+        if len(content) > maxSearchFileBytes {
+            continue
+        }
+        report.Notes++
+
+        line, lineStart, scanned := 1, 0, 0
+        for _, m := range findSensitive(content, rules) {
+            report.Counts[m.rule.name]++
+            if len(report.Findings) == maxSensitiveFindings {
+                report.Truncated = true
+                continue
+            }
+            for ; scanned < m.offset; scanned++ {
+                if content[scanned] == '\n' {
+                    line++
+                    lineStart = scanned + 1
+                }
+            }
+            text := string(content[m.offset : m.offset+m.length])
+            if m.rule.kind != sensitiveKeyword {
+                text = maskSensitive(text)
+            }
+            report.Findings = append(report.Findings, SensitiveFinding{
+                Path:   file.Rel,
+                Line:   line,
+                Column: m.offset - lineStart + 1,
+                Offset: m.offset,
+                Length: m.length,
+                Rule:   m.rule.name,
+                Kind:   m.rule.kind,
+                Match:  text,
+            })
+        }
+    }
+    return report, nil
+}
+
+// sensitiveRuleParam splits a comma-separated rule list.
+func sensitiveRuleParam(value string) []string {
+    if value == "" {
+        return nil
+    }
+    return strings.Split(value, ",")
+}
+
+// -------------------------------------------------------
+// func HandleSensitiveReport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /reports/sensitive: scan every note, a folder (?folder=)
+//     or one note (?path=); ?rule=ssn,keyword limits the rules.
+// Audit:
+//   - An unknown rule answers invalid_field.
+// -------------------------------------------------------
+func HandleSensitiveReport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    query := r.URL.Query()
+    rules, ok := filterSensitiveRules(sensitiveRules(currentConfig(r.Context()).Sensitive), sensitiveRuleParam(query.Get("rule")))
+    if !ok {
+        writeFieldError(w, r, invalidField("rule", "must name configured detectors, patterns, or keyword"))
+        return
+    }
+
+    var files []noteFile
+    if file := query.Get("path"); file != "" {
+        absPath := sanitizePath(r.Context(), file)
+        if absPath == "" || !isNoteName(absPath) {
+            logError(r.Context(), "Invalid file path requested: "+file)
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        files = []noteFile{{Rel: relativeTo(r.Context(), absPath), Abs: absPath}}
+    } else {
+        scope := ""
+        if folder := query.Get("folder"); folder != "" {
+            abs := sanitizePath(r.Context(), folder)
+            if abs == "" {
+                apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+                return
+            }
+            if abs != scratchRoot(r.Context()) {
+                scope = relativeTo(r.Context(), abs) + "/"
+            }
+        }
+        notes, err := scanNotes(r.Context())
+        if err != nil {
+            writeStorageError(w, r, err, "scan notes", "Internal server error")
+            return
+        }
+        for _, note := range notes {
+            if strings.HasPrefix(note.Rel, scope) {
+                files = append(files, note)
+            }
+        }
+    }
+
+    report, err := scanSensitive(r.Context(), files, rules)
+    if err != nil {
+        writeStorageError(w, r, err, "scan for sensitive data", "Internal server error")
+        return
+    }
+    logInfo(r.Context(), fmt.Sprintf("Sensitive data report: %d findings in %d notes", len(report.Findings), report.Notes))
+    w.Header().Set("Content-Type", "application/json")
+    enc := json.NewEncoder(w)
+    enc.SetEscapeHTML(false)
+    enc.Encode(report)
+}
+
+// redactedName is the default sanitized copy: "<stem>.redacted<ext>".
+func redactedName(rel string) string {
+    ext := path.Ext(rel)
+    return strings.TrimSuffix(rel, ext) + ".redacted" + ext
+}
+
+// -------------------------------------------------------
+// func HandleSensitiveRedact(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /reports/sensitive/redact {"path", "target", "rules"}:
+//     write a copy of path with every finding replaced by
+//     [REDACTED:<rule>]; 201 {"source", "target", "redactions",
+//     "counts"}.
+// Audit:
+//   - target defaults to "<name>.redacted.<ext>" next to the note and
+//     must not exist (409); the name policy applies to it.
+//   - The copy is indexed and journalled like a save.
+// -------------------------------------------------------
+func HandleSensitiveRedact(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Path   string   `json:"path"`
+        Target string   `json:"target"`
+        Rules  []string `json:"rules"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    rules, ok := filterSensitiveRules(sensitiveRules(currentConfig(r.Context()).Sensitive), req.Rules)
+    if !ok {
+        writeFieldError(w, r, invalidField("rules", "must name configured detectors, patterns, or keyword"))
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Invalid file path requested: "+req.Path)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    source := relativeTo(r.Context(), absPath)
+
+    targetRel, policyErr := applyNamePolicy(defaultString(req.Target, redactedName(source)))
+    if policyErr != nil {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "target", "Invalid target path: "+policyErr.Error())
+        return
+    }
+    absTarget := sanitizePath(r.Context(), targetRel)
+    if absTarget == "" || !isNoteName(absTarget) || absTarget == absPath {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "target", "Invalid target path")
+        return
+    }
+    if rejectIfArchived(w, r, absTarget) {
+        return
+    }
+    ctx := r.Context()
+    if _, err := statPath(ctx, absTarget); err == nil {
+        apierror.Write(w, r, apierror.CodeConflict, "target", "Target already exists: "+targetRel)
+        return
+    }
+
+    content, err := readNote(ctx, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for redaction: "+absPath, "Internal error")
+        return
+    }
+    if len(content) > maxSearchFileBytes {
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Note exceeds %d bytes", maxSearchFileBytes))
+        return
+    }
+
+    var out strings.Builder
+    counts := map[string]int{}
+    matches := findSensitive(content, rules)
+    last := 0
+    for _, m := range matches {
+        out.Write(content[last:m.offset])
+        out.WriteString("[REDACTED:" + m.rule.name + "]")
+        last = m.offset + m.length
+        counts[m.rule.name]++
+    }
+    out.Write(content[last:])
+    redacted := []byte(out.String())
+
+    if err := mkdirAll(ctx, filepath.Dir(absTarget)); err != nil {
+        writeStorageError(w, r, err, "create folder for "+absTarget, "Write failed")
+        return
+    }
+    if err := writeFile(ctx, absTarget, redacted); err != nil {
+        writeStorageError(w, r, err, "save redacted copy: "+absTarget, "Write failed")
+        return
+    }
+    indexUpdate(ctx, targetRel, redacted)
+    journalPutEntry(ctx, targetRel, redacted)
+
+    logInfo(ctx, fmt.Sprintf("Wrote redacted copy of %s to %s: %d redactions", source, targetRel, len(matches)))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.redact",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusCreated,
+        Actor:    actorName(ctx),
+        Target:   targetRel,
+        Detail:   fmt.Sprintf("source=%s redactions=%d", source, len(matches)),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "source":     source,
+        "target":     targetRel,
+        "redactions": len(matches),
+        "counts":     counts,
+    })
+}
@@ -0,0 +1,190 @@
+// -------------------------------------------------------
+// backend/handlers/server.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Server: the dependencies the handlers run against (scratch
+//     root, configuration source, storage, logger, clock), built
+//     once with NewServer instead of being package-level globals.
+//   - Server.Handler puts the Server on each request context, so
+//     two Servers (e.g. OS-backed and in-memory) can serve side by
+//     side in one process.
+// Audit:
+//   - Everything that needs the root, clock, config, storage or
+//     logger takes a context and resolves the Server from it (path
+//     sanitizing and metadata paths included); nothing reads a
+//     process-wide Server on a request path.
+//   - Background jobs and CLI commands get Server.Context(). A
+//     context without a Server (tests) falls back to a Server built
+//     from the defaults.
+//   - Metadata lock registries (ledger, comments, journal, ...) are
+//     still per process; Servers sharing a Root share them safely,
+//     Servers with different Roots never contend on the same files.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "path/filepath"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/clock"
+    "cfo-scratchpad/config"
+)
+
+// DefaultRoot is the scratch root used when NewServer gets none.
+const DefaultRoot = "/scratchpad-data"
+
+// -------------------------------------------------------
+// type Logger
+// -------------------------------------------------------
+// Purpose:
+//   - Destination for handler log lines.
+// -------------------------------------------------------
+type Logger interface {
+    Info(msg string)
+    Error(msg string)
+}
+
+// -------------------------------------------------------
+// type StdoutLogger
+// -------------------------------------------------------
+// Purpose:
+//   - Default Logger: "[INFO]"/"[ERROR]" lines with a UTC
+//     timestamp on stdout, as the service has always logged.
+// Audit:
+//   - Timestamps come from Clock (the wall clock when nil).
+// -------------------------------------------------------
+type StdoutLogger struct {
+    Clock clock.Clock
+}
+
+// Info logs an informational event.
+func (l StdoutLogger) Info(msg string) {
+    fmt.Printf("[INFO] %s %s\n", l.stamp(), msg)
+}
+
+// Error logs an operational error.
+func (l StdoutLogger) Error(msg string) {
+    fmt.Printf("[ERROR] %s %s\n", l.stamp(), msg)
+}
+
+// stamp formats the current time of l's clock.
+func (l StdoutLogger) stamp() string {
+    clk := l.Clock
+    if clk == nil {
+        clk = clock.System{}
+    }
+    return clk.Now().UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// -------------------------------------------------------
+// type Server
+// -------------------------------------------------------
+// Purpose:
+//   - Everything a handler needs from its environment.
+// Audit:
+//   - Config is a function so reloads (config.Current) are seen
+//     without rebuilding the Server.
+// -------------------------------------------------------
+type Server struct {
+    Root    string
+    Config  func() *config.Config
+    Storage Storage
+    Logger  Logger
+    Clock   clock.Clock
+}
+
+// -------------------------------------------------------
+// func NewServer(root, cfg, store, logger, clk) *Server
+// -------------------------------------------------------
+// Purpose:
+//   - Build a Server rooted at root (DefaultRoot when empty); nil
+//     arguments take the defaults (config.Current, OSStorage on
+//     root, StdoutLogger and clock.System).
+// Audit:
+//   - root must be an absolute path; it is cleaned here, so
+//     relativeTo and the symlink checks compare like with like.
+// -------------------------------------------------------
+func NewServer(root string, cfg func() *config.Config, store Storage, logger Logger, clk clock.Clock) *Server {
+    if root == "" {
+        root = DefaultRoot
+    }
+    root = filepath.Clean(root)
+    if cfg == nil {
+        cfg = config.Current
+    }
+    if store == nil {
+        store = OSStorage{Root: root}
+    }
+    if clk == nil {
+        clk = clock.System{}
+    }
+    if logger == nil {
+        logger = StdoutLogger{Clock: clk}
+    }
+    return &Server{Root: root, Config: cfg, Storage: store, Logger: logger, Clock: clk}
+}
+
+// fallback is the Server for contexts that carry none.
+var (
+    fallbackOnce sync.Once
+    fallback     *Server
+)
+
+// defaultServer returns a Server built from the defaults.
+func defaultServer() *Server {
+    fallbackOnce.Do(func() { fallback = NewServer("", nil, nil, nil, nil) })
+    return fallback
+}
+
+type serverKey struct{}
+
+// -------------------------------------------------------
+// func (s *Server) Handler(next http.Handler) http.Handler
+// -------------------------------------------------------
+// Purpose:
+//   - Serve next with s on the request context.
+// -------------------------------------------------------
+func (s *Server) Handler(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), serverKey{}, s)))
+    })
+}
+
+// -------------------------------------------------------
+// func (s *Server) Context() context.Context
+// -------------------------------------------------------
+// Purpose:
+//   - A background context carrying s, for jobs and commands that
+//     run outside a request.
+// -------------------------------------------------------
+func (s *Server) Context() context.Context {
+    return context.WithValue(context.Background(), serverKey{}, s)
+}
+
+// serverFrom returns the Server on ctx, or the default.
+func serverFrom(ctx context.Context) *Server {
+    if s, ok := ctx.Value(serverKey{}).(*Server); ok {
+        return s
+    }
+    return defaultServer()
+}
+
+// scratchRoot returns the scratch root of the Server on ctx.
+func scratchRoot(ctx context.Context) string {
+    return serverFrom(ctx).Root
+}
+
+// timeNow reads the clock of the Server on ctx.
+func timeNow(ctx context.Context) time.Time {
+    return serverFrom(ctx).Clock.Now()
+}
+
+// currentConfig returns the configuration of the Server on ctx.
+func currentConfig(ctx context.Context) *config.Config {
+    return serverFrom(ctx).Config()
+}
@@ -0,0 +1,54 @@
+// -------------------------------------------------------
+// backend/handlers/server_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that paths and time resolve against the Server on the
+//     context, so two Servers can run side by side.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "cfo-scratchpad/clock"
+)
+
+func TestServerContextResolvesRootAndClock(t *testing.T) {
+    first := NewServer("/srv/first/", nil, nil, nil, clock.NewFixed(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+    second := NewServer("/srv/second", nil, nil, nil, clock.NewFixed(time.Date(2027, 6, 7, 8, 9, 10, 0, time.UTC)))
+
+    for _, tc := range []struct {
+        server     *Server
+        abs, stamp string
+    }{
+        {first, "/srv/first/close/q1.md", "2026-01-02T03:04:05Z"},
+        {second, "/srv/second/close/q1.md", "2027-06-07T08:09:10Z"},
+    } {
+        ctx := tc.server.Context()
+        if got := sanitizePath(ctx, "close/q1.md"); got != tc.abs {
+            t.Errorf("sanitizePath = %q, want %q", got, tc.abs)
+        }
+        if got := relativeTo(ctx, tc.abs); got != "close/q1.md" {
+            t.Errorf("relativeTo(%q) = %q", tc.abs, got)
+        }
+        if got := metaPath(ctx, "index.json"); got != tc.server.Root+"/.scratchpad/index.json" {
+            t.Errorf("metaPath = %q", got)
+        }
+        if got := utcNow(ctx); got != tc.stamp {
+            t.Errorf("utcNow = %q, want %q", got, tc.stamp)
+        }
+    }
+
+    var seen string
+    h := second.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        seen = sanitizePath(r.Context(), "a.md")
+    }))
+    h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/file?path=a.md", nil))
+    if seen != "/srv/second/a.md" {
+        t.Errorf("request through second.Handler resolved %q", seen)
+    }
+}
@@ -0,0 +1,637 @@
+// -------------------------------------------------------
+// backend/handlers/sessions.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Sign-in sessions: POST /auth/login exchanges the caller's
+//     configured token (plus a TOTP or recovery code when enrolled)
+//     for a session token; POST /auth/logout ends the session.
+//   - Session management:
+//       GET  /auth/sessions                 the caller's sessions
+//       POST /auth/sessions/revoke          end one or all of them
+//       GET  /admin/sessions?user=...       every user's sessions
+//       POST /admin/sessions/revoke         end by id or by user
+//   - Browser sessions: with {"cookie": true} login sets the token as
+//     an HttpOnly SameSite=Strict cookie instead of returning it,
+//     plus a CSRF cookie that the frontend echoes in X-CSRF-Token.
+//   - Sessions live in .scratchpad/keys/sessions.json (mode 0600),
+//     keyed by session ID with the SHA-256 of the token.
+// Audit:
+//   - Session tokens are shown once and never stored or logged.
+//   - The CSRF token is bound to its session (stored as SHA-256), so
+//     a cookie planted from elsewhere does not match.
+//   - A session ends sessions.idle_timeout after it was last used or
+//     sessions.absolute_lifetime after login, whichever comes first;
+//     both are read on every request, so a shorter setting applies
+//     to existing sessions at once. A session of a user no longer
+//     configured is refused.
+//   - Last use is written to disk at most once a minute per session.
+//   - Login, logout and revocation write "auth.login", "auth.logout",
+//     "auth.session_revoke" and "admin.session_revoke".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/auth"
+)
+
+// Cookie and header names of browser sessions.
+const (
+    SessionCookie = "scratchpad_session"
+    CSRFCookie    = "scratchpad_csrf"
+    CSRFHeader    = "X-CSRF-Token"
+)
+
+const (
+    sessionsFile        = "keys/sessions.json"
+    sessionSeenInterval = time.Minute
+    maxDeviceLength     = 200
+)
+
+var (
+    // sessionsMu guards sessions and sessions.json.
+    sessionsMu     sync.Mutex
+    sessions       map[string]*Session
+    sessionsLoaded bool
+)
+
+// -------------------------------------------------------
+// type Session
+// -------------------------------------------------------
+// Purpose:
+//   - One signed-in session of a user, as stored.
+// Audit:
+//   - Device is the User-Agent and IP the client address of the
+//     last request; MFA records that login presented a second
+//     factor; CSRFSHA256 is set for cookie sessions only.
+// -------------------------------------------------------
+type Session struct {
+    ID          string `json:"id"`
+    User        string `json:"user"`
+    TokenSHA256 string `json:"token_sha256"`
+    CSRFSHA256  string `json:"csrf_sha256,omitempty"`
+    CreatedAt   string `json:"created_at"`
+    LastSeen    string `json:"last_seen"`
+    IP          string `json:"ip"`
+    Device      string `json:"device"`
+    MFA         bool   `json:"mfa"`
+    Cookie      bool   `json:"cookie"`
+}
+
+// -------------------------------------------------------
+// type SessionInfo
+// -------------------------------------------------------
+// Purpose:
+//   - A session as listed by the API (no token hash); Current marks
+//     the session the request itself used.
+// -------------------------------------------------------
+type SessionInfo struct {
+    ID        string `json:"id"`
+    User      string `json:"user"`
+    Device    string `json:"device"`
+    IP        string `json:"ip"`
+    CreatedAt string `json:"created_at"`
+    LastSeen  string `json:"last_seen"`
+    ExpiresAt string `json:"expires_at"`
+    MFA       bool   `json:"mfa"`
+    Cookie    bool   `json:"cookie"`
+    Current   bool   `json:"current"`
+}
+
+// sessionStamp formats session times.
+func sessionStamp(t time.Time) string {
+    return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// sessionExpiry is when s ends under the lifetimes configured on ctx.
+func sessionExpiry(ctx context.Context, s *Session) time.Time {
+    cfg := currentConfig(ctx).Sessions
+    created, _ := time.Parse(time.RFC3339, s.CreatedAt)
+    seen, err := time.Parse(time.RFC3339, s.LastSeen)
+    if err != nil {
+        seen = created
+    }
+    end := created.Add(cfg.AbsoluteLifetime.Std())
+    if idle := seen.Add(cfg.IdleTimeout.Std()); idle.Before(end) {
+        end = idle
+    }
+    return end
+}
+
+// sessionsLocked loads sessions.json once. Caller holds sessionsMu.
+func sessionsLocked(ctx context.Context) (map[string]*Session, error) {
+    if sessionsLoaded {
+        return sessions, nil
+    }
+    loaded := map[string]*Session{}
+    if err := loadMetaJSON(ctx, sessionsFile, &loaded); err != nil {
+        return nil, err
+    }
+    if loaded == nil {
+        loaded = map[string]*Session{}
+    }
+    sessions, sessionsLoaded = loaded, true
+    return sessions, nil
+}
+
+// saveSessionsLocked writes sessions.json, dropping ended sessions.
+func saveSessionsLocked(ctx context.Context, now time.Time) error {
+    for id, s := range sessions {
+        if !now.Before(sessionExpiry(ctx, s)) {
+            delete(sessions, id)
+        }
+    }
+    data, err := json.MarshalIndent(sessions, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeMetaFilePerm(ctx, sessionsFile, data, 0600)
+}
+
+// clientDevice is the User-Agent of r, trimmed for storage.
+func clientDevice(r *http.Request) string {
+    device := strings.TrimSpace(r.UserAgent())
+    if len(device) > maxDeviceLength {
+        device = device[:maxDeviceLength]
+    }
+    return device
+}
+
+// clientAddr is the client address of r without the port; behind a
+// trusted proxy, IPAccessMiddleware has already put the client it
+// named in RemoteAddr.
+func clientAddr(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
+
+// -------------------------------------------------------
+// func SessionUser(r, token) (auth.User, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Resolve a session token to its user, with roles as currently
+//     configured, SessionID and MFA set; records the request as the
+//     session's last use.
+// -------------------------------------------------------
+func SessionUser(r *http.Request, token string) (auth.User, bool) {
+    hash := auth.HashToken(token)
+    now := timeNow(r.Context())
+
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    all, err := sessionsLocked(r.Context())
+    if err != nil {
+        logError(r.Context(), "Failed to load sessions: "+err.Error())
+        return auth.User{}, false
+    }
+    for _, s := range all {
+        if s.TokenSHA256 != hash || !now.Before(sessionExpiry(r.Context(), s)) {
+            continue
+        }
+        configured, ok := currentConfig(r.Context()).Users[s.User]
+        if !ok {
+            return auth.User{}, false
+        }
+
+        seen, _ := time.Parse(time.RFC3339, s.LastSeen)
+        ip, device := clientAddr(r), clientDevice(r)
+        if now.Sub(seen) >= sessionSeenInterval || s.IP != ip || s.Device != device {
+            s.LastSeen, s.IP, s.Device = sessionStamp(now), ip, device
+            if err := saveSessionsLocked(r.Context(), now); err != nil {
+                logError(r.Context(), "Failed to save sessions: "+err.Error())
+            }
+        }
+        return auth.User{
+            Name:      s.User,
+            Roles:     append([]string{}, configured.Roles...),
+            SessionID: s.ID,
+            MFA:       s.MFA,
+        }, true
+    }
+    return auth.User{}, false
+}
+
+// -------------------------------------------------------
+// func SessionCSRFValid(ctx context.Context, sessionID, presented string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether presented is the CSRF token of a cookie
+//     session; always false for sessions without one.
+// -------------------------------------------------------
+func SessionCSRFValid(ctx context.Context, sessionID string, presented string) bool {
+    if presented == "" {
+        return false
+    }
+    hash := auth.HashToken(presented)
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    all, err := sessionsLocked(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load sessions: "+err.Error())
+        return false
+    }
+    s, ok := all[sessionID]
+    return ok && s.CSRFSHA256 != "" && subtle.ConstantTimeCompare([]byte(s.CSRFSHA256), []byte(hash)) == 1
+}
+
+// -------------------------------------------------------
+// func setSessionCookies(w, r, token, csrf, maxAge)
+// -------------------------------------------------------
+// Purpose:
+//   - Set (or, with maxAge < 0, clear) the session and CSRF cookies.
+// Audit:
+//   - Secure is set over TLS (or a trusted X-Forwarded-Proto).
+// -------------------------------------------------------
+func setSessionCookies(w http.ResponseWriter, r *http.Request, token string, csrf string, maxAge int) {
+    secure := r.TLS != nil || (currentConfig(r.Context()).SecurityHeaders.TrustForwardedProto &&
+        strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"))
+    http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: token, Path: "/", MaxAge: maxAge,
+        HttpOnly: true, Secure: secure, SameSite: http.SameSiteStrictMode})
+    http.SetCookie(w, &http.Cookie{Name: CSRFCookie, Value: csrf, Path: "/", MaxAge: maxAge,
+        Secure: secure, SameSite: http.SameSiteStrictMode})
+}
+
+// -------------------------------------------------------
+// func ClearSessionCookies(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Tell the browser to drop the session and CSRF cookies.
+// -------------------------------------------------------
+func ClearSessionCookies(w http.ResponseWriter, r *http.Request) {
+    setSessionCookies(w, r, "", "", -1)
+}
+
+// -------------------------------------------------------
+// func listSessions(ctx context.Context, user, current string) ([]SessionInfo, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Live sessions of user (all users when empty), most recently
+//     used first.
+// -------------------------------------------------------
+func listSessions(ctx context.Context, user string, current string) ([]SessionInfo, error) {
+    now := timeNow(ctx)
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    all, err := sessionsLocked(ctx)
+    if err != nil {
+        return nil, err
+    }
+    list := []SessionInfo{}
+    for _, s := range all {
+        expires := sessionExpiry(ctx, s)
+        if (user != "" && s.User != user) || !now.Before(expires) {
+            continue
+        }
+        list = append(list, SessionInfo{
+            ID:        s.ID,
+            User:      s.User,
+            Device:    s.Device,
+            IP:        s.IP,
+            CreatedAt: s.CreatedAt,
+            LastSeen:  s.LastSeen,
+            ExpiresAt: sessionStamp(expires),
+            MFA:       s.MFA,
+            Cookie:    s.Cookie,
+            Current:   s.ID == current,
+        })
+    }
+    sort.Slice(list, func(i, j int) bool {
+        if list[i].LastSeen != list[j].LastSeen {
+            return list[i].LastSeen > list[j].LastSeen
+        }
+        return list[i].ID < list[j].ID
+    })
+    return list, nil
+}
+
+// -------------------------------------------------------
+// func revokeSessions(ctx, now, match) ([]string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - End every session match selects; returns their IDs, sorted.
+// -------------------------------------------------------
+func revokeSessions(ctx context.Context, now time.Time, match func(s *Session) bool) ([]string, error) {
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    all, err := sessionsLocked(ctx)
+    if err != nil {
+        return nil, err
+    }
+    revoked := []string{}
+    for id, s := range all {
+        if match(s) {
+            revoked = append(revoked, id)
+            delete(all, id)
+        }
+    }
+    sort.Strings(revoked)
+    if len(revoked) == 0 {
+        return revoked, nil
+    }
+    return revoked, saveSessionsLocked(ctx, now)
+}
+
+// -------------------------------------------------------
+// func HandleLogin(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/login {"code"} or {"recovery_code"}: open a session
+//     and answer {"token", "session_id", "expires_at", "mfa"}.
+//   - With "cookie": true the token is set as the session cookie
+//     and the answer has "csrf_token" instead of "token".
+// Audit:
+//   - Users with a confirmed second factor must present it; users
+//     whose role requires MFA but who have not enrolled get 403
+//     mfa_required.
+//   - expires_at is the absolute end; unused sessions end earlier.
+// -------------------------------------------------------
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+        Cookie       bool   `json:"cookie"`
+    }
+    if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+        return
+    }
+
+    mfa := TOTPEnrolled(r.Context(), user.Name)
+    if mfa {
+        if !checkSecondFactor(w, r, user.Name, req.Code, req.RecoveryCode) {
+            return
+        }
+    } else if auth.MFARequired(currentConfig(r.Context()), user) {
+        auditAuth(r, "auth.mfa_required", http.StatusForbidden, user.Name, "login without enrolled second factor")
+        apierror.Write(w, r, apierror.CodeMFARequired, "", "Two-factor authentication required: enroll at /auth/totp/enroll first")
+        return
+    }
+
+    now := timeNow(r.Context()).UTC()
+    token := auth.NewToken()
+    csrf := ""
+    if req.Cookie {
+        csrf = auth.NewToken()
+    }
+    session := &Session{
+        ID:          auth.NewToken()[:16],
+        User:        user.Name,
+        TokenSHA256: auth.HashToken(token),
+        CreatedAt:   sessionStamp(now),
+        LastSeen:    sessionStamp(now),
+        IP:          clientAddr(r),
+        Device:      clientDevice(r),
+        MFA:         mfa,
+        Cookie:      req.Cookie,
+    }
+    if req.Cookie {
+        session.CSRFSHA256 = auth.HashToken(csrf)
+    }
+
+    sessionsMu.Lock()
+    all, err := sessionsLocked(r.Context())
+    if err == nil {
+        all[session.ID] = session
+        if err = saveSessionsLocked(r.Context(), now); err != nil {
+            delete(all, session.ID)
+        }
+    }
+    sessionsMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "save session for "+user.Name, "Internal server error")
+        return
+    }
+
+    auditAuth(r, "auth.login", http.StatusOK, session.ID, "mfa="+strconv.FormatBool(mfa)+" cookie="+strconv.FormatBool(req.Cookie))
+    logInfo(r.Context(), "Session opened for "+user.Name)
+    lifetime := currentConfig(r.Context()).Sessions.AbsoluteLifetime.Std()
+    resp := map[string]interface{}{
+        "session_id": session.ID,
+        "expires_at": sessionStamp(now.Add(lifetime)),
+        "mfa":        mfa,
+    }
+    if req.Cookie {
+        setSessionCookies(w, r, token, csrf, int(lifetime/time.Second))
+        resp["csrf_token"] = csrf
+    } else {
+        resp["token"] = token
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// -------------------------------------------------------
+// func HandleLogout(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/logout: end the session whose token was used.
+// -------------------------------------------------------
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    if user.SessionID == "" {
+        apierror.Write(w, r, apierror.CodeInvalidField, "", "Bad request: not signed in with a session token")
+        return
+    }
+
+    _, err := revokeSessions(r.Context(), timeNow(r.Context()), func(s *Session) bool { return s.ID == user.SessionID })
+    if err != nil {
+        writeStorageError(w, r, err, "end session of "+user.Name, "Internal server error")
+        return
+    }
+
+    auditAuth(r, "auth.logout", http.StatusOK, user.SessionID, "")
+    ClearSessionCookies(w, r)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"ended": user.SessionID})
+}
+
+// -------------------------------------------------------
+// func HandleSessions(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /auth/sessions: the caller's live sessions with device,
+//     IP, last use and end; "current" marks the one in use.
+// -------------------------------------------------------
+func HandleSessions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    list, err := listSessions(r.Context(), user.Name, user.SessionID)
+    if err != nil {
+        writeStorageError(w, r, err, "list sessions of "+user.Name, "Internal server error")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"items": list})
+}
+
+// -------------------------------------------------------
+// func HandleSessionRevoke(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/sessions/revoke {"id"}: end one of the caller's
+//     sessions; {"others": true}: end all but the current one;
+//     {"all": true}: end all of them.
+// Audit:
+//   - Writes "auth.session_revoke" with the IDs ended; 404 when id
+//     is not a live session of the caller.
+// -------------------------------------------------------
+func HandleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        ID     string `json:"id"`
+        Others bool   `json:"others"`
+        All    bool   `json:"all"`
+    }
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    selected := 0
+    for _, set := range []bool{req.ID != "", req.Others, req.All} {
+        if set {
+            selected++
+        }
+    }
+    if selected != 1 {
+        apierror.Write(w, r, apierror.CodeInvalidField, "", `Bad request: give exactly one of "id", "others" or "all"`)
+        return
+    }
+
+    revoked, err := revokeSessions(r.Context(), timeNow(r.Context()), func(s *Session) bool {
+        switch {
+        case s.User != user.Name:
+            return false
+        case req.Others:
+            return s.ID != user.SessionID
+        case req.All:
+            return true
+        }
+        return s.ID == req.ID
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "revoke sessions of "+user.Name, "Internal server error")
+        return
+    }
+    if req.ID != "" && len(revoked) == 0 {
+        apierror.Write(w, r, apierror.CodeNotFound, "id", "No such session: "+req.ID)
+        return
+    }
+
+    auditAuth(r, "auth.session_revoke", http.StatusOK, user.Name, fmt.Sprintf("revoked=%s", strings.Join(revoked, ",")))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"revoked": revoked})
+}
+
+// -------------------------------------------------------
+// func HandleAdminSessions(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/sessions?user=...: live sessions of every user (or
+//     one), most recently used first.
+// -------------------------------------------------------
+func HandleAdminSessions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    list, err := listSessions(r.Context(), r.URL.Query().Get("user"), "")
+    if err != nil {
+        writeStorageError(w, r, err, "list sessions", "Internal server error")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"items": list})
+}
+
+// -------------------------------------------------------
+// func HandleAdminSessionRevoke(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/sessions/revoke {"id"} or {"user"}: end one
+//     session, or every session of a user.
+// Audit:
+//   - Writes "admin.session_revoke"; 404 when nothing matched.
+// -------------------------------------------------------
+func HandleAdminSessionRevoke(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        ID   string `json:"id"`
+        User string `json:"user"`
+    }
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if (req.ID == "") == (req.User == "") {
+        apierror.Write(w, r, apierror.CodeInvalidField, "", `Bad request: give exactly one of "id" or "user"`)
+        return
+    }
+
+    revoked, err := revokeSessions(r.Context(), timeNow(r.Context()), func(s *Session) bool {
+        return s.ID == req.ID || s.User == req.User
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "revoke sessions", "Internal server error")
+        return
+    }
+    if len(revoked) == 0 {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "No matching sessions")
+        return
+    }
+
+    auditAuth(r, "admin.session_revoke", http.StatusOK, defaultString(req.User, req.ID), fmt.Sprintf("revoked=%s", strings.Join(revoked, ",")))
+    logInfo(r.Context(), fmt.Sprintf("Admin revoked %d sessions", len(revoked)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"revoked": revoked})
+}
@@ -0,0 +1,378 @@
+// -------------------------------------------------------
+// backend/handlers/signatures.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Digital sign-off on notes (lightweight memo approval):
+//       POST /file/sign {"path", "comment"}  sign the current content
+//       GET  /file/signatures?path=...       signatures + verification
+//   - Each user gets a server-managed Ed25519 key pair, created on
+//     first signature (.scratchpad/keys/<user>.json, mode 0600).
+//   - Signatures live in .scratchpad/signatures.json (path -> list).
+// Audit:
+//   - The signed statement binds user, content SHA-256, and time:
+//       "cfo-scratchpad signature v1\n<user>\n<sha256>\n<signed_at>"
+//     so a signature stays valid when the note is moved but not when
+//     its content changes.
+//   - Verification reports both cryptographic validity and whether
+//     the note still has the signed content; saving a signed note
+//     writes "file.signed_modified".
+//   - Signing writes "file.sign".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    signaturesFile   = "signatures.json"
+    signingKeysDir   = "keys"
+    signaturePreface = "cfo-scratchpad signature v1"
+)
+
+// signaturesMu guards signatures.json and the key directory.
+var signaturesMu sync.Mutex
+
+// -------------------------------------------------------
+// type Signature
+// -------------------------------------------------------
+// Purpose:
+//   - One user's signature over one version of a note.
+// -------------------------------------------------------
+type Signature struct {
+    User      string `json:"user"`
+    SHA256    string `json:"sha256"`
+    SignedAt  string `json:"signed_at"`
+    Comment   string `json:"comment,omitempty"`
+    PublicKey string `json:"public_key"`
+    Signature string `json:"signature"`
+}
+
+// -------------------------------------------------------
+// type SignatureStatus
+// -------------------------------------------------------
+// Purpose:
+//   - A signature plus its verification result.
+// Audit:
+//   - Valid: the signature verifies against the stated key.
+//   - Current: the note still has the signed content.
+// -------------------------------------------------------
+type SignatureStatus struct {
+    Signature
+    Valid   bool `json:"valid"`
+    Current bool `json:"current"`
+}
+
+// signingKey is the on-disk form of a user's key pair.
+type signingKey struct {
+    User       string `json:"user"`
+    PublicKey  string `json:"public_key"`
+    PrivateKey string `json:"private_key"`
+    CreatedAt  string `json:"created_at"`
+}
+
+// signedStatement is the exact message a signature covers.
+func signedStatement(user, sha256, signedAt string) []byte {
+    return []byte(signaturePreface + "\n" + user + "\n" + sha256 + "\n" + signedAt)
+}
+
+// -------------------------------------------------------
+// func loadSignaturesLocked() map[string][]Signature
+// -------------------------------------------------------
+// Purpose:
+//   - Read signatures.json. Caller holds signaturesMu.
+// -------------------------------------------------------
+func loadSignaturesLocked(ctx context.Context) map[string][]Signature {
+    signatures := map[string][]Signature{}
+    if err := loadMetaJSON(ctx, signaturesFile, &signatures); err != nil {
+        logError(ctx, "Failed to load signatures: "+err.Error())
+    }
+    if signatures == nil {
+        signatures = map[string][]Signature{}
+    }
+    return signatures
+}
+
+// -------------------------------------------------------
+// func userSigningKeyLocked(ctx context.Context, user string) (ed25519.PrivateKey, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Load the user's private key, generating it on first use.
+//     Caller holds signaturesMu.
+// -------------------------------------------------------
+func userSigningKeyLocked(ctx context.Context, user string) (ed25519.PrivateKey, error) {
+    name := filepath.Join(signingKeysDir, user+".json")
+    var stored signingKey
+    if err := loadMetaJSON(ctx, name, &stored); err != nil {
+        return nil, err
+    }
+    if stored.PrivateKey != "" {
+        seed, err := base64.StdEncoding.DecodeString(stored.PrivateKey)
+        if err != nil || len(seed) != ed25519.SeedSize {
+            return nil, fmt.Errorf("signing key for %s is corrupt", user)
+        }
+        return ed25519.NewKeyFromSeed(seed), nil
+    }
+
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    stored = signingKey{
+        User:       user,
+        PublicKey:  base64.StdEncoding.EncodeToString(public),
+        PrivateKey: base64.StdEncoding.EncodeToString(private.Seed()),
+        CreatedAt:  utcNow(ctx),
+    }
+    data, err := json.MarshalIndent(stored, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    if err := writeMetaFilePerm(ctx, name, data, 0600); err != nil {
+        return nil, err
+    }
+    logInfo(ctx, "Created signing key for user "+user)
+    return private, nil
+}
+
+// -------------------------------------------------------
+// func verifySignature(sig Signature) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Check sig against its embedded public key.
+// -------------------------------------------------------
+func verifySignature(sig Signature) bool {
+    public, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+    if err != nil || len(public) != ed25519.PublicKeySize {
+        return false
+    }
+    raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+    if err != nil {
+        return false
+    }
+    return ed25519.Verify(public, signedStatement(sig.User, sig.SHA256, sig.SignedAt), raw)
+}
+
+// -------------------------------------------------------
+// func signaturesRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Move a note's signatures along with it.
+// -------------------------------------------------------
+func signaturesRename(ctx context.Context, from, to string) {
+    signaturesMu.Lock()
+    defer signaturesMu.Unlock()
+    signatures := loadSignaturesLocked(ctx)
+    list, ok := signatures[from]
+    if !ok {
+        return
+    }
+    delete(signatures, from)
+    signatures[to] = list
+    if err := saveMetaJSON(ctx, signaturesFile, signatures); err != nil {
+        logError(ctx, "Failed to move signatures "+from+" -> "+to+": "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func flagSignedChange(r, rel, content)
+// -------------------------------------------------------
+// Purpose:
+//   - After a save, audit that a signed note no longer matches any
+//     of its signatures.
+// -------------------------------------------------------
+func flagSignedChange(r *http.Request, rel string, content []byte) {
+    signaturesMu.Lock()
+    list := loadSignaturesLocked(r.Context())[rel]
+    signaturesMu.Unlock()
+    if len(list) == 0 {
+        return
+    }
+
+    hash := contentHash(content)
+    signers := []string{}
+    for _, sig := range list {
+        if sig.SHA256 == hash {
+            return
+        }
+        signers = append(signers, sig.User)
+    }
+    logInfo(r.Context(), "Signed note modified after signing: "+rel)
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.signed_modified",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Target:   rel,
+        Detail:   "signatures no longer match content; signed by " + strings.Join(signers, ", "),
+    })
+}
+
+// -------------------------------------------------------
+// func HandleFileSign(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/sign {"path", "comment"}: sign the note's current
+//     content as the calling user.
+// Audit:
+//   - Requires a user token (401 otherwise).
+//   - Signing the same content twice returns the existing signature.
+// -------------------------------------------------------
+func HandleFileSign(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        Path    string `json:"path"`
+        Comment string `json:"comment"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    if len(req.Comment) > 1000 {
+        apierror.Write(w, r, apierror.CodeInvalidField, "comment", "Bad request: comment exceeds 1000 bytes")
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    content, err := readFile(r.Context(), absPath)
+    if os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "read file to sign: "+absPath, "Internal error")
+        return
+    }
+    hash := contentHash(content)
+
+    signaturesMu.Lock()
+    defer signaturesMu.Unlock()
+
+    signatures := loadSignaturesLocked(r.Context())
+    for _, existing := range signatures[rel] {
+        if existing.User == user.Name && existing.SHA256 == hash {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(existing)
+            return
+        }
+    }
+
+    private, err := userSigningKeyLocked(r.Context(), user.Name)
+    if err != nil {
+        writeStorageError(w, r, err, "load signing key for "+user.Name, "Signing failed")
+        return
+    }
+    sig := Signature{
+        User:      user.Name,
+        SHA256:    hash,
+        SignedAt:  utcNow(r.Context()),
+        Comment:   req.Comment,
+        PublicKey: base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)),
+    }
+    sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, signedStatement(sig.User, sig.SHA256, sig.SignedAt)))
+
+    signatures[rel] = append(signatures[rel], sig)
+    if err := saveMetaJSON(r.Context(), signaturesFile, signatures); err != nil {
+        writeStorageError(w, r, err, "save signatures", "Signing failed")
+        return
+    }
+
+    logInfo(r.Context(), "Signed "+absPath+" as "+user.Name)
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.sign",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    user.Name,
+        Target:   rel,
+        Detail:   "sha256=" + hash,
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(sig)
+}
+
+// -------------------------------------------------------
+// func HandleFileSignatures(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/signatures?path=: signatures of a note, each
+//     verified, plus "modified" when the content changed since
+//     any signature.
+// Audit:
+//   - Always returns an array for signatures ([] when unsigned).
+// -------------------------------------------------------
+func HandleFileSignatures(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    file := r.URL.Query().Get("path")
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+
+    hash := ""
+    content, err := readFile(r.Context(), absPath)
+    if err == nil {
+        hash = contentHash(content)
+    } else if !os.IsNotExist(err) {
+        writeStorageError(w, r, err, "read file for verification: "+absPath, "Internal error")
+        return
+    }
+
+    signaturesMu.Lock()
+    list := loadSignaturesLocked(r.Context())[rel]
+    signaturesMu.Unlock()
+
+    statuses := make([]SignatureStatus, 0, len(list))
+    modified := false
+    for _, sig := range list {
+        status := SignatureStatus{Signature: sig, Valid: verifySignature(sig), Current: sig.SHA256 == hash}
+        if !status.Current {
+            modified = true
+        }
+        statuses = append(statuses, status)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":       rel,
+        "sha256":     hash,
+        "modified":   modified,
+        "signatures": statuses,
+    })
+}
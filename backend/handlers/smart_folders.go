@@ -0,0 +1,513 @@
+// -------------------------------------------------------
+// backend/handlers/smart_folders.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Smart folders: named, saved searches per user, evaluated live
+//     whenever they are opened:
+//       GET    /folders?type=smart              the caller's smart folders
+//       POST   /folders?type=smart {name,query} create or replace one
+//       DELETE /folders?type=smart&name=...     remove one
+//       GET    /files?smart=<name>              notes matching it now
+//   - A query combines text (as in /search), #tags, a folder scope,
+//     and a modification date range (absolute or relative, e.g.
+//     "this_quarter").
+//   - Stored in .scratchpad/smart-folders/<user>.json.
+// Audit:
+//   - Requires a user token (401 otherwise).
+//   - Queries are validated when saved (pattern compiles, tags and
+//     dates well-formed) so opening a smart folder cannot fail on
+//     its own definition.
+//   - Saves and deletes write "smart_folder.save" /
+//     "smart_folder.delete" with the actor.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "path"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    smartFoldersDirName  = "smart-folders"
+    maxSmartFolders      = 50
+    maxSmartFolderBytes  = 8 << 10
+    maxSmartFolderTags   = 20
+    smartFolderDateStamp = "2006-01-02"
+)
+
+// smartFoldersMu guards the smart folder files.
+var smartFoldersMu sync.Mutex
+
+// Relative date ranges accepted in SmartQuery.Range.
+var smartRanges = []string{"today", "last_7_days", "last_30_days", "this_month", "this_quarter", "this_year"}
+
+var (
+    // smartNamePattern is what a smart folder may be called.
+    smartNamePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} ._-]{0,63}$`)
+
+    // smartTagPattern is a tag without its leading '#'.
+    smartTagPattern = regexp.MustCompile(`^[\p{L}\p{N}_][\p{L}\p{N}_/-]{0,63}$`)
+
+    // noteTagPattern finds the hashtags of a note (group 1).
+    noteTagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#/&])#([\p{L}\p{N}_][\p{L}\p{N}_/-]{0,63})`)
+)
+
+// -------------------------------------------------------
+// type SmartQuery / SmartFolder
+// -------------------------------------------------------
+// Purpose:
+//   - A saved search and its name.
+// Audit:
+//   - Text, Mode, and Case behave as q, mode, and case on /search.
+//   - Tags must all appear in the note as hashtags (#tag, case-
+//     insensitive).
+//   - From/To (YYYY-MM-DD, inclusive, UTC) or Range bound the
+//     note's modification time; Range is resolved when opened.
+// -------------------------------------------------------
+type SmartQuery struct {
+    Text   string   `json:"text,omitempty"`
+    Mode   string   `json:"mode,omitempty"`
+    Case   bool     `json:"case,omitempty"`
+    Tags   []string `json:"tags,omitempty"`
+    Folder string   `json:"folder,omitempty"`
+    From   string   `json:"from,omitempty"`
+    To     string   `json:"to,omitempty"`
+    Range  string   `json:"range,omitempty"`
+}
+
+type SmartFolder struct {
+    Name      string     `json:"name"`
+    Query     SmartQuery `json:"query"`
+    UpdatedAt string     `json:"updated_at"`
+}
+
+// smartFoldersName is the metadata file of a user's smart folders.
+func smartFoldersName(user string) string {
+    return filepath.Join(smartFoldersDirName, user+".json")
+}
+
+// -------------------------------------------------------
+// func loadSmartFoldersLocked(ctx context.Context, user string) []SmartFolder
+// -------------------------------------------------------
+// Purpose:
+//   - The user's smart folders sorted by name.
+//     Caller holds smartFoldersMu.
+// -------------------------------------------------------
+func loadSmartFoldersLocked(ctx context.Context, user string) []SmartFolder {
+    folders := []SmartFolder{}
+    if err := loadMetaJSON(ctx, smartFoldersName(user), &folders); err != nil {
+        logError(ctx, "Failed to load smart folders for "+user+": "+err.Error())
+        return []SmartFolder{}
+    }
+    if folders == nil {
+        folders = []SmartFolder{}
+    }
+    sort.Slice(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+    return folders
+}
+
+// findSmartFolder returns the caller's smart folder called name.
+func findSmartFolder(ctx context.Context, user, name string) (SmartFolder, bool) {
+    smartFoldersMu.Lock()
+    defer smartFoldersMu.Unlock()
+    for _, folder := range loadSmartFoldersLocked(ctx, user) {
+        if folder.Name == name {
+            return folder, true
+        }
+    }
+    return SmartFolder{}, false
+}
+
+// -------------------------------------------------------
+// func validateSmartQuery(ctx context.Context, q SmartQuery) error
+// -------------------------------------------------------
+// Purpose:
+//   - Reject queries that could never be evaluated.
+// Audit:
+//   - Errors are *fieldError naming the offending query field.
+// -------------------------------------------------------
+func validateSmartQuery(ctx context.Context, q SmartQuery) error {
+    if len(q.Text) > maxSearchQueryBytes {
+        return invalidField("query.text", "exceeds %d bytes", maxSearchQueryBytes)
+    }
+    if q.Mode != "" && !oneOf(q.Mode, []string{searchSubstring, searchRegex, searchWord}) {
+        return invalidField("query.mode", "must be substring, regex, or word")
+    }
+    if q.Text != "" {
+        re, err := regexp.Compile(searchPattern(q.Text, defaultString(q.Mode, searchSubstring), q.Case))
+        if err != nil {
+            return invalidField("query.text", "is not a valid pattern: %v", err)
+        }
+        if re.MatchString("") {
+            return invalidField("query.text", "matches the empty string")
+        }
+    }
+    if len(q.Tags) > maxSmartFolderTags {
+        return invalidField("query.tags", "allows at most %d tags", maxSmartFolderTags)
+    }
+    for _, tag := range q.Tags {
+        if !smartTagPattern.MatchString(strings.TrimPrefix(tag, "#")) {
+            return invalidField("query.tags", "%q is not a valid tag", tag)
+        }
+    }
+    if q.Folder != "" && sanitizePath(ctx, q.Folder) == "" {
+        return invalidField("query.folder", "is not a valid folder path")
+    }
+    for field, value := range map[string]string{"query.from": q.From, "query.to": q.To} {
+        if value == "" {
+            continue
+        }
+        if _, err := time.Parse(smartFolderDateStamp, value); err != nil {
+            return invalidField(field, "must be a date (YYYY-MM-DD)")
+        }
+    }
+    if q.From != "" && q.To != "" && q.From > q.To {
+        return invalidField("query.from", "is after query.to")
+    }
+    if q.Range != "" {
+        if !oneOf(q.Range, smartRanges) {
+            return invalidField("query.range", "must be one of %v", smartRanges)
+        }
+        if q.From != "" || q.To != "" {
+            return invalidField("query.range", "cannot be combined with from/to")
+        }
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func smartDateBounds(q, now) (time.Time, time.Time)
+// -------------------------------------------------------
+// Purpose:
+//   - Half-open modification window [start, end) of a query; zero
+//     values mean unbounded.
+// Audit:
+//   - Relative ranges are calendar-based in UTC ("this_quarter" on
+//     2025-05-10 is 2025-04-01 up to now).
+// -------------------------------------------------------
+func smartDateBounds(q SmartQuery, now time.Time) (time.Time, time.Time) {
+    now = now.UTC()
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+    var start, end time.Time
+    switch q.Range {
+    case "today":
+        start = today
+    case "last_7_days":
+        start = today.AddDate(0, 0, -6)
+    case "last_30_days":
+        start = today.AddDate(0, 0, -29)
+    case "this_month":
+        start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+    case "this_quarter":
+        start = time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+    case "this_year":
+        start = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+    }
+    if q.From != "" {
+        start, _ = time.Parse(smartFolderDateStamp, q.From)
+    }
+    if q.To != "" {
+        to, _ := time.Parse(smartFolderDateStamp, q.To)
+        end = to.AddDate(0, 0, 1)
+    }
+    return start, end
+}
+
+// tagPattern matches #tag as a whole hashtag, ignoring case.
+func tagPattern(tag string) *regexp.Regexp {
+    tag = strings.TrimPrefix(tag, "#")
+    return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_#/&])#` + regexp.QuoteMeta(tag) + `(?:$|[^\p{L}\p{N}_/-])`)
+}
+
+// noteTags returns the hashtags of a note, lowercased, sorted and
+// without duplicates; nil when it has none.
+func noteTags(data []byte) []string {
+    var tags []string
+    seen := map[string]bool{}
+    for _, match := range noteTagPattern.FindAllSubmatch(data, -1) {
+        tag := strings.ToLower(string(match[1]))
+        if !seen[tag] {
+            seen[tag] = true
+            tags = append(tags, tag)
+        }
+    }
+    sort.Strings(tags)
+    return tags
+}
+
+// -------------------------------------------------------
+// func evaluateSmartQuery(ctx, q) ([]string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Paths of the notes matching q now, sorted.
+// Audit:
+//   - Filters cheapest first (scope, dates) and reads a note only
+//     if text or tags must be checked.
+// -------------------------------------------------------
+func evaluateSmartQuery(ctx context.Context, q SmartQuery) ([]string, error) {
+    var text *regexp.Regexp
+    if q.Text != "" {
+        re, err := compileSearch(ctx, searchPattern(q.Text, defaultString(q.Mode, searchSubstring), q.Case))
+        if err != nil {
+            return nil, err
+        }
+        text = re
+    }
+    tags := []*regexp.Regexp{}
+    for _, tag := range q.Tags {
+        tags = append(tags, tagPattern(tag))
+    }
+    scope := ""
+    if q.Folder != "" {
+        scope = relativeTo(ctx, sanitizePath(ctx, q.Folder)) + "/"
+    }
+    start, end := smartDateBounds(q, timeNow(ctx))
+
+    notes, err := scanNotes(ctx)
+    if err != nil {
+        return nil, err
+    }
+    paths := []string{}
+    for _, note := range notes {
+        if scope != "" && !strings.HasPrefix(note.Rel, scope) {
+            continue
+        }
+        if (!start.IsZero() && note.ModTime.Before(start)) || (!end.IsZero() && !note.ModTime.Before(end)) {
+            continue
+        }
+        if text != nil || len(tags) > 0 {
+            if note.Size > maxSearchFileBytes {
+                continue
+            }
+            content, err := readFile(ctx, note.Abs)
+            if err != nil {
+                return nil, err
+            }
+            if text != nil && !text.Match(content) {
+                continue
+            }
+            matched := true
+            for _, tag := range tags {
+                if !tag.Match(content) {
+                    matched = false
+                    break
+                }
+            }
+            if !matched {
+                continue
+            }
+        }
+        paths = append(paths, note.Rel)
+    }
+    sort.Strings(paths)
+    return paths, nil
+}
+
+// -------------------------------------------------------
+// func handleSmartFolders(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /folders?type=smart: list, save, or delete smart folders.
+// -------------------------------------------------------
+func handleSmartFolders(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    switch r.Method {
+    case http.MethodGet:
+        smartFoldersMu.Lock()
+        folders := loadSmartFoldersLocked(r.Context(), user.Name)
+        smartFoldersMu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(folders)
+
+    case http.MethodPost:
+        var folder SmartFolder
+        dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSmartFolderBytes))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(&folder); err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Smart folder exceeds %d bytes", maxSmartFolderBytes))
+                return
+            }
+            writeJSONError(w, r, err)
+            return
+        }
+        if !requireField(w, r, "name", folder.Name) {
+            return
+        }
+        if !smartNamePattern.MatchString(folder.Name) {
+            writeFieldError(w, r, invalidField("name", "must be 1-64 letters, digits, spaces, '.', '_' or '-'"))
+            return
+        }
+        if err := validateSmartQuery(r.Context(), folder.Query); err != nil {
+            writeFieldError(w, r, err)
+            return
+        }
+        folder.UpdatedAt = utcNow(r.Context())
+
+        smartFoldersMu.Lock()
+        defer smartFoldersMu.Unlock()
+        folders := loadSmartFoldersLocked(r.Context(), user.Name)
+        replaced := false
+        for i := range folders {
+            if folders[i].Name == folder.Name {
+                folders[i] = folder
+                replaced = true
+            }
+        }
+        if !replaced {
+            if len(folders) >= maxSmartFolders {
+                writeFieldError(w, r, invalidField("name", "would exceed %d smart folders", maxSmartFolders))
+                return
+            }
+            folders = append(folders, folder)
+        }
+        if err := saveMetaJSON(r.Context(), smartFoldersName(user.Name), folders); err != nil {
+            writeStorageError(w, r, err, "save smart folders for "+user.Name, "Save failed")
+            return
+        }
+        touchListing()
+
+        logInfo(r.Context(), "Saved smart folder "+folder.Name+" for "+user.Name)
+        auditSmartFolder(r, "smart_folder.save", user.Name, folder.Name)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(folder)
+
+    case http.MethodDelete:
+        name := r.URL.Query().Get("name")
+        if !requireField(w, r, "name", name) {
+            return
+        }
+        smartFoldersMu.Lock()
+        defer smartFoldersMu.Unlock()
+        folders := loadSmartFoldersLocked(r.Context(), user.Name)
+        kept := []SmartFolder{}
+        for _, folder := range folders {
+            if folder.Name != name {
+                kept = append(kept, folder)
+            }
+        }
+        if len(kept) == len(folders) {
+            apierror.Write(w, r, apierror.CodeNotFound, "name", "Smart folder not found")
+            return
+        }
+        if err := saveMetaJSON(r.Context(), smartFoldersName(user.Name), kept); err != nil {
+            writeStorageError(w, r, err, "save smart folders for "+user.Name, "Delete failed")
+            return
+        }
+        touchListing()
+
+        logInfo(r.Context(), "Deleted smart folder "+name+" for "+user.Name)
+        auditSmartFolder(r, "smart_folder.delete", user.Name, name)
+        w.WriteHeader(http.StatusNoContent)
+
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func handleSmartFileList(w, r, name)
+// -------------------------------------------------------
+// Purpose:
+//   - /files?smart=<name>: the notes the smart folder matches,
+//     as paths (or FileEntry objects with ?detail=1), narrowed by
+//     ?lang= and the frontmatter filters when given.
+// -------------------------------------------------------
+func handleSmartFileList(w http.ResponseWriter, r *http.Request, name string) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    folder, found := findSmartFolder(r.Context(), user.Name, name)
+    if !found {
+        apierror.Write(w, r, apierror.CodeNotFound, "smart", "Smart folder not found")
+        return
+    }
+
+    paths, err := evaluateSmartQuery(r.Context(), folder.Query)
+    if err != nil {
+        writeStorageError(w, r, err, "evaluate smart folder "+name, "Smart folder evaluation failed")
+        return
+    }
+    if keep := listingFilter(r); keep != nil {
+        kept := []string{}
+        for _, rel := range paths {
+            if keep(rel) {
+                kept = append(kept, rel)
+            }
+        }
+        paths = kept
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Smart folder %s matched %d files", name, len(paths)))
+    w.Header().Set("Content-Type", "application/json")
+    if r.URL.Query().Get("detail") != "1" {
+        json.NewEncoder(w).Encode(paths)
+        return
+    }
+    json.NewEncoder(w).Encode(fileEntries(r.Context(), paths))
+}
+
+// -------------------------------------------------------
+// func fileEntries(ctx, rels []string) []FileEntry
+// -------------------------------------------------------
+// Purpose:
+//   - FileEntry objects (workflow state, open comments, language,
+//     processor attributes, frontmatter) for notes given by slash-separated path.
+// -------------------------------------------------------
+func fileEntries(ctx context.Context, rels []string) []FileEntry {
+    states := workflowStates(ctx)
+    positions := currentOrder(ctx).Files
+    languages := newLanguageLookup(ctx)
+    frontmatter := newFrontmatterLookup(ctx, languages.index)
+    entries := make([]FileEntry, 0, len(rels))
+    for _, rel := range rels {
+        state := states[rel]
+        if state == "" {
+            state = stateDraft
+        }
+        entries = append(entries, FileEntry{
+            Name:               path.Base(rel),
+            Path:               rel,
+            State:              state,
+            UnresolvedComments: unresolvedComments(ctx, rel),
+            Position:           positionOf(positions, rel),
+            Language:           languages.of(rel),
+            Attributes:         languages.index[rel].Attributes,
+            Frontmatter:        frontmatter.shown(rel),
+        })
+    }
+    return entries
+}
+
+// auditSmartFolder records a smart folder change.
+func auditSmartFolder(r *http.Request, event, actor, name string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actor,
+        Target:   name,
+    })
+}
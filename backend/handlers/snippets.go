@@ -0,0 +1,316 @@
+// -------------------------------------------------------
+// backend/handlers/snippets.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Snippet library: named, reusable text blocks (standard
+//     disclaimers, approval language) shared by everyone using this
+//     scratchpad, for the editor to insert into notes.
+//       GET    /snippets                  all snippets, by name
+//       GET    /snippets?name=            one snippet with content
+//       GET    /snippets?name=&version=n  an earlier version
+//       POST   /snippets                  create or update
+//       DELETE /snippets?name=            remove with its history
+// Audit:
+//   - Every update is a new version; the last maxSnippetVersions
+//     are kept with who saved them and when. base_version makes an
+//     update fail with 409 when someone else saved in between.
+//   - Kept in .scratchpad/snippets.json. Changes write
+//     "snippet.save" and "snippet.delete".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    snippetsFile       = "snippets.json"
+    maxSnippets        = 500
+    maxSnippetVersions = 50
+    maxSnippetBytes    = 64 << 10
+    maxSnippetRequest  = maxSnippetBytes + 8<<10
+)
+
+// snippetsMu guards snippets.json.
+var snippetsMu sync.Mutex
+
+// -------------------------------------------------------
+// type SnippetVersion / Snippet
+// -------------------------------------------------------
+// Purpose:
+//   - One saved version of a snippet, and a snippet with its
+//     versions (oldest first; the last one is current).
+// -------------------------------------------------------
+type SnippetVersion struct {
+    Version     int    `json:"version"`
+    Description string `json:"description,omitempty"`
+    Content     string `json:"content"`
+    SavedAt     string `json:"saved_at"`
+    SavedBy     string `json:"saved_by,omitempty"`
+}
+
+type Snippet struct {
+    Name     string           `json:"name"`
+    Versions []SnippetVersion `json:"versions"`
+}
+
+// -------------------------------------------------------
+// type SnippetSummary
+// -------------------------------------------------------
+// Purpose:
+//   - A snippet as listed and answered: its current (or requested)
+//     version. Content is left out of listings.
+// -------------------------------------------------------
+type SnippetSummary struct {
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+    Content     string `json:"content,omitempty"`
+    Version     int    `json:"version"`
+    Versions    []int  `json:"versions,omitempty"`
+    SavedAt     string `json:"saved_at"`
+    SavedBy     string `json:"saved_by,omitempty"`
+}
+
+// summary describes version v of s (with content when full).
+func (s Snippet) summary(v SnippetVersion, full bool) SnippetSummary {
+    out := SnippetSummary{Name: s.Name, Description: v.Description, Version: v.Version, SavedAt: v.SavedAt, SavedBy: v.SavedBy}
+    if full {
+        out.Content = v.Content
+        for _, version := range s.Versions {
+            out.Versions = append(out.Versions, version.Version)
+        }
+    }
+    return out
+}
+
+// current is the latest version of s.
+func (s Snippet) current() SnippetVersion {
+    return s.Versions[len(s.Versions)-1]
+}
+
+// loadSnippetsLocked reads the library. Caller holds snippetsMu.
+func loadSnippetsLocked(ctx context.Context) map[string]Snippet {
+    snippets := map[string]Snippet{}
+    if err := loadMetaJSON(ctx, snippetsFile, &snippets); err != nil {
+        logError(ctx, "Failed to load snippets: "+err.Error())
+        return map[string]Snippet{}
+    }
+    if snippets == nil {
+        snippets = map[string]Snippet{}
+    }
+    return snippets
+}
+
+// -------------------------------------------------------
+// func HandleSnippets(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - /snippets: list, read, save, or delete snippets.
+// -------------------------------------------------------
+func HandleSnippets(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        getSnippet(w, r)
+    case http.MethodPost:
+        saveSnippet(w, r)
+    case http.MethodDelete:
+        deleteSnippet(w, r)
+    default:
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func getSnippet(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Without ?name: every snippet's current version, by name,
+//     without content. With ?name: that snippet with content and
+//     its version numbers; ?version=n picks an earlier one.
+// -------------------------------------------------------
+func getSnippet(w http.ResponseWriter, r *http.Request) {
+    snippetsMu.Lock()
+    snippets := loadSnippetsLocked(r.Context())
+    snippetsMu.Unlock()
+
+    name := r.URL.Query().Get("name")
+    if name == "" {
+        list := []SnippetSummary{}
+        for _, snippet := range snippets {
+            list = append(list, snippet.summary(snippet.current(), false))
+        }
+        sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(list)
+        return
+    }
+
+    snippet, ok := snippets[name]
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "name", "Snippet not found")
+        return
+    }
+    version := snippet.current()
+    if raw := r.URL.Query().Get("version"); raw != "" {
+        n, err := strconv.Atoi(raw)
+        if err != nil || n < 1 {
+            writeFieldError(w, r, invalidField("version", "must be a version number (1 or more)"))
+            return
+        }
+        found := false
+        for _, v := range snippet.Versions {
+            if v.Version == n {
+                version, found = v, true
+            }
+        }
+        if !found {
+            apierror.Write(w, r, apierror.CodeNotFound, "version", fmt.Sprintf("Version %d of %s is not kept", n, name))
+            return
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(snippet.summary(version, true))
+}
+
+// -------------------------------------------------------
+// func saveSnippet(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST {"name", "content", "description", "base_version"}:
+//     create a snippet (version 1) or add a version to it.
+// Audit:
+//   - base_version, when given, must be the current version (0 for
+//     a new snippet); otherwise 409 with the current version.
+//   - Saving the current content and description again adds no
+//     version.
+// -------------------------------------------------------
+func saveSnippet(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Name        string `json:"name"`
+        Content     string `json:"content"`
+        Description string `json:"description"`
+        BaseVersion *int   `json:"base_version"`
+    }
+    dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetRequest))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&req); err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Snippet exceeds %d bytes", maxSnippetBytes))
+            return
+        }
+        writeJSONError(w, r, err)
+        return
+    }
+    if !requireField(w, r, "name", req.Name) || !requireField(w, r, "content", req.Content) {
+        return
+    }
+    if !smartNamePattern.MatchString(req.Name) {
+        writeFieldError(w, r, invalidField("name", "must be 1-64 letters, digits, spaces, '.', '_' or '-'"))
+        return
+    }
+    if len(req.Content) > maxSnippetBytes {
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "content", fmt.Sprintf("Snippet exceeds %d bytes", maxSnippetBytes))
+        return
+    }
+    if len(req.Description) > 256 {
+        writeFieldError(w, r, invalidField("description", "exceeds 256 bytes"))
+        return
+    }
+
+    actor := actorName(r.Context())
+    snippetsMu.Lock()
+    defer snippetsMu.Unlock()
+    snippets := loadSnippetsLocked(r.Context())
+    snippet, exists := snippets[req.Name]
+    current := 0
+    if exists {
+        current = snippet.current().Version
+    } else if len(snippets) >= maxSnippets {
+        writeFieldError(w, r, invalidField("name", "would exceed %d snippets", maxSnippets))
+        return
+    }
+    if req.BaseVersion != nil && *req.BaseVersion != current {
+        apierror.WriteDetails(w, r, apierror.CodeConflict, "base_version", "Snippet changed since it was loaded",
+            map[string]interface{}{"name": req.Name, "version": current})
+        return
+    }
+    if exists && snippet.current().Content == req.Content && snippet.current().Description == req.Description {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(snippet.summary(snippet.current(), true))
+        return
+    }
+
+    snippet.Name = req.Name
+    snippet.Versions = append(snippet.Versions, SnippetVersion{
+        Version:     current + 1,
+        Description: req.Description,
+        Content:     req.Content,
+        SavedAt:     utcNow(r.Context()),
+        SavedBy:     actor,
+    })
+    if len(snippet.Versions) > maxSnippetVersions {
+        snippet.Versions = snippet.Versions[len(snippet.Versions)-maxSnippetVersions:]
+    }
+    snippets[req.Name] = snippet
+    if err := saveMetaJSON(r.Context(), snippetsFile, snippets); err != nil {
+        writeStorageError(w, r, err, "save snippet "+req.Name, "Save failed")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Saved snippet %s version %d", req.Name, current+1))
+    auditSnippet(r, "snippet.save", req.Name, fmt.Sprintf("version=%d bytes=%d", current+1, len(req.Content)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(snippet.summary(snippet.current(), true))
+}
+
+// deleteSnippet removes a snippet and all its versions.
+func deleteSnippet(w http.ResponseWriter, r *http.Request) {
+    name := r.URL.Query().Get("name")
+    if !requireField(w, r, "name", name) {
+        return
+    }
+    snippetsMu.Lock()
+    defer snippetsMu.Unlock()
+    snippets := loadSnippetsLocked(r.Context())
+    snippet, ok := snippets[name]
+    if !ok {
+        apierror.Write(w, r, apierror.CodeNotFound, "name", "Snippet not found")
+        return
+    }
+    delete(snippets, name)
+    if err := saveMetaJSON(r.Context(), snippetsFile, snippets); err != nil {
+        writeStorageError(w, r, err, "delete snippet "+name, "Delete failed")
+        return
+    }
+
+    logInfo(r.Context(), "Deleted snippet "+name)
+    auditSnippet(r, "snippet.delete", name, fmt.Sprintf("version=%d", snippet.current().Version))
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// auditSnippet records a snippet change.
+func auditSnippet(r *http.Request, event, name, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   name,
+        Detail:   detail,
+    })
+}
@@ -0,0 +1,517 @@
+// -------------------------------------------------------
+// backend/handlers/split.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Split one note into several, or join several into one:
+//       POST /file/split  {"path", "folder", "mode", "level", "marker"}
+//       POST /file/concat {"paths", "target", "separator"}
+// Audit:
+//   - Both only create notes: the sources are never changed, and a
+//     destination that already exists answers 409 before anything is
+//     written. Each destination is created under its path lock
+//     (createFile), so a note that appears after the check is still
+//     never overwritten.
+//   - Version snapshots: the source content is kept in the revision
+//     store (revisions.go) and every created note is journaled like a
+//     save, so each version involved stays readable via
+//     GET /file?asOf=. The response carries every sha256.
+//   - Every created note passes the save processors and the folder's
+//     content_policy first, as on POST /file/save; a refusal answers
+//     422 and nothing is written.
+//   - Destinations obey the filename policy and may not lie in an
+//     archived folder. Sources may be archived (read-only use) but
+//     not under legal hold or approved: both answer 423.
+//   - Each operation writes one audit event ("file.split",
+//     "file.concat") with the paths and hashes involved.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    maxSplitParts      = 99
+    maxConcatSources   = 100
+    maxConcatBytes     = 16 << 20
+    maxSplitLabelBytes = 60
+    defaultSplitLevel  = 2
+    defaultSeparator   = "\n---\n\n"
+)
+
+// Split modes.
+const (
+    splitHeading = "heading"
+    splitMarker  = "marker"
+)
+
+// -------------------------------------------------------
+// type SplitPart
+// -------------------------------------------------------
+// Purpose:
+//   - One note created by a split, or one source of a concat.
+// Audit:
+//   - Heading is the heading the part starts with (heading mode).
+// -------------------------------------------------------
+type SplitPart struct {
+    Path    string `json:"path"`
+    Heading string `json:"heading,omitempty"`
+    Bytes   int    `json:"bytes"`
+    SHA256  string `json:"sha256"`
+    content []byte
+    abs     string
+}
+
+// -------------------------------------------------------
+// func splitNote(content, base, ext, mode, level, marker) []SplitPart
+// -------------------------------------------------------
+// Purpose:
+//   - Cut content into parts named "NN-<label><ext>" in note order.
+// Audit:
+//   - Heading mode cuts before every heading of level or higher
+//     (uses markdownHeadings, so code fences and front matter are
+//     respected) and keeps the heading in its part; the label is the
+//     heading's slug. Text before the first heading is a part
+//     labelled with base.
+//   - Marker mode cuts at lines equal to marker (surrounding spaces
+//     ignored) and drops those lines; parts are labelled with base.
+//   - Parts holding only whitespace are dropped.
+// -------------------------------------------------------
+func splitNote(content []byte, base string, ext string, mode string, level int, marker string) []SplitPart {
+    type cut struct {
+        start   int
+        end     int
+        heading string
+        label   string
+    }
+    cuts := []cut{}
+    if mode == splitHeading {
+        starts := []TocEntry{}
+        for _, heading := range markdownHeadings(content) {
+            if heading.Level <= level {
+                starts = append(starts, heading)
+            }
+        }
+        first := len(content)
+        if len(starts) > 0 {
+            first = starts[0].Offset
+        }
+        cuts = append(cuts, cut{start: 0, end: first, label: base})
+        for i, heading := range starts {
+            end := len(content)
+            if i+1 < len(starts) {
+                end = starts[i+1].Offset
+            }
+            cuts = append(cuts, cut{start: heading.Offset, end: end, heading: heading.Text, label: heading.Slug})
+        }
+    } else {
+        start, offset := 0, 0
+        for _, line := range splitLines(string(content)) {
+            if strings.TrimSpace(line) == marker {
+                cuts = append(cuts, cut{start: start, end: offset, label: base})
+                start = offset + len(line)
+            }
+            offset += len(line)
+        }
+        cuts = append(cuts, cut{start: start, end: len(content), label: base})
+    }
+
+    parts := []SplitPart{}
+    for _, c := range cuts {
+        data := content[c.start:c.end]
+        if strings.TrimSpace(string(data)) == "" {
+            continue
+        }
+        label := c.label
+        for len(label) > maxSplitLabelBytes || !utf8.ValidString(label) {
+            label = label[:len(label)-1]
+        }
+        label = strings.Trim(label, "-_ .")
+        if label == "" {
+            label = "part"
+        }
+        parts = append(parts, SplitPart{
+            Path:    fmt.Sprintf("%02d-%s%s", len(parts)+1, label, ext),
+            Heading: c.heading,
+            Bytes:   len(data),
+            SHA256:  contentHash(data),
+            content: data,
+        })
+    }
+    return parts
+}
+
+// -------------------------------------------------------
+// func newNoteTarget(ctx, field, rel) (string, string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Validate a note path about to be created; returns its
+//     normalized relative and absolute paths.
+// Audit:
+//   - Errors are *fieldError (bad name), errNoteExists, or storage
+//     errors from the existence check.
+// -------------------------------------------------------
+func newNoteTarget(ctx context.Context, field string, rel string) (string, string, error) {
+    normalized, err := applyNamePolicy(rel)
+    if err != nil {
+        return "", "", invalidField(field, "%s: %v", rel, err)
+    }
+    absPath := sanitizePath(ctx, normalized)
+    if absPath == "" || !isNoteName(absPath) {
+        return "", "", invalidField(field, "%s is not a valid note path", rel)
+    }
+    if _, err := statPath(ctx, absPath); err == nil {
+        return "", "", fmt.Errorf("%s %w", relativeTo(ctx, absPath), errNoteExists)
+    } else if !os.IsNotExist(err) {
+        return "", "", err
+    }
+    return relativeTo(ctx, absPath), absPath, nil
+}
+
+// errNoteExists refuses a split or concat that would overwrite a note.
+var errNoteExists = errors.New("already exists")
+
+// -------------------------------------------------------
+// func writeNewNotes(ctx, parts []SplitPart) error
+// -------------------------------------------------------
+// Purpose:
+//   - Create every part, indexed and journaled like a save.
+// Audit:
+//   - Stops at the first failure; parts already written stay (they
+//     are journaled) and are named in the log.
+//   - A part created by someone else since newNoteTarget checked it
+//     fails with errNoteExists and is left untouched.
+// -------------------------------------------------------
+func writeNewNotes(ctx context.Context, parts []SplitPart) error {
+    for i, part := range parts {
+        err := mkdirAll(ctx, filepath.Dir(part.abs))
+        if err == nil {
+            err = createFile(ctx, part.abs, part.content)
+        }
+        if err != nil {
+            for _, written := range parts[:i] {
+                logError(ctx, "Created before failure: "+written.Path)
+            }
+            if os.IsExist(err) {
+                return fmt.Errorf("%s %w", part.Path, errNoteExists)
+            }
+            return fmt.Errorf("write %s: %v", part.Path, err)
+        }
+        indexUpdate(ctx, part.Path, part.content)
+        journalPutEntry(ctx, part.Path, part.content)
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func processParts(ctx, parts []SplitPart) error
+// -------------------------------------------------------
+// Purpose:
+//   - Run the save processors over every part, as POST /file/save
+//     would, and refresh its size and hash.
+// -------------------------------------------------------
+func processParts(ctx context.Context, parts []SplitPart) error {
+    for i := range parts {
+        processed, err := processContent(ctx, hookSave, parts[i].Path, parts[i].content)
+        if err != nil {
+            return err
+        }
+        parts[i].content = processed
+        parts[i].Bytes = len(processed)
+        parts[i].SHA256 = contentHash(processed)
+    }
+    return nil
+}
+
+// writeNewNoteError answers a failed destination check.
+func writeNewNoteError(w http.ResponseWriter, r *http.Request, err error, field string, action string) {
+    if _, ok := err.(*fieldError); ok {
+        writeFieldError(w, r, err)
+        return
+    }
+    if errors.Is(err, errNoteExists) {
+        apierror.Write(w, r, apierror.CodeConflict, field, "Destination "+err.Error())
+        return
+    }
+    writeStorageError(w, r, err, action, "Internal server error")
+}
+
+// -------------------------------------------------------
+// func HandleFileSplit(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Split the note at path into numbered notes in folder (default:
+//     a folder named after the note, next to it).
+// Audit:
+//   - mode is "heading" (default; level 1-6, default 2) or "marker"
+//     (marker required). With dry_run the parts are returned without
+//     writing anything.
+// -------------------------------------------------------
+func HandleFileSplit(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Path   string `json:"path"`
+        Folder string `json:"folder"`
+        Mode   string `json:"mode"`
+        Level  int    `json:"level"`
+        Marker string `json:"marker"`
+        DryRun bool   `json:"dry_run"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    req.Mode = defaultString(req.Mode, splitHeading)
+    if !oneOf(req.Mode, []string{splitHeading, splitMarker}) {
+        writeFieldError(w, r, invalidField("mode", "must be heading or marker"))
+        return
+    }
+    if req.Level == 0 {
+        req.Level = defaultSplitLevel
+    }
+    if req.Level < 1 || req.Level > 6 {
+        writeFieldError(w, r, invalidField("level", "must be 1-6"))
+        return
+    }
+    req.Marker = strings.TrimSpace(req.Marker)
+    if req.Mode == splitMarker && !requireField(w, r, "marker", req.Marker) {
+        return
+    }
+
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfHeld(w, r, absPath) || rejectIfApproved(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+    ext := filepath.Ext(rel)
+    base := strings.TrimSuffix(path.Base(rel), ext)
+    folder := strings.Trim(req.Folder, "/")
+    if folder == "" {
+        folder = strings.TrimSuffix(rel, ext)
+    }
+
+    ctx := r.Context()
+    content, err := readNote(ctx, absPath)
+    if errors.Is(err, os.ErrNotExist) {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "File not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "read file for split: "+absPath, "Internal error")
+        return
+    }
+
+    parts := splitNote(content, base, ext, req.Mode, req.Level, req.Marker)
+    if len(parts) < 2 {
+        field := "level"
+        if req.Mode == splitMarker {
+            field = "marker"
+        }
+        writeFieldError(w, r, invalidField(field, "leaves fewer than 2 parts; nothing to split"))
+        return
+    }
+    if len(parts) > maxSplitParts {
+        writeFieldError(w, r, invalidField("path", "would split into more than %d notes", maxSplitParts))
+        return
+    }
+    for i := range parts {
+        partRel, partAbs, err := newNoteTarget(ctx, "folder", path.Join(folder, parts[i].Path))
+        if err != nil {
+            writeNewNoteError(w, r, err, "folder", "check split target in "+folder)
+            return
+        }
+        if rejectIfArchived(w, r, partAbs) {
+            return
+        }
+        parts[i].Path, parts[i].abs = partRel, partAbs
+    }
+    if err := processParts(ctx, parts); err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+    for _, part := range parts {
+        if rejectIfDangerous(w, r, part.Path, part.content) {
+            return
+        }
+    }
+
+    sha := contentHash(content)
+    result := map[string]interface{}{
+        "dry_run": req.DryRun,
+        "path":    rel,
+        "sha256":  sha,
+        "folder":  relativeTo(ctx, sanitizePath(ctx, folder)),
+        "parts":   parts,
+    }
+    if !req.DryRun {
+        storeRevision(ctx, content)
+        if err := writeNewNotes(ctx, parts); err != nil {
+            writeNewNoteError(w, r, err, "folder", "split "+rel)
+            return
+        }
+        logInfo(ctx, fmt.Sprintf("Split %s into %d notes under %s", rel, len(parts), folder))
+        hashes := []string{}
+        for _, part := range parts {
+            hashes = append(hashes, part.Path+"@"+part.SHA256[:12])
+        }
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:    "file.split",
+            Method:   r.Method,
+            Path:     r.URL.Path,
+            RemoteIP: r.RemoteAddr,
+            Status:   http.StatusOK,
+            Actor:    actorName(ctx),
+            Target:   rel,
+            Detail:   fmt.Sprintf("sha256=%s mode=%s parts=%s", sha, req.Mode, strings.Join(hashes, ",")),
+        })
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
+
+// -------------------------------------------------------
+// func HandleFileConcat(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - Create target holding the listed notes in order, separated by
+//     separator (default a blank line, "---", a blank line).
+// Audit:
+//   - A source without a final newline gets one before the
+//     separator, so the separator always starts on its own line.
+//   - At most maxConcatSources notes and maxConcatBytes in total.
+// -------------------------------------------------------
+func HandleFileConcat(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        Paths     []string `json:"paths"`
+        Target    string   `json:"target"`
+        Separator *string  `json:"separator"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "target", req.Target) {
+        return
+    }
+    if len(req.Paths) < 2 {
+        writeFieldError(w, r, invalidField("paths", "must list at least 2 notes"))
+        return
+    }
+    if len(req.Paths) > maxConcatSources {
+        writeFieldError(w, r, invalidField("paths", "must list at most %d notes", maxConcatSources))
+        return
+    }
+    separator := defaultSeparator
+    if req.Separator != nil {
+        separator = *req.Separator
+    }
+    if !utf8.ValidString(separator) {
+        writeFieldError(w, r, invalidField("separator", "is not valid UTF-8"))
+        return
+    }
+
+    ctx := r.Context()
+    targetRel, targetAbs, err := newNoteTarget(ctx, "target", req.Target)
+    if err != nil {
+        writeNewNoteError(w, r, err, "target", "check concat target "+req.Target)
+        return
+    }
+    if rejectIfArchived(w, r, targetAbs) {
+        return
+    }
+
+    sources := []SplitPart{}
+    var merged []byte
+    for i, p := range req.Paths {
+        absPath := sanitizePath(ctx, p)
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "paths", "Invalid file path: "+p)
+            return
+        }
+        if rejectIfHeld(w, r, absPath) || rejectIfApproved(w, r, absPath) {
+            return
+        }
+        data, err := readNote(ctx, absPath)
+        if errors.Is(err, os.ErrNotExist) {
+            apierror.Write(w, r, apierror.CodeNotFound, "paths", "File not found: "+relativeTo(ctx, absPath))
+            return
+        }
+        if err != nil {
+            writeStorageError(w, r, err, "read file for concat: "+absPath, "Internal error")
+            return
+        }
+        if i > 0 {
+            if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+                merged = append(merged, '\n')
+            }
+            merged = append(merged, separator...)
+        }
+        merged = append(merged, data...)
+        if len(merged) > maxConcatBytes {
+            apierror.Write(w, r, apierror.CodePayloadTooLarge, "paths", fmt.Sprintf("Merged note exceeds %d MiB", maxConcatBytes>>20))
+            return
+        }
+        sources = append(sources, SplitPart{Path: relativeTo(ctx, absPath), Bytes: len(data), SHA256: contentHash(data), content: data})
+    }
+
+    for _, source := range sources {
+        storeRevision(ctx, source.content)
+    }
+    targets := []SplitPart{{Path: targetRel, Bytes: len(merged), SHA256: contentHash(merged), content: merged, abs: targetAbs}}
+    if err := processParts(ctx, targets); err != nil {
+        writeProcessorError(w, r, targetRel, err)
+        return
+    }
+    target := targets[0]
+    if rejectIfDangerous(w, r, target.Path, target.content) {
+        return
+    }
+    if err := writeNewNotes(ctx, targets); err != nil {
+        writeNewNoteError(w, r, err, "target", "concat into "+targetRel)
+        return
+    }
+
+    logInfo(ctx, fmt.Sprintf("Concatenated %d notes into %s", len(sources), targetRel))
+    hashes := []string{}
+    for _, source := range sources {
+        hashes = append(hashes, source.Path+"@"+source.SHA256[:12])
+    }
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.concat",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(ctx),
+        Target:   targetRel,
+        Detail:   fmt.Sprintf("sha256=%s sources=%s", target.SHA256, strings.Join(hashes, ",")),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":    targetRel,
+        "bytes":   target.Bytes,
+        "sha256":  target.SHA256,
+        "sources": sources,
+    })
+}
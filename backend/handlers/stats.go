@@ -0,0 +1,198 @@
+// -------------------------------------------------------
+// backend/handlers/stats.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/stats?path=...: word, line, and character counts of
+//     a note, an estimated reading time, and the size deltas of its
+//     last N revisions, so the frontend can show document stats
+//     without downloading the content.
+// Audit:
+//   - Revisions come from the change journal (journal.go): every
+//     put of the note, following it back through moves, up to the
+//     last delete of its path.
+//   - Read-only; archived notes are read from their archive.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    defaultStatsRevisions = 10
+    maxStatsRevisions     = 100
+    readingWordsPerMinute = 200
+)
+
+// -------------------------------------------------------
+// type FileStats / RevisionDelta
+// -------------------------------------------------------
+// Purpose:
+//   - JSON shape returned by /file/stats.
+// Audit:
+//   - Characters counts Unicode code points; Bytes the stored size.
+//   - Lines counts a final line without a trailing newline; an
+//     empty note has 0 lines.
+//   - Revisions are newest first; Delta is the size change against
+//     the previous revision (the full size for the first one).
+// -------------------------------------------------------
+type FileStats struct {
+    Path           string          `json:"path"`
+    Words          int             `json:"words"`
+    Lines          int             `json:"lines"`
+    Characters     int             `json:"characters"`
+    Bytes          int             `json:"bytes"`
+    ReadingMinutes int             `json:"reading_minutes"`
+    Revisions      []RevisionDelta `json:"revisions"`
+}
+
+type RevisionDelta struct {
+    Clock int64  `json:"clock"`
+    At    string `json:"at"`
+    Actor string `json:"actor,omitempty"`
+    Path  string `json:"path"`
+    Size  int64  `json:"size"`
+    Delta int64  `json:"delta"`
+}
+
+// -------------------------------------------------------
+// func textStats(content []byte) FileStats
+// -------------------------------------------------------
+// Purpose:
+//   - Count words, lines, and characters of content.
+// Audit:
+//   - Words are runs of non-space characters (strings.Fields).
+//   - Reading time rounds up; any non-empty note takes 1 minute.
+// -------------------------------------------------------
+func textStats(content []byte) FileStats {
+    text := string(content)
+    stats := FileStats{
+        Words:      len(strings.Fields(text)),
+        Lines:      strings.Count(text, "\n"),
+        Characters: utf8.RuneCountInString(text),
+        Bytes:      len(content),
+    }
+    if text != "" && !strings.HasSuffix(text, "\n") {
+        stats.Lines++
+    }
+    stats.ReadingMinutes = (stats.Words + readingWordsPerMinute - 1) / readingWordsPerMinute
+    return stats
+}
+
+// -------------------------------------------------------
+// func noteRevisions(ctx context.Context, rel string, limit int) ([]RevisionDelta, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The last limit revisions of the note now at rel, newest first.
+// Audit:
+//   - Walks the journal backwards: a move renames the note being
+//     followed to its source path; a delete ends its history.
+// -------------------------------------------------------
+func noteRevisions(ctx context.Context, rel string, limit int) ([]RevisionDelta, error) {
+    entries, err := readJournal(ctx, 0, 0)
+    if err != nil {
+        return []RevisionDelta{}, err
+    }
+
+    // Collect the whole lineage so the oldest listed revision still
+    // gets its delta against the one before it.
+    lineage := []RevisionDelta{}
+    name := rel
+    for i := len(entries) - 1; i >= 0; i-- {
+        entry := entries[i]
+        if entry.Path != name || !journalNoteContent(entry) {
+            continue
+        }
+        if entry.Op == journalDelete {
+            break
+        }
+        if entry.Op == journalMove {
+            name = entry.From
+            continue
+        }
+        lineage = append(lineage, RevisionDelta{
+            Clock: entry.Clock,
+            At:    entry.At,
+            Actor: entry.Actor,
+            Path:  entry.Path,
+            Size:  entry.Size,
+        })
+    }
+
+    revisions := []RevisionDelta{}
+    for i, revision := range lineage {
+        if len(revisions) == limit {
+            break
+        }
+        revision.Delta = revision.Size
+        if i+1 < len(lineage) {
+            revision.Delta = revision.Size - lineage[i+1].Size
+        }
+        revisions = append(revisions, revision)
+    }
+    return revisions, nil
+}
+
+// -------------------------------------------------------
+// func HandleFileStats(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/stats?path=...&revisions=N (default 10, max 100).
+// Audit:
+//   - A journal read failure is logged and answered with an empty
+//     revision list; the counts are still returned.
+// -------------------------------------------------------
+func HandleFileStats(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    file := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    limit, err := searchIntParam(r, "revisions", defaultStatsRevisions, maxStatsRevisions)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    rel := relativeTo(r.Context(), absPath)
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for stats: "+absPath, "Internal error")
+        return
+    }
+    content, err = processContent(r.Context(), hookRead, rel, content)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+
+    stats := textStats(content)
+    stats.Path = rel
+    stats.Revisions, err = noteRevisions(r.Context(), rel, limit)
+    if err != nil {
+        logError(r.Context(), "Failed to read change journal for stats: "+err.Error())
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Stats for %s: %d words, %d revisions", rel, stats.Words, len(stats.Revisions)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(stats)
+}
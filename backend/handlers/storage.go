@@ -0,0 +1,482 @@
+// -------------------------------------------------------
+// backend/handlers/storage.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Storage interface for everything under the scratch root (notes
+//     and .scratchpad metadata), with context-aware wrappers for the
+//     note operations handlers perform (stat, read, write, list,
+//     move, mkdir). Implementations: OSStorage (default,
+//     storage_os.go), MemStorage (storage_mem.go), FSStorage
+//     (storage_fs.go).
+//   - Map storage failures (including deadlines) to HTTP responses.
+// Audit:
+//   - Symlinks and special files are refused (storage_safety.go).
+//   - Metadata helpers and background work (meta.go, trash,
+//     archives, compaction) call the Server's Storage directly,
+//     without a deadline, so they are never abandoned halfway.
+//   - Every call honours r.Context(): a cancelled or expired context
+//     returns immediately instead of hanging on slow storage.
+//   - Disk I/O cannot be interrupted once issued; an abandoned call
+//     finishes in the background and its result is discarded. Writes
+//     are never started once the context has already ended.
+//   - Reads, writes and renames are serialized per path
+//     (storage_queue.go); a write waiting behind another re-checks
+//     the context before it starts.
+//   - With durable_writes, a completed write or rename is fsynced
+//     together with its parent directory before the call returns.
+//   - With tracing on, every call is a "storage.<op>" span (fsync
+//     its own "storage.fsync" child), separating disk time from
+//     handler time.
+//   - Writes, renames and mkdirs advance the listing state, which
+//     invalidates listing ETags (listing_etag.go).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/tracing"
+)
+
+// StatusClientClosedRequest is logged/audited when the client disconnects
+// before the response is ready (non-standard, nginx convention).
+const StatusClientClosedRequest = 499
+
+// -------------------------------------------------------
+// type Storage
+// -------------------------------------------------------
+// Purpose:
+//   - The filesystem operations the note handlers depend on, so
+//     the backing store can be swapped (OS, in-memory, any fs.FS).
+// Audit:
+//   - Paths are absolute paths under scratchRoot as produced by
+//     sanitizePath; implementations must not follow symlinks.
+//   - Missing entries return errors for which os.IsNotExist holds.
+//   - Create is exclusive: an existing entry fails with an error for
+//     which os.IsExist holds. AppendFile creates a missing file.
+//   - Remove takes a file or an empty directory; RemoveAll takes a
+//     whole tree and succeeds when path does not exist. Neither
+//     removes the scratch root itself.
+//   - Only backup archives, evidence bundles and temporary files for
+//     external tools live outside the scratch root; those use the
+//     os package directly.
+// -------------------------------------------------------
+type Storage interface {
+    Lstat(path string) (os.FileInfo, error)
+    ReadFile(path string) ([]byte, error)
+    Open(path string) (File, error)
+    WriteFile(path string, data []byte) error
+    Create(path string, perm os.FileMode) (io.WriteCloser, error)
+    AppendFile(path string, data []byte) error
+    ReadDir(path string) ([]os.FileInfo, error)
+    Rename(from, to string) error
+    MkdirAll(path string) error
+    Remove(path string) error
+    RemoveAll(path string) error
+    Chtimes(path string, mtime time.Time) error
+    Walk(root string, fn filepath.WalkFunc) error
+}
+
+// -------------------------------------------------------
+// type File
+// -------------------------------------------------------
+// Purpose:
+//   - A regular file opened for reading with Storage.Open; seekable
+//     and readable at offsets (zip archives need both).
+// -------------------------------------------------------
+type File interface {
+    io.ReadSeekCloser
+    io.ReaderAt
+    Stat() (os.FileInfo, error)
+}
+
+// -------------------------------------------------------
+// type Syncer
+// -------------------------------------------------------
+// Purpose:
+//   - Optional Storage extension: flush a file or directory to
+//     stable storage. Stores without it (MemStorage) skip fsync.
+// -------------------------------------------------------
+type Syncer interface {
+    Sync(path string) error
+}
+
+// -------------------------------------------------------
+// type PrefixReader
+// -------------------------------------------------------
+// Purpose:
+//   - Optional Storage extension: read at most n bytes from the
+//     start of a file. Stores without it read the whole file.
+// -------------------------------------------------------
+type PrefixReader interface {
+    ReadPrefix(path string, n int64) ([]byte, error)
+}
+
+// -------------------------------------------------------
+// func syncPaths(ctx, paths ...string) error
+// -------------------------------------------------------
+// Purpose:
+//   - fsync paths in order when durable_writes is on.
+// Audit:
+//   - Runs after the write itself, so it is not skipped when the
+//     context ends meanwhile; a failure is returned to the caller
+//     because the change may not survive a crash.
+// -------------------------------------------------------
+func syncPaths(ctx context.Context, paths ...string) error {
+    if !currentConfig(ctx).DurableWrites {
+        return nil
+    }
+    syncer, ok := serverFrom(ctx).Storage.(Syncer)
+    if !ok {
+        return nil
+    }
+    _, span := storageSpan(ctx, "fsync", paths[0])
+    for i, path := range paths {
+        if i > 0 && path == paths[i-1] {
+            continue
+        }
+        if err := syncer.Sync(path); err != nil {
+            endStorageSpan(span, err)
+            return err
+        }
+    }
+    endStorageSpan(span, nil)
+    return nil
+}
+
+// -------------------------------------------------------
+// func storageSpan(ctx, op, path)
+// -------------------------------------------------------
+// Purpose:
+//   - Start the "storage.<op>" tracing span for one call on path.
+// Audit:
+//   - The note path is recorded only with tracing.include_paths;
+//     otherwise spans show the operation and timing alone.
+// -------------------------------------------------------
+func storageSpan(ctx context.Context, op string, path string) (context.Context, *tracing.Span) {
+    ctx, span := tracing.Start(ctx, "storage."+op, tracing.KindInternal)
+    if span != nil && currentConfig(ctx).Tracing.IncludePaths {
+        span.SetAttr("file.path", relativeTo(ctx, path))
+    }
+    return ctx, span
+}
+
+// endStorageSpan finishes span; a missing entry is an answer, not a
+// failure.
+func endStorageSpan(span *tracing.Span, err error) {
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        span.SetError(err)
+    }
+    span.End()
+}
+
+// -------------------------------------------------------
+// func runWithContext(ctx, fn)
+// -------------------------------------------------------
+// Purpose:
+//   - Run a blocking storage call, returning early if ctx ends.
+// Audit:
+//   - Returns ctx.Err() (Canceled or DeadlineExceeded) on early exit.
+// -------------------------------------------------------
+func runWithContext(ctx context.Context, fn func() error) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    done := make(chan error, 1)
+    go func() {
+        done <- fn()
+    }()
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// -------------------------------------------------------
+// func statPath(ctx, path)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.Lstat bound to the request context.
+// Audit:
+//   - Does not follow symlinks; callers inspect the returned mode.
+// -------------------------------------------------------
+func statPath(ctx context.Context, path string) (os.FileInfo, error) {
+    ctx, span := storageSpan(ctx, "stat", path)
+    var info os.FileInfo
+    err := runWithContext(ctx, func() error {
+        var statErr error
+        info, statErr = serverFrom(ctx).Storage.Lstat(path)
+        return statErr
+    })
+    endStorageSpan(span, err)
+    return info, err
+}
+
+// -------------------------------------------------------
+// func readFile(ctx, path)
+// -------------------------------------------------------
+// Purpose:
+//   - Read a regular file (no symlinks) bound to the request context.
+// -------------------------------------------------------
+func readFile(ctx context.Context, path string) ([]byte, error) {
+    ctx, span := storageSpan(ctx, "read", path)
+    var data []byte
+    err := runWithContext(ctx, func() error {
+        defer rlockPath(path)()
+        var readErr error
+        data, readErr = serverFrom(ctx).Storage.ReadFile(path)
+        return readErr
+    })
+    endStorageSpan(span, err)
+    return data, err
+}
+
+// -------------------------------------------------------
+// func writeFile(ctx, path, data)
+// -------------------------------------------------------
+// Purpose:
+//   - Create/truncate a regular file (0644, no symlinks) and write
+//     data, bound to the request context.
+// Audit:
+//   - Concurrent writes to one path are applied one at a time.
+// -------------------------------------------------------
+func writeFile(ctx context.Context, path string, data []byte) error {
+    defer touchStoragePaths(ctx, false, path)
+    ctx, span := storageSpan(ctx, "write", path)
+    span.SetAttr("storage.bytes", len(data))
+    err := runWithContext(ctx, func() error {
+        defer lockPaths(path)()
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        if err := serverFrom(ctx).Storage.WriteFile(path, data); err != nil {
+            return err
+        }
+        return syncPaths(ctx, path, filepath.Dir(path))
+    })
+    endStorageSpan(span, err)
+    return err
+}
+
+// -------------------------------------------------------
+// func createFile(ctx, path, data)
+// -------------------------------------------------------
+// Purpose:
+//   - writeFile for a file that must not exist yet; an existing
+//     entry fails with an error for which os.IsExist holds.
+// Audit:
+//   - The existence check and the write happen under the path's
+//     write lock, so two creators of one path cannot both succeed
+//     and neither truncates a file written in between.
+// -------------------------------------------------------
+func createFile(ctx context.Context, path string, data []byte) error {
+    defer touchStoragePaths(ctx, false, path)
+    ctx, span := storageSpan(ctx, "write", path)
+    span.SetAttr("storage.bytes", len(data))
+    err := runWithContext(ctx, func() error {
+        defer lockPaths(path)()
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        store := serverFrom(ctx).Storage
+        if _, err := store.Lstat(path); err == nil {
+            return &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+        } else if !os.IsNotExist(err) {
+            return err
+        }
+        if err := store.WriteFile(path, data); err != nil {
+            return err
+        }
+        return syncPaths(ctx, path, filepath.Dir(path))
+    })
+    endStorageSpan(span, err)
+    return err
+}
+
+// -------------------------------------------------------
+// func readFilePrefix(ctx, path, n)
+// -------------------------------------------------------
+// Purpose:
+//   - The first n bytes of a file, through PrefixReader when the
+//     store has it.
+// -------------------------------------------------------
+func readFilePrefix(ctx context.Context, path string, n int64) ([]byte, error) {
+    ctx, span := storageSpan(ctx, "read", path)
+    var data []byte
+    err := runWithContext(ctx, func() error {
+        defer rlockPath(path)()
+        var readErr error
+        if prefix, ok := serverFrom(ctx).Storage.(PrefixReader); ok {
+            data, readErr = prefix.ReadPrefix(path, n)
+            return readErr
+        }
+        data, readErr = serverFrom(ctx).Storage.ReadFile(path)
+        if int64(len(data)) > n {
+            data = data[:n]
+        }
+        return readErr
+    })
+    endStorageSpan(span, err)
+    return data, err
+}
+
+// -------------------------------------------------------
+// func readDir(ctx, path)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.ReadDir bound to the request context.
+// -------------------------------------------------------
+func readDir(ctx context.Context, path string) ([]os.FileInfo, error) {
+    ctx, span := storageSpan(ctx, "readdir", path)
+    var entries []os.FileInfo
+    err := runWithContext(ctx, func() error {
+        var readErr error
+        entries, readErr = serverFrom(ctx).Storage.ReadDir(path)
+        return readErr
+    })
+    endStorageSpan(span, err)
+    return entries, err
+}
+
+// -------------------------------------------------------
+// func renamePath(ctx, from, to)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.Rename bound to the request context.
+// Audit:
+//   - Moves notes only: a directory source is refused
+//     (renamePathAny moves folders).
+//   - Both ends get new listing ETags; a moved folder also changes
+//     the folder tree (listing_etag.go).
+// -------------------------------------------------------
+func renamePath(ctx context.Context, from, to string) error {
+    ctx, span := storageSpan(ctx, "rename", from)
+    err := runWithContext(ctx, func() error {
+        defer lockPaths(from, to)()
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        store := serverFrom(ctx).Storage
+        if info, err := store.Lstat(from); err == nil && info.IsDir() {
+            return &UnsafePathError{Path: from, Reason: "not a regular file"}
+        }
+        if err := store.Rename(from, to); err != nil {
+            return err
+        }
+        info, statErr := store.Lstat(to)
+        touchStoragePaths(ctx, statErr == nil && info.IsDir(), from, to)
+        return syncPaths(ctx, to, filepath.Dir(to), filepath.Dir(from))
+    })
+    endStorageSpan(span, err)
+    return err
+}
+
+// -------------------------------------------------------
+// func mkdirAll(ctx, path)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.MkdirAll bound to the request context.
+// Audit:
+//   - Only a folder that did not exist yet changes the folder tree's
+//     ETag (listing_etag.go).
+// -------------------------------------------------------
+func mkdirAll(ctx context.Context, path string) error {
+    ctx, span := storageSpan(ctx, "mkdir", path)
+    err := runWithContext(ctx, func() error {
+        store := serverFrom(ctx).Storage
+        if _, err := store.Lstat(path); os.IsNotExist(err) {
+            defer touchStoragePaths(ctx, true, path)
+        }
+        return store.MkdirAll(path)
+    })
+    endStorageSpan(span, err)
+    return err
+}
+
+// -------------------------------------------------------
+// func walkPath(ctx, root, fn)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.Walk that stops as soon as ctx ends.
+// Audit:
+//   - Checks the context before visiting each entry so large
+//     trees abort promptly on timeout or client disconnect.
+// -------------------------------------------------------
+func walkPath(ctx context.Context, root string, fn filepath.WalkFunc) error {
+    ctx, span := storageSpan(ctx, "walk", root)
+    err := runWithContext(ctx, func() error {
+        return serverFrom(ctx).Storage.Walk(root, func(path string, info os.FileInfo, err error) error {
+            if ctxErr := ctx.Err(); ctxErr != nil {
+                return ctxErr
+            }
+            return fn(path, info, err)
+        })
+    })
+    endStorageSpan(span, err)
+    return err
+}
+
+// -------------------------------------------------------
+// func CheckStorage(ctx context.Context) error
+// -------------------------------------------------------
+// Purpose:
+//   - Readiness probe: the scratch root exists, is a directory, and
+//     answers within ctx.
+// -------------------------------------------------------
+func CheckStorage(ctx context.Context) error {
+    info, err := statPath(ctx, scratchRoot(ctx))
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return errors.New(scratchRoot(ctx) + " is not a directory")
+    }
+    return nil
+}
+
+// -------------------------------------------------------
+// func writeStorageError(w, r, err, action, message)
+// -------------------------------------------------------
+// Purpose:
+//   - Log a storage failure and send the matching HTTP status.
+// Audit:
+//   - ProcessorError   -> as writeProcessorError.
+//   - UnsafePathError  -> 403 unsafe_path + security audit event.
+//   - Not found        -> 404 not_found.
+//   - DeadlineExceeded -> 504 storage_timeout.
+//   - Canceled         -> 499 (client went away; body unused).
+//   - Anything else    -> 500 internal with the caller's message.
+// -------------------------------------------------------
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error, action string, message string) {
+    var unsafeErr *UnsafePathError
+    var failed *ProcessorError
+    switch {
+    case errors.As(err, &failed):
+        writeProcessorError(w, r, failed.Path, err)
+    case errors.As(err, &unsafeErr):
+        auditUnsafePath(r, unsafeErr)
+        apierror.Write(w, r, apierror.CodeUnsafePath, "", "Access denied: path is a symlink or special file")
+    case errors.Is(err, os.ErrNotExist):
+        logError(r.Context(), "Not found during: "+action)
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Not found")
+    case errors.Is(err, context.DeadlineExceeded):
+        logError(r.Context(), "Storage deadline exceeded: "+action)
+        apierror.Write(w, r, apierror.CodeStorageTimeout, "", "Storage timeout")
+    case errors.Is(err, context.Canceled):
+        logError(r.Context(), "Client disconnected during: "+action)
+        w.WriteHeader(StatusClientClosedRequest)
+    default:
+        logError(r.Context(), "Failed to "+action+" - "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", message)
+    }
+}
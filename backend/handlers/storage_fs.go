@@ -0,0 +1,208 @@
+// -------------------------------------------------------
+// backend/handlers/storage_fs.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - FSStorage: read-only Storage adapter over any io/fs.FS
+//     (fstest.MapFS fixtures, embed.FS, zip archives, os.DirFS),
+//     mounted at a root such as scratchRoot.
+// Audit:
+//   - Writes, renames, mkdir, removals and Chtimes fail with
+//     fs.ErrPermission, so a mounted fixture can never be modified
+//     through the handlers.
+//   - Paths outside Root, or not valid fs.FS names, do not exist.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// -------------------------------------------------------
+// type FSStorage
+// -------------------------------------------------------
+// Purpose:
+//   - Serve FS as if it were mounted at Root.
+// -------------------------------------------------------
+type FSStorage struct {
+    FS   fs.FS
+    Root string
+}
+
+// -------------------------------------------------------
+// func NewFSStorage(fsys fs.FS, root string) FSStorage
+// -------------------------------------------------------
+// Purpose:
+//   - Mount fsys at root (usually scratchRoot).
+// -------------------------------------------------------
+func NewFSStorage(fsys fs.FS, root string) FSStorage {
+    return FSStorage{FS: fsys, Root: filepath.Clean(root)}
+}
+
+// name maps an absolute path to an fs.FS name.
+func (s FSStorage) name(op, path string) (string, error) {
+    rel, err := filepath.Rel(s.Root, filepath.Clean(path))
+    if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+        return "", notExist(op, path)
+    }
+    name := filepath.ToSlash(rel)
+    if !fs.ValidPath(name) {
+        return "", notExist(op, path)
+    }
+    return name, nil
+}
+
+// readOnly is the error for any modifying operation.
+func readOnly(op, path string) error {
+    return &fs.PathError{Op: op, Path: path, Err: fs.ErrPermission}
+}
+
+// Lstat describes the entry at path.
+func (s FSStorage) Lstat(path string) (os.FileInfo, error) {
+    name, err := s.name("lstat", path)
+    if err != nil {
+        return nil, err
+    }
+    return fs.Stat(s.FS, name)
+}
+
+// ReadFile returns the file's contents.
+func (s FSStorage) ReadFile(path string) ([]byte, error) {
+    name, err := s.name("open", path)
+    if err != nil {
+        return nil, err
+    }
+    return fs.ReadFile(s.FS, name)
+}
+
+// -------------------------------------------------------
+// func (s FSStorage) Open(path string) (File, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Open a regular file for reading.
+// Audit:
+//   - Files that cannot seek or read at offsets (most fs.FS
+//     implementations besides os.DirFS) are read into memory.
+// -------------------------------------------------------
+func (s FSStorage) Open(path string) (File, error) {
+    name, err := s.name("open", path)
+    if err != nil {
+        return nil, err
+    }
+    f, err := s.FS.Open(name)
+    if err != nil {
+        return nil, err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, err
+    }
+    if !info.Mode().IsRegular() {
+        f.Close()
+        return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("not a regular file")}
+    }
+    if file, ok := f.(File); ok {
+        return file, nil
+    }
+    data, err := io.ReadAll(f)
+    f.Close()
+    if err != nil {
+        return nil, err
+    }
+    return memFile{Reader: bytes.NewReader(data), info: memFileInfo{name: info.Name(), entry: memEntry{data: data, modTime: info.ModTime()}}}, nil
+}
+
+// ReadDir lists a directory in name order.
+func (s FSStorage) ReadDir(path string) ([]os.FileInfo, error) {
+    name, err := s.name("open", path)
+    if err != nil {
+        return nil, err
+    }
+    entries, err := fs.ReadDir(s.FS, name)
+    if err != nil {
+        return nil, err
+    }
+    infos := make([]os.FileInfo, 0, len(entries))
+    for _, entry := range entries {
+        info, err := entry.Info()
+        if err != nil {
+            return nil, err
+        }
+        infos = append(infos, info)
+    }
+    return infos, nil
+}
+
+// WriteFile is refused: FSStorage is read-only.
+func (s FSStorage) WriteFile(path string, data []byte) error {
+    return readOnly("open", path)
+}
+
+// Create is refused: FSStorage is read-only.
+func (s FSStorage) Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+    return nil, readOnly("open", path)
+}
+
+// AppendFile is refused: FSStorage is read-only.
+func (s FSStorage) AppendFile(path string, data []byte) error {
+    return readOnly("open", path)
+}
+
+// Rename is refused: FSStorage is read-only.
+func (s FSStorage) Rename(from, to string) error {
+    return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrPermission}
+}
+
+// MkdirAll is refused: FSStorage is read-only.
+func (s FSStorage) MkdirAll(path string) error {
+    return readOnly("mkdir", path)
+}
+
+// Remove is refused: FSStorage is read-only.
+func (s FSStorage) Remove(path string) error {
+    return readOnly("remove", path)
+}
+
+// RemoveAll is refused: FSStorage is read-only.
+func (s FSStorage) RemoveAll(path string) error {
+    return readOnly("remove", path)
+}
+
+// Chtimes is refused: FSStorage is read-only.
+func (s FSStorage) Chtimes(path string, mtime time.Time) error {
+    return readOnly("chtimes", path)
+}
+
+// -------------------------------------------------------
+// func (s FSStorage) Walk(root string, fn filepath.WalkFunc) error
+// -------------------------------------------------------
+// Purpose:
+//   - fs.WalkDir translated to filepath.Walk's callback, with
+//     absolute paths.
+// -------------------------------------------------------
+func (s FSStorage) Walk(root string, fn filepath.WalkFunc) error {
+    name, err := s.name("lstat", root)
+    if err != nil {
+        return fn(root, nil, err)
+    }
+    err = fs.WalkDir(s.FS, name, func(p string, d fs.DirEntry, err error) error {
+        abs := filepath.Join(s.Root, filepath.FromSlash(p))
+        if err != nil {
+            return fn(abs, nil, err)
+        }
+        info, err := d.Info()
+        return fn(abs, info, err)
+    })
+    if err == filepath.SkipAll {
+        return nil
+    }
+    return err
+}
@@ -0,0 +1,416 @@
+// -------------------------------------------------------
+// backend/handlers/storage_mem.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - MemStorage: a Storage kept entirely in memory, for hermetic
+//     handler tests and ephemeral instances.
+// Audit:
+//   - Behaves like the OS backend where handlers can tell: missing
+//     entries satisfy os.IsNotExist, writes need an existing parent
+//     directory, listings and walks are in lexical order.
+//   - Contents are lost when the process exits.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/clock"
+)
+
+// memEntry is one file or directory in a MemStorage; perm 0 is the
+// default 0644.
+type memEntry struct {
+    data    []byte
+    dir     bool
+    perm    os.FileMode
+    modTime time.Time
+}
+
+// -------------------------------------------------------
+// type MemStorage
+// -------------------------------------------------------
+// Purpose:
+//   - In-memory Storage keyed by cleaned absolute path.
+// Audit:
+//   - Safe for concurrent use; "/" always exists.
+//   - Modification times come from Clock.
+//   - The root given to NewMemStorage cannot be removed.
+// -------------------------------------------------------
+type MemStorage struct {
+    Clock clock.Clock
+
+    mu      sync.RWMutex
+    root    string
+    entries map[string]*memEntry
+}
+
+// -------------------------------------------------------
+// func NewMemStorage(root string) *MemStorage
+// -------------------------------------------------------
+// Purpose:
+//   - Empty in-memory store holding only root (the scratch root of
+//     the Server it backs), with the wall clock for modification
+//     times.
+// -------------------------------------------------------
+func NewMemStorage(root string) *MemStorage {
+    m := &MemStorage{Clock: clock.System{}, root: filepath.Clean(root), entries: map[string]*memEntry{}}
+    m.MkdirAll(root)
+    return m
+}
+
+// memFileInfo adapts a memEntry to os.FileInfo.
+type memFileInfo struct {
+    name  string
+    entry memEntry
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.entry.data)) }
+func (i memFileInfo) ModTime() time.Time { return i.entry.modTime }
+func (i memFileInfo) IsDir() bool        { return i.entry.dir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+func (i memFileInfo) Mode() os.FileMode {
+    if i.entry.dir {
+        return os.ModeDir | 0755
+    }
+    if i.entry.perm != 0 {
+        return i.entry.perm
+    }
+    return 0644
+}
+
+// memFile is a file opened with Open: a snapshot of its contents.
+type memFile struct {
+    *bytes.Reader
+    info memFileInfo
+}
+
+func (f memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f memFile) Close() error               { return nil }
+
+// memWriter collects a file made with Create; Close stores it.
+type memWriter struct {
+    m     *MemStorage
+    entry *memEntry
+    buf   bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memWriter) Close() error {
+    w.m.mu.Lock()
+    defer w.m.mu.Unlock()
+    w.entry.data = append([]byte{}, w.buf.Bytes()...)
+    w.entry.modTime = w.m.Clock.Now()
+    return nil
+}
+
+// lookupLocked returns the entry at a cleaned path. Caller holds mu.
+func (m *MemStorage) lookupLocked(path string) (*memEntry, bool) {
+    if path == "/" {
+        return &memEntry{dir: true}, true
+    }
+    entry, ok := m.entries[path]
+    return entry, ok
+}
+
+// notExist builds the error os.IsNotExist recognises.
+func notExist(op, path string) error {
+    return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+}
+
+// Lstat describes the entry at path.
+func (m *MemStorage) Lstat(path string) (os.FileInfo, error) {
+    path = filepath.Clean(path)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    entry, ok := m.lookupLocked(path)
+    if !ok {
+        return nil, notExist("lstat", path)
+    }
+    return memFileInfo{name: filepath.Base(path), entry: *entry}, nil
+}
+
+// ReadFile returns a copy of the file's contents.
+func (m *MemStorage) ReadFile(path string) ([]byte, error) {
+    path = filepath.Clean(path)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    entry, ok := m.lookupLocked(path)
+    if !ok {
+        return nil, notExist("open", path)
+    }
+    if entry.dir {
+        return nil, &fs.PathError{Op: "read", Path: path, Err: errors.New("is a directory")}
+    }
+    return append([]byte{}, entry.data...), nil
+}
+
+// Open returns a reader over a snapshot of the file's contents.
+func (m *MemStorage) Open(path string) (File, error) {
+    path = filepath.Clean(path)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    entry, ok := m.lookupLocked(path)
+    if !ok {
+        return nil, notExist("open", path)
+    }
+    if entry.dir {
+        return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+    }
+    info := memFileInfo{name: filepath.Base(path), entry: *entry}
+    return memFile{Reader: bytes.NewReader(entry.data), info: info}, nil
+}
+
+// WriteFile creates or replaces a file; its directory must exist.
+func (m *MemStorage) WriteFile(path string, data []byte) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    parent, ok := m.lookupLocked(filepath.Dir(path))
+    if !ok || !parent.dir {
+        return notExist("open", path)
+    }
+    if entry, ok := m.lookupLocked(path); ok && entry.dir {
+        return &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+    }
+    m.entries[path] = &memEntry{data: append([]byte{}, data...), modTime: m.Clock.Now()}
+    return nil
+}
+
+// -------------------------------------------------------
+// func (m *MemStorage) Create(path string, perm os.FileMode) (io.WriteCloser, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Create an empty file and return a writer for its contents.
+// Audit:
+//   - Exclusive: an existing entry fails with fs.ErrExist. The
+//     contents appear when the writer is closed.
+// -------------------------------------------------------
+func (m *MemStorage) Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    parent, ok := m.lookupLocked(filepath.Dir(path))
+    if !ok || !parent.dir {
+        return nil, notExist("open", path)
+    }
+    if _, ok := m.lookupLocked(path); ok {
+        return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrExist}
+    }
+    entry := &memEntry{perm: perm, modTime: m.Clock.Now()}
+    m.entries[path] = entry
+    return &memWriter{m: m, entry: entry}, nil
+}
+
+// AppendFile appends data to a file, creating it if missing.
+func (m *MemStorage) AppendFile(path string, data []byte) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    parent, ok := m.lookupLocked(filepath.Dir(path))
+    if !ok || !parent.dir {
+        return notExist("open", path)
+    }
+    entry, ok := m.lookupLocked(path)
+    if ok && entry.dir {
+        return &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+    }
+    if !ok {
+        entry = &memEntry{}
+        m.entries[path] = entry
+    }
+    entry.data = append(append([]byte{}, entry.data...), data...)
+    entry.modTime = m.Clock.Now()
+    return nil
+}
+
+// ReadDir lists the direct children of a directory by name.
+func (m *MemStorage) ReadDir(path string) ([]os.FileInfo, error) {
+    path = filepath.Clean(path)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    entry, ok := m.lookupLocked(path)
+    if !ok {
+        return nil, notExist("open", path)
+    }
+    if !entry.dir {
+        return nil, &fs.PathError{Op: "readdirent", Path: path, Err: errors.New("not a directory")}
+    }
+    infos := []os.FileInfo{}
+    for p, child := range m.entries {
+        if p != path && filepath.Dir(p) == path {
+            infos = append(infos, memFileInfo{name: filepath.Base(p), entry: *child})
+        }
+    }
+    sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+    return infos, nil
+}
+
+// -------------------------------------------------------
+// func (m *MemStorage) Rename(from, to string) error
+// -------------------------------------------------------
+// Purpose:
+//   - Move a file, or a directory with everything below it.
+// Audit:
+//   - The destination directory must exist; an existing file at
+//     to is replaced, an existing directory is an error.
+// -------------------------------------------------------
+func (m *MemStorage) Rename(from, to string) error {
+    from, to = filepath.Clean(from), filepath.Clean(to)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    entry, ok := m.entries[from]
+    if !ok {
+        return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrNotExist}
+    }
+    if parent, ok := m.lookupLocked(filepath.Dir(to)); !ok || !parent.dir {
+        return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrNotExist}
+    }
+    if existing, ok := m.entries[to]; ok && existing.dir {
+        return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrExist}
+    }
+    if entry.dir && strings.HasPrefix(to, from+"/") {
+        return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrInvalid}
+    }
+
+    delete(m.entries, from)
+    m.entries[to] = entry
+    if entry.dir {
+        for p, child := range m.entries {
+            if strings.HasPrefix(p, from+"/") {
+                delete(m.entries, p)
+                m.entries[to+strings.TrimPrefix(p, from)] = child
+            }
+        }
+    }
+    return nil
+}
+
+// MkdirAll creates path and any missing parents.
+func (m *MemStorage) MkdirAll(path string) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    missing := []string{}
+    for p := path; p != "/" && p != "."; p = filepath.Dir(p) {
+        entry, ok := m.entries[p]
+        if ok && !entry.dir {
+            return &fs.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+        }
+        if ok {
+            break
+        }
+        missing = append(missing, p)
+    }
+    now := m.Clock.Now()
+    for _, p := range missing {
+        m.entries[p] = &memEntry{dir: true, modTime: now}
+    }
+    return nil
+}
+
+// Remove deletes a file or an empty directory.
+func (m *MemStorage) Remove(path string) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if path == m.root || path == "/" {
+        return &UnsafePathError{Path: path, Reason: "scratch root cannot be removed"}
+    }
+    entry, ok := m.entries[path]
+    if !ok {
+        return notExist("remove", path)
+    }
+    if entry.dir {
+        for p := range m.entries {
+            if strings.HasPrefix(p, path+"/") {
+                return &fs.PathError{Op: "remove", Path: path, Err: errors.New("directory not empty")}
+            }
+        }
+    }
+    delete(m.entries, path)
+    return nil
+}
+
+// RemoveAll deletes path and everything below it; a missing path is
+// not an error.
+func (m *MemStorage) RemoveAll(path string) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if path == m.root || path == "/" {
+        return &UnsafePathError{Path: path, Reason: "scratch root cannot be removed"}
+    }
+    delete(m.entries, path)
+    for p := range m.entries {
+        if strings.HasPrefix(p, path+"/") {
+            delete(m.entries, p)
+        }
+    }
+    return nil
+}
+
+// Chtimes sets the modification time of an entry.
+func (m *MemStorage) Chtimes(path string, mtime time.Time) error {
+    path = filepath.Clean(path)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    entry, ok := m.entries[path]
+    if !ok {
+        return notExist("chtimes", path)
+    }
+    entry.modTime = mtime
+    return nil
+}
+
+// -------------------------------------------------------
+// func (m *MemStorage) Walk(root string, fn filepath.WalkFunc) error
+// -------------------------------------------------------
+// Purpose:
+//   - filepath.Walk semantics (lexical order, SkipDir, SkipAll).
+// Audit:
+//   - The lock is not held while fn runs, so fn may use the store.
+// -------------------------------------------------------
+func (m *MemStorage) Walk(root string, fn filepath.WalkFunc) error {
+    info, err := m.Lstat(root)
+    if err != nil {
+        err = fn(root, nil, err)
+    } else {
+        err = m.walk(filepath.Clean(root), info, fn)
+    }
+    if err == filepath.SkipDir || err == filepath.SkipAll {
+        return nil
+    }
+    return err
+}
+
+func (m *MemStorage) walk(path string, info os.FileInfo, fn filepath.WalkFunc) error {
+    if !info.IsDir() {
+        return fn(path, info, nil)
+    }
+    children, err := m.ReadDir(path)
+    if walkErr := fn(path, info, err); err != nil || walkErr != nil {
+        return walkErr
+    }
+    for _, child := range children {
+        if err := m.walk(filepath.Join(path, child.Name()), child, fn); err != nil {
+            if !child.IsDir() || err != filepath.SkipDir {
+                return err
+            }
+        }
+    }
+    return nil
+}
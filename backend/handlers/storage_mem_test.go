@@ -0,0 +1,79 @@
+// -------------------------------------------------------
+// backend/handlers/storage_mem_test.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Tests that handlers run entirely on a MemStorage: notes and
+//     their metadata land in the store and nothing touches the disk.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "cfo-scratchpad/clock"
+)
+
+// memServe runs one request against handler on srv.
+func memServe(srv *Server, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+    rec := httptest.NewRecorder()
+    r := httptest.NewRequest(method, target, strings.NewReader(body))
+    r.Header.Set("Content-Type", "application/json")
+    srv.Handler(handler).ServeHTTP(rec, r)
+    return rec
+}
+
+func TestHandlersOnMemStorage(t *testing.T) {
+    const root = "/cfo-scratchpad-memtest"
+    store := NewMemStorage(root)
+    srv := NewServer(root, nil, store, nil, clock.NewFixed(time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)))
+    ctx := srv.Context()
+    if err := store.MkdirAll(root + "/close"); err != nil {
+        t.Fatal(err)
+    }
+
+    if rec := memServe(srv, HandleFileSave, "POST", "/file/save", `{"path":"close/q1.md","content":"# Q1\naccruals\n"}`); rec.Code != http.StatusOK {
+        t.Fatalf("save: %d %s", rec.Code, rec.Body)
+    }
+    if data, err := store.ReadFile(root + "/close/q1.md"); err != nil || string(data) != "# Q1\naccruals\n" {
+        t.Fatalf("stored note = %q, %v", data, err)
+    }
+    if _, err := store.Lstat(metaPath(ctx, journalFile)); err != nil {
+        t.Fatalf("journal not written to the store: %v", err)
+    }
+
+    rec := memServe(srv, HandleFileGet, "GET", "/file?path=close/q1.md", "")
+    if rec.Code != http.StatusOK || rec.Body.String() != "# Q1\naccruals\n" {
+        t.Fatalf("read: %d %q", rec.Code, rec.Body)
+    }
+
+    if rec := memServe(srv, HandleFileMove, "POST", "/file/move", `{"from":"close/q1.md","to":"close/q1-final.md"}`); rec.Code != http.StatusOK {
+        t.Fatalf("move: %d %s", rec.Code, rec.Body)
+    }
+    rec = memServe(srv, HandleFileList, "GET", "/files?folder=close", "")
+    var names []string
+    if err := json.Unmarshal(rec.Body.Bytes(), &names); err != nil || len(names) != 1 || names[0] != "q1-final.md" {
+        t.Fatalf("list: %d %s", rec.Code, rec.Body)
+    }
+
+    if rec := memServe(srv, HandleFileGet, "DELETE", "/file?path=close/q1-final.md", ""); rec.Code != http.StatusOK {
+        t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+    }
+    items, err := listTrash(ctx)
+    if err != nil || len(items) != 1 || items[0].Path != "close/q1-final.md" {
+        t.Fatalf("trash = %+v, %v", items, err)
+    }
+    if _, err := store.Lstat(root + "/close/q1-final.md"); !os.IsNotExist(err) {
+        t.Fatalf("deleted note still in place: %v", err)
+    }
+
+    if _, err := os.Lstat(root); !os.IsNotExist(err) {
+        t.Fatalf("scratch root %s exists on disk: %v", root, err)
+    }
+}
@@ -0,0 +1,49 @@
+// -------------------------------------------------------
+// backend/handlers/storage_open_other.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Portable no-follow open for platforms without the Linux
+//     openat path (development builds on macOS/Windows).
+// Audit:
+//   - Lstat-checks the whole chain before opening, then confirms
+//     the opened file is regular and is the same file that was
+//     checked (os.SameFile), narrowing the check/use window.
+// -------------------------------------------------------
+
+//go:build !linux
+
+package handlers
+
+import (
+    "os"
+)
+
+// -------------------------------------------------------
+// func openNoFollow(root, absPath, flag, perm)
+// -------------------------------------------------------
+// Purpose:
+//   - Open a regular file under root without following symlinks.
+// Audit:
+//   - Symlinks and non-regular targets map to *UnsafePathError.
+// -------------------------------------------------------
+func openNoFollow(root, absPath string, flag int, perm os.FileMode) (*os.File, error) {
+    if err := checkPathChain(root, absPath, false); err != nil {
+        return nil, err
+    }
+    before, _ := os.Lstat(absPath)
+
+    f, err := os.OpenFile(absPath, flag, perm)
+    if err != nil {
+        return nil, err
+    }
+    after, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, err
+    }
+    if !after.Mode().IsRegular() || (before != nil && !os.SameFile(before, after)) {
+        f.Close()
+        return nil, &UnsafePathError{Path: absPath, Reason: "not a regular file"}
+    }
+    return f, nil
+}
@@ -0,0 +1,239 @@
+// -------------------------------------------------------
+// backend/handlers/storage_os.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - OSStorage: the default Storage, backed by the local
+//     filesystem under its Root (/scratchpad-data by default).
+// Audit:
+//   - Every operation applies the symlink and special-file checks
+//     of storage_safety.go; file opens use openNoFollow.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// -------------------------------------------------------
+// type OSStorage
+// -------------------------------------------------------
+// Purpose:
+//   - Storage on the real filesystem.
+// Audit:
+//   - Root is where the symlink checks start; it must match the
+//     Root of the Server using the store (NewServer sets both).
+// -------------------------------------------------------
+type OSStorage struct {
+    Root string
+}
+
+// Lstat is os.Lstat; symlinks are reported, never followed.
+func (OSStorage) Lstat(path string) (os.FileInfo, error) {
+    return os.Lstat(path)
+}
+
+// ReadFile reads a regular file without following symlinks.
+func (s OSStorage) ReadFile(path string) ([]byte, error) {
+    f, err := openNoFollow(s.Root, path, os.O_RDONLY, 0)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    return ioutil.ReadAll(f)
+}
+
+// Open opens a regular file for reading without following symlinks.
+func (s OSStorage) Open(path string) (File, error) {
+    return openNoFollow(s.Root, path, os.O_RDONLY, 0)
+}
+
+// ReadPrefix reads at most n bytes of a regular file without
+// following symlinks.
+func (s OSStorage) ReadPrefix(path string, n int64) ([]byte, error) {
+    f, err := openNoFollow(s.Root, path, os.O_RDONLY, 0)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    return ioutil.ReadAll(io.LimitReader(f, n))
+}
+
+// WriteFile creates or truncates a regular file (0644).
+func (s OSStorage) WriteFile(path string, data []byte) error {
+    f, err := openNoFollow(s.Root, path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// -------------------------------------------------------
+// func (OSStorage) Create(path string, perm os.FileMode) (io.WriteCloser, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Create a new regular file with perm for writing.
+// Audit:
+//   - O_EXCL: an existing entry (a symlink included) is never
+//     opened or truncated.
+// -------------------------------------------------------
+func (s OSStorage) Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+    return openNoFollow(s.Root, path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+}
+
+// AppendFile appends data to a regular file, creating it (0644).
+func (s OSStorage) AppendFile(path string, data []byte) error {
+    f, err := openNoFollow(s.Root, path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// ReadDir lists a directory whose chain is free of symlinks.
+func (s OSStorage) ReadDir(path string) ([]os.FileInfo, error) {
+    if err := checkPathChain(s.Root, path, true); err != nil {
+        return nil, err
+    }
+    return ioutil.ReadDir(path)
+}
+
+// -------------------------------------------------------
+// func (OSStorage) Rename(from, to string) error
+// -------------------------------------------------------
+// Purpose:
+//   - os.Rename after checking both chains.
+// Audit:
+//   - Source must be a regular file or a directory, never a symlink.
+//   - For a file, an existing destination must be regular; for a
+//     directory only the destination's parent chain is checked.
+// -------------------------------------------------------
+func (s OSStorage) Rename(from, to string) error {
+    info, err := os.Lstat(from)
+    if err != nil {
+        return err
+    }
+    if err := checkPathChain(s.Root, from, info.IsDir()); err != nil {
+        return err
+    }
+    dest, wantDir := to, false
+    if info.IsDir() {
+        dest, wantDir = filepath.Dir(to), true
+    }
+    if err := checkPathChain(s.Root, dest, wantDir); err != nil {
+        return err
+    }
+    return os.Rename(from, to)
+}
+
+// MkdirAll creates path (0755); existing components must be real
+// directories.
+func (s OSStorage) MkdirAll(path string) error {
+    if err := checkPathChain(s.Root, path, true); err != nil {
+        return err
+    }
+    return os.MkdirAll(path, 0755)
+}
+
+// -------------------------------------------------------
+// func (OSStorage) Remove(path string) error
+// -------------------------------------------------------
+// Purpose:
+//   - os.Remove of a file or empty directory.
+// Audit:
+//   - The parent chain must be free of symlinks; a symlink leaf is
+//     removed itself, never its target. The root is refused.
+// -------------------------------------------------------
+func (s OSStorage) Remove(path string) error {
+    if err := s.checkRemovable(path); err != nil {
+        return err
+    }
+    return os.Remove(path)
+}
+
+// -------------------------------------------------------
+// func (OSStorage) RemoveAll(path string) error
+// -------------------------------------------------------
+// Purpose:
+//   - os.RemoveAll of a tree below the root.
+// Audit:
+//   - Same checks as Remove; os.RemoveAll does not follow symlinks
+//     inside the tree.
+// -------------------------------------------------------
+func (s OSStorage) RemoveAll(path string) error {
+    if err := s.checkRemovable(path); err != nil {
+        return err
+    }
+    return os.RemoveAll(path)
+}
+
+// checkRemovable refuses the root and paths whose parent chain is
+// not made of real directories.
+func (s OSStorage) checkRemovable(path string) error {
+    parts, err := splitUnderRoot(s.Root, path)
+    if err != nil {
+        return err
+    }
+    if len(parts) == 0 {
+        return &UnsafePathError{Path: path, Reason: "scratch root cannot be removed"}
+    }
+    return checkPathChain(s.Root, filepath.Dir(path), true)
+}
+
+// Chtimes sets the modification (and access) time of a file or
+// directory whose chain is free of symlinks.
+func (s OSStorage) Chtimes(path string, mtime time.Time) error {
+    info, err := os.Lstat(path)
+    if err != nil {
+        return err
+    }
+    if err := checkPathChain(s.Root, path, info.IsDir()); err != nil {
+        return err
+    }
+    return os.Chtimes(path, mtime, mtime)
+}
+
+// -------------------------------------------------------
+// func (OSStorage) Sync(path string) error
+// -------------------------------------------------------
+// Purpose:
+//   - fsync a file or directory, so a completed write or rename
+//     survives a power cut (durable_writes).
+// Audit:
+//   - Same chain checks as the operation being made durable.
+// -------------------------------------------------------
+func (s OSStorage) Sync(path string) error {
+    info, err := os.Lstat(path)
+    if err != nil {
+        return err
+    }
+    if err := checkPathChain(s.Root, path, info.IsDir()); err != nil {
+        return err
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// Walk is filepath.Walk (which does not follow symlinks).
+func (OSStorage) Walk(root string, fn filepath.WalkFunc) error {
+    return filepath.Walk(root, fn)
+}
@@ -0,0 +1,695 @@
+// -------------------------------------------------------
+// backend/handlers/sync.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Cross-instance sync. A primary serves its change journal and
+//     note contents over /sync (sync key required); a secondary with
+//     sync.primary configured pulls and applies them periodically.
+//       GET  /sync/changes?since=N&limit=M  journal entries after N
+//       GET  /sync/file?path=...            note content + SHA-256
+//       GET  /admin/sync                    local pull state
+//       POST /admin/sync                    pull now
+//   - With sync.follower the secondary is a read-only hot standby
+//     (follower.go).
+// Audit:
+//   - Divergence never loses data: if a note changed on both sides
+//     since the last sync, the local copy is kept and the primary's
+//     version is written next to it as a conflict file
+//     "<name> (conflict <UTC>).<ext>".
+//   - Remote deletes of locally modified, ledger, or approved notes
+//     are skipped (logged); remote rewrites of ledger or approved
+//     notes become conflict files.
+//   - Remote folder creations and tag changes are applied and
+//     journaled with their origin; tag changes of notes that diverged
+//     locally are skipped.
+//   - Pull state (cursor, last-synced hashes) is persisted in
+//     .scratchpad/sync_state.json after every page.
+//   - Writes "sync.pull" per run and "sync.conflict" per conflict.
+// Configuration:
+//   - sync.key / SYNC_KEY, sync.primary / SYNC_PRIMARY,
+//     sync.interval / SYNC_INTERVAL (default 1m),
+//     sync.follower / SYNC_FOLLOWER (default false).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "path"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    syncStateFile       = "sync_state.json"
+    syncPageSize        = 500
+    maxSyncPageSize     = 5000
+    syncHTTPTimeout     = 30 * time.Second
+    contentHashHeader   = "X-Content-SHA256"
+    maxSyncContentBytes = 64 << 20
+)
+
+// errSyncDisabled is returned when no sync.primary is configured.
+var errSyncDisabled = errors.New("sync disabled: sync.primary not configured")
+
+// syncMu serializes pulls (timer and manual trigger).
+var syncMu sync.Mutex
+
+// -------------------------------------------------------
+// type SyncState
+// -------------------------------------------------------
+// Purpose:
+//   - Persisted progress of pulls from the primary.
+// Audit:
+//   - Known maps each synced path to the SHA-256 both sides agreed
+//     on last; a local hash different from it means a local edit.
+// -------------------------------------------------------
+type SyncState struct {
+    Primary         string            `json:"primary"`
+    PrimaryInstance string            `json:"primary_instance"`
+    Cursor          int64             `json:"cursor"`
+    PrimaryClock    int64             `json:"primary_clock"`
+    LastSyncAt      string            `json:"last_sync_at,omitempty"`
+    LastError       string            `json:"last_error,omitempty"`
+    Applied         int64             `json:"applied"`
+    Conflicts       int64             `json:"conflicts"`
+    Known           map[string]string `json:"known"`
+}
+
+// -------------------------------------------------------
+// type SyncResult
+// -------------------------------------------------------
+// Purpose:
+//   - Outcome of one pull.
+// -------------------------------------------------------
+type SyncResult struct {
+    Received  int      `json:"received"`
+    Applied   int      `json:"applied"`
+    Skipped   int      `json:"skipped"`
+    Conflicts []string `json:"conflicts"`
+    Cursor    int64    `json:"cursor"`
+}
+
+// syncChangesResponse is the /sync/changes body.
+type syncChangesResponse struct {
+    Instance string         `json:"instance"`
+    Clock    int64          `json:"clock"`
+    Changes  []JournalEntry `json:"changes"`
+    More     bool           `json:"more"`
+}
+
+// -------------------------------------------------------
+// func HandleSyncChanges(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /sync/changes?since=N&limit=M: journal after clock N.
+// -------------------------------------------------------
+func HandleSyncChanges(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    writeChangesPage(w, r)
+}
+
+// -------------------------------------------------------
+// func writeChangesPage(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - One page of the journal after ?since=N (default 0), at most
+//     ?limit=M entries; shared by /sync/changes and /changes.
+// Audit:
+//   - Always returns an array for changes ([] when none).
+// -------------------------------------------------------
+func writeChangesPage(w http.ResponseWriter, r *http.Request) {
+    since, err := strconv.ParseInt(defaultString(r.URL.Query().Get("since"), "0"), 10, 64)
+    if err != nil || since < 0 {
+        apierror.Write(w, r, apierror.CodeInvalidField, "since", "Bad request: since must be a non-negative integer")
+        return
+    }
+    limit := syncPageSize
+    if v := r.URL.Query().Get("limit"); v != "" {
+        limit, err = strconv.Atoi(v)
+        if err != nil || limit < 1 || limit > maxSyncPageSize {
+            apierror.Write(w, r, apierror.CodeInvalidField, "limit", fmt.Sprintf("Bad request: limit must be 1-%d", maxSyncPageSize))
+            return
+        }
+    }
+
+    var entries []JournalEntry
+    err = runWithContext(r.Context(), func() error {
+        var readErr error
+        entries, readErr = readJournal(r.Context(), since, limit+1)
+        return readErr
+    })
+    if err != nil {
+        writeStorageError(w, r, err, "read change journal", "Internal server error")
+        return
+    }
+
+    resp := syncChangesResponse{Instance: InstanceID(r.Context()), Clock: currentJournalClock(r.Context()), Changes: entries}
+    if len(entries) > limit {
+        resp.Changes = entries[:limit]
+        resp.More = true
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// -------------------------------------------------------
+// func HandleSyncFile(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /sync/file?path=: current note content with its SHA-256
+//     in the X-Content-SHA256 header.
+// -------------------------------------------------------
+func HandleSyncFile(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    file := r.URL.Query().Get("path")
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+
+    content, err := readFile(r.Context(), absPath)
+    if os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "read file for sync: "+absPath, "Internal error")
+        return
+    }
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.Header().Set(contentHashHeader, contentHash(content))
+    w.Write(content)
+}
+
+// -------------------------------------------------------
+// func loadSyncState() SyncState
+// -------------------------------------------------------
+// Purpose:
+//   - Read sync_state.json (zero state if missing).
+// -------------------------------------------------------
+func loadSyncState(ctx context.Context) SyncState {
+    state := SyncState{Known: map[string]string{}}
+    if err := loadMetaJSON(ctx, syncStateFile, &state); err != nil {
+        logError(ctx, "Failed to load sync state: "+err.Error())
+    }
+    if state.Known == nil {
+        state.Known = map[string]string{}
+    }
+    return state
+}
+
+// -------------------------------------------------------
+// type syncClient
+// -------------------------------------------------------
+// Purpose:
+//   - Authenticated HTTP access to the primary's /sync API.
+// -------------------------------------------------------
+type syncClient struct {
+    base   string
+    key    string
+    client *http.Client
+}
+
+func (c *syncClient) get(ctx context.Context, endpoint string, query url.Values) (*http.Response, error) {
+    req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.base, "/")+endpoint+"?"+query.Encode(), nil)
+    if err != nil {
+        return nil, err
+    }
+    req = req.WithContext(ctx)
+    req.Header.Set("Authorization", "Bearer "+c.key)
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode != http.StatusOK {
+        resp.Body.Close()
+        return resp, fmt.Errorf("primary returned HTTP %d for %s", resp.StatusCode, endpoint)
+    }
+    return resp, nil
+}
+
+func (c *syncClient) changes(ctx context.Context, since int64) (syncChangesResponse, error) {
+    var page syncChangesResponse
+    resp, err := c.get(ctx, "/sync/changes", url.Values{"since": {strconv.FormatInt(since, 10)}})
+    if err != nil {
+        return page, err
+    }
+    defer resp.Body.Close()
+    err = json.NewDecoder(resp.Body).Decode(&page)
+    return page, err
+}
+
+func (c *syncClient) file(ctx context.Context, rel string) ([]byte, string, error) {
+    resp, err := c.get(ctx, "/sync/file", url.Values{"path": {rel}})
+    if err != nil {
+        if resp != nil && resp.StatusCode == http.StatusNotFound {
+            return nil, "", os.ErrNotExist
+        }
+        return nil, "", err
+    }
+    defer resp.Body.Close()
+    data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSyncContentBytes))
+    if err != nil {
+        return nil, "", err
+    }
+    if sum := contentHash(data); sum != resp.Header.Get(contentHashHeader) {
+        return nil, "", fmt.Errorf("content hash mismatch for %s", rel)
+    }
+    return data, contentHash(data), nil
+}
+
+// -------------------------------------------------------
+// func SyncOnce(ctx) (SyncResult, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Pull and apply every change the primary has after the cursor.
+// Audit:
+//   - A different primary instance id resets the cursor, so a
+//     rebuilt primary is re-read in full (conflicts, not overwrites).
+// -------------------------------------------------------
+func SyncOnce(ctx context.Context) (SyncResult, error) {
+    result := SyncResult{Conflicts: []string{}}
+    cfg := currentConfig(ctx).Sync
+    if cfg.Primary == "" {
+        return result, errSyncDisabled
+    }
+
+    syncMu.Lock()
+    defer syncMu.Unlock()
+
+    state := loadSyncState(ctx)
+    if state.Primary != cfg.Primary {
+        state.Primary = cfg.Primary
+        state.PrimaryInstance = ""
+    }
+    client := &syncClient{base: cfg.Primary, key: cfg.Key, client: &http.Client{Timeout: syncHTTPTimeout}}
+
+    var runErr error
+    for {
+        page, err := client.changes(ctx, state.Cursor)
+        if err != nil {
+            runErr = err
+            break
+        }
+        if state.PrimaryInstance != page.Instance {
+            if state.PrimaryInstance != "" {
+                logInfo(ctx, "Sync primary instance changed; re-reading journal from the start")
+            }
+            state.PrimaryInstance = page.Instance
+            if state.Cursor != 0 {
+                state.Cursor = 0
+                continue
+            }
+        }
+
+        state.PrimaryClock = page.Clock
+        for _, change := range page.Changes {
+            result.Received++
+            if change.Origin == InstanceID(ctx) {
+                result.Skipped++
+            } else if err := applySyncChange(ctx, client, &state, change, &result); err != nil {
+                runErr = fmt.Errorf("apply %s %s: %v", change.Op, change.Path, err)
+                break
+            }
+            state.Cursor = change.Clock
+        }
+        if runErr != nil || !page.More {
+            break
+        }
+        saveSyncState(ctx, &state, nil)
+    }
+
+    result.Cursor = state.Cursor
+    state.Applied += int64(result.Applied)
+    state.Conflicts += int64(len(result.Conflicts))
+    saveSyncState(ctx, &state, runErr)
+
+    audit.WriteContext(ctx, audit.Event{
+        Event:  "sync.pull",
+        Method: "SYNC",
+        Path:   "/sync/changes",
+        Target: cfg.Primary,
+        Status: syncStatus(runErr),
+        Detail: fmt.Sprintf("received=%d applied=%d conflicts=%d cursor=%d%s",
+            result.Received, result.Applied, len(result.Conflicts), result.Cursor, errSuffix(runErr)),
+    })
+    return result, runErr
+}
+
+func syncStatus(err error) int {
+    if err != nil {
+        return http.StatusBadGateway
+    }
+    return http.StatusOK
+}
+
+func errSuffix(err error) string {
+    if err == nil {
+        return ""
+    }
+    return " error=" + err.Error()
+}
+
+// -------------------------------------------------------
+// func saveSyncState(ctx, state, runErr)
+// -------------------------------------------------------
+// Purpose:
+//   - Persist pull progress and the last outcome.
+// -------------------------------------------------------
+func saveSyncState(ctx context.Context, state *SyncState, runErr error) {
+    state.LastSyncAt = utcNow(ctx)
+    state.LastError = ""
+    if runErr != nil {
+        state.LastError = runErr.Error()
+    }
+    if err := saveMetaJSON(ctx, syncStateFile, state); err != nil {
+        logError(ctx, "Failed to persist sync state: "+err.Error())
+    }
+}
+
+// -------------------------------------------------------
+// func notePathForWrite(ctx context.Context, rel string) (string, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Validate a relative note path exactly as a local save would
+//     (name policy, .txt/.md, not archived), returning the absolute path.
+// Audit:
+//   - Used for paths that did not come from a checked request:
+//     remote journal entries and generated conflict names.
+// -------------------------------------------------------
+func notePathForWrite(ctx context.Context, rel string) (string, bool) {
+    normalized, err := applyNamePolicy(rel)
+    if err != nil || normalized != rel {
+        return "", false
+    }
+    absPath := sanitizePath(ctx, rel)
+    if absPath == "" || !isNoteName(absPath) {
+        return "", false
+    }
+    if _, _, archived := archivedFolderFor(ctx, rel); archived {
+        return "", false
+    }
+    return absPath, true
+}
+
+// -------------------------------------------------------
+// func localHash(ctx, absPath) (string, bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - SHA-256 of the local note; false if it does not exist.
+// -------------------------------------------------------
+func localHash(ctx context.Context, absPath string) (string, bool, error) {
+    data, err := readFile(ctx, absPath)
+    if os.IsNotExist(err) {
+        return "", false, nil
+    }
+    if err != nil {
+        return "", false, err
+    }
+    return contentHash(data), true, nil
+}
+
+// -------------------------------------------------------
+// func applySyncChange(ctx, client, state, change, result) error
+// -------------------------------------------------------
+// Purpose:
+//   - Apply one remote journal entry to the local tree.
+// -------------------------------------------------------
+func applySyncChange(ctx context.Context, client *syncClient, state *SyncState, change JournalEntry, result *SyncResult) error {
+    switch change.Op {
+    case journalPut:
+        return applySyncPut(ctx, client, state, change, change.Path, result)
+
+    case journalMove:
+        fromAbs, fromOK := notePathForWrite(ctx, change.From)
+        toAbs, toOK := notePathForWrite(ctx, change.Path)
+        if fromOK && toOK {
+            fromHash, fromExists, err := localHash(ctx, fromAbs)
+            if err != nil {
+                return err
+            }
+            _, toExists, err := localHash(ctx, toAbs)
+            if err != nil {
+                return err
+            }
+            if fromExists && !toExists && fromHash == state.Known[change.From] && !isApproved(ctx, change.From) && !isHeld(ctx, change.From) {
+                if err := mkdirAll(ctx, path.Dir(toAbs)); err != nil {
+                    return err
+                }
+                if err := renamePath(ctx, fromAbs, toAbs); err != nil {
+                    return err
+                }
+                indexRename(ctx, change.From, change.Path)
+                renameNoteMeta(ctx, change.From, change.Path)
+                journalAppend(ctx, JournalEntry{Op: journalMove, Path: change.Path, From: change.From, Actor: change.Actor, SHA256: fromHash, Size: change.Size, Origin: change.Origin}, change.Clock)
+                delete(state.Known, change.From)
+                state.Known[change.Path] = fromHash
+                result.Applied++
+                return nil
+            }
+        }
+        // Source edited locally or missing: fetch the destination
+        // content instead and leave the local source alone.
+        return applySyncPut(ctx, client, state, change, change.Path, result)
+
+    case journalDelete:
+        absPath, ok := notePathForWrite(ctx, change.Path)
+        if !ok {
+            result.Skipped++
+            return nil
+        }
+        hash, exists, err := localHash(ctx, absPath)
+        if err != nil {
+            return err
+        }
+        if !exists {
+            delete(state.Known, change.Path)
+            return nil
+        }
+        if isLedger(ctx, change.Path) || isApproved(ctx, change.Path) || isHeld(ctx, change.Path) {
+            logInfo(ctx, "Sync kept ledger, approved, or held note deleted on primary: "+change.Path)
+            result.Skipped++
+            return nil
+        }
+        if hash != state.Known[change.Path] {
+            logInfo(ctx, "Sync kept locally modified note deleted on primary: "+change.Path)
+            result.Skipped++
+            return nil
+        }
+        if _, err := moveToTrash(ctx, absPath, "file"); err != nil {
+            return err
+        }
+        delete(state.Known, change.Path)
+        result.Applied++
+        return nil
+
+    case journalTags:
+        // Follows the put before it; recorded only while the local
+        // note still holds the primary's content.
+        absPath, ok := notePathForWrite(ctx, change.Path)
+        if !ok {
+            result.Skipped++
+            return nil
+        }
+        hash, exists, err := localHash(ctx, absPath)
+        if err != nil {
+            return err
+        }
+        if !exists || hash != state.Known[change.Path] {
+            result.Skipped++
+            return nil
+        }
+        if indexSetTags(ctx, change.Path, change.Tags) {
+            journalAppend(ctx, JournalEntry{Op: journalTags, Path: change.Path, Actor: change.Actor, Tags: change.Tags, Origin: change.Origin}, change.Clock)
+        }
+        result.Applied++
+        return nil
+
+    case journalMkdir:
+        normalized, err := applyNamePolicy(change.Path)
+        absPath := sanitizePath(ctx, change.Path)
+        if err != nil || normalized != change.Path || absPath == "" || absPath == scratchRoot(ctx) {
+            result.Skipped++
+            return nil
+        }
+        if _, _, archived := archivedFolderFor(ctx, change.Path); archived {
+            result.Skipped++
+            return nil
+        }
+        if _, statErr := statPath(ctx, absPath); !os.IsNotExist(statErr) {
+            return nil
+        }
+        if err := mkdirAll(ctx, absPath); err != nil {
+            return err
+        }
+        journalAppend(ctx, JournalEntry{Op: journalMkdir, Path: change.Path, Actor: change.Actor, Origin: change.Origin}, change.Clock)
+        result.Applied++
+        return nil
+    }
+
+    result.Skipped++
+    return nil
+}
+
+// -------------------------------------------------------
+// func applySyncPut(ctx, client, state, change, rel, result) error
+// -------------------------------------------------------
+// Purpose:
+//   - Bring rel up to the primary's current content, or write a
+//     conflict file when the local copy has diverged.
+// -------------------------------------------------------
+func applySyncPut(ctx context.Context, client *syncClient, state *SyncState, change JournalEntry, rel string, result *SyncResult) error {
+    absPath, ok := notePathForWrite(ctx, rel)
+    if !ok {
+        logError(ctx, "Sync skipped unsafe or archived path: "+rel)
+        result.Skipped++
+        return nil
+    }
+
+    data, remoteHash, err := client.file(ctx, rel)
+    if errors.Is(err, os.ErrNotExist) {
+        // Gone again on the primary; a later delete entry follows.
+        result.Skipped++
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    hash, exists, err := localHash(ctx, absPath)
+    if err != nil {
+        return err
+    }
+    switch {
+    case exists && hash == remoteHash:
+        state.Known[rel] = remoteHash
+        return nil
+    case exists && (hash != state.Known[rel] || !ledgerAccepts(ctx, rel, data) || isApproved(ctx, rel)):
+        conflict, err := writeConflictCopy(ctx, rel, data, conflictSourceSync)
+        if err != nil {
+            return err
+        }
+        state.Known[rel] = remoteHash
+        result.Conflicts = append(result.Conflicts, conflict)
+        logInfo(ctx, "Sync conflict: kept local "+rel+", primary version saved as "+conflict)
+        audit.WriteContext(ctx, audit.Event{
+            Event:  "sync.conflict",
+            Method: "SYNC",
+            Path:   "/sync/file",
+            Status: http.StatusConflict,
+            Target: rel,
+            Detail: "primary version saved as " + conflict,
+        })
+        return nil
+    }
+
+    if err := mkdirAll(ctx, path.Dir(absPath)); err != nil {
+        return err
+    }
+    if err := saveLedger(ctx, rel, absPath, data); err != nil {
+        return err
+    }
+    indexUpdate(ctx, rel, data)
+    storeRevision(ctx, data)
+    journalAppend(ctx, JournalEntry{Op: journalPut, Path: rel, Actor: change.Actor, SHA256: remoteHash, Size: int64(len(data)), Origin: change.Origin}, change.Clock)
+    state.Known[rel] = remoteHash
+    result.Applied++
+    return nil
+}
+
+// -------------------------------------------------------
+// func RunSyncPuller()
+// -------------------------------------------------------
+// Purpose:
+//   - Pull from the primary every sync.interval while configured.
+// Audit:
+//   - Configuration is re-read each cycle, so enabling sync or
+//     changing the interval via reload needs no restart.
+//   - Cycles are skipped while paused() reports true (read-only),
+//     and for good once a follower has been promoted.
+// -------------------------------------------------------
+func RunSyncPuller(ctx context.Context, paused func() bool) {
+    for {
+        cfg := currentConfig(ctx).Sync
+        if cfg.Primary != "" && !paused() && !promoted.Load() {
+            ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+            if result, err := SyncOnce(ctx); err != nil {
+                logError(ctx, "Sync pull failed: "+err.Error())
+            } else if result.Applied > 0 || len(result.Conflicts) > 0 {
+                logInfo(ctx, fmt.Sprintf("Sync pulled %d changes (%d conflicts)", result.Applied, len(result.Conflicts)))
+            }
+            cancel()
+        }
+        time.Sleep(cfg.Interval.Std())
+    }
+}
+
+// -------------------------------------------------------
+// func HandleSyncAdmin(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /admin/sync: pull state. POST /admin/sync: pull now.
+// -------------------------------------------------------
+func HandleSyncAdmin(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        state := loadSyncState(r.Context())
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "instance":         InstanceID(r.Context()),
+            "clock":            currentJournalClock(r.Context()),
+            "primary":          currentConfig(r.Context()).Sync.Primary,
+            "cursor":           state.Cursor,
+            "primary_instance": state.PrimaryInstance,
+            "last_sync_at":     state.LastSyncAt,
+            "last_error":       state.LastError,
+            "applied":          state.Applied,
+            "conflicts":        state.Conflicts,
+            "known_paths":      len(state.Known),
+        })
+    case http.MethodPost:
+        result, err := SyncOnce(r.Context())
+        if err == errSyncDisabled {
+            apierror.Write(w, r, apierror.CodeConflict, "", err.Error())
+            return
+        }
+        if err != nil {
+            logError(r.Context(), "Sync pull failed: "+err.Error())
+            apierror.Write(w, r, apierror.CodeUpstreamFailed, "", "Sync failed: "+err.Error())
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(result)
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// defaultString returns v, or fallback when v is empty.
+func defaultString(v, fallback string) string {
+    if v == "" {
+        return fallback
+    }
+    return v
+}
@@ -0,0 +1,509 @@
+// -------------------------------------------------------
+// backend/handlers/tables.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/export?path=...&format=csv|xlsx: the Markdown
+//     tables of a note as spreadsheets, named after the section
+//     each table sits in. format=html and format=docx export the
+//     whole note instead (export_html.go, docx_export.go).
+// Audit:
+//   - Tables follow GitHub's pipe syntax: a header row, a delimiter
+//     row ("|---|:--:|") with the same number of columns, then body
+//     rows up to the first blank or pipe-less line. Tables inside
+//     fenced code blocks and front matter are ignored.
+//   - Rows are padded or cut to the header's width; "\|" is a
+//     literal pipe in a cell.
+//   - CSV cells that a spreadsheet would run as a formula (leading
+//     =, +, -, @ and not a number) are prefixed with "'".
+//   - XLSX is written directly (inline strings, one sheet per table);
+//     plain numbers ("1200", "1,200.50", "-3") become numeric cells.
+//   - Writes a "file.export" audit event.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/csv"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "net/http"
+    "path"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    maxSheetName    = 31
+)
+
+// -------------------------------------------------------
+// type NoteTable
+// -------------------------------------------------------
+// Purpose:
+//   - One Markdown table and where it is in the note.
+// Audit:
+//   - Heading/Slug are the nearest heading above the table (empty
+//     before the first heading); Index counts tables in the note
+//     from 1, Section counts them within the heading's section.
+// -------------------------------------------------------
+type NoteTable struct {
+    Heading string
+    Slug    string
+    Index   int
+    Section int
+    Line    int
+    Header  []string
+    Rows    [][]string
+}
+
+var (
+    tableDelimiterCellRe = regexp.MustCompile(`^:?-+:?$`)
+    plainNumberRe        = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+    groupedNumberRe      = regexp.MustCompile(`^-?\d{1,3}(,\d{3})+(\.\d+)?$`)
+)
+
+// -------------------------------------------------------
+// func splitTableRow(line string) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Cells of a pipe table row, trimmed, with the optional outer
+//     pipes dropped and "\|" unescaped.
+// -------------------------------------------------------
+func splitTableRow(line string) []string {
+    line = strings.TrimSpace(line)
+    line = strings.TrimPrefix(line, "|")
+    if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+        line = line[:len(line)-1]
+    }
+    cells := []string{}
+    var cell strings.Builder
+    for i := 0; i < len(line); i++ {
+        switch {
+        case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+            cell.WriteByte('|')
+            i++
+        case line[i] == '|':
+            cells = append(cells, strings.TrimSpace(cell.String()))
+            cell.Reset()
+        default:
+            cell.WriteByte(line[i])
+        }
+    }
+    return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// isTableDelimiter reports whether line is a delimiter row of n columns.
+func isTableDelimiter(line string, n int) bool {
+    if !strings.Contains(line, "-") {
+        return false
+    }
+    cells := splitTableRow(line)
+    if len(cells) != n {
+        return false
+    }
+    for _, cell := range cells {
+        if !tableDelimiterCellRe.MatchString(cell) {
+            return false
+        }
+    }
+    return true
+}
+
+// -------------------------------------------------------
+// func markdownTables(content []byte) []NoteTable
+// -------------------------------------------------------
+// Purpose:
+//   - Every pipe table in the note in document order, with the
+//     heading it belongs to.
+// -------------------------------------------------------
+func markdownTables(content []byte) []NoteTable {
+    lines := splitTocLines(content)
+    headings := markdownHeadings(content)
+    tables := []NoteTable{}
+    sections := map[int]int{}
+
+    start := 0
+    if len(lines) > 0 && strings.TrimSpace(lines[0].text) == "---" {
+        for i := 1; i < len(lines); i++ {
+            if t := strings.TrimSpace(lines[i].text); t == "---" || t == "..." {
+                start = i + 1
+                break
+            }
+        }
+    }
+
+    fence := ""
+    for i := start; i < len(lines); i++ {
+        line := lines[i].text
+        if fence != "" {
+            if strings.HasPrefix(strings.TrimSpace(line), fence) && strings.Trim(strings.TrimSpace(line), fence[:1]) == "" {
+                fence = ""
+            }
+            continue
+        }
+        if marker := fenceMarker(line); marker != "" {
+            fence = marker
+            continue
+        }
+        if !strings.Contains(line, "|") || i+1 >= len(lines) {
+            continue
+        }
+        header := splitTableRow(line)
+        if !isTableDelimiter(lines[i+1].text, len(header)) {
+            continue
+        }
+
+        table := NoteTable{Index: len(tables) + 1, Line: i + 1, Header: header, Rows: [][]string{}}
+        section := -1
+        for h := range headings {
+            if headings[h].Offset < lines[i].offset {
+                section = h
+            }
+        }
+        if section >= 0 {
+            table.Heading = headings[section].Text
+            table.Slug = headings[section].Slug
+        }
+        sections[section]++
+        table.Section = sections[section]
+
+        for i += 2; i < len(lines); i++ {
+            row := lines[i].text
+            if strings.TrimSpace(row) == "" || !strings.Contains(row, "|") {
+                break
+            }
+            cells := splitTableRow(row)
+            for len(cells) < len(header) {
+                cells = append(cells, "")
+            }
+            table.Rows = append(table.Rows, cells[:len(header)])
+        }
+        i--
+        tables = append(tables, table)
+    }
+    return tables
+}
+
+// fileSafeName keeps letters, digits, '.', '_' and '-' of name.
+func fileSafeName(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r < utf8.RuneSelf && isWordByte(byte(r)) || r == '.' || r == '_' || r == '-' {
+            return r
+        }
+        return '_'
+    }, name)
+}
+
+// -------------------------------------------------------
+// func tableFileName(note string, table NoteTable, sectionTables int) string
+// -------------------------------------------------------
+// Purpose:
+//   - Base file name of a table: "<note>-<heading-slug>", with
+//     "-<n>" when its section has several tables, or
+//     "<note>-table-<index>" before the first heading.
+// -------------------------------------------------------
+func tableFileName(note string, table NoteTable, sectionTables int) string {
+    if table.Slug == "" {
+        return fileSafeName(fmt.Sprintf("%s-table-%d", note, table.Index))
+    }
+    name := note + "-" + table.Slug
+    if sectionTables > 1 {
+        name += "-" + strconv.Itoa(table.Section)
+    }
+    return fileSafeName(name)
+}
+
+// -------------------------------------------------------
+// func sheetNames(tables []NoteTable) []string
+// -------------------------------------------------------
+// Purpose:
+//   - A unique, Excel-valid sheet name per table: the heading text
+//     without []:*?/\ and cut to 31 characters, "Table <n>" without
+//     a heading; repeats get " (2)", " (3)", ...
+// -------------------------------------------------------
+func sheetNames(tables []NoteTable) []string {
+    names := make([]string, len(tables))
+    used := map[string]bool{}
+    for i, table := range tables {
+        base := strings.TrimSpace(strings.Map(func(r rune) rune {
+            if strings.ContainsRune(`[]:*?/\`, r) {
+                return -1
+            }
+            return r
+        }, table.Heading))
+        base = strings.Trim(base, "'")
+        if base == "" {
+            base = fmt.Sprintf("Table %d", table.Index)
+        }
+        name := truncateRunes(base, maxSheetName)
+        for n := 2; used[strings.ToLower(name)]; n++ {
+            suffix := fmt.Sprintf(" (%d)", n)
+            name = truncateRunes(base, maxSheetName-len(suffix)) + suffix
+        }
+        used[strings.ToLower(name)] = true
+        names[i] = name
+    }
+    return names
+}
+
+// truncateRunes cuts s to at most n runes.
+func truncateRunes(s string, n int) string {
+    runes := []rune(s)
+    if len(runes) > n {
+        return string(runes[:n])
+    }
+    return s
+}
+
+// csvSafeCell neutralizes cells a spreadsheet would read as a formula.
+func csvSafeCell(cell string) string {
+    if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) && !plainNumberRe.MatchString(cell) {
+        return "'" + cell
+    }
+    return cell
+}
+
+// writeTableCSV writes one table as CSV (header row first).
+func writeTableCSV(w io.Writer, table NoteTable) error {
+    out := csv.NewWriter(w)
+    for _, row := range append([][]string{table.Header}, table.Rows...) {
+        safe := make([]string, len(row))
+        for i, cell := range row {
+            safe[i] = csvSafeCell(cell)
+        }
+        if err := out.Write(safe); err != nil {
+            return err
+        }
+    }
+    out.Flush()
+    return out.Error()
+}
+
+// xlsxColumn is the spreadsheet column letter of index i (0 = A).
+func xlsxColumn(i int) string {
+    name := ""
+    for i++; i > 0; i = (i - 1) / 26 {
+        name = string(rune('A'+(i-1)%26)) + name
+    }
+    return name
+}
+
+// xmlEscape escapes s for XML text and attributes.
+func xmlEscape(s string) string {
+    var b bytes.Buffer
+    xml.EscapeText(&b, []byte(s))
+    return b.String()
+}
+
+// -------------------------------------------------------
+// func writeTablesXLSX(w io.Writer, tables []NoteTable) error
+// -------------------------------------------------------
+// Purpose:
+//   - A minimal Office Open XML workbook with one sheet per table.
+// Audit:
+//   - The header row is frozen at the top of each sheet.
+// -------------------------------------------------------
+func writeTablesXLSX(w io.Writer, tables []NoteTable) error {
+    names := sheetNames(tables)
+    var sheets, rels, overrides strings.Builder
+    for i, name := range names {
+        fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+        fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+        fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+    }
+
+    parts := []struct {
+        name string
+        body string
+    }{
+        {"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+            `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+            `<Default Extension="xml" ContentType="application/xml"/>` +
+            `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+            overrides.String() + `</Types>`},
+        {"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+            `</Relationships>`},
+        {"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+            `<sheets>` + sheets.String() + `</sheets></workbook>`},
+        {"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            rels.String() + `</Relationships>`},
+    }
+
+    archive := zip.NewWriter(w)
+    for _, part := range parts {
+        f, err := archive.Create(part.name)
+        if err != nil {
+            return err
+        }
+        if _, err := io.WriteString(f, part.body); err != nil {
+            return err
+        }
+    }
+    for i, table := range tables {
+        f, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+        if err != nil {
+            return err
+        }
+        if err := writeSheetXML(f, table); err != nil {
+            return err
+        }
+    }
+    return archive.Close()
+}
+
+// writeSheetXML writes the worksheet part of one table.
+func writeSheetXML(w io.Writer, table NoteTable) error {
+    var b strings.Builder
+    b.WriteString(xml.Header)
+    b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+    b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+    b.WriteString(`<sheetData>`)
+    for r, row := range append([][]string{table.Header}, table.Rows...) {
+        fmt.Fprintf(&b, `<row r="%d">`, r+1)
+        for c, cell := range row {
+            ref := xlsxColumn(c) + strconv.Itoa(r+1)
+            switch {
+            case cell == "":
+            case r > 0 && (plainNumberRe.MatchString(cell) || groupedNumberRe.MatchString(cell)):
+                fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strings.ReplaceAll(cell, ",", ""))
+            default:
+                fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(cell))
+            }
+        }
+        b.WriteString(`</row>`)
+    }
+    b.WriteString(`</sheetData></worksheet>`)
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+// -------------------------------------------------------
+// func HandleFileExport(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/export?path=...&format=csv|xlsx&table=n: download
+//     the note's tables; format=html|docx downloads the whole note.
+// Audit:
+//   - csv: a single table (the only one, or ?table=n) is sent as
+//     one .csv file; several are sent as a .zip of .csv files.
+//   - xlsx: one workbook; ?table=n limits it to one sheet.
+//   - A note without tables answers not_found.
+// -------------------------------------------------------
+func HandleFileExport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    query := r.URL.Query()
+    file := query.Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isNoteName(absPath) {
+        logError(r.Context(), "Invalid file path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    format := defaultString(query.Get("format"), "csv")
+    if !oneOf(format, []string{"csv", "xlsx", "html", "docx"}) {
+        writeFieldError(w, r, invalidField("format", "must be csv, xlsx, html or docx"))
+        return
+    }
+    if format == "html" || format == "docx" {
+        exportNoteDocument(w, r, absPath, format)
+        return
+    }
+
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for table export: "+absPath, "Internal error")
+        return
+    }
+    content, err = processContent(r.Context(), hookRead, relativeTo(r.Context(), absPath), content)
+    if err != nil {
+        writeProcessorError(w, r, relativeTo(r.Context(), absPath), err)
+        return
+    }
+    tables := markdownTables(content)
+    if len(tables) == 0 {
+        apierror.Write(w, r, apierror.CodeNotFound, "path", "Note has no tables")
+        return
+    }
+    perSection := map[string]int{}
+    for _, table := range tables {
+        perSection[table.Slug]++
+    }
+    if n := query.Get("table"); n != "" {
+        index, err := strconv.Atoi(n)
+        if err != nil || index < 1 || index > len(tables) {
+            writeFieldError(w, r, invalidField("table", "must be between 1 and %d", len(tables)))
+            return
+        }
+        tables = tables[index-1 : index]
+    }
+
+    rel := relativeTo(r.Context(), absPath)
+    note := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+    var body bytes.Buffer
+    var name, contentType string
+    switch {
+    case format == "xlsx":
+        name, contentType = fileSafeName(note)+".xlsx", xlsxContentType
+        if len(tables) == 1 {
+            name = tableFileName(note, tables[0], perSection[tables[0].Slug]) + ".xlsx"
+        }
+        err = writeTablesXLSX(&body, tables)
+    case len(tables) == 1:
+        name, contentType = tableFileName(note, tables[0], perSection[tables[0].Slug])+".csv", "text/csv; charset=utf-8"
+        err = writeTableCSV(&body, tables[0])
+    default:
+        name, contentType = fileSafeName(note)+"-tables.zip", "application/zip"
+        archive := zip.NewWriter(&body)
+        for _, table := range tables {
+            f, createErr := archive.Create(tableFileName(note, table, perSection[table.Slug]) + ".csv")
+            if createErr != nil {
+                err = createErr
+                break
+            }
+            if err = writeTableCSV(f, table); err != nil {
+                break
+            }
+        }
+        if closeErr := archive.Close(); err == nil {
+            err = closeErr
+        }
+    }
+    if err != nil {
+        logError(r.Context(), "Table export failed for "+rel+": "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Export failed")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Exported %d tables from %s as %s", len(tables), rel, format))
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "file.export",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(r.Context()),
+        Target:   rel,
+        Detail:   fmt.Sprintf("format=%s tables=%d", format, len(tables)),
+    })
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+    w.Write(body.Bytes())
+}
@@ -0,0 +1,376 @@
+// -------------------------------------------------------
+// backend/handlers/tasks.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Checklists across the scratchpad: "- [ ]" and "- [x]" items
+//     are parsed from every note on save into the metadata index.
+//       GET   /tasks   open tasks of all notes, by due date
+//       PATCH /tasks   check or uncheck one task in its note
+//   - A due date is read from the task's own line: "due: 2025-10-15",
+//     "due 2025-10-15", "@due(2025-10-15)" or "📅 2025-10-15".
+// Audit:
+//   - List markers -, * and + and numbered items ("1.") count;
+//     items inside fenced code blocks do not.
+//   - PATCH rewrites only the box of the named line and saves the
+//     note like any other save (save processors, index, journal,
+//     revision). It is refused with 409 when that line is no longer
+//     a task, or when base_sha256 is given and the note has changed
+//     since.
+//   - Approved, archived and ledger notes are not rewritten. Toggles
+//     write "task.toggle".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    defaultTaskLimit = 500
+    maxTaskLimit     = 5000
+    taskStatusOpen   = "open"
+    taskStatusDone   = "done"
+    taskStatusAll    = "all"
+)
+
+var (
+    // taskLinePattern finds a checklist item: indent and marker (1),
+    // box state (2), text (3).
+    taskLinePattern = regexp.MustCompile(`^(\s*(?:[-*+]|\d{1,9}[.)])\s+)\[([ xX])\](?:\s+(.*))?$`)
+
+    // taskDuePattern finds the due date on a task line (group 1).
+    taskDuePattern = regexp.MustCompile(`(?i)(?:\bdue:?\s*|@due\(|📅\s*)(\d{4}-\d{2}-\d{2})`)
+)
+
+// -------------------------------------------------------
+// type NoteTask / Task
+// -------------------------------------------------------
+// Purpose:
+//   - One checklist item of a note (NoteTask, as indexed) and the
+//     same with its note's path (Task, as answered).
+// Audit:
+//   - Line is 1-based. The index keeps an empty list for notes
+//     without tasks, so nil there means "not parsed yet".
+// -------------------------------------------------------
+type NoteTask struct {
+    Line int    `json:"line"`
+    Text string `json:"text"`
+    Done bool   `json:"done"`
+    Due  string `json:"due,omitempty"`
+}
+
+type Task struct {
+    Path string `json:"path"`
+    NoteTask
+}
+
+// -------------------------------------------------------
+// func parseTaskLine(line string) (NoteTask, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The task on one line of a note, if it holds one (Line unset).
+// -------------------------------------------------------
+func parseTaskLine(line string) (NoteTask, bool) {
+    match := taskLinePattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+    if match == nil {
+        return NoteTask{}, false
+    }
+    task := NoteTask{Text: strings.TrimSpace(match[3]), Done: match[2] != " "}
+    if due := taskDuePattern.FindStringSubmatch(task.Text); due != nil {
+        if _, err := time.Parse(frontmatterDueLayout, due[1]); err == nil {
+            task.Due = due[1]
+        }
+    }
+    return task, true
+}
+
+// -------------------------------------------------------
+// func parseTasks(data []byte) []NoteTask
+// -------------------------------------------------------
+// Purpose:
+//   - Every task of a note, in line order; never nil.
+// -------------------------------------------------------
+func parseTasks(data []byte) []NoteTask {
+    tasks := []NoteTask{}
+    fence := ""
+    for i, line := range strings.Split(string(data), "\n") {
+        trimmed := strings.TrimSpace(line)
+        if fence != "" {
+            if strings.HasPrefix(trimmed, fence) {
+                fence = ""
+            }
+            continue
+        }
+        if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+            fence = trimmed[:3]
+            continue
+        }
+        if task, ok := parseTaskLine(line); ok {
+            task.Line = i + 1
+            tasks = append(tasks, task)
+        }
+    }
+    return tasks
+}
+
+// -------------------------------------------------------
+// func noteTasks(ctx, index, rel) []NoteTask
+// -------------------------------------------------------
+// Purpose:
+//   - The indexed tasks of a note.
+// Audit:
+//   - Index entries from before tasks were indexed are parsed now
+//     and stored; unreadable notes have none.
+// -------------------------------------------------------
+func noteTasks(ctx context.Context, index map[string]IndexEntry, rel string) []NoteTask {
+    if entry := index[rel]; entry.Tasks != nil {
+        return entry.Tasks
+    }
+    data, err := readFile(ctx, sanitizePath(ctx, rel))
+    if err != nil {
+        return nil
+    }
+    tasks := parseTasks(data)
+    indexSetTasks(ctx, rel, tasks)
+    return tasks
+}
+
+// -------------------------------------------------------
+// func HandleTasks(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET: tasks across the scratchpad, sorted by due date (tasks
+//     without one last), then path and line.
+//       status      open (default) | done | all
+//       folder      one folder and its subfolders
+//       due_before, due_after   inclusive YYYY-MM-DD; tasks
+//                   without a due date are left out
+//       limit       default 500, max 5000
+//   - PATCH: see toggleTask.
+// Audit:
+//   - Notes in archived folders are not listed.
+// -------------------------------------------------------
+func HandleTasks(w http.ResponseWriter, r *http.Request) {
+    if r.Method == http.MethodPatch {
+        toggleTask(w, r)
+        return
+    }
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    q := r.URL.Query()
+    status := defaultString(q.Get("status"), taskStatusOpen)
+    if !oneOf(status, []string{taskStatusOpen, taskStatusDone, taskStatusAll}) {
+        writeFieldError(w, r, invalidField("status", "must be open, done, or all"))
+        return
+    }
+    scope := ""
+    if folder := q.Get("folder"); folder != "" {
+        absFolder := sanitizePath(r.Context(), folder)
+        if absFolder == "" {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "folder", "Invalid folder path")
+            return
+        }
+        if absFolder != scratchRoot(r.Context()) {
+            scope = relativeTo(r.Context(), absFolder) + "/"
+        }
+    }
+    dueBefore, dueAfter := q.Get("due_before"), q.Get("due_after")
+    for field, value := range map[string]string{"due_before": dueBefore, "due_after": dueAfter} {
+        if _, err := time.Parse(frontmatterDueLayout, value); value != "" && err != nil {
+            writeFieldError(w, r, invalidField(field, "must be a date (YYYY-MM-DD)"))
+            return
+        }
+    }
+    limit, err := searchIntParam(r, "limit", defaultTaskLimit, maxTaskLimit)
+    if err != nil {
+        writeFieldError(w, r, err)
+        return
+    }
+
+    index := indexSnapshot(r.Context())
+    tasks := []Task{}
+    for rel := range index {
+        if scope != "" && !strings.HasPrefix(rel, scope) {
+            continue
+        }
+        if _, _, archived := archivedFolderFor(r.Context(), rel); archived {
+            continue
+        }
+        for _, task := range noteTasks(r.Context(), index, rel) {
+            if status == taskStatusOpen && task.Done || status == taskStatusDone && !task.Done {
+                continue
+            }
+            if (dueBefore != "" || dueAfter != "") && task.Due == "" {
+                continue
+            }
+            if dueBefore != "" && task.Due > dueBefore || dueAfter != "" && task.Due < dueAfter {
+                continue
+            }
+            tasks = append(tasks, Task{Path: rel, NoteTask: task})
+        }
+    }
+    sort.Slice(tasks, func(i, j int) bool {
+        a, b := tasks[i], tasks[j]
+        if a.Due != b.Due {
+            return b.Due == "" || a.Due != "" && a.Due < b.Due
+        }
+        if a.Path != b.Path {
+            return a.Path < b.Path
+        }
+        return a.Line < b.Line
+    })
+    truncated := len(tasks) > limit
+    if truncated {
+        tasks = tasks[:limit]
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Listed %d %s tasks under %s", len(tasks), status, defaultString(scope, "/")))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "tasks":     tasks,
+        "truncated": truncated,
+    })
+}
+
+// -------------------------------------------------------
+// func toggleTask(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - PATCH /tasks {"path", "line", "done", "base_sha256"}: set the
+//     box of the task on line; without done it is flipped.
+//   - Answers the task as it now reads and the note's new hash.
+// Audit:
+//   - Read, check and write happen under conflictMu, like
+//     base-checked saves, so a concurrent save cannot be lost.
+// -------------------------------------------------------
+func toggleTask(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Path       string `json:"path"`
+        Line       int    `json:"line"`
+        Done       *bool  `json:"done"`
+        BaseSHA256 string `json:"base_sha256"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    if req.Line < 1 {
+        writeFieldError(w, r, invalidField("line", "must be a line number (1 or more)"))
+        return
+    }
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+    if rejectIfArchived(w, r, absPath) || rejectIfApproved(w, r, absPath) {
+        return
+    }
+    if isLedger(r.Context(), rel) {
+        apierror.Write(w, r, apierror.CodeLedgerViolation, "path", "Ledger notes only accept appends: "+rel)
+        return
+    }
+
+    ctx := r.Context()
+    conflictMu.Lock()
+    content, err := readFile(ctx, absPath)
+    if err != nil {
+        conflictMu.Unlock()
+        writeStorageError(w, r, err, "read file: "+absPath, "Internal error")
+        return
+    }
+    if req.BaseSHA256 != "" && contentHash(content) != req.BaseSHA256 {
+        conflictMu.Unlock()
+        apierror.WriteDetails(w, r, apierror.CodeConflict, "base_sha256", "note changed since it was loaded",
+            map[string]interface{}{"path": rel, "sha256": contentHash(content)})
+        return
+    }
+    lines := strings.Split(string(content), "\n")
+    var task NoteTask
+    ok := false
+    if req.Line <= len(lines) {
+        task, ok = parseTaskLine(lines[req.Line-1])
+    }
+    if ok {
+        ok = false
+        for _, parsed := range parseTasks(content) {
+            // A "- [ ]" inside a code block is not a task.
+            ok = ok || parsed.Line == req.Line
+        }
+    }
+    if !ok {
+        conflictMu.Unlock()
+        apierror.WriteDetails(w, r, apierror.CodeConflict, "line", fmt.Sprintf("line %d is not a task", req.Line),
+            map[string]interface{}{"path": rel, "sha256": contentHash(content)})
+        return
+    }
+    done := !task.Done
+    if req.Done != nil {
+        done = *req.Done
+    }
+    updated := content
+    changed := done != task.Done
+    if changed {
+        match := taskLinePattern.FindStringSubmatchIndex(strings.TrimRight(lines[req.Line-1], "\r"))
+        box := " "
+        if done {
+            box = "x"
+        }
+        line := lines[req.Line-1]
+        lines[req.Line-1] = line[:match[4]] + box + line[match[5]:]
+        updated, err = processContent(ctx, hookSave, rel, []byte(strings.Join(lines, "\n")))
+        if err != nil {
+            conflictMu.Unlock()
+            writeProcessorError(w, r, rel, err)
+            return
+        }
+        if rejectIfDangerous(w, r, rel, updated) {
+            conflictMu.Unlock()
+            return
+        }
+        err = writeFile(ctx, absPath, updated)
+    }
+    conflictMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "save file: "+absPath, "Write failed")
+        return
+    }
+    task.Line, task.Done = req.Line, done
+
+    if changed {
+        indexUpdate(ctx, rel, updated)
+        journalPutEntry(ctx, rel, updated)
+        flagSignedChange(r, rel, updated)
+    }
+    logInfo(ctx, fmt.Sprintf("Task on line %d of %s set done=%t", req.Line, rel, done))
+    audit.WriteContext(ctx, audit.Event{
+        Event:    "task.toggle",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   http.StatusOK,
+        Actor:    actorName(ctx),
+        Target:   rel,
+        Detail:   fmt.Sprintf("line=%d done=%t", req.Line, done),
+    })
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "task":   Task{Path: rel, NoteTask: task},
+        "sha256": contentHash(updated),
+    })
+}
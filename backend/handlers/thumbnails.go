@@ -0,0 +1,286 @@
+// -------------------------------------------------------
+// backend/handlers/thumbnails.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /attachments/thumb?path=...&w=256: a small version of an
+//     image attachment, so attachment lists show previews without
+//     downloading full-resolution screenshots.
+// Audit:
+//   - Attachments are the files of the raw folders (raw.go); other
+//     paths answer 403. PNG, JPEG and GIF (first frame) are
+//     thumbnailed; other types answer 422 invalid_content.
+//   - w is the width in pixels (16-1024, default 256); the height
+//     keeps the aspect ratio. An image no wider than w is sent as
+//     it is. Thumbnails are JPEG for JPEG sources, PNG otherwise.
+//   - Cached in .scratchpad/thumbnails by content hash and width, so
+//     a replaced attachment gets a new thumbnail and identical
+//     images share one. A cache hit refreshes the file's time;
+//     compaction removes thumbnails unused for thumbnailIdleDays.
+//   - Sources over maxThumbnailPixels are refused (422) before they
+//     are decoded. One thumbnail is generated at a time.
+//   - Served with an ETag; every request is a "file.read" of the
+//     attachment with detail "thumbnail".
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/gif"
+    "image/jpeg"
+    "image/png"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    thumbnailsDir         = "thumbnails"
+    thumbnailDefaultWidth = 256
+    minThumbnailWidth     = 16
+    maxThumbnailWidth     = 1024
+    maxThumbnailPixels    = 40000000
+    thumbnailIdleDays     = 30
+    thumbnailJPEGQuality  = 80
+)
+
+// thumbnailsMu serializes generation: decoding is memory-heavy.
+var thumbnailsMu sync.Mutex
+
+// thumbnailName is the metadata name of the cached thumbnail.
+func thumbnailName(sha string, width int, ext string) string {
+    return filepath.Join(thumbnailsDir, sha[:2], fmt.Sprintf("%s-%d%s", sha, width, ext))
+}
+
+// -------------------------------------------------------
+// func scaleImage(src image.Image, width int) *image.RGBA
+// -------------------------------------------------------
+// Purpose:
+//   - Shrink src to width pixels wide by averaging the source pixels
+//     that fall on each target pixel.
+// Audit:
+//   - Only for width < the source width; every target pixel then
+//     receives at least one source pixel.
+// -------------------------------------------------------
+func scaleImage(src image.Image, width int) *image.RGBA {
+    b := src.Bounds()
+    sw, sh := b.Dx(), b.Dy()
+    height := max(1, (sh*width+sw/2)/sw)
+    sums := make([]uint64, width*height*5)
+    for y := 0; y < sh; y++ {
+        row := y * height / sh * width
+        for x := 0; x < sw; x++ {
+            r, g, bl, a := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+            i := (row + x*width/sw) * 5
+            sums[i] += uint64(r)
+            sums[i+1] += uint64(g)
+            sums[i+2] += uint64(bl)
+            sums[i+3] += uint64(a)
+            sums[i+4]++
+        }
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, width, height))
+    for i := 0; i < width*height; i++ {
+        n := sums[i*5+4]
+        for c := 0; c < 4; c++ {
+            dst.Pix[i*4+c] = uint8(sums[i*5+c] / n >> 8)
+        }
+    }
+    return dst
+}
+
+// -------------------------------------------------------
+// func makeThumbnail(data []byte, width int) ([]byte, string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The thumbnail of an image and its MIME type; data itself when
+//     the image is not wider than width.
+// Audit:
+//   - Errors wrap errThumbnailType or errThumbnailTooLarge for
+//     sources that cannot be thumbnailed.
+// -------------------------------------------------------
+func makeThumbnail(data []byte, width int) ([]byte, string, error) {
+    config, format, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", fmt.Errorf("%w (%v)", errThumbnailType, err)
+    }
+    if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxThumbnailPixels {
+        return nil, "", fmt.Errorf("%w: %dx%d", errThumbnailTooLarge, config.Width, config.Height)
+    }
+    contentType := "image/" + format
+    if config.Width <= width {
+        return data, contentType, nil
+    }
+    src, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", fmt.Errorf("decode %s: %v", format, err)
+    }
+    dst := scaleImage(src, width)
+    var out bytes.Buffer
+    if format == "jpeg" {
+        err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: thumbnailJPEGQuality})
+    } else {
+        contentType = "image/png"
+        err = png.Encode(&out, dst)
+    }
+    if err != nil {
+        return nil, "", err
+    }
+    return out.Bytes(), contentType, nil
+}
+
+var (
+    errThumbnailType     = errors.New("not a PNG, JPEG or GIF image")
+    errThumbnailTooLarge = fmt.Errorf("image has more than %d pixels", maxThumbnailPixels)
+)
+
+// -------------------------------------------------------
+// func cachedThumbnail(ctx, sha string, width int, data []byte) ([]byte, string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The thumbnail of data (whose hash is sha) from the cache,
+//     generating and storing it on a miss.
+// Audit:
+//   - A failed cache write is logged; the thumbnail is still sent.
+// -------------------------------------------------------
+func cachedThumbnail(ctx context.Context, sha string, width int, data []byte) ([]byte, string, error) {
+    store := serverFrom(ctx).Storage
+    for _, candidate := range []struct{ ext, contentType string }{{".jpg", "image/jpeg"}, {".png", "image/png"}} {
+        path := metaPath(ctx, thumbnailName(sha, width, candidate.ext))
+        if thumb, err := store.ReadFile(path); err == nil {
+            store.Chtimes(path, timeNow(ctx))
+            return thumb, candidate.contentType, nil
+        }
+    }
+
+    thumbnailsMu.Lock()
+    defer thumbnailsMu.Unlock()
+    thumb, contentType, err := makeThumbnail(data, width)
+    if err != nil {
+        return nil, "", err
+    }
+    if len(thumb) != len(data) || !bytes.Equal(thumb, data) {
+        ext := ".png"
+        if contentType == "image/jpeg" {
+            ext = ".jpg"
+        }
+        if err := writeMetaFile(ctx, thumbnailName(sha, width, ext), thumb); err != nil {
+            logError(ctx, "Failed to cache thumbnail "+sha+": "+err.Error())
+        }
+    }
+    return thumb, contentType, nil
+}
+
+// -------------------------------------------------------
+// func compactThumbnails(ctx, now, report) ([]compactCandidate, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Measure the thumbnail cache and pick thumbnails not served for
+//     thumbnailIdleDays; they are regenerated on demand.
+// -------------------------------------------------------
+func compactThumbnails(ctx context.Context, now time.Time, report *CompactReport) ([]compactCandidate, error) {
+    category := CompactCategory{Name: "thumbnails", Kept: fmt.Sprintf("%d days since last use", thumbnailIdleDays)}
+    cutoff := now.AddDate(0, 0, -thumbnailIdleDays)
+    candidates := []compactCandidate{}
+    err := serverFrom(ctx).Storage.Walk(metaPath(ctx, thumbnailsDir), func(path string, info os.FileInfo, err error) error {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if !info.Mode().IsRegular() {
+            return nil
+        }
+        category.Items++
+        category.Bytes += info.Size()
+        if info.ModTime().Before(cutoff) {
+            candidates = append(candidates, compactCandidate{path: path, bytes: info.Size()})
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    category.Collectable = len(candidates)
+    report.Categories = append(report.Categories, category)
+    return candidates, nil
+}
+
+// -------------------------------------------------------
+// func HandleAttachmentThumb(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /attachments/thumb?path=...&w=...: the thumbnail image.
+// Audit:
+//   - If-None-Match with the current ETag answers 304.
+// -------------------------------------------------------
+func HandleAttachmentThumb(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    query := r.URL.Query()
+    file := query.Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    width := thumbnailDefaultWidth
+    if raw := query.Get("w"); raw != "" {
+        n, err := strconv.Atoi(raw)
+        if err != nil || n < minThumbnailWidth || n > maxThumbnailWidth {
+            writeFieldError(w, r, invalidField("w", "must be %d-%d", minThumbnailWidth, maxThumbnailWidth))
+            return
+        }
+        width = n
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || absPath == scratchRoot(r.Context()) || isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid attachment path")
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+    if rejectIfNotRaw(w, r, rel) {
+        return
+    }
+    ctx := r.Context()
+    data, err := readNote(ctx, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read attachment: "+absPath, "Internal error")
+        return
+    }
+
+    sha := contentHash(data)
+    etag := fmt.Sprintf(`"%s-%d"`, sha, width)
+    if strings.Contains(r.Header.Get("If-None-Match"), etag) {
+        w.Header().Set("ETag", etag)
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    thumb, contentType, err := cachedThumbnail(r.Context(), sha, width, data)
+    switch {
+    case errors.Is(err, errThumbnailType) || errors.Is(err, errThumbnailTooLarge):
+        apierror.Write(w, r, apierror.CodeInvalidContent, "path", "Cannot thumbnail "+rel+": "+err.Error())
+        return
+    case err != nil:
+        writeStorageError(w, r, err, "thumbnail "+absPath, "Internal error")
+        return
+    }
+
+    auditFileRead(r, absPath, "thumbnail")
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("ETag", etag)
+    w.Header().Set("Cache-Control", "private, max-age=86400")
+    w.Write(thumb)
+}
@@ -0,0 +1,308 @@
+// -------------------------------------------------------
+// backend/handlers/toc.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - GET /file/toc?path=...: the heading hierarchy of a Markdown
+//     (.md) note with byte offsets, for an outline sidebar and deep
+//     links to sections of long notes.
+// Audit:
+//   - ATX ("## Title") and setext (underlined) headings are found;
+//     fenced code blocks and a leading YAML front matter block are
+//     skipped, so "# comment" lines in code are not headings.
+//   - Read-only; archived notes are read from their archive.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "unicode"
+
+    "cfo-scratchpad/apierror"
+)
+
+// -------------------------------------------------------
+// type TocEntry
+// -------------------------------------------------------
+// Purpose:
+//   - One heading and the headings nested below it.
+// Audit:
+//   - Offset is the byte offset of the heading line; End is where
+//     its section ends (the next heading of the same or a higher
+//     level, or the end of the note).
+//   - Slug is a GitHub-style anchor, unique within the note
+//     ("-1", "-2" are appended to repeats).
+//   - Children is never null.
+// -------------------------------------------------------
+type TocEntry struct {
+    Level    int        `json:"level"`
+    Text     string     `json:"text"`
+    Slug     string     `json:"slug"`
+    Line     int        `json:"line"`
+    Offset   int        `json:"offset"`
+    End      int        `json:"end"`
+    Children []TocEntry `json:"children"`
+}
+
+// tocLine is one line of a note and where it starts.
+type tocLine struct {
+    text   string
+    offset int
+}
+
+// splitTocLines splits content into lines without line endings.
+func splitTocLines(content []byte) []tocLine {
+    lines := []tocLine{}
+    for offset := 0; offset < len(content); {
+        end := bytes.IndexByte(content[offset:], '\n')
+        next := offset + end + 1
+        if end < 0 {
+            end = len(content) - offset
+            next = len(content)
+        }
+        lines = append(lines, tocLine{text: strings.TrimSuffix(string(content[offset:offset+end]), "\r"), offset: offset})
+        offset = next
+    }
+    return lines
+}
+
+// -------------------------------------------------------
+// func atxHeading(line string) (int, string, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - Level and text of an ATX heading ("### Text ##").
+// Audit:
+//   - Up to three leading spaces; the #'s must be followed by a
+//     space or end the line; a closing run of #'s is dropped.
+// -------------------------------------------------------
+func atxHeading(line string) (int, string, bool) {
+    trimmed := strings.TrimLeft(line, " ")
+    if len(line)-len(trimmed) > 3 {
+        return 0, "", false
+    }
+    level := 0
+    for level < len(trimmed) && trimmed[level] == '#' {
+        level++
+    }
+    if level == 0 || level > 6 {
+        return 0, "", false
+    }
+    rest := trimmed[level:]
+    if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+        return 0, "", false
+    }
+    text := strings.TrimSpace(rest)
+    if closing := strings.TrimRight(text, "#"); closing == "" || strings.HasSuffix(closing, " ") || strings.HasSuffix(closing, "\t") {
+        text = strings.TrimSpace(closing)
+    }
+    return level, text, true
+}
+
+// setextLevel is 1 for "===" and 2 for "---" underlines, else 0.
+func setextLevel(line string) int {
+    trimmed := strings.TrimSpace(line)
+    if trimmed == "" || len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+        return 0
+    }
+    switch {
+    case strings.Trim(trimmed, "=") == "":
+        return 1
+    case strings.Trim(trimmed, "-") == "":
+        return 2
+    }
+    return 0
+}
+
+// fenceMarker returns the fence ("```" or "~~~" run) opening a code block.
+func fenceMarker(line string) string {
+    trimmed := strings.TrimLeft(line, " ")
+    if len(line)-len(trimmed) > 3 {
+        return ""
+    }
+    for _, c := range []string{"`", "~"} {
+        n := len(trimmed) - len(strings.TrimLeft(trimmed, c))
+        if n >= 3 {
+            return strings.Repeat(c, n)
+        }
+    }
+    return ""
+}
+
+// -------------------------------------------------------
+// func headingSlug(text string, seen map[string]int) string
+// -------------------------------------------------------
+// Purpose:
+//   - Anchor for a heading: lowercase, punctuation dropped, spaces
+//     to '-', made unique with a counter.
+// -------------------------------------------------------
+func headingSlug(text string, seen map[string]int) string {
+    var b strings.Builder
+    for _, r := range strings.ToLower(text) {
+        switch {
+        case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+            b.WriteRune(r)
+        case r == ' ':
+            b.WriteRune('-')
+        }
+    }
+    slug := b.String()
+    n := seen[slug]
+    seen[slug] = n + 1
+    if n > 0 {
+        slug = fmt.Sprintf("%s-%d", slug, n)
+    }
+    return slug
+}
+
+// -------------------------------------------------------
+// func markdownHeadings(content []byte) []TocEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Every heading in document order, without nesting.
+// Audit:
+//   - A setext underline only counts below a paragraph line, so a
+//     "---" after a blank line stays a thematic break.
+// -------------------------------------------------------
+func markdownHeadings(content []byte) []TocEntry {
+    lines := splitTocLines(content)
+    headings := []TocEntry{}
+    seen := map[string]int{}
+    add := func(level int, text string, index int) {
+        headings = append(headings, TocEntry{
+            Level:    level,
+            Text:     text,
+            Slug:     headingSlug(text, seen),
+            Line:     index + 1,
+            Offset:   lines[index].offset,
+            Children: []TocEntry{},
+        })
+    }
+
+    start := 0
+    if len(lines) > 0 && strings.TrimSpace(lines[0].text) == "---" {
+        for i := 1; i < len(lines); i++ {
+            if t := strings.TrimSpace(lines[i].text); t == "---" || t == "..." {
+                start = i + 1
+                break
+            }
+        }
+    }
+
+    fence := ""
+    paragraph := -1
+    for i := start; i < len(lines); i++ {
+        line := lines[i].text
+        if fence != "" {
+            if strings.HasPrefix(strings.TrimSpace(line), fence) && strings.Trim(strings.TrimSpace(line), fence[:1]) == "" {
+                fence = ""
+            }
+            continue
+        }
+        if marker := fenceMarker(line); marker != "" {
+            fence = marker
+            paragraph = -1
+            continue
+        }
+        if level, text, ok := atxHeading(line); ok {
+            add(level, text, i)
+            paragraph = -1
+            continue
+        }
+        if level := setextLevel(line); level > 0 && paragraph >= 0 {
+            add(level, strings.TrimSpace(lines[paragraph].text), paragraph)
+            paragraph = -1
+            continue
+        }
+        if strings.TrimSpace(line) == "" {
+            paragraph = -1
+            continue
+        }
+        paragraph = i
+    }
+
+    for i := range headings {
+        headings[i].End = len(content)
+        for _, later := range headings[i+1:] {
+            if later.Level <= headings[i].Level {
+                headings[i].End = later.Offset
+                break
+            }
+        }
+    }
+    return headings
+}
+
+// -------------------------------------------------------
+// func nestHeadings(headings []TocEntry) []TocEntry
+// -------------------------------------------------------
+// Purpose:
+//   - Nest each heading under the nearest preceding heading of a
+//     lower level.
+// Audit:
+//   - Skipped levels (# then ###) nest directly; a note starting
+//     at ## has ## entries at the top.
+// -------------------------------------------------------
+func nestHeadings(headings []TocEntry) []TocEntry {
+    var build func(i int, parent int) ([]TocEntry, int)
+    build = func(i int, parent int) ([]TocEntry, int) {
+        entries := []TocEntry{}
+        for i < len(headings) && headings[i].Level > parent {
+            entry := headings[i]
+            entry.Children, i = build(i+1, entry.Level)
+            entries = append(entries, entry)
+        }
+        return entries, i
+    }
+    entries, _ := build(0, 0)
+    return entries
+}
+
+// -------------------------------------------------------
+// func HandleFileToc(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/toc?path=...: {"path", "headings"} for a .md note.
+// Audit:
+//   - Non-Markdown notes answer invalid_path.
+// -------------------------------------------------------
+func HandleFileToc(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    file := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !strings.HasSuffix(absPath, markdownExt) {
+        logError(r.Context(), "Invalid Markdown path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Table of contents needs a .md note")
+        return
+    }
+
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for toc: "+absPath, "Internal error")
+        return
+    }
+    content, err = processContent(r.Context(), hookRead, relativeTo(r.Context(), absPath), content)
+    if err != nil {
+        writeProcessorError(w, r, relativeTo(r.Context(), absPath), err)
+        return
+    }
+
+    headings := markdownHeadings(content)
+    logInfo(r.Context(), fmt.Sprintf("Table of contents for %s: %d headings", relativeTo(r.Context(), absPath), len(headings)))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "path":     relativeTo(r.Context(), absPath),
+        "headings": nestHeadings(headings),
+    })
+}
@@ -0,0 +1,569 @@
+// -------------------------------------------------------
+// backend/handlers/totp.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Two-factor authentication with TOTP authenticator apps:
+//       GET  /auth/totp                     enrollment status
+//       POST /auth/totp/enroll              start: new secret + URI
+//       GET  /auth/totp/qr.svg              QR code of a pending secret
+//       POST /auth/totp/confirm {"code"}    finish: recovery codes
+//       POST /auth/totp/recovery-codes      replace recovery codes
+//       POST /auth/totp/disable             remove the second factor
+//       POST /admin/totp/reset {"user"}     admin: remove a user's
+//   - Secrets live in .scratchpad/keys/totp.json (mode 0600).
+// Audit:
+//   - Confirm, disable, new recovery codes, recovery code use and
+//     admin reset write "auth.totp_enroll", "auth.totp_disable",
+//     "auth.totp_recovery_codes", "auth.totp_recovery_used" and
+//     "admin.totp_reset".
+//   - Wrong codes count towards the login throttle of both the user
+//     ("user:<name>") and the client ("ip:<address>"), and are
+//     audited as "auth.totp_failed".
+//   - A secret is shown only while enrollment is pending; recovery
+//     codes only when they are issued.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/qrcode"
+)
+
+const (
+    totpFile          = "keys/totp.json"
+    recoveryCodeCount = 10
+)
+
+// totpMu guards totp.json.
+var totpMu sync.Mutex
+
+// totpRecord is one user's second factor as stored on disk.
+type totpRecord struct {
+    Secret        string   `json:"secret"`
+    Confirmed     bool     `json:"confirmed"`
+    CreatedAt     string   `json:"created_at"`
+    ConfirmedAt   string   `json:"confirmed_at,omitempty"`
+    LastStep      int64    `json:"last_step,omitempty"`
+    RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// -------------------------------------------------------
+// type TOTPStatus
+// -------------------------------------------------------
+// Purpose:
+//   - GET /auth/totp response.
+// -------------------------------------------------------
+type TOTPStatus struct {
+    User              string `json:"user"`
+    Enrolled          bool   `json:"enrolled"`
+    Pending           bool   `json:"pending"`
+    Required          bool   `json:"required"`
+    RecoveryCodesLeft int    `json:"recovery_codes_left"`
+}
+
+// loadTOTPLocked reads totp.json. Caller holds totpMu.
+func loadTOTPLocked(ctx context.Context) (map[string]totpRecord, error) {
+    records := map[string]totpRecord{}
+    if err := loadMetaJSON(ctx, totpFile, &records); err != nil {
+        return nil, err
+    }
+    if records == nil {
+        records = map[string]totpRecord{}
+    }
+    return records, nil
+}
+
+// saveTOTPLocked writes totp.json readable by the service only.
+func saveTOTPLocked(ctx context.Context, records map[string]totpRecord) error {
+    data, err := json.MarshalIndent(records, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeMetaFilePerm(ctx, totpFile, data, 0600)
+}
+
+// -------------------------------------------------------
+// func TOTPEnrolled(ctx context.Context, user string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether user has a confirmed second factor.
+// -------------------------------------------------------
+func TOTPEnrolled(ctx context.Context, user string) bool {
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(ctx)
+    if err != nil {
+        logError(ctx, "Failed to load TOTP records: "+err.Error())
+        return false
+    }
+    return records[user].Confirmed
+}
+
+// -------------------------------------------------------
+// func verifySecondFactor(r, user, code, recoveryCode) (bool, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Check a TOTP code (or, if given instead, a recovery code)
+//     against the user's confirmed secret and consume it.
+// Audit:
+//   - A used recovery code is removed and "auth.totp_recovery_used"
+//     written with the number left.
+// -------------------------------------------------------
+func verifySecondFactor(r *http.Request, user string, code string, recoveryCode string) (bool, error) {
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        return false, err
+    }
+    record, ok := records[user]
+    if !ok || !record.Confirmed {
+        return false, nil
+    }
+
+    if recoveryCode != "" {
+        hash := auth.HashRecoveryCode(recoveryCode)
+        for i, stored := range record.RecoveryCodes {
+            if stored != hash {
+                continue
+            }
+            record.RecoveryCodes = append(record.RecoveryCodes[:i:i], record.RecoveryCodes[i+1:]...)
+            records[user] = record
+            if err := saveTOTPLocked(r.Context(), records); err != nil {
+                return false, err
+            }
+            auditAuth(r, "auth.totp_recovery_used", http.StatusOK, user, fmt.Sprintf("%d recovery codes left", len(record.RecoveryCodes)))
+            return true, nil
+        }
+        return false, nil
+    }
+
+    step, ok := auth.VerifyTOTP(record.Secret, code, timeNow(r.Context()), record.LastStep)
+    if !ok {
+        return false, nil
+    }
+    record.LastStep = step
+    records[user] = record
+    return true, saveTOTPLocked(r.Context(), records)
+}
+
+// -------------------------------------------------------
+// func checkSecondFactor(w, r, user, code, recoveryCode) bool
+// -------------------------------------------------------
+// Purpose:
+//   - verifySecondFactor behind the throttles of the user and the
+//     client address; answers 429, 401 or 500 itself and returns
+//     false on any failure.
+// Audit:
+//   - A lockout of either key refuses the attempt, so guesses spread
+//     over many addresses still lock the user, and one address
+//     cannot work through several users.
+// -------------------------------------------------------
+func checkSecondFactor(w http.ResponseWriter, r *http.Request, user string, code string, recoveryCode string) bool {
+    keys := []string{"ip:" + clientAddr(r), auth.UserThrottleKey(user)}
+    now := timeNow(r.Context())
+    if key, wait, locked := auth.ThrottleWaitAny(keys, now); wait > 0 {
+        seconds := int((wait + time.Second - 1) / time.Second)
+        detail := fmt.Sprintf("delayed %ds", seconds)
+        if locked {
+            detail = fmt.Sprintf("locked out %ds", seconds)
+        }
+        auditAuth(r, "auth.throttled", http.StatusTooManyRequests, key, detail)
+        w.Header().Set("Retry-After", strconv.Itoa(seconds))
+        apierror.Write(w, r, apierror.CodeRateLimited, "", "Too many failed attempts; retry later")
+        return false
+    }
+    if code == "" && recoveryCode == "" {
+        apierror.Write(w, r, apierror.CodeMissingField, "code", "Missing required field: code")
+        return false
+    }
+
+    ok, err := verifySecondFactor(r, user, code, recoveryCode)
+    if err != nil {
+        writeStorageError(w, r, err, "verify second factor for "+user, "Internal server error")
+        return false
+    }
+    if !ok {
+        for _, key := range keys {
+            failures, lockedUntil := auth.ThrottleFail(key, now)
+            if key == auth.UserThrottleKey(user) {
+                auditAuth(r, "auth.totp_failed", http.StatusUnauthorized, user, fmt.Sprintf("failure %d", failures))
+            }
+            if !lockedUntil.IsZero() {
+                auditAuth(r, "auth.lockout", http.StatusUnauthorized, key,
+                    fmt.Sprintf("%d failures; locked until %s", failures, lockedUntil.UTC().Format(time.RFC3339)))
+            }
+        }
+        apierror.Write(w, r, apierror.CodeUnauthorized, "code", "Invalid authentication code")
+        return false
+    }
+    auth.ThrottleReset(auth.UserThrottleKey(user))
+    return true
+}
+
+// auditAuth writes a sign-in or second factor audit event.
+func auditAuth(r *http.Request, event string, status int, target string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actorName(r.Context()),
+        Target:   target,
+        Detail:   detail,
+    })
+}
+
+// -------------------------------------------------------
+// func HandleTOTP(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /auth/totp: the caller's enrollment status.
+// -------------------------------------------------------
+func HandleTOTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    totpMu.Lock()
+    records, err := loadTOTPLocked(r.Context())
+    totpMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    record, exists := records[user.Name]
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(TOTPStatus{
+        User:              user.Name,
+        Enrolled:          record.Confirmed,
+        Pending:           exists && !record.Confirmed,
+        Required:          auth.MFARequired(currentConfig(r.Context()), user),
+        RecoveryCodesLeft: len(record.RecoveryCodes),
+    })
+}
+
+// -------------------------------------------------------
+// func HandleTOTPEnroll(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/totp/enroll: create a pending secret and answer
+//     {"secret", "otpauth_uri", "qr_svg"} for the authenticator app.
+// Audit:
+//   - 409 when a confirmed second factor exists (disable it first).
+//   - Starting again replaces a pending secret.
+// -------------------------------------------------------
+func HandleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    if records[user.Name].Confirmed {
+        apierror.Write(w, r, apierror.CodeConflict, "", "Two-factor authentication is already enrolled; disable it first")
+        return
+    }
+    secret := auth.NewTOTPSecret()
+    records[user.Name] = totpRecord{Secret: secret, CreatedAt: utcNow(r.Context())}
+    if err := saveTOTPLocked(r.Context(), records); err != nil {
+        writeStorageError(w, r, err, "save TOTP records", "Internal server error")
+        return
+    }
+
+    logInfo(r.Context(), "TOTP enrollment started for "+user.Name)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]string{
+        "secret":      secret,
+        "otpauth_uri": auth.ProvisioningURI(currentConfig(r.Context()).MFA.Issuer, user.Name, secret),
+        "qr_svg":      "/auth/totp/qr.svg",
+    })
+}
+
+// -------------------------------------------------------
+// func HandleTOTPQR(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /auth/totp/qr.svg: the pending provisioning URI as a QR
+//     code (image/svg+xml) to scan with the authenticator app.
+// Audit:
+//   - 404 once enrollment is confirmed; the secret is not shown
+//     again.
+// -------------------------------------------------------
+func HandleTOTPQR(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    totpMu.Lock()
+    records, err := loadTOTPLocked(r.Context())
+    totpMu.Unlock()
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    record, exists := records[user.Name]
+    if !exists || record.Confirmed {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "No pending enrollment; POST /auth/totp/enroll first")
+        return
+    }
+    code, err := qrcode.Encode(auth.ProvisioningURI(currentConfig(r.Context()).MFA.Issuer, user.Name, record.Secret))
+    if err != nil {
+        logError(r.Context(), "QR encoding failed: "+err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Internal server error")
+        return
+    }
+    w.Header().Set("Content-Type", "image/svg+xml")
+    w.Header().Set("Cache-Control", "no-store")
+    w.Write(code.SVG(6))
+}
+
+// -------------------------------------------------------
+// func HandleTOTPConfirm(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/totp/confirm {"code"}: activate the pending secret
+//     once the app shows a matching code; answers the recovery
+//     codes, which are not retrievable later.
+// -------------------------------------------------------
+func HandleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Code string `json:"code"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "code", req.Code) {
+        return
+    }
+
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    record, exists := records[user.Name]
+    if !exists || record.Confirmed {
+        apierror.Write(w, r, apierror.CodeConflict, "", "No pending enrollment; POST /auth/totp/enroll first")
+        return
+    }
+    step, ok := auth.VerifyTOTP(record.Secret, req.Code, timeNow(r.Context()), 0)
+    if !ok {
+        auditAuth(r, "auth.totp_failed", http.StatusUnauthorized, user.Name, "enrollment code rejected")
+        apierror.Write(w, r, apierror.CodeUnauthorized, "code", "Invalid authentication code")
+        return
+    }
+
+    codes := auth.NewRecoveryCodes(recoveryCodeCount)
+    record.Confirmed = true
+    record.ConfirmedAt = utcNow(r.Context())
+    record.LastStep = step
+    record.RecoveryCodes = hashRecoveryCodes(codes)
+    records[user.Name] = record
+    if err := saveTOTPLocked(r.Context(), records); err != nil {
+        writeStorageError(w, r, err, "save TOTP records", "Internal server error")
+        return
+    }
+
+    auditAuth(r, "auth.totp_enroll", http.StatusOK, user.Name, "")
+    logInfo(r.Context(), "TOTP enrolled for "+user.Name)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]interface{}{"enrolled": true, "recovery_codes": codes})
+}
+
+// hashRecoveryCodes is the stored form of freshly issued codes.
+func hashRecoveryCodes(codes []string) []string {
+    hashes := make([]string, len(codes))
+    for i, code := range codes {
+        hashes[i] = auth.HashRecoveryCode(code)
+    }
+    return hashes
+}
+
+// -------------------------------------------------------
+// func HandleTOTPRecoveryCodes(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/totp/recovery-codes {"code"}: replace all recovery
+//     codes with a new set (the old ones stop working).
+// -------------------------------------------------------
+func HandleTOTPRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Code string `json:"code"`
+    }
+    if !decodeJSON(w, r, &req) || !checkSecondFactor(w, r, user.Name, req.Code, "") {
+        return
+    }
+
+    codes := auth.NewRecoveryCodes(recoveryCodeCount)
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    record := records[user.Name]
+    record.RecoveryCodes = hashRecoveryCodes(codes)
+    records[user.Name] = record
+    if err := saveTOTPLocked(r.Context(), records); err != nil {
+        writeStorageError(w, r, err, "save TOTP records", "Internal server error")
+        return
+    }
+
+    auditAuth(r, "auth.totp_recovery_codes", http.StatusOK, user.Name, "")
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// -------------------------------------------------------
+// func HandleTOTPDisable(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /auth/totp/disable {"code"} or {"recovery_code"}: remove
+//     the caller's second factor (or a pending enrollment, without
+//     a code).
+// Audit:
+//   - Users whose role requires MFA must enroll again before they
+//     can use anything but /auth.
+// -------------------------------------------------------
+func HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+    var req struct {
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+    if !decodeJSON(w, r, &req) {
+        return
+    }
+    if TOTPEnrolled(r.Context(), user.Name) && !checkSecondFactor(w, r, user.Name, req.Code, req.RecoveryCode) {
+        return
+    }
+
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    if _, exists := records[user.Name]; !exists {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Two-factor authentication is not enrolled")
+        return
+    }
+    delete(records, user.Name)
+    if err := saveTOTPLocked(r.Context(), records); err != nil {
+        writeStorageError(w, r, err, "save TOTP records", "Internal server error")
+        return
+    }
+
+    auditAuth(r, "auth.totp_disable", http.StatusOK, user.Name, "")
+    logInfo(r.Context(), "TOTP disabled for "+user.Name)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]bool{"enrolled": false})
+}
+
+// -------------------------------------------------------
+// func HandleTOTPReset(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /admin/totp/reset {"user"}: remove a user's second factor
+//     (lost device and recovery codes); the user enrolls again.
+// -------------------------------------------------------
+func HandleTOTPReset(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    var req struct {
+        User string `json:"user"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "user", req.User) {
+        return
+    }
+
+    totpMu.Lock()
+    defer totpMu.Unlock()
+    records, err := loadTOTPLocked(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "load TOTP records", "Internal server error")
+        return
+    }
+    if _, exists := records[req.User]; !exists {
+        apierror.Write(w, r, apierror.CodeNotFound, "user", "No second factor enrolled for "+req.User)
+        return
+    }
+    delete(records, req.User)
+    if err := saveTOTPLocked(r.Context(), records); err != nil {
+        writeStorageError(w, r, err, "save TOTP records", "Internal server error")
+        return
+    }
+    auth.ThrottleReset(auth.UserThrottleKey(req.User))
+
+    auditAuth(r, "admin.totp_reset", http.StatusOK, req.User, "")
+    logInfo(r.Context(), "TOTP reset for "+req.User)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"reset": req.User})
+}
@@ -0,0 +1,331 @@
+// -------------------------------------------------------
+// backend/handlers/transclusion.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Transclusion: ![[Other note]] or ![[Treasury/cash#Summary]]
+//     in a note stands for the other note, or one section of it,
+//     as it reads now. GET /file/render?path=... answers the note
+//     with every include replaced, so a board pack note can embed
+//     the live cash summary instead of a pasted copy.
+// Audit:
+//   - Targets resolve like wiki-links (reports_links.go): the
+//     note's folder, then the root, with .md/.txt appended; a bare
+//     name also finds a unique note of that name in any folder.
+//   - Every target, however it resolved, passes checkNoteRead, the
+//     guard of GET /file: attachments, files of raw folders, metadata
+//     and paths outside the root are refused, and render an inline
+//     "Include refused" marker. Notes of archived folders are read
+//     from their archive, as GET /file reads them.
+//     Each included note is audited as a read of that note (detail
+//     "include from <note>"), passes the read processors, and shows
+//     in its /file/access-log.
+//   - Includes nest up to maxIncludeDepth. A cycle, a missing
+//     target or section, or an unreadable note renders an inline
+//     "Include failed" marker; rendering itself does not fail.
+//   - Includes inside fenced code blocks are left as written.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "path"
+    "regexp"
+    "strings"
+
+    "cfo-scratchpad/apierror"
+)
+
+const (
+    maxIncludeDepth = 8
+    // maxRenderBytes bounds a rendered note, includes and all.
+    maxRenderBytes = 16 << 20
+)
+
+// includePattern captures the target, #section, and alias of ![[...]].
+var includePattern = regexp.MustCompile(`!\[\[([^\[\]\n|#]*)(?:#([^\[\]\n|]*))?(?:\|[^\[\]\n]*)?\]\]`)
+
+// -------------------------------------------------------
+// type RenderInclude
+// -------------------------------------------------------
+// Purpose:
+//   - One include met while rendering, for ?format=json.
+// Audit:
+//   - Path is empty when the target did not resolve; Error says
+//     why the include was not expanded, and Refused marks a target
+//     the read guard does not serve.
+// -------------------------------------------------------
+type RenderInclude struct {
+    In      string `json:"in"`
+    Target  string `json:"target"`
+    Section string `json:"section,omitempty"`
+    Path    string `json:"path,omitempty"`
+    Depth   int    `json:"depth"`
+    Error   string `json:"error,omitempty"`
+    Refused bool   `json:"refused,omitempty"`
+}
+
+// -------------------------------------------------------
+// type includeRenderer
+// -------------------------------------------------------
+// Purpose:
+//   - State of one render: the includes open above the current one
+//     (for cycles), the bytes produced, and what was included.
+// -------------------------------------------------------
+type includeRenderer struct {
+    r        *http.Request
+    stack    []string
+    size     int
+    includes []RenderInclude
+}
+
+// -------------------------------------------------------
+// func resolveInclude(r, source, target) (string, error)
+// -------------------------------------------------------
+// Purpose:
+//   - The note an include in source points at.
+// Audit:
+//   - A candidate outside the root or refused by checkNoteRead
+//     fails with errNotReadable; name matches from the index are
+//     checked the same way.
+// -------------------------------------------------------
+func resolveInclude(r *http.Request, source, target string) (string, error) {
+    candidates := []string{target}
+    if !isNoteName(target) {
+        candidates = []string{target + markdownExt, target + fileExt}
+    }
+    for _, base := range []string{path.Dir(source), "."} {
+        for _, candidate := range candidates {
+            joined, ok := within(base, candidate)
+            if !ok {
+                return "", errNotReadable
+            }
+            absPath, err := checkNoteRead(r.Context(), joined)
+            if err != nil {
+                return "", err
+            }
+            if _, err := readNote(r.Context(), absPath); err == nil {
+                return relativeTo(r.Context(), absPath), nil
+            }
+        }
+    }
+    if !strings.Contains(target, "/") {
+        var found []string
+        for rel := range indexSnapshot(r.Context()) {
+            if _, err := checkNoteRead(r.Context(), rel); err != nil {
+                continue
+            }
+            name := strings.ToLower(path.Base(rel))
+            if name == strings.ToLower(target) || strings.TrimSuffix(name, path.Ext(name)) == strings.ToLower(target) {
+                found = append(found, rel)
+            }
+        }
+        if len(found) == 1 {
+            return found[0], nil
+        }
+        if len(found) > 1 {
+            return "", fmt.Errorf("%d notes are named %s; give the folder", len(found), target)
+        }
+    }
+    return "", fmt.Errorf("note not found")
+}
+
+// -------------------------------------------------------
+// func noteSection(content, section) ([]byte, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - The section of a note under the heading named section
+//     (matched by text ignoring case, or by slug), heading line
+//     included.
+// -------------------------------------------------------
+func noteSection(content []byte, section string) ([]byte, bool) {
+    want := strings.ToLower(strings.TrimSpace(section))
+    for _, heading := range markdownHeadings(content) {
+        if strings.ToLower(heading.Text) == want || heading.Slug == want || headingSlug(heading.Text, map[string]int{}) == want {
+            return content[heading.Offset:heading.End], true
+        }
+    }
+    return nil, false
+}
+
+// stripFrontmatter drops a leading YAML frontmatter block.
+func stripFrontmatter(content []byte) []byte {
+    block, ok := frontmatterBlock(content)
+    if !ok {
+        return content
+    }
+    // Opening and closing lines plus the block's own lines.
+    lines := bytes.SplitAfterN(content, []byte("\n"), len(block)+3)
+    if len(lines) < len(block)+3 {
+        return nil
+    }
+    return lines[len(block)+2]
+}
+
+// -------------------------------------------------------
+// func (ir *includeRenderer) expand(rel, content, depth) []byte
+// -------------------------------------------------------
+// Purpose:
+//   - content (of the note rel) with its includes replaced,
+//     recursively.
+// -------------------------------------------------------
+func (ir *includeRenderer) expand(rel string, content []byte, depth int) []byte {
+    fenced := fencedRanges(content)
+    var out bytes.Buffer
+    last := 0
+    for _, loc := range includePattern.FindAllSubmatchIndex(content, -1) {
+        inFence := false
+        for _, f := range fenced {
+            inFence = inFence || loc[0] >= f[0] && loc[0] < f[1]
+        }
+        if inFence {
+            continue
+        }
+        out.Write(content[last:loc[0]])
+        last = loc[1]
+
+        include := RenderInclude{In: rel, Target: strings.TrimSpace(string(content[loc[2]:loc[3]])), Depth: depth + 1}
+        if loc[4] >= 0 {
+            include.Section = strings.TrimSpace(string(content[loc[4]:loc[5]]))
+        }
+        embedded, err := ir.include(&include, depth)
+        if err != nil {
+            include.Error = err.Error()
+            marker := "Include failed"
+            if errors.Is(err, errNotReadable) {
+                include.Refused, marker = true, "Include refused"
+                logError(ir.r.Context(), fmt.Sprintf("Refused include of %q in %s", include.Target, rel))
+            }
+            fmt.Fprintf(&out, "> **%s:** `%s` (%s)", marker, content[loc[0]:loc[1]], err)
+        } else {
+            out.Write(bytes.TrimRight(embedded, "\n"))
+        }
+        ir.includes = append(ir.includes, include)
+    }
+    out.Write(content[last:])
+    return out.Bytes()
+}
+
+// include resolves, reads, and expands one include.
+func (ir *includeRenderer) include(include *RenderInclude, depth int) ([]byte, error) {
+    if include.Target == "" {
+        return nil, fmt.Errorf("no note named")
+    }
+    if depth+1 > maxIncludeDepth {
+        return nil, fmt.Errorf("includes nest deeper than %d", maxIncludeDepth)
+    }
+    rel, err := resolveInclude(ir.r, include.In, include.Target)
+    if err != nil {
+        return nil, err
+    }
+    include.Path = rel
+    key := rel + "#" + strings.ToLower(include.Section)
+    for _, open := range ir.stack {
+        if open == key || open == rel+"#" {
+            return nil, fmt.Errorf("cycle: %s includes itself", rel)
+        }
+    }
+
+    absPath, err := checkNoteRead(ir.r.Context(), rel)
+    if err != nil {
+        return nil, err
+    }
+    content, err := readNote(ir.r.Context(), absPath)
+    if err != nil {
+        return nil, fmt.Errorf("note could not be read")
+    }
+    content, err = processContent(ir.r.Context(), hookRead, rel, content)
+    if err != nil {
+        return nil, fmt.Errorf("read processor failed")
+    }
+    if include.Section != "" {
+        section, ok := noteSection(content, include.Section)
+        if !ok {
+            return nil, fmt.Errorf("section %q not found in %s", include.Section, rel)
+        }
+        content = section
+    } else {
+        content = stripFrontmatter(content)
+    }
+    if ir.size += len(content); ir.size > maxRenderBytes {
+        return nil, fmt.Errorf("rendered note exceeds %d bytes", maxRenderBytes)
+    }
+    auditFileRead(ir.r, absPath, "include from "+include.In)
+
+    ir.stack = append(ir.stack, key)
+    defer func() { ir.stack = ir.stack[:len(ir.stack)-1] }()
+    return ir.expand(rel, content, depth+1), nil
+}
+
+// -------------------------------------------------------
+// func HandleFileRender(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/render?path=...: the note with its includes
+//     expanded, as text/markdown.
+//   - ?format=json answers {"path", "content", "includes"} instead,
+//     listing every include with what it resolved to or why not.
+// Audit:
+//   - The note itself is audited as a read with detail "render".
+// -------------------------------------------------------
+func HandleFileRender(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    file := r.URL.Query().Get("path")
+    if !requireField(w, r, "path", file) {
+        return
+    }
+    absPath, err := checkNoteRead(r.Context(), file)
+    if err != nil {
+        logError(r.Context(), "Invalid render path requested: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    format := r.URL.Query().Get("format")
+    if format != "" && format != "json" {
+        writeFieldError(w, r, invalidField("format", "must be json or omitted"))
+        return
+    }
+
+    rel := relativeTo(r.Context(), absPath)
+    content, err := readNote(r.Context(), absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read file for render: "+absPath, "Internal error")
+        return
+    }
+    content, err = processContent(r.Context(), hookRead, rel, content)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+    auditFileRead(r, absPath, "render")
+
+    renderer := &includeRenderer{r: r, stack: []string{rel + "#"}, size: len(content), includes: []RenderInclude{}}
+    rendered := renderer.expand(rel, content, 0)
+    failed := 0
+    for _, include := range renderer.includes {
+        if include.Error != "" {
+            failed++
+        }
+    }
+    logInfo(r.Context(), fmt.Sprintf("Rendered %s: %d includes, %d failed", rel, len(renderer.includes), failed))
+
+    if format == "json" {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "path":     rel,
+            "content":  string(rendered),
+            "includes": renderer.includes,
+        })
+        return
+    }
+    w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+    w.Write(rendered)
+}
@@ -0,0 +1,544 @@
+// -------------------------------------------------------
+// backend/handlers/trash.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Soft delete: DELETE /folders?path= and DELETE /file?path= move
+//     the folder (with its entire contents) or file into the trash.
+//   - GET /trash lists trashed items; POST /trash/restore puts one
+//     back as a unit.
+//   - Retention: expired items are purged per the most specific
+//     trash_retention folder rule (see config.TrashRetentionDays).
+// Audit:
+//   - Layout: .scratchpad/trash/<id>/item.json + payload, where
+//     payload is the renamed folder or file. Delete and restore are
+//     each a single rename, so a folder is never half in the trash.
+//   - Index entries travel with the item and are re-attached on
+//     restore; each note is journaled as a delete / put.
+//   - Writes "trash.delete", "trash.restore", and "trash.purge"
+//     audit events.
+// Configuration:
+//   - trash_retention / TRASH_RETENTION_DAYS (default {"*": 30}).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+const (
+    trashDirName     = "trash"
+    trashItemFile    = "item.json"
+    trashPayloadName = "payload"
+    // trashSweepInterval is how often expired items are purged.
+    trashSweepInterval = time.Hour
+)
+
+// errTrashNotFound is returned for an unknown or incomplete trash id.
+var errTrashNotFound = errors.New("trash item not found")
+
+// -------------------------------------------------------
+// type TrashItem
+// -------------------------------------------------------
+// Purpose:
+//   - One soft-deleted folder or file.
+// Audit:
+//   - ExpiresAt is computed from the current retention rules when
+//     listed; empty means kept until restored.
+//   - Held items (legal hold on their path) are not purged even
+//     once expired.
+// -------------------------------------------------------
+type TrashItem struct {
+    ID        string `json:"id"`
+    Kind      string `json:"kind"`
+    Path      string `json:"path"`
+    DeletedAt string `json:"deleted_at"`
+    Files     int    `json:"files"`
+    Bytes     int64  `json:"bytes"`
+    ExpiresAt string `json:"expires_at,omitempty"`
+    Held      bool   `json:"held,omitempty"`
+}
+
+// trashRecord is the on-disk item.json (item plus detached index).
+type trashRecord struct {
+    TrashItem
+    Index map[string]IndexEntry `json:"index"`
+}
+
+// -------------------------------------------------------
+// func trashPath(ctx context.Context, parts ...string) string
+// -------------------------------------------------------
+// Purpose:
+//   - Absolute path inside .scratchpad/trash.
+// -------------------------------------------------------
+func trashPath(ctx context.Context, parts ...string) string {
+    return metaPath(ctx, append([]string{trashDirName}, parts...)...)
+}
+
+// -------------------------------------------------------
+// func newStampID() string
+// -------------------------------------------------------
+// Purpose:
+//   - Sortable unique id: UTC timestamp plus random suffix.
+// -------------------------------------------------------
+func newStampID(ctx context.Context) string {
+    suffix := make([]byte, 4)
+    rand.Read(suffix)
+    return timeNow(ctx).UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// -------------------------------------------------------
+// func validTrashID(id string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Reject ids that could escape the trash directory.
+// -------------------------------------------------------
+func validTrashID(id string) bool {
+    if id == "" || len(id) > 64 {
+        return false
+    }
+    for _, r := range id {
+        if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '-') {
+            return false
+        }
+    }
+    return true
+}
+
+// -------------------------------------------------------
+// func moveToTrash(ctx, absPath, kind) (TrashItem, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Record item.json, then rename absPath into the trash.
+// Audit:
+//   - On rename failure the half-created trash entry is removed and
+//     the detached index entries are put back.
+// -------------------------------------------------------
+func moveToTrash(ctx context.Context, absPath string, kind string) (TrashItem, error) {
+    rel := relativeTo(ctx, absPath)
+    item := TrashItem{ID: newStampID(ctx), Kind: kind, Path: rel, DeletedAt: utcNow(ctx)}
+
+    err := walkPath(ctx, absPath, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.Mode().IsRegular() {
+            item.Files++
+            item.Bytes += info.Size()
+        }
+        return nil
+    })
+    if err != nil {
+        return item, err
+    }
+
+    store := serverFrom(ctx).Storage
+    if err := store.MkdirAll(trashPath(ctx, item.ID)); err != nil {
+        return item, err
+    }
+    record := trashRecord{TrashItem: item, Index: indexDetach(ctx, rel)}
+    if err := saveMetaJSON(ctx, filepath.Join(trashDirName, item.ID, trashItemFile), record); err != nil {
+        indexAttach(ctx, rel, record.Index)
+        store.RemoveAll(trashPath(ctx, item.ID))
+        return item, err
+    }
+
+    if err := renamePathAny(ctx, absPath, trashPath(ctx, item.ID, trashPayloadName)); err != nil {
+        indexAttach(ctx, rel, record.Index)
+        store.RemoveAll(trashPath(ctx, item.ID))
+        return item, err
+    }
+    journalFolderEntries(ctx, journalDelete, rel, record.Index)
+    return item, nil
+}
+
+// -------------------------------------------------------
+// func renamePathAny(ctx, from, to)
+// -------------------------------------------------------
+// Purpose:
+//   - Storage.Rename for a file or directory, bound to ctx.
+// Audit:
+//   - Storage checks both chains for symlinks; unlike renamePath
+//     the source may be a directory.
+// -------------------------------------------------------
+func renamePathAny(ctx context.Context, from, to string) error {
+    store := serverFrom(ctx).Storage
+    return runWithContext(ctx, func() error {
+        info, err := store.Lstat(from)
+        if err != nil {
+            return err
+        }
+        defer touchStoragePaths(ctx, info.IsDir(), from, to)
+        return store.Rename(from, to)
+    })
+}
+
+// -------------------------------------------------------
+// func loadTrashRecord(ctx context.Context, id string) (trashRecord, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Read item.json for id; errTrashNotFound if absent or if the
+//     payload never made it into the trash.
+// -------------------------------------------------------
+func loadTrashRecord(ctx context.Context, id string) (trashRecord, error) {
+    var record trashRecord
+    if !validTrashID(id) {
+        return record, errTrashNotFound
+    }
+    if _, err := serverFrom(ctx).Storage.Lstat(trashPath(ctx, id, trashPayloadName)); err != nil {
+        return record, errTrashNotFound
+    }
+    if err := loadMetaJSON(ctx, filepath.Join(trashDirName, id, trashItemFile), &record); err != nil {
+        return record, err
+    }
+    if record.ID != id {
+        return record, errTrashNotFound
+    }
+    return record, nil
+}
+
+// -------------------------------------------------------
+// func listTrash() ([]TrashItem, error)
+// -------------------------------------------------------
+// Purpose:
+//   - All complete trash items, newest first, with expiry filled in.
+// -------------------------------------------------------
+func listTrash(ctx context.Context) ([]TrashItem, error) {
+    items := []TrashItem{}
+    entries, err := serverFrom(ctx).Storage.ReadDir(trashPath(ctx))
+    if os.IsNotExist(err) {
+        return items, nil
+    }
+    if err != nil {
+        return items, err
+    }
+
+    cfg := currentConfig(ctx)
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+        record, loadErr := loadTrashRecord(ctx, entry.Name())
+        if loadErr != nil {
+            continue
+        }
+        item := record.TrashItem
+        if expires, ok := trashExpiry(cfg, item); ok {
+            item.ExpiresAt = expires.Format("2006-01-02T15:04:05Z")
+        }
+        item.Held = isHeld(ctx, item.Path)
+        items = append(items, item)
+    }
+    sort.Slice(items, func(a, b int) bool { return items[a].ID > items[b].ID })
+    return items, nil
+}
+
+// -------------------------------------------------------
+// func trashExpiry(cfg, item) (time.Time, bool)
+// -------------------------------------------------------
+// Purpose:
+//   - When item expires under the current rules; false = never.
+// -------------------------------------------------------
+func trashExpiry(cfg *config.Config, item TrashItem) (time.Time, bool) {
+    days := cfg.TrashRetentionDays(item.Path)
+    deleted, err := time.Parse("2006-01-02T15:04:05Z", item.DeletedAt)
+    if days <= 0 || err != nil {
+        return time.Time{}, false
+    }
+    return deleted.Add(time.Duration(days) * 24 * time.Hour), true
+}
+
+// -------------------------------------------------------
+// func PurgeExpiredTrash(ctx) ([]TrashItem, error)
+// -------------------------------------------------------
+// Purpose:
+//   - Permanently remove trash items past their retention.
+// Audit:
+//   - Writes one "trash.purge" event per removed item.
+//   - Items under legal hold are skipped.
+// -------------------------------------------------------
+func PurgeExpiredTrash(ctx context.Context) ([]TrashItem, error) {
+    purged := []TrashItem{}
+    items, err := listTrash(ctx)
+    if err != nil {
+        return purged, err
+    }
+
+    cfg := currentConfig(ctx)
+    now := timeNow(ctx).UTC()
+    for _, item := range items {
+        if err := ctx.Err(); err != nil {
+            return purged, err
+        }
+        expires, ok := trashExpiry(cfg, item)
+        if !ok || now.Before(expires) {
+            continue
+        }
+        if item.Held {
+            logInfo(ctx, "Kept expired trash item "+item.ID+" under legal hold: "+item.Path)
+            continue
+        }
+        if err := serverFrom(ctx).Storage.RemoveAll(trashPath(ctx, item.ID)); err != nil {
+            logError(ctx, "Failed to purge trash item "+item.ID+": "+err.Error())
+            continue
+        }
+        logInfo(ctx, fmt.Sprintf("Purged trash item %s (%s, %d files)", item.ID, item.Path, item.Files))
+        audit.WriteContext(ctx, audit.Event{
+            Event:  "trash.purge",
+            Method: "RETENTION",
+            Path:   "/trash",
+            Target: item.Path,
+            Detail: fmt.Sprintf("id=%s files=%d bytes=%d", item.ID, item.Files, item.Bytes),
+        })
+        purged = append(purged, item)
+    }
+    return purged, nil
+}
+
+// -------------------------------------------------------
+// func RunTrashRetention()
+// -------------------------------------------------------
+// Purpose:
+//   - Purge expired trash at startup and then hourly, for the life
+//     of the process; sweeps are skipped while schedules are paused
+//     (maintenance mode).
+// -------------------------------------------------------
+func RunTrashRetention(ctx context.Context) {
+    for {
+        if SchedulesPaused() {
+            time.Sleep(trashSweepInterval)
+            continue
+        }
+        if _, err := PurgeExpiredTrash(ctx); err != nil {
+            logError(ctx, "Trash retention sweep failed: "+err.Error())
+        }
+        time.Sleep(trashSweepInterval)
+    }
+}
+
+// -------------------------------------------------------
+// func auditTrash(r, event, status, target, detail)
+// -------------------------------------------------------
+// Purpose:
+//   - Write a trash.* audit event for an HTTP request.
+// -------------------------------------------------------
+func auditTrash(r *http.Request, event string, status int, target string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Target:   target,
+        Detail:   detail,
+    })
+}
+
+// -------------------------------------------------------
+// func handleDeleteFolder(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - DELETE /folders?path=: move a folder and everything in it to
+//     the trash.
+// Audit:
+//   - The scratch root itself cannot be deleted, nor folders holding
+//     ledger notes.
+// -------------------------------------------------------
+func handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+    folder := r.URL.Query().Get("path")
+    absPath := sanitizePath(r.Context(), folder)
+    if absPath == "" || absPath == scratchRoot(r.Context()) {
+        logError(r.Context(), "Rejected folder delete: "+folder)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid folder path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) || rejectIfLedger(w, r, absPath) || rejectIfApproved(w, r, absPath) || rejectIfHeld(w, r, absPath) {
+        return
+    }
+
+    info, err := statPath(r.Context(), absPath)
+    if os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Folder not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "stat folder: "+absPath, "Delete failed")
+        return
+    }
+    if !info.IsDir() {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Not a folder")
+        return
+    }
+
+    writeTrashed(w, r, absPath, "folder")
+}
+
+// -------------------------------------------------------
+// func handleFileDelete(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - DELETE /file?path=: move a single note to the trash
+//     (any file of a raw folder with ?raw=1).
+// Audit:
+//   - Ledger notes cannot be deleted (403, "ledger.violation").
+// -------------------------------------------------------
+func handleFileDelete(w http.ResponseWriter, r *http.Request) {
+    file := r.URL.Query().Get("path")
+    absPath := sanitizePath(r.Context(), file)
+    if absPath == "" || !isFileName(r, absPath) {
+        logError(r.Context(), "Invalid file path for delete: "+file)
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) || rejectIfLedger(w, r, absPath) || rejectIfApproved(w, r, absPath) || rejectIfHeld(w, r, absPath) {
+        return
+    }
+
+    if _, err := statPath(r.Context(), absPath); os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+
+    writeTrashed(w, r, absPath, "file")
+}
+
+// -------------------------------------------------------
+// func writeTrashed(w, r, absPath, kind)
+// -------------------------------------------------------
+// Purpose:
+//   - Shared tail of folder/file delete: trash, audit, respond.
+// -------------------------------------------------------
+func writeTrashed(w http.ResponseWriter, r *http.Request, absPath string, kind string) {
+    item, err := moveToTrash(r.Context(), absPath, kind)
+    if err != nil {
+        writeStorageError(w, r, err, "move to trash: "+absPath, "Delete failed")
+        return
+    }
+
+    logInfo(r.Context(), fmt.Sprintf("Moved %s to trash: %s (id %s, %d files)", kind, absPath, item.ID, item.Files))
+    auditTrash(r, "trash.delete", http.StatusOK, item.Path,
+        fmt.Sprintf("id=%s kind=%s files=%d bytes=%d", item.ID, kind, item.Files, item.Bytes))
+
+    if expires, ok := trashExpiry(currentConfig(r.Context()), item); ok {
+        item.ExpiresAt = expires.Format("2006-01-02T15:04:05Z")
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(item)
+}
+
+// -------------------------------------------------------
+// func HandleTrash(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /trash: list trashed items (newest first).
+// Audit:
+//   - Always returns an array ([] when empty).
+// -------------------------------------------------------
+func HandleTrash(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    items, err := listTrash(r.Context())
+    if err != nil {
+        writeStorageError(w, r, err, "list trash", "Internal server error")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(items)
+}
+
+// -------------------------------------------------------
+// func HandleTrashRestore(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /trash/restore {"id": "...", "path": "optional/target"}:
+//     move an item back to its original (or the given) path.
+// Audit:
+//   - 409 if the destination already exists; nothing is merged.
+//   - Writes "trash.restore".
+// -------------------------------------------------------
+func HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    var req struct {
+        ID   string `json:"id"`
+        Path string `json:"path"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "id", req.ID) {
+        return
+    }
+
+    record, err := loadTrashRecord(r.Context(), req.ID)
+    if err == errTrashNotFound {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "Trash item not found")
+        return
+    }
+    if err != nil {
+        writeStorageError(w, r, err, "load trash item "+req.ID, "Restore failed")
+        return
+    }
+
+    target := record.Path
+    if req.Path != "" {
+        normalized, policyErr := applyNamePolicy(req.Path)
+        if policyErr != nil {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid target path: "+policyErr.Error())
+            return
+        }
+        target = normalized
+    }
+    absTarget := sanitizePath(r.Context(), target)
+    if absTarget == "" || absTarget == scratchRoot(r.Context()) || (record.Kind == "file" && !isNoteName(absTarget) && !rawAllowed(r.Context(), relativeTo(r.Context(), absTarget))) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid target path")
+        return
+    }
+    if rejectIfArchived(w, r, absTarget) {
+        return
+    }
+
+    ctx := r.Context()
+    if _, statErr := statPath(ctx, absTarget); statErr == nil {
+        apierror.Write(w, r, apierror.CodeConflict, "", "Destination already exists: "+target)
+        return
+    }
+    if err := mkdirAll(ctx, filepath.Dir(absTarget)); err != nil {
+        writeStorageError(w, r, err, "create restore parent: "+absTarget, "Restore failed")
+        return
+    }
+    if err := renamePathAny(ctx, trashPath(ctx, record.ID, trashPayloadName), absTarget); err != nil {
+        writeStorageError(w, r, err, "restore "+record.ID+" -> "+absTarget, "Restore failed")
+        return
+    }
+    if err := serverFrom(ctx).Storage.RemoveAll(trashPath(ctx, record.ID)); err != nil {
+        logError(ctx, "Failed to remove restored trash entry "+record.ID+": "+err.Error())
+    }
+    indexAttach(ctx, target, record.Index)
+    journalFolderEntries(ctx, journalPut, target, record.Index)
+
+    logInfo(ctx, "Restored trash item "+record.ID+" -> "+absTarget)
+    auditTrash(r, "trash.restore", http.StatusOK, target, fmt.Sprintf("id=%s kind=%s files=%d", record.ID, record.Kind, record.Files))
+
+    item := record.TrashItem
+    item.Path = target
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(item)
+}
@@ -0,0 +1,335 @@
+// -------------------------------------------------------
+// backend/handlers/tts.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Text-to-speech export: GET /file/audio?path=... renders a note
+//     to an audio file through a local speech backend and returns
+//     it for download, so long memos can be listened to on the go.
+//   - Backends are pluggable (ttsBackends): "command" runs a program
+//     on this host (e.g. piper, espeak-ng) with the text on stdin
+//     and the audio on stdout; "http" posts the text to a speech
+//     server on premises. Note text never leaves the operator's
+//     infrastructure.
+// Audit:
+//   - Markdown is read as prose: code blocks, link targets, and
+//     formatting marks are dropped; table cells are read in order.
+//   - The voice follows the note's language (language.go) through
+//     tts.voices, unless ?voice= names one.
+//   - At most ttsConcurrency renderings run at once; others wait for
+//     a slot until the request deadline.
+//   - A backend failure or timeout answers 502 upstream_failed; the
+//     backend's own message is logged, not returned.
+//   - Each rendering writes "file.read" with detail "audio", so
+//     /file/access-log shows who listened to a note.
+// Configuration:
+//   - tts.backend / TTS_BACKEND       "" (off, default), command, http
+//   - tts.command / TTS_COMMAND       program and arguments
+//   - tts.url / TTS_URL               speech server endpoint
+//   - tts.voices                      language -> voice, "default"
+//   - tts.format / TTS_FORMAT         wav (default), mp3, ogg
+//   - tts.max_chars / TTS_MAX_CHARS   default 100000
+//   - tts.timeout / TTS_TIMEOUT       default 2m
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "os/exec"
+    "path"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/config"
+)
+
+const (
+    // ttsMaxAudioBytes bounds what a backend may return.
+    ttsMaxAudioBytes = 256 << 20
+    ttsConcurrency   = 2
+    // ttsMaxStderr is how much backend stderr is kept for the log.
+    ttsMaxStderr = 512
+)
+
+// ttsContentTypes maps tts.format to the audio MIME type.
+var ttsContentTypes = map[string]string{
+    "wav": "audio/wav",
+    "mp3": "audio/mpeg",
+    "ogg": "audio/ogg",
+}
+
+var (
+    ttsVoicePattern   = regexp.MustCompile(`^[A-Za-z0-9_.+-]{1,64}$`)
+    ttsLinkPattern    = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+    ttsListPattern    = regexp.MustCompile(`^([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`)
+    ttsFormatReplacer = strings.NewReplacer("**", "", "__", "", "*", "", "`", "", "~~", "")
+)
+
+// ttsSlots limits concurrent renderings; speech synthesis is CPU
+// heavy.
+var ttsSlots = make(chan struct{}, ttsConcurrency)
+
+// -------------------------------------------------------
+// type ttsBackend
+// -------------------------------------------------------
+// Purpose:
+//   - One way of turning text into audio bytes.
+// -------------------------------------------------------
+type ttsBackend interface {
+    synthesize(ctx context.Context, text, lang, voice string) ([]byte, error)
+}
+
+// ttsBackends builds the backend named by tts.backend.
+var ttsBackends = map[string]func(cfg config.TTSConfig) ttsBackend{
+    "command": func(cfg config.TTSConfig) ttsBackend { return ttsCommand{argv: cfg.Command} },
+    "http":    func(cfg config.TTSConfig) ttsBackend { return ttsHTTP{url: cfg.URL, format: cfg.Format} },
+}
+
+// -------------------------------------------------------
+// type ttsCommand
+// -------------------------------------------------------
+// Purpose:
+//   - Backend running a local program: text on stdin, audio on
+//     stdout, {lang} and {voice} substituted in its arguments.
+// Audit:
+//   - The program is started directly, never through a shell.
+// -------------------------------------------------------
+type ttsCommand struct {
+    argv []string
+}
+
+func (b ttsCommand) synthesize(ctx context.Context, text, lang, voice string) ([]byte, error) {
+    args := make([]string, 0, len(b.argv)-1)
+    replacer := strings.NewReplacer("{lang}", lang, "{voice}", voice)
+    for _, arg := range b.argv[1:] {
+        args = append(args, replacer.Replace(arg))
+    }
+    cmd := exec.CommandContext(ctx, b.argv[0], args...)
+    cmd.Stdin = strings.NewReader(text)
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &limitedBuffer{buf: &stdout, max: ttsMaxAudioBytes}
+    cmd.Stderr = &limitedBuffer{buf: &stderr, max: ttsMaxStderr}
+    if err := cmd.Run(); err != nil {
+        if ctx.Err() != nil {
+            return nil, ctx.Err()
+        }
+        return nil, fmt.Errorf("%s: %v: %s", path.Base(b.argv[0]), err, strings.TrimSpace(stderr.String()))
+    }
+    if stdout.Len() > ttsMaxAudioBytes {
+        return nil, fmt.Errorf("audio exceeds %d bytes", ttsMaxAudioBytes)
+    }
+    return stdout.Bytes(), nil
+}
+
+// -------------------------------------------------------
+// type ttsHTTP
+// -------------------------------------------------------
+// Purpose:
+//   - Backend calling a speech server:
+//       POST <url> {"text", "language", "voice", "format"}
+//     answering 2xx with the audio as the body.
+// -------------------------------------------------------
+type ttsHTTP struct {
+    url    string
+    format string
+}
+
+func (b ttsHTTP) synthesize(ctx context.Context, text, lang, voice string) ([]byte, error) {
+    body, _ := json.Marshal(map[string]string{"text": text, "language": lang, "voice": voice, "format": b.format})
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, ttsMaxStderr))
+        return nil, fmt.Errorf("speech server answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+    }
+    audio, err := ioutil.ReadAll(io.LimitReader(resp.Body, ttsMaxAudioBytes+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(audio) > ttsMaxAudioBytes {
+        return nil, fmt.Errorf("audio exceeds %d bytes", ttsMaxAudioBytes)
+    }
+    return audio, nil
+}
+
+// limitedBuffer keeps at most max bytes (plus one, to detect
+// overflow) and discards the rest, so a runaway program cannot
+// exhaust memory.
+type limitedBuffer struct {
+    buf *bytes.Buffer
+    max int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+    if room := l.max + 1 - l.buf.Len(); room > 0 {
+        if len(p) > room {
+            l.buf.Write(p[:room])
+        } else {
+            l.buf.Write(p)
+        }
+    }
+    return len(p), nil
+}
+
+// -------------------------------------------------------
+// func speechText(content []byte, markdown bool) string
+// -------------------------------------------------------
+// Purpose:
+//   - The text of a note as it should be read aloud.
+// Audit:
+//   - Plain .txt notes are passed through; Markdown loses fenced
+//     code, heading/quote/list markers, link targets, emphasis
+//     marks and table rules. Blank lines are kept as pauses.
+// -------------------------------------------------------
+func speechText(content []byte, markdown bool) string {
+    text := strings.ReplaceAll(strings.ToValidUTF8(string(content), ""), "\r\n", "\n")
+    if !markdown {
+        return strings.TrimSpace(text)
+    }
+    var out []string
+    fenced := false
+    for _, line := range strings.Split(text, "\n") {
+        trimmed := strings.TrimSpace(line)
+        if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+            fenced = !fenced
+            continue
+        }
+        // Table rules and horizontal rules are not read.
+        if fenced || strings.Contains(trimmed, "---") && strings.Trim(trimmed, "|-: ") == "" {
+            continue
+        }
+        trimmed = strings.TrimLeft(trimmed, "#> ")
+        trimmed = ttsListPattern.ReplaceAllString(trimmed, "")
+        if strings.HasPrefix(trimmed, "|") {
+            cells := strings.Split(strings.Trim(trimmed, "| "), "|")
+            for i := range cells {
+                cells[i] = strings.TrimSpace(cells[i])
+            }
+            trimmed = strings.Join(cells, ", ") + "."
+        }
+        trimmed = ttsLinkPattern.ReplaceAllString(trimmed, "$1")
+        out = append(out, ttsFormatReplacer.Replace(trimmed))
+    }
+    return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// ttsVoice picks the voice for a language: an exact tts.voices
+// entry, then its primary subtag, then "default", else "".
+func ttsVoice(voices map[string]string, lang string) string {
+    if voice := voices[lang]; voice != "" {
+        return voice
+    }
+    if primary, _, found := strings.Cut(lang, "-"); found && voices[primary] != "" {
+        return voices[primary]
+    }
+    return voices["default"]
+}
+
+// -------------------------------------------------------
+// func HandleFileAudio(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET /file/audio?path=...&voice=...: the note read aloud, as
+//     an attachment in tts.format.
+// Audit:
+//   - 403 when tts.backend is off; 413 when the text exceeds
+//     tts.max_chars; 400 when the note has nothing to read.
+// -------------------------------------------------------
+func HandleFileAudio(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        logError(r.Context(), "Unsupported method: "+r.Method)
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    ctx := r.Context()
+    cfg := currentConfig(ctx).TTS
+    newBackend, ok := ttsBackends[cfg.Backend]
+    if !ok {
+        logError(ctx, "Audio requested but tts.backend is off")
+        apierror.Write(w, r, apierror.CodeForbidden, "", "Text-to-speech is disabled")
+        return
+    }
+
+    absPath := sanitizePath(ctx, r.URL.Query().Get("path"))
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    voice := r.URL.Query().Get("voice")
+    if voice != "" && !ttsVoicePattern.MatchString(voice) {
+        writeFieldError(w, r, invalidField("voice", "must be 1-64 letters, digits, or . _ + -"))
+        return
+    }
+    content, err := readNote(ctx, absPath)
+    if err != nil {
+        writeStorageError(w, r, err, "read note for audio: "+absPath, "Internal error")
+        return
+    }
+    rel := relativeTo(ctx, absPath)
+    content, err = processContent(ctx, hookRead, rel, content)
+    if err != nil {
+        writeProcessorError(w, r, rel, err)
+        return
+    }
+    text := speechText(content, strings.HasSuffix(rel, markdownExt))
+    if text == "" {
+        writeFieldError(w, r, invalidField("path", "names a note with no text to read"))
+        return
+    }
+    if chars := utf8.RuneCountInString(text); chars > cfg.MaxChars {
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "path", fmt.Sprintf("Note has %d characters to read; tts.max_chars is %d", chars, cfg.MaxChars))
+        return
+    }
+    lang := newLanguageLookup(ctx).of(rel)
+    if voice == "" {
+        voice = ttsVoice(cfg.Voices, lang)
+    }
+
+    select {
+    case ttsSlots <- struct{}{}:
+        defer func() { <-ttsSlots }()
+    case <-ctx.Done():
+        writeStorageError(w, r, ctx.Err(), "wait for a text-to-speech slot", "Internal error")
+        return
+    }
+    renderCtx, cancel := context.WithTimeout(ctx, cfg.Timeout.Std())
+    defer cancel()
+    audio, err := newBackend(cfg).synthesize(renderCtx, text, lang, voice)
+    if err == nil && len(audio) == 0 {
+        err = errors.New("backend returned no audio")
+    }
+    if err != nil {
+        if ctx.Err() != nil {
+            writeStorageError(w, r, ctx.Err(), "render audio: "+rel, "Internal error")
+            return
+        }
+        logError(ctx, fmt.Sprintf("Text-to-speech failed for %s (%s backend): %v", rel, cfg.Backend, err))
+        apierror.Write(w, r, apierror.CodeUpstreamFailed, "", "Text-to-speech backend failed")
+        return
+    }
+
+    name := strings.TrimSuffix(path.Base(rel), path.Ext(rel)) + "." + cfg.Format
+    logInfo(ctx, fmt.Sprintf("Rendered audio: %s (%s, voice %q, %d characters, %d bytes)", rel, lang, voice, utf8.RuneCountInString(text), len(audio)))
+    auditFileRead(r, absPath, fmt.Sprintf("audio lang=%s voice=%s bytes=%d", lang, defaultString(voice, "-"), len(audio)))
+    w.Header().Set("Content-Type", ttsContentTypes[cfg.Format])
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+    w.Write(audio)
+}
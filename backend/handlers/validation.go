@@ -0,0 +1,108 @@
+// -------------------------------------------------------
+// backend/handlers/validation.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Request validation shared by the JSON endpoints: decode the
+//     body and check required fields, answering with the structured
+//     errors of the apierror package.
+// Audit:
+//   - invalid_json names the offending field when the decoder
+//     knows it (wrong type); missing_field always names it.
+//   - Every rejection is logged with the endpoint path.
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "cfo-scratchpad/apierror"
+)
+
+// -------------------------------------------------------
+// func decodeJSON(w, r, v) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Decode the request body into v, or answer invalid_json.
+// -------------------------------------------------------
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    err := json.NewDecoder(r.Body).Decode(v)
+    if err == nil {
+        return true
+    }
+    writeJSONError(w, r, err)
+    return false
+}
+
+// writeJSONError answers invalid_json for a decoding error, or
+// payload_too_large when the body hit an http.MaxBytesReader limit.
+func writeJSONError(w http.ResponseWriter, r *http.Request, err error) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        logError(r.Context(), fmt.Sprintf("Request body for %s exceeds %d bytes", r.URL.Path, tooLarge.Limit))
+        apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+        return
+    }
+    field := ""
+    var typeErr *json.UnmarshalTypeError
+    if errors.As(err, &typeErr) {
+        field = typeErr.Field
+    }
+    logError(r.Context(), "Invalid JSON body for "+r.URL.Path+": "+err.Error())
+    apierror.Write(w, r, apierror.CodeInvalidJSON, field, "Bad request: "+err.Error())
+}
+
+// -------------------------------------------------------
+// func requireField(w, r, field, value) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Answer missing_field unless value is non-empty.
+// -------------------------------------------------------
+func requireField(w http.ResponseWriter, r *http.Request, field string, value string) bool {
+    if value != "" {
+        return true
+    }
+    logError(r.Context(), "Missing "+field+" for "+r.URL.Path)
+    apierror.Write(w, r, apierror.CodeMissingField, field, "Bad request: "+field+" is required")
+    return false
+}
+
+// -------------------------------------------------------
+// type fieldError
+// -------------------------------------------------------
+// Purpose:
+//   - A validation failure attributable to one input field.
+// -------------------------------------------------------
+type fieldError struct {
+    field  string
+    reason string
+}
+
+func (e *fieldError) Error() string {
+    return e.field + " " + e.reason
+}
+
+// invalidField builds a *fieldError; the reason is formatted.
+func invalidField(field string, format string, args ...interface{}) error {
+    return &fieldError{field: field, reason: fmt.Sprintf(format, args...)}
+}
+
+// -------------------------------------------------------
+// func writeFieldError(w, r, err)
+// -------------------------------------------------------
+// Purpose:
+//   - Answer invalid_field, naming the field when err is a
+//     *fieldError.
+// -------------------------------------------------------
+func writeFieldError(w http.ResponseWriter, r *http.Request, err error) {
+    field := ""
+    var fe *fieldError
+    if errors.As(err, &fe) {
+        field = fe.field
+    }
+    logError(r.Context(), "Invalid "+defaultString(field, "request")+" for "+r.URL.Path+": "+err.Error())
+    apierror.Write(w, r, apierror.CodeInvalidField, field, "Bad request: "+err.Error())
+}
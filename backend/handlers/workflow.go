@@ -0,0 +1,368 @@
+// -------------------------------------------------------
+// backend/handlers/workflow.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Approval workflow for notes: draft -> in-review -> approved.
+//       GET  /file/workflow?path=...                  state + history
+//       POST /file/workflow {"path", "action", "comment"}
+//   - Actions and the role each requires:
+//       submit   draft     -> in-review  editor
+//       reject   in-review -> draft      reviewer or approver
+//       approve  in-review -> approved   approver
+//       reopen   approved  -> draft      approver
+//   - Registry: .scratchpad/workflow.json (path -> WorkflowRecord);
+//     notes without a record are drafts.
+// Audit:
+//   - Approved notes are read-only: save, move, and delete answer
+//     423 until the note is reopened.
+//   - Every transition writes "workflow.<action>" with the actor and
+//     comment; reject and reopen require a comment.
+//   - Transitions fire matching automations (automations.go).
+// -------------------------------------------------------
+
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+)
+
+const workflowFile = "workflow.json"
+
+// Workflow states.
+const (
+    stateDraft    = "draft"
+    stateInReview = "in-review"
+    stateApproved = "approved"
+)
+
+// workflowMu guards workflow.json.
+var workflowMu sync.Mutex
+
+// -------------------------------------------------------
+// type workflowAction
+// -------------------------------------------------------
+// Purpose:
+//   - One allowed transition and the roles that may perform it.
+// -------------------------------------------------------
+type workflowAction struct {
+    From           string
+    To             string
+    Roles          []string
+    RequireComment bool
+}
+
+// workflowActions is the complete transition table.
+var workflowActions = map[string]workflowAction{
+    "submit":  {From: stateDraft, To: stateInReview, Roles: []string{auth.RoleEditor}},
+    "reject":  {From: stateInReview, To: stateDraft, Roles: []string{auth.RoleReviewer, auth.RoleApprover}, RequireComment: true},
+    "approve": {From: stateInReview, To: stateApproved, Roles: []string{auth.RoleApprover}},
+    "reopen":  {From: stateApproved, To: stateDraft, Roles: []string{auth.RoleApprover}, RequireComment: true},
+}
+
+// -------------------------------------------------------
+// type Transition
+// -------------------------------------------------------
+// Purpose:
+//   - One recorded state change.
+// -------------------------------------------------------
+type Transition struct {
+    Action  string `json:"action"`
+    From    string `json:"from"`
+    To      string `json:"to"`
+    Actor   string `json:"actor"`
+    Comment string `json:"comment,omitempty"`
+    At      string `json:"at"`
+}
+
+// -------------------------------------------------------
+// type WorkflowRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Current state of a note and how it got there.
+// -------------------------------------------------------
+type WorkflowRecord struct {
+    Path      string       `json:"path"`
+    State     string       `json:"state"`
+    UpdatedAt string       `json:"updated_at,omitempty"`
+    UpdatedBy string       `json:"updated_by,omitempty"`
+    History   []Transition `json:"history"`
+}
+
+// -------------------------------------------------------
+// func loadWorkflowLocked() map[string]WorkflowRecord
+// -------------------------------------------------------
+// Purpose:
+//   - Read workflow.json. Caller holds workflowMu.
+// -------------------------------------------------------
+func loadWorkflowLocked(ctx context.Context) map[string]WorkflowRecord {
+    records := map[string]WorkflowRecord{}
+    if err := loadMetaJSON(ctx, workflowFile, &records); err != nil {
+        logError(ctx, "Failed to load workflow states: "+err.Error())
+    }
+    if records == nil {
+        records = map[string]WorkflowRecord{}
+    }
+    return records
+}
+
+// -------------------------------------------------------
+// func workflowStates() map[string]string
+// -------------------------------------------------------
+// Purpose:
+//   - Path -> state for every note that is not a draft.
+// -------------------------------------------------------
+func workflowStates(ctx context.Context) map[string]string {
+    workflowMu.Lock()
+    defer workflowMu.Unlock()
+    states := map[string]string{}
+    for path, record := range loadWorkflowLocked(ctx) {
+        states[path] = record.State
+    }
+    return states
+}
+
+// -------------------------------------------------------
+// func approvedUnder(ctx context.Context, rel string) []string
+// -------------------------------------------------------
+// Purpose:
+//   - Approved notes at rel or inside folder rel.
+// -------------------------------------------------------
+func approvedUnder(ctx context.Context, rel string) []string {
+    found := []string{}
+    for path, state := range workflowStates(ctx) {
+        if state == stateApproved && (rel == "." || path == rel || strings.HasPrefix(path, rel+"/")) {
+            found = append(found, path)
+        }
+    }
+    sort.Strings(found)
+    return found
+}
+
+// -------------------------------------------------------
+// func isApproved(ctx context.Context, rel string) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Report whether the note at rel is approved (read-only).
+// -------------------------------------------------------
+func isApproved(ctx context.Context, rel string) bool {
+    return workflowStates(ctx)[rel] == stateApproved
+}
+
+// -------------------------------------------------------
+// func rejectIfApproved(w, r, absPath) bool
+// -------------------------------------------------------
+// Purpose:
+//   - Write 423 Locked and return true if absPath is an approved
+//     note or a folder holding one.
+// -------------------------------------------------------
+func rejectIfApproved(w http.ResponseWriter, r *http.Request, absPath string) bool {
+    rel := relativeTo(r.Context(), absPath)
+    found := approvedUnder(r.Context(), rel)
+    if len(found) == 0 {
+        return false
+    }
+    logError(r.Context(), "Rejected change to approved note: "+found[0])
+    if found[0] == rel {
+        apierror.Write(w, r, apierror.CodeLocked, "", "Note is approved (read-only); reopen it to edit: "+rel)
+    } else {
+        apierror.Write(w, r, apierror.CodeLocked, "", "Folder contains approved notes (read-only): "+found[0])
+    }
+    return true
+}
+
+// -------------------------------------------------------
+// func workflowRename(ctx context.Context, from, to string)
+// -------------------------------------------------------
+// Purpose:
+//   - Move a note's workflow record along with it.
+// -------------------------------------------------------
+func workflowRename(ctx context.Context, from, to string) {
+    workflowMu.Lock()
+    defer workflowMu.Unlock()
+    records := loadWorkflowLocked(ctx)
+    record, ok := records[from]
+    if !ok {
+        return
+    }
+    delete(records, from)
+    record.Path = to
+    records[to] = record
+    if err := saveMetaJSON(ctx, workflowFile, records); err != nil {
+        logError(ctx, "Failed to move workflow record "+from+" -> "+to+": "+err.Error())
+    }
+    touchListing(from, to)
+}
+
+// -------------------------------------------------------
+// func HandleWorkflow(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - GET ?path=: current state and history (draft if none).
+//   - POST {"path", "action", "comment"}: perform a transition.
+// Audit:
+//   - 401 without a user, 403 without the required role, 409 when
+//     the note is not in the action's starting state.
+// -------------------------------------------------------
+func HandleWorkflow(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        absPath := sanitizePath(r.Context(), r.URL.Query().Get("path"))
+        if absPath == "" || !isNoteName(absPath) {
+            apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+            return
+        }
+        rel := relativeTo(r.Context(), absPath)
+
+        workflowMu.Lock()
+        record, ok := loadWorkflowLocked(r.Context())[rel]
+        workflowMu.Unlock()
+        if !ok {
+            record = WorkflowRecord{Path: rel, State: stateDraft}
+        }
+        if record.History == nil {
+            record.History = []Transition{}
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(record)
+
+    case http.MethodPost:
+        handleWorkflowTransition(w, r)
+
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+    }
+}
+
+// -------------------------------------------------------
+// func handleWorkflowTransition(w, r)
+// -------------------------------------------------------
+// Purpose:
+//   - POST /file/workflow: validate and record one transition.
+// -------------------------------------------------------
+func handleWorkflowTransition(w http.ResponseWriter, r *http.Request) {
+    user, ok := requireUser(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        Path    string `json:"path"`
+        Action  string `json:"action"`
+        Comment string `json:"comment"`
+    }
+    if !decodeJSON(w, r, &req) || !requireField(w, r, "path", req.Path) {
+        return
+    }
+    action, known := workflowActions[req.Action]
+    if !known {
+        apierror.Write(w, r, apierror.CodeInvalidField, "action", "Bad request: action must be submit, reject, approve, or reopen")
+        return
+    }
+    req.Comment = strings.TrimSpace(req.Comment)
+    if action.RequireComment && req.Comment == "" {
+        apierror.Write(w, r, apierror.CodeMissingField, "comment", "Bad request: "+req.Action+" requires a comment")
+        return
+    }
+    if len(req.Comment) > 2000 {
+        apierror.Write(w, r, apierror.CodeInvalidField, "comment", "Bad request: comment exceeds 2000 bytes")
+        return
+    }
+
+    absPath := sanitizePath(r.Context(), req.Path)
+    if absPath == "" || !isNoteName(absPath) {
+        apierror.Write(w, r, apierror.CodeInvalidPath, "path", "Invalid file path")
+        return
+    }
+    if rejectIfArchived(w, r, absPath) {
+        return
+    }
+    rel := relativeTo(r.Context(), absPath)
+    if _, err := statPath(r.Context(), absPath); os.IsNotExist(err) {
+        apierror.Write(w, r, apierror.CodeNotFound, "", "File not found")
+        return
+    }
+
+    permitted := false
+    for _, role := range action.Roles {
+        if user.HasRole(role) {
+            permitted = true
+        }
+    }
+    if !permitted {
+        auditWorkflow(r, "workflow.denied", http.StatusForbidden, user.Name, rel,
+            fmt.Sprintf("action=%s requires role %s", req.Action, strings.Join(action.Roles, " or ")))
+        apierror.Write(w, r, apierror.CodeForbidden, "", "Forbidden: "+req.Action+" requires role "+strings.Join(action.Roles, " or "))
+        return
+    }
+
+    workflowMu.Lock()
+    defer workflowMu.Unlock()
+
+    records := loadWorkflowLocked(r.Context())
+    record, exists := records[rel]
+    if !exists {
+        record = WorkflowRecord{Path: rel, State: stateDraft, History: []Transition{}}
+    }
+    if record.State != action.From {
+        apierror.Write(w, r, apierror.CodeConflict, "", fmt.Sprintf("Cannot %s a note in state %s", req.Action, record.State))
+        return
+    }
+
+    now := utcNow(r.Context())
+    record.History = append(record.History, Transition{
+        Action:  req.Action,
+        From:    record.State,
+        To:      action.To,
+        Actor:   user.Name,
+        Comment: req.Comment,
+        At:      now,
+    })
+    record.State = action.To
+    record.UpdatedAt = now
+    record.UpdatedBy = user.Name
+    records[rel] = record
+    if err := saveMetaJSON(r.Context(), workflowFile, records); err != nil {
+        writeStorageError(w, r, err, "save workflow state", "Transition failed")
+        return
+    }
+    touchListing(rel)
+
+    logInfo(r.Context(), fmt.Sprintf("Workflow %s: %s %s -> %s by %s", req.Action, rel, action.From, action.To, user.Name))
+    auditWorkflow(r, "workflow."+req.Action, http.StatusOK, user.Name, rel,
+        fmt.Sprintf("from=%s to=%s comment=%q", action.From, action.To, req.Comment))
+    fireAutomations(r.Context(), AutomationEvent{
+        Event:    "workflow." + req.Action,
+        Path:     rel,
+        Actor:    user.Name,
+        Workflow: &AutomationWorkflow{From: action.From, To: action.To, Comment: req.Comment},
+        At:       now,
+    })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(record)
+}
+
+// auditWorkflow writes a workflow audit event for actor.
+func auditWorkflow(r *http.Request, event string, status int, actor string, target string, detail string) {
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    event,
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actor,
+        Target:   target,
+        Detail:   detail,
+    })
+}
@@ -0,0 +1,110 @@
+//-------------------------------------------------------
+// backend/http_server.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Build and run the HTTP server from the "server" configuration:
+//     connection timeouts, header size limit, keep-alives, and TLS
+//     with HTTP/2.
+// Audit:
+//   - Replaces the bare http.ListenAndServe, whose zero timeouts let a
+//     client hold a connection open indefinitely by sending its
+//     request a byte at a time (slowloris).
+//   - Read at startup only; a reload that changes "server" is
+//     reported and takes effect after a restart.
+// Configuration:
+//   - server.read_header_timeout / read_timeout / write_timeout /
+//     idle_timeout, server.max_header_bytes,
+//     server.disable_keep_alives, server.tcp_keep_alive.
+//   - server.tls_cert_file + server.tls_key_file (or TLS_CERT_FILE /
+//     TLS_KEY_FILE) serve HTTPS; server.http2 (default true) offers
+//     HTTP/2 over it.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "fmt"
+    "net"
+    "net/http"
+
+    "cfo-scratchpad/config"
+)
+
+//-------------------------------------------------------
+// Function: newHTTPServer
+//-------------------------------------------------------
+// Purpose:
+//   - http.Server for handler with the configured limits.
+// Audit:
+//   - With TLS, connections need TLS 1.2 or later. Without HTTP/2,
+//     TLSNextProto is emptied so only HTTP/1.1 is negotiated.
+//-------------------------------------------------------
+func newHTTPServer(cfg *config.Config, handler http.Handler) *http.Server {
+    s := cfg.Server
+    srv := &http.Server{
+        Addr:              ":" + cfg.Port,
+        Handler:           handler,
+        ReadHeaderTimeout: s.ReadHeaderTimeout.Std(),
+        ReadTimeout:       s.ReadTimeout.Std(),
+        WriteTimeout:      s.WriteTimeout.Std(),
+        IdleTimeout:       s.IdleTimeout.Std(),
+        MaxHeaderBytes:    s.MaxHeaderBytes,
+    }
+    srv.SetKeepAlivesEnabled(!s.DisableKeepAlives)
+    if s.TLSCertFile != "" {
+        srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+        if !s.HTTP2 {
+            srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+        }
+    }
+    return srv
+}
+
+//-------------------------------------------------------
+// Function: serveHTTP
+//-------------------------------------------------------
+// Purpose:
+//   - Listen on the configured port (or the socket systemd passed
+//     in, see systemd.go) and serve until failure.
+// Audit:
+//   - The listener sets the TCP keep-alive period itself, so idle
+//     peers that vanished are detected even when HTTP keep-alives
+//     are off. An activated socket keeps the socket unit's settings.
+//   - systemd is told READY=1 once the listener exists, and the
+//     watchdog starts when the unit asks for one.
+//-------------------------------------------------------
+func serveHTTP(cfg *config.Config, handler http.Handler) error {
+    srv := newHTTPServer(cfg, handler)
+    s := cfg.Server
+
+    listener, err := activationListener()
+    if err != nil {
+        return err
+    }
+    if listener != nil {
+        logInfo("Serving on socket passed by systemd: " + listener.Addr().String())
+    } else {
+        keepAlive := s.TCPKeepAlive.Std()
+        if keepAlive == 0 {
+            keepAlive = -1
+        }
+        listener, err = (&net.ListenConfig{KeepAlive: keepAlive}).Listen(context.Background(), "tcp", srv.Addr)
+        if err != nil {
+            return err
+        }
+    }
+    notifySystemd("READY=1\nSTATUS=Serving on " + listener.Addr().String())
+    if interval := watchdogInterval(); interval > 0 {
+        go runWatchdog(interval, listener, s.TLSCertFile != "")
+    }
+
+    logInfo(fmt.Sprintf("HTTP server: tls=%t http2=%t read_header_timeout=%s read_timeout=%s write_timeout=%s idle_timeout=%s max_header_bytes=%d keep_alives=%t",
+        s.TLSCertFile != "", s.TLSCertFile != "" && s.HTTP2, s.ReadHeaderTimeout.Std(), s.ReadTimeout.Std(), s.WriteTimeout.Std(),
+        s.IdleTimeout.Std(), s.MaxHeaderBytes, !s.DisableKeepAlives))
+    if s.TLSCertFile == "" {
+        return srv.Serve(listener)
+    }
+    return srv.ServeTLS(listener, s.TLSCertFile, s.TLSKeyFile)
+}
@@ -0,0 +1,62 @@
+// -------------------------------------------------------
+// backend/layout.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - The data-layout migrations of this release, applied at
+//     startup before any route is served (see migrations/).
+// Audit:
+//   - Append new steps at the end with the next version; never
+//     renumber or remove a released step.
+//   - The server refuses to start on a failed migration or on a
+//     layout newer than it knows.
+// -------------------------------------------------------
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "cfo-scratchpad/handlers"
+    "cfo-scratchpad/migrations"
+)
+
+// layoutMigrations upgrade a scratch root to the current layout.
+var layoutMigrations = []migrations.Migration{
+    {
+        Version: 1,
+        Name:    "metadata directory",
+        Apply: func(root string) error {
+            return os.MkdirAll(filepath.Join(root, ".scratchpad"), 0755)
+        },
+    },
+    {
+        Version: 2,
+        Name:    "index existing notes",
+        Apply: func(root string) error {
+            // Data directories from before the metadata index have
+            // notes the index does not know; fsck repair adds them.
+            _, err := handlers.RunFsck(handlers.NewServer(root, nil, nil, nil, nil).Context(), true)
+            return err
+        },
+    },
+}
+
+// -------------------------------------------------------
+// func runMigrations(root string) error
+// -------------------------------------------------------
+// Purpose:
+//   - Bring root up to the current layout and log each step.
+// -------------------------------------------------------
+func runMigrations(root string) error {
+    applied, err := migrations.Run(root, layoutMigrations)
+    for _, step := range applied {
+        logInfo(fmt.Sprintf("Applied data layout migration %d: %s", step.Version, step.Name))
+    }
+    if err != nil {
+        return err
+    }
+    logInfo(fmt.Sprintf("Data layout version %d", len(layoutMigrations)))
+    return nil
+}
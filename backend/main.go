@@ -4,7 +4,13 @@
 // Purpose Summary:
 //   - Entry point for cfo-scratchpad backend service.
 //   - Initializes secure REST API routes for folder and file handling.
-//   - Serves static frontend assets from ./frontend via HTTP root path.
+//   - Exposes /metrics and /admin/stats for per-route latency SLO tracking.
+//   - Reports build identity via /version (see buildinfo package).
+//   - Groups operational actions under /admin (see admin.go).
+//   - Dispatches operator subcommands (see commands.go) when given args.
+//   - Loads configuration (config package) and hot-reloads it on SIGHUP.
+//   - Serves static frontend assets from ./frontend via HTTP root path,
+//     verified against the build-time asset manifest (see assets.go).
 // Audit:
 //   - Logs all actions with UTC ISO 8601 timestamps.
 //   - Fails fast on any binding or dependency error.
@@ -18,15 +24,18 @@ import (
     "log"
     "net/http"
     "os"
+    "strings"
+    "sync/atomic"
     "time"
 
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/buildinfo"
+    "cfo-scratchpad/clock"
+    "cfo-scratchpad/config"
     "cfo-scratchpad/handlers"
 )
 
-const (
-    defaultPort   = "8080"
-    staticDirPath = "./frontend"
-)
+const staticDirPath = "./frontend"
 
 // -------------------------------------------------------
 // func utcNow()
@@ -64,6 +73,18 @@ func logError(message string) {
     log.Printf("[ERROR] %s %s\n", utcNow(), message)
 }
 
+// -------------------------------------------------------
+// func logWarn()
+// -------------------------------------------------------
+// Purpose:
+//   - Logs warning messages with UTC timestamp.
+// Audit:
+//   - Used for degraded-but-running conditions (e.g., SLO breaches).
+// -------------------------------------------------------
+func logWarn(message string) {
+    log.Printf("[WARN] %s %s\n", utcNow(), message)
+}
+
 // -------------------------------------------------------
 // func main()
 // -------------------------------------------------------
@@ -75,31 +96,243 @@ func logError(message string) {
 //   - Ensures all handlers are secure, minimal, and logged.
 // -------------------------------------------------------
 func main() {
+    // Operator subcommands (e.g. `fsck`) run instead of the server.
+    if len(os.Args) > 1 {
+        os.Exit(runCommand(os.Args[1:]))
+    }
+
+    // Configuration: defaults, environment, then CONFIG_FILE.
+    cfg, err := config.Init()
+    if err != nil {
+        logError("Configuration error: " + err.Error())
+        os.Exit(1)
+    }
+    logInfo("Starting cfo-scratchpad " + buildinfo.String() + " (" + buildinfo.Get().GoVersion + ")")
+    logInfo("Configuration loaded from " + describeConfigSource())
+    go watchConfigSignals()
+
+    if cfg.ReadOnly {
+        setReadOnly(true)
+        logInfo("Starting in read-only mode")
+    }
+    // Handler dependencies: scratch root, configuration (re-read on
+    // reload), note storage, logger, and clock. The same clock stamps
+    // audit evidence. Background jobs run on server.Context().
+    clk := clock.System{}
+    audit.SetClock(clk)
+    audit.SetDurable(func() bool { return config.Current().DurableWrites })
+    root := handlers.DefaultRoot
+    server := handlers.NewServer(root, config.Current, handlers.OSStorage{Root: root}, handlers.StdoutLogger{Clock: clk}, clk)
+    serverCtx := server.Context()
+
+    handlers.StartFollower(serverCtx, cfg.Sync.Follower)
+    if cfg.AdminKey == "" {
+        logInfo("Admin API disabled (admin_key not set)")
+    }
+    verifyAssets(cfg)
+    if err := startTracing(cfg); err != nil {
+        logError("Tracing setup failed: " + err.Error())
+        os.Exit(1)
+    }
+
+    // Upgrade the data directory's on-disk layout before serving.
+    if err := runMigrations(server.Root); err != nil {
+        logError("Data layout migration failed: " + err.Error())
+        os.Exit(1)
+    }
+
     mux := http.NewServeMux()
 
+    // handle registers an API route with its request deadline and
+    // records it for per-route metrics; /admin/ and /audit/ routes
+    // also require the admin key, /sync/ routes the sync key, and all
+    // others identify the calling user (and honor Idempotency-Key on
+    // the mutating routes).
+    handle := func(pattern string, h http.HandlerFunc) {
+        apiRoutes[pattern] = true
+        var handler http.Handler = TimeoutMiddleware(pattern, RouteSpanMiddleware(pattern, h))
+        if strings.HasPrefix(pattern, adminPrefix) || strings.HasPrefix(pattern, auditPrefix) {
+            handler = AdminMiddleware(handler)
+        } else if strings.HasPrefix(pattern, syncPrefix) {
+            handler = SyncMiddleware(handler)
+        } else {
+            handler = UserMiddleware(pattern, IdempotencyMiddleware(pattern, handler))
+        }
+        mux.Handle(pattern, handler)
+    }
+
     // API routes
-    mux.HandleFunc("/folders", handlers.HandleFolders)
-    mux.HandleFunc("/files", handlers.HandleFileList)
-    mux.HandleFunc("/file", handlers.HandleFileGet)
-    mux.HandleFunc("/file/save", handlers.HandleFileSave)
-    mux.HandleFunc("/file/move", handlers.HandleFileMove)
+    handle("/folders", handlers.HandleFolders)
+    handle("/folders/archive", handlers.HandleFolderArchive)
+    handle("/folders/unarchive", handlers.HandleFolderUnarchive)
+    handle("/folders/bootstrap", handlers.HandleFolderBootstrap)
+    handle("/folders/meta", handlers.HandleFolderMeta)
+    handle("/folders/order", handlers.HandleFolderOrder)
+    handle("/rollover", handlers.HandleRollover)
+    handle("/recurring", handlers.HandleRecurring)
+    handle("/rules", handlers.HandleRules)
+    handle("/rules/preview", handlers.HandleRulesPreview)
+    handle("/rules/run", handlers.HandleRulesRun)
+    handle("/rules/flags", handlers.HandleRuleFlags)
+    handle("/automations", handlers.HandleAutomations)
+    handle("/automations/test", handlers.HandleAutomationTest)
+    handle("/files", handlers.HandleFileList)
+    handle("/files/order", handlers.HandleFileOrder)
+    handle("/files/rename-batch", handlers.HandleFilesRenameBatch)
+    handle("/files/replace", handlers.HandleFilesReplace)
+    handle("/files/download", handlers.HandleFilesDownload)
+    handle("/export", handlers.HandleExport)
+    handle("/file", handlers.HandleFileGet)
+    handle("/file/save", handlers.HandleFileSave)
+    handle("/file/move", handlers.HandleFileMove)
+    handle("/file/merge", handlers.HandleFileMerge)
+    handle("/file/split", handlers.HandleFileSplit)
+    handle("/file/concat", handlers.HandleFileConcat)
+    handle("/file/import", handlers.HandleFileImport)
+    handle("/file/paste-image", handlers.HandleFilePasteImage)
+    handle("/attachments/thumb", handlers.HandleAttachmentThumb)
+    handle("/file/fix-encoding", handlers.HandleFileFixEncoding)
+    handle("/file/ledger", handlers.HandleLedger)
+    handle("/file/sign", handlers.HandleFileSign)
+    handle("/file/signatures", handlers.HandleFileSignatures)
+    handle("/file/preview", handlers.HandleFilePreview)
+    handle("/file/stats", handlers.HandleFileStats)
+    handle("/file/access-log", handlers.HandleFileAccessLog)
+    handle("/file/lint", handlers.HandleFileLint)
+    handle("/file/extract-numbers", handlers.HandleFileExtractNumbers)
+    handle("/file/toc", handlers.HandleFileToc)
+    handle("/file/render", handlers.HandleFileRender)
+    handle("/file/export", handlers.HandleFileExport)
+    handle("/file/workflow", handlers.HandleWorkflow)
+    handle("/file/language", handlers.HandleFileLanguage)
+    handle("/file/audio", handlers.HandleFileAudio)
+    handle("/file/comments", handlers.HandleComments)
+    handle("/file/comments/resolve", handlers.HandleCommentResolve)
+    handle("/trash", handlers.HandleTrash)
+    handle("/trash/restore", handlers.HandleTrashRestore)
+    handle("/conflicts", handlers.HandleConflicts)
+    handle("/conflicts/resolve", handlers.HandleConflictResolve)
+    handle("/preferences", handlers.HandlePreferences)
+    handle("/snippets", handlers.HandleSnippets)
+    handle("/scratch", handlers.HandleScratch)
+    handle("/activity", handlers.HandleActivity)
+    handle("/changes", handlers.HandleChanges)
+    handle("/events", handlers.HandleEvents)
+    handle("/search", handlers.HandleSearch)
+    handle("/tasks", handlers.HandleTasks)
+    handle("/calendar", handlers.HandleCalendar)
+    handle("/calendar.ics", handlers.HandleCalendarICS)
+    handle("/calendar/feed", handlers.HandleCalendarFeed)
+    handle("/reports/duplicates", handlers.HandleDuplicatesReport)
+    handle("/reports/usage", handlers.HandleUsageReport)
+    handle("/reports/broken-links", handlers.HandleBrokenLinksReport)
+    handle("/reports/sensitive", handlers.HandleSensitiveReport)
+    handle("/reports/sensitive/redact", handlers.HandleSensitiveRedact)
+    handle("/auth/login", handlers.HandleLogin)
+    handle("/auth/logout", handlers.HandleLogout)
+    handle("/auth/sessions", handlers.HandleSessions)
+    handle("/auth/sessions/revoke", handlers.HandleSessionRevoke)
+    handle("/auth/totp", handlers.HandleTOTP)
+    handle("/auth/totp/enroll", handlers.HandleTOTPEnroll)
+    handle("/auth/totp/qr.svg", handlers.HandleTOTPQR)
+    handle("/auth/totp/confirm", handlers.HandleTOTPConfirm)
+    handle("/auth/totp/recovery-codes", handlers.HandleTOTPRecoveryCodes)
+    handle("/auth/totp/disable", handlers.HandleTOTPDisable)
+
+    // Admin routes (admin key required)
+    handle("/admin/read-only", handleReadOnly)
+    handle("/admin/maintenance", handleMaintenance)
+    handle("/admin/config", handleConfig)
+    handle("/admin/config/reload", handleConfigReload)
+    handle("/admin/backup", handleBackup)
+    handle("/admin/logs/rotate", handleRotateLogs)
+    handle("/admin/evidence-bundle", handlers.HandleEvidenceBundle)
+    handle("/admin/stats", handleAdminStats)
+    handle("/admin/alerts", handleAlerts)
+    handle("/admin/lockouts", handleLockouts)
+    handle("/admin/lockouts/clear", handleLockoutClear)
+    handle("/admin/totp/reset", handlers.HandleTOTPReset)
+    handle("/admin/sessions", handlers.HandleAdminSessions)
+    handle("/admin/sessions/revoke", handlers.HandleAdminSessionRevoke)
+    handle("/admin/fsck", handlers.HandleFsck)
+    handle("/admin/compact", handlers.HandleCompact)
+    handle("/admin/jobs", handlers.HandleJobs)
+    handle("/admin/jobs/cancel", handlers.HandleJobCancel)
+    handle("/admin/holds", handlers.HandleHolds)
+    handle("/admin/holds/release", handlers.HandleHoldRelease)
+    handle("/admin/quarantine", handlers.HandleQuarantine)
+    handle("/admin/sync", handlers.HandleSyncAdmin)
+    handle("/admin/follower", handlers.HandleFollower)
+    handle("/admin/follower/promote", handlers.HandleFollowerPromote)
+    handle("/admin/runtime", handleAdminRuntime)
+    handle("/admin/probes", handleProbeReport)
+    handle(pprofPrefix, handlePprof)
+
+    // Evidence export for the SIEM (admin key required)
+    handle("/audit/export", handleAuditExport)
+
+    // Instance-to-instance sync (sync key required)
+    handle("/sync/changes", handlers.HandleSyncChanges)
+    handle("/sync/file", handlers.HandleSyncFile)
+
+    // Operational routes
+    handle("/metrics", handleMetrics)
+    handle("/readyz", handleReadyz)
+    handle("/version", handleVersion)
 
     // Static frontend
     fs := http.FileServer(http.Dir(staticDirPath))
-    mux.Handle("/", fs)
+    mux.Handle("/", AssetIntegrityMiddleware(fs))
 
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = defaultPort
-    }
+    port := cfg.Port
 
     logInfo("Binding routes and starting server on port " + port)
 
-    // Wrap all routes in AuditMiddleware to capture request evidence
-    auditedMux := AuditMiddleware(mux) 
+    // Evaluate latency SLOs in the background
+    go latencyTracker.run()
 
-    err := http.ListenAndServe(":"+port, auditedMux)
-    if err != nil {
+    // Watch the audit stream for anomalies (anomaly.enabled)
+    audit.SetObserver(anomalies.observe)
+    go anomalies.run()
+
+    // Summarize each day's probes into the evidence log
+    go runProbeReports()
+
+    // Purge trash items past their retention
+    go handlers.RunTrashRetention(serverCtx)
+
+    // Check links on the configured schedule (link_check_interval)
+    go handlers.RunLinkCheck(serverCtx)
+
+    // Compact storage on the configured schedule (compact.interval)
+    go handlers.RunCompactSchedule(serverCtx)
+
+    // Roll period folders over on rollover.day
+    go handlers.RunRollover(serverCtx)
+    go handlers.RunRecurring(serverCtx)
+    go handlers.RunRules(serverCtx)
+
+    // Post automation webhooks for local changes
+    go handlers.RunAutomations(serverCtx)
+
+    // Run background jobs submitted via /admin/jobs (job_workers)
+    handlers.StartJobs(serverCtx, cfg.JobWorkers)
+
+    // Pull from the sync primary, if configured (paused while
+    // read-only or in maintenance)
+    go handlers.RunSyncPuller(serverCtx, func() bool { return atomic.LoadInt32(&readOnly) == 1 || maintenanceActive() })
+
+    // Wrap all routes in the handler Server, ReadOnlyMiddleware, then
+    // MaintenanceMiddleware so only /admin passes during maintenance, then
+    // AuditMiddleware to capture request evidence, then
+    // RecoverMiddleware so handler panics are audited as 500s, then
+    // TracingMiddleware so the request span covers all of them, then
+    // IPAccessMiddleware so refused addresses reach none of them, then
+    // SecurityHeadersMiddleware so every response carries them, then
+    // RequestIDMiddleware so every layer sees the request ID.
+    auditedMux := RequestIDMiddleware(SecurityHeadersMiddleware(IPAccessMiddleware(TracingMiddleware(RecoverMiddleware(clk, AuditMiddleware(clk, MaintenanceMiddleware(ReadOnlyMiddleware(server.Handler(mux)))))))))
+
+    if err := serveHTTP(cfg, auditedMux); err != nil {
         logError("Server failed to start: " + err.Error())
         os.Exit(1)
     }
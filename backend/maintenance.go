@@ -0,0 +1,309 @@
+//-------------------------------------------------------
+// backend/maintenance.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Maintenance mode: while on, every route outside /admin answers
+//     503, so backups and migrations run without partial writes.
+//       GET/POST /admin/maintenance   view / toggle maintenance mode
+//   - Browsers get a maintenance page (built in, or the HTML file
+//     named by maintenance_page); API clients get the JSON error
+//     "maintenance".
+// Audit:
+//   - Turning it on writes "admin.maintenance_start" (message and
+//     expected end); turning it off writes "admin.maintenance_end"
+//     with how long it lasted and how many requests were refused.
+//   - Refused requests are audited like any other request (503).
+//   - Scheduled writers (rollover, recurring notes, expiry rules,
+//     trash retention, link check, compaction, sync pull) pause
+//     while it is on.
+//   - The mode is not persisted: a restart ends it.
+// Configuration:
+//   - maintenance_page / MAINTENANCE_PAGE   absolute path of a custom
+//     HTML page; {{message}}, {{since}} and {{until}} are replaced.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "html"
+    "io"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/handlers"
+)
+
+const (
+    maintenanceDefaultMessage = "The scratchpad is down for scheduled maintenance."
+    maintenanceMaxMessage     = 500
+)
+
+// maintenanceSafeRoutes stay available during maintenance so that
+// monitoring does not alert on it.
+var maintenanceSafeRoutes = map[string]bool{
+    "/metrics": true,
+    "/readyz":  true,
+    "/version": true,
+}
+
+// maintenancePage is the built-in page. It carries no inline styles
+// or scripts, so the default Content-Security-Policy allows it.
+const maintenancePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Maintenance - CFO Scratchpad</title>
+</head>
+<body>
+<h1>Scheduled maintenance</h1>
+<p>{{message}}</p>
+<p>Started {{since}}. Expected back {{until}}.</p>
+<p>Your notes are safe. Please try again later.</p>
+</body>
+</html>
+`
+
+//-------------------------------------------------------
+// Struct: MaintenanceStatus
+//-------------------------------------------------------
+// Purpose:
+//   - Response body of GET/POST /admin/maintenance.
+//-------------------------------------------------------
+type MaintenanceStatus struct {
+    Enabled bool       `json:"enabled"`
+    Message string     `json:"message,omitempty"`
+    Since   *time.Time `json:"since,omitempty"`
+    Until   *time.Time `json:"until,omitempty"`
+    Refused int64      `json:"refused"`
+}
+
+// maintenance holds the current mode and its rendered page.
+var maintenance struct {
+    mu      sync.RWMutex
+    status  MaintenanceStatus
+    page    string
+    refused atomic.Int64
+}
+
+//-------------------------------------------------------
+// Function: currentMaintenance
+//-------------------------------------------------------
+// Purpose:
+//   - Snapshot of the mode and the page to serve.
+//-------------------------------------------------------
+func currentMaintenance() (MaintenanceStatus, string) {
+    maintenance.mu.RLock()
+    defer maintenance.mu.RUnlock()
+    status := maintenance.status
+    status.Refused = maintenance.refused.Load()
+    return status, maintenance.page
+}
+
+//-------------------------------------------------------
+// Function: renderMaintenancePage
+//-------------------------------------------------------
+// Purpose:
+//   - Fill the page template (custom or built-in) for status.
+// Audit:
+//   - An unreadable custom page falls back to the built-in one with
+//     a warning, so maintenance can always be turned on.
+//-------------------------------------------------------
+func renderMaintenancePage(status MaintenanceStatus) string {
+    page := maintenancePage
+    if custom := config.Current().MaintenancePage; custom != "" {
+        data, err := os.ReadFile(custom)
+        if err != nil {
+            logWarn("Maintenance page unreadable, using the built-in page: " + err.Error())
+        } else {
+            page = string(data)
+        }
+    }
+    until := "shortly"
+    if status.Until != nil {
+        until = status.Until.Format("2006-01-02 15:04 MST")
+    }
+    return strings.NewReplacer(
+        "{{message}}", html.EscapeString(status.Message),
+        "{{since}}", html.EscapeString(status.Since.Format("2006-01-02 15:04 MST")),
+        "{{until}}", html.EscapeString(until),
+    ).Replace(page)
+}
+
+//-------------------------------------------------------
+// Function: MaintenanceMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Answer 503 for every request outside /admin while maintenance
+//     mode is on.
+// Audit:
+//   - Admin routes, /audit/ (admin key) and maintenanceSafeRoutes
+//     pass. GET/HEAD requests accepting text/html get the page;
+//     everything else gets the "maintenance" JSON error.
+//   - Retry-After counts the seconds to the expected end, if set.
+//-------------------------------------------------------
+func MaintenanceMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        status, page := currentMaintenance()
+        if !status.Enabled || strings.HasPrefix(r.URL.Path, adminPrefix) || strings.HasPrefix(r.URL.Path, "/audit/") || maintenanceSafeRoutes[r.URL.Path] {
+            next.ServeHTTP(w, r)
+            return
+        }
+        maintenance.refused.Add(1)
+        w.Header().Set("Cache-Control", "no-store")
+        if status.Until != nil {
+            if wait := time.Until(*status.Until); wait > 0 {
+                w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+            }
+        }
+        if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.Contains(r.Header.Get("Accept"), "text/html") {
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(http.StatusServiceUnavailable)
+            if r.Method == http.MethodGet {
+                io.WriteString(w, page)
+            }
+            return
+        }
+        apierror.Write(w, r, apierror.CodeMaintenance, "", "Service is in maintenance mode: "+status.Message)
+    })
+}
+
+//-------------------------------------------------------
+// Function: maintenanceActive
+//-------------------------------------------------------
+// Purpose:
+//   - Whether maintenance mode is on.
+//-------------------------------------------------------
+func maintenanceActive() bool {
+    maintenance.mu.RLock()
+    defer maintenance.mu.RUnlock()
+    return maintenance.status.Enabled
+}
+
+//-------------------------------------------------------
+// Function: handleMaintenance
+//-------------------------------------------------------
+// Purpose:
+//   - GET: current mode. POST {"enabled": bool, "message": string,
+//     "duration": "30m"}: turn it on (or update the message and
+//     expected end) or off.
+// Audit:
+//   - Writes "admin.maintenance_start" or "admin.maintenance_end"
+//     when the mode changes, "admin.maintenance" otherwise.
+//-------------------------------------------------------
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        var req struct {
+            Enabled  *bool  `json:"enabled"`
+            Message  string `json:"message"`
+            Duration string `json:"duration"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+            apierror.Write(w, r, apierror.CodeInvalidField, "enabled", `Bad request: expected {"enabled": true|false}`)
+            return
+        }
+        message := strings.TrimSpace(req.Message)
+        if message == "" {
+            message = maintenanceDefaultMessage
+        }
+        if len(message) > maintenanceMaxMessage {
+            apierror.Write(w, r, apierror.CodeInvalidField, "message", fmt.Sprintf("Bad request: message must be at most %d bytes", maintenanceMaxMessage))
+            return
+        }
+        var expected time.Duration
+        if req.Duration != "" {
+            d, err := time.ParseDuration(req.Duration)
+            if err != nil || d <= 0 {
+                apierror.Write(w, r, apierror.CodeInvalidField, "duration", `Bad request: duration must be a positive duration such as "30m"`)
+                return
+            }
+            expected = d
+        }
+        if *req.Enabled {
+            startMaintenance(r, message, expected)
+        } else {
+            endMaintenance(r)
+        }
+    default:
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    status, _ := currentMaintenance()
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(status)
+}
+
+//-------------------------------------------------------
+// Function: startMaintenance
+//-------------------------------------------------------
+// Purpose:
+//   - Turn maintenance mode on, or update its message and expected
+//     end when it is already on.
+//-------------------------------------------------------
+func startMaintenance(r *http.Request, message string, expected time.Duration) {
+    now := audit.Clock().Now().UTC()
+    maintenance.mu.Lock()
+    changed := !maintenance.status.Enabled
+    status := MaintenanceStatus{Enabled: true, Message: message, Since: &now}
+    if !changed {
+        status.Since = maintenance.status.Since
+    }
+    if expected > 0 {
+        until := now.Add(expected)
+        status.Until = &until
+    }
+    if changed {
+        maintenance.refused.Store(0)
+    }
+    maintenance.status = status
+    maintenance.page = renderMaintenancePage(status)
+    maintenance.mu.Unlock()
+
+    handlers.PauseSchedules(true)
+    detail := "message=" + strconv.Quote(message)
+    if status.Until != nil {
+        detail += " until=" + status.Until.Format(time.RFC3339)
+    }
+    if !changed {
+        auditAdmin(r, "admin.maintenance", http.StatusOK, "", "enabled=true changed=false "+detail)
+        return
+    }
+    auditAdmin(r, "admin.maintenance_start", http.StatusOK, "", detail)
+    logWarn("Maintenance mode started: " + message)
+}
+
+//-------------------------------------------------------
+// Function: endMaintenance
+//-------------------------------------------------------
+// Purpose:
+//   - Turn maintenance mode off and resume scheduled writers.
+//-------------------------------------------------------
+func endMaintenance(r *http.Request) {
+    maintenance.mu.Lock()
+    status := maintenance.status
+    maintenance.status = MaintenanceStatus{}
+    maintenance.page = ""
+    maintenance.mu.Unlock()
+
+    handlers.PauseSchedules(false)
+    if !status.Enabled {
+        auditAdmin(r, "admin.maintenance", http.StatusOK, "", "enabled=false changed=false")
+        return
+    }
+    lasted := audit.Clock().Now().UTC().Sub(*status.Since).Round(time.Second)
+    refused := maintenance.refused.Load()
+    auditAdmin(r, "admin.maintenance_end", http.StatusOK, "", fmt.Sprintf("duration=%s refused=%d", lasted, refused))
+    logInfo(fmt.Sprintf("Maintenance mode ended after %s (%d requests refused)", lasted, refused))
+}
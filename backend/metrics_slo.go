@@ -0,0 +1,394 @@
+//-------------------------------------------------------
+// backend/metrics_slo.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Track per-route request latency (p50/p95/p99) in memory.
+//   - Expose latency data via /metrics (Prometheus text) and
+//     /admin/stats (JSON), together with the per-path write queue
+//     counters (handlers/storage_queue.go).
+//   - Warn (and optionally fire a webhook) on SLO threshold breaches.
+// Audit:
+//   - Fed from the same audit.Event emitted for every request.
+//   - Samples are kept only for the rolling window; nothing is persisted.
+//   - Breaches are logged as one structured JSON line with UTC timestamp.
+// Configuration:
+//   - "slo" section of the config file, or the SLO_* environment
+//     variables (see config/config.go). Read on every evaluation,
+//     so a config reload takes effect without a restart.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/handlers"
+)
+
+const (
+    sloCheckInterval   = 30 * time.Second
+    maxSamplesPerRoute = 10000
+    staticRouteLabel   = "static"
+)
+
+//-------------------------------------------------------
+// Struct: latencySample
+//-------------------------------------------------------
+// Purpose:
+//   - One observed request duration for a route.
+//-------------------------------------------------------
+type latencySample struct {
+    at       time.Time
+    duration int64
+}
+
+//-------------------------------------------------------
+// Struct: RouteLatency
+//-------------------------------------------------------
+// Purpose:
+//   - JSON summary of a route's latency over the rolling window.
+// Audit:
+//   - Returned by /admin/stats; mirrors the /metrics quantiles.
+//-------------------------------------------------------
+type RouteLatency struct {
+    Route    string `json:"route"`
+    Samples  int    `json:"samples"`
+    Total    int64  `json:"total_requests"`
+    P50      int64  `json:"p50_ms"`
+    P95      int64  `json:"p95_ms"`
+    P99      int64  `json:"p99_ms"`
+    Breached bool   `json:"slo_breached"`
+}
+
+//-------------------------------------------------------
+// Struct: sloTracker
+//-------------------------------------------------------
+// Purpose:
+//   - Hold rolling latency samples and breach state per route.
+// Audit:
+//   - Guarded by a mutex; safe for concurrent request handlers.
+//-------------------------------------------------------
+type sloTracker struct {
+    mu       sync.Mutex
+    samples  map[string][]latencySample
+    totals   map[string]int64
+    breached map[string]bool
+}
+
+var (
+    latencyTracker = newSLOTracker()
+    apiRoutes      = map[string]bool{}
+)
+
+//-------------------------------------------------------
+// Function: newSLOTracker
+//-------------------------------------------------------
+// Purpose:
+//   - Build an empty tracker.
+// Audit:
+//   - Thresholds come from config.Current() at use time.
+//-------------------------------------------------------
+func newSLOTracker() *sloTracker {
+    return &sloTracker{
+        samples:  map[string][]latencySample{},
+        totals:   map[string]int64{},
+        breached: map[string]bool{},
+    }
+}
+
+//-------------------------------------------------------
+// Function: routeLabel
+//-------------------------------------------------------
+// Purpose:
+//   - Map a request path to a bounded route label.
+// Audit:
+//   - Static asset paths collapse into one label so arbitrary
+//     URLs cannot grow the in-memory sample maps.
+//-------------------------------------------------------
+func routeLabel(path string) string {
+    if apiRoutes[path] {
+        return path
+    }
+    return staticRouteLabel
+}
+
+//-------------------------------------------------------
+// Function: (*sloTracker) record
+//-------------------------------------------------------
+// Purpose:
+//   - Store one request duration taken from an audit.Event.
+// Audit:
+//   - Drops samples older than the window and caps per-route size.
+//-------------------------------------------------------
+func (t *sloTracker) record(event audit.Event) {
+    route := routeLabel(event.Path)
+    now := audit.Clock().Now().UTC()
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    list := append(t.samples[route], latencySample{at: now, duration: event.Duration})
+    list = pruneSamples(list, now.Add(-config.Current().SLO.Window.Std()))
+    if len(list) > maxSamplesPerRoute {
+        list = list[len(list)-maxSamplesPerRoute:]
+    }
+    t.samples[route] = list
+    t.totals[route]++
+}
+
+//-------------------------------------------------------
+// Function: pruneSamples
+//-------------------------------------------------------
+// Purpose:
+//   - Remove samples observed before the cutoff time.
+// Audit:
+//   - Samples are appended in time order, so a prefix is dropped.
+//-------------------------------------------------------
+func pruneSamples(list []latencySample, cutoff time.Time) []latencySample {
+    i := 0
+    for i < len(list) && list[i].at.Before(cutoff) {
+        i++
+    }
+    return list[i:]
+}
+
+//-------------------------------------------------------
+// Function: percentile
+//-------------------------------------------------------
+// Purpose:
+//   - Nearest-rank percentile over a sorted slice of durations.
+//-------------------------------------------------------
+func percentile(sorted []int64, p float64) int64 {
+    if len(sorted) == 0 {
+        return 0
+    }
+    rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+    if rank < 0 {
+        rank = 0
+    }
+    if rank >= len(sorted) {
+        rank = len(sorted) - 1
+    }
+    return sorted[rank]
+}
+
+//-------------------------------------------------------
+// Function: (*sloTracker) snapshot
+//-------------------------------------------------------
+// Purpose:
+//   - Compute per-route percentiles over the current window.
+// Audit:
+//   - Result is sorted by route for stable output.
+//-------------------------------------------------------
+func (t *sloTracker) snapshot() []RouteLatency {
+    cutoff := audit.Clock().Now().UTC().Add(-config.Current().SLO.Window.Std())
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    result := []RouteLatency{}
+    for route, list := range t.samples {
+        list = pruneSamples(list, cutoff)
+        t.samples[route] = list
+
+        durations := make([]int64, len(list))
+        for i, s := range list {
+            durations[i] = s.duration
+        }
+        sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+
+        result = append(result, RouteLatency{
+            Route:    route,
+            Samples:  len(durations),
+            Total:    t.totals[route],
+            P50:      percentile(durations, 0.50),
+            P95:      percentile(durations, 0.95),
+            P99:      percentile(durations, 0.99),
+            Breached: t.breached[route],
+        })
+    }
+    sort.Slice(result, func(a, b int) bool { return result[a].Route < result[b].Route })
+    return result
+}
+
+//-------------------------------------------------------
+// Function: (*sloTracker) evaluate
+//-------------------------------------------------------
+// Purpose:
+//   - Compare each route's p95 against the SLO threshold.
+// Audit:
+//   - Emits one warning when a route enters breach and one info
+//     line when it recovers; no repeated alerts while breached.
+//-------------------------------------------------------
+func (t *sloTracker) evaluate() {
+    slo := config.Current().SLO
+    if slo.P95Ms <= 0 {
+        return
+    }
+
+    for _, rl := range t.snapshot() {
+        breach := rl.Samples >= slo.MinSamples && rl.P95 > slo.P95Ms
+
+        t.mu.Lock()
+        wasBreached := t.breached[rl.Route]
+        t.breached[rl.Route] = breach
+        t.mu.Unlock()
+
+        if breach && !wasBreached {
+            t.alert(rl, slo)
+        } else if !breach && wasBreached {
+            logInfo(fmt.Sprintf("SLO recovered for route %s (p95=%dms)", rl.Route, rl.P95))
+        }
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*sloTracker) alert
+//-------------------------------------------------------
+// Purpose:
+//   - Log a structured breach warning and fire the optional webhook.
+// Audit:
+//   - Webhook failures are logged, never retried or fatal.
+//-------------------------------------------------------
+func (t *sloTracker) alert(rl RouteLatency, slo config.SLOConfig) {
+    payload := map[string]interface{}{
+        "event":        "slo_breach",
+        "timestamp":    utcNow(),
+        "route":        rl.Route,
+        "p50_ms":       rl.P50,
+        "p95_ms":       rl.P95,
+        "p99_ms":       rl.P99,
+        "samples":      rl.Samples,
+        "threshold_ms": slo.P95Ms,
+        "window":       slo.Window.Std().String(),
+    }
+
+    body, err := json.Marshal(payload)
+    if err != nil {
+        logError("SLO alert encode failed: " + err.Error())
+        return
+    }
+    logWarn(string(body))
+
+    if slo.WebhookURL == "" {
+        return
+    }
+    go func() {
+        client := &http.Client{Timeout: 5 * time.Second}
+        resp, err := client.Post(slo.WebhookURL, "application/json", bytes.NewReader(body))
+        if err != nil {
+            logError("SLO webhook failed: " + err.Error())
+            return
+        }
+        resp.Body.Close()
+        if resp.StatusCode >= 300 {
+            logError(fmt.Sprintf("SLO webhook returned HTTP %d", resp.StatusCode))
+        }
+    }()
+}
+
+//-------------------------------------------------------
+// Function: (*sloTracker) run
+//-------------------------------------------------------
+// Purpose:
+//   - Evaluate SLOs periodically for the life of the process.
+// Audit:
+//   - Keeps ticking while alerting is disabled so that enabling it
+//     through a config reload needs no restart.
+//-------------------------------------------------------
+func (t *sloTracker) run() {
+    if slo := config.Current().SLO; slo.P95Ms <= 0 {
+        logInfo("SLO alerting disabled (slo.p95_ms not set)")
+    } else {
+        logInfo(fmt.Sprintf("SLO alerting enabled: p95 > %dms over %s", slo.P95Ms, slo.Window.Std()))
+    }
+
+    ticker := time.NewTicker(sloCheckInterval)
+    defer ticker.Stop()
+    for range ticker.C {
+        t.evaluate()
+    }
+}
+
+//-------------------------------------------------------
+// Function: handleMetrics
+//-------------------------------------------------------
+// Purpose:
+//   - Serve per-route latency quantiles in Prometheus text format.
+// Audit:
+//   - Read-only; exposes durations and counts, never paths of files.
+//-------------------------------------------------------
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+    var b strings.Builder
+    b.WriteString("# HELP cfo_request_latency_ms Request latency over the rolling window.\n")
+    b.WriteString("# TYPE cfo_request_latency_ms summary\n")
+    for _, rl := range latencyTracker.snapshot() {
+        fmt.Fprintf(&b, "cfo_request_latency_ms{route=%q,quantile=\"0.5\"} %d\n", rl.Route, rl.P50)
+        fmt.Fprintf(&b, "cfo_request_latency_ms{route=%q,quantile=\"0.95\"} %d\n", rl.Route, rl.P95)
+        fmt.Fprintf(&b, "cfo_request_latency_ms{route=%q,quantile=\"0.99\"} %d\n", rl.Route, rl.P99)
+        fmt.Fprintf(&b, "cfo_request_latency_ms_count{route=%q} %d\n", rl.Route, rl.Total)
+    }
+    b.WriteString("# HELP cfo_slo_breached Whether the route currently breaches its p95 SLO.\n")
+    b.WriteString("# TYPE cfo_slo_breached gauge\n")
+    for _, rl := range latencyTracker.snapshot() {
+        breached := 0
+        if rl.Breached {
+            breached = 1
+        }
+        fmt.Fprintf(&b, "cfo_slo_breached{route=%q} %d\n", rl.Route, breached)
+    }
+    queue := handlers.WriteQueue()
+    b.WriteString("# HELP cfo_write_queue_depth Storage calls waiting for a per-path lock.\n")
+    b.WriteString("# TYPE cfo_write_queue_depth gauge\n")
+    fmt.Fprintf(&b, "cfo_write_queue_depth %d\n", queue.Depth)
+    b.WriteString("# HELP cfo_write_queue_max_depth Highest write queue depth since start.\n")
+    b.WriteString("# TYPE cfo_write_queue_max_depth gauge\n")
+    fmt.Fprintf(&b, "cfo_write_queue_max_depth %d\n", queue.MaxDepth)
+    b.WriteString("# HELP cfo_write_queue_writes_total Writes and renames serialized per path.\n")
+    b.WriteString("# TYPE cfo_write_queue_writes_total counter\n")
+    fmt.Fprintf(&b, "cfo_write_queue_writes_total %d\n", queue.Acquired)
+    b.WriteString("# HELP cfo_write_queue_contended_total Writes and renames that waited for another.\n")
+    b.WriteString("# TYPE cfo_write_queue_contended_total counter\n")
+    fmt.Fprintf(&b, "cfo_write_queue_contended_total %d\n", queue.Contended)
+    b.WriteString("# HELP cfo_write_queue_wait_seconds_total Time spent waiting for per-path locks.\n")
+    b.WriteString("# TYPE cfo_write_queue_wait_seconds_total counter\n")
+    fmt.Fprintf(&b, "cfo_write_queue_wait_seconds_total %g\n", queue.WaitSeconds)
+
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+    w.Write([]byte(b.String()))
+}
+
+//-------------------------------------------------------
+// Function: handleStats
+//-------------------------------------------------------
+// Purpose:
+//   - Serve per-route latency summary and SLO settings as JSON.
+// Audit:
+//   - Read-only; always returns an array for routes ([] when empty).
+//-------------------------------------------------------
+func handleStats(w http.ResponseWriter, r *http.Request) {
+    slo := config.Current().SLO
+    stats := map[string]interface{}{
+        "timestamp":    utcNow(),
+        "window":       slo.Window.Std().String(),
+        "threshold_ms": slo.P95Ms,
+        "read_only":    atomic.LoadInt32(&readOnly) == 1,
+        "maintenance":  maintenanceActive(),
+        "follower":     handlers.IsFollower(),
+        "routes":       latencyTracker.snapshot(),
+        "write_queue":  handlers.WriteQueue(),
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(stats)
+}
@@ -5,7 +5,8 @@
 //   - Record all file and API access events for audit evidence.
 //   - Maintain immutable event trail under /evidence/logs/.
 // Audit:
-//   - Appends JSON records to /evidence/logs/requests_YYYY-MM-DD.log.
+//   - Appends JSON records to /evidence/logs/requests_YYYY-MM-DD.log
+//     through audit.Write (see backend/audit/audit.go).
 //   - Emits UTC ISO 8601 timestamps for every action and error.
 //   - Never creates or modifies directories.
 //   - Fails safe if /evidence/logs/ is missing or unwritable.
@@ -17,31 +18,13 @@
 package main
 
 import (
-    "encoding/json"
-    "log"
     "net/http"
-    "os"
-    "path/filepath"
     "time"
-)
 
-//-------------------------------------------------------
-// Struct: AuditEvent
-//-------------------------------------------------------
-// Purpose:
-//   - Define a consistent JSON schema for auditable events.
-// Audit:
-//   - One event per line in /evidence/logs/requests_YYYY-MM-DD.log.
-//   - Immutable once written (append-only).
-//-------------------------------------------------------
-type AuditEvent struct {
-    Timestamp string `json:"timestamp"`
-    Method    string `json:"method"`
-    Path      string `json:"path"`
-    RemoteIP  string `json:"remote_ip"`
-    Status    int    `json:"status"`
-    Duration  int64  `json:"duration_ms"`
-}
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/clock"
+)
 
 //-------------------------------------------------------
 // Function: AuditMiddleware
@@ -49,26 +32,40 @@ type AuditEvent struct {
 // Purpose:
 //   - Wrap HTTP handlers to capture metadata on every request.
 // Audit:
-//   - Captures method, path, remote IP, response code, and latency.
-//   - Delegates event persistence to writeAuditEvent().
+//   - Captures method, path, remote IP, response code, latency, and
+//     the declared request body size.
+//   - Flags 504 responses (request deadline exceeded) as timed_out.
+//   - Categorizes the request as api, static or probe (probes.go).
+//   - Delegates event persistence to audit.WriteContext(), so the
+//     write is traced under the request span.
+//   - Feeds the same event to the per-route latency tracker.
 //   - Emits one structured JSON audit record per request.
+//   - Timestamp and duration are read from clk, so a pinned clock
+//     reproduces events exactly.
 //-------------------------------------------------------
-func AuditMiddleware(next http.Handler) http.Handler {
+func AuditMiddleware(clk clock.Clock, next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        start := time.Now().UTC()
+        start := clk.Now().UTC()
         lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
         next.ServeHTTP(lrw, r)
 
-        event := AuditEvent{
+        event := audit.Event{
             Timestamp: start.Format(time.RFC3339), // ISO 8601 UTC timestamp
             Method:    r.Method,
             Path:      r.URL.Path,
             RemoteIP:  r.RemoteAddr,
             Status:    lrw.statusCode,
-            Duration:  time.Since(start).Milliseconds(),
+            Duration:  clk.Now().Sub(start).Milliseconds(),
+            TimedOut:  lrw.statusCode == http.StatusGatewayTimeout,
+            RequestID: apierror.RequestID(r.Context()),
         }
+        if r.ContentLength > 0 {
+            event.RequestBytes = r.ContentLength
+        }
+        event.Category, event.Detail = classifyRequest(r, lrw.statusCode)
 
-        writeAuditEvent(event)
+        audit.WriteContext(r.Context(), event)
+        latencyTracker.record(event)
     })
 }
 
@@ -77,55 +74,32 @@ func AuditMiddleware(next http.Handler) http.Handler {
 //-------------------------------------------------------
 // Purpose:
 //   - Capture the final HTTP status code from handler responses.
+//   - Remember whether the response has started (headers sent).
 // Audit:
 //   - Ensures status codes are correctly logged in each event.
 //-------------------------------------------------------
 type loggingResponseWriter struct {
     http.ResponseWriter
-    statusCode int
+    statusCode  int
+    wroteHeader bool
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
     lrw.statusCode = code
+    lrw.wroteHeader = true
     lrw.ResponseWriter.WriteHeader(code)
 }
 
-//-------------------------------------------------------
-// Function: writeAuditEvent
-//-------------------------------------------------------
-// Purpose:
-//   - Append JSON audit events to daily evidence logs.
-// Audit:
-//   - File naming: /evidence/logs/requests_YYYY-MM-DD.log
-//   - Creates the log file if missing (license-permitted).
-//   - Never creates directories; /evidence/logs must pre-exist.
-//   - Each JSON record represents one auditable transaction.
-//   - Logs [ERROR] with UTC ISO 8601 timestamp on any failure.
-//-------------------------------------------------------
-func writeAuditEvent(event AuditEvent) {
-    logDir := "/evidence/logs"
-    logFile := filepath.Join(logDir, "requests_"+time.Now().UTC().Format("2006-01-02")+".log")
-
-    // Verify that /evidence/logs directory exists and is valid
-    if stat, err := os.Stat(logDir); err != nil || !stat.IsDir() {
-        log.Printf("[ERROR] %s audit path missing or invalid: %s (%v)",
-            time.Now().UTC().Format(time.RFC3339), logDir, err)
-        return
-    }
-
-    // Open or create the daily log file for appending
-    f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-    if err != nil {
-        log.Printf("[ERROR] %s audit open failed: %v",
-            time.Now().UTC().Format(time.RFC3339), err)
-        return
-    }
-    defer f.Close()
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+    lrw.wroteHeader = true
+    return lrw.ResponseWriter.Write(b)
+}
 
-    // Encode event as a single JSON line
-    enc := json.NewEncoder(f)
-    if err := enc.Encode(event); err != nil {
-        log.Printf("[ERROR] %s audit encode failed: %v",
-            time.Now().UTC().Format(time.RFC3339), err)
+// Flush passes through, so streamed responses (NDJSON listings)
+// reach the client as they are written.
+func (lrw *loggingResponseWriter) Flush() {
+    lrw.wroteHeader = true
+    if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
     }
 }
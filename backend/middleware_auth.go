@@ -0,0 +1,215 @@
+//-------------------------------------------------------
+// backend/middleware_auth.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Identify API callers from "Authorization: Bearer <token>" and
+//     attach the user to the request context (see auth package).
+// Audit:
+//   - An unknown token is always rejected (401, "auth.denied").
+//   - Browser sessions may present the token in the session cookie
+//     instead; their writes must echo the CSRF cookie in
+//     X-CSRF-Token (403 csrf_failed, "security.csrf"). Bearer
+//     requests are not subject to the CSRF check.
+//   - Failed tokens, admin keys and sync keys are throttled per
+//     client IP (auth/throttle.go): 429 with Retry-After while a
+//     delay or lockout is in force. An unknown token names no user,
+//     so it counts against the address only; failed second factors
+//     count against the user as well (handlers/totp.go).
+//   - Without a token the request proceeds anonymously unless
+//     auth_required is set; features that need an identity (signing,
+//     workflow, comments, preferences) answer 401 on their own.
+// Configuration:
+//   - users / auth_required (AUTH_REQUIRED) in the config file.
+//   - mfa.required_roles: roles that must sign in with TOTP.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/handlers"
+)
+
+// publicRoutes never require a user token (monitoring scrapers,
+// readiness probes, build identity, and the calendar feed, which
+// checks its own feed token).
+var publicRoutes = map[string]bool{
+    "/metrics":      true,
+    "/readyz":       true,
+    "/version":      true,
+    "/calendar.ics": true,
+}
+
+// mfaExemptRoutes are reachable without a second factor even for
+// roles that require one, so users can enroll and sign in.
+var mfaExemptRoutes = map[string]bool{
+    "/auth/totp":         true,
+    "/auth/totp/enroll":  true,
+    "/auth/totp/qr.svg":  true,
+    "/auth/totp/confirm": true,
+    "/auth/login":        true,
+    "/auth/logout":       true,
+}
+
+//-------------------------------------------------------
+// Function: UserMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Resolve the caller's bearer token to a configured user or a
+//     session opened at /auth/login.
+// Audit:
+//   - Users whose role requires MFA (mfa.required_roles) get 403
+//     mfa_required ("auth.mfa_required") unless the token is a
+//     session opened with a second factor or the route is exempt.
+//-------------------------------------------------------
+func UserMiddleware(pattern string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        cfg := config.Current()
+        token := ""
+        if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+            token = strings.TrimPrefix(header, "Bearer ")
+        }
+
+        if token == "" && !publicRoutes[pattern] {
+            if cookie, err := r.Cookie(handlers.SessionCookie); err == nil && cookie.Value != "" {
+                serveCookieSession(w, r, pattern, cookie.Value, next)
+                return
+            }
+        }
+
+        if token != "" {
+            if refuseThrottled(w, r, "ip") {
+                return
+            }
+            user, ok := auth.Authenticate(token)
+            if !ok {
+                user, ok = handlers.SessionUser(r, token)
+            }
+            if !ok {
+                recordAuthFailure(r, "ip", "auth.denied", "unknown user token")
+                w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+                apierror.Write(w, r, apierror.CodeUnauthorized, "", "Unauthorized")
+                return
+            }
+            auth.ThrottleReset(throttleKey("ip", r))
+            if !user.MFA && !mfaExemptRoutes[pattern] && !publicRoutes[pattern] && auth.MFARequired(cfg, user) {
+                auditAdmin(r, "auth.mfa_required", http.StatusForbidden, user.Name, "token without second factor")
+                apierror.Write(w, r, apierror.CodeMFARequired, "", "Two-factor authentication required: sign in at /auth/login")
+                return
+            }
+            next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+            return
+        }
+
+        if cfg.AuthRequired && !publicRoutes[pattern] {
+            auditAdmin(r, "auth.denied", http.StatusUnauthorized, "", "missing user token")
+            w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+            apierror.Write(w, r, apierror.CodeUnauthorized, "", "Unauthorized")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+//-------------------------------------------------------
+// Function: serveCookieSession
+//-------------------------------------------------------
+// Purpose:
+//   - Resolve a session cookie and serve the request as its user,
+//     checking the CSRF token on anything but GET, HEAD and OPTIONS.
+// Audit:
+//   - A stale or unknown cookie is cleared and answered 401
+//     ("auth.denied"); it is not counted as a failed credential,
+//     since browsers resend it on their own.
+//   - A missing or wrong CSRF token writes "security.csrf" (403).
+//-------------------------------------------------------
+func serveCookieSession(w http.ResponseWriter, r *http.Request, pattern string, token string, next http.Handler) {
+    user, ok := handlers.SessionUser(r, token)
+    if !ok {
+        auditAdmin(r, "auth.denied", http.StatusUnauthorized, "", "unknown or expired session cookie")
+        handlers.ClearSessionCookies(w, r)
+        apierror.Write(w, r, apierror.CodeUnauthorized, "", "Session expired; sign in again")
+        return
+    }
+    switch r.Method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions:
+    default:
+        if !handlers.SessionCSRFValid(r.Context(), user.SessionID, r.Header.Get(handlers.CSRFHeader)) {
+            auditAdmin(r, "security.csrf", http.StatusForbidden, user.Name, "missing or invalid "+handlers.CSRFHeader)
+            apierror.Write(w, r, apierror.CodeCSRFFailed, "", "Missing or invalid CSRF token")
+            return
+        }
+    }
+    if !user.MFA && !mfaExemptRoutes[pattern] && !publicRoutes[pattern] && auth.MFARequired(config.Current(), user) {
+        auditAdmin(r, "auth.mfa_required", http.StatusForbidden, user.Name, "session without second factor")
+        apierror.Write(w, r, apierror.CodeMFARequired, "", "Two-factor authentication required: sign in at /auth/login")
+        return
+    }
+    next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+}
+
+// throttleKey is the throttle key of the requesting client (as
+// resolved from trusted proxies by IPAccessMiddleware) for one
+// kind of credential: "ip:<address>" for user tokens, "admin:<address>"
+// and "sync:<address>" for the keys, so a throttled client does not
+// lock an admin on the same address out of /admin. Failures that
+// name a user also count against auth.UserThrottleKey, which the
+// second factor check shares with this "ip" key.
+func throttleKey(scope string, r *http.Request) string {
+    return scope + ":" + clientIP(r.RemoteAddr)
+}
+
+//-------------------------------------------------------
+// Function: refuseThrottled
+//-------------------------------------------------------
+// Purpose:
+//   - Answer 429 (rate_limited) with Retry-After when the client
+//     must wait before presenting another credential.
+// Audit:
+//   - Writes "auth.throttled"; the credential is not checked.
+//-------------------------------------------------------
+func refuseThrottled(w http.ResponseWriter, r *http.Request, scope string) bool {
+    key := throttleKey(scope, r)
+    wait, locked := auth.ThrottleWait(key, audit.Clock().Now())
+    if wait <= 0 {
+        return false
+    }
+    seconds := int((wait + time.Second - 1) / time.Second)
+    detail := fmt.Sprintf("delayed %ds", seconds)
+    if locked {
+        detail = fmt.Sprintf("locked out %ds", seconds)
+    }
+    auditAdmin(r, "auth.throttled", http.StatusTooManyRequests, key, detail)
+    w.Header().Set("Retry-After", strconv.Itoa(seconds))
+    apierror.Write(w, r, apierror.CodeRateLimited, "", "Too many failed attempts; retry later")
+    return true
+}
+
+//-------------------------------------------------------
+// Function: recordAuthFailure
+//-------------------------------------------------------
+// Purpose:
+//   - Count a rejected credential against the client's scope key
+//     and audit it as event, with the failure count in the detail.
+// Audit:
+//   - The failure that starts a lockout also writes "auth.lockout".
+//-------------------------------------------------------
+func recordAuthFailure(r *http.Request, scope string, event string, detail string) {
+    key := throttleKey(scope, r)
+    failures, lockedUntil := auth.ThrottleFail(key, audit.Clock().Now())
+    auditAdmin(r, event, http.StatusUnauthorized, "", fmt.Sprintf("%s (failure %d)", detail, failures))
+    if !lockedUntil.IsZero() {
+        until := lockedUntil.UTC().Format(time.RFC3339)
+        auditAdmin(r, "auth.lockout", http.StatusUnauthorized, key, fmt.Sprintf("%d failures; locked until %s", failures, until))
+        logWarn(fmt.Sprintf("Authentication locked out for %s until %s", key, until))
+    }
+}
@@ -0,0 +1,347 @@
+//-------------------------------------------------------
+// backend/middleware_idempotency.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Idempotency keys for mutating requests: a client sends
+//     "Idempotency-Key: <unique value>" with a save, move, delete or
+//     batch request, and a retry with the same key (flaky Wi-Fi, a
+//     proxy retry) gets the first outcome back instead of applying
+//     the change twice.
+// Audit:
+//   - Keys are scoped to the calling user (or, without a token, the
+//     client address), so users never see each other's outcomes.
+//   - A key is bound to the request it first came with (method,
+//     path, query, SHA-256 of the body); reusing it for a different
+//     request answers 422 idempotency_key_reused.
+//   - A retry while the first request is still running answers 409
+//     conflict; the client retries again later.
+//   - Outcomes below 500 are kept and replayed with the header
+//     "Idempotent-Replayed: true"; 5xx outcomes are not kept, so the
+//     request can be retried for real. Each replay writes
+//     "request.idempotent_replay".
+//   - Keys live in memory for idempotency.window, measured on the
+//     injected clock; a restart forgets them.
+//   - The body is buffered to fingerprint it, so it is capped at the
+//     largest body an idempotent route accepts (raw.max_bytes for
+//     raw uploads, 16 MiB otherwise); a larger body answers 413
+//     payload_too_large before the handler runs.
+// Configuration:
+//   - idempotency.window / IDEMPOTENCY_WINDOW       default 24h, 0 = off
+//   - idempotency.max_keys / IDEMPOTENCY_MAX_KEYS   default 10000
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/auth"
+    "cfo-scratchpad/config"
+)
+
+const (
+    idempotencyHeader       = "Idempotency-Key"
+    idempotencyReplayHeader = "Idempotent-Replayed"
+    maxIdempotencyKeyLen    = 255
+    // maxIdempotentResponse bounds a kept response body; larger
+    // outcomes are not kept and a retry runs again.
+    maxIdempotentResponse = 1 << 20
+    // maxIdempotentRequest bounds the buffered body of the JSON
+    // routes; raw uploads to /file may use up to raw.max_bytes.
+    maxIdempotentRequest = 16 << 20
+)
+
+// idempotentRoutes are the routes whose non-GET requests honor
+// Idempotency-Key.
+var idempotentRoutes = map[string]bool{
+    "/file":               true,
+    "/file/save":          true,
+    "/file/move":          true,
+    "/folders":            true,
+    "/files/rename-batch": true,
+    "/files/replace":      true,
+    "/trash":              true,
+    "/trash/restore":      true,
+}
+
+// idempotentReplayHeaders are the response headers kept with an
+// outcome; X-Request-ID and cookies always come from the retry.
+var idempotentReplayHeaders = []string{"Content-Type", "Content-Disposition", "Location", "X-Content-SHA256"}
+
+//-------------------------------------------------------
+// Struct: idempotencyRecord
+//-------------------------------------------------------
+// Purpose:
+//   - One key: the request it belongs to and, once done, its
+//     outcome.
+//-------------------------------------------------------
+type idempotencyRecord struct {
+    fingerprint string
+    created     time.Time
+    done        bool
+    status      int
+    header      http.Header
+    body        []byte
+}
+
+//-------------------------------------------------------
+// Struct: idempotencyStore
+//-------------------------------------------------------
+// Purpose:
+//   - Keys by scope and value, expiring after the window.
+//-------------------------------------------------------
+type idempotencyStore struct {
+    mu      sync.Mutex
+    records map[string]*idempotencyRecord
+}
+
+var idempotencyKeys = &idempotencyStore{records: map[string]*idempotencyRecord{}}
+
+//-------------------------------------------------------
+// Function: (*idempotencyStore) begin
+//-------------------------------------------------------
+// Purpose:
+//   - Claim key for a new request, or return the existing record.
+// Audit:
+//   - Expired keys are dropped first; at maxKeys the oldest key is
+//     forgotten to make room.
+//-------------------------------------------------------
+func (s *idempotencyStore) begin(key string, fingerprint string, now time.Time, window time.Duration, maxKeys int) (*idempotencyRecord, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    oldestKey := ""
+    var oldest time.Time
+    for k, record := range s.records {
+        if now.Sub(record.created) >= window {
+            delete(s.records, k)
+            continue
+        }
+        if record.done && (oldestKey == "" || record.created.Before(oldest)) {
+            oldestKey, oldest = k, record.created
+        }
+    }
+    if existing, ok := s.records[key]; ok {
+        return existing, false
+    }
+    if len(s.records) >= maxKeys && oldestKey != "" {
+        delete(s.records, oldestKey)
+    }
+    record := &idempotencyRecord{fingerprint: fingerprint, created: now}
+    s.records[key] = record
+    return record, true
+}
+
+//-------------------------------------------------------
+// Function: (*idempotencyStore) finish
+//-------------------------------------------------------
+// Purpose:
+//   - Keep the outcome of a claimed key, or release the key when
+//     the outcome must not be replayed.
+//-------------------------------------------------------
+func (s *idempotencyStore) finish(key string, record *idempotencyRecord, keep bool, status int, header http.Header, body []byte) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if !keep {
+        if s.records[key] == record {
+            delete(s.records, key)
+        }
+        return
+    }
+    record.done = true
+    record.status = status
+    record.header = header
+    record.body = body
+}
+
+//-------------------------------------------------------
+// Struct: idempotencyRecorder
+//-------------------------------------------------------
+// Purpose:
+//   - Pass the response through while keeping a copy of its status
+//     and (bounded) body.
+//-------------------------------------------------------
+type idempotencyRecorder struct {
+    http.ResponseWriter
+    status   int
+    body     bytes.Buffer
+    overflow bool
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+    if rec.status == 0 {
+        rec.status = code
+    }
+    rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+    if rec.status == 0 {
+        rec.status = http.StatusOK
+    }
+    if !rec.overflow {
+        if rec.body.Len()+len(b) > maxIdempotentResponse {
+            rec.overflow = true
+            rec.body.Reset()
+        } else {
+            rec.body.Write(b)
+        }
+    }
+    return rec.ResponseWriter.Write(b)
+}
+
+//-------------------------------------------------------
+// Function: idempotencyScope
+//-------------------------------------------------------
+// Purpose:
+//   - Whose keys a request uses: the user, else the client address.
+//-------------------------------------------------------
+func idempotencyScope(r *http.Request) string {
+    if user, ok := auth.FromContext(r.Context()); ok && user.Name != "" {
+        return "user:" + user.Name
+    }
+    return "ip:" + clientIP(r.RemoteAddr)
+}
+
+//-------------------------------------------------------
+// Function: IdempotencyMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Honor Idempotency-Key on the non-GET requests of
+//     idempotentRoutes.
+// Audit:
+//   - Must run inside UserMiddleware, so keys are scoped to the
+//     authenticated user.
+//   - Requests without the header are not affected.
+//-------------------------------------------------------
+func IdempotencyMiddleware(pattern string, next http.Handler) http.Handler {
+    if !idempotentRoutes[pattern] {
+        return next
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        value := r.Header.Get(idempotencyHeader)
+        settings := config.Current().Idempotency
+        if value == "" || settings.Window == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+            next.ServeHTTP(w, r)
+            return
+        }
+        if len(value) > maxIdempotencyKeyLen || !printableASCII(value) {
+            apierror.Write(w, r, apierror.CodeInvalidField, idempotencyHeader, "Idempotency-Key must be 1-255 printable ASCII characters")
+            return
+        }
+
+        limit := max(maxIdempotentRequest, config.Current().Raw.MaxBytes)
+        body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+        if err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                apierror.Write(w, r, apierror.CodePayloadTooLarge, "", fmt.Sprintf("Request body exceeds %d bytes", limit))
+                return
+            }
+            logError("Failed to read request body for idempotency: " + err.Error())
+            apierror.Write(w, r, apierror.CodeInvalidField, "", "Bad request: could not read body")
+            return
+        }
+        r.Body = ioutil.NopCloser(bytes.NewReader(body))
+        sum := sha256.Sum256(body)
+        fingerprint := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + " " + hex.EncodeToString(sum[:])
+
+        key := idempotencyScope(r) + "\n" + value
+        record, claimed := idempotencyKeys.begin(key, fingerprint, audit.Clock().Now(), settings.Window.Std(), settings.MaxKeys)
+        if !claimed {
+            replayIdempotent(w, r, value, fingerprint, record)
+            return
+        }
+
+        rec := &idempotencyRecorder{ResponseWriter: w}
+        kept := false
+        defer func() {
+            if !kept {
+                idempotencyKeys.finish(key, record, false, 0, nil, nil)
+            }
+        }()
+        next.ServeHTTP(rec, r)
+
+        status := rec.status
+        if status == 0 {
+            status = http.StatusOK
+        }
+        if status >= 500 || rec.overflow {
+            return
+        }
+        header := http.Header{}
+        for _, name := range idempotentReplayHeaders {
+            if v := w.Header().Get(name); v != "" {
+                header.Set(name, v)
+            }
+        }
+        idempotencyKeys.finish(key, record, true, status, header, append([]byte(nil), rec.body.Bytes()...))
+        kept = true
+    })
+}
+
+//-------------------------------------------------------
+// Function: replayIdempotent
+//-------------------------------------------------------
+// Purpose:
+//   - Answer a retry from the kept outcome of its key.
+//-------------------------------------------------------
+func replayIdempotent(w http.ResponseWriter, r *http.Request, value string, fingerprint string, record *idempotencyRecord) {
+    idempotencyKeys.mu.Lock()
+    done, matches := record.done, record.fingerprint == fingerprint
+    status, header, body := record.status, record.header, record.body
+    idempotencyKeys.mu.Unlock()
+
+    if !matches {
+        apierror.Write(w, r, apierror.CodeIdempotencyKeyReused, idempotencyHeader, "Idempotency-Key was already used for a different request")
+        return
+    }
+    if !done {
+        apierror.Write(w, r, apierror.CodeConflict, idempotencyHeader, "A request with this Idempotency-Key is still in progress; retry later")
+        return
+    }
+
+    for name, values := range header {
+        w.Header()[name] = values
+    }
+    w.Header().Set(idempotencyReplayHeader, "true")
+    w.WriteHeader(status)
+    w.Write(body)
+
+    actor := ""
+    if user, ok := auth.FromContext(r.Context()); ok {
+        actor = user.Name
+    }
+    audit.WriteContext(r.Context(), audit.Event{
+        Event:    "request.idempotent_replay",
+        Method:   r.Method,
+        Path:     r.URL.Path,
+        RemoteIP: r.RemoteAddr,
+        Status:   status,
+        Actor:    actor,
+        Target:   value,
+        Detail:   "status=" + strconv.Itoa(status),
+    })
+}
+
+// printableASCII reports whether s is printable ASCII (no spaces
+// at either end, no control characters).
+func printableASCII(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] < 0x20 || s[i] > 0x7e {
+            return false
+        }
+    }
+    return s != "" && s[0] != ' ' && s[len(s)-1] != ' '
+}
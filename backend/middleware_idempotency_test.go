@@ -0,0 +1,115 @@
+//-------------------------------------------------------
+// backend/middleware_idempotency_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for IdempotencyMiddleware: replay, key reuse, the
+//     window on the injected clock and the request body cap.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/clock"
+)
+
+// idempotencyTestHandler wraps a counting handler for /file/save
+// on a fresh key store and a fixed clock.
+func idempotencyTestHandler(t *testing.T) (http.Handler, *int, *clock.Fixed) {
+    t.Helper()
+    idempotencyKeys = &idempotencyStore{records: map[string]*idempotencyRecord{}}
+    clk := clock.NewFixed(time.Now().UTC())
+    audit.SetClock(clk)
+    t.Cleanup(func() { audit.SetClock(clock.System{}) })
+
+    calls := 0
+    next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        w.Write([]byte(`{"saved":true}`))
+    })
+    return IdempotencyMiddleware("/file/save", next), &calls, clk
+}
+
+func idempotentRequest(h http.Handler, key string, body []byte) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPost, "/file/save", bytes.NewReader(body))
+    req.RemoteAddr = "192.0.2.10:50000"
+    req.Header.Set(idempotencyHeader, key)
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    return rec
+}
+
+func TestIdempotencyReplaysFirstOutcome(t *testing.T) {
+    h, calls, _ := idempotencyTestHandler(t)
+    body := []byte(`{"path":"a.txt","content":"x"}`)
+
+    first := idempotentRequest(h, "key-1", body)
+    second := idempotentRequest(h, "key-1", body)
+
+    if *calls != 1 {
+        t.Fatalf("handler ran %d times, want 1", *calls)
+    }
+    if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+        t.Fatalf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+    }
+    if second.Header().Get(idempotencyReplayHeader) != "true" {
+        t.Fatalf("replay is missing %s", idempotencyReplayHeader)
+    }
+}
+
+func TestIdempotencyKeyReusedForDifferentBody(t *testing.T) {
+    h, calls, _ := idempotencyTestHandler(t)
+
+    idempotentRequest(h, "key-1", []byte(`{"path":"a.txt"}`))
+    rec := idempotentRequest(h, "key-1", []byte(`{"path":"b.txt"}`))
+
+    if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "idempotency_key_reused") {
+        t.Fatalf("reused key = %d %s, want 422 idempotency_key_reused", rec.Code, rec.Body.String())
+    }
+    if *calls != 1 {
+        t.Fatalf("handler ran %d times, want 1", *calls)
+    }
+}
+
+func TestIdempotencyWindowFollowsInjectedClock(t *testing.T) {
+    h, calls, clk := idempotencyTestHandler(t)
+    body := []byte(`{"path":"a.txt"}`)
+
+    idempotentRequest(h, "key-1", body)
+    clk.Advance(23 * time.Hour)
+    idempotentRequest(h, "key-1", body)
+    if *calls != 1 {
+        t.Fatalf("handler ran %d times inside the window, want 1", *calls)
+    }
+
+    clk.Advance(2 * time.Hour)
+    rec := idempotentRequest(h, "key-1", body)
+    if *calls != 2 || rec.Header().Get(idempotencyReplayHeader) != "" {
+        t.Fatalf("after the window: handler ran %d times, replayed=%q; want a fresh run", *calls, rec.Header().Get(idempotencyReplayHeader))
+    }
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+    h, calls, _ := idempotencyTestHandler(t)
+
+    rec := idempotentRequest(h, "key-1", make([]byte, maxIdempotentRequest+1))
+
+    if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "payload_too_large") {
+        t.Fatalf("oversized body = %d %s, want 413 payload_too_large", rec.Code, rec.Body.String())
+    }
+    if *calls != 0 {
+        t.Fatalf("handler ran %d times, want 0", *calls)
+    }
+    if len(idempotencyKeys.records) != 0 {
+        t.Fatalf("oversized request claimed a key")
+    }
+}
@@ -0,0 +1,245 @@
+//-------------------------------------------------------
+// backend/middleware_ipaccess.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Admit or refuse each request by client address, using the
+//     ip_access allow and deny lists (CIDR ranges), before any
+//     handler, authentication or audit middleware runs.
+// Audit:
+//   - Refused requests answer 403 (code "ip_denied") and write a
+//     "security.ip_denied" event with the client address and the
+//     rule that refused it.
+//   - The client is the TCP peer, unless the peer is a trusted
+//     proxy: then X-Forwarded-For is read right to left, skipping
+//     trusted proxies, and the first other address is the client.
+//     A malformed header from a trusted proxy is refused.
+//   - Admitted requests reach the handlers with RemoteAddr set to
+//     that client, so per-client throttles, records and audit
+//     events never collapse onto the proxy's address.
+//   - Lists are re-read from the active configuration, so a reload
+//     takes effect on the next request.
+// Configuration:
+//   - ip_access.allow / IP_ALLOW, ip_access.deny / IP_DENY,
+//     ip_access.trusted_proxies / TRUSTED_PROXIES (comma-separated).
+//-------------------------------------------------------
+
+package main
+
+import (
+    "errors"
+    "net/http"
+    "net/netip"
+    "strings"
+    "sync"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/config"
+)
+
+//-------------------------------------------------------
+// Struct: ipAccessRules
+//-------------------------------------------------------
+// Purpose:
+//   - The parsed ip_access lists of one configuration.
+//-------------------------------------------------------
+type ipAccessRules struct {
+    allow   []netip.Prefix
+    deny    []netip.Prefix
+    proxies []netip.Prefix
+}
+
+// ipRulesCache keeps the rules parsed for the active configuration.
+var ipRulesCache struct {
+    mu    sync.Mutex
+    cfg   *config.Config
+    rules *ipAccessRules
+}
+
+// errForwardedFor reports an X-Forwarded-For header that cannot be
+// trusted to name the client.
+var errForwardedFor = errors.New("malformed X-Forwarded-For")
+
+//-------------------------------------------------------
+// Function: currentIPRules
+//-------------------------------------------------------
+// Purpose:
+//   - Rules for cfg, parsed once per configuration.
+// Audit:
+//   - Entries were validated with the configuration, so parse
+//     errors cannot occur here; a bad entry would be skipped.
+//-------------------------------------------------------
+func currentIPRules(cfg *config.Config) *ipAccessRules {
+    ipRulesCache.mu.Lock()
+    defer ipRulesCache.mu.Unlock()
+    if ipRulesCache.cfg == cfg {
+        return ipRulesCache.rules
+    }
+    parse := func(entries []string) []netip.Prefix {
+        prefixes := make([]netip.Prefix, 0, len(entries))
+        for _, entry := range entries {
+            if prefix, err := config.ParseAddressRange(entry); err == nil {
+                prefixes = append(prefixes, prefix)
+            }
+        }
+        return prefixes
+    }
+    rules := &ipAccessRules{
+        allow:   parse(cfg.IPAccess.Allow),
+        deny:    parse(cfg.IPAccess.Deny),
+        proxies: parse(cfg.IPAccess.TrustedProxies),
+    }
+    ipRulesCache.cfg, ipRulesCache.rules = cfg, rules
+    return rules
+}
+
+// matchRange returns the first prefix containing addr.
+func matchRange(prefixes []netip.Prefix, addr netip.Addr) (netip.Prefix, bool) {
+    for _, prefix := range prefixes {
+        if prefix.Contains(addr) {
+            return prefix, true
+        }
+    }
+    return netip.Prefix{}, false
+}
+
+//-------------------------------------------------------
+// Function: clientAddress
+//-------------------------------------------------------
+// Purpose:
+//   - The address access is decided on: the peer, or the client
+//     named by a trusted proxy's X-Forwarded-For.
+//-------------------------------------------------------
+func clientAddress(r *http.Request, proxies []netip.Prefix) (netip.Addr, error) {
+    peer, err := netip.ParseAddrPort(r.RemoteAddr)
+    if err != nil {
+        return netip.Addr{}, err
+    }
+    client := peer.Addr().Unmap()
+    if _, trusted := matchRange(proxies, client); !trusted {
+        return client, nil
+    }
+    hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(hops) - 1; i >= 0; i-- {
+        hop := strings.TrimSpace(hops[i])
+        if hop == "" && len(hops) == 1 {
+            break
+        }
+        addr, err := netip.ParseAddr(hop)
+        if err != nil {
+            return netip.Addr{}, errForwardedFor
+        }
+        client = addr.Unmap()
+        if _, trusted := matchRange(proxies, client); !trusted {
+            break
+        }
+    }
+    return client, nil
+}
+
+//-------------------------------------------------------
+// Function: checkIPAccess
+//-------------------------------------------------------
+// Purpose:
+//   - The client address of r and the reason it is refused, or ""
+//     when it is admitted.
+//-------------------------------------------------------
+func checkIPAccess(r *http.Request, rules *ipAccessRules) (string, string) {
+    client, err := clientAddress(r, rules.proxies)
+    if err != nil {
+        return r.RemoteAddr, err.Error()
+    }
+    if prefix, denied := matchRange(rules.deny, client); denied {
+        return client.String(), "deny " + prefix.String()
+    }
+    if len(rules.allow) > 0 {
+        if _, allowed := matchRange(rules.allow, client); !allowed {
+            return client.String(), "not in allow list"
+        }
+    }
+    return client.String(), ""
+}
+
+//-------------------------------------------------------
+// Function: withClientAddress
+//-------------------------------------------------------
+// Purpose:
+//   - r as seen after this middleware: when a trusted proxy named
+//     the client, a copy whose RemoteAddr is the client (with the
+//     peer's port); otherwise r itself.
+// Audit:
+//   - Everything downstream keys on RemoteAddr (throttles, session
+//     and second factor records, idempotency keys, audit remote_ip
+//     and the anomaly detector), so they all see the client instead
+//     of the proxy. A malformed header leaves the peer in place.
+//-------------------------------------------------------
+func withClientAddress(r *http.Request, proxies []netip.Prefix) *http.Request {
+    peer, err := netip.ParseAddrPort(r.RemoteAddr)
+    if err != nil {
+        return r
+    }
+    client, err := clientAddress(r, proxies)
+    if err != nil || client == peer.Addr().Unmap() {
+        return r
+    }
+    forwarded := *r
+    forwarded.RemoteAddr = netip.AddrPortFrom(client, peer.Port()).String()
+    return &forwarded
+}
+
+// isLoopbackReadyz reports whether r is a GET /readyz from a local
+// prober: the TCP peer is a loopback address and is not a trusted
+// proxy relaying a client (X-Forwarded-For), so a reverse proxy on
+// the same host cannot carry denied clients past the lists.
+func isLoopbackReadyz(r *http.Request, proxies []netip.Prefix) bool {
+    if r.Method != http.MethodGet || r.URL.Path != "/readyz" {
+        return false
+    }
+    peer, err := netip.ParseAddrPort(r.RemoteAddr)
+    if err != nil || !peer.Addr().Unmap().IsLoopback() {
+        return false
+    }
+    _, proxied := matchRange(proxies, peer.Addr().Unmap())
+    return !proxied || len(r.Header.Values("X-Forwarded-For")) == 0
+}
+
+//-------------------------------------------------------
+// Function: IPAccessMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Refuse requests from addresses outside ip_access, and pass
+//     the rest on with the client address resolved
+//     (withClientAddress).
+// Audit:
+//   - With both lists empty every request passes.
+//   - GET /readyz from a loopback peer always passes: it is the
+//     systemd watchdog's probe (systemd.go), and refusing it would
+//     restart a healthy server. A loopback trusted proxy forwarding
+//     a client does not count; that client is checked as usual.
+//-------------------------------------------------------
+func IPAccessMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        cfg := config.Current()
+        rules := currentIPRules(cfg)
+        if len(cfg.IPAccess.Allow) == 0 && len(cfg.IPAccess.Deny) == 0 || isLoopbackReadyz(r, rules.proxies) {
+            next.ServeHTTP(w, withClientAddress(r, rules.proxies))
+            return
+        }
+        client, reason := checkIPAccess(r, rules)
+        if reason == "" {
+            next.ServeHTTP(w, withClientAddress(r, rules.proxies))
+            return
+        }
+        audit.WriteContext(r.Context(), audit.Event{
+            Event:     "security.ip_denied",
+            Method:    r.Method,
+            Path:      r.URL.Path,
+            RemoteIP:  r.RemoteAddr,
+            Status:    http.StatusForbidden,
+            Target:    client,
+            Detail:    reason,
+            RequestID: apierror.RequestID(r.Context()),
+        })
+        apierror.Write(w, r, apierror.CodeIPDenied, "", "Access from this address is not permitted")
+    })
+}
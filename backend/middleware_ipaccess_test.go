@@ -0,0 +1,154 @@
+//-------------------------------------------------------
+// backend/middleware_ipaccess_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for ip_access: client address resolution through
+//     trusted proxies (X-Forwarded-For), the address handed on to
+//     the handlers, and the allow/deny rules.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "net/http/httptest"
+    "testing"
+
+    "cfo-scratchpad/config"
+)
+
+// ipTestRules parses allow, deny and trusted proxy lists.
+func ipTestRules(allow, deny, proxies []string) *ipAccessRules {
+    cfg := config.Defaults()
+    cfg.IPAccess.Allow = allow
+    cfg.IPAccess.Deny = deny
+    cfg.IPAccess.TrustedProxies = proxies
+    return currentIPRules(cfg)
+}
+
+func TestClientAddress(t *testing.T) {
+    rules := ipTestRules(nil, nil, []string{"10.0.0.0/8", "::1"})
+    for _, tc := range []struct {
+        name, peer string
+        forwarded  []string
+        want       string
+        malformed  bool
+    }{
+        {"untrusted peer ignores header", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5", false},
+        {"trusted peer without header", "10.0.0.2:4000", nil, "10.0.0.2", false},
+        {"trusted peer names client", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1", false},
+        {"rightmost untrusted hop wins", "10.0.0.2:4000", []string{"192.0.2.66, 198.51.100.1, 10.0.0.3"}, "198.51.100.1", false},
+        {"spoofed left entries ignored", "10.0.0.2:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1", false},
+        {"all hops trusted", "10.0.0.2:4000", []string{"10.1.1.1, 10.0.0.3"}, "10.1.1.1", false},
+        {"ipv6 trusted peer", "[::1]:4000", []string{"2001:db8::7"}, "2001:db8::7", false},
+        {"mapped ipv4 hop", "10.0.0.2:4000", []string{"::ffff:198.51.100.1"}, "198.51.100.1", false},
+        {"garbage from trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1, not-an-ip"}, "", true},
+        {"empty element from trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1,,"}, "", true},
+    } {
+        r := httptest.NewRequest("GET", "/files", nil)
+        r.RemoteAddr = tc.peer
+        for _, value := range tc.forwarded {
+            r.Header.Add("X-Forwarded-For", value)
+        }
+        got, err := clientAddress(r, rules.proxies)
+        if tc.malformed {
+            if err != errForwardedFor {
+                t.Errorf("%s: clientAddress = %v, %v; want errForwardedFor", tc.name, got, err)
+            }
+            continue
+        }
+        if err != nil || got.String() != tc.want {
+            t.Errorf("%s: clientAddress = %v, %v; want %s", tc.name, got, err, tc.want)
+        }
+    }
+}
+
+func TestCheckIPAccess(t *testing.T) {
+    rules := ipTestRules([]string{"192.168.10.0/24", "2001:db8::/32"}, []string{"192.168.10.66"}, []string{"10.0.0.1"})
+    for _, tc := range []struct {
+        peer, forwarded string
+        refused         bool
+    }{
+        {"192.168.10.5:1000", "", false},
+        {"192.168.10.66:1000", "", true},
+        {"192.168.11.5:1000", "", true},
+        {"[2001:db8::1]:1000", "", false},
+        {"[::ffff:192.168.10.5]:1000", "", false},
+        {"10.0.0.1:1000", "192.168.10.5", false},
+        {"10.0.0.1:1000", "192.168.10.66", true},
+        {"10.0.0.1:1000", "", true},
+        {"192.168.11.5:1000", "192.168.10.5", true},
+    } {
+        r := httptest.NewRequest("GET", "/files", nil)
+        r.RemoteAddr = tc.peer
+        if tc.forwarded != "" {
+            r.Header.Set("X-Forwarded-For", tc.forwarded)
+        }
+        client, reason := checkIPAccess(r, rules)
+        if (reason != "") != tc.refused {
+            t.Errorf("peer %s forwarded %q: client %s reason %q, refused want %t", tc.peer, tc.forwarded, client, reason, tc.refused)
+        }
+    }
+}
+
+func TestWithClientAddress(t *testing.T) {
+    rules := ipTestRules(nil, nil, []string{"10.0.0.0/8"})
+    for _, tc := range []struct {
+        name, peer, forwarded string
+        want                  string
+    }{
+        {"trusted proxy names client", "10.0.0.2:4000", "198.51.100.1", "198.51.100.1:4000"},
+        {"untrusted peer keeps its address", "203.0.113.5:4000", "198.51.100.1", "203.0.113.5:4000"},
+        {"trusted proxy without header", "10.0.0.2:4000", "", "10.0.0.2:4000"},
+        {"malformed header keeps the peer", "10.0.0.2:4000", "not-an-ip", "10.0.0.2:4000"},
+    } {
+        r := httptest.NewRequest("POST", "/file/save", nil)
+        r.RemoteAddr = tc.peer
+        if tc.forwarded != "" {
+            r.Header.Set("X-Forwarded-For", tc.forwarded)
+        }
+        got := withClientAddress(r, rules.proxies)
+        if got.RemoteAddr != tc.want {
+            t.Errorf("%s: RemoteAddr = %s, want %s", tc.name, got.RemoteAddr, tc.want)
+        }
+        if r.RemoteAddr != tc.peer {
+            t.Errorf("%s: original request changed to %s", tc.name, r.RemoteAddr)
+        }
+    }
+
+    // Two clients behind one proxy get separate throttles.
+    keys := map[string]bool{}
+    for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+        r := httptest.NewRequest("GET", "/files", nil)
+        r.RemoteAddr = "10.0.0.2:4000"
+        r.Header.Set("X-Forwarded-For", client)
+        keys[throttleKey("ip", withClientAddress(r, rules.proxies))] = true
+    }
+    if !keys["ip:198.51.100.1"] || !keys["ip:198.51.100.2"] {
+        t.Errorf("throttle keys behind a trusted proxy = %v", keys)
+    }
+}
+
+func TestLoopbackReadyzBypass(t *testing.T) {
+    rules := ipTestRules(nil, nil, []string{"127.0.0.1"})
+    for _, tc := range []struct {
+        method, path, peer, forwarded string
+        want                          bool
+    }{
+        {"GET", "/readyz", "127.0.0.1:5000", "", true},
+        {"GET", "/readyz", "[::1]:5000", "", true},
+        {"GET", "/readyz", "192.0.2.1:5000", "", false},
+        {"POST", "/readyz", "127.0.0.1:5000", "", false},
+        {"GET", "/files", "127.0.0.1:5000", "", false},
+        {"GET", "/readyz", "127.0.0.1:5000", "203.0.113.9", false},
+        {"GET", "/readyz", "[::1]:5000", "203.0.113.9", true},
+    } {
+        r := httptest.NewRequest(tc.method, tc.path, nil)
+        r.RemoteAddr = tc.peer
+        if tc.forwarded != "" {
+            r.Header.Set("X-Forwarded-For", tc.forwarded)
+        }
+        if got := isLoopbackReadyz(r, rules.proxies); got != tc.want {
+            t.Errorf("%s %s from %s (forwarded %q): isLoopbackReadyz = %t, want %t", tc.method, tc.path, tc.peer, tc.forwarded, got, tc.want)
+        }
+    }
+}
@@ -0,0 +1,85 @@
+//-------------------------------------------------------
+// backend/middleware_recover.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Recover from panics raised by any handler or inner middleware.
+//   - Return HTTP 500 instead of dropping the client connection.
+// Audit:
+//   - Logs the stack trace with a correlation ID (the request ID,
+//     see middleware_requestid.go) and UTC timestamp.
+//   - Writes an audit.Event flagged "panic": true with the same ID,
+//     so every crash appears in /evidence/logs/ alongside requests.
+//   - The correlation ID is returned in X-Correlation-ID so a user
+//     report can be matched to the evidence record.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "runtime/debug"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/clock"
+)
+
+//-------------------------------------------------------
+// Function: RecoverMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Wrap the handler chain and convert panics into 500 responses.
+// Audit:
+//   - Must be the outermost wrapper: a panic unwinds past
+//     AuditMiddleware, so this records the request's audit event.
+//   - http.ErrAbortHandler is re-raised; it is net/http's
+//     deliberate abort signal, not a crash.
+//   - Timestamp and duration are read from clk.
+//-------------------------------------------------------
+func RecoverMiddleware(clk clock.Clock, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := clk.Now().UTC()
+        lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
+
+        defer func() {
+            rec := recover()
+            if rec == nil {
+                return
+            }
+            if rec == http.ErrAbortHandler {
+                panic(rec)
+            }
+
+            id := apierror.RequestID(r.Context())
+            if id == "" {
+                id = apierror.NewRequestID()
+            }
+            logError(fmt.Sprintf("panic recovered [correlation_id=%s] %s %s: %v\n%s",
+                id, r.Method, r.URL.Path, rec, debug.Stack()))
+
+            // Only send a 500 if the handler had not started its response.
+            if !lrw.wroteHeader {
+                w.Header().Set("X-Correlation-ID", id)
+                apierror.Write(w, r, apierror.CodeInternal, "", "Internal server error (correlation id: "+id+")")
+            }
+
+            event := audit.Event{
+                Timestamp:     start.Format(time.RFC3339),
+                Method:        r.Method,
+                Path:          r.URL.Path,
+                RemoteIP:      r.RemoteAddr,
+                Status:        http.StatusInternalServerError,
+                Duration:      clk.Now().Sub(start).Milliseconds(),
+                Panic:         true,
+                CorrelationID: id,
+                RequestID:     id,
+            }
+            audit.WriteContext(r.Context(), event)
+            latencyTracker.record(event)
+        }()
+
+        next.ServeHTTP(lrw, r)
+    })
+}
@@ -0,0 +1,57 @@
+//-------------------------------------------------------
+// backend/middleware_requestid.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Give every request an ID, returned in X-Request-ID, placed
+//     in error bodies (request_id), and recorded on its audit event.
+// Audit:
+//   - An incoming X-Request-ID from a proxy is kept when it is 1-64
+//     characters of [A-Za-z0-9._-]; anything else is replaced, so
+//     the value is always safe to log.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "net/http"
+
+    "cfo-scratchpad/apierror"
+)
+
+// maxRequestIDLen bounds an accepted incoming X-Request-ID.
+const maxRequestIDLen = 64
+
+//-------------------------------------------------------
+// Function: RequestIDMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Attach the request ID to the context and response headers.
+// Audit:
+//   - Must wrap RecoverMiddleware so panics report the same ID.
+//-------------------------------------------------------
+func RequestIDMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get("X-Request-ID")
+        if !validRequestID(id) {
+            id = apierror.NewRequestID()
+        }
+        w.Header().Set("X-Request-ID", id)
+        next.ServeHTTP(w, r.WithContext(apierror.WithRequestID(r.Context(), id)))
+    })
+}
+
+// validRequestID reports whether id may be adopted as-is.
+func validRequestID(id string) bool {
+    if id == "" || len(id) > maxRequestIDLen {
+        return false
+    }
+    for _, c := range id {
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+        case c == '.' || c == '_' || c == '-':
+        default:
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,112 @@
+//-------------------------------------------------------
+// backend/middleware_timeout.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Attach a per-route deadline to every API request context.
+//   - Resolve per-route timeouts from defaults and configuration.
+// Audit:
+//   - Handlers pass r.Context() into all storage calls, so an
+//     expired deadline surfaces as HTTP 504 and is recorded by
+//     AuditMiddleware with "timed_out": true.
+//   - Client disconnects cancel the same context.
+//   - Timeouts are resolved per request, so a config reload applies
+//     to the next request without a restart.
+// Configuration:
+//   - request_timeout / REQUEST_TIMEOUT  default deadline (10s).
+//   - route_timeouts  / ROUTE_TIMEOUTS   per-route overrides, e.g.
+//     {"/file/save": "30s"} or "/file/save=30s,/files=5s".
+//-------------------------------------------------------
+
+package main
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "cfo-scratchpad/config"
+)
+
+// routeTimeouts holds built-in per-route deadlines; route_timeouts overrides.
+var routeTimeouts = map[string]time.Duration{
+    "/folders":   10 * time.Second,
+    "/files":     10 * time.Second,
+    "/file":      10 * time.Second,
+    "/file/save": 15 * time.Second,
+    "/file/move": 15 * time.Second,
+
+    // Archiving compresses or extracts a whole folder.
+    "/folders/archive":   120 * time.Second,
+    "/folders/unarchive": 120 * time.Second,
+
+    // Reports and search scan every note and need more headroom.
+    "/search":               30 * time.Second,
+    "/reports/duplicates":   60 * time.Second,
+    "/reports/usage":        30 * time.Second,
+    "/reports/broken-links": 60 * time.Second,
+    "/reports/sensitive":    60 * time.Second,
+    "/file/access-log":      30 * time.Second,
+    "/files/replace":        120 * time.Second,
+    "/files/download":       60 * time.Second,
+    "/export":               300 * time.Second,
+    "/rollover":             300 * time.Second,
+    "/rules/preview":        60 * time.Second,
+    "/rules/run":            300 * time.Second,
+    "/admin/fsck":           120 * time.Second,
+    "/admin/backup":         300 * time.Second,
+    "/admin/logs/rotate":    120 * time.Second,
+    "/audit/export":         300 * time.Second,
+    "/admin/sync":           300 * time.Second,
+
+    // Event streams end at their deadline and the client reconnects;
+    // this must stay below server.write_timeout.
+    "/events": 5 * time.Minute,
+
+    // Text-to-speech renders whole notes; tts.timeout is at most 5m.
+    "/file/audio": 300 * time.Second,
+
+    // Evidence bundles copy a range of logs plus a backup archive.
+    "/admin/evidence-bundle": 300 * time.Second,
+
+    // CPU profiles and execution traces sample for ?seconds= (30 by
+    // default); this must stay below server.write_timeout.
+    pprofPrefix: 300 * time.Second,
+}
+
+//-------------------------------------------------------
+// Function: TimeoutMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Run the handler with a context that expires after the
+//     deadline configured for pattern.
+// Audit:
+//   - The deadline is enforced by handlers/storage; this wrapper
+//     never writes a response itself, so no partial bodies occur.
+//-------------------------------------------------------
+func TimeoutMiddleware(pattern string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx, cancel := context.WithTimeout(r.Context(), timeoutFor(pattern))
+        defer cancel()
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+//-------------------------------------------------------
+// Function: timeoutFor
+//-------------------------------------------------------
+// Purpose:
+//   - Resolve the deadline for a route pattern.
+// Audit:
+//   - Precedence: configured route_timeouts entry, built-in route
+//     value, then request_timeout.
+//-------------------------------------------------------
+func timeoutFor(pattern string) time.Duration {
+    cfg := config.Current()
+    if d, ok := cfg.RouteTimeouts[pattern]; ok {
+        return d.Std()
+    }
+    if d, ok := routeTimeouts[pattern]; ok {
+        return d
+    }
+    return cfg.RequestTimeout.Std()
+}
@@ -0,0 +1,111 @@
+//-------------------------------------------------------
+// backend/middleware_tracing.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - OpenTelemetry server spans for every HTTP request, exported
+//     over OTLP when tracing is enabled (see backend/tracing).
+// Audit:
+//   - One "METHOD /route" span per request with method, route,
+//     status and request ID; storage calls and the audit write are
+//     child spans (handlers/storage.go, audit.WriteContext).
+//   - A W3C traceparent request header joins the caller's trace.
+//   - Only the route pattern is recorded, never the query string,
+//     body or credentials.
+// Configuration:
+//   - tracing.enabled / TRACING_ENABLED (default off),
+//     tracing.endpoint / OTEL_EXPORTER_OTLP_ENDPOINT,
+//     tracing.service_name / OTEL_SERVICE_NAME,
+//     tracing.sample_ratio / OTEL_TRACES_SAMPLER_ARG,
+//     tracing.headers / OTEL_EXPORTER_OTLP_HEADERS,
+//     tracing.include_paths.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "fmt"
+    "net/http"
+
+    "cfo-scratchpad/buildinfo"
+    "cfo-scratchpad/config"
+    "cfo-scratchpad/tracing"
+)
+
+//-------------------------------------------------------
+// Function: startTracing
+//-------------------------------------------------------
+// Purpose:
+//   - Turn span export on when tracing.enabled is set.
+// Audit:
+//   - Read at startup only; a reload that changes "tracing" is
+//     reported and takes effect after a restart.
+//-------------------------------------------------------
+func startTracing(cfg *config.Config) error {
+    t := cfg.Tracing
+    if !t.Enabled {
+        return nil
+    }
+    err := tracing.Configure(tracing.Settings{
+        Enabled:        true,
+        Endpoint:       t.Endpoint,
+        ServiceName:    t.ServiceName,
+        ServiceVersion: buildinfo.String(),
+        SampleRatio:    t.SampleRatio,
+        Headers:        t.Headers,
+    })
+    if err != nil {
+        return err
+    }
+    endpoint, _ := tracing.TracesURL(t.Endpoint)
+    logInfo(fmt.Sprintf("Tracing enabled: exporting to %s (service %s, sample_ratio %g)", endpoint, t.ServiceName, t.SampleRatio))
+    return nil
+}
+
+//-------------------------------------------------------
+// Function: TracingMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Wrap each request in a server span.
+// Audit:
+//   - 5xx responses mark the span failed; 4xx do not (the server
+//     worked as intended).
+//-------------------------------------------------------
+func TracingMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !tracing.Enabled() {
+            next.ServeHTTP(w, r)
+            return
+        }
+        ctx := tracing.Extract(r.Context(), r.Header.Get("traceparent"))
+        ctx, span := tracing.Start(ctx, "HTTP "+r.Method, tracing.KindServer)
+        span.SetAttr("http.request.method", r.Method)
+        span.SetAttr("request.id", w.Header().Get("X-Request-ID"))
+
+        lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+        defer func() {
+            span.SetAttr("http.response.status_code", lrw.statusCode)
+            if lrw.statusCode >= 500 {
+                span.SetError(fmt.Errorf("HTTP %d", lrw.statusCode))
+            }
+            span.End()
+        }()
+        next.ServeHTTP(lrw, r.WithContext(ctx))
+    })
+}
+
+//-------------------------------------------------------
+// Function: RouteSpanMiddleware
+//-------------------------------------------------------
+// Purpose:
+//   - Name the request's server span after its route pattern
+//     (e.g. "POST /file/save"), once the mux has matched it.
+//-------------------------------------------------------
+func RouteSpanMiddleware(pattern string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if span := tracing.FromContext(r.Context()); span != nil {
+            span.SetName(r.Method + " " + pattern)
+            span.SetAttr("http.route", pattern)
+        }
+        next.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,182 @@
+//-------------------------------------------------------
+// backend/migrations/migrations.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Versioned on-disk layout of the scratch root: the version is
+//     recorded in <root>/.scratchpad/layout.json and ordered
+//     migrations bring older data directories up to date at startup.
+// Audit:
+//   - Each applied migration is recorded (version, name, UTC time)
+//     and written as a "migration.apply" audit event.
+//   - The version is saved after every step, so a crash mid-upgrade
+//     resumes at the first unapplied migration. Migrations must
+//     therefore be safe to re-run.
+//   - A layout newer than the binary knows is refused
+//     (ErrNewerLayout): an older binary must never touch it.
+//-------------------------------------------------------
+
+package migrations
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+
+    "cfo-scratchpad/audit"
+)
+
+// ErrNewerLayout is returned when the data directory was written by a
+// newer release.
+var ErrNewerLayout = errors.New("data layout is newer than this binary supports")
+
+//-------------------------------------------------------
+// Struct: Migration
+//-------------------------------------------------------
+// Purpose:
+//   - One layout change: Apply upgrades root from Version-1 to
+//     Version.
+//-------------------------------------------------------
+type Migration struct {
+    Version int
+    Name    string
+    Apply   func(root string) error
+}
+
+//-------------------------------------------------------
+// Struct: State
+//-------------------------------------------------------
+// Purpose:
+//   - Content of layout.json.
+//-------------------------------------------------------
+type State struct {
+    Version int       `json:"version"`
+    Applied []Applied `json:"applied"`
+}
+
+// Applied records one migration that ran.
+type Applied struct {
+    Version   int    `json:"version"`
+    Name      string `json:"name"`
+    AppliedAt string `json:"applied_at"`
+}
+
+// statePath is the layout version file under root.
+func statePath(root string) string {
+    return filepath.Join(root, ".scratchpad", "layout.json")
+}
+
+//-------------------------------------------------------
+// Function: Load
+//-------------------------------------------------------
+// Purpose:
+//   - Read the recorded layout; a missing file is version 0 (a
+//     data directory from before versioning, or a new one).
+//-------------------------------------------------------
+func Load(root string) (State, error) {
+    state := State{Applied: []Applied{}}
+    data, err := ioutil.ReadFile(statePath(root))
+    if os.IsNotExist(err) {
+        return state, nil
+    }
+    if err != nil {
+        return state, err
+    }
+    if err := json.Unmarshal(data, &state); err != nil {
+        return state, fmt.Errorf("corrupt %s: %v", statePath(root), err)
+    }
+    return state, nil
+}
+
+//-------------------------------------------------------
+// Function: save
+//-------------------------------------------------------
+// Purpose:
+//   - Atomically replace layout.json (temp file, fsync, rename).
+//-------------------------------------------------------
+func save(root string, state State) error {
+    data, err := json.MarshalIndent(state, "", "  ")
+    if err != nil {
+        return err
+    }
+    path := statePath(root)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    tmp, err := ioutil.TempFile(filepath.Dir(path), "layout.json.tmp-")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    if err := os.Chmod(tmp.Name(), 0644); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+//-------------------------------------------------------
+// Function: Run
+//-------------------------------------------------------
+// Purpose:
+//   - Apply every step newer than the recorded version, in order,
+//     and return the ones applied.
+// Audit:
+//   - steps must be numbered 1..n without gaps.
+//   - A missing root is left alone (nothing to upgrade yet).
+//   - Stops at the first failing step; the version stays at the
+//     last step that succeeded.
+//-------------------------------------------------------
+func Run(root string, steps []Migration) ([]Applied, error) {
+    applied := []Applied{}
+    for i, step := range steps {
+        if step.Version != i+1 {
+            return applied, fmt.Errorf("migration %q has version %d, want %d", step.Name, step.Version, i+1)
+        }
+    }
+    if info, err := os.Stat(root); err != nil || !info.IsDir() {
+        return applied, nil
+    }
+
+    state, err := Load(root)
+    if err != nil {
+        return applied, err
+    }
+    if state.Version > len(steps) {
+        return applied, fmt.Errorf("%w: layout version %d, supported %d", ErrNewerLayout, state.Version, len(steps))
+    }
+
+    for _, step := range steps[state.Version:] {
+        if err := step.Apply(root); err != nil {
+            return applied, fmt.Errorf("migration %d (%s): %v", step.Version, step.Name, err)
+        }
+        record := Applied{Version: step.Version, Name: step.Name, AppliedAt: audit.Now()}
+        state.Version = step.Version
+        state.Applied = append(state.Applied, record)
+        if err := save(root, state); err != nil {
+            return applied, fmt.Errorf("record migration %d: %v", step.Version, err)
+        }
+        applied = append(applied, record)
+        audit.Write(audit.Event{
+            Event:  "migration.apply",
+            Method: "STARTUP",
+            Path:   statePath(root),
+            Status: 200,
+            Target: step.Name,
+            Detail: fmt.Sprintf("version=%d", step.Version),
+        })
+    }
+    return applied, nil
+}
@@ -0,0 +1,353 @@
+//-------------------------------------------------------
+// backend/probes.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Classify every request for the evidence log as an API call,
+//     a static asset hit, or a suspicious probe (scanners trying
+//     /.env, /wp-admin, path traversal, ...), so the log doubles as
+//     an intrusion indicator.
+//   - Daily probe report: GET /admin/probes?date=YYYY-MM-DD and a
+//     "security.probe_report" event summarizing each finished day.
+// Audit:
+//   - The category is written on the request event ("category");
+//     probes carry the matched signature in Detail ("probe: /.env",
+//     "probe: not found", "probe: traversal").
+//   - A 404 outside the API is a probe unless it is a path browsers
+//     and crawlers fetch on their own (favicon, robots.txt,
+//     /.well-known/...).
+//   - API routes are only checked for traversal in the raw URI;
+//     their paths and parameters are otherwise the caller's data.
+//   - Static files that failed asset verification are flagged on
+//     the request ("asset unverified: <name>") in warn mode; enforce
+//     mode blocks them with a "security.asset_blocked" event
+//     (assets.go).
+//-------------------------------------------------------
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "sort"
+    "strings"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+)
+
+const (
+    probeReportEvent = "security.probe_report"
+    probeReportTop   = 20
+    probeNotFound    = "not found"
+    probeTraversal   = "traversal"
+)
+
+// probeSignatures are path fragments this application never serves
+// and that vulnerability scanners request on every host.
+var probeSignatures = []string{
+    "/.env", "/.git", "/.svn", "/.hg", "/.aws", "/.ssh", "/.docker",
+    "/.htaccess", "/.htpasswd", "/.ds_store", "/.vscode", "/.idea",
+    "/wp-", "/wordpress", "/xmlrpc.php", "/phpmyadmin", "/pma/",
+    "/cgi-bin/", "/server-status", "/server-info", "/actuator",
+    "/etc/passwd", "/proc/self", "/vendor/phpunit", "/boaform",
+    "/hnap1", "/owa/", "/autodiscover", "/solr/", "/manager/html",
+    "/jmx-console", "/console/", "/telescope", "/_ignition",
+    "/config.json", "/credentials", "/backup.", "/dump.sql",
+}
+
+// probeSuffixes are file types the frontend never contains.
+var probeSuffixes = []string{
+    ".php", ".asp", ".aspx", ".jsp", ".cgi", ".pl", ".sql", ".bak",
+    ".old", ".swp", ".ini", ".cfg", ".conf", ".yml", ".yaml", ".key",
+    ".pem",
+}
+
+// benignMisses may 404 without any intent: browsers and crawlers
+// request them on their own.
+var benignMisses = map[string]bool{
+    "/favicon.ico":                      true,
+    "/robots.txt":                       true,
+    "/apple-touch-icon.png":             true,
+    "/apple-touch-icon-precomposed.png": true,
+    "/sitemap.xml":                      true,
+}
+
+//-------------------------------------------------------
+// Function: isAPIRoute
+//-------------------------------------------------------
+// Purpose:
+//   - Whether path is served by a registered API route (exact
+//     pattern, or below a pattern ending in "/").
+//-------------------------------------------------------
+func isAPIRoute(p string) bool {
+    if apiRoutes[p] {
+        return true
+    }
+    for pattern := range apiRoutes {
+        if strings.HasSuffix(pattern, "/") && strings.HasPrefix(p, pattern) {
+            return true
+        }
+    }
+    return false
+}
+
+//-------------------------------------------------------
+// Function: probeSignature
+//-------------------------------------------------------
+// Purpose:
+//   - The probe signature r matches, or "".
+// Audit:
+//   - Traversal is checked on the raw request URI (before the mux
+//     cleans the path), once and twice URL-decoded.
+//-------------------------------------------------------
+func probeSignature(r *http.Request, api bool) string {
+    raw := strings.ToLower(r.RequestURI)
+    for i := 0; i < 2; i++ {
+        if strings.Contains(raw, "../") || strings.Contains(raw, "..\\") || strings.HasSuffix(raw, "/..") {
+            return probeTraversal
+        }
+        decoded, err := url.QueryUnescape(raw)
+        if err != nil || decoded == raw {
+            break
+        }
+        raw = decoded
+    }
+    if api {
+        return ""
+    }
+    p := strings.ToLower(r.URL.Path)
+    for _, signature := range probeSignatures {
+        if strings.Contains(p, signature) {
+            return signature
+        }
+    }
+    for _, suffix := range probeSuffixes {
+        if strings.HasSuffix(p, suffix) {
+            return "*" + suffix
+        }
+    }
+    return ""
+}
+
+//-------------------------------------------------------
+// Function: classifyRequest
+//-------------------------------------------------------
+// Purpose:
+//   - Category and detail for the request event of r answered with
+//     status.
+//-------------------------------------------------------
+func classifyRequest(r *http.Request, status int) (string, string) {
+    api := isAPIRoute(r.URL.Path)
+    if signature := probeSignature(r, api); signature != "" {
+        return audit.CategoryProbe, "probe: " + signature
+    }
+    if api {
+        return audit.CategoryAPI, ""
+    }
+    if status == http.StatusNotFound && !benignMisses[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/.well-known/") {
+        return audit.CategoryProbe, "probe: " + probeNotFound
+    }
+    if status < 300 {
+        report := currentAssetReport()
+        if report.Mode == "warn" && report.Status == assetsTampered {
+            name := assetName(r)
+            if _, ok := report.trusted[name]; !ok {
+                return audit.CategoryStatic, "asset unverified: " + name
+            }
+        }
+    }
+    return audit.CategoryStatic, ""
+}
+
+//-------------------------------------------------------
+// Struct: ProbeReport
+//-------------------------------------------------------
+// Purpose:
+//   - Probe summary for one UTC day.
+// Audit:
+//   - Lists are sorted by count (then name) and capped at
+//     probeReportTop entries; totals cover everything.
+//-------------------------------------------------------
+type ProbeReport struct {
+    Date        string       `json:"date"`
+    Probes      int          `json:"probes"`
+    UniqueIPs   int          `json:"unique_ips"`
+    FirstSeen   string       `json:"first_seen,omitempty"`
+    LastSeen    string       `json:"last_seen,omitempty"`
+    BySignature []ProbeCount `json:"by_signature"`
+    ByIP        []ProbeCount `json:"by_ip"`
+    ByPath      []ProbeCount `json:"by_path"`
+    APICalls    int          `json:"api_calls"`
+    StaticHits  int          `json:"static_hits"`
+    AssetEvents int          `json:"asset_events"`
+}
+
+// ProbeCount is one row of a ProbeReport list.
+type ProbeCount struct {
+    Name  string `json:"name"`
+    Count int    `json:"count"`
+}
+
+//-------------------------------------------------------
+// Function: buildProbeReport
+//-------------------------------------------------------
+// Purpose:
+//   - Summarize the request events of day (UTC, YYYY-MM-DD) from
+//     the evidence log.
+//-------------------------------------------------------
+func buildProbeReport(day time.Time) (*ProbeReport, error) {
+    date := day.UTC().Format("2006-01-02")
+    report := &ProbeReport{Date: date}
+    signatures, ips, paths := map[string]int{}, map[string]int{}, map[string]int{}
+    err := audit.Scan(day, func(event audit.Event, ref string) {
+        if !strings.HasPrefix(event.Timestamp, date) {
+            return
+        }
+        switch {
+        case strings.HasPrefix(event.Event, "security.asset_"):
+            report.AssetEvents++
+        case event.Event != "":
+        case event.Category == audit.CategoryAPI:
+            report.APICalls++
+        case event.Category == audit.CategoryStatic:
+            report.StaticHits++
+        case event.Category == audit.CategoryProbe:
+            report.Probes++
+            signatures[strings.TrimPrefix(event.Detail, "probe: ")]++
+            ips[clientIP(event.RemoteIP)]++
+            paths[event.Path]++
+            if report.FirstSeen == "" || event.Timestamp < report.FirstSeen {
+                report.FirstSeen = event.Timestamp
+            }
+            if event.Timestamp > report.LastSeen {
+                report.LastSeen = event.Timestamp
+            }
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    report.UniqueIPs = len(ips)
+    report.BySignature = topCounts(signatures)
+    report.ByIP = topCounts(ips)
+    report.ByPath = topCounts(paths)
+    return report, nil
+}
+
+// topCounts sorts counts by count, then name, keeping probeReportTop.
+func topCounts(counts map[string]int) []ProbeCount {
+    list := make([]ProbeCount, 0, len(counts))
+    for name, count := range counts {
+        list = append(list, ProbeCount{Name: name, Count: count})
+    }
+    sort.Slice(list, func(i, j int) bool {
+        if list[i].Count != list[j].Count {
+            return list[i].Count > list[j].Count
+        }
+        return list[i].Name < list[j].Name
+    })
+    if len(list) > probeReportTop {
+        list = list[:probeReportTop]
+    }
+    return list
+}
+
+//-------------------------------------------------------
+// Function: handleProbeReport
+//-------------------------------------------------------
+// Purpose:
+//   - GET /admin/probes?date=YYYY-MM-DD: the ProbeReport of that UTC
+//     day (default today, so far).
+// Audit:
+//   - Read-only; writes "admin.probe_report_view".
+//-------------------------------------------------------
+func handleProbeReport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    day := audit.Clock().Now().UTC()
+    if v := r.URL.Query().Get("date"); v != "" {
+        parsed, err := time.Parse("2006-01-02", v)
+        if err != nil {
+            apierror.Write(w, r, apierror.CodeInvalidField, "date", "Bad request: date must be YYYY-MM-DD")
+            return
+        }
+        day = parsed
+    }
+    report, err := buildProbeReport(day)
+    if err != nil {
+        logError("Failed to build probe report: " + err.Error())
+        apierror.Write(w, r, apierror.CodeInternal, "", "Failed to read the evidence log")
+        return
+    }
+    auditAdmin(r, "admin.probe_report_view", http.StatusOK, report.Date, "")
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
+
+//-------------------------------------------------------
+// Function: runProbeReports
+//-------------------------------------------------------
+// Purpose:
+//   - After each UTC midnight, write yesterday's probe summary to
+//     the evidence log as "security.probe_report".
+// Audit:
+//   - Also runs at startup for the previous day; a day already
+//     reported (the event is in today's log) is skipped, so restarts
+//     do not duplicate it.
+//   - Days without probes still get a report (probes=0), so a
+//     missing report means the server was down, not quiet.
+//-------------------------------------------------------
+func runProbeReports() {
+    for {
+        now := audit.Clock().Now().UTC()
+        writeProbeReport(now.AddDate(0, 0, -1))
+        next := time.Date(now.Year(), now.Month(), now.Day(), 0, 5, 0, 0, time.UTC).AddDate(0, 0, 1)
+        time.Sleep(next.Sub(now))
+    }
+}
+
+// writeProbeReport records the summary of day unless it exists.
+func writeProbeReport(day time.Time) {
+    date := day.Format("2006-01-02")
+    reported := false
+    audit.Scan(day.AddDate(0, 0, 1), func(event audit.Event, ref string) {
+        if event.Event == probeReportEvent && event.Target == date {
+            reported = true
+        }
+    })
+    if reported {
+        return
+    }
+    report, err := buildProbeReport(day)
+    if err != nil {
+        logError("Probe report for " + date + " failed: " + err.Error())
+        return
+    }
+    top := make([]string, 0, 3)
+    for i, entry := range report.BySignature {
+        if i == 3 {
+            break
+        }
+        top = append(top, fmt.Sprintf("%s=%d", entry.Name, entry.Count))
+    }
+    detail := fmt.Sprintf("probes=%d unique_ips=%d api_calls=%d static_hits=%d asset_events=%d top=[%s]",
+        report.Probes, report.UniqueIPs, report.APICalls, report.StaticHits, report.AssetEvents, strings.Join(top, " "))
+    audit.Write(audit.Event{
+        Event:  probeReportEvent,
+        Method: "REPORT",
+        Path:   "/admin/probes",
+        Status: http.StatusOK,
+        Target: date,
+        Detail: detail,
+    })
+    if report.Probes > 0 {
+        logWarn("Probe report " + date + ": " + detail)
+    } else {
+        logInfo("Probe report " + date + ": no probes")
+    }
+}
@@ -0,0 +1,480 @@
+//-------------------------------------------------------
+// backend/qrcode/qrcode.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Minimal QR code encoder for provisioning URIs (otpauth://),
+//     rendered as SVG so authenticator apps can scan them from the
+//     browser without an external service or library.
+// Audit:
+//   - Byte mode, error correction level M, versions 1-10 (up to 213
+//     bytes); longer text is refused with ErrTooLong.
+//   - The mask is chosen by the standard penalty rules (ISO/IEC
+//     18004), so the output matches other encoders module for module.
+//-------------------------------------------------------
+
+package qrcode
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+)
+
+// ErrTooLong is returned for text beyond version 10 capacity.
+var ErrTooLong = errors.New("qrcode: text too long")
+
+// versionInfo is the level M block layout of one version.
+type versionInfo struct {
+    eccPerBlock int
+    blocks      []int // data codewords of each block
+    alignment   []int // alignment pattern centre coordinates
+}
+
+// versions holds versions 1-10 at level M (index = version - 1).
+var versions = []versionInfo{
+    {10, []int{16}, nil},
+    {16, []int{28}, []int{6, 18}},
+    {26, []int{44}, []int{6, 22}},
+    {18, []int{32, 32}, []int{6, 26}},
+    {24, []int{43, 43}, []int{6, 30}},
+    {16, []int{27, 27, 27, 27}, []int{6, 34}},
+    {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+    {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+    {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+    {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// formatLevelM is the two-bit format code of error correction level M.
+const formatLevelM = 0
+
+//-------------------------------------------------------
+// Struct: Code
+//-------------------------------------------------------
+// Purpose:
+//   - An encoded symbol: Size x Size modules, true is dark.
+//-------------------------------------------------------
+type Code struct {
+    Size     int
+    modules  [][]bool
+    function [][]bool
+}
+
+//-------------------------------------------------------
+// Function: Encode
+//-------------------------------------------------------
+// Purpose:
+//   - Encode text in the smallest version that holds it.
+//-------------------------------------------------------
+func Encode(text string) (*Code, error) {
+    data := []byte(text)
+    for v := 1; v <= len(versions); v++ {
+        info := versions[v-1]
+        capacity := 0
+        for _, n := range info.blocks {
+            capacity += n
+        }
+        countBits := 8
+        if v >= 10 {
+            countBits = 16
+        }
+        if 4+countBits+8*len(data) > capacity*8 {
+            continue
+        }
+        codewords := interleave(info, dataCodewords(data, countBits, capacity))
+        return build(v, info, codewords), nil
+    }
+    return nil, ErrTooLong
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+    return c.modules[y][x]
+}
+
+//-------------------------------------------------------
+// Function: (Code) SVG
+//-------------------------------------------------------
+// Purpose:
+//   - The symbol as a scalable SVG image with the standard quiet
+//     zone of four modules; scale is the pixel size of one module.
+//-------------------------------------------------------
+func (c *Code) SVG(scale int) []byte {
+    const quiet = 4
+    full := c.Size + 2*quiet
+    var b bytes.Buffer
+    fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+        full*scale, full*scale, full, full)
+    fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, full, full)
+    for y := 0; y < c.Size; y++ {
+        for x := 0; x < c.Size; x++ {
+            if c.modules[y][x] {
+                fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+            }
+        }
+    }
+    b.WriteString(`"/></svg>`)
+    return b.Bytes()
+}
+
+// dataCodewords builds the byte mode bit stream, padded to capacity.
+func dataCodewords(data []byte, countBits int, capacity int) []byte {
+    var bits []bool
+    put := func(value int, n int) {
+        for i := n - 1; i >= 0; i-- {
+            bits = append(bits, value>>uint(i)&1 == 1)
+        }
+    }
+    put(0x4, 4)
+    put(len(data), countBits)
+    for _, c := range data {
+        put(int(c), 8)
+    }
+    for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+        bits = append(bits, false)
+    }
+    for len(bits)%8 != 0 {
+        bits = append(bits, false)
+    }
+
+    out := make([]byte, 0, capacity)
+    for i := 0; i < len(bits); i += 8 {
+        var c byte
+        for j := 0; j < 8; j++ {
+            if bits[i+j] {
+                c |= 1 << uint(7-j)
+            }
+        }
+        out = append(out, c)
+    }
+    for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+        out = append(out, pad)
+    }
+    return out
+}
+
+// interleave splits data into blocks, adds error correction, and
+// interleaves data then error correction codewords column by column.
+func interleave(info versionInfo, data []byte) []byte {
+    divisor := rsDivisor(info.eccPerBlock)
+    var blocks, eccs [][]byte
+    longest := 0
+    for _, n := range info.blocks {
+        block := data[:n]
+        data = data[n:]
+        blocks = append(blocks, block)
+        eccs = append(eccs, rsRemainder(block, divisor))
+        if n > longest {
+            longest = n
+        }
+    }
+    var out []byte
+    for i := 0; i < longest; i++ {
+        for _, block := range blocks {
+            if i < len(block) {
+                out = append(out, block[i])
+            }
+        }
+    }
+    for i := 0; i < info.eccPerBlock; i++ {
+        for _, ecc := range eccs {
+            out = append(out, ecc[i])
+        }
+    }
+    return out
+}
+
+// build lays out function patterns and codewords and applies the
+// mask with the lowest penalty.
+func build(version int, info versionInfo, codewords []byte) *Code {
+    size := 17 + 4*version
+    c := &Code{Size: size, modules: grid(size), function: grid(size)}
+
+    for i := 0; i < size; i++ {
+        c.setFunction(6, i, i%2 == 0)
+        c.setFunction(i, 6, i%2 == 0)
+    }
+    c.drawFinder(3, 3)
+    c.drawFinder(size-4, 3)
+    c.drawFinder(3, size-4)
+    last := len(info.alignment) - 1
+    for i, x := range info.alignment {
+        for j, y := range info.alignment {
+            if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+                continue
+            }
+            c.drawAlignment(x, y)
+        }
+    }
+    c.drawFormat(0)
+    c.drawVersion(version)
+    c.drawCodewords(codewords)
+
+    best, bestPenalty := 0, -1
+    for mask := 0; mask < 8; mask++ {
+        c.applyMask(mask)
+        c.drawFormat(mask)
+        if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+            best, bestPenalty = mask, p
+        }
+        c.applyMask(mask)
+    }
+    c.applyMask(best)
+    c.drawFormat(best)
+    return c
+}
+
+func grid(size int) [][]bool {
+    g := make([][]bool, size)
+    for i := range g {
+        g[i] = make([]bool, size)
+    }
+    return g
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+    c.modules[y][x] = dark
+    c.function[y][x] = true
+}
+
+func (c *Code) drawFinder(cx, cy int) {
+    for dy := -4; dy <= 4; dy++ {
+        for dx := -4; dx <= 4; dx++ {
+            x, y := cx+dx, cy+dy
+            if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+                continue
+            }
+            d := maxInt(absInt(dx), absInt(dy))
+            c.setFunction(x, y, d != 2 && d != 4)
+        }
+    }
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+    for dy := -2; dy <= 2; dy++ {
+        for dx := -2; dx <= 2; dx++ {
+            c.setFunction(cx+dx, cy+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+        }
+    }
+}
+
+// drawFormat writes both copies of the 15-bit format information.
+func (c *Code) drawFormat(mask int) {
+    data := formatLevelM<<3 | mask
+    rem := data
+    for i := 0; i < 10; i++ {
+        rem = rem<<1 ^ (rem>>9)*0x537
+    }
+    bits := (data<<10 | rem) ^ 0x5412
+    bit := func(i int) bool { return bits>>uint(i)&1 == 1 }
+
+    for i := 0; i <= 5; i++ {
+        c.setFunction(8, i, bit(i))
+    }
+    c.setFunction(8, 7, bit(6))
+    c.setFunction(8, 8, bit(7))
+    c.setFunction(7, 8, bit(8))
+    for i := 9; i < 15; i++ {
+        c.setFunction(14-i, 8, bit(i))
+    }
+    for i := 0; i < 8; i++ {
+        c.setFunction(c.Size-1-i, 8, bit(i))
+    }
+    for i := 8; i < 15; i++ {
+        c.setFunction(8, c.Size-15+i, bit(i))
+    }
+    c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersion writes the 18-bit version information (version 7+).
+func (c *Code) drawVersion(version int) {
+    if version < 7 {
+        return
+    }
+    rem := version
+    for i := 0; i < 12; i++ {
+        rem = rem<<1 ^ (rem>>11)*0x1F25
+    }
+    bits := version<<12 | rem
+    for i := 0; i < 18; i++ {
+        dark := bits>>uint(i)&1 == 1
+        a, b := c.Size-11+i%3, i/3
+        c.setFunction(a, b, dark)
+        c.setFunction(b, a, dark)
+    }
+}
+
+// drawCodewords places the bits in the two-column zigzag, bottom
+// right first, skipping function modules.
+func (c *Code) drawCodewords(codewords []byte) {
+    i := 0
+    for right := c.Size - 1; right >= 1; right -= 2 {
+        if right == 6 {
+            right = 5
+        }
+        for vert := 0; vert < c.Size; vert++ {
+            for j := 0; j < 2; j++ {
+                x := right - j
+                y := vert
+                if (right+1)&2 == 0 {
+                    y = c.Size - 1 - vert
+                }
+                if c.function[y][x] || i >= len(codewords)*8 {
+                    continue
+                }
+                c.modules[y][x] = codewords[i>>3]>>uint(7-i&7)&1 == 1
+                i++
+            }
+        }
+    }
+}
+
+// applyMask inverts data modules selected by mask (self-inverse).
+func (c *Code) applyMask(mask int) {
+    for y := 0; y < c.Size; y++ {
+        for x := 0; x < c.Size; x++ {
+            if c.function[y][x] {
+                continue
+            }
+            var invert bool
+            switch mask {
+            case 0:
+                invert = (x+y)%2 == 0
+            case 1:
+                invert = y%2 == 0
+            case 2:
+                invert = x%3 == 0
+            case 3:
+                invert = (x+y)%3 == 0
+            case 4:
+                invert = (x/3+y/2)%2 == 0
+            case 5:
+                invert = x*y%2+x*y%3 == 0
+            case 6:
+                invert = (x*y%2+x*y%3)%2 == 0
+            case 7:
+                invert = ((x+y)%2+x*y%3)%2 == 0
+            }
+            if invert {
+                c.modules[y][x] = !c.modules[y][x]
+            }
+        }
+    }
+}
+
+// penalty scores the symbol by the four mask evaluation rules.
+func (c *Code) penalty() int {
+    total := 0
+    line := func(get func(i int) bool) {
+        run := 1
+        for i := 1; i <= c.Size; i++ {
+            if i < c.Size && get(i) == get(i-1) {
+                run++
+                continue
+            }
+            if run >= 5 {
+                total += run - 2
+            }
+            run = 1
+        }
+        finder := []bool{true, false, true, true, true, false, true}
+        for i := 0; i+7 <= c.Size; i++ {
+            match := true
+            for k, want := range finder {
+                if get(i+k) != want {
+                    match = false
+                    break
+                }
+            }
+            if match && (lightRun(get, i-4, i, c.Size) || lightRun(get, i+7, i+11, c.Size)) {
+                total += 40
+            }
+        }
+    }
+    dark := 0
+    for y := 0; y < c.Size; y++ {
+        row := y
+        line(func(i int) bool { return c.modules[row][i] })
+        line(func(i int) bool { return c.modules[i][row] })
+        for x := 0; x < c.Size; x++ {
+            if c.modules[y][x] {
+                dark++
+            }
+            if x+1 < c.Size && y+1 < c.Size {
+                v := c.modules[y][x]
+                if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+                    total += 3
+                }
+            }
+        }
+    }
+    cells := c.Size * c.Size
+    total += absInt(dark*20-cells*10) / cells * 10
+    return total
+}
+
+// lightRun reports whether modules from..to-1 are all light, treating
+// positions outside the symbol as light (the quiet zone).
+func lightRun(get func(i int) bool, from, to, size int) bool {
+    for i := from; i < to; i++ {
+        if i >= 0 && i < size && get(i) {
+            return false
+        }
+    }
+    return true
+}
+
+// rsDivisor is the Reed-Solomon generator polynomial of degree n,
+// highest coefficient (always 1) omitted.
+func rsDivisor(n int) []byte {
+    result := make([]byte, n)
+    result[n-1] = 1
+    root := byte(1)
+    for i := 0; i < n; i++ {
+        for j := range result {
+            result[j] = gfMul(result[j], root)
+            if j+1 < n {
+                result[j] ^= result[j+1]
+            }
+        }
+        root = gfMul(root, 2)
+    }
+    return result
+}
+
+// rsRemainder is the error correction of data for the divisor.
+func rsRemainder(data []byte, divisor []byte) []byte {
+    result := make([]byte, len(divisor))
+    for _, b := range data {
+        factor := b ^ result[0]
+        copy(result, result[1:])
+        result[len(result)-1] = 0
+        for i := range result {
+            result[i] ^= gfMul(divisor[i], factor)
+        }
+    }
+    return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+    z := 0
+    for i := 7; i >= 0; i-- {
+        z = z<<1 ^ (z>>7)*0x11D
+        z ^= int(y>>uint(i)&1) * int(x)
+    }
+    return byte(z)
+}
+
+func absInt(v int) int {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
+
+func maxInt(a, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
@@ -0,0 +1,298 @@
+//-------------------------------------------------------
+// backend/qrcode/qrcode_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for the QR encoder: symbols are read back with an
+//     independent reader (format information, unmasking, zigzag
+//     placement, de-interleaving, Reed-Solomon syndromes) and must
+//     yield the encoded text.
+//-------------------------------------------------------
+
+package qrcode
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+)
+
+// readFormat decodes the format information next to the top left
+// finder, checks it against the copy by the other two finders and
+// returns the mask.
+func readFormat(t *testing.T, c *Code) int {
+    t.Helper()
+    var first, second int
+    // Least significant bit first, in the positions ISO/IEC 18004 gives.
+    firstCoords := [][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+    for i, xy := range firstCoords {
+        if c.Dark(xy[0], xy[1]) {
+            first |= 1 << uint(i)
+        }
+    }
+    for i := 0; i < 8; i++ {
+        if c.Dark(c.Size-1-i, 8) {
+            second |= 1 << uint(i)
+        }
+    }
+    for i := 8; i < 15; i++ {
+        if c.Dark(8, c.Size-15+i) {
+            second |= 1 << uint(i)
+        }
+    }
+    if first != second {
+        t.Fatalf("format copies differ: %015b vs %015b", first, second)
+    }
+    format := first ^ 0x5412
+    rem := format
+    for bit := 14; bit >= 10; bit-- {
+        if rem>>uint(bit)&1 == 1 {
+            rem ^= 0x537 << uint(bit-10)
+        }
+    }
+    if rem != 0 {
+        t.Fatalf("format %015b fails its BCH check", format)
+    }
+    if level := format >> 13; level != 0 {
+        t.Fatalf("error correction level bits %02b, want 00 (M)", level)
+    }
+    if !c.Dark(8, c.Size-8) {
+        t.Fatalf("dark module missing")
+    }
+    return format >> 10 & 7
+}
+
+// readVersion decodes both copies of the version information
+// (versions 7 and up).
+func readVersion(t *testing.T, c *Code) int {
+    t.Helper()
+    var bottomLeft, topRight int
+    for i := 0; i < 18; i++ {
+        a, b := c.Size-11+i%3, i/3
+        if c.Dark(a, b) {
+            topRight |= 1 << uint(i)
+        }
+        if c.Dark(b, a) {
+            bottomLeft |= 1 << uint(i)
+        }
+    }
+    if bottomLeft != topRight {
+        t.Fatalf("version copies differ: %018b vs %018b", bottomLeft, topRight)
+    }
+    rem := topRight
+    for bit := 17; bit >= 12; bit-- {
+        if rem>>uint(bit)&1 == 1 {
+            rem ^= 0x1F25 << uint(bit-12)
+        }
+    }
+    if rem != 0 {
+        t.Fatalf("version information %018b fails its BCH check", topRight)
+    }
+    return topRight >> 12
+}
+
+// masked reports whether mask inverts the module at x, y.
+func masked(mask, x, y int) bool {
+    switch mask {
+    case 0:
+        return (x+y)%2 == 0
+    case 1:
+        return y%2 == 0
+    case 2:
+        return x%3 == 0
+    case 3:
+        return (x+y)%3 == 0
+    case 4:
+        return (x/3+y/2)%2 == 0
+    case 5:
+        return x*y%2+x*y%3 == 0
+    case 6:
+        return (x*y%2+x*y%3)%2 == 0
+    }
+    return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// readCodewords unmasks the data modules and reads them in zigzag
+// order from the bottom right.
+func readCodewords(c *Code, mask int) []byte {
+    var out []byte
+    var cur byte
+    n := 0
+    for right := c.Size - 1; right >= 1; right -= 2 {
+        if right == 6 {
+            right = 5
+        }
+        for vert := 0; vert < c.Size; vert++ {
+            for j := 0; j < 2; j++ {
+                x := right - j
+                y := vert
+                if (right+1)&2 == 0 {
+                    y = c.Size - 1 - vert
+                }
+                if c.function[y][x] {
+                    continue
+                }
+                bit := c.Dark(x, y) != masked(mask, x, y)
+                cur <<= 1
+                if bit {
+                    cur |= 1
+                }
+                if n++; n%8 == 0 {
+                    out = append(out, cur)
+                    cur = 0
+                }
+            }
+        }
+    }
+    return out
+}
+
+// syndromesZero evaluates a codeword at the generator's roots.
+func syndromesZero(codeword []byte, ecc int) bool {
+    alpha := byte(1)
+    for i := 0; i < ecc; i++ {
+        var sum byte
+        for _, b := range codeword {
+            sum = gfMul(sum, alpha) ^ b
+        }
+        if sum != 0 {
+            return false
+        }
+        alpha = gfMul(alpha, 2)
+    }
+    return true
+}
+
+// decode reads the byte mode payload back out of c.
+func decode(t *testing.T, c *Code) string {
+    t.Helper()
+    version := (c.Size - 17) / 4
+    if version >= 7 {
+        if got := readVersion(t, c); got != version {
+            t.Fatalf("version information says %d, size says %d", got, version)
+        }
+    }
+    info := versions[version-1]
+    raw := readCodewords(c, readFormat(t, c))
+
+    longest, total := 0, 0
+    for _, n := range info.blocks {
+        longest = max(longest, n)
+        total += n
+    }
+    blocks := make([][]byte, len(info.blocks))
+    pos := 0
+    for i := 0; i < longest; i++ {
+        for b, n := range info.blocks {
+            if i < n {
+                blocks[b] = append(blocks[b], raw[pos])
+                pos++
+            }
+        }
+    }
+    for i := 0; i < info.eccPerBlock; i++ {
+        for b := range blocks {
+            blocks[b] = append(blocks[b], raw[pos])
+            pos++
+        }
+    }
+    var data []byte
+    for b, n := range info.blocks {
+        if !syndromesZero(blocks[b], info.eccPerBlock) {
+            t.Fatalf("block %d fails its Reed-Solomon check", b)
+        }
+        data = append(data, blocks[b][:n]...)
+    }
+    if len(data) != total {
+        t.Fatalf("read %d data codewords, want %d", len(data), total)
+    }
+
+    countBits := 8
+    if version >= 10 {
+        countBits = 16
+    }
+    bitAt := func(i int) int { return int(data[i/8]>>uint(7-i%8)) & 1 }
+    field := func(from, n int) int {
+        v := 0
+        for i := 0; i < n; i++ {
+            v = v<<1 | bitAt(from+i)
+        }
+        return v
+    }
+    if mode := field(0, 4); mode != 4 {
+        t.Fatalf("mode %04b, want 0100 (byte)", mode)
+    }
+    length := field(4, countBits)
+    text := make([]byte, length)
+    for i := range text {
+        text[i] = byte(field(4+countBits+8*i, 8))
+    }
+    return string(text)
+}
+
+func TestEncodeReadsBack(t *testing.T) {
+    for _, tc := range []struct {
+        text    string
+        version int
+    }{
+        {"a", 1},
+        {strings.Repeat("x", 14), 1},
+        {strings.Repeat("x", 15), 2},
+        {"otpauth://totp/CFO%20Scratchpad:alice?secret=JBSWY3DPEHPK3PXP&issuer=CFO%20Scratchpad&algorithm=SHA1&digits=6&period=30", 7},
+        {strings.Repeat("z", 180), 9},
+        {strings.Repeat("y", 213), 10},
+    } {
+        c, err := Encode(tc.text)
+        if err != nil {
+            t.Fatalf("Encode(%d bytes): %v", len(tc.text), err)
+        }
+        if got := (c.Size - 17) / 4; got != tc.version {
+            t.Errorf("Encode(%d bytes) chose version %d, want %d", len(tc.text), got, tc.version)
+        }
+        if got := decode(t, c); got != tc.text {
+            t.Errorf("read back %q, want %q", got, tc.text)
+        }
+    }
+}
+
+func TestEncodeFunctionPatterns(t *testing.T) {
+    c, err := Encode("otpauth://totp/x")
+    if err != nil {
+        t.Fatal(err)
+    }
+    finder := []string{"#######", "#.....#", "#.###.#", "#.###.#", "#.###.#", "#.....#", "#######"}
+    for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+        for dy, row := range finder {
+            for dx, want := range row {
+                if c.Dark(corner[0]+dx, corner[1]+dy) != (want == '#') {
+                    t.Fatalf("finder at %v differs at %d,%d", corner, dx, dy)
+                }
+            }
+        }
+    }
+    for i := 8; i < c.Size-8; i++ {
+        if c.Dark(i, 6) != (i%2 == 0) || c.Dark(6, i) != (i%2 == 0) {
+            t.Fatalf("timing pattern wrong at %d", i)
+        }
+    }
+}
+
+func TestEncodeTooLong(t *testing.T) {
+    if _, err := Encode(strings.Repeat("y", 214)); !errors.Is(err, ErrTooLong) {
+        t.Fatalf("Encode(214 bytes) = %v, want ErrTooLong", err)
+    }
+}
+
+func TestSVG(t *testing.T) {
+    c, err := Encode("a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    svg := c.SVG(4)
+    if !bytes.HasPrefix(svg, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="116" height="116" viewBox="0 0 29 29"`)) {
+        t.Fatalf("unexpected SVG header: %.120s", svg)
+    }
+    if !bytes.HasSuffix(svg, []byte(`"/></svg>`)) || !bytes.Contains(svg, []byte("M4 4h1v1h-1z")) {
+        t.Fatalf("SVG is missing the top left finder module")
+    }
+}
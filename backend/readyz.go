@@ -0,0 +1,96 @@
+//-------------------------------------------------------
+// backend/readyz.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - GET /readyz: readiness for load balancers and operators,
+//     covering storage, the evidence log directory, and frontend
+//     asset verification (see assets.go).
+// Audit:
+//   - Public like /metrics; reveals no file contents or secrets.
+//   - 200 when ready, 503 otherwise, always with the check details.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "os"
+    "time"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/audit"
+    "cfo-scratchpad/handlers"
+)
+
+// readyzStorageTimeout bounds the storage probe.
+const readyzStorageTimeout = 2 * time.Second
+
+//-------------------------------------------------------
+// Struct: readyCheck
+//-------------------------------------------------------
+// Purpose:
+//   - Outcome of one readiness check.
+//-------------------------------------------------------
+type readyCheck struct {
+    OK    bool   `json:"ok"`
+    Error string `json:"error,omitempty"`
+}
+
+//-------------------------------------------------------
+// Function: handleReadyz
+//-------------------------------------------------------
+// Purpose:
+//   - Run the readiness checks and report them.
+// Audit:
+//   - Tampered or unverified assets make the instance unready only
+//     in enforce mode; in warn mode they are reported but tolerated.
+//-------------------------------------------------------
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+
+    storage := checkStorage(r.Context(), readyzStorageTimeout)
+    evidence := checkEvidenceDir()
+
+    assets := currentAssetReport()
+    assetsOK := assets.Status == assetsVerified || assets.Status == assetsDisabled || assets.Mode != "enforce"
+
+    ready := storage.OK && evidence.OK && assetsOK
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    if !ready {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "ready":    ready,
+        "storage":  storage,
+        "evidence": evidence,
+        "assets":   assets,
+    })
+}
+
+// checkStorage probes the scratch root within timeout.
+func checkStorage(ctx context.Context, timeout time.Duration) readyCheck {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    if err := handlers.CheckStorage(ctx); err != nil {
+        return readyCheck{OK: false, Error: err.Error()}
+    }
+    return readyCheck{OK: true}
+}
+
+// checkEvidenceDir confirms the evidence log directory is present.
+func checkEvidenceDir() readyCheck {
+    info, err := os.Stat(audit.LogDir)
+    if err != nil {
+        return readyCheck{OK: false, Error: err.Error()}
+    }
+    if !info.IsDir() {
+        return readyCheck{OK: false, Error: audit.LogDir + " is not a directory"}
+    }
+    return readyCheck{OK: true}
+}
@@ -0,0 +1,219 @@
+//-------------------------------------------------------
+// backend/schedule/cron.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Cron-style schedules ("0 7 * * MON") for background tasks
+//     such as recurring notes.
+// Audit:
+//   - Five fields: minute, hour, day of month, month, day of week.
+//     Each takes *, numbers, ranges (1-5), lists (1,15) and steps
+//     (*/15, 1-10/2); months and weekdays also take names (JAN,
+//     MON). Day of week 0 and 7 are both Sunday.
+//   - As in cron, when both day fields are restricted (not
+//     starting with *) a time matches if either one does.
+//   - @hourly, @daily, @weekly, @monthly and @yearly are accepted.
+//   - Times are evaluated in the location of the time passed in.
+//-------------------------------------------------------
+
+package schedule
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// maxSearch bounds Next for schedules that never match (e.g. Feb 30).
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// macros are the accepted @ shorthands.
+var macros = map[string]string{
+    "@hourly":  "0 * * * *",
+    "@daily":   "0 0 * * *",
+    "@weekly":  "0 0 * * 0",
+    "@monthly": "0 0 1 * *",
+    "@yearly":  "0 0 1 1 *",
+}
+
+var (
+    monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+    dayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+//-------------------------------------------------------
+// Struct: Schedule
+//-------------------------------------------------------
+// Purpose:
+//   - A parsed cron expression: the allowed values of each field.
+//-------------------------------------------------------
+type Schedule struct {
+    spec   string
+    minute [60]bool
+    hour   [24]bool
+    dom    [32]bool
+    month  [13]bool
+    dow    [7]bool
+    anyDom bool
+    anyDow bool
+}
+
+// field describes one cron field's range and names.
+type field struct {
+    name  string
+    min   int
+    max   int
+    names []string
+    base  int
+}
+
+//-------------------------------------------------------
+// Function: Parse
+//-------------------------------------------------------
+// Purpose:
+//   - Parse a cron expression or @ macro.
+// Audit:
+//   - Errors name the offending field.
+//-------------------------------------------------------
+func Parse(spec string) (*Schedule, error) {
+    expr := strings.TrimSpace(spec)
+    if macro, ok := macros[strings.ToLower(expr)]; ok {
+        expr = macro
+    }
+    parts := strings.Fields(expr)
+    if len(parts) != 5 {
+        return nil, fmt.Errorf("want 5 fields (minute hour day month weekday), got %d", len(parts))
+    }
+
+    s := &Schedule{spec: spec, anyDom: strings.HasPrefix(parts[2], "*"), anyDow: strings.HasPrefix(parts[4], "*")}
+    fields := []struct {
+        f   field
+        set []bool
+    }{
+        {field{name: "minute", min: 0, max: 59}, s.minute[:]},
+        {field{name: "hour", min: 0, max: 23}, s.hour[:]},
+        {field{name: "day of month", min: 1, max: 31}, s.dom[:]},
+        {field{name: "month", min: 1, max: 12, names: monthNames, base: 1}, s.month[:]},
+        {field{name: "day of week", min: 0, max: 7, names: dayNames, base: 0}, nil},
+    }
+    var dow [8]bool
+    fields[4].set = dow[:]
+    for i, part := range parts {
+        if err := parseField(part, fields[i].f, fields[i].set); err != nil {
+            return nil, err
+        }
+    }
+    copy(s.dow[:], dow[:7])
+    if dow[7] {
+        s.dow[0] = true
+    }
+    return s, nil
+}
+
+// parseField sets set[v] for every value part allows.
+func parseField(part string, f field, set []bool) error {
+    for _, item := range strings.Split(part, ",") {
+        rangePart, step := item, 1
+        if i := strings.Index(item, "/"); i >= 0 {
+            n, err := strconv.Atoi(item[i+1:])
+            if err != nil || n < 1 {
+                return fmt.Errorf("%s: invalid step in %q", f.name, item)
+            }
+            rangePart, step = item[:i], n
+        }
+        lo, hi := f.min, f.max
+        if rangePart != "*" {
+            bounds := strings.SplitN(rangePart, "-", 2)
+            var err error
+            if lo, err = fieldValue(bounds[0], f); err != nil {
+                return err
+            }
+            hi = lo
+            if len(bounds) == 2 {
+                if hi, err = fieldValue(bounds[1], f); err != nil {
+                    return err
+                }
+            } else if step > 1 {
+                hi = f.max
+            }
+            if hi < lo {
+                return fmt.Errorf("%s: range %q runs backwards", f.name, rangePart)
+            }
+        }
+        for v := lo; v <= hi; v += step {
+            set[v] = true
+        }
+    }
+    return nil
+}
+
+// fieldValue parses one number or name of a field.
+func fieldValue(text string, f field) (int, error) {
+    for i, name := range f.names {
+        if strings.EqualFold(text, name) {
+            return i + f.base, nil
+        }
+    }
+    n, err := strconv.Atoi(text)
+    if err != nil || n < f.min || n > f.max {
+        return 0, fmt.Errorf("%s: %q is not between %d and %d", f.name, text, f.min, f.max)
+    }
+    return n, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+    return s.spec
+}
+
+// dayMatches applies cron's day-of-month / day-of-week rule.
+func (s *Schedule) dayMatches(t time.Time) bool {
+    dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+    switch {
+    case s.anyDom && s.anyDow:
+        return true
+    case s.anyDom:
+        return dow
+    case s.anyDow:
+        return dom
+    }
+    return dom || dow
+}
+
+//-------------------------------------------------------
+// Function: (*Schedule) Matches
+//-------------------------------------------------------
+// Purpose:
+//   - Whether the minute containing t is scheduled.
+//-------------------------------------------------------
+func (s *Schedule) Matches(t time.Time) bool {
+    return s.minute[t.Minute()] && s.hour[t.Hour()] && s.month[t.Month()] && s.dayMatches(t)
+}
+
+//-------------------------------------------------------
+// Function: (*Schedule) Next
+//-------------------------------------------------------
+// Purpose:
+//   - The first scheduled minute strictly after t.
+// Audit:
+//   - Returns the zero time if nothing matches within five years.
+//-------------------------------------------------------
+func (s *Schedule) Next(t time.Time) time.Time {
+    t = t.Truncate(time.Minute).Add(time.Minute)
+    limit := t.Add(maxSearch)
+    for t.Before(limit) {
+        switch {
+        case !s.month[t.Month()]:
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+        case !s.dayMatches(t):
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+        case !s.hour[t.Hour()]:
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+        case !s.minute[t.Minute()]:
+            t = t.Add(time.Minute)
+        default:
+            return t
+        }
+    }
+    return time.Time{}
+}
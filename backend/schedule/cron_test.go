@@ -0,0 +1,100 @@
+//-------------------------------------------------------
+// backend/schedule/cron_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for cron expression parsing, matching and Next.
+//-------------------------------------------------------
+
+package schedule
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseRejects(t *testing.T) {
+    for _, tc := range []struct {
+        spec, field string
+    }{
+        {"* * * *", "5 fields"},
+        {"60 * * * *", "minute"},
+        {"* 24 * * *", "hour"},
+        {"* * 0 * *", "day of month"},
+        {"* * * 13 *", "month"},
+        {"* * * * 8", "day of week"},
+        {"*/0 * * * *", "step"},
+        {"5-1 * * * *", "backwards"},
+        {"* * * FOO *", "month"},
+        {"0 18 L * *", "day of month"},
+    } {
+        _, err := Parse(tc.spec)
+        if err == nil || !strings.Contains(err.Error(), tc.field) {
+            t.Errorf("Parse(%q) = %v, want an error mentioning %q", tc.spec, err, tc.field)
+        }
+    }
+}
+
+func TestNext(t *testing.T) {
+    // Monday 2026-03-02 09:30 UTC.
+    from := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+    for _, tc := range []struct {
+        spec string
+        want time.Time
+    }{
+        {"* * * * *", time.Date(2026, 3, 2, 9, 31, 0, 0, time.UTC)},
+        {"*/15 * * * *", time.Date(2026, 3, 2, 9, 45, 0, 0, time.UTC)},
+        {"0 7 * * MON", time.Date(2026, 3, 9, 7, 0, 0, 0, time.UTC)},
+        {"0 7 * * mon-fri", time.Date(2026, 3, 3, 7, 0, 0, 0, time.UTC)},
+        {"30 9 * * *", time.Date(2026, 3, 3, 9, 30, 0, 0, time.UTC)},
+        {"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+        {"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+        {"@hourly", time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)},
+        {"0 12 * * 7", time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+        {"0 12 * * 0", time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+        {"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+        {"0 0 31 FEB *", time.Time{}},
+        {"0 9 1,15 * *", time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC)},
+        {"0 8 1-10/3 * *", time.Date(2026, 3, 4, 8, 0, 0, 0, time.UTC)},
+        // Both day fields restricted: either one matches (the 13th or a Friday).
+        {"0 0 13 * FRI", time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+    } {
+        s, err := Parse(tc.spec)
+        if err != nil {
+            t.Errorf("Parse(%q): %v", tc.spec, err)
+            continue
+        }
+        if got := s.Next(from); !got.Equal(tc.want) {
+            t.Errorf("%q.Next(%s) = %s, want %s", tc.spec, from.Format(time.RFC3339), got.Format(time.RFC3339), tc.want.Format(time.RFC3339))
+        }
+    }
+}
+
+func TestNextIsStrictlyAfterAndMatches(t *testing.T) {
+    s, err := Parse("0 7 * * MON")
+    if err != nil {
+        t.Fatal(err)
+    }
+    at := time.Date(2026, 3, 9, 7, 0, 0, 0, time.UTC)
+    if !s.Matches(at) {
+        t.Fatalf("Matches(%s) = false", at)
+    }
+    if got := s.Next(at); !got.Equal(at.AddDate(0, 0, 7)) {
+        t.Fatalf("Next(%s) = %s, want a week later", at, got)
+    }
+    if got := s.Next(at.Add(-time.Second)); !got.Equal(at) {
+        t.Fatalf("Next just before = %s, want %s", got, at)
+    }
+}
+
+func TestNextUsesLocation(t *testing.T) {
+    zone := time.FixedZone("UTC+2", 2*60*60)
+    s, err := Parse("0 7 * * *")
+    if err != nil {
+        t.Fatal(err)
+    }
+    from := time.Date(2026, 3, 2, 6, 0, 0, 0, zone)
+    if got := s.Next(from); !got.Equal(time.Date(2026, 3, 2, 5, 0, 0, 0, time.UTC)) {
+        t.Fatalf("Next in UTC+2 = %s, want 07:00 local", got)
+    }
+}
@@ -0,0 +1,59 @@
+//-------------------------------------------------------
+// backend/systemd_test.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Tests for the watchdog's loopback /readyz probe.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestReadyzProbeFollowsServer(t *testing.T) {
+    ready := true
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/readyz" {
+            http.NotFound(w, r)
+            return
+        }
+        if !ready {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            w.Write([]byte(`{"ready":false,"storage":{"ok":false,"error":"disk stalled"},"evidence":{"ok":true}}`))
+            return
+        }
+        w.Write([]byte(`{"ready":true}`))
+    }))
+    defer srv.Close()
+
+    client, url := readyzProbe(srv.Listener.Addr(), false, time.Second)
+    if err := probeReadyz(client, url); err != nil {
+        t.Fatalf("healthy server: %v", err)
+    }
+    ready = false
+    err := probeReadyz(client, url)
+    if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "storage: disk stalled") {
+        t.Fatalf("unready server: %v", err)
+    }
+    srv.Close()
+    if err := probeReadyz(client, url); err == nil {
+        t.Fatalf("closed server: no error")
+    }
+}
+
+func TestReadyzProbeWildcardUsesLoopback(t *testing.T) {
+    _, url := readyzProbe(&net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false, time.Second)
+    if url != "http://127.0.0.1:8080/readyz" {
+        t.Fatalf("IPv4 wildcard: %s", url)
+    }
+    _, url = readyzProbe(&net.TCPAddr{IP: net.IPv6unspecified, Port: 8443}, true, time.Second)
+    if url != "https://[::1]:8443/readyz" {
+        t.Fatalf("IPv6 wildcard: %s", url)
+    }
+}
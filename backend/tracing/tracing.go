@@ -0,0 +1,515 @@
+//-------------------------------------------------------
+// backend/tracing/tracing.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - Minimal OpenTelemetry-compatible tracing without external
+//     libraries: spans carry W3C trace context through
+//     context.Context and are exported in batches over OTLP/HTTP
+//     (JSON encoding) to a collector.
+//   - Used for HTTP requests (server spans), storage calls, and the
+//     audit writer, so latency can be attributed to disk vs. handler
+//     logic.
+// Audit:
+//   - Off until Configure is called with Enabled; every function is
+//     then a cheap no-op and methods on a nil *Span do nothing.
+//   - Export never blocks a request: finished spans go to a bounded
+//     queue and are dropped (and counted) when it is full or the
+//     collector is unreachable.
+//   - Spans carry only what callers set; no request bodies, query
+//     strings or credentials are recorded here.
+//-------------------------------------------------------
+
+package tracing
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/binary"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Span kinds (OTLP SpanKind values).
+const (
+    KindInternal = 1
+    KindServer   = 2
+)
+
+const (
+    queueSize      = 2048
+    maxBatch       = 512
+    exportInterval = 5 * time.Second
+    exportTimeout  = 10 * time.Second
+    scopeName      = "cfo-scratchpad"
+)
+
+//-------------------------------------------------------
+// Struct: Settings
+//-------------------------------------------------------
+// Purpose:
+//   - Exporter settings, taken from the "tracing" configuration.
+// Audit:
+//   - Endpoint is the collector base URL (OTLP/HTTP, usually port
+//     4318); "/v1/traces" is appended unless already present.
+//   - SampleRatio picks that share of new traces (0-1); requests
+//     with a traceparent header follow the caller's decision.
+//   - Headers are sent with every export (e.g. an API key).
+//-------------------------------------------------------
+type Settings struct {
+    Enabled        bool
+    Endpoint       string
+    ServiceName    string
+    ServiceVersion string
+    SampleRatio    float64
+    Headers        map[string]string
+}
+
+//-------------------------------------------------------
+// Struct: Stats
+//-------------------------------------------------------
+// Purpose:
+//   - Exporter counters since start.
+//-------------------------------------------------------
+type Stats struct {
+    Enabled  bool   `json:"enabled"`
+    Exported uint64 `json:"exported"`
+    Dropped  uint64 `json:"dropped"`
+    Failed   uint64 `json:"failed_exports"`
+}
+
+// exporter holds the queue and settings of an enabled tracer.
+type exporter struct {
+    settings Settings
+    url      string
+    queue    chan *Span
+    client   *http.Client
+    exported uint64
+    dropped  uint64
+    failed   uint64
+    failing  int32
+}
+
+// active is the *exporter in use, or nil while tracing is off.
+var active atomic.Value
+
+// spanKey is the context key of the current *Span.
+type spanKey struct{}
+
+//-------------------------------------------------------
+// Struct: Span
+//-------------------------------------------------------
+// Purpose:
+//   - One timed operation. Created by Start, finished by End.
+// Audit:
+//   - A nil *Span (tracing off) accepts every call and does nothing.
+//   - Unsampled spans still propagate their trace ID to children but
+//     are never exported.
+//-------------------------------------------------------
+type Span struct {
+    mu       sync.Mutex
+    exporter *exporter
+    traceID  [16]byte
+    spanID   [8]byte
+    parentID [8]byte
+    name     string
+    kind     int
+    start    time.Time
+    end      time.Time
+    attrs    []attribute
+    status   int
+    message  string
+    sampled  bool
+    remote   bool
+    ended    bool
+}
+
+type attribute struct {
+    Key   string                 `json:"key"`
+    Value map[string]interface{} `json:"value"`
+}
+
+//-------------------------------------------------------
+// Function: Configure
+//-------------------------------------------------------
+// Purpose:
+//   - Turn tracing on with settings, or leave it off.
+// Audit:
+//   - Call once at startup; the export loop runs for the life of the
+//     process.
+//-------------------------------------------------------
+func Configure(settings Settings) error {
+    if !settings.Enabled {
+        return nil
+    }
+    endpoint, err := TracesURL(settings.Endpoint)
+    if err != nil {
+        return err
+    }
+    e := &exporter{
+        settings: settings,
+        url:      endpoint,
+        queue:    make(chan *Span, queueSize),
+        client:   &http.Client{Timeout: exportTimeout},
+    }
+    go e.run()
+    active.Store(e)
+    return nil
+}
+
+//-------------------------------------------------------
+// Function: TracesURL
+//-------------------------------------------------------
+// Purpose:
+//   - The OTLP/HTTP traces URL for a collector endpoint.
+//-------------------------------------------------------
+func TracesURL(endpoint string) (string, error) {
+    u, err := url.Parse(endpoint)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return "", fmt.Errorf("endpoint %q: need an http(s) URL", endpoint)
+    }
+    if !strings.HasSuffix(u.Path, "/v1/traces") {
+        u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+    }
+    return u.String(), nil
+}
+
+// current returns the active exporter, or nil while tracing is off.
+func current() *exporter {
+    e, _ := active.Load().(*exporter)
+    return e
+}
+
+// Enabled reports whether spans are being recorded.
+func Enabled() bool {
+    return current() != nil
+}
+
+//-------------------------------------------------------
+// Function: CurrentStats
+//-------------------------------------------------------
+// Purpose:
+//   - Exporter counters, for diagnostics.
+//-------------------------------------------------------
+func CurrentStats() Stats {
+    e := current()
+    if e == nil {
+        return Stats{}
+    }
+    return Stats{
+        Enabled:  true,
+        Exported: atomic.LoadUint64(&e.exported),
+        Dropped:  atomic.LoadUint64(&e.dropped),
+        Failed:   atomic.LoadUint64(&e.failed),
+    }
+}
+
+//-------------------------------------------------------
+// Function: Start
+//-------------------------------------------------------
+// Purpose:
+//   - Begin a span named name as a child of the span in ctx (or a
+//     new trace), returning ctx carrying the new span.
+// Audit:
+//   - Returns ctx unchanged and a nil span while tracing is off.
+//-------------------------------------------------------
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+    e := current()
+    if e == nil {
+        return ctx, nil
+    }
+    span := &Span{exporter: e, name: name, kind: kind, start: time.Now()}
+    if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+        span.traceID = parent.traceID
+        span.parentID = parent.spanID
+        span.sampled = parent.sampled
+    } else {
+        rand.Read(span.traceID[:])
+        span.sampled = sampled(span.traceID, e.settings.SampleRatio)
+    }
+    rand.Read(span.spanID[:])
+    return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sampled makes the ratio decision from the trace ID, so every
+// instance decides the same way for one trace.
+func sampled(traceID [16]byte, ratio float64) bool {
+    switch {
+    case ratio >= 1:
+        return true
+    case ratio <= 0:
+        return false
+    }
+    return binary.BigEndian.Uint64(traceID[8:])>>1 < uint64(ratio*(1<<63))
+}
+
+//-------------------------------------------------------
+// Function: Extract
+//-------------------------------------------------------
+// Purpose:
+//   - ctx continuing the trace of a W3C traceparent header
+//     ("00-<trace-id>-<parent-id>-<flags>"), so spans join the
+//     caller's trace.
+// Audit:
+//   - A missing or malformed header leaves ctx unchanged.
+//-------------------------------------------------------
+func Extract(ctx context.Context, traceparent string) context.Context {
+    if current() == nil || traceparent == "" {
+        return ctx
+    }
+    parts := strings.Split(strings.TrimSpace(traceparent), "-")
+    if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+        return ctx
+    }
+    remote := &Span{remote: true}
+    if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil || remote.traceID == [16]byte{} {
+        return ctx
+    }
+    if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil || remote.spanID == [8]byte{} {
+        return ctx
+    }
+    flags, err := strconv.ParseUint(parts[3], 16, 8)
+    if err != nil {
+        return ctx
+    }
+    remote.sampled = flags&1 == 1
+    return context.WithValue(ctx, spanKey{}, remote)
+}
+
+//-------------------------------------------------------
+// Function: FromContext
+//-------------------------------------------------------
+// Purpose:
+//   - The local span carried by ctx, or nil.
+//-------------------------------------------------------
+func FromContext(ctx context.Context) *Span {
+    span, ok := ctx.Value(spanKey{}).(*Span)
+    if !ok || span.remote {
+        return nil
+    }
+    return span
+}
+
+// TraceID is the span's trace ID in hex, or "" for a nil span.
+func (s *Span) TraceID() string {
+    if s == nil {
+        return ""
+    }
+    return hex.EncodeToString(s.traceID[:])
+}
+
+// SetName renames the span (e.g. once the route is known).
+func (s *Span) SetName(name string) {
+    if s == nil {
+        return
+    }
+    s.mu.Lock()
+    s.name = name
+    s.mu.Unlock()
+}
+
+//-------------------------------------------------------
+// Function: (*Span) SetAttr
+//-------------------------------------------------------
+// Purpose:
+//   - Record a string, bool, integer or float attribute.
+// Audit:
+//   - Other types are recorded as their fmt %v text.
+//-------------------------------------------------------
+func (s *Span) SetAttr(key string, value interface{}) {
+    if s == nil {
+        return
+    }
+    var v map[string]interface{}
+    switch x := value.(type) {
+    case string:
+        v = map[string]interface{}{"stringValue": x}
+    case bool:
+        v = map[string]interface{}{"boolValue": x}
+    case int:
+        v = map[string]interface{}{"intValue": strconv.Itoa(x)}
+    case int64:
+        v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+    case float64:
+        v = map[string]interface{}{"doubleValue": x}
+    default:
+        v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+    }
+    s.mu.Lock()
+    s.attrs = append(s.attrs, attribute{Key: key, Value: v})
+    s.mu.Unlock()
+}
+
+// SetError marks the span failed with err; nil err does nothing.
+func (s *Span) SetError(err error) {
+    if s == nil || err == nil {
+        return
+    }
+    s.mu.Lock()
+    s.status = 2
+    s.message = err.Error()
+    s.mu.Unlock()
+}
+
+//-------------------------------------------------------
+// Function: (*Span) End
+//-------------------------------------------------------
+// Purpose:
+//   - Finish the span and queue it for export if sampled.
+// Audit:
+//   - Only the first call counts. A full queue drops the span.
+//-------------------------------------------------------
+func (s *Span) End() {
+    if s == nil {
+        return
+    }
+    s.mu.Lock()
+    if s.ended {
+        s.mu.Unlock()
+        return
+    }
+    s.ended = true
+    s.end = time.Now()
+    s.mu.Unlock()
+    if !s.sampled {
+        return
+    }
+    select {
+    case s.exporter.queue <- s:
+    default:
+        atomic.AddUint64(&s.exporter.dropped, 1)
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*exporter) run
+//-------------------------------------------------------
+// Purpose:
+//   - Export queued spans in batches of up to maxBatch, at least
+//     every exportInterval.
+//-------------------------------------------------------
+func (e *exporter) run() {
+    ticker := time.NewTicker(exportInterval)
+    defer ticker.Stop()
+    batch := make([]*Span, 0, maxBatch)
+    for {
+        select {
+        case span := <-e.queue:
+            batch = append(batch, span)
+            if len(batch) < maxBatch {
+                continue
+            }
+        case <-ticker.C:
+            if len(batch) == 0 {
+                continue
+            }
+        }
+        e.export(batch)
+        batch = make([]*Span, 0, maxBatch)
+    }
+}
+
+//-------------------------------------------------------
+// Function: (*exporter) export
+//-------------------------------------------------------
+// Purpose:
+//   - POST one batch as an OTLP ExportTraceServiceRequest (JSON).
+// Audit:
+//   - A failed export drops the batch. The first failure and the
+//     recovery are logged, not every attempt in between.
+//-------------------------------------------------------
+func (e *exporter) export(batch []*Span) {
+    body, err := json.Marshal(e.request(batch))
+    if err == nil {
+        err = e.post(body)
+    }
+    if err != nil {
+        atomic.AddUint64(&e.failed, 1)
+        atomic.AddUint64(&e.dropped, uint64(len(batch)))
+        if atomic.CompareAndSwapInt32(&e.failing, 0, 1) {
+            log.Printf("[WARN] %s trace export to %s failed: %v (dropping spans until it recovers)",
+                time.Now().UTC().Format(time.RFC3339), e.url, err)
+        }
+        return
+    }
+    atomic.AddUint64(&e.exported, uint64(len(batch)))
+    if atomic.CompareAndSwapInt32(&e.failing, 1, 0) {
+        log.Printf("[INFO] %s trace export to %s recovered",
+            time.Now().UTC().Format(time.RFC3339), e.url)
+    }
+}
+
+func (e *exporter) post(body []byte) error {
+    ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    for name, value := range e.settings.Headers {
+        req.Header.Set(name, value)
+    }
+    resp, err := e.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("collector answered %s", resp.Status)
+    }
+    return nil
+}
+
+// request builds the OTLP/JSON document for batch: IDs in hex,
+// 64-bit integers as strings, as the OTLP JSON mapping requires.
+func (e *exporter) request(batch []*Span) map[string]interface{} {
+    spans := make([]map[string]interface{}, 0, len(batch))
+    for _, s := range batch {
+        s.mu.Lock()
+        attrs := s.attrs
+        if attrs == nil {
+            attrs = []attribute{}
+        }
+        span := map[string]interface{}{
+            "traceId":           hex.EncodeToString(s.traceID[:]),
+            "spanId":            hex.EncodeToString(s.spanID[:]),
+            "name":              s.name,
+            "kind":              s.kind,
+            "startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+            "endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+            "attributes":        attrs,
+            "status":            map[string]interface{}{"code": s.status, "message": s.message},
+        }
+        if s.parentID != [8]byte{} {
+            span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+        }
+        s.mu.Unlock()
+        spans = append(spans, span)
+    }
+    resource := []attribute{
+        {Key: "service.name", Value: map[string]interface{}{"stringValue": e.settings.ServiceName}},
+        {Key: "service.version", Value: map[string]interface{}{"stringValue": e.settings.ServiceVersion}},
+    }
+    return map[string]interface{}{
+        "resourceSpans": []interface{}{map[string]interface{}{
+            "resource": map[string]interface{}{"attributes": resource},
+            "scopeSpans": []interface{}{map[string]interface{}{
+                "scope": map[string]interface{}{"name": scopeName, "version": e.settings.ServiceVersion},
+                "spans": spans,
+            }},
+        }},
+    }
+}
@@ -0,0 +1,38 @@
+//-------------------------------------------------------
+// backend/version.go
+//-------------------------------------------------------
+// Purpose Summary:
+//   - GET /version: build identity of the running binary (see
+//     buildinfo package), so evidence can be tied to an exact build.
+// Audit:
+//   - Public like /metrics; exposes no configuration or secrets.
+//-------------------------------------------------------
+
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "cfo-scratchpad/apierror"
+    "cfo-scratchpad/buildinfo"
+)
+
+//-------------------------------------------------------
+// Function: handleVersion
+//-------------------------------------------------------
+// Purpose:
+//   - Serve buildinfo.Get() plus the compact version string that
+//     appears in audit events.
+//-------------------------------------------------------
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        apierror.Write(w, r, apierror.CodeMethodNotAllowed, "", "Method not allowed")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(struct {
+        buildinfo.Info
+        AuditVersion string `json:"audit_version"`
+    }{buildinfo.Get(), buildinfo.String()})
+}
@@ -60,6 +60,11 @@ else
     exit 1
 fi
 
+# Backups written by POST /admin/backup
+if [ -d /backups ] && ! chown appuser:appuser /backups 2>/dev/null; then
+    log_error "chown failed on /backups; /admin/backup will fail"
+fi
+
 # -------------------------------------------------------
 # Step 3: Start cron for daily evidence rotation
 # -------------------------------------------------------
@@ -6,6 +6,8 @@
 //   - Adds "+ New File" button with safe creation flow.
 //   - Restricts to 10 open tabs. Logs all user actions.
 //   - Adds global search, file rename/delete, keyboard shortcuts.
+//   - All requests go through apiFetch, which adds the CSRF token
+//     required with a session cookie.
 // Audit:
 //   - All actions log to console with UTC ISO 8601.
 //   - All backend requests validated; hard-fail on non-2xx.
@@ -15,6 +17,8 @@
 const MAX_TABS = 10;
 // const API_BASE = "http://localhost:8888";
 const API_BASE = "";
+const CSRF_COOKIE = "scratchpad_csrf";
+const CSRF_HEADER = "X-CSRF-Token";
 
 let activeFolder = null;
 const tabs = {};
@@ -50,15 +54,45 @@ function log(level, msg) {
 // Purpose:
 //   - Enforce HTTP 2xx status before parsing responses.
 // Audit:
-//   - Throws with explicit HTTP status; callers must catch.
+//   - Throws with explicit HTTP status, plus the API error code,
+//     message, and request id when present; callers must catch.
 // -------------------------------------------------------
-function requireOk(res) {
+async function requireOk(res) {
     if (!res.ok) {
-        throw new Error(`HTTP ${res.status}`);
+        let detail = "";
+        try {
+            const body = await res.json();
+            detail = ` ${body.code}: ${body.message} (request ${body.request_id})`;
+        } catch (err) {
+            // Not a structured error body (e.g. static file 404).
+        }
+        throw new Error(`HTTP ${res.status}${detail}`);
     }
     return res;
 }
 
+// -------------------------------------------------------
+// function apiFetch(url, options)
+// -------------------------------------------------------
+// Purpose:
+//   - fetch() for API calls: echoes the CSRF cookie in the
+//     X-CSRF-Token header on every request that is not GET/HEAD.
+// Audit:
+//   - The backend refuses cookie-authenticated changes without it;
+//     bearer-token clients are unaffected.
+// -------------------------------------------------------
+function apiFetch(url, options = {}) {
+    const method = (options.method || "GET").toUpperCase();
+    if (method !== "GET" && method !== "HEAD") {
+        const match = document.cookie.match(new RegExp(`(?:^|; )${CSRF_COOKIE}=([^;]*)`));
+        if (match) {
+            options.headers = Object.assign({}, options.headers, { [CSRF_HEADER]: decodeURIComponent(match[1]) });
+        }
+    }
+    options.credentials = "same-origin";
+    return fetch(url, options);
+}
+
 // -------------------------------------------------------
 // function asArray(x)
 // -------------------------------------------------------
@@ -95,7 +129,7 @@ document.addEventListener("DOMContentLoaded", () => {
     document.getElementById("new-folder-btn").addEventListener("click", () => {
         const name = prompt("New folder name:");
         if (!name) return;
-        fetch(`${API_BASE}/folders`, {
+        apiFetch(`${API_BASE}/folders`, {
             method: "POST",
             headers: { "Content-Type": "application/json" },
             body: JSON.stringify({ name })
@@ -143,6 +177,11 @@ document.addEventListener("DOMContentLoaded", () => {
                 switchTab(keys[nextIdx]);
             }
         }
+
+        if (event.key === "F2" && !event.ctrlKey && !event.altKey) {
+            event.preventDefault();
+            renameBatch();
+        }
     });
 });
 
@@ -151,11 +190,14 @@ document.addEventListener("DOMContentLoaded", () => {
 // -------------------------------------------------------
 // Purpose:
 //   - Loads folder tree and populates sidebar.
+//   - Folder descriptions, colors and icons (PUT /folders/meta) are
+//     shown on the folder's summary line and inside it when opened.
 // Audit:
 //   - Validates response; initializes UI state safely.
+//   - Descriptions are user text: set via textContent only.
 // -------------------------------------------------------
 function loadFolders() {
-    fetch(`${API_BASE}/folders`)
+    apiFetch(`${API_BASE}/folders?include=meta`)
         .then(requireOk)
         .then(res => res.json())
         .then(folders => {
@@ -163,14 +205,35 @@ function loadFolders() {
             const list = document.getElementById("folder-list");
             list.innerHTML = "";
 
-            folders.forEach(folder => {
+            folders.forEach(entry => {
+                const folder = typeof entry === "string" ? entry : entry.path;
                 const details = document.createElement("details");
                 details.className = "folder";
 
                 const summary = document.createElement("summary");
-                summary.textContent = folder;
+                if (entry.icon) {
+                    const icon = document.createElement("span");
+                    icon.className = "folder-icon";
+                    icon.textContent = entry.icon;
+                    summary.appendChild(icon);
+                }
+                summary.appendChild(document.createTextNode(folder));
+                if (entry.color) {
+                    summary.style.borderLeftColor = entry.color;
+                    summary.classList.add("folder-colored");
+                }
+                if (entry.description) {
+                    summary.title = entry.description;
+                }
                 details.appendChild(summary);
 
+                if (entry.description) {
+                    const description = document.createElement("p");
+                    description.className = "folder-description";
+                    description.textContent = entry.description;
+                    details.appendChild(description);
+                }
+
                 const filesUl = document.createElement("ul");
                 filesUl.className = "file-list";
                 details.appendChild(filesUl);
@@ -203,7 +266,7 @@ function loadFilesInto(detailsEl, folder) {
     const filesUl = detailsEl.querySelector(".file-list");
     filesUl.innerHTML = "<li>(Loading...)</li>";
 
-    fetch(`${API_BASE}/files?folder=${encodeURIComponent(folder)}`)
+    apiFetch(`${API_BASE}/files?folder=${encodeURIComponent(folder)}`)
         .then(requireOk)
         .then(res => res.json())
         .then(files => {
@@ -249,7 +312,7 @@ function loadFiles(folder) {
     activeFolder = folder;
     document.getElementById("new-file-btn").style.display = "inline-block";
 
-    fetch(`${API_BASE}/files?folder=${encodeURIComponent(folder)}`)
+    apiFetch(`${API_BASE}/files?folder=${encodeURIComponent(folder)}`)
         .then(requireOk)
         .then(res => res.json())
         .then(files => {
@@ -288,7 +351,7 @@ function createNewFile() {
     let baseName = prompt("Base file name (without extension):", "notes");
     if (!baseName) return;
 
-    fetch(`${API_BASE}/files?folder=${encodeURIComponent(activeFolder)}`)
+    apiFetch(`${API_BASE}/files?folder=${encodeURIComponent(activeFolder)}`)
         .then(requireOk)
         .then(res => res.json())
         .then(files => {
@@ -302,7 +365,7 @@ function createNewFile() {
             } while (files.includes(finalName));
 
             const path = `${activeFolder}/${finalName}`;
-            fetch(`${API_BASE}/file/save`, {
+            apiFetch(`${API_BASE}/file/save`, {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify({ path, content: "" })
@@ -342,7 +405,7 @@ function openFile(path) {
         return;
     }
 
-    fetch(`${API_BASE}/file?path=${encodeURIComponent(path)}`)
+    apiFetch(`${API_BASE}/file?path=${encodeURIComponent(path)}`)
         .then(requireOk)
         .then(res => res.text())
         .then(content => {
@@ -391,11 +454,51 @@ function renderTab(path, content) {
     const textarea = document.createElement("textarea");
     textarea.value = content;
     textarea.style.display = "none";
+    textarea.addEventListener("paste", event => pasteImage(path, textarea, event));
     document.getElementById("editor-area").appendChild(textarea);
 
     log("DEBUG", "Rendered tab and editor for: " + path);
 }
 
+// -------------------------------------------------------
+// function pasteImage(path, textarea, event)
+// -------------------------------------------------------
+// Purpose:
+//   - Pasting an image (a screenshot) into the editor stores it as
+//     an attachment (POST /file/paste-image) and inserts the
+//     returned Markdown link at the cursor.
+// Audit:
+//   - Text pastes are left to the browser. The note is not saved
+//     here: Ctrl+S saves the inserted link as usual.
+// -------------------------------------------------------
+function pasteImage(path, textarea, event) {
+    const items = Array.from((event.clipboardData || {}).items || []);
+    const item = items.find(i => i.kind === "file" && i.type.startsWith("image/"));
+    if (!item) return;
+    event.preventDefault();
+
+    const reader = new FileReader();
+    reader.onload = () => {
+        apiFetch(`${API_BASE}/file/paste-image`, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ path, data: reader.result })
+        })
+        .then(requireOk)
+        .then(res => res.json())
+        .then(body => {
+            const start = textarea.selectionStart;
+            textarea.setRangeText(body.markdown, start, textarea.selectionEnd, "end");
+            log("INFO", "Pasted image saved as: " + body.path);
+        })
+        .catch(err => {
+            log("ERROR", "Image paste failed: " + err.message);
+            alert("Failed to store pasted image");
+        });
+    };
+    reader.readAsDataURL(item.getAsFile());
+}
+
 // -------------------------------------------------------
 // function closeTab(path)
 // -------------------------------------------------------
@@ -457,7 +560,7 @@ function switchTab(path) {
 //   - Logs before/after snapshot (truncated) and save success.
 // -------------------------------------------------------
 function saveFile(path, content) {
-    fetch(`${API_BASE}/file/save`, {
+    apiFetch(`${API_BASE}/file/save`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ path, content })
@@ -487,7 +590,7 @@ function renameFile(oldPath) {
     if (!newName || newName === oldName) return;
 
     const newPath = `${base}/${newName}`;
-    fetch(`${API_BASE}/file/move`, {
+    apiFetch(`${API_BASE}/file/move`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ from: oldPath, to: newPath })
@@ -515,6 +618,63 @@ function renameFile(oldPath) {
     });
 }
 
+// -------------------------------------------------------
+// function renameBatch()
+// -------------------------------------------------------
+// Purpose:
+//   - Renames many notes of the active folder with one regex
+//     pattern (POST /files/rename-batch); "{n}" in the
+//     replacement numbers the notes.
+// Audit:
+//   - Always previews with a dry run first and applies with its
+//     plan token only after the user confirms the list.
+// -------------------------------------------------------
+function renameBatch() {
+    if (!activeFolder) {
+        alert("Select a folder first");
+        log("WARN", "Batch rename requested without active folder");
+        return;
+    }
+    const find = prompt("Rename notes in " + activeFolder + "\nFind (regular expression, name without extension):", "^");
+    if (!find) return;
+    const replace = prompt("Replace with ($1 for groups, {n} for a number):", "");
+    if (replace === null) return;
+
+    const request = { folder: activeFolder, mode: "regex", find, replace, sequence: { start: 1, step: 1, width: 2 } };
+    const send = body => apiFetch(`${API_BASE}/files/rename-batch`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body)
+    })
+    .then(requireOk)
+    .then(res => res.json());
+
+    send(request)
+        .then(preview => {
+            if (preview.renames.length === 0) {
+                alert("No notes would be renamed");
+                return;
+            }
+            const lines = preview.renames.slice(0, 20).map(item => item.from.split("/").pop() + " -> " + item.to.split("/").pop());
+            if (preview.renames.length > lines.length) {
+                lines.push(`... and ${preview.renames.length - lines.length} more`);
+            }
+            if (preview.skipped.length > 0) {
+                lines.push(`(${preview.skipped.length} skipped)`);
+            }
+            if (!confirm(`Rename ${preview.renames.length} notes?\n\n` + lines.join("\n"))) return;
+            return send(Object.assign({}, request, { dry_run: false, plan: preview.plan }))
+                .then(result => {
+                    log("INFO", `Renamed ${result.renames.length} notes in ${activeFolder}`);
+                    loadFolders();
+                });
+        })
+        .catch(err => {
+            log("ERROR", "Batch rename failed: " + err.message);
+            alert("Batch rename failed: " + err.message);
+        });
+}
+
 // -------------------------------------------------------
 // function deleteFile(path)
 // -------------------------------------------------------
@@ -527,7 +687,7 @@ function deleteFile(path) {
     const confirmDelete = confirm(`Delete file ${path}?`);
     if (!confirmDelete) return;
 
-    fetch(`${API_BASE}/file?path=${encodeURIComponent(path)}`, {
+    apiFetch(`${API_BASE}/file?path=${encodeURIComponent(path)}`, {
         method: "DELETE"
     })
     .then(requireOk)
@@ -556,46 +716,18 @@ function deleteFile(path) {
 // function searchFiles(query)
 // -------------------------------------------------------
 // Purpose:
-//   - Client-side full-text search across all files.
+//   - Case-insensitive full-text search across all files via /search.
 // Audit:
 //   - Validates responses; logs queries and result counts.
 // -------------------------------------------------------
 function searchFiles(query) {
-    fetch(`${API_BASE}/folders`)
+    apiFetch(`${API_BASE}/search?q=${encodeURIComponent(query)}&max_matches=1`)
         .then(requireOk)
         .then(res => res.json())
-        .then(folders => {
-            folders = asArray(folders);
-            const allPromises = folders.map(folder =>
-                fetch(`${API_BASE}/files?folder=${encodeURIComponent(folder)}`)
-                    .then(requireOk)
-                    .then(res => res.json())
-                    .then(files => ({ folder, files: asArray(files) }))
-            );
-
-            Promise.all(allPromises)
-                .then(fileGroups => {
-                    const fetches = [];
-                    fileGroups.forEach(group => {
-                        group.files.forEach(file => {
-                            const path = `${group.folder}/${file}`;
-                            fetches.push(
-                                fetch(`${API_BASE}/file?path=${encodeURIComponent(path)}`)
-                                    .then(requireOk)
-                                    .then(res => res.text())
-                                    .then(text => ({ path, content: text }))
-                            );
-                        });
-                    });
-
-                    Promise.all(fetches).then(allFiles => {
-                        const results = allFiles.filter(f =>
-                            f.content.toLowerCase().includes(query.toLowerCase())
-                        );
-                        showSearchResults(results, query);
-                        log("INFO", `Search '${query}' found ${results.length} result(s)`);
-                    });
-                });
+        .then(data => {
+            const results = asArray(data.files);
+            showSearchResults(results, query);
+            log("INFO", `Search '${query}' found ${results.length} result(s)`);
         })
         .catch(err => {
             log("ERROR", "Search failed: " + err.message);
@@ -0,0 +1,180 @@
+//go:build ignore
+
+// -------------------------------------------------------
+// tools/gen_nfc_table.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Generates backend/handlers/filename_nfc_table.go, the tables
+//     normalizeNFC uses, from the Unicode Character Database.
+// Audit:
+//   - Reads UnicodeData.txt (combining classes and canonical
+//     decompositions) and CompositionExclusions.txt; compatibility
+//     decompositions are ignored.
+//   - Decompositions are stored fully expanded; compositions are
+//     the canonical pairs minus the full composition exclusions
+//     (listed exclusions, singletons and non-starter
+//     decompositions). Hangul is algorithmic and not tabulated.
+// Usage:
+//   go run tools/gen_nfc_table.go -ucd <dir> -version 14.0.0 \
+//       > backend/handlers/filename_nfc_table.go
+// -------------------------------------------------------
+
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// -------------------------------------------------------
+// func readUCD(path, fn)
+// -------------------------------------------------------
+// Purpose:
+//   - Call fn with the semicolon-separated fields of every data
+//     line of a UCD file; comments and blank lines are skipped.
+// -------------------------------------------------------
+func readUCD(path string, fn func(fields []string)) {
+    f, err := os.Open(path)
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer f.Close()
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        line := scanner.Text()
+        if i := strings.IndexByte(line, '#'); i >= 0 {
+            line = line[:i]
+        }
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        fields := strings.Split(line, ";")
+        for i := range fields {
+            fields[i] = strings.TrimSpace(fields[i])
+        }
+        fn(fields)
+    }
+    if err := scanner.Err(); err != nil {
+        log.Fatal(err)
+    }
+}
+
+func parseRune(s string) rune {
+    n, err := strconv.ParseUint(s, 16, 32)
+    if err != nil {
+        log.Fatalf("bad code point %q", s)
+    }
+    return rune(n)
+}
+
+func main() {
+    ucd := flag.String("ucd", ".", "directory holding UnicodeData.txt and CompositionExclusions.txt")
+    version := flag.String("version", "", "Unicode version of the files, for the header")
+    flag.Parse()
+
+    classes := map[rune]uint8{}
+    decompositions := map[rune][]rune{}
+    readUCD(filepath.Join(*ucd, "UnicodeData.txt"), func(fields []string) {
+        if len(fields) < 6 {
+            return
+        }
+        r := parseRune(fields[0])
+        if ccc, _ := strconv.Atoi(fields[3]); ccc != 0 {
+            classes[r] = uint8(ccc)
+        }
+        if fields[5] == "" || strings.HasPrefix(fields[5], "<") {
+            return
+        }
+        for _, part := range strings.Fields(fields[5]) {
+            decompositions[r] = append(decompositions[r], parseRune(part))
+        }
+    })
+    excluded := map[rune]bool{}
+    readUCD(filepath.Join(*ucd, "CompositionExclusions.txt"), func(fields []string) {
+        excluded[parseRune(fields[0])] = true
+    })
+
+    var expand func(r rune) []rune
+    expand = func(r rune) []rune {
+        d, ok := decompositions[r]
+        if !ok {
+            return []rune{r}
+        }
+        out := []rune{}
+        for _, part := range d {
+            out = append(out, expand(part)...)
+        }
+        return out
+    }
+
+    runes := make([]rune, 0, len(decompositions))
+    for r := range decompositions {
+        runes = append(runes, r)
+    }
+    sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+    var decompLines, composeLines []string
+    for _, r := range runes {
+        decompLines = append(decompLines, fmt.Sprintf("0x%04X: %+q,", r, string(expand(r))))
+        d := decompositions[r]
+        if len(d) != 2 || excluded[r] || classes[r] != 0 || classes[d[0]] != 0 {
+            continue
+        }
+        composeLines = append(composeLines, fmt.Sprintf("{0x%04X, 0x%04X}: 0x%04X,", d[0], d[1], r))
+    }
+    classRunes := make([]rune, 0, len(classes))
+    for r := range classes {
+        classRunes = append(classRunes, r)
+    }
+    sort.Slice(classRunes, func(i, j int) bool { return classRunes[i] < classRunes[j] })
+    var classLines []string
+    for _, r := range classRunes {
+        classLines = append(classLines, fmt.Sprintf("0x%04X: %d,", r, classes[r]))
+    }
+
+    w := bufio.NewWriter(os.Stdout)
+    defer w.Flush()
+    fmt.Fprintf(w, `// -------------------------------------------------------
+// backend/handlers/filename_nfc_table.go
+// -------------------------------------------------------
+// Purpose Summary:
+//   - Unicode %s tables for normalizeNFC: canonical combining
+//     classes, full canonical decompositions and primary
+//     compositions.
+// Audit:
+//   - Generated by tools/gen_nfc_table.go from UnicodeData.txt and
+//     CompositionExclusions.txt. Do not edit by hand; regenerate
+//     when moving to a new Unicode version.
+//   - Hangul syllables are composed and decomposed algorithmically
+//     (filename_policy.go) and are not listed here.
+// -------------------------------------------------------
+
+package handlers
+
+`, *version)
+    writeTable(w, "nfcCombiningClass holds every non-zero canonical combining class.",
+        "var nfcCombiningClass = map[rune]uint8{", classLines, 6)
+    fmt.Fprintln(w)
+    writeTable(w, "nfcDecompositions maps a rune to its full canonical decomposition.",
+        "var nfcDecompositions = map[rune]string{", decompLines, 3)
+    fmt.Fprintln(w)
+    writeTable(w, "nfcCompositions maps a starter and the rune after it to their\n// primary composite; composition exclusions are left out.",
+        "var nfcCompositions = map[[2]rune]rune{", composeLines, 3)
+}
+
+// writeTable writes a map literal with perLine entries per line.
+func writeTable(w *bufio.Writer, doc, open string, lines []string, perLine int) {
+    fmt.Fprintf(w, "// %s\n%s\n", doc, open)
+    for i := 0; i < len(lines); i += perLine {
+        end := min(i+perLine, len(lines))
+        fmt.Fprintf(w, "    %s\n", strings.Join(lines[i:end], " "))
+    }
+    fmt.Fprintf(w, "}\n")
+}